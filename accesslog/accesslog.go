@@ -0,0 +1,89 @@
+// Package accesslog logs every request the router serves: method, path,
+// status, latency, client address and user agent, one logrus entry each.
+package accesslog
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware logs each request after its handler returns. Server errors
+// are logged at error level, client errors at warning level and the rest
+// at info level.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		entry := logrus.WithContext(r.Context()).WithFields(logrus.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     sw.status,
+			"bytes":      sw.bytes,
+			"latency":    time.Since(start),
+			"remote_ip":  remoteIP(r),
+			"user_agent": r.UserAgent(),
+		})
+		switch {
+		case sw.status >= 500:
+			entry.Error("request")
+		case sw.status >= 400:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+	})
+}
+
+// remoteIP returns the address of the peer that sent r, without its port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// statusWriter records the response status and how much body was written.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.status, w.wrote = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush lets streamed responses such as /changes through.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
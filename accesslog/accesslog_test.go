@@ -0,0 +1,55 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestMiddleware checks that a request is logged with its method, path,
+// status, client address and user agent, at a level by its status.
+func TestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	defer func() {
+		logrus.SetOutput(os.Stderr)
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}()
+
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+	req := httptest.NewRequest("GET", "/greet?name=Gladys", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	req.Header.Set("User-Agent", "curl/8.4.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &got); err != nil {
+		t.Fatalf("log %q is not one JSON entry: %v", logs.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":      "warning",
+		"method":     "GET",
+		"path":       "/greet",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(len("short and stout")),
+		"remote_ip":  "192.0.2.7",
+		"user_agent": "curl/8.4.0",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("logged %s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["latency"]; !ok {
+		t.Errorf("logged %v, want a latency", got)
+	}
+}
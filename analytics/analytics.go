@@ -0,0 +1,264 @@
+// Package analytics counts requests by route, tenant, country, and day.
+// Counts are kept in memory and periodically merged into storage, so teams
+// without an external analytics stack can still see how the API is used.
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/geoip"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// UsageCollection is the storage collection daily counts live in.
+const UsageCollection = "usage_daily"
+
+// TenantHeader names the tenant a request is made for. Requests without it
+// are counted under Anonymous.
+const TenantHeader = "X-Tenant-ID"
+
+// Anonymous is the tenant of requests that don't name one.
+const Anonymous = "anonymous"
+
+// DayLayout is the format of Row.Day.
+const DayLayout = "2006-01-02"
+
+// maxUpdateRetries bounds retries when another instance updates the same
+// row between our read and write.
+const maxUpdateRetries = 5
+
+// Row is the request count for one route, tenant, and client country on
+// one UTC day. Country is empty when geo-IP lookups are disabled. Tenant
+// identifies a customer, so reports hash it.
+type Row struct {
+	Day     string `json:"day"`
+	Route   string `json:"route"`
+	Tenant  string `json:"tenant" pii:"hash"`
+	Country string `json:"country,omitempty"`
+	Count   int64  `json:"count"`
+}
+
+type key struct {
+	day, route, tenant, country string
+}
+
+// id returns the storage ID of the row for k.
+func (k key) id() string {
+	id := url.PathEscape(k.day) + "|" + url.PathEscape(k.route) + "|" + url.PathEscape(k.tenant)
+	if k.country != "" {
+		id += "|" + k.country
+	}
+	return id
+}
+
+// Aggregator counts requests and flushes the counts to Store.
+type Aggregator struct {
+	Store storage.Store
+
+	mu      sync.Mutex
+	pending map[key]int64
+}
+
+// NewAggregator returns an Aggregator flushing to store.
+func NewAggregator(store storage.Store) *Aggregator {
+	return &Aggregator{Store: store, pending: make(map[key]int64)}
+}
+
+// Middleware counts every request under its route template, so
+// /greetings/{id} is one route however many IDs are fetched. Requests that
+// matched no route are counted as "unmatched".
+func (a *Aggregator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tmpl, err := cur.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		tenant := strings.TrimSpace(r.Header.Get(TenantHeader))
+		if tenant == "" {
+			tenant = Anonymous
+		}
+		loc, _ := geoip.FromContext(r.Context())
+		a.Add(time.Now(), r.Method+" "+route, tenant, loc.Country, 1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Add counts n requests to route for tenant from country at t.
+func (a *Aggregator) Add(t time.Time, route, tenant, country string, n int64) {
+	k := key{day: t.UTC().Format(DayLayout), route: route, tenant: tenant, country: country}
+	a.mu.Lock()
+	a.pending[k] += n
+	a.mu.Unlock()
+}
+
+// Flush merges pending counts into storage. Counts that fail to merge are
+// put back and retried on the next flush.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[key]int64)
+	a.mu.Unlock()
+
+	var firstErr error
+	for k, n := range pending {
+		if err := a.merge(ctx, k, n); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			a.mu.Lock()
+			a.pending[k] += n
+			a.mu.Unlock()
+		}
+	}
+	return firstErr
+}
+
+func (a *Aggregator) merge(ctx context.Context, k key, n int64) error {
+	for i := 0; i < maxUpdateRetries; i++ {
+		rec, err := a.Store.Get(ctx, UsageCollection, k.id())
+		if errors.Is(err, storage.ErrNotFound) {
+			data, _ := json.Marshal(Row{Day: k.day, Route: k.route, Tenant: k.tenant, Country: k.country, Count: n})
+			_, err = a.Store.Create(ctx, UsageCollection, k.id(), data)
+			if errors.Is(err, storage.ErrExists) {
+				continue
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		var row Row
+		if err := json.Unmarshal(rec.Data, &row); err != nil {
+			return err
+		}
+		row.Count += n
+		data, _ := json.Marshal(row)
+		_, err = a.Store.Update(ctx, UsageCollection, rec.ID, data, rec.Version)
+		if !errors.Is(err, storage.ErrVersionMismatch) {
+			return err
+		}
+	}
+	return storage.ErrVersionMismatch
+}
+
+// Run flushes every interval until ctx is done, then flushes once more.
+func (a *Aggregator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the last flush needs its own.
+			if err := a.Flush(context.Background()); err != nil {
+				logrus.WithError(err).Error("analytics: final flush")
+			}
+			return
+		case <-ticker.C:
+			if err := a.Flush(ctx); err != nil {
+				logrus.WithError(err).Error("analytics: flushing counts")
+			}
+		}
+	}
+}
+
+// Filter selects rows. Empty fields match everything; From and To are
+// inclusive days in DayLayout.
+type Filter struct {
+	From, To               string
+	Route, Tenant, Country string
+}
+
+func (f Filter) match(r Row) bool {
+	return (f.From == "" || r.Day >= f.From) &&
+		(f.To == "" || r.Day <= f.To) &&
+		(f.Route == "" || r.Route == f.Route) &&
+		(f.Tenant == "" || r.Tenant == f.Tenant) &&
+		(f.Country == "" || r.Country == f.Country)
+}
+
+// Query returns the stored rows matching f, sorted by day, route, tenant,
+// and country. Counts not yet flushed aren't included.
+func (a *Aggregator) Query(ctx context.Context, f Filter) ([]Row, error) {
+	recs, err := a.Store.List(ctx, UsageCollection, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rows := []Row{}
+	for _, rec := range recs {
+		var row Row
+		if err := json.Unmarshal(rec.Data, &row); err == nil && f.match(row) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Country < b.Country
+	})
+	return rows, nil
+}
+
+// GroupBy sums rows over every dimension except by, which is "day",
+// "route", "tenant", or "country". The other dimensions of the result are
+// empty.
+func GroupBy(rows []Row, by string) ([]Row, error) {
+	totals := make(map[string]int64)
+	var order []string
+	for _, r := range rows {
+		var k string
+		switch by {
+		case "day":
+			k = r.Day
+		case "route":
+			k = r.Route
+		case "tenant":
+			k = r.Tenant
+		case "country":
+			k = r.Country
+		default:
+			return nil, errors.New("analytics: group_by must be day, route, tenant, or country")
+		}
+		if _, ok := totals[k]; !ok {
+			order = append(order, k)
+		}
+		totals[k] += r.Count
+	}
+	sort.Strings(order)
+	out := make([]Row, 0, len(order))
+	for _, k := range order {
+		row := Row{Count: totals[k]}
+		switch by {
+		case "day":
+			row.Day = k
+		case "route":
+			row.Route = k
+		case "tenant":
+			row.Tenant = k
+		case "country":
+			row.Country = k
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
@@ -0,0 +1,66 @@
+package analytics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestMiddlewareFlush checks that requests are counted by route template
+// and tenant, and that repeated flushes add to the stored rows.
+func TestMiddlewareFlush(t *testing.T) {
+	ctx := context.Background()
+	a := NewAggregator(storage.NewMemory())
+	r := mux.NewRouter()
+	r.Use(a.Middleware)
+	r.HandleFunc("/greetings/{id}", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+
+	get := func(path, tenant string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	get("/greetings/1", "acme")
+	get("/greetings/2", "acme")
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	get("/greetings/3", "acme")
+	get("/greetings/3", "")
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	rows, err := a.Query(ctx, Filter{Route: "GET /greetings/{id}"})
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("Query() = %+v, %v, want 2 rows", rows, err)
+	}
+	today := time.Now().UTC().Format(DayLayout)
+	if rows[0] != (Row{today, "GET /greetings/{id}", "acme", "", 3}) || rows[1].Tenant != Anonymous || rows[1].Count != 1 {
+		t.Errorf("Query() = %+v, want acme=3 and anonymous=1", rows)
+	}
+}
+
+// TestGroupBy checks summing over every dimension but one.
+func TestGroupBy(t *testing.T) {
+	rows := []Row{
+		{"2026-01-01", "GET /greet", "acme", "DE", 2},
+		{"2026-01-02", "GET /greet", "globex", "FR", 3},
+		{"2026-01-02", "POST /greetings", "acme", "DE", 1},
+	}
+	got, err := GroupBy(rows, "tenant")
+	if err != nil || len(got) != 2 || got[0] != (Row{Tenant: "acme", Count: 3}) || got[1] != (Row{Tenant: "globex", Count: 3}) {
+		t.Fatalf("GroupBy(tenant) = %+v, %v, want acme=3 globex=3", got, err)
+	}
+	if _, err := GroupBy(rows, "hour"); err == nil {
+		t.Errorf("GroupBy(hour) error = nil, want error")
+	}
+}
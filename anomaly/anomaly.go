@@ -0,0 +1,330 @@
+// Package anomaly watches each route's request rate and error rate and
+// raises an alert when one deviates sharply from its baseline. Baselines
+// are exponentially weighted moving averages (EWMA) of the rates and of
+// their variance. A sample more than Threshold standard deviations from
+// its baseline is anomalous. Alerts are published on the event bus, which
+// webhooks forward, and sent as notifications to the configured users.
+package anomaly
+
+import (
+	"bufio"
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/notify"
+)
+
+// Signals watched per route.
+const (
+	// RequestRate is requests per second.
+	RequestRate = "request_rate"
+	// ErrorRate is the fraction of requests answered with a 5xx.
+	ErrorRate = "error_rate"
+)
+
+var (
+	zScores = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "anomaly_zscore",
+		Help: "Standard deviations the last sample was from its baseline, by route and signal.",
+	}, []string{"route", "signal"})
+	alerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anomaly_alerts_total",
+		Help: "Traffic anomalies detected, by route and signal.",
+	}, []string{"route", "signal"})
+)
+
+// Config controls how sensitive the detector is.
+type Config struct {
+	// Interval between samples.
+	Interval time.Duration
+	// Alpha weighs each sample into the baseline, between 0 and 1: higher
+	// values follow changes faster.
+	Alpha float64
+	// Threshold is how many standard deviations from the baseline a
+	// sample must be to alert; lower is more sensitive.
+	Threshold float64
+	// Warmup is how many samples a baseline needs before it alerts.
+	Warmup int
+	// MinRequests is how many requests a sample needs for its error rate
+	// to count, so one failure on a quiet route isn't an anomaly.
+	MinRequests int64
+}
+
+// DefaultConfig is used for zero fields of a Config.
+var DefaultConfig = Config{
+	Interval:    time.Minute,
+	Alpha:       0.3,
+	Threshold:   4,
+	Warmup:      10,
+	MinRequests: 20,
+}
+
+// Alert describes an anomalous sample. It is the data of the
+// events.TrafficAnomaly events published.
+type Alert struct {
+	Route  string  `json:"route"`
+	Signal string  `json:"signal"`
+	Value  float64 `json:"value"`
+	// Baseline and StdDev are the baseline before the sample, StdDev
+	// floored as the z-score is.
+	Baseline float64   `json:"baseline"`
+	StdDev   float64   `json:"std_dev"`
+	ZScore   float64   `json:"z_score"`
+	Time     time.Time `json:"time"`
+}
+
+// ewma is a baseline: a moving average and variance.
+type ewma struct {
+	mean, variance float64
+	samples        int
+	// alerting is set while samples stay anomalous, so a lasting shift
+	// alerts once.
+	alerting bool
+}
+
+// minStdDev floors a baseline's standard deviation, as a fraction of its
+// mean and absolutely, so steady traffic doesn't make every wobble
+// infinitely unlikely.
+const (
+	minStdDevFraction = 0.05
+	minStdDev         = 0.02
+)
+
+// stdDev returns the baseline's floored standard deviation.
+func (e *ewma) stdDev() float64 {
+	return math.Max(math.Sqrt(e.variance), math.Max(minStdDevFraction*math.Abs(e.mean), minStdDev))
+}
+
+// observe folds x into the baseline and returns its z-score against the
+// baseline before it, or 0 while the baseline is warming up.
+func (e *ewma) observe(x, alpha float64, warmup int) float64 {
+	var z float64
+	if e.samples >= warmup {
+		z = (x - e.mean) / e.stdDev()
+	}
+	if e.samples == 0 {
+		e.mean = x
+	} else {
+		d := x - e.mean
+		e.mean += alpha * d
+		e.variance = (1 - alpha) * (e.variance + alpha*d*d)
+	}
+	e.samples++
+	return z
+}
+
+// counts is one route's traffic since the last sample.
+type counts struct {
+	requests, errors int64
+}
+
+// route is one route's baselines.
+type route struct {
+	rate, errors ewma
+}
+
+// Detector counts requests per route and samples them on an interval.
+type Detector struct {
+	cfg Config
+	// Bus receives an events.TrafficAnomaly event per alert; nil drops
+	// them.
+	Bus *events.Bus
+	// Notify sends every alert to Users; nil sends none.
+	Notify *notify.Service
+	Users  []string
+
+	mu      sync.Mutex
+	pending map[string]*counts
+	routes  map[string]*route
+}
+
+// New returns a Detector using cfg, with zero fields taken from
+// DefaultConfig.
+func New(cfg Config) *Detector {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultConfig.Interval
+	}
+	if cfg.Alpha <= 0 || cfg.Alpha > 1 {
+		cfg.Alpha = DefaultConfig.Alpha
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultConfig.Threshold
+	}
+	if cfg.Warmup <= 0 {
+		cfg.Warmup = DefaultConfig.Warmup
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = DefaultConfig.MinRequests
+	}
+	return &Detector{cfg: cfg, pending: make(map[string]*counts), routes: make(map[string]*route)}
+}
+
+// Middleware counts every request and its 5xx responses under its method
+// and route template. Install it inside the router, where the route is
+// known.
+func (d *Detector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := "unmatched"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tmpl, err := cur.GetPathTemplate(); err == nil {
+				name = tmpl
+			}
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		d.add(r.Method+" "+name, sw.status >= 500)
+	})
+}
+
+func (d *Detector) add(name string, failed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.pending[name]
+	if c == nil {
+		c = &counts{}
+		d.pending[name] = c
+	}
+	c.requests++
+	if failed {
+		c.errors++
+	}
+}
+
+// Run samples every interval until ctx is canceled.
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, a := range d.sample(now) {
+				d.alert(ctx, a)
+			}
+		}
+	}
+}
+
+// sample folds the counts since the last sample into the baselines and
+// returns the alerts they raise, by route. Routes seen before but idle
+// since sample zero requests, so traffic stopping is an anomaly too.
+func (d *Detector) sample(now time.Time) []Alert {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[string]*counts)
+	d.mu.Unlock()
+
+	for name := range pending {
+		if d.routes[name] == nil {
+			d.routes[name] = &route{}
+		}
+	}
+	names := make([]string, 0, len(d.routes))
+	for name := range d.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []Alert
+	for _, name := range names {
+		rt, c := d.routes[name], pending[name]
+		if c == nil {
+			c = &counts{}
+		}
+		rate := float64(c.requests) / d.cfg.Interval.Seconds()
+		if a, ok := d.check(&rt.rate, name, RequestRate, rate, now); ok {
+			out = append(out, a)
+		}
+		if c.requests >= d.cfg.MinRequests {
+			errRate := float64(c.errors) / float64(c.requests)
+			if a, ok := d.check(&rt.errors, name, ErrorRate, errRate, now); ok {
+				out = append(out, a)
+			}
+		}
+	}
+	return out
+}
+
+// check folds value into e and reports an alert if it is anomalous and
+// the previous sample wasn't.
+func (d *Detector) check(e *ewma, name, signal string, value float64, now time.Time) (Alert, bool) {
+	mean, sd := e.mean, e.stdDev()
+	z := e.observe(value, d.cfg.Alpha, d.cfg.Warmup)
+	zScores.WithLabelValues(name, signal).Set(z)
+	anomalous := math.Abs(z) >= d.cfg.Threshold
+	raise := anomalous && !e.alerting
+	e.alerting = anomalous
+	if !raise {
+		return Alert{}, false
+	}
+	return Alert{Route: name, Signal: signal, Value: value, Baseline: mean, StdDev: sd, ZScore: z, Time: now.UTC()}, true
+}
+
+// alert logs, counts, publishes and sends a.
+func (d *Detector) alert(ctx context.Context, a Alert) {
+	alerts.WithLabelValues(a.Route, a.Signal).Inc()
+	logrus.WithFields(logrus.Fields{
+		"route":    a.Route,
+		"signal":   a.Signal,
+		"value":    a.Value,
+		"baseline": a.Baseline,
+		"z_score":  a.ZScore,
+	}).Warn("traffic anomaly")
+	e := d.Bus.Publish(ctx, events.TrafficAnomaly, a)
+	if d.Notify == nil {
+		return
+	}
+	for _, user := range d.Users {
+		if _, err := d.Notify.Notify(ctx, user, e); err != nil {
+			logrus.WithError(err).WithField("user", user).Error("anomaly: sending alert")
+		}
+	}
+}
+
+// statusWriter records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.status, w.wrote = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed responses such as /changes through.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
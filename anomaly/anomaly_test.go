@@ -0,0 +1,66 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+)
+
+// feed adds requests to name, failed of them failing, and samples.
+func feed(d *Detector, name string, requests, failed int) []Alert {
+	for i := 0; i < requests; i++ {
+		d.add(name, i < failed)
+	}
+	return d.sample(time.Now())
+}
+
+// TestSample checks that steady traffic raises nothing, that a spike in
+// requests and one in errors each alert once, and that warmup holds
+// alerts back.
+func TestSample(t *testing.T) {
+	d := New(Config{Interval: time.Second, Warmup: 5})
+	route := "GET /greet"
+	for i := 0; i < 10; i++ {
+		if alerts := feed(d, route, 100+i%3, 1); len(alerts) != 0 {
+			t.Fatalf("sample %d of steady traffic = %+v, want no alerts", i, alerts)
+		}
+	}
+
+	alerts := feed(d, route, 400, 4)
+	if len(alerts) != 1 || alerts[0].Signal != RequestRate || alerts[0].Value != 400 {
+		t.Fatalf("sample of a spike = %+v, want one request rate alert", alerts)
+	}
+	if alerts := feed(d, route, 400, 4); len(alerts) != 0 {
+		t.Errorf("second sample of the spike = %+v, want it alerted once", alerts)
+	}
+
+	d = New(Config{Interval: time.Second, Warmup: 5})
+	for i := 0; i < 10; i++ {
+		feed(d, route, 100, 0)
+	}
+	alerts = feed(d, route, 100, 30)
+	if len(alerts) != 1 || alerts[0].Signal != ErrorRate || alerts[0].Value != 0.3 {
+		t.Errorf("sample of failures = %+v, want one error rate alert", alerts)
+	}
+
+	d = New(Config{Interval: time.Second, Warmup: 5})
+	feed(d, route, 10, 0)
+	if alerts := feed(d, route, 1000, 0); len(alerts) != 0 {
+		t.Errorf("spike during warmup = %+v, want no alerts", alerts)
+	}
+}
+
+// TestAlert checks that alerts are published as events.
+func TestAlert(t *testing.T) {
+	bus := events.NewBus()
+	var got []events.Event
+	bus.Subscribe(func(ctx context.Context, e events.Event) { got = append(got, e) })
+	d := New(Config{})
+	d.Bus = bus
+	d.alert(context.Background(), Alert{Route: "GET /greet", Signal: RequestRate, Value: 400, Baseline: 100, ZScore: 12})
+	if len(got) != 1 || got[0].Type != events.TrafficAnomaly || got[0].Data.(Alert).Route != "GET /greet" {
+		t.Errorf("published = %+v, want one %s event", got, events.TrafficAnomaly)
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/approval"
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/config"
+	"github.com/Shulammite-Aso/bazel-demo-app/handlers"
+	"github.com/Shulammite-Aso/bazel-demo-app/health"
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/notify"
+	"github.com/Shulammite-Aso/bazel-demo-app/operations"
+	"github.com/Shulammite-Aso/bazel-demo-app/paginate"
+	"github.com/Shulammite-Aso/bazel-demo-app/pii"
+	"github.com/Shulammite-Aso/bazel-demo-app/presence"
+	"github.com/Shulammite-Aso/bazel-demo-app/privacy"
+	"github.com/Shulammite-Aso/bazel-demo-app/querylog"
+	"github.com/Shulammite-Aso/bazel-demo-app/sla"
+	"github.com/Shulammite-Aso/bazel-demo-app/status"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/webhooks"
+	"github.com/Shulammite-Aso/bazel-demo-app/wellknown"
+)
+
+// Memory is the service on fresh in-memory backends, for benchmarks and
+// tests. Its fields give tests a handle on the backends behind Deps.
+type Memory struct {
+	Deps
+	// Backing is the store under Deps.Store's outbox and query log.
+	Backing *storage.Memory
+	// Cache is the cache presence is tracked and sessions are kept in.
+	Cache *cache.LRU
+	// Users are the accounts POST /login accepts; none to begin with.
+	Users auth.StaticCredentials
+}
+
+// NewMemory returns the service on in-memory backends that tell time by
+// now, or by the wall clock if now is nil. Tokens signed with
+// auth.DevSecret are accepted.
+func NewMemory(now func() time.Time) *Memory {
+	if now == nil {
+		now = time.Now
+	}
+	backing := storage.NewMemory()
+	backing.SetClock(now)
+	queries := querylog.New(backing, querylog.Config{})
+	queries.SetClock(now)
+	outbox := storage.NewOutbox(queries, handlers.GreetingsCollection)
+	store := storage.Store(outbox)
+	presenceCache := cache.NewLRU(0, 0, time.Minute)
+	presenceCache.SetClock(now)
+	registry := clients.NewRegistry(clients.Config{})
+	registry.SetClock(now)
+	files, _ := wellknown.New(wellknown.Config{})
+	fingerprints, _ := config.NewFingerprints(viper.New())
+	verifier, _ := auth.NewVerifier(auth.Config{
+		SigningKey: "default",
+		Keys:       map[string]auth.Key{"default": {Secret: []byte(auth.DevSecret)}},
+	})
+	verifier.SetClock(now)
+	users := auth.StaticCredentials{}
+	login := handlers.NewLogin(users, verifier, time.Hour)
+	login.Sessions = auth.NewSessions(presenceCache, auth.DefaultRefreshTTL)
+	trail := audit.NewLog(store)
+	verifier.OnImpersonation(trail.Impersonated)
+	approvals := approval.NewManager(store, trail, 0)
+	approvals.SetClock(now)
+	redactor := pii.NewRedactor(nil)
+	for collection, model := range PIIModels {
+		redactor.Register(collection, model)
+	}
+	checks := health.NewRegistry()
+	checks.Register("storage", 0, health.Storage(store))
+	checks.Register("cache", 0, health.Cache(presenceCache))
+	levels := sla.NewRecorder(store)
+	levels.SetClock(now)
+	data, _ := privacy.NewService(store, trail, PrivacySources...)
+	data.SetClock(now)
+	data.PII = redactor
+	return &Memory{
+		Deps: Deps{
+			Store:         store,
+			Outbox:        outbox,
+			Cursors:       paginate.NewSigner(nil),
+			Webhooks:      webhooks.NewService(store),
+			Notify:        notify.NewService(store),
+			Catalog:       i18n.NewCatalog(store),
+			Status:        &status.Reporter{Store: store, Health: checks},
+			Analytics:     analytics.NewAggregator(store),
+			SLA:           levels,
+			WellKnown:     files,
+			Clients:       registry,
+			Presence:      presence.NewTracker(presenceCache, nil, presence.DefaultTTL),
+			Config:        fingerprints,
+			Auth:          verifier,
+			Login:         login,
+			Impersonation: handlers.NewImpersonation(verifier, trail, 0, "admin", pii.Scope),
+			Queries:       queries,
+			Audit:         trail,
+			Approvals:     approvals,
+			Cache:         presenceCache,
+			Privacy:       data,
+			Operations:    operations.NewManager(store),
+			PII:           redactor,
+			QR:            handlers.NewQR(cache.NewLRU(100, 0, 0)),
+		},
+		Backing: backing,
+		Cache:   presenceCache,
+		Users:   users,
+	}
+}
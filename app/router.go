@@ -0,0 +1,520 @@
+// Package app assembles the service: the router, its middleware, and the
+// shared services routes are built on. The server command runs it with
+// configured backends; NewMemory and the testserver package run it with
+// in-memory ones.
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/accesslog"
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/anomaly"
+	"github.com/Shulammite-Aso/bazel-demo-app/approval"
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/bodylimit"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/canary"
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/compress"
+	"github.com/Shulammite-Aso/bazel-demo-app/config"
+	"github.com/Shulammite-Aso/bazel-demo-app/contentfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/ctxerr"
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/geoip"
+	"github.com/Shulammite-Aso/bazel-demo-app/handlers"
+	"github.com/Shulammite-Aso/bazel-demo-app/httpmetrics"
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/ipfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/limits"
+	"github.com/Shulammite-Aso/bazel-demo-app/locale"
+	"github.com/Shulammite-Aso/bazel-demo-app/metering"
+	"github.com/Shulammite-Aso/bazel-demo-app/middleware"
+	"github.com/Shulammite-Aso/bazel-demo-app/mirror"
+	"github.com/Shulammite-Aso/bazel-demo-app/normalize"
+	"github.com/Shulammite-Aso/bazel-demo-app/notify"
+	"github.com/Shulammite-Aso/bazel-demo-app/operations"
+	"github.com/Shulammite-Aso/bazel-demo-app/paginate"
+	"github.com/Shulammite-Aso/bazel-demo-app/patch"
+	"github.com/Shulammite-Aso/bazel-demo-app/pii"
+	"github.com/Shulammite-Aso/bazel-demo-app/pipeline"
+	"github.com/Shulammite-Aso/bazel-demo-app/plans"
+	"github.com/Shulammite-Aso/bazel-demo-app/presence"
+	"github.com/Shulammite-Aso/bazel-demo-app/privacy"
+	"github.com/Shulammite-Aso/bazel-demo-app/profiling"
+	"github.com/Shulammite-Aso/bazel-demo-app/querylog"
+	"github.com/Shulammite-Aso/bazel-demo-app/recovery"
+	"github.com/Shulammite-Aso/bazel-demo-app/requestid"
+	"github.com/Shulammite-Aso/bazel-demo-app/retention"
+	"github.com/Shulammite-Aso/bazel-demo-app/routes"
+	"github.com/Shulammite-Aso/bazel-demo-app/securityheaders"
+	"github.com/Shulammite-Aso/bazel-demo-app/sla"
+	"github.com/Shulammite-Aso/bazel-demo-app/status"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/tenancy"
+	"github.com/Shulammite-Aso/bazel-demo-app/timeout"
+	"github.com/Shulammite-Aso/bazel-demo-app/transform"
+	"github.com/Shulammite-Aso/bazel-demo-app/tts"
+	"github.com/Shulammite-Aso/bazel-demo-app/txn"
+	"github.com/Shulammite-Aso/bazel-demo-app/useragent"
+	"github.com/Shulammite-Aso/bazel-demo-app/webhooks"
+	"github.com/Shulammite-Aso/bazel-demo-app/wellknown"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Layer is a middleware layer with a name, so benchmarks and logs can
+// refer to individual layers.
+type Layer struct {
+	Name       string
+	Middleware mux.MiddlewareFunc
+}
+
+// Middleware returns the layers applied to every route, outermost first.
+func Middleware() []Layer {
+	gen, err := requestid.NewGenerator(viper.GetString("requestid.generator"), viper.GetInt64("requestid.node"))
+	if err != nil {
+		logrus.WithError(err).Warn("request IDs: falling back to UUIDs")
+		gen = requestid.UUID
+	}
+	// First, so every other layer can log the request's ID.
+	layers := []Layer{{"requestid", requestid.Middleware(gen)}}
+	if viper.GetBool("accesslog.enabled") {
+		// Outermost, so latency covers every other layer.
+		layers = append(layers, Layer{"accesslog", accesslog.Middleware})
+	}
+	// Outside recovery, so a panic counts as the 500 it becomes.
+	layers = append(layers, Layer{"httpmetrics", httpmetrics.Middleware})
+	// Inside the access log, so it logs the 500 a panic becomes.
+	layers = append(layers, Layer{"recovery", recovery.Middleware})
+	if viper.GetBool("security_headers.enabled") {
+		layers = append(layers, Layer{"securityheaders", securityheaders.Middleware(securityheaders.Config{
+			ContentSecurityPolicy: viper.GetString("security_headers.content_security_policy"),
+			FrameOptions:          viper.GetString("security_headers.frame_options"),
+			ReferrerPolicy:        viper.GetString("security_headers.referrer_policy"),
+		})})
+	}
+	// Before any handler or layer reads a body.
+	layers = append(layers, Layer{"bodylimit", bodylimit.Middleware(viper.GetInt64("server.max_body_bytes"))})
+	if viper.GetBool("compress.enabled") {
+		// Outside the rest, so it compresses what the other layers write too.
+		layers = append(layers, Layer{"compress", compress.New(compress.Config{
+			MinSize: viper.GetInt("compress.min_size"),
+			Types:   viper.GetStringSlice("compress.types"),
+		})})
+	}
+	return append(layers,
+		Layer{"ctxerr", ctxerr.Middleware},
+		// QR codes encode ?data= byte for byte, up to their own limit.
+		Layer{"normalize", normalize.Query(normalize.DefaultMaxLen, map[string][]string{"/qr": {"data"}})},
+		Layer{"locale", locale.Middleware},
+		Layer{"useragent", useragent.NewParser(viper.GetStringSlice("useragent.health_checkers")).Middleware},
+	)
+}
+
+// Chain wraps h in layers so that layers[0] runs first.
+func Chain(h http.Handler, layers []Layer) http.Handler {
+	for i := len(layers) - 1; i >= 0; i-- {
+		h = layers[i].Middleware(h)
+	}
+	return h
+}
+
+// Deps are the shared services routes are built on.
+type Deps struct {
+	Store     storage.Store
+	Outbox    *storage.Outbox
+	Cursors   *paginate.Signer
+	Events    *events.Bus
+	Webhooks  *webhooks.Service
+	Notify    *notify.Service
+	Catalog   *i18n.Catalog
+	Status    *status.Reporter
+	Analytics *analytics.Aggregator
+	WellKnown *wellknown.Handler
+	Clients   *clients.Registry
+	Presence  *presence.Tracker
+	Limits    limits.Report
+	Config    *config.Fingerprints
+	// Auth verifies the bearer tokens of protected routes.
+	Auth *auth.Verifier
+	// Login issues tokens at POST /login, and refreshes them when its
+	// Sessions is set; nil when logins are off.
+	Login *handlers.Login
+	// Impersonation issues admins tokens acting as users at POST
+	// /admin/impersonate; nil when impersonation is off.
+	Impersonation *handlers.Impersonation
+	// QR renders QR codes at /qr, each client IP limited by QRLimit; nil
+	// when qr.enabled is off. A nil QRLimit doesn't limit them.
+	QR      *handlers.QR
+	QRLimit *middleware.Limiter
+	// Queries times the storage queries; nil when they aren't logged.
+	Queries *querylog.Store
+	// Retention applies retention policies; nil when none are configured.
+	Retention *retention.Purger
+	// Approvals holds purges and cache flushes until a second admin
+	// approves them at /admin/approvals; nil runs them at once.
+	Approvals *approval.Manager
+	// Plans meters requests by their tenant's or client's plan, managed
+	// at /admin/plans; nil when plans are off.
+	Plans *plans.Service
+	// Metering counts billable usage per tenant, exported at
+	// /admin/usage; nil when metering is off.
+	Metering *metering.Meter
+	// SLA records each endpoint's availability and latency, reported at
+	// /admin/sla; nil when it isn't recorded.
+	SLA *sla.Recorder
+	// Anomaly watches each route's request and error rates; nil when
+	// anomaly detection is off.
+	Anomaly *anomaly.Detector
+	// Timeouts are the handler deadlines by route; nil when handlers
+	// may run as long as they like.
+	Timeouts *timeout.Config
+	// RateLimit limits requests per client IP, shared by every listener's
+	// router; nil when ratelimit.enabled is off.
+	RateLimit *middleware.Limiter
+	// IPFilter rejects requests to ipfilter.routes from addresses it
+	// doesn't allow; nil when addresses aren't filtered.
+	IPFilter *ipfilter.Filter
+	// Cache is the shared cache admins flush at POST /admin/cache/flush;
+	// nil when it can't be flushed.
+	Cache cache.Flusher
+	// Audit is the audit trail admins read at /admin/audit.
+	Audit *audit.Log
+	// Privacy exports and erases users' data, exports running as
+	// Operations; nil when data requests aren't served.
+	Privacy    *privacy.Service
+	Operations *operations.Manager
+	// PII redacts personal fields from analytics reports and exports.
+	PII *pii.Redactor
+	// Pipeline generates the greetings of /greet and /greet-many; nil
+	// uses pipeline.Default.
+	Pipeline *pipeline.Pipeline
+	// ContentFilter rejects offensive names and messages before they are
+	// stored or greeted; nil when content isn't filtered.
+	ContentFilter *contentfilter.Filter
+	// Speaker speaks greetings at /greet/audio; nil when tts.enabled is
+	// off.
+	Speaker *tts.Speaker
+	// Transform holds response hooks by route path.
+	Transform transform.Routes
+	// Canary holds variant routing rules by route path.
+	Canary map[string]canary.Config
+	// Mirror is nil when shadow traffic is off.
+	Mirror *mirror.Mirror
+	// GeoIP is nil when no geo-IP database is configured.
+	GeoIP geoip.Lookuper
+	// Static serves static assets under static.prefix; nil when
+	// static.dir is unset.
+	Static http.Handler
+}
+
+// PrivacySources are the collections holding data about users, erased
+// when they ask: greetings name their user and are anonymized, and
+// notification preferences are keyed by user and deleted.
+var PrivacySources = []privacy.Source{
+	{Collection: handlers.GreetingsCollection, Field: "name", Erase: privacy.Anonymize, Fields: []string{"message"}},
+	{Collection: notify.PreferencesCollection, Erase: privacy.Delete},
+}
+
+// EncryptedModels are the models of the collections with fields tagged
+// for encryption, sealed at rest once encryption keys are configured.
+var EncryptedModels = map[string]interface{}{
+	notify.PreferencesCollection:     notify.Preferences{},
+	webhooks.SubscriptionsCollection: webhooks.Subscription{},
+}
+
+// PIIModels are the models of the collections with fields tagged as
+// personal, redacted from exports of their records.
+var PIIModels = map[string]interface{}{
+	handlers.GreetingsCollection: handlers.SavedGreeting{},
+	notify.PreferencesCollection: notify.Preferences{},
+}
+
+// NewRouter returns the application's router with the middleware chain
+// installed and every route include accepts, or every route if include is
+// nil.
+func NewRouter(deps Deps, include func(path string) bool) *mux.Router {
+	router := mux.NewRouter()
+	reg := routes.New(router)
+	reg.Include = include
+	router.NotFoundHandler = http.HandlerFunc(reg.NotFound)
+	for _, m := range Middleware() {
+		router.Use(m.Middleware)
+	}
+	if deps.IPFilter != nil {
+		// On ipfilter.routes (by default /admin/*). First, so a rejected
+		// address costs the least work.
+		router.Use(deps.IPFilter.Middleware(routes.Match(viper.GetStringSlice("ipfilter.routes")...)))
+	}
+	if deps.RateLimit != nil {
+		// Per client IP, on ratelimit.routes (paths or prefixes such as
+		// /login or /admin/*; none means every route). Before identifying
+		// clients, so a flood from one address costs the least work.
+		router.Use(deps.RateLimit.For(routes.Match(viper.GetStringSlice("ratelimit.routes")...)))
+	}
+	// Identify and rate-limit clients before any other work is done.
+	router.Use(deps.Clients.Middleware)
+	if deps.GeoIP != nil {
+		router.Use(geoip.Middleware(deps.GeoIP))
+	}
+	// Counting needs the matched route template, so unlike the chain it
+	// only works inside the router.
+	router.Use(deps.Analytics.Middleware)
+	if deps.SLA != nil {
+		// Outside the timeouts, so it counts their 504s.
+		router.Use(deps.SLA.Middleware)
+	}
+	if deps.Anomaly != nil {
+		router.Use(deps.Anomaly.Middleware)
+	}
+	if deps.Timeouts != nil {
+		// Inside the counting above, so they see the 504s.
+		router.Use(timeout.Middleware(*deps.Timeouts))
+	}
+	if deps.Mirror != nil {
+		router.Use(deps.Mirror.Middleware)
+	}
+	if viper.GetBool("auth.authorize") {
+		router.Use(deps.Auth.Authorize(reg.Required))
+	}
+	if viper.GetBool("tenancy.enabled") {
+		router.Use(tenancy.Middleware(deps.Auth, routes.Match("/admin/*")))
+	}
+	if deps.Metering != nil {
+		// After tenancy, so requests are billed to the tenant they act for.
+		router.Use(deps.Metering.Middleware)
+	}
+	if deps.Plans != nil {
+		// After tenancy, so tenants are metered by their own plan. Admin
+		// routes and probes aren't metered.
+		router.Use(deps.Plans.Middleware(routes.Match("/admin/*", "/healthz", "/readyz", "/metrics")))
+	}
+	router.Use(reg.ContentTypes)
+	router.Use(reg.Deprecations)
+	if len(deps.Transform) > 0 {
+		router.Use(deps.Transform.Middleware)
+	}
+	if viper.GetBool("storage.transactions") {
+		// Innermost, so it sees the status handlers set.
+		router.Use(txn.Middleware(deps.Store))
+	}
+
+	reg.Handle(wellknown.RobotsPath, deps.WellKnown.Robots, "GET")
+	reg.Handle(wellknown.FaviconPath, deps.WellKnown.Favicon, "GET")
+	reg.Handle(wellknown.SecurityTxtPath, deps.WellKnown.SecurityTxt, "GET")
+	reg.Handle(wellknown.ChangePasswordPath, deps.WellKnown.ChangePassword, "GET")
+	// Registered even for HS256-only configs, which get 404, so a reload
+	// that moves to key pairs publishes them.
+	reg.Handle(auth.JWKSPath, deps.Auth.ServeJWKS, "GET").
+		Returns(http.StatusOK, jwksSchema).
+		Returns(http.StatusNotFound, errorSchema).
+		Example(routes.Example{Name: "no key pairs", Target: auth.JWKSPath, Status: http.StatusNotFound})
+	if deps.Static != nil {
+		prefix := strings.TrimSuffix(viper.GetString("static.prefix"), "/")
+		reg.Handle(prefix+"/{file:.+}", http.StripPrefix(prefix, deps.Static).ServeHTTP, "GET", "HEAD")
+	}
+
+	if deps.Login != nil {
+		reg.Handle("/login", deps.Login.Post, "POST").
+			Returns(http.StatusOK, tokenSchema).
+			Returns(http.StatusBadRequest, errorSchema).
+			Returns(http.StatusUnauthorized, errorSchema).
+			Example(routes.Example{Name: "wrong password", Target: "/login", Body: `{"username":"nobody","password":"wrong"}`, Status: http.StatusUnauthorized})
+		if deps.Login.Sessions != nil {
+			reg.Handle("/token/refresh", deps.Login.Refresh, "POST").
+				Returns(http.StatusOK, tokenSchema).
+				Returns(http.StatusBadRequest, errorSchema).
+				Returns(http.StatusUnauthorized, errorSchema).
+				Example(routes.Example{Name: "unknown token", Target: "/token/refresh", Body: `{"refresh_token":"unknown"}`, Status: http.StatusUnauthorized})
+			reg.Handle("/logout", deps.Login.Logout, "POST")
+		}
+	}
+
+	translations := handlers.NewTranslations(deps.Catalog)
+	if deps.Pipeline != nil {
+		translations.Pipeline = deps.Pipeline
+	}
+	translations.Filter = deps.ContentFilter
+	reg.Handle("/greet", translations.Greet, "GET")
+	if deps.Speaker != nil {
+		translations.Speaker = deps.Speaker
+		reg.Handle("/greet/audio", translations.Audio, "GET")
+	}
+	greetMany := canary.Split("/greet-many", deps.Canary["/greet-many"], translations.GreetMany, map[string]http.HandlerFunc{
+		"buffered": translations.GreetManyBuffered,
+	})
+	reg.Handle("/greet-many", deps.Auth.Require(greetMany), "GET", "POST")
+	reg.Handle("/greeting-translations", translations.List, "GET").
+		Returns(http.StatusOK, listOf(translationSchema)).
+		Example(routes.Example{Name: "list", Target: "/greeting-translations", Status: http.StatusOK})
+	reg.Handle("/greeting-translations/{lang}", translations.Get, "GET").
+		Returns(http.StatusOK, translationSchema).
+		Returns(http.StatusNotFound, errorSchema).
+		Example(routes.Example{Name: "missing", Target: "/greeting-translations/de", Status: http.StatusNotFound})
+	reg.Handle("/greeting-translations/{lang}", translations.Put, "PUT").Require("admin")
+	reg.Handle("/greeting-translations/{lang}", translations.Delete, "DELETE").Require("admin")
+
+	saved := handlers.NewGreetings(deps.Store, deps.Cursors)
+	saved.Events = deps.Events
+	saved.Filter = deps.ContentFilter
+	reg.Handle("/greetings", saved.List, "GET").
+		Returns(http.StatusOK, listOf(greetingSchema)).
+		Example(routes.Example{Name: "list", Target: "/greetings", Status: http.StatusOK})
+	reg.Handle("/greetings", saved.Create, "POST").
+		Returns(http.StatusCreated, greetingSchema).
+		Returns(http.StatusBadRequest, errorSchema).
+		Example(routes.Example{Name: "create", Target: "/greetings", Body: `{"name":"Gladys","message":"Hello, Gladys!"}`, Status: http.StatusCreated}).
+		Example(routes.Example{Name: "invalid", Target: "/greetings", Body: `{"name":`, Status: http.StatusBadRequest})
+	reg.Handle("/greetings/import", saved.Import, "POST").
+		Returns(http.StatusCreated, listOf(greetingSchema)).
+		Returns(http.StatusBadRequest, errorSchema).
+		Example(routes.Example{Name: "invalid", Target: "/greetings/import", Body: `[{"name":""}]`, Status: http.StatusBadRequest})
+	reg.Handle("/greetings/{id}", saved.Get, "GET").
+		Returns(http.StatusOK, greetingSchema).
+		Returns(http.StatusNotFound, errorSchema).
+		Example(routes.Example{Name: "missing", Target: "/greetings/does-not-exist", Status: http.StatusNotFound})
+	reg.Handle("/greetings/{id}", saved.Replace, "PUT")
+	reg.Handle("/greetings/{id}", saved.Patch, "PATCH").
+		Accept("application/json", patch.JSONPatchType, patch.MergePatchType)
+	reg.Handle("/greetings/{id}", saved.Delete, "DELETE")
+
+	hooks := handlers.NewWebhooks(deps.Webhooks)
+	// Webhooks are a plan feature; every route passes without plans. Only
+	// admins manage them, as deliveries come from inside the network.
+	gated := func(h http.HandlerFunc) http.HandlerFunc { return deps.Plans.Feature("webhooks", h) }
+	reg.Handle("/webhooks", gated(hooks.List), "GET").Require("admin")
+	reg.Handle("/webhooks", gated(hooks.Create), "POST").Require("admin")
+	reg.Handle("/webhooks/{id}", gated(hooks.Get), "GET").Require("admin")
+	reg.Handle("/webhooks/{id}", gated(hooks.Replace), "PUT").Require("admin")
+	reg.Handle("/webhooks/{id}", gated(hooks.Delete), "DELETE").Require("admin")
+	reg.Handle("/webhooks/{id}/deliveries", gated(hooks.Deliveries), "GET").Require("admin")
+	reg.Handle("/webhooks/{id}/test", gated(hooks.Test), "POST").Require("admin")
+
+	notifications := handlers.NewNotifications(deps.Notify)
+	// Templates are what every email and Slack message says, so only
+	// admins edit them.
+	reg.Handle("/notification-templates", notifications.ListTemplates, "GET")
+	reg.Handle("/notification-templates", notifications.CreateTemplate, "POST").Require("admin")
+	reg.Handle("/notification-templates/{id}", notifications.GetTemplate, "GET")
+	reg.Handle("/notification-templates/{id}", notifications.ReplaceTemplate, "PUT").Require("admin")
+	reg.Handle("/notification-templates/{id}", notifications.DeleteTemplate, "DELETE").Require("admin")
+	reg.Handle("/notification-templates/{id}/preview", notifications.PreviewTemplate, "POST").Require("admin")
+	reg.Handle("/users/{user}/notification-preferences", deps.Auth.Require(notifications.GetPreferences), "GET")
+	reg.Handle("/users/{user}/notification-preferences", deps.Auth.Require(notifications.PutPreferences), "PUT")
+
+	if deps.Privacy != nil {
+		data := handlers.NewPrivacy(deps.Privacy, deps.Operations)
+		reg.Handle("/users/{user}/export", deps.Auth.Require(data.Export), "POST").
+			Returns(http.StatusAccepted, operationSchema).
+			Returns(http.StatusForbidden, errorSchema)
+		reg.Handle("/users/{user}/erase", deps.Auth.Require(data.Erase), "POST").
+			Returns(http.StatusOK, erasureSchema).
+			Returns(http.StatusBadRequest, errorSchema).
+			Returns(http.StatusForbidden, errorSchema)
+		reg.Handle(handlers.OperationsPath+"{id}", deps.Auth.Require(handlers.NewOperations(deps.Operations).Get), "GET").
+			Returns(http.StatusOK, operationSchema).
+			Returns(http.StatusNotFound, errorSchema)
+	}
+
+	st := handlers.NewStatus(deps.Status)
+	reg.Handle("/status", st.Page, "GET")
+	reg.Handle("/healthz", st.Health, "GET")
+	reg.Handle("/readyz", st.Ready, "GET")
+	reg.Handle("/version", handlers.NewVersion(deps.Config).Get, "GET").
+		Returns(http.StatusOK, versionSchema).
+		Example(routes.Example{Name: "get", Target: "/version", Status: http.StatusOK})
+	reg.Handle("/version/integrity", handlers.Integrity, "GET")
+	if deps.QR != nil {
+		render := deps.QR.Get
+		if deps.QRLimit != nil {
+			render = deps.QRLimit.Limit(render)
+		}
+		reg.Handle("/qr", render, "GET").
+			Returns(http.StatusBadRequest, errorSchema).
+			Example(routes.Example{Name: "no data", Target: "/qr", Status: http.StatusBadRequest})
+	}
+	reg.Handle("/admin/incidents", st.ListIncidents, "GET").Require("admin")
+	reg.Handle("/admin/incidents", st.CreateIncident, "POST").Require("admin")
+	reg.Handle("/admin/incidents/{id}", st.ReplaceIncident, "PUT").Require("admin")
+	reg.Handle("/admin/incidents/{id}", st.DeleteIncident, "DELETE").Require("admin")
+
+	reports := handlers.NewAnalytics(deps.Analytics, deps.PII)
+	reg.Handle("/admin/analytics", reports.Report, "GET").Require("admin")
+	reg.Handle("/admin/analytics/export.csv", reports.Export, "GET").Require("admin")
+
+	feed := handlers.NewChanges(deps.Outbox)
+	// The feed carries every tenant's records; admins acting for a tenant
+	// only get its changes.
+	reg.Handle("/changes", deps.Presence.Track(feed.Stream), "GET").Require("admin")
+	reg.Handle("/presence", handlers.NewPresence(deps.Presence).List, "GET")
+
+	integrations := handlers.NewClients(deps.Clients)
+	reg.Handle("/admin/clients", integrations.List, "GET").Require("admin")
+	reg.Handle("/admin/stats", handlers.NewStats(deps.Limits).Get, "GET").Require("admin")
+	if deps.Queries != nil {
+		reg.Handle("/admin/queries/slow", handlers.NewQueries(deps.Queries).Slowest, "GET").Require("admin")
+	}
+	if deps.SLA != nil {
+		reg.Handle(sla.Path, handlers.NewSLA(deps.SLA).Report, "GET").Require("admin")
+	}
+	if deps.Metering != nil {
+		usage := handlers.NewUsage(deps.Metering)
+		reg.Handle("/admin/usage", usage.Report, "GET").Require("admin")
+		reg.Handle("/admin/usage/export.csv", usage.Export, "GET").Require("admin")
+	}
+	if deps.Plans != nil {
+		tiers := handlers.NewPlans(deps.Plans)
+		reg.Handle("/admin/plans", tiers.List, "GET").Require("admin")
+		reg.Handle("/admin/plans/assignments", tiers.Assignments, "GET").Require("admin")
+		reg.Handle("/admin/plans/assignments/{subject}", tiers.Assign, "PUT").Require("admin").
+			Returns(http.StatusBadRequest, errorSchema)
+		reg.Handle("/admin/plans/assignments/{subject}", tiers.Unassign, "DELETE").Require("admin").
+			Returns(http.StatusNotFound, errorSchema)
+	}
+	if deps.Impersonation != nil {
+		reg.Handle("/admin/impersonate", deps.Auth.Require(deps.Impersonation.Post), "POST").Require("admin").
+			Returns(http.StatusOK, tokenSchema).
+			Returns(http.StatusBadRequest, errorSchema).
+			Returns(http.StatusForbidden, errorSchema)
+	}
+	if deps.Audit != nil {
+		reg.Handle("/admin/audit", handlers.NewAudit(deps.Audit).List, "GET").Require("admin")
+	}
+	if deps.Retention != nil {
+		purge := handlers.NewRetention(deps.Retention, deps.Approvals).Purge
+		reg.Handle("/admin/retention/purge", deps.Auth.Require(purge), "POST").Require("admin")
+	}
+	if deps.Cache != nil {
+		flush := handlers.NewCache(deps.Cache, deps.Approvals).Flush
+		reg.Handle("/admin/cache/flush", deps.Auth.Require(flush), "POST").Require("admin").
+			Returns(http.StatusAccepted, actionSchema)
+	}
+	if deps.Approvals != nil {
+		approvals := handlers.NewApprovals(deps.Approvals)
+		reg.Handle("/admin/approvals", deps.Auth.Require(approvals.List), "GET").Require("admin")
+		reg.Handle("/admin/approvals/{id}", deps.Auth.Require(approvals.Get), "GET").Require("admin").
+			Returns(http.StatusOK, actionSchema).
+			Returns(http.StatusNotFound, errorSchema)
+		reg.Handle("/admin/approvals/{id}", deps.Auth.Require(approvals.Reject), "DELETE").Require("admin").
+			Returns(http.StatusOK, actionSchema).
+			Returns(http.StatusConflict, errorSchema)
+		reg.Handle("/admin/approvals/{id}/approve", deps.Auth.Require(approvals.Approve), "POST").Require("admin").
+			Returns(http.StatusOK, actionSchema).
+			Returns(http.StatusForbidden, errorSchema).
+			Returns(http.StatusConflict, errorSchema)
+	}
+
+	if viper.GetBool("profiling.enabled") {
+		p := &profiling.Handler{MaxDuration: viper.GetDuration("profiling.max_duration")}
+		reg.Handle(profiling.CPUPath, p.CPU, "GET").Require("admin")
+		reg.Handle(profiling.HeapPath, p.Heap, "GET").Require("admin")
+	}
+	reg.Handle("/metrics", promhttp.Handler().ServeHTTP, "GET")
+	reg.Handle(routes.OpenAPIPath, reg.OpenAPI, "GET")
+	return router
+}
@@ -0,0 +1,143 @@
+package app
+
+import "github.com/Shulammite-Aso/bazel-demo-app/routes"
+
+// Response schemas documented in the OpenAPI document and checked by the
+// contract test. They describe what clients may rely on, so fields not
+// listed here may still appear.
+var (
+	timestampSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"rfc3339", "zone", "display"},
+		Properties: map[string]*routes.Schema{
+			"rfc3339": {Type: "string"},
+			"zone":    {Type: "string"},
+			"display": {Type: "string"},
+		},
+	}
+	errorSchema = &routes.Schema{
+		Type:       "object",
+		Required:   []string{"error"},
+		Properties: map[string]*routes.Schema{"error": {Type: "string"}},
+	}
+	greetingSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"id", "name", "message", "version", "created_at", "updated_at"},
+		Properties: map[string]*routes.Schema{
+			"id":         {Type: "string"},
+			"name":       {Type: "string"},
+			"message":    {Type: "string"},
+			"version":    {Type: "integer"},
+			"created_at": timestampSchema,
+			"updated_at": timestampSchema,
+		},
+	}
+	translationSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"lang", "formats", "version"},
+		Properties: map[string]*routes.Schema{
+			"lang":       {Type: "string"},
+			"formats":    {Type: "array", Items: &routes.Schema{Type: "string"}},
+			"version":    {Type: "integer"},
+			"created_at": timestampSchema,
+			"updated_at": timestampSchema,
+		},
+	}
+	tokenSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"access_token", "token_type", "expires_in"},
+		Properties: map[string]*routes.Schema{
+			"access_token":  {Type: "string"},
+			"token_type":    {Type: "string"},
+			"expires_in":    {Type: "integer"},
+			"refresh_token": {Type: "string"},
+		},
+	}
+	jwksSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"keys"},
+		Properties: map[string]*routes.Schema{
+			"keys": listOf(&routes.Schema{
+				Type:     "object",
+				Required: []string{"kty", "kid", "use", "alg"},
+				Properties: map[string]*routes.Schema{
+					"kty": {Type: "string"},
+					"kid": {Type: "string"},
+					"use": {Type: "string"},
+					"alg": {Type: "string"},
+					"n":   {Type: "string"},
+					"e":   {Type: "string"},
+					"crv": {Type: "string"},
+					"x":   {Type: "string"},
+					"y":   {Type: "string"},
+				},
+			}),
+		},
+	}
+	operationSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"id", "kind", "done", "created_at", "updated_at"},
+		Properties: map[string]*routes.Schema{
+			"id":         {Type: "string"},
+			"kind":       {Type: "string"},
+			"owner":      {Type: "string"},
+			"done":       {Type: "boolean"},
+			"error":      {Type: "string"},
+			"result":     {Type: "object"},
+			"created_at": {Type: "string"},
+			"updated_at": {Type: "string"},
+		},
+	}
+	erasureSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"user", "deleted", "anonymized", "verified"},
+		Properties: map[string]*routes.Schema{
+			"user":       {Type: "string"},
+			"deleted":    {Type: "object"},
+			"anonymized": {Type: "object"},
+			"verified":   {Type: "boolean"},
+		},
+	}
+	versionSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"version", "go_version", "stamped", "features", "config_fingerprint"},
+		Properties: map[string]*routes.Schema{
+			"version":         {Type: "string"},
+			"git_commit":      {Type: "string"},
+			"build_timestamp": {Type: "string"},
+			"go_version":      {Type: "string"},
+			"stamped":         {Type: "boolean"},
+			"features":        {Type: "array", Items: &routes.Schema{Type: "string"}},
+			"config_fingerprint": {
+				Type:     "object",
+				Required: []string{"startup", "current", "changed"},
+				Properties: map[string]*routes.Schema{
+					"startup": {Type: "string"},
+					"current": {Type: "string"},
+					"changed": {Type: "boolean"},
+				},
+			},
+		},
+	}
+	actionSchema = &routes.Schema{
+		Type:     "object",
+		Required: []string{"id", "kind", "status", "requested_by", "expires_at", "created_at", "updated_at"},
+		Properties: map[string]*routes.Schema{
+			"id":           {Type: "string"},
+			"kind":         {Type: "string"},
+			"params":       {Type: "object"},
+			"status":       {Type: "string"},
+			"requested_by": {Type: "string"},
+			"decided_by":   {Type: "string"},
+			"expires_at":   {Type: "string"},
+			"error":        {Type: "string"},
+			"created_at":   {Type: "string"},
+			"updated_at":   {Type: "string"},
+		},
+	}
+)
+
+// listOf returns the schema of a JSON array of item.
+func listOf(item *routes.Schema) *routes.Schema {
+	return &routes.Schema{Type: "array", Items: item}
+}
@@ -0,0 +1,255 @@
+// Package approval holds destructive admin actions, such as flushing the
+// cache or purging expired records, until a second admin confirms them.
+// One admin requests an action, which is stored as pending; another
+// approves it before it expires, which runs it, or rejects it. Requests,
+// approvals and rejections are recorded in the audit trail, and pending
+// actions are stored records, so any replica can approve one.
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Collection is the storage collection actions live in.
+const Collection = "pending_actions"
+
+// DefaultTTL is how long actions wait for approval.
+const DefaultTTL = time.Hour
+
+// Statuses of an action.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Audited actions.
+const (
+	ActionRequest = "approval.request"
+	ActionApprove = "approval.approve"
+	ActionReject  = "approval.reject"
+)
+
+// Errors returned by Manager.
+var (
+	ErrUnknownKind = errors.New("approval: no such kind of action")
+	// ErrSelfApproval is returned when the admin who requested an action
+	// tries to approve it.
+	ErrSelfApproval = errors.New("approval: an action must be approved by someone other than who requested it")
+	ErrExpired      = errors.New("approval: action expired before it was approved")
+	// ErrDecided is returned for actions already approved or rejected.
+	ErrDecided = errors.New("approval: action was already decided")
+)
+
+var decided = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "approval_decisions_total",
+	Help: "Pending admin actions decided, by kind and status (approved, rejected or expired).",
+}, []string{"kind", "status"})
+
+// Func runs an approved action with the parameters it was requested
+// with, returning what it did.
+type Func func(ctx context.Context, params map[string]string) (interface{}, error)
+
+// Action is a destructive action and its approval.
+type Action struct {
+	ID string `json:"id"`
+	// Kind names what the action does, such as cache.flush.
+	Kind   string            `json:"kind"`
+	Params map[string]string `json:"params,omitempty"`
+	Status string            `json:"status"`
+	// RequestedBy and DecidedBy are the admins who requested and approved
+	// or rejected the action.
+	RequestedBy string    `json:"requested_by"`
+	DecidedBy   string    `json:"decided_by,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// Result is what the action returned once approved, or Error why it
+	// failed.
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Manager requests and decides actions.
+type Manager struct {
+	Store storage.Store
+	Audit *audit.Log
+	// TTL is how long actions wait for approval.
+	TTL   time.Duration
+	kinds map[string]Func
+	now   func() time.Time
+}
+
+// NewManager returns a manager keeping actions in store for ttl, or
+// DefaultTTL if ttl isn't positive, and auditing to log.
+func NewManager(store storage.Store, log *audit.Log, ttl time.Duration) *Manager {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Manager{Store: store, Audit: log, TTL: ttl, kinds: make(map[string]Func), now: time.Now}
+}
+
+// SetClock makes the manager expire actions by now instead of the wall
+// clock, for tests.
+func (m *Manager) SetClock(now func() time.Time) {
+	m.now = now
+}
+
+// Register makes actions of kind run f once approved. Call it before the
+// manager is used.
+func (m *Manager) Register(kind string, f Func) {
+	m.kinds[kind] = f
+}
+
+// Request stores a pending action of kind, requested by actor, and
+// returns it.
+func (m *Manager) Request(ctx context.Context, actor, kind string, params map[string]string) (Action, error) {
+	if _, ok := m.kinds[kind]; !ok {
+		return Action{}, ErrUnknownKind
+	}
+	a := Action{ID: uuid.NewString(), Kind: kind, Params: params, Status: StatusPending, RequestedBy: actor, ExpiresAt: m.now().Add(m.TTL)}
+	data, _ := json.Marshal(a)
+	rec, err := m.Store.Create(ctx, Collection, a.ID, data)
+	if err != nil {
+		return Action{}, err
+	}
+	_, err = m.Audit.Record(ctx, audit.Entry{Actor: actor, Action: ActionRequest, Target: kind, Details: map[string]interface{}{
+		"id":     a.ID,
+		"params": params,
+	}})
+	return fromRecord(a, rec), err
+}
+
+// Get returns the action with id, or storage.ErrNotFound.
+func (m *Manager) Get(ctx context.Context, id string) (Action, error) {
+	a, _, err := m.get(ctx, id)
+	return a, err
+}
+
+func (m *Manager) get(ctx context.Context, id string) (Action, storage.Record, error) {
+	rec, err := m.Store.Get(ctx, Collection, id)
+	if err != nil {
+		return Action{}, storage.Record{}, err
+	}
+	var a Action
+	if err := json.Unmarshal(rec.Data, &a); err != nil {
+		return Action{}, storage.Record{}, err
+	}
+	return fromRecord(a, rec), rec, nil
+}
+
+// List returns the actions awaiting approval, oldest first, deleting
+// those that have expired along the way.
+func (m *Manager) List(ctx context.Context) ([]Action, error) {
+	recs, err := m.Store.List(ctx, Collection, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	now := m.now()
+	out := []Action{}
+	for _, rec := range recs {
+		var a Action
+		if err := json.Unmarshal(rec.Data, &a); err != nil {
+			return nil, err
+		}
+		if now.After(a.ExpiresAt) {
+			if a.Status == StatusPending {
+				decided.WithLabelValues(a.Kind, "expired").Inc()
+			}
+			m.Store.Delete(ctx, Collection, rec.ID, rec.Version)
+			continue
+		}
+		if a.Status == StatusPending {
+			out = append(out, fromRecord(a, rec))
+		}
+	}
+	return out, nil
+}
+
+// Approve runs the pending action with id on behalf of actor, who must
+// not be who requested it, and returns it with its result. Its Func's
+// failure is reported in the action's Error, not as an error.
+func (m *Manager) Approve(ctx context.Context, actor, id string) (Action, error) {
+	a, rec, err := m.decide(ctx, actor, id, StatusApproved)
+	if err != nil {
+		return Action{}, err
+	}
+	v, err := m.kinds[a.Kind](ctx, a.Params)
+	if err == nil {
+		a.Result, err = json.Marshal(v)
+	}
+	if err != nil {
+		a.Error, a.Result = err.Error(), nil
+	}
+	data, _ := json.Marshal(a)
+	if rec, err = m.Store.Update(ctx, Collection, a.ID, data, rec.Version); err != nil {
+		return a, err
+	}
+	details := map[string]interface{}{"id": a.ID, "requested_by": a.RequestedBy}
+	if a.Error != "" {
+		details["error"] = a.Error
+	}
+	_, err = m.Audit.Record(ctx, audit.Entry{Actor: actor, Action: ActionApprove, Target: a.Kind, Details: details})
+	return fromRecord(a, rec), err
+}
+
+// Reject marks the pending action with id as rejected by actor, who may
+// be who requested it, withdrawing it.
+func (m *Manager) Reject(ctx context.Context, actor, id string) (Action, error) {
+	a, rec, err := m.decide(ctx, actor, id, StatusRejected)
+	if err != nil {
+		return Action{}, err
+	}
+	_, err = m.Audit.Record(ctx, audit.Entry{Actor: actor, Action: ActionReject, Target: a.Kind, Details: map[string]interface{}{
+		"id":           a.ID,
+		"requested_by": a.RequestedBy,
+	}})
+	return fromRecord(a, rec), err
+}
+
+// decide moves the pending action with id to status on behalf of actor.
+// Storing the decision with the version read means two admins approving
+// at once can't both run it.
+func (m *Manager) decide(ctx context.Context, actor, id, status string) (Action, storage.Record, error) {
+	a, rec, err := m.get(ctx, id)
+	switch {
+	case err != nil:
+		return Action{}, storage.Record{}, err
+	case a.Status != StatusPending:
+		return Action{}, storage.Record{}, ErrDecided
+	case m.now().After(a.ExpiresAt):
+		decided.WithLabelValues(a.Kind, "expired").Inc()
+		m.Store.Delete(ctx, Collection, rec.ID, rec.Version)
+		return Action{}, storage.Record{}, ErrExpired
+	case status == StatusApproved && actor == a.RequestedBy:
+		return Action{}, storage.Record{}, ErrSelfApproval
+	case status == StatusApproved && m.kinds[a.Kind] == nil:
+		return Action{}, storage.Record{}, ErrUnknownKind
+	}
+	a.Status, a.DecidedBy = status, actor
+	data, _ := json.Marshal(a)
+	rec, err = m.Store.Update(ctx, Collection, a.ID, data, rec.Version)
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		return Action{}, storage.Record{}, ErrDecided
+	}
+	if err != nil {
+		return Action{}, storage.Record{}, err
+	}
+	decided.WithLabelValues(a.Kind, status).Inc()
+	return fromRecord(a, rec), rec, nil
+}
+
+func fromRecord(a Action, rec storage.Record) Action {
+	a.ID, a.CreatedAt, a.UpdatedAt = rec.ID, rec.CreatedAt, rec.UpdatedAt
+	return a
+}
@@ -0,0 +1,98 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// newManager returns a manager whose cache.flush action counts its runs,
+// telling time by *now.
+func newManager(now *time.Time) (*Manager, *int, *audit.Log) {
+	m := storage.NewMemory()
+	log := audit.NewLog(m)
+	mgr := NewManager(m, log, time.Hour)
+	mgr.SetClock(func() time.Time { return *now })
+	runs := 0
+	mgr.Register("cache.flush", func(ctx context.Context, params map[string]string) (interface{}, error) {
+		runs++
+		return map[string]string{"flushed": params["cache"]}, nil
+	})
+	return mgr, &runs, log
+}
+
+// TestApprove checks that an action runs only once a second admin approves
+// it, and only once.
+func TestApprove(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	mgr, runs, log := newManager(&now)
+	ctx := context.Background()
+	if _, err := mgr.Request(ctx, "ada", "restore", nil); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("Request(restore) = %v, want ErrUnknownKind", err)
+	}
+	a, err := mgr.Request(ctx, "ada", "cache.flush", map[string]string{"cache": "sessions"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := mgr.List(ctx); len(pending) != 1 || pending[0].ID != a.ID {
+		t.Errorf("List() = %+v, want the requested action", pending)
+	}
+	if _, err := mgr.Approve(ctx, "ada", a.ID); !errors.Is(err, ErrSelfApproval) || *runs != 0 {
+		t.Errorf("Approve by the requester = %v after %d runs, want ErrSelfApproval and none", err, *runs)
+	}
+	done, err := mgr.Approve(ctx, "grace", a.ID)
+	if err != nil || *runs != 1 || done.Status != StatusApproved || done.DecidedBy != "grace" || string(done.Result) != `{"flushed":"sessions"}` {
+		t.Fatalf("Approve by another admin = %+v, %v after %d runs, want it run once", done, err, *runs)
+	}
+	if _, err := mgr.Approve(ctx, "linus", a.ID); !errors.Is(err, ErrDecided) || *runs != 1 {
+		t.Errorf("Approve again = %v after %d runs, want ErrDecided", err, *runs)
+	}
+	if pending, _ := mgr.List(ctx); len(pending) != 0 {
+		t.Errorf("List() = %+v, want nothing pending", pending)
+	}
+	entries, _ := log.List(ctx, storage.ListOptions{})
+	if len(entries) != 2 || entries[0].Action != ActionRequest || entries[1].Action != ActionApprove || entries[1].Actor != "grace" {
+		t.Errorf("audit trail = %+v, want the request and the approval", entries)
+	}
+}
+
+// TestExpiry checks that actions can't be approved once expired, and are
+// deleted when found expired.
+func TestExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	mgr, runs, _ := newManager(&now)
+	ctx := context.Background()
+	a, _ := mgr.Request(ctx, "ada", "cache.flush", nil)
+	b, _ := mgr.Request(ctx, "ada", "cache.flush", nil)
+	now = now.Add(2 * time.Hour)
+	if _, err := mgr.Approve(ctx, "grace", a.ID); !errors.Is(err, ErrExpired) || *runs != 0 {
+		t.Errorf("Approve(expired) = %v after %d runs, want ErrExpired and none", err, *runs)
+	}
+	if pending, _ := mgr.List(ctx); len(pending) != 0 {
+		t.Errorf("List() = %+v, want nothing pending", pending)
+	}
+	for _, id := range []string{a.ID, b.ID} {
+		if _, err := mgr.Get(ctx, id); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Get(expired action) = %v, want it deleted", err)
+		}
+	}
+}
+
+// TestReject checks that the requester may withdraw an action, which then
+// can't be approved.
+func TestReject(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	mgr, runs, _ := newManager(&now)
+	ctx := context.Background()
+	a, _ := mgr.Request(ctx, "ada", "cache.flush", nil)
+	if r, err := mgr.Reject(ctx, "ada", a.ID); err != nil || r.Status != StatusRejected {
+		t.Fatalf("Reject by the requester = %+v, %v, want it rejected", r, err)
+	}
+	if _, err := mgr.Approve(ctx, "grace", a.ID); !errors.Is(err, ErrDecided) || *runs != 0 {
+		t.Errorf("Approve(rejected) = %v after %d runs, want ErrDecided and none", err, *runs)
+	}
+}
@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestRecord checks that recorded entries list back in order with their
+// IDs and times set.
+func TestRecord(t *testing.T) {
+	l := NewLog(storage.NewMemory())
+	ctx := context.Background()
+	for _, action := range []string{"privacy.export", "privacy.erase"} {
+		if _, err := l.Record(ctx, Entry{Actor: "admin", Action: action, Target: "gladys"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := l.List(ctx, storage.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Action != "privacy.export" || got[1].Action != "privacy.erase" {
+		t.Fatalf("List() = %+v, want the export then the erasure", got)
+	}
+	if got[0].ID == "" || got[0].Time.IsZero() || got[0].Target != "gladys" {
+		t.Errorf("List()[0] = %+v, want an ID, a time and the target", got[0])
+	}
+}
+
+// TestImpersonated checks that entries recorded for a request made with
+// an impersonation token are flagged with the impersonator.
+func TestImpersonated(t *testing.T) {
+	l := NewLog(storage.NewMemory())
+	claims := jwt.MapClaims{"sub": "gladys", auth.ActClaim: map[string]interface{}{"sub": "ada"}}
+	req := httptest.NewRequest("POST", "/users/gladys/export", nil)
+	req = req.WithContext(auth.NewContext(req.Context(), claims))
+	l.Impersonated(req, "ada")
+	l.Record(req.Context(), Entry{Actor: "gladys", Action: "privacy.export", Target: "gladys"})
+
+	got, _ := l.List(context.Background(), storage.ListOptions{})
+	if len(got) != 2 || got[0].Action != ActionImpersonatedRequest || got[0].Target != "POST /users/gladys/export" {
+		t.Fatalf("List() = %+v, want the request then the export", got)
+	}
+	for _, e := range got {
+		if e.Actor != "gladys" || e.Impersonator != "ada" {
+			t.Errorf("entry %s = %+v, want gladys acting, impersonated by ada", e.Action, e)
+		}
+	}
+}
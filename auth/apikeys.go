@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// APIKey is a key machine clients send in the X-API-Key header instead of
+// a bearer token. Only its digest is configured, by clients.HashAPIKey.
+type APIKey struct {
+	// Client names who the key belongs to. It is the sub claim of the
+	// key's requests, and the client they are tracked and rate-limited as.
+	Client string
+	// Claims are what the key grants, such as roles and scope, as if they
+	// were in a token.
+	Claims jwt.MapClaims
+}
+
+// NewAPIKey returns a new random API key.
+func NewAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// checkDigest reports whether digest looks like a clients.HashAPIKey
+// digest.
+func checkDigest(digest string) error {
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != 32 || digest != strings.ToLower(digest) {
+		return fmt.Errorf("%q is not a lower-case hex SHA-256 digest", digest)
+	}
+	return nil
+}
+
+// ParseAPIKeys reads API keys from a file of "client digest" lines, each
+// digest a clients.HashAPIKey, and returns them by digest. Blank lines and
+// lines starting with # are skipped. Keys read this way grant no claims
+// beyond sub.
+func ParseAPIKeys(data []byte) (map[string]APIKey, error) {
+	keys := make(map[string]APIKey)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want a client name and a digest", n)
+		}
+		if err := checkDigest(fields[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		keys[fields[1]] = APIKey{Client: fields[0]}
+	}
+	return keys, sc.Err()
+}
+
+// authenticateKey returns the claims key grants, or responds 401 and
+// returns false if no such key is configured.
+func (v *Verifier) authenticateKey(w http.ResponseWriter, key string) (jwt.MapClaims, bool) {
+	k, ok := v.config.Load().APIKeys[clients.HashAPIKey(key)]
+	if !ok {
+		requests.WithLabelValues(ResultInvalid).Inc()
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		respond.Error(w, http.StatusUnauthorized, "unknown API key")
+		return nil, false
+	}
+	claims := make(jwt.MapClaims, len(k.Claims)+1)
+	for name, val := range k.Claims {
+		claims[name] = val
+	}
+	claims["sub"] = k.Client
+	return claims, true
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+)
+
+// TestAPIKeys checks that a configured key authenticates as its client
+// with the claims it grants, and that unknown keys are refused.
+func TestAPIKeys(t *testing.T) {
+	key, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := devConfig()
+	c.APIKeys = map[string]APIKey{
+		clients.HashAPIKey(key): {Client: "billing", Claims: jwt.MapClaims{"roles": []interface{}{"admin"}, "sub": "ignored"}},
+	}
+	v, err := NewVerifier(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got jwt.MapClaims
+	h := v.Authorize(func(*http.Request) []string { return []string{"admin"} })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+	for _, tt := range []struct {
+		name, key string
+		status    int
+	}{
+		{"configured", key, http.StatusOK},
+		{"unknown", "not-a-key", http.StatusUnauthorized},
+	} {
+		got = nil
+		req := httptest.NewRequest("GET", "/admin/stats", nil)
+		req.Header.Set(clients.APIKeyHeader, tt.key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s key: GET /admin/stats = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/admin/stats", nil)
+	req.Header.Set(clients.APIKeyHeader, key)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got["sub"] != "billing" {
+		t.Errorf("claims of an API key = %v, want sub billing", got)
+	}
+}
+
+// TestParseAPIKeys checks the key file format and that configured
+// digests are validated.
+func TestParseAPIKeys(t *testing.T) {
+	digest := clients.HashAPIKey("k")
+	keys, err := ParseAPIKeys([]byte("# machine clients\n\nbilling " + digest + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys[digest].Client != "billing" || len(keys) != 1 {
+		t.Errorf("ParseAPIKeys() = %v, want billing's key", keys)
+	}
+	for _, data := range []string{"billing", "billing not-hex", "billing " + digest + " extra"} {
+		if _, err := ParseAPIKeys([]byte(data)); err == nil {
+			t.Errorf("ParseAPIKeys(%q) succeeded, want an error", data)
+		}
+	}
+
+	c := devConfig()
+	c.APIKeys = map[string]APIKey{"plaintext-key": {Client: "billing"}}
+	if err := c.Check(); err == nil {
+		t.Error("Check() of a plaintext API key succeeded, want an error")
+	}
+}
@@ -0,0 +1,324 @@
+// Package auth signs and verifies the bearer tokens clients send to
+// protected routes: JWTs signed with one of the server's keys, named by
+// the token's kid header so keys can be rotated. Keys are HS256 secrets
+// or RS256 and ES256 key pairs; services that only hold the public half
+// of a pair can verify tokens but not sign them. Machine clients may send
+// an API key instead of a token.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// DevSecret is the development signing secret: the auth.secret default,
+// which the tokens in testdata/jwt are signed with. Deployments must set
+// their own.
+const DevSecret = "secret-key"
+
+// Results counted in auth_requests_total.
+const (
+	ResultOK      = "ok"
+	ResultMissing = "missing"
+	ResultInvalid = "invalid"
+	ResultExpired = "expired"
+	ResultRetired = "retired"
+	// ResultForbidden is a valid token without the roles or scopes the
+	// route requires.
+	ResultForbidden = "forbidden"
+)
+
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "auth_requests_total",
+	Help: "Requests to protected routes by token verification result.",
+}, []string{"result"})
+
+// Errors returned by Verify and Sign.
+var (
+	ErrExpired = errors.New("token expired")
+	// ErrUnknownKey is returned for tokens whose kid names no configured
+	// key.
+	ErrUnknownKey = errors.New("token signed with an unknown key")
+	// ErrRetiredKey is returned for tokens signed with a key retired for
+	// longer than the grace period.
+	ErrRetiredKey = errors.New("token signed with a retired key")
+	// ErrCannotSign is returned by Sign for verifiers without a signing
+	// key.
+	ErrCannotSign = errors.New("no signing key configured")
+)
+
+// Config configures a Verifier.
+type Config struct {
+	// SigningKey is the ID of the key tokens are signed with. Tokens
+	// without a kid header are checked against it too. It is empty for
+	// verifiers that only check tokens, which then need a kid.
+	SigningKey string
+	// Keys holds every accepted key by ID, the signing key included. IDs
+	// are in lower case, as viper reads map keys; kid headers are matched
+	// regardless of case.
+	Keys map[string]Key
+	// Grace is how long tokens signed with a retired key stay valid.
+	Grace time.Duration
+	// APIKeys are accepted in place of a token, by clients.HashAPIKey
+	// digest.
+	APIKeys map[string]APIKey
+}
+
+// Check reports configurations that can't sign or verify: a missing,
+// retired or public-only signing key, keys without exactly one usable
+// secret or key, and malformed API keys.
+func (c Config) Check() error {
+	if c.SigningKey != "" {
+		signing, ok := c.Keys[c.SigningKey]
+		switch {
+		case !ok:
+			return fmt.Errorf("signing key %q is not configured", c.SigningKey)
+		case !signing.RetiredAt.IsZero():
+			return fmt.Errorf("signing key %q is retired", c.SigningKey)
+		case signing.Public != nil:
+			return fmt.Errorf("signing key %q is a public key, which can't sign", c.SigningKey)
+		}
+	}
+	for id, k := range c.Keys {
+		if _, err := k.method(); err != nil {
+			return fmt.Errorf("key %q %v", id, err)
+		}
+	}
+	for digest, k := range c.APIKeys {
+		if err := checkDigest(digest); err != nil {
+			return fmt.Errorf("API key of %q: %v", k.Client, err)
+		}
+		if k.Client == "" {
+			return fmt.Errorf("API key %s has no client", digest)
+		}
+	}
+	return nil
+}
+
+// Algorithms returns the algorithms of the keys c accepts, sorted and
+// without repeats, such as [HS256 RS256]. Keys Check would refuse are
+// left out.
+func (c Config) Algorithms() []string {
+	var algs []string
+	for _, k := range c.Keys {
+		if m, err := k.method(); err == nil && !slices.Contains(algs, m.Alg()) {
+			algs = append(algs, m.Alg())
+		}
+	}
+	slices.Sort(algs)
+	return algs
+}
+
+// Verifier signs and checks bearer tokens. It is safe for concurrent
+// use.
+type Verifier struct {
+	config       atomic.Pointer[Config]
+	now          func() time.Time
+	impersonated func(r *http.Request, actor string)
+}
+
+// NewVerifier returns a verifier using c.
+func NewVerifier(c Config) (*Verifier, error) {
+	v := &Verifier{now: time.Now}
+	if err := v.Reconfigure(c); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SetClock makes the verifier tell time by now instead of the wall clock,
+// for tests: tokens are issued, expire and have their keys retire by it.
+// Call it before the verifier is used.
+func (v *Verifier) SetClock(now func() time.Time) {
+	v.now = now
+}
+
+// Reconfigure replaces the verifier's keys, as after a config reload that
+// rotates them. An invalid configuration is refused and the current one
+// kept.
+func (v *Verifier) Reconfigure(c Config) error {
+	if err := c.Check(); err != nil {
+		return err
+	}
+	v.config.Store(&c)
+	return nil
+}
+
+// Sign returns a token carrying claims, signed with the signing key by
+// its algorithm and naming it in its kid header. It returns
+// ErrCannotSign for verifiers without a signing key.
+func (v *Verifier) Sign(claims jwt.MapClaims) (string, error) {
+	c := v.config.Load()
+	if c.SigningKey == "" {
+		return "", ErrCannotSign
+	}
+	key := c.Keys[c.SigningKey]
+	method, _ := key.method()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = c.SigningKey
+	return token.SignedString(key.signingKey())
+}
+
+// Issue signs a token carrying claims that is valid for ttl, setting its
+// iat and exp claims by the verifier's clock.
+func (v *Verifier) Issue(claims jwt.MapClaims, ttl time.Duration) (string, error) {
+	now := v.now()
+	out := make(jwt.MapClaims, len(claims)+2)
+	for k, val := range claims {
+		out[k] = val
+	}
+	out["iat"] = now.Unix()
+	out["exp"] = now.Add(ttl).Unix()
+	return v.Sign(out)
+}
+
+// Verify parses token and returns its claims if it is signed with an
+// accepted key by that key's algorithm and, when it has an exp or nbf
+// claim, currently valid. Unsigned tokens are rejected, and so are tokens
+// whose alg doesn't match their key, such as HS256 tokens "signed" with an
+// RSA public key.
+func (v *Verifier) Verify(token string) (jwt.MapClaims, error) {
+	c := v.config.Load()
+	claims := jwt.MapClaims{}
+	// Time claims are checked below by the verifier's clock, not jwt-go's.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		id, _ := t.Header["kid"].(string)
+		if id == "" {
+			id = c.SigningKey
+		}
+		key, ok := c.Keys[strings.ToLower(id)]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if method, _ := key.method(); t.Method != method {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		if !key.RetiredAt.IsZero() && v.now().After(key.RetiredAt.Add(c.Grace)) {
+			return nil, ErrRetiredKey
+		}
+		return key.verificationKey(), nil
+	})
+	var verr *jwt.ValidationError
+	if errors.As(err, &verr) {
+		if errors.Is(verr.Inner, ErrUnknownKey) || errors.Is(verr.Inner, ErrRetiredKey) {
+			return nil, verr.Inner
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := v.now().Unix()
+	switch {
+	case !claims.VerifyExpiresAt(now, false):
+		return nil, ErrExpired
+	case !claims.VerifyNotBefore(now, false):
+		return nil, errors.New("token is not valid yet")
+	}
+	return claims, nil
+}
+
+// Require wraps h so it only runs for requests with a valid
+// "Authorization: Bearer <token>" header or a configured API key, storing
+// the token's or key's claims in the request context. Other requests get 401
+// with a WWW-Authenticate challenge (RFC 6750).
+func (v *Verifier) Require(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := v.authenticate(w, r)
+		if !ok {
+			return
+		}
+		requests.WithLabelValues(ResultOK).Inc()
+		v.serve(h, w, r, claims)
+	}
+}
+
+// Optional wraps next for routes that don't need a token but act on one
+// when it is sent: requests with a bearer token or API key are
+// authenticated as by Require, so they run with its claims in the context
+// or get 401, and requests with neither run untouched. Requests already
+// carrying claims pass through.
+func (v *Verifier) Optional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, seen := FromContext(r.Context())
+		_, hasToken := bearer(r)
+		if seen || !hasToken && r.Header.Get(clients.APIKeyHeader) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims, ok := v.authenticate(w, r)
+		if !ok {
+			return
+		}
+		requests.WithLabelValues(ResultOK).Inc()
+		v.serve(next, w, r, claims)
+	})
+}
+
+// authenticate returns the claims of r's bearer token, or of its API key
+// if it sends one instead. If it has neither, or it doesn't verify,
+// authenticate counts the failure, responds 401 and returns false.
+func (v *Verifier) authenticate(w http.ResponseWriter, r *http.Request) (jwt.MapClaims, bool) {
+	token, ok := bearer(r)
+	if key := r.Header.Get(clients.APIKeyHeader); !ok && key != "" {
+		return v.authenticateKey(w, key)
+	}
+	if !ok {
+		requests.WithLabelValues(ResultMissing).Inc()
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		respond.Error(w, http.StatusUnauthorized, "missing bearer token")
+		return nil, false
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		result := ResultInvalid
+		switch {
+		case errors.Is(err, ErrExpired):
+			result = ResultExpired
+		case errors.Is(err, ErrRetiredKey):
+			result = ResultRetired
+		}
+		requests.WithLabelValues(result).Inc()
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		respond.Error(w, http.StatusUnauthorized, "invalid bearer token: "+err.Error())
+		return nil, false
+	}
+	return claims, true
+}
+
+// bearer returns the token of r's Authorization header.
+func bearer(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying claims.
+func NewContext(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// FromContext returns the claims stored in ctx by Require. ok is false
+// for requests to routes that don't require a token.
+func FromContext(ctx context.Context) (claims jwt.MapClaims, ok bool) {
+	claims, ok = ctx.Value(contextKey{}).(jwt.MapClaims)
+	return claims, ok
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/fixtures"
+)
+
+// devConfig accepts the tokens in the corpus, which have no kid and are
+// signed with "secret-key".
+func devConfig() Config {
+	return Config{SigningKey: "default", Keys: map[string]Key{"default": {Secret: []byte("secret-key")}}}
+}
+
+// TestRequire checks the tokens in the corpus: only the valid one reaches
+// the handler, with its claims in the context, and each rejection carries
+// a Bearer challenge.
+func TestRequire(t *testing.T) {
+	v, err := NewVerifier(devConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := v.Require(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := FromContext(r.Context())
+		if !ok {
+			t.Error("FromContext() ok = false in a protected handler")
+		}
+		w.Write([]byte(claims["user"].(string)))
+	})
+	token := func(name string) string {
+		return "Bearer " + strings.TrimSpace(string(fixtures.Read(t, "jwt/"+name)))
+	}
+	tests := []struct {
+		name, authorization string
+		status              int
+		challenge           string
+	}{
+		{"valid", token("valid.jwt"), http.StatusOK, ""},
+		{"lowercase scheme", strings.Replace(token("valid.jwt"), "Bearer", "bearer", 1), http.StatusOK, ""},
+		{"missing", "", http.StatusUnauthorized, "Bearer"},
+		{"basic", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "Bearer"},
+		{"expired", token("expired.jwt"), http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"alg none", token("alg-none.jwt"), http.StatusUnauthorized, `Bearer error="invalid_token"`},
+		{"bad signature", token("bad-signature.jwt"), http.StatusUnauthorized, `Bearer error="invalid_token"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/greet-many", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.status, rec.Body)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+			t.Errorf("%s: WWW-Authenticate = %q, want %q", tt.name, got, tt.challenge)
+		}
+	}
+}
+
+// TestVerifyExpired checks that expiry is reported as ErrExpired, apart
+// from other failures.
+func TestVerifyExpired(t *testing.T) {
+	v, err := NewVerifier(devConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(strings.TrimSpace(string(fixtures.Read(t, "jwt/expired.jwt")))); err != ErrExpired {
+		t.Errorf("Verify(expired.jwt) error = %v, want ErrExpired", err)
+	}
+	if _, err := v.Verify(strings.TrimSpace(string(fixtures.Read(t, "jwt/bad-signature.jwt")))); err == nil || err == ErrExpired {
+		t.Errorf("Verify(bad-signature.jwt) error = %v, want a signature error", err)
+	}
+}
+
+// TestIssue checks that issued tokens expire after their TTL by the
+// verifier's clock.
+func TestIssue(t *testing.T) {
+	v, err := NewVerifier(devConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return issued }
+	token, err := v.Issue(jwt.MapClaims{"sub": "gladys"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify(issued token): %v", err)
+	}
+	if claims["sub"] != "gladys" || claims["exp"] != float64(issued.Add(time.Hour).Unix()) {
+		t.Errorf("Verify(issued token) claims = %v, want sub gladys expiring in an hour", claims)
+	}
+	v.now = func() time.Time { return issued.Add(time.Hour + time.Second) }
+	if _, err := v.Verify(token); err != ErrExpired {
+		t.Errorf("Verify(issued token) after its TTL error = %v, want ErrExpired", err)
+	}
+}
+
+// TestRotation signs a token with a key, rotates to a new one, and checks
+// the old token is accepted until the retired key's grace period ends.
+func TestRotation(t *testing.T) {
+	retired := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	v, err := NewVerifier(Config{SigningKey: "2026-04", Keys: map[string]Key{"2026-04": {Secret: []byte("old")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := v.Sign(jwt.MapClaims{"user": "gladys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Reconfigure(Config{
+		SigningKey: "2026-10",
+		Keys: map[string]Key{
+			"2026-10": {Secret: []byte("new")},
+			"2026-04": {Secret: []byte("old"), RetiredAt: retired},
+		},
+		Grace: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := v.Sign(jwt.MapClaims{"user": "gladys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user": "gladys"})
+	forged.Header["kid"] = "2025-01"
+	unknown, _ := forged.SignedString([]byte("old"))
+
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+		want  error
+	}{
+		{"current key", current, retired.Add(48 * time.Hour), nil},
+		{"retired key in grace", old, retired.Add(time.Hour), nil},
+		{"retired key after grace", old, retired.Add(25 * time.Hour), ErrRetiredKey},
+		{"unknown key", unknown, retired, ErrUnknownKey},
+	}
+	for _, tt := range tests {
+		v.now = func() time.Time { return tt.now }
+		if _, err := v.Verify(tt.token); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestConfigCheck checks that configurations that couldn't sign are
+// refused, and that Reconfigure keeps the current keys when they are.
+func TestConfigCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Config
+		want string
+	}{
+		{"valid", devConfig(), ""},
+		{"missing signing key", Config{SigningKey: "next", Keys: devConfig().Keys}, `signing key "next" is not configured`},
+		{"retired signing key", Config{SigningKey: "a", Keys: map[string]Key{"a": {Secret: []byte("s"), RetiredAt: time.Now()}}}, `signing key "a" is retired`},
+		{"empty secret", Config{SigningKey: "a", Keys: map[string]Key{"a": {Secret: []byte("s")}, "b": {}}}, `key "b" has no secret or key`},
+	}
+	for _, tt := range tests {
+		got := ""
+		if err := tt.c.Check(); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: Check() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	v, err := NewVerifier(devConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Reconfigure(Config{SigningKey: "next"}); err == nil {
+		t.Error("Reconfigure(invalid) succeeded, want an error")
+	}
+	if _, err := v.Verify(strings.TrimSpace(string(fixtures.Read(t, "jwt/valid.jwt")))); err != nil {
+		t.Errorf("Verify(valid.jwt) after a refused Reconfigure: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestGrants checks the claim shapes roles and scopes are read from.
+func TestGrants(t *testing.T) {
+	claims := jwt.MapClaims{
+		"roles": []interface{}{"admin", 7},
+		"scope": "greet:read  greet:write",
+		"scp":   []string{"webhooks:write"},
+	}
+	want := map[string]bool{"admin": true, "greet:read": true, "greet:write": true, "webhooks:write": true}
+	if got := Grants(claims); !reflect.DeepEqual(got, want) {
+		t.Errorf("Grants() = %v, want %v", got, want)
+	}
+	if got := Missing(claims, []string{"admin", "billing", "greet:write", "greet:delete"}); !reflect.DeepEqual(got, []string{"billing", "greet:delete"}) {
+		t.Errorf("Missing() = %v, want [billing greet:delete]", got)
+	}
+}
+
+// TestAuthorize checks that routes without requirements are left alone,
+// that others need a token, and that tokens short of the requirements get
+// a 403 naming what they lack.
+func TestAuthorize(t *testing.T) {
+	v, err := NewVerifier(devConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	required := map[string][]string{"/admin/stats": {"admin"}, "/greetings": {"greet:write"}}
+	h := v.Authorize(func(r *http.Request) []string { return required[r.URL.Path] })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := FromContext(r.Context()); !ok && len(required[r.URL.Path]) > 0 {
+			t.Errorf("%s: FromContext() ok = false after Authorize", r.URL.Path)
+		}
+	}))
+	sign := func(claims jwt.MapClaims) string {
+		token, err := v.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+	admin := sign(jwt.MapClaims{"sub": "gladys", "roles": []string{"admin"}})
+	writer := sign(jwt.MapClaims{"sub": "yusuf", "scope": "greet:read greet:write"})
+	tests := []struct {
+		path, authorization string
+		status              int
+		missing             []string
+	}{
+		{"/greet", "", http.StatusOK, nil},
+		{"/admin/stats", "", http.StatusUnauthorized, nil},
+		{"/admin/stats", "Bearer not-a-token", http.StatusUnauthorized, nil},
+		{"/admin/stats", admin, http.StatusOK, nil},
+		{"/admin/stats", writer, http.StatusForbidden, []string{"admin"}},
+		{"/greetings", writer, http.StatusOK, nil},
+		{"/greetings", admin, http.StatusForbidden, []string{"greet:write"}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("GET %s = %d, want %d", tt.path, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusForbidden {
+			continue
+		}
+		var body forbiddenBody
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(body.Missing, tt.missing) || !reflect.DeepEqual(body.Required, required[tt.path]) {
+			t.Errorf("GET %s 403 body = %+v, want missing %v", tt.path, body, tt.missing)
+		}
+		if got, want := rec.Header().Get("WWW-Authenticate"), `Bearer error="insufficient_scope", scope="`+required[tt.path][0]+`"`; got != want {
+			t.Errorf("GET %s WWW-Authenticate = %q, want %q", tt.path, got, want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned by Credentials for unknown users and
+// wrong passwords alike, so callers can't tell which.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Credentials checks the passwords users log in with. Implementations
+// might read a config file, a database, or a directory service.
+type Credentials interface {
+	// Authenticate returns the claims to add to user's tokens if password
+	// is theirs, and ErrInvalidCredentials otherwise.
+	Authenticate(ctx context.Context, user, password string) (jwt.MapClaims, error)
+}
+
+// User is an account of a StaticCredentials store.
+type User struct {
+	// PasswordHash is a bcrypt hash of the password, as printed by
+	// htpasswd -nbB user password after the colon.
+	PasswordHash string `mapstructure:"password_hash"`
+	// Claims are added to the user's tokens, such as {role: admin}.
+	Claims map[string]interface{} `mapstructure:"claims"`
+}
+
+// StaticCredentials is a fixed set of users by name, as read from the
+// configuration.
+type StaticCredentials map[string]User
+
+// unknownUserHash is compared against for users that don't exist, so they
+// take as long to refuse as wrong passwords.
+var unknownUserHash, _ = bcrypt.GenerateFromPassword([]byte("unknown user"), bcrypt.DefaultCost)
+
+// Authenticate checks password against user's bcrypt hash.
+func (s StaticCredentials) Authenticate(ctx context.Context, user, password string) (jwt.MapClaims, error) {
+	u, ok := s[user]
+	hash := []byte(u.PasswordHash)
+	if !ok {
+		hash = unknownUserHash
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		return nil, ErrInvalidCredentials
+	}
+	claims := make(jwt.MapClaims, len(u.Claims))
+	for k, v := range u.Claims {
+		claims[k] = v
+	}
+	return claims, nil
+}
+
+// Check reports users whose password hash isn't a bcrypt hash.
+func (s StaticCredentials) Check() error {
+	for name, u := range s {
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return fmt.Errorf("user %q: password_hash: %w", name, err)
+		}
+	}
+	return nil
+}
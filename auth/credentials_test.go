@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestStaticCredentials checks that only the right password of a known
+// user is accepted, and that the user's claims come back.
+func TestStaticCredentials(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	creds := StaticCredentials{"gladys": {PasswordHash: string(hash), Claims: map[string]interface{}{"role": "admin"}}}
+	if err := creds.Check(); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+
+	claims, err := creds.Authenticate(context.Background(), "gladys", "hunter2")
+	if err != nil || claims["role"] != "admin" {
+		t.Errorf(`Authenticate("gladys", right password) = %v, %v, want role admin`, claims, err)
+	}
+	for _, tt := range []struct{ user, password string }{
+		{"gladys", "hunter3"},
+		{"gladys", ""},
+		{"derin", "hunter2"},
+	} {
+		if _, err := creds.Authenticate(context.Background(), tt.user, tt.password); err != ErrInvalidCredentials {
+			t.Errorf("Authenticate(%q, %q) error = %v, want ErrInvalidCredentials", tt.user, tt.password, err)
+		}
+	}
+
+	if err := (StaticCredentials{"derin": {PasswordHash: "hunter2"}}).Check(); err == nil {
+		t.Error("Check() accepted a plain-text password_hash")
+	}
+}
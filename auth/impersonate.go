@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// ActClaim holds the party acting through a token on its subject's
+// behalf, as {"sub": "<actor>"} (RFC 8693 section 4.1). Impersonation
+// tokens carry it.
+const ActClaim = "act"
+
+// ErrNestedImpersonation is returned by Impersonate for an actor who is
+// already impersonating someone.
+var ErrNestedImpersonation = errors.New("impersonation tokens can't impersonate")
+
+// Impersonator returns who acts through claims, if they are an
+// impersonation token's.
+func Impersonator(claims jwt.MapClaims) (string, bool) {
+	act, _ := claims[ActClaim].(map[string]interface{})
+	sub, _ := act["sub"].(string)
+	return sub, sub != ""
+}
+
+// Impersonate issues a token valid for ttl that acts as user on behalf of
+// actor, the claims of whoever asks for it. It carries only the scopes
+// given, none of the user's or actor's roles, so it grants no more than
+// the user's identity and what was asked for.
+func (v *Verifier) Impersonate(actor jwt.MapClaims, user string, scopes []string, ttl time.Duration) (string, error) {
+	if _, ok := Impersonator(actor); ok {
+		return "", ErrNestedImpersonation
+	}
+	sub, _ := actor["sub"].(string)
+	claims := jwt.MapClaims{"sub": user, ActClaim: map[string]interface{}{"sub": sub}}
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	return v.Issue(claims, ttl)
+}
+
+// OnImpersonation makes the verifier call f with every request it
+// authenticates with an impersonation token, before the request is
+// served, such as to audit what was done through it. r carries the
+// token's claims. Call it before the verifier is used.
+func (v *Verifier) OnImpersonation(f func(r *http.Request, actor string)) {
+	v.impersonated = f
+}
+
+// serve calls h with r carrying claims, reporting it first if claims are
+// an impersonation token's. Requests already carrying claims were
+// reported by the layer that stored them.
+func (v *Verifier) serve(h http.Handler, w http.ResponseWriter, r *http.Request, claims jwt.MapClaims) {
+	_, seen := FromContext(r.Context())
+	r = r.WithContext(NewContext(r.Context(), claims))
+	if actor, ok := Impersonator(claims); ok && !seen && v.impersonated != nil {
+		v.impersonated(r, actor)
+	}
+	h.ServeHTTP(w, r)
+}
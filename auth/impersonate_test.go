@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestImpersonate checks that impersonation tokens act as the user with
+// only the scopes asked for, that each request made with one is reported
+// once, and that they can't impersonate in turn.
+func TestImpersonate(t *testing.T) {
+	v, _ := NewVerifier(devConfig())
+	var reported []string
+	v.OnImpersonation(func(r *http.Request, actor string) {
+		claims, _ := FromContext(r.Context())
+		reported = append(reported, actor+" as "+claims["sub"].(string))
+	})
+	admin := jwt.MapClaims{"sub": "ada", "roles": []string{"admin"}}
+	token, err := v.Impersonate(admin, "gladys", []string{"greet:write"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actor, ok := Impersonator(claims); !ok || actor != "ada" || claims["sub"] != "gladys" {
+		t.Errorf("Impersonator(%v) = %q, %t, want ada acting as gladys", claims, actor, ok)
+	}
+	if grants := Grants(claims); len(grants) != 1 || !grants["greet:write"] {
+		t.Errorf("Grants(impersonation token) = %v, want only greet:write", grants)
+	}
+
+	// Authorize stores the claims, so the Require inside doesn't report
+	// the request again.
+	h := v.Authorize(func(*http.Request) []string { return []string{"greet:write"} })(v.Require(func(http.ResponseWriter, *http.Request) {}))
+	req := httptest.NewRequest("POST", "/greetings", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if len(reported) != 1 || reported[0] != "ada as gladys" {
+		t.Errorf("reported %v, want the request once, as ada acting as gladys", reported)
+	}
+
+	if _, err := v.Impersonate(claims, "derin", nil, time.Minute); err != ErrNestedImpersonation {
+		t.Errorf("Impersonate(by an impersonation token) = %v, want ErrNestedImpersonation", err)
+	}
+}
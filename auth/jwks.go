@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// JWKSPath is where ServeJWKS is routed.
+const JWKSPath = "/.well-known/jwks.json"
+
+// JWK is a public key in JSON Web Key form (RFC 7517), for RSA and P-256
+// ECDSA keys.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv, X and Y are the curve and point of ECDSA keys.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys tokens are currently accepted with, sorted
+// by ID: the asymmetric keys that aren't retired or are still in their
+// grace period. HS256 secrets are never included.
+func (v *Verifier) JWKS() JWKS {
+	c := v.config.Load()
+	now := v.now()
+	set := JWKS{Keys: []JWK{}}
+	for id, k := range c.Keys {
+		if !k.RetiredAt.IsZero() && now.After(k.RetiredAt.Add(c.Grace)) {
+			continue
+		}
+		if jwk, ok := k.jwk(id); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// jwk returns the public half of k as a JWK, or false if k is a secret.
+func (k Key) jwk(id string) (JWK, bool) {
+	pub := k.Public
+	if k.Private != nil {
+		pub = k.Private.Public()
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA", Kid: id, Use: "sig", Alg: "RS256",
+			N: b64(pub.N.Bytes()),
+			E: b64(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case *ecdsa.PublicKey:
+		// Coordinates are fixed-width, as RFC 7518 section 6.2.1 requires.
+		point := make([]byte, 64)
+		pub.X.FillBytes(point[:32])
+		pub.Y.FillBytes(point[32:])
+		return JWK{
+			Kty: "EC", Kid: id, Use: "sig", Alg: "ES256",
+			Crv: "P-256", X: b64(point[:32]), Y: b64(point[32:]),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// ParseJWKS decodes a key set, such as another service's JWKSPath, into
+// verification-only keys by ID, ready for Config.Keys. Keys not used for
+// signatures are skipped; keys of unsupported types are an error.
+func ParseJWKS(data []byte) (map[string]Key, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decoding key set: %w", err)
+	}
+	keys := make(map[string]Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if jwk.Kid == "" {
+			return nil, errors.New("key set has a key without a kid")
+		}
+		pub, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = Key{Public: pub}
+	}
+	return keys, nil
+}
+
+func (jwk JWK) publicKey() (interface{}, error) {
+	decode := func(name, s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode("n", jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e", jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("curve %q is not supported; ES256 needs P-256", jwk.Crv)
+		}
+		x, err := decode("x", jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y", jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on P-256")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("key type %q is not supported", jwk.Kty)
+}
+
+// ServeJWKS responds with the verifier's JWKS, or 404 when it has no
+// public keys, as when only HS256 secrets are configured.
+func (v *Verifier) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	set := v.JWKS()
+	if len(set.Keys) == 0 {
+		respond.Error(w, http.StatusNotFound, "no public keys are configured")
+		return
+	}
+	// Short enough that verifiers pick up a new key during a rotation,
+	// which accepts it everywhere before signing with it.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respond.JSON(w, http.StatusOK, set)
+}
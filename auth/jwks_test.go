@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestJWKS publishes RSA and ECDSA keys and checks that a verifier built
+// from the served set accepts tokens signed with either, and that secrets
+// and keys retired past the grace period are left out.
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	config := Config{
+		SigningKey: "rsa",
+		Keys: map[string]Key{
+			"rsa":  {Private: rsaKey},
+			"ec":   {Public: ecKey.Public()},
+			"hmac": {Secret: []byte("not published")},
+			"old":  {Public: ecKey.Public(), RetiredAt: now.Add(-48 * time.Hour)},
+		},
+		Grace: 24 * time.Hour,
+	}
+	v, err := NewVerifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetClock(func() time.Time { return now })
+
+	rec := httptest.NewRecorder()
+	v.ServeJWKS(rec, httptest.NewRequest(http.MethodGet, JWKSPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", JWKSPath, rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc == "" {
+		t.Error("GET jwks has no Cache-Control header")
+	}
+	keys, err := ParseJWKS(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys["ec"].Public == nil || keys["rsa"].Public == nil {
+		t.Fatalf("ParseJWKS(served) = %v, want the ec and rsa keys", keys)
+	}
+	remote, err := NewVerifier(Config{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := v.Sign(jwt.MapClaims{"user": "gladys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Verify(token); err != nil {
+		t.Errorf("Verify() of an RS256 token with the published keys: %v", err)
+	}
+	ecSigner, _ := NewVerifier(Config{SigningKey: "ec", Keys: map[string]Key{"ec": {Private: ecKey}}})
+	token, _ = ecSigner.Sign(jwt.MapClaims{"user": "gladys"})
+	if _, err := remote.Verify(token); err != nil {
+		t.Errorf("Verify() of an ES256 token with the published keys: %v", err)
+	}
+}
+
+// TestJWKSSecretsOnly checks that a verifier with only HS256 secrets
+// publishes nothing.
+func TestJWKSSecretsOnly(t *testing.T) {
+	v, err := NewVerifier(Config{SigningKey: "default", Keys: map[string]Key{"default": {Secret: []byte(DevSecret)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	v.ServeJWKS(rec, httptest.NewRequest(http.MethodGet, JWKSPath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET %s status = %d, want 404", JWKSPath, rec.Code)
+	}
+}
+
+// TestParseJWKS checks that malformed or unsupported keys are refused and
+// that encryption keys are skipped.
+func TestParseJWKS(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{"empty", `{"keys":[]}`, 0, false},
+		{"encryption key", `{"keys":[{"kty":"RSA","kid":"a","use":"enc","n":"AQAB","e":"AQAB"}]}`, 0, false},
+		{"no kid", `{"keys":[{"kty":"RSA","n":"AQAB","e":"AQAB"}]}`, 0, true},
+		{"unknown type", `{"keys":[{"kty":"OKP","kid":"a","crv":"Ed25519","x":"AQAB"}]}`, 0, true},
+		{"other curve", `{"keys":[{"kty":"EC","kid":"a","crv":"P-384","x":"AQAB","y":"AQAB"}]}`, 0, true},
+		{"off curve", `{"keys":[{"kty":"EC","kid":"a","crv":"P-256","x":"AQAB","y":"AQAB"}]}`, 0, true},
+		{"bad base64", `{"keys":[{"kty":"RSA","kid":"a","n":"!!","e":"AQAB"}]}`, 0, true},
+		{"not JSON", `keys`, 0, true},
+	}
+	for _, tt := range tests {
+		keys, err := ParseJWKS([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ParseJWKS() error = %v, want error %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(keys) != tt.want {
+			t.Errorf("%s: ParseJWKS() = %d keys, want %d", tt.name, len(keys), tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Key is a key tokens are signed or verified with. It holds one of an
+// HMAC secret, a private key, or just a public key; which one decides the
+// algorithm, and tokens signed by any other are rejected.
+type Key struct {
+	// Secret signs and verifies HS256 tokens.
+	Secret []byte
+	// Private signs RS256 or ES256 tokens; its public half verifies them.
+	// It is an *rsa.PrivateKey, or an *ecdsa.PrivateKey on P-256.
+	Private crypto.Signer
+	// Public verifies RS256 or ES256 tokens signed elsewhere, so services
+	// can check tokens without holding anything that can sign them. It is
+	// an *rsa.PublicKey, or an *ecdsa.PublicKey on P-256.
+	Public crypto.PublicKey
+	// RetiredAt, when set, is when the key stopped being used. Tokens
+	// signed with it are accepted for Config.Grace after that. Keys that
+	// aren't retired are all accepted, so a new key can be rolled out to
+	// every replica before it signs anything.
+	RetiredAt time.Time
+}
+
+// method returns the algorithm of k.
+func (k Key) method() (jwt.SigningMethod, error) {
+	set := 0
+	for _, ok := range []bool{len(k.Secret) > 0, k.Private != nil, k.Public != nil} {
+		if ok {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return nil, errors.New("has no secret or key")
+	case set > 1:
+		return nil, errors.New("has more than one of a secret, a private key and a public key")
+	case len(k.Secret) > 0:
+		return jwt.SigningMethodHS256, nil
+	}
+	pub := k.Public
+	if k.Private != nil {
+		pub = k.Private.Public()
+	}
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("is an ECDSA key on %s; ES256 needs P-256", pub.Curve.Params().Name)
+		}
+		return jwt.SigningMethodES256, nil
+	}
+	return nil, fmt.Errorf("is a %T, not an RSA or ECDSA key", pub)
+}
+
+// signingKey returns what jwt-go signs with for k.
+func (k Key) signingKey() interface{} {
+	if k.Private != nil {
+		return k.Private
+	}
+	return k.Secret
+}
+
+// verificationKey returns what jwt-go verifies with for k.
+func (k Key) verificationKey() interface{} {
+	switch {
+	case k.Private != nil:
+		return k.Private.Public()
+	case k.Public != nil:
+		return k.Public
+	}
+	return k.Secret
+}
+
+// ParsePrivateKey parses a PEM-encoded RSA or ECDSA private key, in
+// PKCS #1, SEC 1 or PKCS #8 form.
+func ParsePrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("not a PEM-encoded private key")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", block.Type, err)
+	}
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s is a %T, not an RSA or ECDSA key", block.Type, k)
+}
+
+// ParsePublicKey parses a PEM-encoded RSA or ECDSA public key, in PKIX or
+// PKCS #1 form, or the key of a certificate.
+func ParsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("not a PEM-encoded public key")
+	}
+	var (
+		k   interface{}
+		err error
+	)
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			k = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		k, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		k, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", block.Type, err)
+	}
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		return k, nil
+	}
+	return nil, fmt.Errorf("%s is a %T, not an RSA or ECDSA key", block.Type, k)
+}
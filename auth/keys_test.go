@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestAsymmetric signs with RSA and ECDSA private keys and checks that a
+// verifier holding only the public keys accepts the tokens, and refuses
+// to sign.
+func TestAsymmetric(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := NewVerifier(Config{Keys: map[string]Key{
+		"rsa": {Public: rsaKey.Public()},
+		"ec":  {Public: ecKey.Public()},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		id  string
+		key crypto.Signer
+		alg string
+	}{
+		{"rsa", rsaKey, "RS256"},
+		{"ec", ecKey, "ES256"},
+	} {
+		signer, err := NewVerifier(Config{SigningKey: tt.id, Keys: map[string]Key{tt.id: {Private: tt.key}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := signer.Sign(jwt.MapClaims{"user": "gladys"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _, _ := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+		if parsed.Method.Alg() != tt.alg {
+			t.Errorf("%s: Sign() alg = %s, want %s", tt.id, parsed.Method.Alg(), tt.alg)
+		}
+		if _, err := public.Verify(token); err != nil {
+			t.Errorf("%s: Verify() with the public key: %v", tt.id, err)
+		}
+	}
+	if _, err := public.Sign(jwt.MapClaims{}); !errors.Is(err, ErrCannotSign) {
+		t.Errorf("Sign() on a public-only verifier error = %v, want ErrCannotSign", err)
+	}
+
+	// An HS256 token using the public key's encoding as the secret must
+	// not verify against the RSA key.
+	der, _ := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user": "mallory"})
+	confused.Header["kid"] = "rsa"
+	token, _ := confused.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if _, err := public.Verify(token); err == nil {
+		t.Error("Verify() accepted an HS256 token for an RSA key")
+	}
+}
+
+// TestParseKeys checks PEM parsing of private and public keys, and that
+// ECDSA keys off P-256 are refused.
+func TestParseKeys(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	priv, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParsePrivateKey(PKCS #8 ECDSA): %v", err)
+	}
+	if !ecKey.Equal(priv) {
+		t.Error("ParsePrivateKey() returned a different key")
+	}
+	pubDER, _ := x509.MarshalPKIXPublicKey(ecKey.Public())
+	pub, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+	if err != nil {
+		t.Fatalf("ParsePublicKey(ECDSA): %v", err)
+	}
+	if !ecKey.PublicKey.Equal(pub) {
+		t.Error("ParsePublicKey() returned a different key")
+	}
+	if _, err := ParsePrivateKey([]byte("secret-key")); err == nil {
+		t.Error("ParsePrivateKey(not PEM) succeeded, want an error")
+	}
+
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err := (Config{SigningKey: "a", Keys: map[string]Key{"a": {Private: p384}}}).Check(); err == nil {
+		t.Error("Check() accepted a P-384 key for ES256")
+	}
+}
+
+// TestAlgorithms checks that each algorithm is listed once, in order, and
+// that unusable keys are left out.
+func TestAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Config{Keys: map[string]Key{
+		"rsa":     {Public: rsaKey.Public()},
+		"old":     {Secret: []byte("s"), RetiredAt: time.Now()},
+		"default": {Secret: []byte("secret-key")},
+		"empty":   {},
+	}}
+	if got, want := c.Algorithms(), []string{"HS256", "RS256"}; !slices.Equal(got, want) {
+		t.Errorf("Algorithms() = %v, want %v", got, want)
+	}
+}
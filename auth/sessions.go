@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+)
+
+// ErrInvalidRefreshToken is returned for refresh tokens that were never
+// issued, have expired, or were revoked or already used.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// DefaultRefreshTTL is how long a refresh token stays valid unused.
+const DefaultRefreshTTL = 30 * 24 * time.Hour
+
+// Sessions keeps the refresh tokens of logged-in users in a cache, so they
+// can be revoked. Each refresh token can be used once: Rotate replaces it.
+// A bounded cache may evict sessions under pressure, which logs their
+// users out.
+type Sessions struct {
+	Cache cache.Cache
+	// TTL is how long a refresh token stays valid unused.
+	TTL time.Duration
+}
+
+// NewSessions returns sessions kept in c, expiring after ttl unused, or
+// DefaultRefreshTTL if ttl isn't positive.
+func NewSessions(c cache.Cache, ttl time.Duration) *Sessions {
+	if ttl <= 0 {
+		ttl = DefaultRefreshTTL
+	}
+	return &Sessions{Cache: c, TTL: ttl}
+}
+
+// sessionKey is the cache key of a refresh token. Tokens are stored
+// hashed, so whoever can read the cache can't use them.
+func sessionKey(refresh string) string {
+	sum := sha256.Sum256([]byte(refresh))
+	return "session:" + hex.EncodeToString(sum[:])
+}
+
+// Create starts a session whose access tokens carry claims and returns its
+// refresh token.
+func (s *Sessions) Create(ctx context.Context, claims jwt.MapClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(buf)
+	if err := s.Cache.Set(ctx, sessionKey(refresh), data, s.TTL); err != nil {
+		return "", fmt.Errorf("storing session: %w", err)
+	}
+	return refresh, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same session,
+// returning the session's claims with it. The old token stops working.
+func (s *Sessions) Rotate(ctx context.Context, refresh string) (jwt.MapClaims, string, error) {
+	v, ok, err := s.Cache.Get(ctx, sessionKey(refresh))
+	if err != nil {
+		return nil, "", fmt.Errorf("loading session: %w", err)
+	}
+	data, _ := v.([]byte)
+	if !ok || data == nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err := s.Revoke(ctx, refresh); err != nil {
+		return nil, "", err
+	}
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, "", fmt.Errorf("decoding session: %w", err)
+	}
+	next, err := s.Create(ctx, claims)
+	return claims, next, err
+}
+
+// Revoke ends the session of refresh. Revoking an unknown token is not an
+// error.
+func (s *Sessions) Revoke(ctx context.Context, refresh string) error {
+	if err := s.Cache.Delete(ctx, sessionKey(refresh)); err != nil {
+		return fmt.Errorf("revoking session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+)
+
+// TestSessions rotates a refresh token, checks the old one is spent, and
+// that revoked and expired tokens are refused.
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := cache.NewLRU(0, 0, 0)
+	c.SetClock(func() time.Time { return now })
+	s := NewSessions(c, time.Hour)
+
+	first, err := s.Create(ctx, jwt.MapClaims{"sub": "gladys"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, second, err := s.Rotate(ctx, first)
+	if err != nil || claims["sub"] != "gladys" {
+		t.Fatalf("Rotate(first) = %v, %v, want sub gladys", claims, err)
+	}
+	if _, _, err := s.Rotate(ctx, first); err != ErrInvalidRefreshToken {
+		t.Errorf("Rotate(first) again error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	if err := s.Revoke(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Rotate(ctx, second); err != ErrInvalidRefreshToken {
+		t.Errorf("Rotate(revoked) error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	third, _ := s.Create(ctx, jwt.MapClaims{"sub": "gladys"})
+	now = now.Add(2 * time.Hour)
+	if _, _, err := s.Rotate(ctx, third); err != ErrInvalidRefreshToken {
+		t.Errorf("Rotate(expired) error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -0,0 +1,124 @@
+// Package bodylimit caps how much of a request body handlers may read,
+// so a client can't make one buffer or decode unbounded input.
+package bodylimit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// DefaultMaxBytes is the default cap on request bodies.
+const DefaultMaxBytes = 1 << 20
+
+var tooLarge = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "http_request_body_too_large_total",
+	Help: "Requests rejected with 413 for a body over the size limit.",
+})
+
+// Middleware limits request bodies to max bytes with http.MaxBytesReader.
+// Requests declaring a larger Content-Length are rejected with 413 before
+// they reach next. For those that only turn out too large while being
+// read, whatever error response next makes of the failed read is replaced
+// by the same 413, provided nothing was written yet. A max of zero or
+// less disables the limit.
+func Middleware(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+		msg := "request body is larger than " + strconv.FormatInt(max, 10) + " bytes"
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > max {
+				tooLarge.Inc()
+				respond.Error(w, http.StatusRequestEntityTooLarge, msg)
+				return
+			}
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			lw := &limitWriter{ResponseWriter: w, msg: msg}
+			r.Body = &limitReader{ReadCloser: http.MaxBytesReader(w, r.Body, max), w: lw}
+			next.ServeHTTP(lw, r)
+		})
+	}
+}
+
+// limitReader notes on w when the body turns out too large.
+type limitReader struct {
+	io.ReadCloser
+	w *limitWriter
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		l.w.exceeded = true
+	}
+	return n, err
+}
+
+// limitWriter answers 413 in place of the handler's response once the
+// body was too large.
+type limitWriter struct {
+	http.ResponseWriter
+	msg      string
+	exceeded bool
+	wrote    bool
+	replaced bool
+}
+
+func (w *limitWriter) WriteHeader(status int) {
+	if w.wrote {
+		return
+	}
+	w.wrote = true
+	if w.exceeded {
+		w.replaced = true
+		tooLarge.Inc()
+		w.Header().Del("Content-Length")
+		respond.Error(w.ResponseWriter, http.StatusRequestEntityTooLarge, w.msg)
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush lets streaming responses through.
+func (w *limitWriter) Flush() {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through.
+func (w *limitWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (w *limitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,51 @@
+package bodylimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echo decodes a JSON body and responds 400 if it can't, as handlers do.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var v map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+})
+
+// TestMiddleware checks that bodies within the limit reach the handler
+// and that larger ones get a JSON 413, whether declared or streamed.
+func TestMiddleware(t *testing.T) {
+	h := Middleware(32)(echo)
+	large := `{"name":"` + strings.Repeat("a", 64) + `"}`
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		want    int
+	}{
+		{"small", `{"name":"Gladys"}`, false, http.StatusCreated},
+		{"declared", large, false, http.StatusRequestEntityTooLarge},
+		{"streamed", large, true, http.StatusRequestEntityTooLarge},
+		{"bad json", `{"name":`, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/greetings", strings.NewReader(tt.body))
+		if tt.chunked {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+		if tt.want == http.StatusRequestEntityTooLarge && !strings.HasPrefix(rec.Body.String(), `{"error":"request body is larger than 32 bytes"`) {
+			t.Errorf("%s: body = %s, want a JSON error", tt.name, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DevVersion is the version of builds with no stamped version.
+const DevVersion = "dev"
+
+// Build identifies the running build. It is what the version subcommand
+// prints and /version reports.
+type Build struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit,omitempty"`
+	// BuildTime is when the binary was built, in RFC 3339.
+	BuildTime string `json:"build_timestamp,omitempty"`
+	GoVersion string `json:"go_version"`
+	// Stamped is false when the commit and time come from the VCS
+	// information go build records instead of Bazel stamping.
+	Stamped bool `json:"stamped"`
+}
+
+// Current returns the running build. Unstamped builds report DevVersion,
+// and the commit and commit time go build recorded, if any.
+func Current() Build {
+	b := Build{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildTime: stampTime(BuildTimestamp),
+		GoVersion: runtime.Version(),
+		Stamped:   GitCommit != "" || Version != "",
+	}
+	if !b.Stamped {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range bi.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					b.GitCommit = s.Value
+				case "vcs.time":
+					b.BuildTime = s.Value
+				}
+			}
+		}
+	}
+	if b.Version == "" {
+		b.Version = DevVersion
+	}
+	return b
+}
+
+// stampTime converts BUILD_TIMESTAMP, which is in Unix seconds, to RFC
+// 3339. Anything else is returned as is.
+func stampTime(ts string) string {
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ts
+	}
+	return time.Unix(secs, 0).UTC().Format(time.RFC3339)
+}
+
+// String formats b on one line, like "v1.4.0 (commit 1a2b3c4d5e6f, built
+// 2026-01-02T15:04:05Z, go1.24.0)".
+func (b Build) String() string {
+	parts := []string{}
+	if b.GitCommit != "" {
+		commit := b.GitCommit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		parts = append(parts, "commit "+commit)
+	}
+	if b.BuildTime != "" {
+		parts = append(parts, "built "+b.BuildTime)
+	}
+	parts = append(parts, b.GoVersion)
+	return fmt.Sprintf("%s (%s)", b.Version, strings.Join(parts, ", "))
+}
@@ -0,0 +1,131 @@
+// Package buildinfo describes the running binary: its SHA-256, the Go
+// module build information, and the values Bazel stamped into it, so a
+// deployment can check it runs the artifact that was released.
+package buildinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// Stamped by Bazel through x_defs when building with --config=release. They
+// stay empty in unstamped and plain go builds.
+var (
+	GitCommit      string
+	Version        string
+	BuildTimestamp string
+	BuildUser      string
+	BuildHost      string
+)
+
+// Module is one module the binary was built from.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+	// Replace is set when the module was replaced in go.mod.
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// Info is what is known about the running binary.
+type Info struct {
+	// SHA256 is the hex digest of the executable file. It is empty if the
+	// file couldn't be read.
+	SHA256    string            `json:"sha256,omitempty"`
+	GoVersion string            `json:"go_version,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Main      *Module           `json:"main,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+	Deps      []Module          `json:"deps,omitempty"`
+	// Stamp holds the non-empty Bazel stamp values.
+	Stamp map[string]string `json:"stamp,omitempty"`
+}
+
+var (
+	digestOnce sync.Once
+	digest     string
+	digestErr  error
+)
+
+// SHA256 returns the hex SHA-256 of the running executable. The file is
+// hashed once; later calls return the same result.
+func SHA256() (string, error) {
+	digestOnce.Do(func() {
+		digest, digestErr = hashExecutable()
+	})
+	return digest, digestErr
+}
+
+func hashExecutable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("buildinfo: %w", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("buildinfo: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("buildinfo: hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Stamp returns the non-empty Bazel stamp values by their workspace status
+// key.
+func Stamp() map[string]string {
+	stamp := make(map[string]string)
+	for k, v := range map[string]string{
+		"STABLE_GIT_COMMIT": GitCommit,
+		"STABLE_VERSION":    Version,
+		"BUILD_TIMESTAMP":   BuildTimestamp,
+		"BUILD_USER":        BuildUser,
+		"BUILD_HOST":        BuildHost,
+	} {
+		if v != "" {
+			stamp[k] = v
+		}
+	}
+	return stamp
+}
+
+// Read returns the Info of the running binary. An unreadable executable
+// only leaves SHA256 empty.
+func Read() Info {
+	info := Info{Stamp: Stamp()}
+	info.SHA256, _ = SHA256()
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+	info.Path = bi.Path
+	main := module(&bi.Main)
+	info.Main = &main
+	if len(bi.Settings) > 0 {
+		info.Settings = make(map[string]string, len(bi.Settings))
+		for _, s := range bi.Settings {
+			info.Settings[s.Key] = s.Value
+		}
+	}
+	for _, d := range bi.Deps {
+		info.Deps = append(info.Deps, module(d))
+	}
+	return info
+}
+
+func module(m *debug.Module) Module {
+	out := Module{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		r := module(m.Replace)
+		out.Replace = &r
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package buildinfo
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRead checks that the test binary hashes and that only set stamp
+// values are reported.
+func TestRead(t *testing.T) {
+	GitCommit = "abc123"
+	defer func() { GitCommit = "" }()
+
+	info := Read()
+	if len(info.SHA256) != 64 {
+		t.Errorf("SHA256 = %q, want a hex digest", info.SHA256)
+	}
+	if len(info.Stamp) != 1 || info.Stamp["STABLE_GIT_COMMIT"] != "abc123" {
+		t.Errorf("Stamp = %v, want only STABLE_GIT_COMMIT", info.Stamp)
+	}
+	if info.GoVersion == "" {
+		t.Error("GoVersion is empty, want the toolchain version")
+	}
+}
+
+// TestCurrent checks that stamped values are reported, with the build
+// timestamp converted to RFC 3339.
+func TestCurrent(t *testing.T) {
+	Version, GitCommit, BuildTimestamp = "v1.4.0", "1a2b3c4d5e6f7a8b", "1700000000"
+	defer func() { Version, GitCommit, BuildTimestamp = "", "", "" }()
+
+	b := Current()
+	want := Build{Version: "v1.4.0", GitCommit: "1a2b3c4d5e6f7a8b", BuildTime: "2023-11-14T22:13:20Z", GoVersion: b.GoVersion, Stamped: true}
+	if b != want {
+		t.Errorf("Current() = %+v, want %+v", b, want)
+	}
+	if got, prefix := b.String(), "v1.4.0 (commit 1a2b3c4d5e6f, built 2023-11-14T22:13:20Z, go"; !strings.HasPrefix(got, prefix) {
+		t.Errorf("String() = %q, want prefix %q", got, prefix)
+	}
+}
+
+// TestCurrentUnstamped checks the fallback version of plain go builds.
+func TestCurrentUnstamped(t *testing.T) {
+	if b := Current(); b.Version != DevVersion || b.Stamped {
+		t.Errorf("Current() = %+v, want version %s, unstamped", b, DevVersion)
+	}
+}
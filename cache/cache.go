@@ -0,0 +1,100 @@
+// Package cache defines the cache interface used across the application and
+// its in-memory implementation.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// NoExpiration stores an entry until it is deleted.
+const NoExpiration time.Duration = -1
+
+// Cache is a key/value cache. Every method takes a context so remote
+// implementations can honour cancellation; implementations return the
+// context's error once it is done.
+type Cache interface {
+	// Get returns the value for key and whether it was found.
+	Get(ctx context.Context, key string) (interface{}, bool, error)
+	// Set stores value under key for ttl. A ttl of zero uses the cache's
+	// default expiration.
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Flusher is a Cache that can remove every entry at once.
+type Flusher interface {
+	Cache
+	// Flush removes every entry.
+	Flush()
+}
+
+// Memory is a Cache backed by go-cache.
+type Memory struct {
+	c *gocache.Cache
+}
+
+var _ Flusher = (*Memory)(nil)
+
+// NewMemory returns an in-memory cache with the given default expiration
+// and cleanup interval.
+func NewMemory(defaultTTL, cleanupInterval time.Duration) *Memory {
+	return &Memory{c: gocache.New(defaultTTL, cleanupInterval)}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	v, ok := m.c.Get(key)
+	return v, ok, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ttl == 0 {
+		ttl = gocache.DefaultExpiration
+	}
+	m.c.Set(key, value, ttl)
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.c.Delete(key)
+	return nil
+}
+
+// Flush removes every entry.
+func (m *Memory) Flush() {
+	m.c.Flush()
+}
+
+// Config selects and sizes a cache implementation.
+type Config struct {
+	// Backend is "memory" (unbounded, go-cache) or "lru" (bounded).
+	Backend    string
+	DefaultTTL time.Duration
+	// MaxEntries and MaxBytes bound the "lru" backend; zero is unbounded.
+	MaxEntries int
+	MaxBytes   int
+}
+
+// New returns the cache described by cfg.
+func New(cfg Config) (Cache, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemory(cfg.DefaultTTL, 2*cfg.DefaultTTL), nil
+	case "lru":
+		return NewLRU(cfg.MaxEntries, cfg.MaxBytes, cfg.DefaultTTL), nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/ctxerr"
+)
+
+// TestCacheTakesContext audits the Cache interface for methods that can't
+// be canceled.
+func TestCacheTakesContext(t *testing.T) {
+	if missing := ctxerr.MissingContext(reflect.TypeOf((*Cache)(nil)).Elem()); len(missing) > 0 {
+		t.Fatalf("Cache methods without a leading context.Context: %v", missing)
+	}
+}
+
+// TestMemoryCanceled checks that Memory refuses work on a canceled context.
+func TestMemoryCanceled(t *testing.T) {
+	m := NewMemory(0, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Set(ctx, "k", "v", 0); err != context.Canceled {
+		t.Fatalf("Set on canceled context = %v, want context.Canceled", err)
+	}
+	if _, ok, err := m.Get(context.Background(), "k"); ok || err != nil {
+		t.Fatalf("Get after canceled Set = %v, %v, want false, nil", ok, err)
+	}
+}
+
+// TestLRUEviction checks eviction by entry count, by size, and recency.
+func TestLRUEviction(t *testing.T) {
+	ctx := context.Background()
+
+	c := NewLRU(2, 0, 0)
+	c.Set(ctx, "a", "1", 0)
+	c.Set(ctx, "b", "2", 0)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", "3", 0)
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Errorf("b still cached; want it evicted as least recently used")
+	}
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Errorf("a evicted; want it kept after recent Get")
+	}
+
+	big := make([]byte, 100)
+	c = NewLRU(0, 2*(100+1+entryOverhead), 0)
+	c.Set(ctx, "x", big, 0)
+	c.Set(ctx, "y", big, 0)
+	c.Set(ctx, "z", big, 0)
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d after exceeding max bytes, want 2", c.Len())
+	}
+	if _, ok, _ := c.Get(ctx, "x"); ok {
+		t.Errorf("x still cached; want it evicted for size")
+	}
+}
+
+// TestLRUExpiry checks that entries past their ttl are not returned.
+func TestLRUExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c := NewLRU(0, 0, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Set(ctx, "a", "1", 0)
+
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := c.Get(ctx, "a"); ok {
+		t.Fatalf("expired entry returned")
+	}
+	if c.Len() != 0 {
+		t.Fatalf("Len() = %d after expired Get, want 0", c.Len())
+	}
+}
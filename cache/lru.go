@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is a Cache bounded by entry count and approximate size in bytes.
+// When either limit is exceeded the least recently used entries are
+// evicted.
+type LRU struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int
+	defaultTTL time.Duration
+	bytes      int
+	ll         *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	size    int
+	expires time.Time
+}
+
+var _ Flusher = (*LRU)(nil)
+
+// NewLRU returns an LRU cache holding at most maxEntries entries and about
+// maxBytes bytes of values. A zero limit is unbounded; a zero defaultTTL
+// means entries don't expire unless Set is given a ttl.
+func NewLRU(maxEntries, maxBytes int, defaultTTL time.Duration) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		defaultTTL: defaultTTL,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// SetClock makes entries expire by now instead of the wall clock, for
+// tests.
+func (c *LRU) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Flush removes every entry.
+func (c *LRU) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+func (c *LRU) Get(ctx context.Context, key string) (interface{}, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && c.now().After(e.expires) {
+		c.remove(el)
+		return nil, false, nil
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (c *LRU) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ttl == 0 {
+		ttl = c.defaultTTL
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+	size := approxSize(key, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	// A value bigger than the whole cache would only evict everything
+	// else and then itself.
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return nil
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, size: size, expires: expires})
+	c.bytes += size
+
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		c.remove(c.ll.Back())
+	}
+	return nil
+}
+
+func (c *LRU) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet
+// evicted.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Bytes returns the approximate size of the cached entries.
+func (c *LRU) Bytes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+func (c *LRU) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*lruEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+// Sizer can be implemented by cached values that know their own size.
+type Sizer interface {
+	Size() int
+}
+
+// entryOverhead approximates the bookkeeping cost of one entry.
+const entryOverhead = 64
+
+func approxSize(key string, value interface{}) int {
+	n := len(key) + entryOverhead
+	switch v := value.(type) {
+	case Sizer:
+		n += v.Size()
+	case string:
+		n += len(v)
+	case []byte:
+		n += len(v)
+	case map[string]string:
+		for k, s := range v {
+			n += len(k) + len(s)
+		}
+	default:
+		n += 16
+	}
+	return n
+}
@@ -0,0 +1,177 @@
+// Package canary sends a share of a route's requests to alternate
+// implementations of its handler, chosen by request header or by
+// percentage bucket, and measures each variant, so a handler rewrite can
+// be compared against the original in production.
+package canary
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// Primary is the variant name of the route's original handler.
+const Primary = "primary"
+
+// VariantHeader tells the client which variant served the response.
+const VariantHeader = "X-Variant"
+
+// buckets is the number of percentage buckets: hundredths of a percent.
+const buckets = 10000
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "canary_requests_total",
+		Help: "Requests to routes with variants, by route, variant and status class.",
+	}, []string{"route", "variant", "status"})
+	duration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "canary_request_duration_seconds",
+		Help:    "Time to serve requests to routes with variants, by route and variant.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "variant"})
+)
+
+// Rule picks a variant for matching requests.
+type Rule struct {
+	Variant string `mapstructure:"variant"`
+	// Header, when set, limits the rule to requests carrying it, with
+	// Value if that is set too.
+	Header string `mapstructure:"header"`
+	Value  string `mapstructure:"value"`
+	// Percent, when set, limits the rule to that share of requests.
+	Percent float64 `mapstructure:"percent"`
+}
+
+// Config is the variant routing of one route.
+type Config struct {
+	// Rules are tried in order; the first that matches picks the variant.
+	// Requests matching none get Primary.
+	Rules []Rule `mapstructure:"rules"`
+	// BucketHeader, such as X-User-ID, keys percentage buckets so a caller
+	// keeps getting the same variant. Requests without it are bucketed at
+	// random.
+	BucketHeader string `mapstructure:"bucket_header"`
+}
+
+// splitter serves one route.
+type splitter struct {
+	route    string
+	cfg      Config
+	handlers map[string]http.HandlerFunc
+	// bucket returns a number in [0, buckets); replaced in tests.
+	bucket func(r *http.Request) int
+}
+
+// Split returns a handler for route that serves each request with the
+// variant cfg picks: primary, or one of variants by name. Rules naming a
+// variant that doesn't exist are logged and skipped. Without rules it
+// returns primary itself.
+func Split(route string, cfg Config, primary http.HandlerFunc, variants map[string]http.HandlerFunc) http.HandlerFunc {
+	s := newSplitter(route, cfg, primary, variants)
+	if s == nil {
+		return primary
+	}
+	return s.serve
+}
+
+// newSplitter returns the splitter behind Split, or nil if no rule is
+// usable.
+func newSplitter(route string, cfg Config, primary http.HandlerFunc, variants map[string]http.HandlerFunc) *splitter {
+	handlers := map[string]http.HandlerFunc{Primary: primary}
+	for name, h := range variants {
+		handlers[name] = h
+	}
+	var rules []Rule
+	for _, rule := range cfg.Rules {
+		if handlers[rule.Variant] == nil {
+			logrus.WithFields(logrus.Fields{"route": route, "variant": rule.Variant}).Warn("canary: rule names an unknown variant; skipping it")
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	cfg.Rules = rules
+	s := &splitter{route: route, cfg: cfg, handlers: handlers}
+	s.bucket = s.hashBucket
+	return s
+}
+
+// hashBucket buckets r by its BucketHeader, or at random without one.
+func (s *splitter) hashBucket(r *http.Request) int {
+	key := ""
+	if s.cfg.BucketHeader != "" {
+		key = r.Header.Get(s.cfg.BucketHeader)
+	}
+	if key == "" {
+		return rand.IntN(buckets)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s.route + "\x00" + key))
+	return int(h.Sum32() % buckets)
+}
+
+// pick returns the variant for r.
+func (s *splitter) pick(r *http.Request) string {
+	bucket := -1
+	for _, rule := range s.cfg.Rules {
+		if rule.Header != "" {
+			v := r.Header.Get(rule.Header)
+			if v == "" || (rule.Value != "" && v != rule.Value) {
+				continue
+			}
+		}
+		if rule.Percent > 0 {
+			if bucket < 0 {
+				bucket = s.bucket(r)
+			}
+			if float64(bucket) >= rule.Percent*buckets/100 {
+				continue
+			}
+		}
+		return rule.Variant
+	}
+	return Primary
+}
+
+func (s *splitter) serve(w http.ResponseWriter, r *http.Request) {
+	variant := s.pick(r)
+	w.Header().Set(VariantHeader, variant)
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	s.handlers[variant](sw, r)
+	duration.WithLabelValues(s.route, variant).Observe(time.Since(start).Seconds())
+	requests.WithLabelValues(s.route, variant, strconv.Itoa(sw.status/100)+"xx").Inc()
+}
+
+// statusWriter records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.status, w.wrote = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
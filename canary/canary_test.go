@@ -0,0 +1,74 @@
+package canary
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// variantHandler answers with its name.
+func variantHandler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, name) }
+}
+
+// TestSplit checks that header rules, percentage buckets and the primary
+// fallback pick the expected variant, and that rules naming unknown
+// variants are skipped.
+func TestSplit(t *testing.T) {
+	cfg := Config{Rules: []Rule{
+		{Variant: "buffered", Header: "X-Canary", Value: "buffered"},
+		{Variant: "missing", Header: "X-Canary"},
+		{Variant: "buffered", Percent: 5},
+	}}
+	s := newSplitter("/greet-many", cfg, variantHandler(Primary), map[string]http.HandlerFunc{"buffered": variantHandler("buffered")})
+	var bucket int
+	s.bucket = func(*http.Request) int { return bucket }
+
+	tests := []struct {
+		header string
+		bucket int
+		want   string
+	}{
+		{"buffered", 9999, "buffered"},
+		{"other", 9999, Primary},
+		{"", 499, "buffered"},
+		{"", 500, Primary},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/greet-many", nil)
+		if tt.header != "" {
+			req.Header.Set("X-Canary", tt.header)
+		}
+		bucket = tt.bucket
+		rec := httptest.NewRecorder()
+		s.serve(rec, req)
+		if got := rec.Body.String(); got != tt.want || rec.Header().Get(VariantHeader) != tt.want {
+			t.Errorf("X-Canary %q, bucket %d: served %q (%s %q), want %q", tt.header, tt.bucket, got, VariantHeader, rec.Header().Get(VariantHeader), tt.want)
+		}
+	}
+}
+
+// TestSplitNoRules checks that a route without rules keeps its handler.
+func TestSplitNoRules(t *testing.T) {
+	h := Split("/greet", Config{Rules: []Rule{{Variant: "missing"}}}, variantHandler(Primary), nil)
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/greet", nil))
+	if rec.Header().Get(VariantHeader) != "" || rec.Body.String() != Primary {
+		t.Errorf("Split() without usable rules served %q with %s %q, want the primary handler unwrapped", rec.Body, VariantHeader, rec.Header().Get(VariantHeader))
+	}
+}
+
+// TestBucketSticky checks that a bucket header keeps a caller on one
+// bucket.
+func TestBucketSticky(t *testing.T) {
+	s := &splitter{route: "/greet-many", cfg: Config{BucketHeader: "X-User-ID"}}
+	req := httptest.NewRequest("GET", "/greet-many", nil)
+	req.Header.Set("X-User-ID", "gladys")
+	first := s.hashBucket(req)
+	for i := 0; i < 10; i++ {
+		if got := s.hashBucket(req); got != first {
+			t.Fatalf("hashBucket() = %d, then %d, want the same bucket", first, got)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+// Package clients identifies the integration behind each request, from
+// the X-Client-Name and X-Client-Version headers or from its API key, then
+// counts and rate-limits requests per client and remembers which clients
+// are active, so noisy integrations can be found and throttled.
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Request headers that identify a client.
+const (
+	NameHeader    = "X-Client-Name"
+	VersionHeader = "X-Client-Version"
+	APIKeyHeader  = "X-API-Key"
+)
+
+// Anonymous is the name of requests that don't identify themselves.
+const Anonymous = "anonymous"
+
+// Other is the name used once MaxTracked clients are known, so made-up
+// names can't grow memory or metrics without bound.
+const Other = "other"
+
+// MaxTracked caps the number of distinct client names tracked.
+const MaxTracked = 1000
+
+// maxVersions caps the versions remembered per client.
+const maxVersions = 20
+
+var (
+	requestsByClient = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_by_client_total",
+		Help: "Requests by client name.",
+	}, []string{"client"})
+	rateLimitedByClient = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_rate_limited_total",
+		Help: "Requests rejected by the per-client rate limit, by client name.",
+	}, []string{"client"})
+)
+
+// validToken matches acceptable client names and versions.
+var validToken = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,63}$`)
+
+// Errors returned by Identify.
+var (
+	ErrMissing    = errors.New("clients: request doesn't identify its client")
+	ErrUnknownKey = errors.New("clients: unknown API key")
+)
+
+// Identity names the client behind a request.
+type Identity struct {
+	Name    string
+	Version string
+}
+
+// Limit is a token-bucket rate limit. A zero Rate means unlimited.
+type Limit struct {
+	// Rate is the sustained requests per second.
+	Rate float64 `mapstructure:"rate"`
+	// Burst is how many requests may arrive at once. Zero means one
+	// second's worth of Rate.
+	Burst int `mapstructure:"burst"`
+}
+
+// burst returns the bucket size for l.
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// Config says how clients are identified and limited.
+type Config struct {
+	// Require rejects requests that neither send X-Client-Name nor an
+	// API key.
+	Require bool
+	// APIKeys maps the HashAPIKey digests of API keys to client names, so
+	// the keys themselves aren't kept. A name derived from a key can't be
+	// overridden by the X-Client-Name header.
+	APIKeys map[string]string
+	// Limit applies to every client without an entry in Limits.
+	// Anonymous requests share one bucket.
+	Limit  Limit
+	Limits map[string]Limit
+}
+
+// Client is what the registry knows about one client.
+type Client struct {
+	Name      string    `json:"name"`
+	Versions  []string  `json:"versions,omitempty"`
+	Requests  int64     `json:"requests"`
+	Limited   int64     `json:"limited"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// state is a tracked client and its rate-limit bucket.
+type state struct {
+	Client
+	versions map[string]bool
+	tokens   float64
+	filled   time.Time
+}
+
+// Registry identifies, limits, and tracks clients. It is safe for
+// concurrent use.
+type Registry struct {
+	config atomic.Pointer[Config]
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*state
+}
+
+// NewRegistry returns a registry using c.
+func NewRegistry(c Config) *Registry {
+	reg := &Registry{now: time.Now, clients: make(map[string]*state)}
+	reg.config.Store(&c)
+	return reg
+}
+
+// SetClock makes rate limits refill by now instead of the wall clock, for
+// tests. Call it before the registry is used.
+func (reg *Registry) SetClock(now func() time.Time) {
+	reg.now = now
+}
+
+// Reconfigure replaces the registry's configuration, as after a config
+// reload. What is tracked about clients is kept; their buckets take the
+// new limits on their next request.
+func (reg *Registry) Reconfigure(c Config) {
+	reg.config.Store(&c)
+}
+
+// Identify returns the client r says it comes from.
+func (reg *Registry) Identify(r *http.Request) (Identity, error) {
+	config := reg.config.Load()
+	id := Identity{Name: r.Header.Get(NameHeader), Version: r.Header.Get(VersionHeader)}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		name, ok := config.APIKeys[HashAPIKey(key)]
+		if !ok {
+			return Identity{}, ErrUnknownKey
+		}
+		id.Name = name
+	}
+	if id.Name == "" {
+		if config.Require {
+			return Identity{}, ErrMissing
+		}
+		id.Name = Anonymous
+	}
+	if !validToken.MatchString(id.Name) {
+		return Identity{}, fmt.Errorf("clients: invalid %s %q", NameHeader, id.Name)
+	}
+	if id.Version != "" && !validToken.MatchString(id.Version) {
+		return Identity{}, fmt.Errorf("clients: invalid %s %q", VersionHeader, id.Version)
+	}
+	return id, nil
+}
+
+// HashAPIKey returns the digest API keys are configured by: the
+// lower-case hex SHA-256 of key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// limit returns the rate limit for name.
+func (reg *Registry) limit(name string) Limit {
+	config := reg.config.Load()
+	if l, ok := config.Limits[name]; ok {
+		return l
+	}
+	return config.Limit
+}
+
+// Allow records a request from id and reports whether its rate limit lets
+// it through. When it doesn't, retryAfter says when the next request will
+// be allowed. It returns the name the request was tracked under, which is
+// Other once MaxTracked clients are known.
+func (reg *Registry) Allow(id Identity) (name string, ok bool, retryAfter time.Duration) {
+	now := reg.now()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	s := reg.clients[id.Name]
+	if s == nil && len(reg.clients) >= MaxTracked {
+		id = Identity{Name: Other}
+		s = reg.clients[Other]
+	}
+	limit := reg.limit(id.Name)
+	if s == nil {
+		s = &state{
+			Client:   Client{Name: id.Name, FirstSeen: now},
+			versions: make(map[string]bool),
+			tokens:   limit.burst(),
+			filled:   now,
+		}
+		reg.clients[id.Name] = s
+	}
+	s.Requests++
+	s.LastSeen = now
+	if id.Version != "" && !s.versions[id.Version] && len(s.versions) < maxVersions {
+		s.versions[id.Version] = true
+	}
+
+	if limit.Rate <= 0 {
+		return id.Name, true, 0
+	}
+	s.tokens = math.Min(limit.burst(), s.tokens+now.Sub(s.filled).Seconds()*limit.Rate)
+	s.filled = now
+	if s.tokens < 1 {
+		s.Limited++
+		wait := time.Duration((1 - s.tokens) / limit.Rate * float64(time.Second))
+		return id.Name, false, wait
+	}
+	s.tokens--
+	return id.Name, true, 0
+}
+
+// Active returns the clients seen at or after since, busiest first.
+func (reg *Registry) Active(since time.Time) []Client {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	var out []Client
+	for _, s := range reg.clients {
+		if s.LastSeen.Before(since) {
+			continue
+		}
+		c := s.Client
+		c.Versions = nil
+		for v := range s.versions {
+			c.Versions = append(c.Versions, v)
+		}
+		sort.Strings(c.Versions)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// savedClient is a client as State saves it: what is tracked about it
+// and its bucket.
+type savedClient struct {
+	Client
+	Tokens float64   `json:"tokens"`
+	Filled time.Time `json:"filled"`
+}
+
+// State returns the tracked clients and their buckets as JSON, so they
+// can be restored after a restart. It implements limitstate.Stateful.
+func (reg *Registry) State() (json.RawMessage, error) {
+	reg.mu.Lock()
+	saved := make([]savedClient, 0, len(reg.clients))
+	for _, s := range reg.clients {
+		c := s.Client
+		c.Versions = nil
+		for v := range s.versions {
+			c.Versions = append(c.Versions, v)
+		}
+		sort.Strings(c.Versions)
+		saved = append(saved, savedClient{Client: c, Tokens: s.tokens, Filled: s.filled})
+	}
+	reg.mu.Unlock()
+	return json.Marshal(saved)
+}
+
+// Restore tracks the clients saved by State, leaving those already
+// tracked, which are newer. Restored buckets refill for the time since
+// they were saved.
+func (reg *Registry) Restore(data json.RawMessage) error {
+	var saved []savedClient
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, c := range saved {
+		if _, ok := reg.clients[c.Name]; ok || len(reg.clients) >= MaxTracked {
+			continue
+		}
+		s := &state{Client: c.Client, versions: make(map[string]bool), tokens: c.Tokens, filled: c.Filled}
+		for _, v := range c.Versions {
+			s.versions[v] = true
+		}
+		s.Versions = nil
+		reg.clients[c.Name] = s
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the client stored in ctx by Middleware, or Anonymous
+// if there is none.
+func FromContext(ctx context.Context) Identity {
+	if id, ok := ctx.Value(contextKey{}).(Identity); ok {
+		return id
+	}
+	return Identity{Name: Anonymous}
+}
+
+// Middleware identifies the client of every request, rejecting requests
+// that fail to identify themselves (400, or 401 for an unknown API key)
+// and requests over the client's rate limit (429 with Retry-After). The
+// identity, named as tracked, is stored in the request context.
+func (reg *Registry) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := reg.Identify(r)
+		switch {
+		case errors.Is(err, ErrUnknownKey):
+			respond.Error(w, http.StatusUnauthorized, "unknown API key")
+			return
+		case errors.Is(err, ErrMissing):
+			respond.Error(w, http.StatusBadRequest, "send "+NameHeader+" or "+APIKeyHeader)
+			return
+		case err != nil:
+			respond.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		name, ok, retryAfter := reg.Allow(id)
+		requestsByClient.WithLabelValues(name).Inc()
+		if !ok {
+			rateLimitedByClient.WithLabelValues(name).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			respond.Error(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		id.Name = name
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
@@ -0,0 +1,159 @@
+package clients
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestIdentify checks header and API key identification.
+func TestIdentify(t *testing.T) {
+	reg := NewRegistry(Config{APIKeys: map[string]string{HashAPIKey("secret"): "billing"}})
+	tests := []struct {
+		header  map[string]string
+		want    Identity
+		wantErr bool
+	}{
+		{nil, Identity{Name: Anonymous}, false},
+		{map[string]string{NameHeader: "mobile-app", VersionHeader: "2.1.0"}, Identity{"mobile-app", "2.1.0"}, false},
+		{map[string]string{NameHeader: "spoofed", APIKeyHeader: "secret"}, Identity{Name: "billing"}, false},
+		{map[string]string{APIKeyHeader: "wrong"}, Identity{}, true},
+		{map[string]string{NameHeader: "bad name"}, Identity{}, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		got, err := reg.Identify(r)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Identify(%v) = %v, %v, want %v (error %v)", tt.header, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if got := HashAPIKey("secret"); got != "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b" {
+		t.Errorf("HashAPIKey(secret) = %s, want its SHA-256", got)
+	}
+
+	reg = NewRegistry(Config{Require: true})
+	if _, err := reg.Identify(httptest.NewRequest("GET", "/", nil)); err != ErrMissing {
+		t.Errorf("Identify() with Require = %v, want ErrMissing", err)
+	}
+}
+
+// TestAllow checks the token bucket, per-client overrides, and tracking.
+func TestAllow(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	reg := NewRegistry(Config{
+		Limit:  Limit{Rate: 1, Burst: 2},
+		Limits: map[string]Limit{"batch": {}},
+	})
+	reg.now = func() time.Time { return now }
+
+	noisy := Identity{Name: "noisy", Version: "1.0"}
+	for i, want := range []bool{true, true, false} {
+		if _, ok, _ := reg.Allow(noisy); ok != want {
+			t.Errorf("Allow(noisy) #%d = %v, want %v", i, ok, want)
+		}
+	}
+	now = now.Add(time.Second)
+	if _, ok, _ := reg.Allow(noisy); !ok {
+		t.Error("Allow(noisy) after refill = false, want true")
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok, _ := reg.Allow(Identity{Name: "batch"}); !ok {
+			t.Fatal("Allow(batch) = false, want unlimited")
+		}
+	}
+
+	active := reg.Active(now.Add(-time.Minute))
+	if len(active) != 2 || active[0].Name != "batch" || active[1].Requests != 4 || active[1].Limited != 1 || active[1].Versions[0] != "1.0" {
+		t.Errorf("Active() = %+v, want batch then noisy with 4 requests, 1 limited", active)
+	}
+}
+
+// TestState checks that clients and their buckets survive a State and
+// Restore into a new registry.
+func TestState(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	reg := NewRegistry(Config{Limit: Limit{Rate: 1, Burst: 2}})
+	reg.now = func() time.Time { return now }
+	noisy := Identity{Name: "noisy", Version: "1.0"}
+	reg.Allow(noisy)
+	reg.Allow(noisy)
+	state, err := reg.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewRegistry(Config{Limit: Limit{Rate: 1, Burst: 2}})
+	restored.now = reg.now
+	if err := restored.Restore(state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := restored.Allow(noisy); ok {
+		t.Error("Allow(noisy) after Restore = true, want its empty bucket restored")
+	}
+	active := restored.Active(now.Add(-time.Minute))
+	if len(active) != 1 || active[0].Requests != 3 || active[0].Versions[0] != "1.0" {
+		t.Errorf("Active() after Restore = %+v, want noisy with 3 requests", active)
+	}
+}
+
+// TestReconfigure checks that new limits apply to clients already being
+// tracked.
+func TestReconfigure(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	reg := NewRegistry(Config{})
+	reg.now = func() time.Time { return now }
+	id := Identity{Name: "noisy"}
+	for i := 0; i < 5; i++ {
+		if _, ok, _ := reg.Allow(id); !ok {
+			t.Fatal("Allow(noisy) = false, want unlimited")
+		}
+	}
+
+	reg.Reconfigure(Config{Limit: Limit{Rate: 1, Burst: 1}, APIKeys: map[string]string{HashAPIKey("k"): "keyed"}})
+	if _, ok, _ := reg.Allow(id); !ok {
+		t.Error("Allow(noisy) after reconfigure = false, want the first request allowed")
+	}
+	if _, ok, _ := reg.Allow(id); ok {
+		t.Error("Allow(noisy) again = true, want the new limit applied")
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(APIKeyHeader, "k")
+	if got, err := reg.Identify(r); err != nil || got.Name != "keyed" {
+		t.Errorf("Identify() = %v, %v, want the new API key's client", got, err)
+	}
+}
+
+// TestMiddleware checks the statuses of rejected requests.
+func TestMiddleware(t *testing.T) {
+	reg := NewRegistry(Config{APIKeys: map[string]string{HashAPIKey("k"): "svc"}, Limit: Limit{Rate: 1}})
+	h := reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()).Name != "svc" {
+			t.Errorf("FromContext() = %v, want svc", FromContext(r.Context()))
+		}
+	}))
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"k", http.StatusOK},
+		{"k", http.StatusTooManyRequests},
+		{"nope", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(APIKeyHeader, tt.key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.want {
+			t.Errorf("key %q = %d, want %d", tt.key, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After = %q, want 1", rec.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+)
+
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys for machine clients",
+}
+
+var apikeyNewCmd = &cobra.Command{
+	Use:   "new CLIENT",
+	Short: "Generate an API key and the digest to configure it by",
+	Long: "Print a new random API key for CLIENT, to hand to the client, and " +
+		"the auth.api_keys entry that accepts it. Only the digest is " +
+		"configured, so the key can't be recovered from the config.",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := auth.NewAPIKey()
+		if err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "key: %s\n\n", key)
+		fmt.Fprintf(out, "auth:\n  api_keys:\n    %s:\n      digest: %s\n", args[0], clients.HashAPIKey(key))
+		return nil
+	},
+}
+
+func init() {
+	apikeyCmd.AddCommand(apikeyNewCmd)
+	rootCmd.AddCommand(apikeyCmd)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/spf13/viper"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+)
+
+// TestAdminOnly checks that admin routes outside /admin, such as those
+// editing the greeting catalog or notification templates, managing
+// webhooks or following the change feed, turn away anonymous callers with
+// 401 and non-admins with 403, and let admins through.
+func TestAdminOnly(t *testing.T) {
+	viper.Set("auth.authorize", true)
+	t.Cleanup(func() { viper.Set("auth.authorize", false) })
+	mem := app.NewMemory(nil)
+	h := app.NewRouter(mem.Deps, nil)
+	user, _ := mem.Auth.Issue(jwt.MapClaims{"sub": "gladys"}, time.Hour)
+	admin, _ := mem.Auth.Issue(jwt.MapClaims{"sub": "ops", "roles": []string{"admin"}}, time.Hour)
+
+	for _, tt := range []struct {
+		method, target, body string
+		status               int
+	}{
+		{"PUT", "/greeting-translations/fr", `{"formats":["Bonjour, %v !"]}`, http.StatusCreated},
+		{"DELETE", "/greeting-translations/fr", "", http.StatusNoContent},
+		{"POST", "/webhooks", `{"url":"https://example.com/hook","events":["*"],"secret":"0123456789abcdef"}`, http.StatusCreated},
+		{"GET", "/webhooks", "", http.StatusOK},
+		{"POST", "/webhooks/missing/test", "", http.StatusNotFound},
+		{"GET", "/changes?follow=false", "", http.StatusOK},
+		{"POST", "/notification-templates", `{"event":"greeting.created","channel":"slack","body":"Hi {{.data.name}}"}`, http.StatusCreated},
+		{"POST", "/notification-templates/greeting.created.slack/preview", `{"name":"Gladys"}`, http.StatusOK},
+		{"PUT", "/notification-templates/greeting.created.slack", `{"event":"greeting.created","channel":"slack","body":"Hello {{.data.name}}"}`, http.StatusPreconditionRequired},
+		{"DELETE", "/notification-templates/greeting.created.slack", "", http.StatusNoContent},
+	} {
+		for token, want := range map[string]int{"": http.StatusUnauthorized, user: http.StatusForbidden, admin: tt.status} {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != want {
+				t.Errorf("%s %s with token %.10q = %d %s, want %d", tt.method, tt.target, token, rec.Code, rec.Body, want)
+			}
+		}
+	}
+}
+
+// TestNotificationPreferencesOwner checks that a user's notification
+// preferences are only read and written by the user or an admin.
+func TestNotificationPreferencesOwner(t *testing.T) {
+	mem := app.NewMemory(nil)
+	h := app.NewRouter(mem.Deps, nil)
+	gladys, _ := mem.Auth.Issue(jwt.MapClaims{"sub": "gladys"}, time.Hour)
+	mallory, _ := mem.Auth.Issue(jwt.MapClaims{"sub": "mallory"}, time.Hour)
+	admin, _ := mem.Auth.Issue(jwt.MapClaims{"sub": "ops", "roles": []string{"admin"}}, time.Hour)
+
+	for _, tt := range []struct {
+		method, token, body string
+		status              int
+	}{
+		{"PUT", "", `{"email":"gladys@example.com"}`, http.StatusUnauthorized},
+		{"PUT", mallory, `{"email":"mallory@example.com"}`, http.StatusForbidden},
+		{"PUT", gladys, `{"email":"gladys@example.com"}`, http.StatusCreated},
+		{"GET", "", "", http.StatusUnauthorized},
+		{"GET", mallory, "", http.StatusForbidden},
+		{"GET", gladys, "", http.StatusOK},
+		{"GET", admin, "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(tt.method, "/users/gladys/notification-preferences", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s /users/gladys/notification-preferences with token %.10q = %d %s, want %d", tt.method, tt.token, rec.Code, rec.Body, tt.status)
+		}
+	}
+}
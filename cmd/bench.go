@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/datagen"
+	"github.com/Shulammite-Aso/bazel-demo-app/handlers"
+	"github.com/spf13/cobra"
+)
+
+// benchCase is one handler to benchmark with a single request.
+type benchCase struct {
+	name    string
+	handler http.Handler
+	target  string
+}
+
+// noopHandler is the innermost handler when measuring middleware alone.
+var noopHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+// middlewareBenchCases returns a case per middleware layer, one for the
+// whole chain around a no-op handler, one for a real route through the
+// router, and one listing a page of a seeded store.
+func middlewareBenchCases() []benchCase {
+	const target = "/greet?name=Gladys"
+	layers := app.Middleware()
+
+	var cases []benchCase
+	for _, m := range layers {
+		cases = append(cases, benchCase{m.Name, m.Middleware(noopHandler), target})
+	}
+	cases = append(cases,
+		benchCase{"chain", app.Chain(noopHandler, layers), target},
+		benchCase{"router", app.NewRouter(app.NewMemory(nil).Deps, nil), target},
+		benchCase{"list", seededRouter(), "/greetings?per_page=50"},
+	)
+	return cases
+}
+
+// benchSeed and benchGreetings fix the dataset the list case pages
+// through, so results compare across runs.
+const (
+	benchSeed      = 1
+	benchGreetings = 500
+)
+
+// seededRouter returns the router on in-memory backends holding the
+// greetings generated from benchSeed.
+func seededRouter() http.Handler {
+	mem := app.NewMemory(nil)
+	for i, g := range datagen.New(benchSeed).Greetings(benchGreetings) {
+		data, _ := json.Marshal(g)
+		if _, err := mem.Backing.Create(context.Background(), handlers.GreetingsCollection, fmt.Sprintf("greeting-%03d", i), data); err != nil {
+			panic(err)
+		}
+	}
+	return app.NewRouter(mem.Deps, nil)
+}
+
+// runBenchCase serves the case's request b.N times.
+func runBenchCase(b *testing.B, c benchCase) {
+	req := httptest.NewRequest(http.MethodGet, c.target, nil)
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Run built-in benchmarks",
+}
+
+var benchMiddlewareCmd = &cobra.Command{
+	Use:   "middleware",
+	Short: "Benchmark each middleware layer and the full chain",
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "layer\tns/op\tallocs/op\tB/op\t")
+		for _, c := range middlewareBenchCases() {
+			c := c
+			r := testing.Benchmark(func(b *testing.B) { runBenchCase(b, c) })
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", c.name, r.NsPerOp(), r.AllocsPerOp(), r.AllocedBytesPerOp())
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	benchCmd.AddCommand(benchMiddlewareCmd)
+	rootCmd.AddCommand(benchCmd)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+// BenchmarkMiddleware measures every middleware layer on its own, the
+// full chain, and a complete request through the router. Run it with
+//
+//	bazel run //cmd:cmd_test -- -test.bench=Middleware
+func BenchmarkMiddleware(b *testing.B) {
+	for _, c := range middlewareBenchCases() {
+		c := c
+		b.Run(c.name, func(b *testing.B) { runBenchCase(b, c) })
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/config"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect configuration files",
+}
+
+var configLintCmd = &cobra.Command{
+	Use:   "lint FILE",
+	Short: "Report deprecated keys in a config file",
+	Args:  cobra.ExactArgs(1),
+	// A lint failure is not a usage error.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		v := viper.New()
+		v.SetConfigFile(args[0])
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("reading %s: %w", args[0], err)
+		}
+
+		used := config.Lint(v, config.Deprecations)
+		for _, d := range used {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", args[0], d)
+		}
+		if len(used) > 0 {
+			return fmt.Errorf("%d deprecated key(s) found", len(used))
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: no deprecated keys\n", args[0])
+		return nil
+	},
+}
+
+// loadConfig reads the --config file, if one was given, maps deprecated
+// keys onto their replacements, and validates the result into Config.
+func loadConfig() error {
+	if path, _ := rootCmd.PersistentFlags().GetString("config"); path != "" {
+		if err := config.Load(viper.GetViper(), path); err != nil {
+			return err
+		}
+	}
+	warnDeprecatedConfig()
+	return config.Decode(viper.GetViper(), &Config{})
+}
+
+// applyLogLevel sets the log level from debug.
+func applyLogLevel() {
+	if viper.GetBool("debug") {
+		logrus.SetLevel(logrus.DebugLevel)
+	} else {
+		logrus.SetLevel(logrus.InfoLevel)
+	}
+}
+
+// registerReloadHooks lets config file changes to the log level, to
+// client identification and rate limits, and to auth keys apply without a
+// restart, so keys can be rotated in place. Other keys, feature toggles
+// such as compress.enabled and profiling.enabled among them, shape the
+// router or listeners at startup, so the reloader warns that they need
+// one.
+func registerReloadHooks(r *config.Reloader, registry *clients.Registry, verifier *auth.Verifier) {
+	r.Handle("logging", func(*viper.Viper) error {
+		applyLogLevel()
+		return nil
+	}, "debug")
+	r.Handle("clients", func(*viper.Viper) error {
+		c, err := clientsConfig()
+		if err != nil {
+			return err
+		}
+		registry.Reconfigure(c)
+		return nil
+	}, "clients", "auth.api_keys", "auth.api_keys_file")
+	r.Handle("auth", func(*viper.Viper) error {
+		c, err := authConfig()
+		if err != nil {
+			return err
+		}
+		return verifier.Reconfigure(c)
+	}, "auth")
+}
+
+// warnDeprecatedConfig maps deprecated keys onto their replacements and
+// logs a warning for each one still in use.
+func warnDeprecatedConfig() {
+	for _, d := range config.ApplyDeprecations(viper.GetViper(), config.Deprecations) {
+		logrus.WithFields(logrus.Fields{
+			"key":         d.Old,
+			"replacement": d.New,
+			"removed_in":  d.RemovedIn,
+		}).Warn("deprecated config key in use")
+	}
+}
+
+func init() {
+	configCmd.AddCommand(configLintCmd)
+	rootCmd.AddCommand(configCmd)
+}
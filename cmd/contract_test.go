@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/routes"
+)
+
+// TestContract replays the examples in the OpenAPI document against the
+// full router and checks each response against the status and schema the
+// document declares, so the spec and the handlers can't drift apart
+// unnoticed. Add an example next to a route's Returns to cover it.
+func TestContract(t *testing.T) {
+	problems, err := routes.Contract(app.NewRouter(app.NewMemory(nil).Deps, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		t.Error(p)
+	}
+}
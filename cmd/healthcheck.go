@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/health"
+)
+
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check that a running server is ready, printing each check",
+	Long: "Fetch the /readyz report of a running server and print the " +
+		"status and latency of every registered health check. Exits " +
+		"non-zero unless the server is ready, so it can be a container " +
+		"HEALTHCHECK.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		setConfigDefaults()
+		server, _ := cmd.Flags().GetString("server")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		format, _ := cmd.Flags().GetString("format")
+		if format != "table" && format != "json" {
+			return fmt.Errorf("--format must be table or json, not %q", format)
+		}
+		if server == "" {
+			server = fmt.Sprintf("http://localhost:%d", viper.GetInt("port"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		rd, err := health.Fetch(ctx, &http.Client{}, server)
+		if err != nil {
+			return err
+		}
+		if err := printReadiness(cmd.OutOrStdout(), rd, format); err != nil {
+			return err
+		}
+		switch {
+		case !rd.Started:
+			return errors.New("not ready: the server hasn't started or is shutting down")
+		case !rd.Ready:
+			return errors.New("not ready: checks failed")
+		}
+		return nil
+	},
+}
+
+// printReadiness writes rd's checks as an aligned table or rd as JSON.
+func printReadiness(out io.Writer, rd health.Readiness, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rd)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "check\tstatus\tlatency\terror")
+	for _, c := range rd.Checks {
+		name := c.Name
+		if c.Dependency {
+			name += " (dependency)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, c.Status, c.Latency.Round(time.Microsecond), c.Error)
+	}
+	return w.Flush()
+}
+
+func init() {
+	healthcheckCmd.Flags().String("server", "", "base URL of the running server (default this configuration's server on localhost)")
+	healthcheckCmd.Flags().Duration("timeout", 10*time.Second, "how long to wait for the report")
+	healthcheckCmd.Flags().String("format", "table", "output format: table or json")
+	rootCmd.AddCommand(healthcheckCmd)
+}
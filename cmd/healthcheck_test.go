@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/health"
+)
+
+// TestHealthcheck fetches the readiness report of a server before and
+// after it starts and checks the table printed.
+func TestHealthcheck(t *testing.T) {
+	mem := app.NewMemory(nil)
+	srv := httptest.NewServer(app.NewRouter(mem.Deps, nil))
+	defer srv.Close()
+
+	rd, err := health.Fetch(context.Background(), srv.Client(), srv.URL)
+	if err != nil || rd.Ready || rd.Started {
+		t.Fatalf("Fetch() before starting = %+v, %v, want not started", rd, err)
+	}
+	mem.Status.SetStarted(true)
+	rd, err = health.Fetch(context.Background(), srv.Client(), srv.URL)
+	if err != nil || !rd.Ready {
+		t.Fatalf("Fetch() once started = %+v, %v, want ready", rd, err)
+	}
+
+	var out strings.Builder
+	if err := printReadiness(&out, rd, "table"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < 3 || !strings.HasPrefix(lines[0], "check") || !strings.HasPrefix(lines[1], "storage") || !strings.Contains(lines[1], health.Pass) {
+		t.Errorf("printReadiness =\n%s\nwant a passing storage check first", out.String())
+	}
+}
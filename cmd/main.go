@@ -1,25 +1,84 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/anomaly"
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/approval"
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
 	"github.com/Shulammite-Aso/bazel-demo-app/bazel"
+	"github.com/Shulammite-Aso/bazel-demo-app/bodylimit"
+	"github.com/Shulammite-Aso/bazel-demo-app/buildinfo"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/canary"
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/compress"
+	"github.com/Shulammite-Aso/bazel-demo-app/config"
+	"github.com/Shulammite-Aso/bazel-demo-app/contentfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/fieldcrypt"
+	"github.com/Shulammite-Aso/bazel-demo-app/geoip"
 	"github.com/Shulammite-Aso/bazel-demo-app/handlers"
+	"github.com/Shulammite-Aso/bazel-demo-app/health"
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/ipfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/limits"
+	"github.com/Shulammite-Aso/bazel-demo-app/limitstate"
+	"github.com/Shulammite-Aso/bazel-demo-app/metering"
+	"github.com/Shulammite-Aso/bazel-demo-app/middleware"
+	"github.com/Shulammite-Aso/bazel-demo-app/mirror"
+	"github.com/Shulammite-Aso/bazel-demo-app/notify"
+	"github.com/Shulammite-Aso/bazel-demo-app/objectstore"
+	"github.com/Shulammite-Aso/bazel-demo-app/operations"
+	"github.com/Shulammite-Aso/bazel-demo-app/paginate"
+	"github.com/Shulammite-Aso/bazel-demo-app/pidfile"
+	"github.com/Shulammite-Aso/bazel-demo-app/pii"
+	"github.com/Shulammite-Aso/bazel-demo-app/pipeline"
+	"github.com/Shulammite-Aso/bazel-demo-app/plans"
+	"github.com/Shulammite-Aso/bazel-demo-app/presence"
+	"github.com/Shulammite-Aso/bazel-demo-app/privacy"
+	"github.com/Shulammite-Aso/bazel-demo-app/profiling"
+	"github.com/Shulammite-Aso/bazel-demo-app/querylog"
+	"github.com/Shulammite-Aso/bazel-demo-app/requestid"
+	"github.com/Shulammite-Aso/bazel-demo-app/retention"
+	"github.com/Shulammite-Aso/bazel-demo-app/routes"
+	"github.com/Shulammite-Aso/bazel-demo-app/schedule"
+	"github.com/Shulammite-Aso/bazel-demo-app/securityheaders"
+	"github.com/Shulammite-Aso/bazel-demo-app/server"
+	"github.com/Shulammite-Aso/bazel-demo-app/sla"
+	"github.com/Shulammite-Aso/bazel-demo-app/status"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/systemd"
+	"github.com/Shulammite-Aso/bazel-demo-app/timeout"
+	"github.com/Shulammite-Aso/bazel-demo-app/transform"
+	"github.com/Shulammite-Aso/bazel-demo-app/tts"
+	"github.com/Shulammite-Aso/bazel-demo-app/upstream"
+	"github.com/Shulammite-Aso/bazel-demo-app/useragent"
+	"github.com/Shulammite-Aso/bazel-demo-app/watchdog"
+	"github.com/Shulammite-Aso/bazel-demo-app/webhooks"
+	"github.com/Shulammite-Aso/bazel-demo-app/wellknown"
 	"github.com/antchfx/xmlquery"
 	"github.com/bgentry/go-netrc/netrc"
 	"github.com/bwmarrin/snowflake"
 	jwt "github.com/dgrijalva/jwt-go"
-	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
-	cache "github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -29,11 +88,12 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Config struct for demonstration with validator tags
+// Config holds the settings validated before the server starts, whether
+// they come from defaults, flags or the --config file.
 type Config struct {
-	AppName string `yaml:"app_name" validate:"required"`
-	Port    int    `yaml:"port" validate:"required,min=1000,max=65535"`
-	Debug   bool   `yaml:"debug"`
+	AppName string `yaml:"app_name" mapstructure:"app_name" validate:"required"`
+	Port    int    `yaml:"port" mapstructure:"port" validate:"required,min=1000,max=65535"`
+	Debug   bool   `yaml:"debug" mapstructure:"debug"`
 }
 
 // Simple protobuf message demonstration
@@ -46,88 +106,976 @@ func doNotInvoke() (string, error) {
 	return bazel.Runfile("/tmp/does/not/exist")
 }
 
-// demonstrateNewDependencies shows usage of all new dependencies
-func demonstrateNewDependencies() {
-	// 1. godotenv - Load environment variables
-	_ = godotenv.Load() // Load from .env file if it exists
-	color.Green("✓ godotenv: Environment loaded")
-
-	// 2. viper - Configuration management
+// setConfigDefaults registers the default value of every config key and
+// binds each key to its environment variable.
+func setConfigDefaults() {
 	viper.SetDefault("app_name", "bazel-demo-app")
+	viper.SetDefault("host", "")
+	viper.SetDefault("accesslog.enabled", true)
+	viper.SetDefault("analytics.flush_interval", time.Minute)
+	viper.SetDefault("auth.key_id", "default")
+	viper.SetDefault("auth.secret", auth.DevSecret)
+	viper.SetDefault("auth.private_key", "")
+	viper.SetDefault("auth.private_key_file", "")
+	viper.SetDefault("auth.public_key", "")
+	viper.SetDefault("auth.public_key_file", "")
+	viper.SetDefault("auth.keys", map[string]interface{}{})
+	viper.SetDefault("auth.retired_grace", 24*time.Hour)
+	viper.SetDefault("auth.authorize", true)
+	viper.SetDefault("auth.api_keys", map[string]interface{}{})
+	viper.SetDefault("auth.api_keys_file", "")
+	viper.SetDefault("auth.impersonation.enabled", true)
+	viper.SetDefault("auth.impersonation.max_ttl", handlers.DefaultMaxImpersonationTTL)
+	viper.SetDefault("auth.impersonation.denied_scopes", []string{"admin", pii.Scope})
 	viper.SetDefault("port", 5000)
 	viper.SetDefault("debug", true)
-	color.Green("✓ viper: Configuration set with defaults")
+	viper.SetDefault("profile", "dev")
+	viper.SetDefault("cache.backend", "memory")
+	viper.SetDefault("cache.default_ttl", 5*time.Minute)
+	viper.SetDefault("cache.max_entries", 10000)
+	viper.SetDefault("cache.max_bytes", 64<<20)
+	viper.SetDefault("canary", map[string]interface{}{})
+	viper.SetDefault("changes.retention", 24*time.Hour)
+	viper.SetDefault("changes.trim_interval", 10*time.Minute)
+	viper.SetDefault("clients.require", false)
+	viper.SetDefault("clients.api_keys", map[string]string{})
+	viper.SetDefault("clients.rate_limit", 0)
+	viper.SetDefault("clients.burst", 0)
+	viper.SetDefault("encryption.primary_key", "")
+	viper.SetDefault("encryption.keys", map[string]interface{}{})
+	viper.SetDefault("encryption.rotate_interval", time.Hour)
+	viper.SetDefault("geoip.country_db", "")
+	viper.SetDefault("geoip.asn_db", "")
+	viper.SetDefault("geoip.refresh_interval", time.Minute)
+	viper.SetDefault("i18n.reload_interval", time.Minute)
+	viper.SetDefault("limits.apply", true)
+	viper.SetDefault("limits.memory_fraction", limits.DefaultMemoryFraction)
+	viper.SetDefault("login.enabled", true)
+	viper.SetDefault("login.ttl", time.Hour)
+	viper.SetDefault("login.refresh_ttl", auth.DefaultRefreshTTL)
+	viper.SetDefault("login.claims", map[string]interface{}{})
+	viper.SetDefault("login.users", map[string]interface{}{})
+	viper.SetDefault("mirror.url", "")
+	viper.SetDefault("mirror.percent", 0)
+	viper.SetDefault("mirror.methods", mirror.DefaultConfig.Methods)
+	viper.SetDefault("mirror.timeout", mirror.DefaultConfig.Timeout)
+	viper.SetDefault("mirror.max_body", mirror.DefaultConfig.MaxBody)
+	viper.SetDefault("mirror.max_in_flight", mirror.DefaultConfig.MaxInFlight)
+	viper.SetDefault("pagination.cursor_secret", "")
+	viper.SetDefault("pidfile.path", "")
+	viper.SetDefault("pprof.enabled", false)
+	viper.SetDefault("pprof.address", "localhost:6060")
+	viper.SetDefault("presence.ttl", presence.DefaultTTL)
+	viper.SetDefault("pii.hash_key", "")
+	viper.SetDefault("privacy.enabled", true)
+	viper.SetDefault("privacy.sources", map[string]interface{}{})
+	viper.SetDefault("profiling.enabled", false)
+	viper.SetDefault("profiling.max_duration", 2*time.Minute)
+	viper.SetDefault("ratelimit.enabled", false)
+	viper.SetDefault("ratelimit.rps", 10)
+	viper.SetDefault("ratelimit.burst", 20)
+	viper.SetDefault("ratelimit.routes", []string{})
+	viper.SetDefault("requestid.generator", requestid.KindUUID)
+	viper.SetDefault("requestid.node", 1)
+	viper.SetDefault("response_hooks", map[string]interface{}{})
+	viper.SetDefault("greeting_pipeline", pipeline.DefaultSpecs)
+	viper.SetDefault("retention.policies", map[string]interface{}{})
+	viper.SetDefault("retention.schedule", "0 3 * * *")
+	viper.SetDefault("retention.time_zone", "UTC")
+	viper.SetDefault("retention.dry_run", false)
+	viper.SetDefault("retention.batch_size", retention.DefaultBatchSize)
+	viper.SetDefault("approval.enabled", true)
+	viper.SetDefault("metering.enabled", false)
+	viper.SetDefault("metering.period", metering.DefaultPeriod)
+	viper.SetDefault("metering.flush_interval", time.Minute)
+	viper.SetDefault("metering.collections", []string{handlers.GreetingsCollection})
+	viper.SetDefault("anomaly.enabled", false)
+	viper.SetDefault("anomaly.interval", anomaly.DefaultConfig.Interval)
+	viper.SetDefault("anomaly.alpha", anomaly.DefaultConfig.Alpha)
+	viper.SetDefault("anomaly.threshold", anomaly.DefaultConfig.Threshold)
+	viper.SetDefault("anomaly.warmup", anomaly.DefaultConfig.Warmup)
+	viper.SetDefault("anomaly.min_requests", anomaly.DefaultConfig.MinRequests)
+	viper.SetDefault("anomaly.notify_users", []string{})
+	viper.SetDefault("limitstate.enabled", true)
+	viper.SetDefault("limitstate.interval", limitstate.DefaultInterval)
+	viper.SetDefault("readiness.upstream_url", "")
+	viper.SetDefault("sla.enabled", true)
+	viper.SetDefault("sla.flush_interval", time.Minute)
+	viper.SetDefault("ipfilter.enabled", false)
+	viper.SetDefault("ipfilter.routes", []string{"/admin/*"})
+	viper.SetDefault("ipfilter.allow", []string{})
+	viper.SetDefault("ipfilter.deny", []string{})
+	viper.SetDefault("contentfilter.enabled", false)
+	viper.SetDefault("contentfilter.words", []string{})
+	viper.SetDefault("contentfilter.wordlists", []string{})
+	viper.SetDefault("contentfilter.moderation.url", "")
+	viper.SetDefault("contentfilter.moderation.token", "")
+	viper.SetDefault("contentfilter.moderation.timeout", 2*time.Second)
+	viper.SetDefault("contentfilter.moderation.cache_size", 10000)
+	viper.SetDefault("contentfilter.moderation.cache_ttl", contentfilter.DefaultCacheTTL)
+	viper.SetDefault("contentfilter.moderation.fail_closed", false)
+	viper.SetDefault("qr.enabled", true)
+	viper.SetDefault("qr.cache.max_entries", 1000)
+	viper.SetDefault("qr.cache.max_bytes", 32<<20)
+	viper.SetDefault("qr.cache.ttl", time.Hour)
+	viper.SetDefault("qr.ratelimit.rps", 5)
+	viper.SetDefault("qr.ratelimit.burst", 20)
+	viper.SetDefault("tts.enabled", false)
+	viper.SetDefault("tts.provider.url", "")
+	viper.SetDefault("tts.provider.token", "")
+	viper.SetDefault("tts.provider.timeout", 10*time.Second)
+	viper.SetDefault("tts.store.dir", "")
+	viper.SetDefault("tts.store.max_objects", 1000)
+	viper.SetDefault("tts.store.max_bytes", 64<<20)
+	viper.SetDefault("timeout.enabled", true)
+	viper.SetDefault("timeout.default", timeout.DefaultTimeout)
+	viper.SetDefault("timeout.routes", map[string]interface{}{})
+	viper.SetDefault("plans.enabled", false)
+	viper.SetDefault("plans.default", plans.Free)
+	viper.SetDefault("plans.definitions", map[string]interface{}{})
+	viper.SetDefault("plans.cache_ttl", plans.DefaultCacheTTL)
+	viper.SetDefault("approval.ttl", approval.DefaultTTL)
+	viper.SetDefault("server.read_timeout", 30*time.Second)
+	viper.SetDefault("server.write_timeout", 0)
+	viper.SetDefault("server.max_connections_per_ip", 0)
+	viper.SetDefault("server.max_body_bytes", bodylimit.DefaultMaxBytes)
+	viper.SetDefault("tls.cert_file", "")
+	viper.SetDefault("tls.key_file", "")
+	viper.SetDefault("selfupdate.url", "")
+	viper.SetDefault("selfupdate.public_key", "")
+	viper.SetDefault("selfupdate.timeout", 10*time.Minute)
+	viper.SetDefault("shutdown.timeout", 15*time.Second)
+	viper.SetDefault("useragent.health_checkers", useragent.DefaultHealthCheckers)
+	viper.SetDefault("watchdog.interval", watchdog.DefaultConfig.Interval)
+	viper.SetDefault("watchdog.goroutine_threshold", watchdog.DefaultConfig.Threshold)
+	viper.SetDefault("watchdog.samples", watchdog.DefaultConfig.Samples)
+	viper.SetDefault("security_headers.enabled", true)
+	viper.SetDefault("security_headers.content_security_policy", securityheaders.DefaultContentSecurityPolicy)
+	viper.SetDefault("security_headers.frame_options", securityheaders.DefaultFrameOptions)
+	viper.SetDefault("security_headers.referrer_policy", securityheaders.DefaultReferrerPolicy)
+	viper.SetDefault("compress.enabled", true)
+	viper.SetDefault("compress.min_size", compress.MinSize)
+	viper.SetDefault("compress.types", []string{})
+	viper.SetDefault("static.dir", "")
+	viper.SetDefault("static.prefix", "/static/")
+	viper.SetDefault("storage.transactions", false)
+	viper.SetDefault("tenancy.enabled", false)
+	viper.SetDefault("tenancy.collections", []string{handlers.GreetingsCollection})
+	viper.SetDefault("storage.slow_query_threshold", querylog.DefaultSlowThreshold)
+	viper.SetDefault("storage.recent_queries", querylog.DefaultRecent)
+	viper.SetDefault("wellknown.robots_file", "")
+	viper.SetDefault("wellknown.favicon_file", "")
+	viper.SetDefault("wellknown.security_txt_file", "")
+	viper.SetDefault("wellknown.security_contact", "")
+	viper.SetDefault("wellknown.change_password_url", "")
+	// Every key above can also be set through BAZELDEMO_<KEY>.
+	config.BindEnv(viper.GetViper())
+}
+
+// newCache returns the cache selected by the cache.* config keys.
+func newCache() (cache.Cache, error) {
+	return cache.New(cache.Config{
+		Backend:    viper.GetString("cache.backend"),
+		DefaultTTL: viper.GetDuration("cache.default_ttl"),
+		MaxEntries: viper.GetInt("cache.max_entries"),
+		MaxBytes:   viper.GetInt("cache.max_bytes"),
+	})
+}
+
+// openGeoIP opens the configured geo-IP databases and keeps them fresh.
+// It returns nil if none are configured.
+func openGeoIP(ctx context.Context) (*geoip.DB, error) {
+	var paths []string
+	for _, key := range []string{"geoip.country_db", "geoip.asn_db"} {
+		if p := viper.GetString(key); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	db, err := geoip.Open(paths...)
+	if err != nil {
+		return nil, err
+	}
+	go db.Watch(ctx, viper.GetDuration("geoip.refresh_interval"))
+	return db, nil
+}
+
+// clientsConfig reads client identification and rate limits from the
+// clients.* keys. Per-client limits go under clients.limits.<name> with
+// rate and burst keys. API keys are those of apiKeysConfig, which may set
+// their client's limit too, and the plaintext keys of the deprecated
+// clients.api_keys, which only identify clients.
+func clientsConfig() (clients.Config, error) {
+	c := clients.Config{
+		Require: viper.GetBool("clients.require"),
+		APIKeys: make(map[string]string),
+		Limit: clients.Limit{
+			Rate:  viper.GetFloat64("clients.rate_limit"),
+			Burst: viper.GetInt("clients.burst"),
+		},
+	}
+	if err := viper.UnmarshalKey("clients.limits", &c.Limits); err != nil {
+		return clients.Config{}, fmt.Errorf("clients.limits: %w", err)
+	}
+	if legacy := viper.GetStringMapString("clients.api_keys"); len(legacy) > 0 {
+		logrus.Warn("clients.api_keys holds API keys in plaintext and is deprecated; move them to auth.api_keys as digests")
+		for key, name := range legacy {
+			c.APIKeys[clients.HashAPIKey(key)] = name
+		}
+	}
+	keys, limits, err := apiKeysConfig()
+	if err != nil {
+		return clients.Config{}, err
+	}
+	for digest, k := range keys {
+		c.APIKeys[digest] = k.Client
+	}
+	for name, l := range limits {
+		if c.Limits == nil {
+			c.Limits = make(map[string]clients.Limit)
+		}
+		c.Limits[name] = l
+	}
+	return c, nil
+}
+
+// apiKeysConfig reads the API keys clients may authenticate with and the
+// rate limits set on them. auth.api_keys.<client> holds a key's digest,
+// as printed by the apikey command, the claims it grants, such as
+// {roles: [admin]}, and optional rate and burst limits. auth.api_keys_file
+// names a file of further "client digest" lines, which grant no claims.
+func apiKeysConfig() (map[string]auth.APIKey, map[string]clients.Limit, error) {
+	var configured map[string]struct {
+		Digest        string                 `mapstructure:"digest"`
+		Claims        map[string]interface{} `mapstructure:"claims"`
+		clients.Limit `mapstructure:",squash"`
+	}
+	if err := viper.UnmarshalKey("auth.api_keys", &configured); err != nil {
+		return nil, nil, fmt.Errorf("auth.api_keys: %w", err)
+	}
+	keys := make(map[string]auth.APIKey)
+	if file := viper.GetString("auth.api_keys_file"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("auth.api_keys_file: %w", err)
+		}
+		if keys, err = auth.ParseAPIKeys(data); err != nil {
+			return nil, nil, fmt.Errorf("auth.api_keys_file: %s: %w", file, err)
+		}
+	}
+	limits := make(map[string]clients.Limit)
+	for name, k := range configured {
+		if k.Digest == "" {
+			return nil, nil, fmt.Errorf("auth.api_keys.%s: no digest", name)
+		}
+		keys[k.Digest] = auth.APIKey{Client: name, Claims: k.Claims}
+		if k.Rate > 0 {
+			limits[name] = k.Limit
+		}
+	}
+	return keys, limits, nil
+}
+
+// authConfig reads the auth key. The key new tokens are signed with has
+// the ID auth.key_id and is auth.secret, an HS256 secret, unless
+// auth.private_key or auth.private_key_file is set to a PEM-encoded RSA or
+// ECDSA key. Services that only check tokens set auth.public_key or
+// auth.public_key_file instead and sign nothing. auth.keys holds the other
+// accepted keys by ID, each a secret, public_key or public_key_file, such
+// as {public_key_file: old.pem, retired_at: 2026-10-01T00:00:00Z} for a key
+// being rotated out. Tokens signed with a retired key are accepted for
+// auth.retired_grace after it was retired.
+func authConfig() (auth.Config, error) {
+	var others map[string]struct {
+		Secret        string `mapstructure:"secret"`
+		PublicKey     string `mapstructure:"public_key"`
+		PublicKeyFile string `mapstructure:"public_key_file"`
+		// RetiredAt is a string from JSON and the environment, and a
+		// time.Time from YAML and TOML.
+		RetiredAt interface{} `mapstructure:"retired_at"`
+	}
+	if err := viper.UnmarshalKey("auth.keys", &others); err != nil {
+		return auth.Config{}, fmt.Errorf("auth.keys: %w", err)
+	}
+	id := strings.ToLower(viper.GetString("auth.key_id"))
+	signing, err := signingKeyConfig()
+	if err != nil {
+		return auth.Config{}, err
+	}
+	c := auth.Config{
+		SigningKey: id,
+		Keys:       map[string]auth.Key{id: signing},
+		Grace:      viper.GetDuration("auth.retired_grace"),
+	}
+	if c.APIKeys, _, err = apiKeysConfig(); err != nil {
+		return auth.Config{}, err
+	}
+	if signing.Public != nil {
+		c.SigningKey = ""
+	}
+	for kid, k := range others {
+		if kid == id {
+			return auth.Config{}, fmt.Errorf("auth.keys.%s: the key %s is set by auth.secret, auth.private_key or auth.public_key", kid, id)
+		}
+		key := auth.Key{Secret: []byte(k.Secret)}
+		if pemBytes, err := pemSetting(k.PublicKey, k.PublicKeyFile); err != nil {
+			return auth.Config{}, fmt.Errorf("auth.keys.%s.public_key: %w", kid, err)
+		} else if pemBytes != nil {
+			if key.Public, err = auth.ParsePublicKey(pemBytes); err != nil {
+				return auth.Config{}, fmt.Errorf("auth.keys.%s.public_key: %w", kid, err)
+			}
+		}
+		switch at := k.RetiredAt.(type) {
+		case nil:
+		case time.Time:
+			key.RetiredAt = at
+		case string:
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				return auth.Config{}, fmt.Errorf("auth.keys.%s.retired_at: %w", kid, err)
+			}
+			key.RetiredAt = t
+		default:
+			return auth.Config{}, fmt.Errorf("auth.keys.%s.retired_at: want an RFC 3339 time, got %v", kid, at)
+		}
+		c.Keys[kid] = key
+	}
+	return c, c.Check()
+}
+
+// signingKeyConfig reads the key of auth.key_id: a private key, a public
+// key for verify-only services, or else auth.secret.
+func signingKeyConfig() (auth.Key, error) {
+	private, err := pemSetting(viper.GetString("auth.private_key"), viper.GetString("auth.private_key_file"))
+	if err != nil {
+		return auth.Key{}, fmt.Errorf("auth.private_key: %w", err)
+	}
+	public, err := pemSetting(viper.GetString("auth.public_key"), viper.GetString("auth.public_key_file"))
+	if err != nil {
+		return auth.Key{}, fmt.Errorf("auth.public_key: %w", err)
+	}
+	switch {
+	case private != nil && public != nil:
+		return auth.Key{}, errors.New("auth.private_key and auth.public_key are both set; the public key is derived from the private one")
+	case private != nil:
+		k, err := auth.ParsePrivateKey(private)
+		if err != nil {
+			return auth.Key{}, fmt.Errorf("auth.private_key: %w", err)
+		}
+		return auth.Key{Private: k}, nil
+	case public != nil:
+		k, err := auth.ParsePublicKey(public)
+		if err != nil {
+			return auth.Key{}, fmt.Errorf("auth.public_key: %w", err)
+		}
+		return auth.Key{Public: k}, nil
+	}
+	return auth.Key{Secret: []byte(viper.GetString("auth.secret"))}, nil
+}
+
+// pemSetting returns the PEM given inline, or read from file, or nil if
+// neither is set.
+func pemSetting(inline, file string) ([]byte, error) {
+	switch {
+	case inline != "" && file != "":
+		return nil, errors.New("set the key or its _file, not both")
+	case file != "":
+		return os.ReadFile(file)
+	case inline != "":
+		return []byte(inline), nil
+	}
+	return nil, nil
+}
+
+// newLogin returns the POST /login handler configured by the login.* keys,
+// or nil if login.enabled is false. login.users holds the accounts by
+// name, such as {gladys: {password_hash: $2y$10$..., claims: {role:
+// admin}}}, with names in lower case as viper reads map keys; login.claims
+// is added to every token, which is valid for login.ttl. Logins come with a
+// refresh token, kept in sessions, that renews them for login.refresh_ttl
+// after its last use; set it to 0 to turn refresh tokens off.
+func newLogin(verifier *auth.Verifier, sessions cache.Cache) (*handlers.Login, error) {
+	if !viper.GetBool("login.enabled") {
+		return nil, nil
+	}
+	var users auth.StaticCredentials
+	if err := viper.UnmarshalKey("login.users", &users); err != nil {
+		return nil, fmt.Errorf("login.users: %w", err)
+	}
+	if err := users.Check(); err != nil {
+		return nil, fmt.Errorf("login.users: %w", err)
+	}
+	ttl := viper.GetDuration("login.ttl")
+	if ttl <= 0 {
+		return nil, fmt.Errorf("login.ttl must be positive, got %s", ttl)
+	}
+	login := handlers.NewLogin(users, verifier, ttl)
+	login.Claims = viper.GetStringMap("login.claims")
+	if refresh := viper.GetDuration("login.refresh_ttl"); refresh > 0 {
+		login.Sessions = auth.NewSessions(sessions, refresh)
+	}
+	return login, nil
+}
+
+// canaryConfig reads the canary key: variant routing rules keyed by route
+// path, such as canary./greet-many.rules.
+func canaryConfig() (map[string]canary.Config, error) {
+	var routes map[string]canary.Config
+	if err := viper.UnmarshalKey("canary", &routes); err != nil {
+		return nil, fmt.Errorf("canary: %w", err)
+	}
+	return routes, nil
+}
+
+// responseHooks builds the response_hooks key: per route path, a list of
+// hooks such as {type: set_header, header: X-Foo, value: bar}.
+func responseHooks() (transform.Routes, error) {
+	var specs map[string][]transform.Spec
+	if err := viper.UnmarshalKey("response_hooks", &specs); err != nil {
+		return nil, fmt.Errorf("response_hooks: %w", err)
+	}
+	return transform.NewRoutes(specs)
+}
+
+// greetingPipeline builds the greeting_pipeline key: the stages greetings
+// go through, in order, such as {type: profanity} or {type: emoji, emoji:
+// "🎉"}.
+func greetingPipeline(catalog *i18n.Catalog) (*pipeline.Pipeline, error) {
+	var specs []pipeline.Spec
+	if err := viper.UnmarshalKey("greeting_pipeline", &specs); err != nil {
+		return nil, fmt.Errorf("greeting_pipeline: %w", err)
+	}
+	return pipeline.Build(specs, pipeline.Env{Catalog: catalog})
+}
+
+// newMirror returns the shadow traffic mirror configured by the mirror.*
+// keys, or nil if mirror.url isn't set.
+func newMirror() (*mirror.Mirror, error) {
+	if viper.GetString("mirror.url") == "" {
+		return nil, nil
+	}
+	return mirror.New(mirror.Config{
+		URL:         viper.GetString("mirror.url"),
+		Percent:     viper.GetFloat64("mirror.percent"),
+		Methods:     viper.GetStringSlice("mirror.methods"),
+		Timeout:     viper.GetDuration("mirror.timeout"),
+		MaxBody:     viper.GetInt64("mirror.max_body"),
+		MaxInFlight: viper.GetInt("mirror.max_in_flight"),
+	})
+}
+
+// encryptionKeys reads the keyring fields tagged for encryption are sealed
+// with: encryption.keys holds base64-encoded 32-byte keys by version, and
+// encryption.primary_key names the version new values are sealed with.
+// To rotate, add a key, make it primary, and drop the old one once the
+// background re-sealing has logged that it is done. ok is false if no
+// keys are configured, leaving fields in plaintext.
+func encryptionKeys() (keys fieldcrypt.Keyring, ok bool, err error) {
+	encoded := viper.GetStringMapString("encryption.keys")
+	if len(encoded) == 0 {
+		return fieldcrypt.Keyring{}, false, nil
+	}
+	keys = fieldcrypt.Keyring{Primary: viper.GetString("encryption.primary_key"), Keys: make(map[string][]byte)}
+	for version, key := range encoded {
+		if keys.Keys[version], err = base64.StdEncoding.DecodeString(key); err != nil {
+			return fieldcrypt.Keyring{}, false, fmt.Errorf("encryption.keys.%s: %w", version, err)
+		}
+	}
+	return keys, true, keys.Check()
+}
 
-	// 3. yaml.v3 - YAML parsing
+// newRedactor returns the redactor of the models in app.PIIModels,
+// hashing with pii.hash_key. Set the key so hashes match across restarts
+// and replicas; without it each process hashes with a random key.
+func newRedactor() *pii.Redactor {
+	r := pii.NewRedactor([]byte(viper.GetString("pii.hash_key")))
+	for collection, model := range app.PIIModels {
+		r.Register(collection, model)
+	}
+	return r
+}
+
+// newPrivacy returns the service answering users' data export and
+// erasure requests, redacting exports with redactor, or nil if
+// privacy.enabled is off. privacy.sources
+// holds per collection the field naming a record's user, empty if records
+// are keyed by user, how to erase them, delete or anonymize, and the
+// further fields anonymizing overwrites. Without it, the sources are
+// app.PrivacySources.
+func newPrivacy(store storage.Store, trail *audit.Log, redactor *pii.Redactor) (*privacy.Service, error) {
+	if !viper.GetBool("privacy.enabled") {
+		return nil, nil
+	}
+	var configured map[string]privacy.Source
+	if err := viper.UnmarshalKey("privacy.sources", &configured); err != nil {
+		return nil, fmt.Errorf("privacy.sources: %w", err)
+	}
+	sources := app.PrivacySources
+	if len(configured) > 0 {
+		sources = make([]privacy.Source, 0, len(configured))
+		for collection, src := range configured {
+			src.Collection = collection
+			sources = append(sources, src)
+		}
+		sort.Slice(sources, func(i, j int) bool { return sources[i].Collection < sources[j].Collection })
+	}
+	s, err := privacy.NewService(store, trail, sources...)
+	if err != nil {
+		return nil, err
+	}
+	s.PII = redactor
+	return s, nil
+}
+
+// newPlans returns the plans service of the plans.* keys, or nil when
+// plans.enabled is off. plans.definitions maps plan names to their rate,
+// burst, quota and features, replacing the built-in free, pro and
+// internal plans.
+func newPlans(store storage.Store) (*plans.Service, error) {
+	if !viper.GetBool("plans.enabled") {
+		return nil, nil
+	}
+	var configured map[string]plans.Plan
+	if err := viper.UnmarshalKey("plans.definitions", &configured); err != nil {
+		return nil, fmt.Errorf("plans.definitions: %w", err)
+	}
+	if len(configured) == 0 {
+		configured = plans.Defaults
+	}
+	s, err := plans.NewService(store, configured, viper.GetString("plans.default"))
+	if err != nil {
+		return nil, err
+	}
+	s.CacheTTL = viper.GetDuration("plans.cache_ttl")
+	return s, nil
+}
+
+// newIPFilter returns the address filter of the ipfilter.allow and
+// ipfilter.deny CIDR ranges, auditing rejections to trail, or nil if
+// ipfilter.enabled is off.
+func newIPFilter(trail *audit.Log) (*ipfilter.Filter, error) {
+	if !viper.GetBool("ipfilter.enabled") {
+		return nil, nil
+	}
+	f, err := ipfilter.New(viper.GetStringSlice("ipfilter.allow"), viper.GetStringSlice("ipfilter.deny"))
+	if err != nil {
+		return nil, err
+	}
+	f.Audit = trail
+	return f, nil
+}
+
+// newContentFilter returns the filter of contentfilter.words, the files of
+// contentfilter.wordlists and, if contentfilter.moderation.url is set, a
+// moderation API, or nil if contentfilter.enabled is off.
+func newContentFilter() (*contentfilter.Filter, error) {
+	if !viper.GetBool("contentfilter.enabled") {
+		return nil, nil
+	}
+	return contentfilter.New(contentfilter.Config{
+		Words:             viper.GetStringSlice("contentfilter.words"),
+		Wordlists:         viper.GetStringSlice("contentfilter.wordlists"),
+		ModerationURL:     viper.GetString("contentfilter.moderation.url"),
+		ModerationToken:   viper.GetString("contentfilter.moderation.token"),
+		ModerationTimeout: viper.GetDuration("contentfilter.moderation.timeout"),
+		CacheSize:         viper.GetInt("contentfilter.moderation.cache_size"),
+		CacheTTL:          viper.GetDuration("contentfilter.moderation.cache_ttl"),
+		FailClosed:        viper.GetBool("contentfilter.moderation.fail_closed"),
+	})
+}
+
+// newQR returns the handler of /qr, caching images up to
+// qr.cache.max_entries and qr.cache.max_bytes for qr.cache.ttl, and its
+// per-IP limit of qr.ratelimit.rps in bursts of qr.ratelimit.burst, or
+// none if rps is 0. It returns nil if qr.enabled is off.
+func newQR() (*handlers.QR, *middleware.Limiter) {
+	if !viper.GetBool("qr.enabled") {
+		return nil, nil
+	}
+	images := cache.NewLRU(viper.GetInt("qr.cache.max_entries"), viper.GetInt("qr.cache.max_bytes"), viper.GetDuration("qr.cache.ttl"))
+	var limiter *middleware.Limiter
+	if rps := viper.GetFloat64("qr.ratelimit.rps"); rps > 0 {
+		limiter = middleware.NewLimiter(rps, viper.GetInt("qr.ratelimit.burst"))
+	}
+	return handlers.NewQR(images), limiter
+}
+
+// newSpeaker returns the speaker of /greet/audio, or nil if tts.enabled
+// is off. It synthesizes through the API at tts.provider.url if set and
+// locally otherwise, caching audio in files under tts.store.dir or, when
+// that is unset, in memory up to tts.store.max_objects and
+// tts.store.max_bytes.
+func newSpeaker() (*tts.Speaker, error) {
+	if !viper.GetBool("tts.enabled") {
+		return nil, nil
+	}
+	var store objectstore.Store = objectstore.NewMemory(viper.GetInt("tts.store.max_objects"), viper.GetInt("tts.store.max_bytes"))
+	if dir := viper.GetString("tts.store.dir"); dir != "" {
+		d, err := objectstore.NewDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("tts.store.dir: %w", err)
+		}
+		store = d
+	}
+	var provider tts.Provider
+	if url := viper.GetString("tts.provider.url"); url != "" {
+		provider = &tts.Remote{
+			URL:    url,
+			Token:  viper.GetString("tts.provider.token"),
+			Client: &http.Client{Timeout: viper.GetDuration("tts.provider.timeout")},
+		}
+	}
+	return tts.NewSpeaker(provider, store), nil
+}
+
+// newTimeouts returns the handler deadlines: timeout.default, and
+// timeout.routes overriding it by route pattern, such as
+// timeout.routes./greet-many: 1m. /changes and CPU profiles have no
+// deadline unless timeout.routes gives them one. It returns nil if
+// timeout.enabled is off.
+func newTimeouts() (*timeout.Config, error) {
+	if !viper.GetBool("timeout.enabled") {
+		return nil, nil
+	}
+	cfg := &timeout.Config{Default: viper.GetDuration("timeout.default")}
+	if err := viper.UnmarshalKey("timeout.routes", &cfg.Routes); err != nil {
+		return nil, fmt.Errorf("timeout.routes: %w", err)
+	}
+	if cfg.Routes == nil {
+		cfg.Routes = make(map[string]time.Duration)
+	}
+	// The change feed streams for as long as its client listens, and CPU
+	// profiles run for their ?seconds=, capped at profiling.max_duration.
+	for _, path := range []string{"/changes", profiling.CPUPath} {
+		if _, ok := cfg.Routes[path]; !ok {
+			cfg.Routes[path] = 0
+		}
+	}
+	return cfg, nil
+}
+
+// newPurger returns the purger of the retention.policies key, which holds
+// per collection a max_age, such as 2160h for 90 days, and optionally the
+// field age is measured from, created_at or updated_at. Policies on the
+// collections tenants scopes, if set, purge every tenant's records. It
+// returns nil if no policies are configured.
+func newPurger(store storage.Store, tenants *storage.TenantStore) (*retention.Purger, error) {
+	var configured map[string]struct {
+		MaxAge time.Duration `mapstructure:"max_age"`
+		Field  string        `mapstructure:"field"`
+	}
+	if err := viper.UnmarshalKey("retention.policies", &configured); err != nil {
+		return nil, fmt.Errorf("retention.policies: %w", err)
+	}
+	if len(configured) == 0 {
+		return nil, nil
+	}
+	policies := make([]retention.Policy, 0, len(configured))
+	for collection, p := range configured {
+		policies = append(policies, retention.Policy{Collection: collection, MaxAge: p.MaxAge, Field: p.Field})
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Collection < policies[j].Collection })
+	purger, err := retention.NewPurger(store, policies...)
+	if err != nil {
+		return nil, err
+	}
+	purger.BatchSize = viper.GetInt("retention.batch_size")
+	purger.Tenants = tenants
+	return purger, nil
+}
+
+// scheduleRetention runs purger on the retention.schedule cron, in
+// retention.time_zone, until ctx is canceled. With retention.dry_run set
+// the scheduled purges only log what they would delete.
+func scheduleRetention(ctx context.Context, purger *retention.Purger) error {
+	loc, err := time.LoadLocation(viper.GetString("retention.time_zone"))
+	if err != nil {
+		return fmt.Errorf("retention.time_zone: %w", err)
+	}
+	cron, err := schedule.ParseCron(viper.GetString("retention.schedule"), loc)
+	if err != nil {
+		return fmt.Errorf("retention.schedule: %w", err)
+	}
+	purge := purger.Job(viper.GetBool("retention.dry_run"))
+	jobs := schedule.New()
+	jobs.Add(schedule.Job{Name: "retention", Cron: cron, Run: func(ctx context.Context) error {
+		return purge(storage.Unscoped(ctx))
+	}})
+	jobs.Start(ctx)
+	return nil
+}
+
+// listenersConfig reads the listeners key: a list of listeners, each with
+// a name, an address and network, optional tls settings, timeouts, and
+// the routes it serves. Without it there is one listener on host and port
+// serving every route. Listeners without their own timeouts or connection
+// cap get server.read_timeout, server.write_timeout and
+// server.max_connections_per_ip, and those without tls settings serve
+// HTTPS when tls.cert_file and tls.key_file are set.
+func listenersConfig() ([]server.Config, error) {
+	var configs []server.Config
+	if err := viper.UnmarshalKey("listeners", &configs); err != nil {
+		return nil, fmt.Errorf("listeners: %w", err)
+	}
+	if len(configs) == 0 {
+		configs = []server.Config{{
+			Name:    server.DefaultName,
+			Address: net.JoinHostPort(viper.GetString("host"), strconv.Itoa(viper.GetInt("port"))),
+		}}
+	}
+	for i := range configs {
+		if configs[i].ReadTimeout == 0 {
+			configs[i].ReadTimeout = viper.GetDuration("server.read_timeout")
+		}
+		if configs[i].WriteTimeout == 0 {
+			configs[i].WriteTimeout = viper.GetDuration("server.write_timeout")
+		}
+		if configs[i].MaxConnsPerIP == 0 {
+			configs[i].MaxConnsPerIP = viper.GetInt("server.max_connections_per_ip")
+		}
+		if !configs[i].TLS.Enabled() {
+			configs[i].TLS.CertFile = viper.GetString("tls.cert_file")
+			configs[i].TLS.KeyFile = viper.GetString("tls.key_file")
+		}
+	}
+	return configs, server.Validate(configs)
+}
+
+// pprofConfig declares the listener serving profiling.Debug when
+// pprof.enabled is set: pprof.address, localhost only by default, because
+// the endpoints have no authentication and can expose memory contents.
+func pprofConfig() server.Config {
+	return server.Config{Name: "pprof", Address: viper.GetString("pprof.address")}
+}
+
+// openListeners opens the configured listeners, each with a router holding
+// only its routes. Sockets passed by systemd socket activation serve every
+// route and take the place of the first configured listener.
+func openListeners(deps app.Deps) ([]server.Listener, error) {
+	configs, err := listenersConfig()
+	if err != nil {
+		return nil, err
+	}
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return nil, fmt.Errorf("using systemd sockets: %w", err)
+	}
+	var listeners []server.Listener
+	if len(activated) > 0 {
+		router := app.NewRouter(deps, nil)
+		for i, l := range activated {
+			listeners = append(listeners, server.Listener{Name: fmt.Sprintf("systemd-%d", i), Listener: l, Handler: router})
+		}
+		configs = configs[1:]
+	}
+	for _, c := range configs {
+		var include func(string) bool
+		if len(c.Routes) > 0 {
+			include = routes.Match(c.Routes...)
+		}
+		l, err := server.Open(c, app.NewRouter(deps, include))
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// applyLimits sizes the Go runtime to the container's cgroup limits, unless
+// limits.apply is off, and logs the result.
+func applyLimits() limits.Report {
+	detected, err := limits.Detect()
+	if err != nil {
+		logrus.WithError(err).Warn("detecting cgroup limits")
+	}
+	apply := detected
+	if !viper.GetBool("limits.apply") {
+		// Still report what was detected, but leave the runtime alone.
+		apply = limits.Limits{}
+	}
+	report := limits.Report{Detected: detected, Runtime: limits.Apply(apply, viper.GetFloat64("limits.memory_fraction"))}
+	logrus.WithFields(logrus.Fields{
+		"cgroup":     detected.CgroupVersion,
+		"cpu_limit":  detected.CPU,
+		"mem_limit":  detected.Memory,
+		"gomaxprocs": fmt.Sprintf("%d (%s)", report.Runtime.GOMAXPROCS, report.Runtime.GOMAXPROCSSource),
+		"gomemlimit": fmt.Sprintf("%d (%s)", report.Runtime.GOMEMLIMIT, report.Runtime.GOMEMLIMITSource),
+	}).Info("resource limits")
+	return report
+}
+
+// demonstrateNewDependencies exercises each demo dependency and returns the
+// names of those that worked. Details are logged at debug level.
+func demonstrateNewDependencies(verifier *auth.Verifier) []string {
+	var ok []string
+	check := func(name, format string, args ...interface{}) {
+		logrus.WithField("dependency", name).Debugf(format, args...)
+		ok = append(ok, name)
+	}
+
+	// 1. viper - Configuration management
+	check("viper", "configuration set with defaults")
+
+	// 2. yaml.v3 - YAML parsing
 	config := Config{
 		AppName: viper.GetString("app_name"),
 		Port:    viper.GetInt("port"),
 		Debug:   viper.GetBool("debug"),
 	}
-	yamlData, _ := yaml.Marshal(&config)
-	color.Green("✓ yaml.v3: Config marshaled to YAML: %s", string(yamlData))
+	if yamlData, err := yaml.Marshal(&config); err == nil {
+		check("yaml.v3", "config marshaled to YAML: %s", yamlData)
+	}
 
-	// 4. validator - Struct validation
+	// 3. validator - Struct validation
 	validate := validator.New()
 	if err := validate.Struct(config); err == nil {
-		color.Green("✓ validator: Config validation passed")
+		check("validator", "config validation passed")
 	}
 
-	// 5. go-cache - In-memory caching
-	c := cache.New(5*time.Minute, 10*time.Minute)
-	c.Set("demo-key", "demo-value", cache.DefaultExpiration)
-	if val, found := c.Get("demo-key"); found {
-		color.Green("✓ go-cache: Retrieved value from cache: %s", val)
+	// 4. go-cache - In-memory caching
+	c, err := newCache()
+	if err != nil {
+		logrus.WithError(err).Fatal("creating cache")
+	}
+	ctx := context.Background()
+	if err := c.Set(ctx, "demo-key", "demo-value", 0); err == nil {
+		if val, found, _ := c.Get(ctx, "demo-key"); found {
+			check("go-cache", "retrieved value from cache: %s", val)
+		}
 	}
 
-	// 6. jwt-go - JWT token generation
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	// 5. jwt-go - JWT token generation
+	if tokenString, err := verifier.Sign(jwt.MapClaims{
 		"user": "demo-user",
 		"exp":  time.Now().Add(time.Hour * 24).Unix(),
-	})
-	tokenString, _ := token.SignedString([]byte("secret-key"))
-	color.Green("✓ jwt-go: Generated JWT token (truncated): %s...", tokenString[:20])
+	}); err == nil {
+		check("jwt-go", "generated JWT token (truncated): %s...", tokenString[:20])
+	}
 
-	// 7. testify/assert - Assertions (typically for tests, but demonstrating here)
+	// 6. testify/assert - Assertions (typically for tests, but demonstrating here)
 	testValue := true
-	assert.True(nil, testValue, "This should be true") // nil context for demo
-	color.Green("✓ testify/assert: Assertion passed")
+	if assert.True(nil, testValue, "This should be true") { // nil context for demo
+		check("testify/assert", "assertion passed")
+	}
 
-	// 8. protobuf - Protocol buffers
+	// 7. protobuf - Protocol buffers
 	protoMsg := &ProtoMessage{
 		Timestamp: timestamppb.Now(),
 		Message:   "Hello from protobuf",
 	}
 	// Marshal to demonstrate protobuf usage
 	_ = proto.Size(protoMsg.Timestamp)
-	color.Green("✓ protobuf: Created protobuf timestamp: %v", protoMsg.Timestamp.AsTime())
+	check("protobuf", "created protobuf timestamp: %v", protoMsg.Timestamp.AsTime())
 
-	// 10. fatih/color - Already used above for colored output
-	color.Yellow("✓ color: All dependencies demonstrated successfully!")
+	// 8. cobra - CLI framework (command structure)
+	check("cobra", "CLI framework initialized (see rootCmd)")
 
-	// 11. cobra - CLI framework (command structure)
-	color.Cyan("✓ cobra: CLI framework initialized (see rootCmd)")
+	return ok
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "bazel-demo-app",
 	Short: "A demo Bazel Go application",
-	Long:  "A demonstration application showing Bazel build with multiple Go dependencies",
-	Run: func(cmd *cobra.Command, args []string) {
-		runServer()
-	},
+	Long: "A demonstration application showing Bazel build with multiple Go dependencies. " +
+		"Run \"bazel-demo-app serve\" to start the server.",
 }
 
-func runServer() {
+// runServer serves until ctx is done, then shuts down gracefully.
+func runServer(ctx context.Context) {
 	fmt.Println("Hello world")
 
-	// Demonstrate all new dependencies
-	color.Cyan("\n=== Demonstrating New Dependencies ===")
-	demonstrateNewDependencies()
-	color.Cyan("=====================================\n")
+	sources := []string{"defaults"}
+	// Load environment variables from a .env file if it exists.
+	if err := godotenv.Load(); err == nil {
+		sources = append(sources, ".env")
+	}
+	setConfigDefaults()
+	if err := loadConfig(); err != nil {
+		log.Printf("error starting server: %s\n", err)
+		os.Exit(1)
+	}
+	applyLogLevel()
+	// Log lines made with a request's context carry its ID.
+	logrus.AddHook(requestid.Hook{})
+	redactor := newRedactor()
+	logrus.AddHook(pii.Hook{Redactor: redactor})
+	if f := viper.ConfigFileUsed(); f != "" {
+		sources = append(sources, f)
+	}
+	if env := config.FromEnv(viper.GetViper()); len(env) > 0 {
+		sources = append(sources, "env ("+strings.Join(env, ", ")+")")
+	}
+
+	// Check listener settings, TLS files included, up front, so mistakes
+	// fail here rather than after the upstream fetch.
+	if _, err := listenersConfig(); err != nil {
+		logrus.WithError(err).Fatal("invalid listener configuration")
+	}
+	if viper.GetBool("pprof.enabled") {
+		if err := server.Validate([]server.Config{pprofConfig()}); err != nil {
+			logrus.WithError(err).Fatal("invalid pprof configuration")
+		}
+	}
+
+	// Take the PID file before anything else, so a second instance stops
+	// here rather than at the port bind.
+	if path := viper.GetString("pidfile.path"); path != "" {
+		pid, err := pidfile.Acquire(path)
+		if err != nil {
+			logrus.WithError(err).Fatal("acquiring PID file")
+		}
+		defer pid.Release()
+	}
+
+	resources := applyLimits()
+
+	// Fingerprint once every default, flag and file value is in place.
+	fingerprints, err := config.NewFingerprints(viper.GetViper())
+	if err != nil {
+		logrus.WithError(err).Fatal("fingerprinting configuration")
+	}
+	// Components register the keys they can apply live as they are
+	// built; see registerReloadHooks.
+	reloader := config.NewReloader(viper.GetViper())
+	reloader.Validate = func(v *viper.Viper) error { return config.Decode(v, &Config{}) }
+	if viper.ConfigFileUsed() != "" {
+		viper.OnConfigChange(func(fsnotify.Event) {
+			fingerprints.Check()
+			reloader.Reload()
+		})
+		viper.WatchConfig()
+	}
+
+	authCfg, err := authConfig()
+	if err != nil {
+		logrus.WithError(err).Fatal("loading auth keys")
+	}
+	if signing := authCfg.Keys[strings.ToLower(viper.GetString("auth.key_id"))]; string(signing.Secret) == auth.DevSecret {
+		logrus.Warnf("auth.secret is the built-in development secret; set %s before exposing the server", config.EnvVar("auth.secret"))
+	}
+	verifier, err := auth.NewVerifier(authCfg)
+	if err != nil {
+		logrus.WithError(err).Fatal("loading auth keys")
+	}
+
+	dependencies := demonstrateNewDependencies(verifier)
+
+	go watchdog.New(watchdog.Config{
+		Interval:  viper.GetDuration("watchdog.interval"),
+		Threshold: viper.GetInt("watchdog.goroutine_threshold"),
+		Samples:   viper.GetInt("watchdog.samples"),
+	}).Run(ctx)
 
 	// Existing functionality
-	wadl, err := xmlquery.LoadURL("https://httpbin.org/get")
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	wadl, err := upstream.New().LoadXML(loadCtx, "https://httpbin.org/get")
+	cancel()
 	if err != nil {
 		panic(err)
 	}
@@ -159,25 +1107,362 @@ func runServer() {
 	attr := xmlquery.FindOne(wadl, "//application/@xmlns")
 	fmt.Println(attr.InnerText())
 
-	router := mux.NewRouter()
+	queries := querylog.New(storage.NewMemory(), querylog.Config{
+		SlowThreshold: viper.GetDuration("storage.slow_query_threshold"),
+		Recent:        viper.GetInt("storage.recent_queries"),
+	})
+	backend := storage.Store(queries)
+	keys, encrypt, err := encryptionKeys()
+	if err != nil {
+		logrus.WithError(err).Fatal("loading encryption keys")
+	}
+	if encrypt {
+		sealed, err := fieldcrypt.NewStore(backend, keys)
+		if err != nil {
+			logrus.WithError(err).Fatal("configuring field encryption")
+		}
+		for collection, model := range app.EncryptedModels {
+			sealed.Register(collection, model)
+		}
+		go sealed.Run(ctx, viper.GetDuration("encryption.rotate_interval"))
+		backend = sealed
+	}
+	var tenants *storage.TenantStore
+	if viper.GetBool("tenancy.enabled") {
+		tenants = storage.NewTenantStore(backend, viper.GetStringSlice("tenancy.collections")...)
+		backend = tenants
+	}
+	outbox := storage.NewOutbox(backend, handlers.GreetingsCollection, i18n.TranslationsCollection)
+	go outbox.Run(ctx, viper.GetDuration("changes.trim_interval"), viper.GetDuration("changes.retention"))
+	store := storage.Store(outbox)
+	// Usage records are written beside the metered store, not through it.
+	var meter *metering.Meter
+	if viper.GetBool("metering.enabled") {
+		meter = metering.NewMeter(outbox, viper.GetDuration("metering.period"))
+		go meter.Run(ctx, viper.GetDuration("metering.flush_interval"))
+		store = meter.Wrap(store, viper.GetStringSlice("metering.collections")...)
+	}
+	bus := events.NewBus()
+	hooks := webhooks.NewService(store)
+	bus.Subscribe(hooks.HandleEvent)
+
+	catalog := i18n.NewCatalog(store)
+	if err := catalog.Reload(ctx); err != nil {
+		logrus.WithError(err).Error("loading greeting translations")
+	}
+	go catalog.Watch(ctx, viper.GetDuration("i18n.reload_interval"))
+
+	checks := health.NewRegistry()
+	checks.Register("storage", 0, health.Storage(store))
+	reporter := &status.Reporter{Store: store, Health: checks}
+
+	usage := analytics.NewAggregator(store)
+	go usage.Run(ctx, viper.GetDuration("analytics.flush_interval"))
+
+	var levels *sla.Recorder
+	if viper.GetBool("sla.enabled") {
+		levels = sla.NewRecorder(store)
+		go levels.Run(ctx, viper.GetDuration("sla.flush_interval"))
+	}
+
+	geo, err := openGeoIP(ctx)
+	if err != nil {
+		logrus.WithError(err).Fatal("opening geo-IP databases")
+	}
+
+	files, err := wellknown.New(wellknown.Config{
+		RobotsFile:        viper.GetString("wellknown.robots_file"),
+		FaviconFile:       viper.GetString("wellknown.favicon_file"),
+		SecurityTxtFile:   viper.GetString("wellknown.security_txt_file"),
+		SecurityContact:   viper.GetString("wellknown.security_contact"),
+		ChangePasswordURL: viper.GetString("wellknown.change_password_url"),
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("loading well-known files")
+	}
+
+	sessions, err := newCache()
+	if err != nil {
+		logrus.WithError(err).Fatal("creating cache")
+	}
+	checks.Register("cache", 0, health.Cache(sessions))
+	// Such as the https://httpbin.org/get the upstream WADL comes from.
+	if url := viper.GetString("readiness.upstream_url"); url != "" {
+		checks.RegisterDependency("upstream", 0, health.HTTP(&http.Client{}, url))
+	}
+	tracker := presence.NewTracker(sessions, bus, viper.GetDuration("presence.ttl"))
+	go tracker.Run(ctx)
+
+	variants, err := canaryConfig()
+	if err != nil {
+		logrus.WithError(err).Fatal("loading canary routing")
+	}
+
+	hooked, err := responseHooks()
+	if err != nil {
+		logrus.WithError(err).Fatal("loading response hooks")
+	}
+
+	stages, err := greetingPipeline(catalog)
+	if err != nil {
+		logrus.WithError(err).Fatal("loading the greeting pipeline")
+	}
+
+	shadow, err := newMirror()
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring request mirroring")
+	}
+
+	clientsCfg, err := clientsConfig()
+	if err != nil {
+		logrus.WithError(err).Fatal("loading client configuration")
+	}
+	registry := clients.NewRegistry(clientsCfg)
+	registerReloadHooks(reloader, registry, verifier)
+
+	login, err := newLogin(verifier, sessions)
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring logins")
+	}
 
-	router.HandleFunc("/greet", handlers.Greet).Methods("GET")
-	router.HandleFunc("/greet-many", handlers.GreetMany).Methods("GET")
+	trail := audit.NewLog(store)
+	verifier.OnImpersonation(trail.Impersonated)
+	var impersonation *handlers.Impersonation
+	if viper.GetBool("auth.impersonation.enabled") {
+		impersonation = handlers.NewImpersonation(verifier, trail, viper.GetDuration("auth.impersonation.max_ttl"), viper.GetStringSlice("auth.impersonation.denied_scopes")...)
+	}
+	data, err := newPrivacy(store, trail, redactor)
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring data requests")
+	}
 
-	address := ":5000"
+	// Purges and cache flushes wait for a second admin unless
+	// approval.enabled is off.
+	var approvals *approval.Manager
+	if viper.GetBool("approval.enabled") {
+		approvals = approval.NewManager(store, trail, viper.GetDuration("approval.ttl"))
+	}
 
-	log.Printf("server started at port %v\n", address)
+	tiers, err := newPlans(store)
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring plans")
+	}
 
-	err = http.ListenAndServe(address, router)
+	notifications := notify.NewService(store)
+	var detector *anomaly.Detector
+	if viper.GetBool("anomaly.enabled") {
+		detector = anomaly.New(anomaly.Config{
+			Interval:    viper.GetDuration("anomaly.interval"),
+			Alpha:       viper.GetFloat64("anomaly.alpha"),
+			Threshold:   viper.GetFloat64("anomaly.threshold"),
+			Warmup:      viper.GetInt("anomaly.warmup"),
+			MinRequests: viper.GetInt64("anomaly.min_requests"),
+		})
+		detector.Bus = bus
+		detector.Notify = notifications
+		detector.Users = viper.GetStringSlice("anomaly.notify_users")
+		go detector.Run(ctx)
+	}
 
-	if errors.Is(err, http.ErrServerClosed) {
+	var limiter *middleware.Limiter
+	if viper.GetBool("ratelimit.enabled") {
+		limiter = middleware.NewLimiter(viper.GetFloat64("ratelimit.rps"), viper.GetInt("ratelimit.burst"))
+	}
+	// Buckets and quotas are restored before serving, and saved as they
+	// drain, so a restart doesn't reset them.
+	if viper.GetBool("limitstate.enabled") {
+		syncer := limitstate.NewSyncer(store)
+		syncer.Register(ctx, "clients", registry)
+		if limiter != nil {
+			syncer.Register(ctx, "ratelimit", limiter)
+		}
+		if tiers != nil {
+			syncer.Register(ctx, "plans", tiers)
+		}
+		go syncer.Run(ctx, viper.GetDuration("limitstate.interval"))
+	}
+
+	allowlist, err := newIPFilter(trail)
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring the IP filter")
+	}
+
+	moderation, err := newContentFilter()
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring the content filter")
+	}
+
+	codes, codeLimit := newQR()
+
+	speaker, err := newSpeaker()
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring text-to-speech")
+	}
+
+	deadlines, err := newTimeouts()
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring timeouts")
+	}
+
+	purger, err := newPurger(store, tenants)
+	if err != nil {
+		logrus.WithError(err).Fatal("configuring retention")
+	}
+	if purger != nil {
+		if err := scheduleRetention(ctx, purger); err != nil {
+			logrus.WithError(err).Fatal("scheduling retention")
+		}
+	}
+
+	deps := app.Deps{
+		Store:         store,
+		Outbox:        outbox,
+		Cursors:       paginate.NewSigner([]byte(viper.GetString("pagination.cursor_secret"))),
+		Events:        bus,
+		Webhooks:      hooks,
+		Notify:        notifications,
+		Catalog:       catalog,
+		Pipeline:      stages,
+		Status:        reporter,
+		Analytics:     usage,
+		SLA:           levels,
+		WellKnown:     files,
+		Clients:       registry,
+		Presence:      tracker,
+		Limits:        resources,
+		Config:        fingerprints,
+		Mirror:        shadow,
+		Canary:        variants,
+		Transform:     hooked,
+		Auth:          verifier,
+		Login:         login,
+		Impersonation: impersonation,
+		Queries:       queries,
+		Retention:     purger,
+		Audit:         trail,
+		Approvals:     approvals,
+		Plans:         tiers,
+		Metering:      meter,
+		Anomaly:       detector,
+		Timeouts:      deadlines,
+		RateLimit:     limiter,
+		IPFilter:      allowlist,
+		ContentFilter: moderation,
+		Speaker:       speaker,
+		QR:            codes,
+		QRLimit:       codeLimit,
+		PII:           redactor,
+	}
+	if flusher, ok := sessions.(cache.Flusher); ok {
+		deps.Cache = flusher
+	}
+	if data != nil {
+		deps.Privacy, deps.Operations = data, operations.NewManager(store)
+	}
+	// Only set the interface when there is a database: a nil *geoip.DB in
+	// it wouldn't compare equal to nil.
+	if geo != nil {
+		deps.GeoIP = geo
+	}
+	if dir := viper.GetString("static.dir"); dir != "" {
+		deps.Static = compress.FileServer(os.DirFS(dir))
+	}
+
+	listeners, err := openListeners(deps)
+	if err != nil {
+		log.Printf("error starting server: %s\n", err)
+		os.Exit(1)
+	}
+	if viper.GetBool("pprof.enabled") {
+		l, err := server.Open(pprofConfig(), profiling.Debug())
+		if err != nil {
+			log.Printf("error starting server: %s\n", err)
+			os.Exit(1)
+		}
+		listeners = append(listeners, l)
+	}
+	var addresses []string
+	for _, l := range listeners {
+		addresses = append(addresses, l.Name+"="+l.Addr())
+	}
+
+	features := []string{"normalize", "locale", "useragent", "watchdog", "webhooks", "analytics", "clients", "changes", "presence"}
+	if viper.GetBool("profiling.enabled") {
+		features = append(features, "profiling")
+	}
+	if viper.GetBool("pprof.enabled") {
+		features = append(features, "pprof")
+	}
+	if codes != nil {
+		features = append(features, "qr")
+	}
+	if speaker != nil {
+		features = append(features, "tts")
+	}
+	if geo != nil {
+		features = append(features, "geoip")
+	}
+	if shadow != nil {
+		features = append(features, "mirror")
+	}
+	if purger != nil {
+		features = append(features, "retention")
+	}
+	if data != nil {
+		features = append(features, "privacy")
+	}
+	if encrypt {
+		features = append(features, "encryption")
+	}
+
+	summary := startupSummary{
+		AppName:       viper.GetString("app_name"),
+		Version:       buildinfo.Current().Version,
+		Profile:       viper.GetString("profile"),
+		Addresses:     addresses,
+		Features:      features,
+		AuthMode:      authMode(authCfg, viper.GetBool("auth.authorize")),
+		Storage:       "memory",
+		Cache:         viper.GetString("cache.backend"),
+		ConfigSources: sources,
+		ConfigHash:    fingerprints.Snapshot().Startup,
+		Dependencies:  dependencies,
+	}
+	summary.Log()
+	if summary.Profile == "dev" {
+		summary.Banner()
+	}
+
+	// Ready for traffic from here until shutdown starts draining.
+	reporter.SetStarted(true)
+	context.AfterFunc(ctx, func() { reporter.SetStarted(false) })
+	if _, err := systemd.Notify(systemd.Ready); err != nil {
+		logrus.WithError(err).Warn("notifying systemd")
+	}
+	go systemd.RunWatchdog(ctx, reporter.Healthy)
+	context.AfterFunc(ctx, func() {
+		if _, err := systemd.Notify(systemd.Stopping); err != nil {
+			logrus.WithError(err).Warn("notifying systemd")
+		}
+	})
+
+	err = server.Serve(ctx, viper.GetDuration("shutdown.timeout"), listeners...)
+	if err == nil {
 		log.Printf("server closed\n")
-	} else if err != nil {
+	} else {
 		log.Printf("error starting server: %s\n", err)
 		os.Exit(1)
 	}
 }
 
+func init() {
+	rootCmd.PersistentFlags().Duration("shutdown-timeout", 15*time.Second, "how long in-flight requests get to finish after a shutdown signal (shutdown.timeout)")
+	viper.BindPFlag("shutdown.timeout", rootCmd.PersistentFlags().Lookup("shutdown-timeout"))
+	rootCmd.PersistentFlags().String("config", "", "read settings from this YAML, JSON or TOML file")
+	rootCmd.PersistentFlags().String("pid-file", "", "write the process ID to this file and refuse to start if another process holds it (pidfile.path)")
+	viper.BindPFlag("pidfile.path", rootCmd.PersistentFlags().Lookup("pid-file"))
+}
+
 func main() {
 	// Use cobra for CLI command handling
 	if err := rootCmd.Execute(); err != nil {
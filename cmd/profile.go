@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/profiling"
+	"github.com/spf13/cobra"
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Work with runtime profiles",
+}
+
+var profileCaptureCmd = &cobra.Command{
+	Use:   "capture",
+	Short: "Capture a CPU profile from a running server for use as default.pgo",
+	Long: "Capture a CPU profile from a running server. The server must have " +
+		"profiling.enabled set; pass an admin --token if it authorizes " +
+		"requests. Commit the output as cmd/default.pgo to build the next " +
+		"release with profile-guided optimization.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, _ := cmd.Flags().GetString("server")
+		duration, _ := cmd.Flags().GetDuration("duration")
+		output, _ := cmd.Flags().GetString("output")
+		token, _ := cmd.Flags().GetString("token")
+
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), duration+30*time.Second)
+		defer cancel()
+		if err := profiling.Capture(ctx, server, token, duration, f); err != nil {
+			f.Close()
+			os.Remove(output)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "wrote %s\n", output)
+		return nil
+	},
+}
+
+func init() {
+	profileCaptureCmd.Flags().String("server", "http://localhost:5000", "base URL of the running server")
+	profileCaptureCmd.Flags().Duration("duration", profiling.DefaultDuration, "how long to profile for")
+	profileCaptureCmd.Flags().String("output", "default.pgo", "file to write the profile to")
+	profileCaptureCmd.Flags().String("token", "", "bearer token of an admin, for servers with auth.authorize on")
+	profileCmd.AddCommand(profileCaptureCmd)
+	rootCmd.AddCommand(profileCmd)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/spf13/viper"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/profiling"
+)
+
+// TestProfileCaptureTimeout checks that a CPU capture lasting the default
+// handler deadline isn't cut off by it.
+func TestProfileCaptureTimeout(t *testing.T) {
+	viper.Set("profiling.enabled", true)
+	viper.Set("timeout.enabled", true)
+	viper.Set("timeout.default", time.Second)
+	t.Cleanup(func() {
+		viper.Set("profiling.enabled", false)
+		viper.Set("timeout.enabled", false)
+	})
+	deadlines, err := newTimeouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := app.NewMemory(nil)
+	mem.Timeouts = deadlines
+	srv := httptest.NewServer(app.NewRouter(mem.Deps, nil))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	if err := profiling.Capture(context.Background(), srv.URL, "", time.Second, &out); err != nil {
+		t.Fatalf("Capture() of the default deadline = %v, want a profile", err)
+	}
+	if out.Len() == 0 {
+		t.Error("Capture() wrote an empty profile")
+	}
+}
+
+// TestProfileCaptureToken checks that captures from a server authorizing
+// requests need an admin's token, and succeed with one.
+func TestProfileCaptureToken(t *testing.T) {
+	viper.Set("profiling.enabled", true)
+	viper.Set("auth.authorize", true)
+	t.Cleanup(func() {
+		viper.Set("profiling.enabled", false)
+		viper.Set("auth.authorize", false)
+	})
+	mem := app.NewMemory(nil)
+	srv := httptest.NewServer(app.NewRouter(mem.Deps, nil))
+	defer srv.Close()
+
+	ctx := context.Background()
+	if err := profiling.Capture(ctx, srv.URL, "", time.Second, io.Discard); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Capture() without a token = %v, want 401", err)
+	}
+	token, err := mem.Auth.Issue(jwt.MapClaims{"sub": "ops", "roles": []string{"admin"}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profiling.Capture(ctx, srv.URL, token, time.Second, io.Discard); err != nil {
+		t.Errorf("Capture() with an admin token = %v, want a profile", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/protocompat"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var protoCmd = &cobra.Command{
+	Use:   "proto",
+	Short: "Check protobuf API definitions",
+}
+
+var protoBreakingCmd = &cobra.Command{
+	Use:   "breaking --against RELEASED CURRENT...",
+	Short: "Report breaking changes against a released descriptor set",
+	Long: "Compare the descriptor sets CURRENT, as built by proto_library or " +
+		"protoc --descriptor_set_out, with the descriptor set of the last " +
+		"release, and fail if a change would break clients built against it. " +
+		"In Bazel, use proto_breaking_test from //protocompat:breaking.bzl.",
+	Args: cobra.MinimumNArgs(1),
+	// Breaking changes are not a usage error.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		against, _ := cmd.Flags().GetString("against")
+		released, err := protocompat.ReadSet(against)
+		if err != nil {
+			return err
+		}
+		var sets []*descriptorpb.FileDescriptorSet
+		for _, path := range args {
+			set, err := protocompat.ReadSet(path)
+			if err != nil {
+				return err
+			}
+			sets = append(sets, set)
+		}
+
+		changes := protocompat.Check(released, protocompat.Merge(sets...))
+		for _, c := range changes {
+			fmt.Fprintln(cmd.OutOrStdout(), c)
+		}
+		if len(changes) > 0 {
+			return fmt.Errorf("%d breaking change(s) against %s", len(changes), against)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "no breaking changes against %s\n", against)
+		return nil
+	},
+}
+
+func init() {
+	protoBreakingCmd.Flags().String("against", "", "descriptor set of the last release (required)")
+	protoBreakingCmd.MarkFlagRequired("against")
+	protoCmd.AddCommand(protoBreakingCmd)
+	rootCmd.AddCommand(protoCmd)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+)
+
+// TestQRData checks that /qr encodes ?data= as sent through the full
+// router, past the query normalization other routes get, and that data
+// too long for a code is refused by the handler.
+func TestQRData(t *testing.T) {
+	h := app.NewRouter(app.NewMemory(nil).Deps, nil)
+	get := func(data string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/qr?level=H&data="+url.QueryEscape(data), nil))
+		return rec
+	}
+
+	if rec := get(strings.Repeat("a", 300)); rec.Code != http.StatusOK {
+		t.Errorf("GET /qr with 300 characters = %d %s, want 200", rec.Code, rec.Body)
+	}
+	rec := get(strings.Repeat("a", 1300))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "too long for a QR code") {
+		t.Errorf("GET /qr with 1300 characters = %d %s, want the handler's 400", rec.Code, rec.Body)
+	}
+	// Untrimmed, and in NFD rather than NFC, the data is another code.
+	if nfc, nfd := get("Jos\u00e9"), get(" Jose\u0301 "); nfc.Header().Get("ETag") == nfd.Header().Get("ETag") {
+		t.Errorf("GET /qr encoded %q like %q, want the data kept as sent", " Jose\u0301 ", "Jos\u00e9")
+	}
+}
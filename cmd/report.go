@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/sla"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Print reports from a running server",
+}
+
+var reportSLACmd = &cobra.Command{
+	Use:   "sla",
+	Short: "Print each endpoint's availability and latency percentiles",
+	Long: "Print the availability and latency percentiles of every endpoint " +
+		"of a running server over the last --since, busiest first, from its " +
+		sla.Path + " report. The server must have sla.enabled set. Hours are " +
+		"the unit of the report, so --since is rounded back to the hour.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		setConfigDefaults()
+		server, _ := cmd.Flags().GetString("server")
+		token, _ := cmd.Flags().GetString("token")
+		since, _ := cmd.Flags().GetDuration("since")
+		format, _ := cmd.Flags().GetString("format")
+		if format != "table" && format != "json" {
+			return fmt.Errorf("--format must be table or json, not %q", format)
+		}
+		if server == "" {
+			server = fmt.Sprintf("http://localhost:%d", viper.GetInt("port"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		endpoints, err := sla.Fetch(ctx, &http.Client{}, server, token, since)
+		if err != nil {
+			return err
+		}
+		return printSLA(cmd.OutOrStdout(), endpoints, format)
+	},
+}
+
+// printSLA writes endpoints as an aligned table or as JSON.
+func printSLA(out io.Writer, endpoints []sla.Endpoint, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(endpoints)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "endpoint\trequests\terrors\tavailability\tmean ms\tp50 ms\tp95 ms\tp99 ms\t")
+	for _, e := range endpoints {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.3f%%\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			e.Route, e.Requests, e.Errors, 100*e.Availability, e.MeanMillis, e.P50Millis, e.P95Millis, e.P99Millis)
+	}
+	return w.Flush()
+}
+
+func init() {
+	reportSLACmd.Flags().String("server", "", "base URL of the running server (default this configuration's server on localhost)")
+	reportSLACmd.Flags().String("token", "", "bearer token of an admin, for servers with auth.authorize on")
+	reportSLACmd.Flags().Duration("since", sla.DefaultSince, "how far back to report")
+	reportSLACmd.Flags().String("format", "table", "output format: table or json")
+	reportCmd.AddCommand(reportSLACmd)
+	rootCmd.AddCommand(reportCmd)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/sla"
+)
+
+// TestReportSLA fetches the SLA report of a server that served requests
+// and checks the table printed.
+func TestReportSLA(t *testing.T) {
+	mem := app.NewMemory(nil)
+	srv := httptest.NewServer(app.NewRouter(mem.Deps, nil))
+	defer srv.Close()
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(srv.URL + "/version")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	endpoints, err := sla.Fetch(context.Background(), srv.Client(), srv.URL, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := printSLA(&out, endpoints, "table"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < 2 || !strings.Contains(lines[0], "availability") || !strings.Contains(lines[1], "GET /version") ||
+		!strings.Contains(lines[1], " 3 ") || !strings.Contains(lines[1], "100.000%") {
+		t.Errorf("printSLA =\n%s\nwant GET /version first with 3 requests, all available", out.String())
+	}
+}
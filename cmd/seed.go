@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/datagen"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var seedCmd = &cobra.Command{
+	Use:   "seed [URL]",
+	Short: "Fill a running server with generated greetings",
+	Long: "POST generated greetings to /greetings of the server at URL, by " +
+		"default this configuration's server on localhost. The same --seed " +
+		"always generates the same greetings, so datasets can be rebuilt " +
+		"exactly; IDs are still assigned by the server. With --dry-run the " +
+		"greetings are printed as JSON lines instead.",
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		setConfigDefaults()
+		seed, _ := cmd.Flags().GetUint64("seed")
+		count, _ := cmd.Flags().GetInt("count")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		greetings := datagen.New(seed).Greetings(count)
+		if dryRun {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			for _, g := range greetings {
+				if err := enc.Encode(g); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		base := fmt.Sprintf("http://localhost:%d", viper.GetInt("port"))
+		if len(args) > 0 {
+			base = args[0]
+		}
+		client := &http.Client{Timeout: 10 * time.Second}
+		if err := seedGreetings(client, base, greetings); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "created %d greetings at %s (seed %d)\n", len(greetings), base, seed)
+		return nil
+	},
+}
+
+// seedGreetings creates each of greetings on the server at base, stopping
+// at the first failure.
+func seedGreetings(client *http.Client, base string, greetings []datagen.Greeting) error {
+	url := strings.TrimSuffix(base, "/") + "/greetings"
+	for i, g := range greetings {
+		body, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			return fmt.Errorf("greeting %d: POST %s: %s: %s", i+1, url, resp.Status, bytes.TrimSpace(msg))
+		}
+	}
+	return nil
+}
+
+func init() {
+	seedCmd.Flags().Uint64("seed", 1, "seed the greetings are generated from")
+	seedCmd.Flags().Int("count", 100, "number of greetings to create")
+	seedCmd.Flags().Bool("dry-run", false, "print the greetings instead of creating them")
+	rootCmd.AddCommand(seedCmd)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/datagen"
+	"github.com/Shulammite-Aso/bazel-demo-app/handlers"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestSeedGreetings seeds a server and checks that every generated
+// greeting was stored.
+func TestSeedGreetings(t *testing.T) {
+	mem := app.NewMemory(nil)
+	srv := httptest.NewServer(app.NewRouter(mem.Deps, nil))
+	defer srv.Close()
+
+	greetings := datagen.New(1).Greetings(25)
+	if err := seedGreetings(srv.Client(), srv.URL+"/", greetings); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := mem.Backing.List(context.Background(), handlers.GreetingsCollection, storage.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != len(greetings) {
+		t.Errorf("stored %d greetings, want %d", len(recs), len(greetings))
+	}
+
+	if err := seedGreetings(srv.Client(), srv.URL, []datagen.Greeting{{}}); err == nil {
+		t.Error("seedGreetings(a greeting without a name) succeeded, want an error")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/buildinfo"
+	"github.com/Shulammite-Aso/bazel-demo-app/selfupdate"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Replace this binary with the latest release of a channel",
+	Long: "Fetch the channel's release manifest from selfupdate.url, verify the " +
+		"binary's checksum and its Ed25519 signature by selfupdate.public_key, " +
+		"then atomically replace the running executable. Restart the service " +
+		"afterwards to run the new version. Without a public key releases are " +
+		"refused unless --insecure-skip-signature is passed.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		setConfigDefaults()
+		channel, _ := cmd.Flags().GetString("channel")
+		checkOnly, _ := cmd.Flags().GetBool("check")
+		force, _ := cmd.Flags().GetBool("force")
+		insecure, _ := cmd.Flags().GetBool("insecure-skip-signature")
+
+		u := &selfupdate.Updater{BaseURL: viper.GetString("selfupdate.url")}
+		if u.BaseURL == "" {
+			return errors.New("selfupdate.url is not set")
+		}
+		if key := viper.GetString("selfupdate.public_key"); key != "" {
+			raw, err := base64.StdEncoding.DecodeString(key)
+			if err != nil || len(raw) != ed25519.PublicKeySize {
+				return errors.New("selfupdate.public_key must be a base64 Ed25519 public key")
+			}
+			u.PublicKey = raw
+		} else if insecure {
+			u.InsecureSkipSignature = true
+			fmt.Fprintln(cmd.ErrOrStderr(), "warning: selfupdate.public_key is not set; only checksums are verified")
+		} else {
+			return errors.New("selfupdate.public_key is not set; pass --insecure-skip-signature to install releases checked only by checksum")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("selfupdate.timeout"))
+		defer cancel()
+		current := buildinfo.Version
+		if checkOnly {
+			m, _, err := u.Check(ctx, channel)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: latest %s, running %s\n", channel, m.Version, versionOrUnknown(current))
+			return nil
+		}
+		if force {
+			current = ""
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return err
+		}
+		version, err := u.Update(ctx, channel, current, exe)
+		if errors.Is(err, selfupdate.ErrUpToDate) {
+			fmt.Fprintf(cmd.OutOrStdout(), "already running %s\n", version)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "updated %s to %s; restart to run it\n", exe, version)
+		return nil
+	},
+}
+
+// versionOrUnknown returns v, or "unknown" for unstamped builds.
+func versionOrUnknown(v string) string {
+	if v == "" {
+		return "unknown"
+	}
+	return v
+}
+
+func init() {
+	selfUpdateCmd.Flags().String("channel", "stable", "release channel to update from")
+	selfUpdateCmd.Flags().Bool("check", false, "only report the channel's latest version")
+	selfUpdateCmd.Flags().Bool("force", false, "install even if that version is already running")
+	selfUpdateCmd.Flags().Bool("insecure-skip-signature", false, "accept releases without checking their signature when selfupdate.public_key is unset")
+	selfUpdateCmd.Flags().String("url", "", "base URL of the release manifests (selfupdate.url)")
+	selfUpdateCmd.Flags().String("public-key", "", "base64 Ed25519 key release signatures are checked with (selfupdate.public_key)")
+	viper.BindPFlag("selfupdate.url", selfUpdateCmd.Flags().Lookup("url"))
+	viper.BindPFlag("selfupdate.public_key", selfUpdateCmd.Flags().Lookup("public-key"))
+	rootCmd.AddCommand(selfUpdateCmd)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start the HTTP server",
+	Long: "Start the HTTP server and serve until interrupted or sent SIGTERM, " +
+		"then drain in-flight requests. --host and --port set the address " +
+		"when no listeners are configured.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := service.SignalContext(context.Background())
+		defer stop()
+		runServer(ctx)
+	},
+}
+
+func init() {
+	f := serveCmd.Flags()
+	f.String("host", "", "address to listen on, such as 127.0.0.1 or ::1; empty for every interface, dual-stack where supported (host)")
+	f.Int("port", 5000, "port to listen on (port)")
+	f.Duration("read-timeout", 30*time.Second, "limit on reading a whole request; 0 for none (server.read_timeout)")
+	f.Duration("write-timeout", 0, "limit on writing a response; 0 for none, which streams such as /changes need (server.write_timeout)")
+	f.String("tls-cert", "", "serve HTTPS with this PEM certificate; needs --tls-key (tls.cert_file)")
+	f.String("tls-key", "", "PEM private key of --tls-cert (tls.key_file)")
+	f.Bool("enable-pprof", false, "serve /debug/pprof on a separate listener at --pprof-address (pprof.enabled)")
+	f.String("pprof-address", "localhost:6060", "address of the /debug/pprof listener; keep it private, as pprof has no authentication (pprof.address)")
+	viper.BindPFlag("host", f.Lookup("host"))
+	viper.BindPFlag("port", f.Lookup("port"))
+	viper.BindPFlag("server.read_timeout", f.Lookup("read-timeout"))
+	viper.BindPFlag("server.write_timeout", f.Lookup("write-timeout"))
+	viper.BindPFlag("tls.cert_file", f.Lookup("tls-cert"))
+	viper.BindPFlag("tls.key_file", f.Lookup("tls-key"))
+	viper.BindPFlag("pprof.enabled", f.Lookup("enable-pprof"))
+	viper.BindPFlag("pprof.address", f.Lookup("pprof-address"))
+	rootCmd.AddCommand(serveCmd)
+}
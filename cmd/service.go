@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/service"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage the Windows service",
+	Long: "Register, remove or run the server as a Windows service. On other " +
+		"platforms run the server under systemd instead (see the sd_notify " +
+		"and socket activation support).",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:          "install",
+	Short:        "Register this binary as an automatically started service",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if exe, err = filepath.Abs(exe); err != nil {
+			return err
+		}
+		args = []string{"service", "run", "--name", name}
+		if path := viper.GetString("pidfile.path"); path != "" {
+			if path, err = filepath.Abs(path); err != nil {
+				return err
+			}
+			args = append(args, "--pid-file", path)
+		}
+		err = service.Install(service.Config{
+			Name:        name,
+			DisplayName: "Bazel demo app",
+			Description: "A demonstration application showing Bazel build with multiple Go dependencies",
+			Executable:  exe,
+			Args:        args,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "installed service %s running %s\n", name, exe)
+		return nil
+	},
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:          "uninstall",
+	Short:        "Stop and remove the service",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		if err := service.Uninstall(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "removed service %s\n", name)
+		return nil
+	},
+}
+
+var serviceRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the server as a service",
+	Long: "Run the server under the Service Control Manager, which is what " +
+		"installed services start. From an interactive console it runs in " +
+		"the foreground instead, stopping on Ctrl+C.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		isService, err := service.IsService()
+		if err != nil {
+			return err
+		}
+		if !isService {
+			ctx, stop := service.SignalContext(context.Background())
+			defer stop()
+			runServer(ctx)
+			return nil
+		}
+		return service.Run(name, func(ctx context.Context) error {
+			runServer(ctx)
+			return nil
+		})
+	},
+}
+
+func init() {
+	serviceCmd.PersistentFlags().String("name", service.DefaultName, "service name")
+	serviceCmd.AddCommand(serviceInstallCmd, serviceUninstallCmd, serviceRunCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
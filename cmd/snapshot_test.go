@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/app"
+	"github.com/Shulammite-Aso/bazel-demo-app/fixtures"
+	"github.com/Shulammite-Aso/bazel-demo-app/routes"
+)
+
+// apiSnapshots records responses of the v1 API. IDs, timestamps, cursors
+// and greeting messages, which are picked at random, differ per run, so
+// they are masked.
+var apiSnapshots = fixtures.Snapshots{
+	Version: "v1",
+	Headers: []string{"Content-Type", "Allow", "Deprecation", "WWW-Authenticate"},
+	Mask:    []string{"id", "message", "created_at", "updated_at", "next_cursor", "prev_cursor"},
+}
+
+// TestAPISnapshots sends a scripted series of requests through the full
+// router and compares each response with its golden file. Requests run
+// in order against the same stores, so later ones see earlier writes.
+// After an intended contract change, approve it with
+//
+//	go test ./cmd -run APISnapshots -update
+func TestAPISnapshots(t *testing.T) {
+	router := app.NewRouter(app.NewMemory(nil).Deps, nil)
+	steps := []struct {
+		name, method, target, body string
+	}{
+		{"greeting-translations-list", "GET", "/greeting-translations", ""},
+		{"greetings-create", "POST", "/greetings", `{"name":"Gladys","language":"en"}`},
+		{"greetings-create-invalid", "POST", "/greetings", `{"name":`},
+		{"greetings-list", "GET", "/greetings", ""},
+		{"greetings-get-missing", "GET", "/greetings/does-not-exist", ""},
+		{"greetings-method-not-allowed", "DELETE", "/greetings", ""},
+		{"webhooks-list", "GET", "/webhooks", ""},
+		{"notification-templates-list", "GET", "/notification-templates", ""},
+		{"greet-many-unauthorized", "GET", "/greet-many?name=Gladys", ""},
+		{"not-found", "GET", "/greetngs", ""},
+		{"openapi", "GET", routes.OpenAPIPath, ""},
+	}
+	for _, s := range steps {
+		req := httptest.NewRequest(s.method, s.target, strings.NewReader(s.body))
+		if s.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		apiSnapshots.Record(t, s.name, rec)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+)
+
+// startupSummary describes the effective setup of the server. It is logged
+// once at startup so operators can see what a process is running with.
+type startupSummary struct {
+	AppName       string
+	Version       string
+	Profile       string
+	Addresses     []string
+	Features      []string
+	AuthMode      string
+	Storage       string
+	Cache         string
+	ConfigSources []string
+	ConfigHash    string
+	Dependencies  []string
+}
+
+// Log writes the summary as a single structured Info entry.
+func (s startupSummary) Log() {
+	logrus.WithFields(logrus.Fields{
+		"app":            s.AppName,
+		"version":        s.Version,
+		"profile":        s.Profile,
+		"addresses":      s.Addresses,
+		"features":       s.Features,
+		"auth":           s.AuthMode,
+		"storage":        s.Storage,
+		"cache":          s.Cache,
+		"config_sources": s.ConfigSources,
+		"config_hash":    s.ConfigHash,
+		"dependencies":   s.Dependencies,
+	}).Info("server starting")
+}
+
+// Banner prints a human-friendly version of the summary to stdout. It is
+// meant for local development only.
+func (s startupSummary) Banner() {
+	rule := strings.Repeat("=", 40)
+	color.Cyan(rule)
+	color.Cyan(" %s %s (%s)", s.AppName, s.Version, s.Profile)
+	color.Cyan(rule)
+	row := func(label string, values ...string) {
+		color.Green(" %-10s %s", label, strings.Join(values, ", "))
+	}
+	row("listen", s.Addresses...)
+	row("features", s.Features...)
+	row("auth", s.AuthMode)
+	row("storage", s.Storage)
+	row("cache", s.Cache)
+	row("config", s.ConfigSources...)
+	row("config id", shortFingerprint(s.ConfigHash))
+	row("deps", s.Dependencies...)
+	color.Cyan(rule)
+}
+
+// authMode describes how requests are authenticated under c, such as
+// "jwt HS256/RS256, api keys". It says when the signing key is the
+// built-in development secret, and when roles aren't enforced because
+// auth.authorize is off.
+func authMode(c auth.Config, authorize bool) string {
+	mode := "jwt " + strings.Join(c.Algorithms(), "/")
+	if len(c.APIKeys) > 0 {
+		mode += ", api keys"
+	}
+	if string(c.Keys[c.SigningKey].Secret) == auth.DevSecret {
+		mode += ", dev secret"
+	}
+	if !authorize {
+		mode += ", roles not enforced"
+	}
+	return mode
+}
+
+// shortFingerprint abbreviates a fingerprint for display, like a short
+// commit hash.
+func shortFingerprint(fp string) string {
+	if len(fp) > 12 {
+		return fp[:12]
+	}
+	return fp
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+)
+
+// TestAuthMode checks the auth line of the startup summary for the
+// default keys and for a deployment with its own.
+func TestAuthMode(t *testing.T) {
+	dev := auth.Config{SigningKey: "default", Keys: map[string]auth.Key{"default": {Secret: []byte(auth.DevSecret)}}}
+	own := auth.Config{
+		SigningKey: "default",
+		Keys:       map[string]auth.Key{"default": {Secret: []byte("s3cret")}},
+		APIKeys:    map[string]auth.APIKey{"digest": {Client: "ci"}},
+	}
+	tests := []struct {
+		name      string
+		c         auth.Config
+		authorize bool
+		want      string
+	}{
+		{"dev secret", dev, true, "jwt HS256, dev secret"},
+		{"own secret", own, true, "jwt HS256, api keys"},
+		{"authorize off", own, false, "jwt HS256, api keys, roles not enforced"},
+	}
+	for _, tt := range tests {
+		if got := authMode(tt.c, tt.authorize); got != tt.want {
+			t.Errorf("%s: authMode() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/buildinfo"
+	"github.com/spf13/cobra"
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version, commit and build time",
+	Long: "Print what this binary was built from. Release builds " +
+		"(bazel build --config=release) are stamped with the version, git " +
+		"commit and build time; other builds report \"dev\" and whatever " +
+		"commit the Go toolchain recorded.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b := buildinfo.Current()
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(b)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), b)
+		return nil
+	},
+}
+
+func init() {
+	versionCmd.Flags().Bool("json", false, "print the build as JSON, as /version reports it")
+	rootCmd.AddCommand(versionCmd)
+}
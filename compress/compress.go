@@ -0,0 +1,290 @@
+// Package compress negotiates response compression. Middleware compresses
+// responses on the fly with Brotli or gzip; FileServer serves static
+// assets compressed ahead of time (see precompress.bzl). Both prefer
+// Brotli to gzip when the client accepts both.
+package compress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings, as they appear in Accept-Encoding.
+const (
+	Brotli   = "br"
+	Gzip     = "gzip"
+	Identity = "identity"
+)
+
+// MinSize is the smallest response Middleware compresses by default;
+// below it the framing outweighs the savings.
+const MinSize = 1024
+
+// brotliLevel is the quality Middleware compresses with. Higher levels
+// cost far more CPU per response for a few percent; assets that are worth
+// it are precompressed at the highest.
+const brotliLevel = 4
+
+// Config tunes which responses New's middleware compresses.
+type Config struct {
+	// MinSize is the smallest response compressed; zero means MinSize.
+	MinSize int
+	// Types are the media types compressed, such as application/json, or
+	// a whole type such as text/*. None means the text-like types
+	// compressible by default. Event streams are never compressed.
+	Types []string
+}
+
+// Negotiate returns the coding in offered, which is in order of
+// preference, that acceptEncoding rates highest, or Identity if it
+// accepts none of them.
+func Negotiate(acceptEncoding string, offered ...string) string {
+	best, bestQ := Identity, 0.0
+	for _, coding := range offered {
+		if q := quality(acceptEncoding, coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// quality returns acceptEncoding's q-value for coding, falling back to
+// its * entry.
+func quality(acceptEncoding, coding string) float64 {
+	q, wildcard := -1.0, -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		value := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.EqualFold(k, "q") {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					value = f
+				}
+			}
+		}
+		switch {
+		case strings.EqualFold(name, coding):
+			q = value
+		case name == "*":
+			wildcard = value
+		}
+	}
+	if q < 0 {
+		return max(wildcard, 0)
+	}
+	return q
+}
+
+// compressible reports whether a response of contentType is worth
+// compressing: one of types, or of the text-like types if there are none.
+// Event streams are excluded: compressor buffering would hold events back.
+func compressible(contentType string, types []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	if mediaType == "text/event-stream" {
+		return false
+	}
+	if len(types) > 0 {
+		for _, t := range types {
+			t = strings.ToLower(t)
+			if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "+xml"),
+		mediaType == "application/xml",
+		mediaType == "application/javascript",
+		mediaType == "application/x-ndjson",
+		mediaType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// encoder is a streaming compressor, such as a *gzip.Writer.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders pools the encoders of the codings Middleware offers.
+var encoders = map[string]*sync.Pool{
+	Brotli: {New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }},
+	Gzip: {New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}},
+}
+
+// Middleware compresses compressible responses of at least MinSize bytes
+// with Brotli or gzip, whichever the client accepts, preferring Brotli.
+// Responses that already have a Content-Encoding, such as FileServer's,
+// pass through.
+func Middleware(next http.Handler) http.Handler {
+	return New(Config{})(next)
+}
+
+// New returns middleware like Middleware, compressing the responses cfg
+// allows.
+func New(cfg Config) func(http.Handler) http.Handler {
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = MinSize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header())
+			coding := Negotiate(r.Header.Get("Accept-Encoding"), Brotli, Gzip)
+			if r.Method == http.MethodHead || coding == Identity {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w, cfg: &cfg, coding: coding}
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// addVary adds Accept-Encoding to h's Vary header unless it is there.
+func addVary(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// compressWriter decides on the first write, or once cfg.MinSize bytes
+// are buffered, whether to compress with coding.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg     *Config
+	coding  string
+	status  int
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if c.decided {
+		if c.enc != nil {
+			return c.enc.Write(p)
+		}
+		return c.ResponseWriter.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.cfg.MinSize {
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide writes the header, compressing if the response qualifies and
+// full says enough of it is known, then flushes the buffer.
+func (c *compressWriter) decide(full bool) error {
+	c.decided = true
+	h := c.Header()
+	if h.Get("Content-Type") == "" && len(c.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+	if full && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type"), c.cfg.Types) &&
+		c.status != http.StatusNoContent && c.status != http.StatusNotModified &&
+		c.status != http.StatusPartialContent {
+		h.Set("Content-Encoding", c.coding)
+		h.Del("Content-Length")
+		c.enc = encoders[c.coding].Get().(encoder)
+		c.enc.Reset(c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if c.enc != nil {
+		_, err = c.enc.Write(buf)
+	} else {
+		_, err = c.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what is buffered, deciding on compression with what is
+// known so far: streams flush early and stay uncompressed unless they
+// already filled cfg.MinSize.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		c.decide(false)
+	}
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through.
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c.decided = true
+	return http.NewResponseController(c.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Close finishes the response.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if c.status == 0 {
+			// The handler wrote nothing; net/http sends its own 200.
+			return nil
+		}
+		// The whole body is buffered and smaller than cfg.MinSize.
+		return c.decide(false)
+	}
+	if c.enc == nil {
+		return nil
+	}
+	err := c.enc.Close()
+	c.enc.Reset(nil)
+	encoders[c.coding].Put(c.enc)
+	c.enc = nil
+	return err
+}
@@ -0,0 +1,147 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// TestNegotiate checks Accept-Encoding parsing and preference order.
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept  string
+		offered []string
+		want    string
+	}{
+		{"gzip, deflate, br", []string{Brotli, Gzip}, Brotli},
+		{"gzip, deflate", []string{Brotli, Gzip}, Gzip},
+		{"br;q=0.5, gzip", []string{Brotli, Gzip}, Gzip},
+		{"br;q=0, gzip;q=0", []string{Brotli, Gzip}, Identity},
+		{"*", []string{Brotli, Gzip}, Brotli},
+		{"*;q=0.1, br;q=0", []string{Brotli, Gzip}, Gzip},
+		{"GZIP", []string{Gzip}, Gzip},
+		{"", []string{Brotli, Gzip}, Identity},
+		{"br", nil, Identity},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, tt.offered...); got != tt.want {
+			t.Errorf("Negotiate(%q, %v) = %s, want %s", tt.accept, tt.offered, got, tt.want)
+		}
+	}
+}
+
+// TestMiddleware checks which responses get compressed, and how.
+func TestMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"greeting":"hello"}`, 100)
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		encoding    string
+		body        string
+		flush       bool
+		want        string
+	}{
+		{"large json", "gzip", "application/json", "", large, false, Gzip},
+		{"small json", "gzip", "application/json", "", `{"a":1}`, false, ""},
+		{"brotli", "br", "application/json", "", large, false, Brotli},
+		{"brotli preferred", "gzip, br", "application/json", "", large, false, Brotli},
+		{"not accepted", "deflate", "application/json", "", large, false, ""},
+		{"image", "gzip", "image/png", "", large, false, ""},
+		{"event stream", "gzip", "text/event-stream", "", large, false, ""},
+		{"already encoded", "gzip", "text/css", Brotli, large, false, Brotli},
+		{"flushed early", "gzip", "application/x-ndjson", "", large, true, ""},
+	}
+	for _, tt := range tests {
+		h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			if tt.encoding != "" {
+				w.Header().Set("Content-Encoding", tt.encoding)
+			}
+			if tt.flush {
+				w.(http.Flusher).Flush()
+			}
+			io.WriteString(w, tt.body)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%s: Content-Encoding = %q, want %q", tt.name, got, tt.want)
+			continue
+		}
+		body := rec.Body.String()
+		switch {
+		case tt.encoding != "":
+		case tt.want == Gzip:
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			b, _ := io.ReadAll(zr)
+			body = string(b)
+		case tt.want == Brotli:
+			b, _ := io.ReadAll(brotli.NewReader(rec.Body))
+			body = string(b)
+		}
+		if body != tt.body {
+			t.Errorf("%s: body = %.40q..., want %.40q...", tt.name, body, tt.body)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q, want Accept-Encoding", tt.name, got)
+		}
+	}
+}
+
+// TestMiddlewareStatus checks that the handler's status survives
+// buffering, including for empty bodies.
+func TestMiddlewareStatus(t *testing.T) {
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest(http.MethodDelete, "/greetings/1", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("status = %d, Content-Encoding = %q, want 204 and none", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+}
+
+// TestNew checks that Config's threshold and allowlist decide what is
+// gzipped.
+func TestNew(t *testing.T) {
+	mw := New(Config{MinSize: 16, Types: []string{"text/*", "application/json"}})
+	tests := []struct {
+		contentType string
+		body        string
+		want        string
+	}{
+		{"application/json", `{"greeting":"hello"}`, Gzip},
+		{"application/json", `{"a":1}`, ""},
+		{"text/csv; charset=utf-8", "name,message\nGladys,Hi\n", Gzip},
+		{"application/xml", "<greeting>hello</greeting>", ""},
+		{"text/event-stream", "data: hello world\n\n", ""},
+	}
+	for _, tt := range tests {
+		h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			io.WriteString(w, tt.body)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("%s %q: Content-Encoding = %q, want %q", tt.contentType, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+"""Precompresses static assets for compress.FileServer."""
+
+def precompressed_assets(name, srcs, **kwargs):
+    """Bundles srcs with .gz and .br copies of each, side by side.
+
+    Brotli needs the brotli tool on the build host's PATH.
+
+    Args:
+      name: name of the filegroup holding the originals and compressed copies.
+      srcs: the asset files, in this package.
+      **kwargs: passed to the filegroup.
+    """
+    outs = []
+    for src in srcs:
+        outs.append(src + ".gz")
+        outs.append(src + ".br")
+    native.genrule(
+        name = name + "_compressed",
+        srcs = srcs,
+        outs = outs,
+        cmd = """
+for f in $(SRCS); do
+  out="$(RULEDIR)/$${f#%s/}"
+  mkdir -p "$$(dirname "$$out")"
+  gzip -9 -n -c "$$f" > "$$out.gz"
+  brotli -q 11 -c "$$f" > "$$out.br"
+done
+""" % native.package_name(),
+    )
+    native.filegroup(
+        name = name,
+        srcs = srcs + [":" + name + "_compressed"],
+        **kwargs
+    )
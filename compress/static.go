@@ -0,0 +1,82 @@
+package compress
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// extensions maps the codings FileServer serves to the suffix of their
+// precompressed files, in order of preference.
+var extensions = []struct{ coding, ext string }{
+	{Brotli, ".br"},
+	{Gzip, ".gz"},
+}
+
+// FileServer serves the files in fsys by their path relative to the
+// request path, which the caller strips of any prefix. When a request
+// accepts it and fsys holds a precompressed sibling (app.js.br or
+// app.js.gz next to app.js) that sibling is sent instead, with a
+// Content-Encoding. The uncompressed file must exist, as the fallback.
+// Directories aren't listed.
+func FileServer(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		info, err := fs.Stat(fsys, name)
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		addVary(w.Header())
+		if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+			w.Header().Set("Content-Type", ct)
+		}
+
+		var offered []string
+		for _, e := range extensions {
+			if _, err := fs.Stat(fsys, name+e.ext); err == nil {
+				offered = append(offered, e.coding)
+			}
+		}
+		file := name
+		if coding := Negotiate(r.Header.Get("Accept-Encoding"), offered...); coding != Identity {
+			for _, e := range extensions {
+				if e.coding == coding {
+					file = name + e.ext
+				}
+			}
+			w.Header().Set("Content-Encoding", coding)
+		}
+
+		f, err := fsys.Open(file)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		// ServeContent handles ranges and If-Modified-Since; the ETag
+		// differs per coding so caches don't mix them up.
+		w.Header().Set("ETag", etag(fi))
+		http.ServeContent(w, r, name, fi.ModTime(), content)
+	})
+}
+
+// etag derives a weak validator from the served file's modification time
+// and size.
+func etag(fi fs.FileInfo) string {
+	return `W/"` + strconv.FormatInt(fi.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(fi.Size(), 36) + `"`
+}
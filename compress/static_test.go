@@ -0,0 +1,78 @@
+package compress
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// TestFileServer checks that precompressed siblings are negotiated.
+func TestFileServer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":           {Data: []byte("plain js")},
+		"app.js.br":        {Data: []byte("brotli js")},
+		"app.js.gz":        {Data: []byte("gzip js")},
+		"css/site.css":     {Data: []byte("plain css")},
+		"css/site.css.gz":  {Data: []byte("gzip css")},
+		"orphan.txt.gz":    {Data: []byte("gzip only")},
+		"css/nested/x.svg": {Data: []byte("<svg/>")},
+	}
+	tests := []struct {
+		path, accept       string
+		status             int
+		encoding, body, ct string
+	}{
+		{"/app.js", "gzip, br", http.StatusOK, Brotli, "brotli js", "text/javascript; charset=utf-8"},
+		{"/app.js", "gzip", http.StatusOK, Gzip, "gzip js", "text/javascript; charset=utf-8"},
+		{"/app.js", "br;q=0.5, gzip", http.StatusOK, Gzip, "gzip js", "text/javascript; charset=utf-8"},
+		{"/app.js", "", http.StatusOK, "", "plain js", "text/javascript; charset=utf-8"},
+		{"/css/site.css", "br", http.StatusOK, "", "plain css", "text/css; charset=utf-8"},
+		{"/css/site.css", "br, gzip", http.StatusOK, Gzip, "gzip css", "text/css; charset=utf-8"},
+		{"/css/../app.js", "", http.StatusOK, "", "plain js", "text/javascript; charset=utf-8"},
+		{"/orphan.txt", "gzip", http.StatusNotFound, "", "", ""},
+		{"/css", "", http.StatusNotFound, "", "", ""},
+		{"/", "", http.StatusNotFound, "", "", ""},
+	}
+	h := FileServer(fsys)
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("GET %s (%s) = %d, want %d", tt.path, tt.accept, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		body, _ := io.ReadAll(rec.Body)
+		if got := rec.Header().Get("Content-Encoding"); got != tt.encoding || string(body) != tt.body {
+			t.Errorf("GET %s (%s) = %q encoded %q, want %q encoded %q", tt.path, tt.accept, body, got, tt.body, tt.encoding)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.ct {
+			t.Errorf("GET %s Content-Type = %q, want %q", tt.path, got, tt.ct)
+		}
+	}
+}
+
+// TestFileServerMiddleware checks that the middleware leaves precompressed
+// responses alone.
+func TestFileServerMiddleware(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":    {Data: make([]byte, 4*MinSize)},
+		"app.js.br": {Data: []byte("brotli js")},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+	Middleware(FileServer(fsys)).ServeHTTP(rec, req)
+	if got := rec.Header().Get("Content-Encoding"); got != Brotli || rec.Body.String() != "brotli js" {
+		t.Errorf("GET /app.js = %q encoded %q, want the .br file", rec.Body, got)
+	}
+	if got := rec.Header().Values("Vary"); len(got) != 1 {
+		t.Errorf("Vary = %q, want Accept-Encoding once", got)
+	}
+}
@@ -0,0 +1,52 @@
+// Package config holds the application's configuration plumbing on top of
+// viper.
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// Deprecation describes a configuration key that has been renamed. The old
+// key keeps working until the release named in RemovedIn.
+type Deprecation struct {
+	Old       string
+	New       string
+	RemovedIn string
+}
+
+func (d Deprecation) String() string {
+	return fmt.Sprintf("config key %q is deprecated and will be removed in %s; use %q instead", d.Old, d.RemovedIn, d.New)
+}
+
+// Deprecations lists renamed keys. When renaming a key, add an entry here
+// rather than breaking existing config files.
+var Deprecations = []Deprecation{}
+
+// ApplyDeprecations makes values set under deprecated keys visible under
+// their replacements and returns the deprecations that were in use. A
+// value set under the new key in the config file wins over the old key.
+func ApplyDeprecations(v *viper.Viper, deprecations []Deprecation) []Deprecation {
+	used := Lint(v, deprecations)
+	for _, d := range used {
+		if v.InConfig(d.New) {
+			continue
+		}
+		// A default keeps environment variables and flags for the new
+		// key in charge.
+		v.SetDefault(d.New, v.Get(d.Old))
+	}
+	return used
+}
+
+// Lint returns the deprecations whose old key is set in v.
+func Lint(v *viper.Viper, deprecations []Deprecation) []Deprecation {
+	var used []Deprecation
+	for _, d := range deprecations {
+		if v.IsSet(d.Old) {
+			used = append(used, d)
+		}
+	}
+	return used
+}
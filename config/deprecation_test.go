@@ -0,0 +1,36 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+var testDeprecations = []Deprecation{
+	{Old: "listen_port", New: "port", RemovedIn: "v2.0.0"},
+	{Old: "name", New: "app_name", RemovedIn: "v2.0.0"},
+}
+
+// TestApplyDeprecations checks that old keys still work and that the new
+// key wins when both are set.
+func TestApplyDeprecations(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader("listen_port: 6000\nname: old\napp_name: new\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetDefault("port", 5000)
+
+	used := ApplyDeprecations(v, testDeprecations)
+	if len(used) != 2 {
+		t.Fatalf("ApplyDeprecations returned %d deprecations, want 2", len(used))
+	}
+	if got := v.GetInt("port"); got != 6000 {
+		t.Errorf(`v.GetInt("port") = %d, want 6000`, got)
+	}
+	if got := v.GetString("app_name"); got != "new" {
+		t.Errorf(`v.GetString("app_name") = %q, want "new"`, got)
+	}
+}
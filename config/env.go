@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables settings can be set
+// through: BAZELDEMO_PORT sets port, and BAZELDEMO_CACHE_BACKEND sets
+// cache.backend.
+const EnvPrefix = "BAZELDEMO"
+
+var envReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// BindEnv makes every key of v settable through its environment variable,
+// EnvVar(key). They win over config files and defaults; flags win over
+// them. Only keys with a default or a config file value are found by
+// Unmarshal, so every key should have a default.
+func BindEnv(v *viper.Viper) {
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(envReplacer)
+	v.AutomaticEnv()
+}
+
+// EnvVar returns the environment variable that sets key.
+func EnvVar(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(envReplacer.Replace(key))
+}
+
+// FromEnv returns the keys of v whose environment variables are set,
+// sorted.
+func FromEnv(v *viper.Viper) []string {
+	var keys []string
+	for _, k := range v.AllKeys() {
+		if _, ok := os.LookupEnv(EnvVar(k)); ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
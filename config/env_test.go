@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// TestBindEnv checks that prefixed variables override defaults, nested
+// keys included, and are reported by FromEnv.
+func TestBindEnv(t *testing.T) {
+	t.Setenv("BAZELDEMO_PORT", "6000")
+	t.Setenv("BAZELDEMO_CACHE_BACKEND", "redis")
+	t.Setenv("BAZELDEMO_SHUTDOWN_TIMEOUT", "3s")
+	t.Setenv("PORT", "7000")
+
+	v := viper.New()
+	v.SetDefault("port", 5000)
+	v.SetDefault("cache.backend", "memory")
+	v.SetDefault("shutdown.timeout", 15*time.Second)
+	v.SetDefault("app_name", "bazel-demo-app")
+	BindEnv(v)
+
+	if got := v.GetInt("port"); got != 6000 {
+		t.Errorf("port = %d, want 6000", got)
+	}
+	if got := v.GetString("cache.backend"); got != "redis" {
+		t.Errorf("cache.backend = %q, want redis", got)
+	}
+	if got := v.GetDuration("shutdown.timeout"); got != 3*time.Second {
+		t.Errorf("shutdown.timeout = %s, want 3s", got)
+	}
+	if got := v.GetString("app_name"); got != "bazel-demo-app" {
+		t.Errorf("app_name = %q, want the default", got)
+	}
+	var c struct {
+		Port  int `mapstructure:"port"`
+		Cache struct {
+			Backend string `mapstructure:"backend"`
+		} `mapstructure:"cache"`
+	}
+	if err := v.Unmarshal(&c); err != nil || c.Port != 6000 || c.Cache.Backend != "redis" {
+		t.Errorf("Unmarshal = %+v, %v, want the environment values", c, err)
+	}
+	want := []string{"cache.backend", "port", "shutdown.timeout"}
+	if got := FromEnv(v); !reflect.DeepEqual(got, want) {
+		t.Errorf("FromEnv() = %v, want %v", got, want)
+	}
+}
+
+// TestEnvVar checks key to variable name mapping.
+func TestEnvVar(t *testing.T) {
+	for key, want := range map[string]string{
+		"port":                          "BAZELDEMO_PORT",
+		"server.max_connections_per_ip": "BAZELDEMO_SERVER_MAX_CONNECTIONS_PER_IP",
+		"profile-name":                  "BAZELDEMO_PROFILE_NAME",
+	} {
+		if got := EnvVar(key); got != want {
+			t.Errorf("EnvVar(%q) = %s, want %s", key, got, want)
+		}
+	}
+}
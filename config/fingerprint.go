@@ -0,0 +1,105 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var (
+	fingerprintInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "config_fingerprint_info",
+		Help: "Always 1, labelled with the fingerprint of the effective configuration. Replicas with different fingerprints have drifted.",
+	}, []string{"fingerprint"})
+	fingerprintChanged = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "config_fingerprint_changed",
+		Help: "1 when the configuration has changed since startup, 0 otherwise.",
+	})
+)
+
+// Fingerprint hashes the effective settings of v: every key with its
+// final value, whatever the source. Settings are hashed as JSON, whose
+// object keys are sorted, so equal configurations hash alike.
+func Fingerprint(v *viper.Viper) (string, error) {
+	data, err := json.Marshal(v.AllSettings())
+	if err != nil {
+		return "", fmt.Errorf("config: fingerprinting settings: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Fingerprints tracks the configuration fingerprint of the running
+// process, so config drift between replicas and since startup shows up in
+// /version and the config_fingerprint_* metrics. It is safe for
+// concurrent use.
+type Fingerprints struct {
+	v *viper.Viper
+
+	mu      sync.Mutex
+	startup string
+	current string
+}
+
+// FingerprintsSnapshot is the fingerprint at startup and now.
+type FingerprintsSnapshot struct {
+	Startup string `json:"startup"`
+	Current string `json:"current"`
+	Changed bool   `json:"changed"`
+}
+
+// NewFingerprints fingerprints v as the startup configuration.
+func NewFingerprints(v *viper.Viper) (*Fingerprints, error) {
+	fp, err := Fingerprint(v)
+	if err != nil {
+		return nil, err
+	}
+	fingerprintInfo.WithLabelValues(fp).Set(1)
+	fingerprintChanged.Set(0)
+	return &Fingerprints{v: v, startup: fp, current: fp}, nil
+}
+
+// Snapshot returns the startup and current fingerprints.
+func (f *Fingerprints) Snapshot() FingerprintsSnapshot {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return FingerprintsSnapshot{Startup: f.startup, Current: f.current, Changed: f.current != f.startup}
+}
+
+// Check re-fingerprints the configuration, as after a hot reload, and logs
+// a warning if it changed: the replica now differs from those that
+// haven't reloaded.
+func (f *Fingerprints) Check() {
+	fp, err := Fingerprint(f.v)
+	if err != nil {
+		logrus.WithError(err).Warn("config: fingerprinting reloaded configuration")
+		return
+	}
+	f.mu.Lock()
+	previous := f.current
+	f.current = fp
+	changed := fp != f.startup
+	f.mu.Unlock()
+	if fp == previous {
+		return
+	}
+	fingerprintInfo.DeleteLabelValues(previous)
+	fingerprintInfo.WithLabelValues(fp).Set(1)
+	if changed {
+		fingerprintChanged.Set(1)
+	} else {
+		fingerprintChanged.Set(0)
+	}
+	logrus.WithFields(logrus.Fields{
+		"previous": previous,
+		"current":  fp,
+		"startup":  f.startup,
+	}).Warn("configuration changed by reload; this replica may now differ from the rest of the fleet")
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// TestFingerprint checks that fingerprints depend on values, not on the
+// order keys were set in.
+func TestFingerprint(t *testing.T) {
+	a := viper.New()
+	a.SetDefault("port", 5000)
+	a.Set("cache.backend", "memory")
+	b := viper.New()
+	b.Set("cache.backend", "memory")
+	b.SetDefault("port", 5000)
+
+	fa, err := Fingerprint(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb, _ := Fingerprint(b); fa != fb {
+		t.Errorf("Fingerprint() = %s and %s for equal settings, want equal", fa, fb)
+	}
+	b.Set("port", 6000)
+	if fb, _ := Fingerprint(b); fa == fb {
+		t.Errorf("Fingerprint() = %s after changing port, want a different fingerprint", fb)
+	}
+}
+
+// TestFingerprintsCheck checks that a change is reported after a reload
+// and cleared when the configuration goes back.
+func TestFingerprintsCheck(t *testing.T) {
+	v := viper.New()
+	v.Set("port", 5000)
+	f, err := NewFingerprints(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Snapshot(); s.Changed || s.Startup != s.Current {
+		t.Errorf("Snapshot() at startup = %+v, want unchanged", s)
+	}
+
+	v.Set("port", 6000)
+	f.Check()
+	if s := f.Snapshot(); !s.Changed || s.Startup == s.Current {
+		t.Errorf("Snapshot() after change = %+v, want changed", s)
+	}
+
+	v.Set("port", 5000)
+	f.Check()
+	if s := f.Snapshot(); s.Changed {
+		t.Errorf("Snapshot() after reverting = %+v, want unchanged", s)
+	}
+}
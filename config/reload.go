@@ -0,0 +1,153 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Results counted in config_reloads_total.
+const (
+	ReloadApplied = "applied"
+	// ReloadInvalid is a reload whose configuration failed validation;
+	// nothing was applied.
+	ReloadInvalid = "invalid"
+	// ReloadFailed is a reload where a hook returned an error.
+	ReloadFailed = "failed"
+)
+
+var reloads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "config_reloads_total",
+	Help: "Configuration reloads that changed settings, by result.",
+}, []string{"result"})
+
+// Reloader applies reloaded configuration to running components. Each
+// component registers a hook for the keys it can take live; after a
+// reload, the hooks whose keys changed run, and changed keys no hook
+// covers are logged as needing a restart, rather than silently ignored.
+type Reloader struct {
+	v *viper.Viper
+	// Validate, when set, checks a reloaded configuration before any hook
+	// runs. If it fails no hook runs.
+	Validate func(*viper.Viper) error
+
+	mu    sync.Mutex
+	last  map[string]any
+	hooks []reloadHook
+}
+
+type reloadHook struct {
+	name  string
+	keys  []string
+	apply func(*viper.Viper) error
+}
+
+// NewReloader returns a reloader for v, taking its current settings as
+// the baseline later reloads are compared with.
+func NewReloader(v *viper.Viper) *Reloader {
+	return &Reloader{v: v, last: settings(v)}
+}
+
+// Handle registers apply as the hook of component name for keys. A key
+// covers the keys below it, so "clients" covers "clients.rate_limit".
+func (r *Reloader) Handle(name string, apply func(*viper.Viper) error, keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, reloadHook{name: name, keys: keys, apply: apply})
+}
+
+// Reload compares the settings with the last reload and applies the
+// changes. It returns the keys that changed, sorted. Call it after viper
+// has re-read the config file.
+func (r *Reloader) Reload() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := settings(r.v)
+	changed := diff(r.last, current)
+	if len(changed) == 0 {
+		return nil
+	}
+	if r.Validate != nil {
+		if err := r.Validate(r.v); err != nil {
+			reloads.WithLabelValues(ReloadInvalid).Inc()
+			logrus.WithError(err).WithField("changed", changed).Error("config: reloaded configuration is invalid; not applying it")
+			return changed
+		}
+	}
+	r.last = current
+
+	result := ReloadApplied
+	covered := make(map[string]bool)
+	for _, h := range r.hooks {
+		var hit []string
+		for _, k := range changed {
+			if covers(h.keys, k) {
+				hit = append(hit, k)
+				covered[k] = true
+			}
+		}
+		if len(hit) == 0 {
+			continue
+		}
+		entry := logrus.WithFields(logrus.Fields{"component": h.name, "keys": hit})
+		if err := h.apply(r.v); err != nil {
+			result = ReloadFailed
+			entry.WithError(err).Error("config: applying reloaded configuration")
+			continue
+		}
+		entry.Info("config: applied reloaded configuration")
+	}
+	var restart []string
+	for _, k := range changed {
+		if !covered[k] {
+			restart = append(restart, k)
+		}
+	}
+	if len(restart) > 0 {
+		logrus.WithField("keys", restart).Warn("config: changed keys can't be applied live; restart to apply them")
+	}
+	reloads.WithLabelValues(result).Inc()
+	return changed
+}
+
+// settings returns every key of v with its value.
+func settings(v *viper.Viper) map[string]any {
+	out := make(map[string]any)
+	for _, k := range v.AllKeys() {
+		out[k] = v.Get(k)
+	}
+	return out
+}
+
+// diff returns the keys whose values differ between a and b, sorted.
+func diff(a, b map[string]any) []string {
+	var keys []string
+	for k, v := range b {
+		if old, ok := a[k]; !ok || !reflect.DeepEqual(old, v) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// covers reports whether key is one of keys or below one of them.
+func covers(keys []string, key string) bool {
+	for _, k := range keys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// TestReloader checks that hooks run only for the keys they cover, that
+// uncovered changes are still reported, and that invalid configurations
+// apply nothing.
+func TestReloader(t *testing.T) {
+	v := viper.New()
+	v.Set("debug", false)
+	v.Set("clients.rate_limit", 10)
+	v.Set("port", 5000)
+	r := NewReloader(v)
+	applied := map[string]int{}
+	r.Handle("logging", func(*viper.Viper) error { applied["logging"]++; return nil }, "debug")
+	r.Handle("clients", func(*viper.Viper) error { applied["clients"]++; return nil }, "clients")
+	valid := true
+	r.Validate = func(*viper.Viper) error {
+		if !valid {
+			return errors.New("invalid")
+		}
+		return nil
+	}
+
+	if changed := r.Reload(); changed != nil {
+		t.Errorf("Reload() with no change = %v, want nil", changed)
+	}
+
+	v.Set("clients.rate_limit", 20)
+	v.Set("clients.burst", 5)
+	v.Set("port", 6000)
+	want := []string{"clients.burst", "clients.rate_limit", "port"}
+	if changed := r.Reload(); !reflect.DeepEqual(changed, want) {
+		t.Errorf("Reload() = %v, want %v", changed, want)
+	}
+	if !reflect.DeepEqual(applied, map[string]int{"clients": 1}) {
+		t.Errorf("hooks run = %v, want clients once", applied)
+	}
+
+	valid = false
+	v.Set("debug", true)
+	r.Reload()
+	if applied["logging"] != 0 {
+		t.Error("logging hook ran for an invalid configuration")
+	}
+	valid = true
+	if changed := r.Reload(); !reflect.DeepEqual(changed, []string{"debug"}) || applied["logging"] != 1 {
+		t.Errorf("Reload() once valid = %v, logging run %d times, want [debug] and once", changed, applied["logging"])
+	}
+}
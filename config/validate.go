@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/spf13/viper"
+)
+
+// Formats lists the config file extensions Load reads.
+var Formats = []string{".json", ".toml", ".yaml", ".yml"}
+
+// Load reads the config file at path into v, refusing formats other than
+// Formats so a typo'd extension doesn't fall back to defaults silently.
+func Load(v *viper.Viper, path string) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	known := false
+	for _, f := range Formats {
+		known = known || ext == f
+	}
+	if !known {
+		return fmt.Errorf("config %s: unsupported format %q, want one of %s", path, ext, strings.Join(Formats, ", "))
+	}
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+// InvalidError lists the fields of a configuration that failed
+// validation, one per line.
+type InvalidError struct {
+	Fields []string
+}
+
+func (e *InvalidError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Fields, "\n  ")
+}
+
+// Decode unmarshals v's settings into out, a pointer to a struct with
+// mapstructure and validate tags, and validates it. Validation failures
+// are an *InvalidError naming each field by its config key.
+func Decode(v *viper.Viper, out any) error {
+	if err := v.Unmarshal(out); err != nil {
+		return fmt.Errorf("decoding configuration: %w", err)
+	}
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if name == "" || name == "-" {
+			return f.Name
+		}
+		return name
+	})
+	err := validate.Struct(out)
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return err
+	}
+	invalid := &InvalidError{}
+	for _, fe := range verrs {
+		invalid.Fields = append(invalid.Fields, describe(fe))
+	}
+	return invalid
+}
+
+// describe explains one failed rule.
+func describe(fe validator.FieldError) string {
+	// Namespace is Config.server.port; drop the struct name.
+	_, key, _ := strings.Cut(fe.Namespace(), ".")
+	var rule string
+	switch fe.Tag() {
+	case "required":
+		return key + ": is required"
+	case "min":
+		rule = "must be at least " + fe.Param()
+	case "max":
+		rule = "must be at most " + fe.Param()
+	case "oneof":
+		rule = "must be one of " + fe.Param()
+	default:
+		rule = "fails " + fe.Tag()
+		if fe.Param() != "" {
+			rule += "=" + fe.Param()
+		}
+	}
+	return fmt.Sprintf("%s: %s (got %v)", key, rule, fe.Value())
+}
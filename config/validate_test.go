@@ -0,0 +1,105 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/fixtures"
+)
+
+type testConfig struct {
+	AppName string `mapstructure:"app_name" validate:"required"`
+	Port    int    `mapstructure:"port" validate:"required,min=1000,max=65535"`
+	Cache   struct {
+		Backend string `mapstructure:"backend" validate:"oneof=memory redis"`
+	} `mapstructure:"cache"`
+}
+
+// TestLoadDecode checks each supported format and the fields reported
+// invalid.
+func TestLoadDecode(t *testing.T) {
+	tests := []struct {
+		file, content string
+		want          []string
+	}{
+		{"ok.yaml", "app_name: demo\nport: 5000\ncache:\n  backend: redis\n", nil},
+		{"ok.json", `{"app_name": "demo", "port": 5000, "cache": {"backend": "memory"}}`, nil},
+		{"ok.toml", "app_name = \"demo\"\nport = 5000\n[cache]\nbackend = \"memory\"\n", nil},
+		{"bad.yml", "port: 80\ncache:\n  backend: disk\n", []string{
+			"app_name: is required",
+			"port: must be at least 1000 (got 80)",
+			"cache.backend: must be one of memory redis (got disk)",
+		}},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		v := viper.New()
+		if err := Load(v, path); err != nil {
+			t.Errorf("Load(%s) = %v", tt.file, err)
+			continue
+		}
+		var c testConfig
+		err := Decode(v, &c)
+		var invalid *InvalidError
+		switch {
+		case tt.want == nil && err != nil:
+			t.Errorf("Decode(%s) = %v, want nil", tt.file, err)
+		case tt.want != nil && !errors.As(err, &invalid):
+			t.Errorf("Decode(%s) = %v, want an *InvalidError", tt.file, err)
+		case tt.want != nil && !reflect.DeepEqual(invalid.Fields, tt.want):
+			t.Errorf("Decode(%s) fields = %q, want %q", tt.file, invalid.Fields, tt.want)
+		}
+	}
+}
+
+// TestLoadFormat checks that unknown extensions are refused.
+func TestLoadFormat(t *testing.T) {
+	err := Load(viper.New(), "app.conf")
+	if err == nil || !strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("Load(app.conf) = %v, want unsupported format", err)
+	}
+}
+
+// serverConfig mirrors the server's Config in cmd.
+type serverConfig struct {
+	AppName string `mapstructure:"app_name" validate:"required"`
+	Port    int    `mapstructure:"port" validate:"required,min=1000,max=65535"`
+	Debug   bool   `mapstructure:"debug"`
+}
+
+// TestDecodeCorpus decodes the corpus config files: the valid ones in
+// each format to the same settings, and the invalid one to the errors in
+// its golden file.
+func TestDecodeCorpus(t *testing.T) {
+	want := serverConfig{AppName: "bazel-demo-app", Port: 8080}
+	for _, name := range []string{"config/valid.yaml", "config/valid.json", "config/valid.toml"} {
+		v := viper.New()
+		if err := Load(v, fixtures.Path(t, name)); err != nil {
+			t.Errorf("Load(%s) = %v", name, err)
+			continue
+		}
+		var got serverConfig
+		if err := Decode(v, &got); err != nil || got != want {
+			t.Errorf("Decode(%s) = %+v, %v, want %+v", name, got, err, want)
+		}
+	}
+
+	v := viper.New()
+	if err := Load(v, fixtures.Path(t, "config/invalid.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	err := Decode(v, &serverConfig{})
+	if err == nil {
+		t.Fatal("Decode(invalid.yaml) = nil, want an error")
+	}
+	fixtures.Golden(t, "config/invalid.txt", []byte(err.Error()+"\n"))
+}
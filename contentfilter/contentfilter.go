@@ -0,0 +1,237 @@
+// Package contentfilter rejects offensive names and messages before they
+// are stored or echoed back. Text is matched against wordlists and, when
+// one is configured, sent to an external moderation API whose verdicts
+// are cached.
+package contentfilter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/bazel"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+)
+
+// Rejection sources.
+const (
+	SourceWordlist   = "wordlist"
+	SourceModeration = "moderation"
+)
+
+// ErrUnavailable is returned when the moderation API can't be reached by
+// a filter that fails closed.
+var ErrUnavailable = errors.New("contentfilter: moderation unavailable")
+
+// DefaultCacheTTL is how long moderation verdicts are cached by default.
+const DefaultCacheTTL = time.Hour
+
+var (
+	rejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "contentfilter_rejections_total",
+		Help: "User-supplied text rejected by the content filter, by field and by what rejected it.",
+	}, []string{"field", "source"})
+	moderationErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "contentfilter_moderation_errors_total",
+		Help: "Moderation API calls that failed; the text was let through if moderation fails open.",
+	})
+)
+
+// Rejection is the error for rejected text. It doesn't say which word
+// matched, so callers can show it.
+type Rejection struct {
+	// Field is what was rejected, such as "name".
+	Field string
+	// Source is SourceWordlist or SourceModeration.
+	Source string
+}
+
+func (r *Rejection) Error() string {
+	return r.Field + " contains language that isn't allowed"
+}
+
+// Config sets up a Filter.
+type Config struct {
+	// Words are rejected wherever they appear as whole words, whatever
+	// their case.
+	Words []string
+	// Wordlists are files of further words, one per line, with blank
+	// lines and lines starting with # skipped. Under Bazel, relative paths
+	// are runfiles, such as a wordlist in a filegroup of the binary's data.
+	Wordlists []string
+	// ModerationURL, if set, is POSTed {"text": ...} for text no wordlist
+	// rejects, and answers {"flagged": true} for text to reject.
+	ModerationURL string
+	// ModerationToken is sent as a bearer token, if set.
+	ModerationToken string
+	// ModerationTimeout bounds each call; zero means 2s.
+	ModerationTimeout time.Duration
+	// CacheSize and CacheTTL bound the cached moderation verdicts. Zero
+	// means 10000 and DefaultCacheTTL.
+	CacheSize int
+	CacheTTL  time.Duration
+	// FailClosed rejects text when the moderation API can't be reached,
+	// rather than letting it through.
+	FailClosed bool
+}
+
+// Filter checks text against wordlists and an optional moderation API. A
+// nil Filter lets everything through.
+type Filter struct {
+	words      *regexp.Regexp
+	url, token string
+	failClosed bool
+	client     *http.Client
+	verdicts   cache.Cache
+}
+
+// New returns a filter for cfg, reading its wordlists.
+func New(cfg Config) (*Filter, error) {
+	words := append([]string(nil), cfg.Words...)
+	for _, path := range cfg.Wordlists {
+		list, err := readWordlist(path)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, list...)
+	}
+
+	f := &Filter{url: cfg.ModerationURL, token: cfg.ModerationToken, failClosed: cfg.FailClosed}
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) > 0 {
+		f.words = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+	if f.url != "" {
+		timeout := cfg.ModerationTimeout
+		if timeout <= 0 {
+			timeout = 2 * time.Second
+		}
+		size, ttl := cfg.CacheSize, cfg.CacheTTL
+		if size <= 0 {
+			size = 10000
+		}
+		if ttl <= 0 {
+			ttl = DefaultCacheTTL
+		}
+		f.client = &http.Client{Timeout: timeout}
+		f.verdicts = cache.NewLRU(size, 0, ttl)
+	}
+	return f, nil
+}
+
+// readWordlist reads the words of the file at path.
+func readWordlist(path string) ([]string, error) {
+	if bazel.BuiltWithBazel() && !filepath.IsAbs(path) {
+		resolved, err := bazel.Runfile(path)
+		if err != nil {
+			return nil, fmt.Errorf("contentfilter: wordlist %s: %w", path, err)
+		}
+		path = resolved
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("contentfilter: %w", err)
+	}
+	defer file.Close()
+	var words []string
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("contentfilter: wordlist %s: %w", path, err)
+	}
+	return words, nil
+}
+
+// Check returns a *Rejection if text, the value of field, must be
+// rejected, and ErrUnavailable if moderation failed and the filter fails
+// closed.
+func (f *Filter) Check(ctx context.Context, field, text string) error {
+	if f == nil || text == "" {
+		return nil
+	}
+	source := ""
+	if f.words != nil && f.words.MatchString(text) {
+		source = SourceWordlist
+	} else if f.url != "" {
+		flagged, err := f.moderate(ctx, text)
+		if err != nil {
+			moderationErrors.Inc()
+			logrus.WithContext(ctx).WithError(err).Warn("contentfilter: moderation API failed")
+			if f.failClosed {
+				return fmt.Errorf("%w: checking %s: %v", ErrUnavailable, field, err)
+			}
+			return nil
+		}
+		if flagged {
+			source = SourceModeration
+		}
+	}
+	if source == "" {
+		return nil
+	}
+	rejections.WithLabelValues(field, source).Inc()
+	return &Rejection{Field: field, Source: source}
+}
+
+// moderate asks the moderation API whether text is flagged, remembering
+// the answer.
+func (f *Filter) moderate(ctx context.Context, text string) (bool, error) {
+	sum := sha256.Sum256([]byte(text))
+	key := "contentfilter:" + hex.EncodeToString(sum[:])
+	if v, ok, err := f.verdicts.Get(ctx, key); err == nil && ok {
+		return v.(bool), nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"text": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return false, fmt.Errorf("%s: %s: %s", f.url, resp.Status, msg)
+	}
+	var verdict struct {
+		Flagged bool `json:"flagged"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return false, fmt.Errorf("%s: decoding verdict: %w", f.url, err)
+	}
+	f.verdicts.Set(ctx, key, verdict.Flagged, 0)
+	return verdict.Flagged, nil
+}
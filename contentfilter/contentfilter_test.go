@@ -0,0 +1,89 @@
+package contentfilter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestWordlists checks that words from config and wordlist files reject
+// text only as whole words.
+func TestWordlists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# mild\n\nheck\n  darn  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(Config{Words: []string{"gosh"}, Wordlists: []string{path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for text, rejected := range map[string]bool{
+		"Gladys":          false,
+		"Oh GOSH, Gladys": true,
+		"Darn":            true,
+		"what the heck":   true,
+		"Heckler":         false,
+		"# mild":          false,
+	} {
+		err := f.Check(ctx, "name", text)
+		var rej *Rejection
+		if got := errors.As(err, &rej); got != rejected || (got && rej.Source != SourceWordlist) {
+			t.Errorf("Check(%q) = %v, want rejected %v", text, err, rejected)
+		}
+	}
+	if err := (*Filter)(nil).Check(ctx, "name", "darn"); err != nil {
+		t.Errorf("nil Check() = %v, want nil", err)
+	}
+
+	if _, err := New(Config{Wordlists: []string{filepath.Join(t.TempDir(), "missing.txt")}}); err == nil {
+		t.Error("New() with a missing wordlist = nil error, want one")
+	}
+}
+
+// TestModeration checks that the moderation API's verdicts are cached,
+// and that failures let text through unless the filter fails closed.
+func TestModeration(t *testing.T) {
+	var calls atomic.Int32
+	down := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if down || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var in struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&in)
+		json.NewEncoder(w).Encode(map[string]bool{"flagged": in.Text == "Rude"})
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	f, _ := New(Config{ModerationURL: srv.URL, ModerationToken: "secret"})
+	var rej *Rejection
+	if err := f.Check(ctx, "message", "Rude"); !errors.As(err, &rej) || rej.Source != SourceModeration || rej.Field != "message" {
+		t.Errorf("Check(Rude) = %v, want a moderation rejection of message", err)
+	}
+	if err := f.Check(ctx, "message", "Kind"); err != nil {
+		t.Errorf("Check(Kind) = %v, want nil", err)
+	}
+	f.Check(ctx, "message", "Rude")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("moderation API called %d times, want 2 with verdicts cached", n)
+	}
+
+	down = true
+	if err := f.Check(ctx, "message", "Other"); err != nil {
+		t.Errorf("Check() failing open = %v, want nil", err)
+	}
+	closed, _ := New(Config{ModerationURL: srv.URL, ModerationToken: "secret", FailClosed: true})
+	if err := closed.Check(ctx, "message", "Other"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Check() failing closed = %v, want ErrUnavailable", err)
+	}
+}
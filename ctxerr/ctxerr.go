@@ -0,0 +1,111 @@
+// Package ctxerr tells apart the ways a context can end, so that a client
+// hanging up, a server-side deadline firing and the server canceling work
+// itself, such as at shutdown, show up separately in logs and metrics.
+package ctxerr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/server"
+)
+
+// Reasons returned by Classify.
+const (
+	ClientCanceled   = "client_canceled"
+	DeadlineExceeded = "deadline_exceeded"
+	// Canceled is work the server canceled itself: at shutdown, when a
+	// request's handler is done with a context of its own, or in the
+	// background.
+	Canceled = "canceled"
+)
+
+var contextErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "context_errors_total",
+	Help: "Operations that stopped because their context ended, by component and reason.",
+}, []string{"component", "reason"})
+
+type requestKey struct{}
+
+// Classify returns why err, from work done under ctx, was caused by a
+// context ending, and "" if it wasn't. Only a request context canceled
+// while the server wasn't shutting down, as net/http does when the client
+// goes away, is ClientCanceled; that needs ctx to descend from one that
+// passed through Middleware. Other cancellations are Canceled.
+func Classify(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	case !errors.Is(err, context.Canceled):
+		return ""
+	case clientGone(ctx):
+		return ClientCanceled
+	}
+	return Canceled
+}
+
+// clientGone reports whether the request ctx belongs to was canceled from
+// outside the server, by its client.
+func clientGone(ctx context.Context) bool {
+	req, ok := ctx.Value(requestKey{}).(context.Context)
+	if !ok || req.Err() == nil || context.Cause(req) != context.Canceled {
+		return false
+	}
+	select {
+	case <-server.Draining(req):
+		return false
+	default:
+		return true
+	}
+}
+
+// Record logs and counts err, from work done under ctx, if it was caused
+// by a context ending. It reports whether it did.
+func Record(ctx context.Context, component string, err error) bool {
+	reason := Classify(ctx, err)
+	if reason == "" {
+		return false
+	}
+	contextErrors.WithLabelValues(component, reason).Inc()
+	logrus.WithFields(logrus.Fields{
+		"component": component,
+		"reason":    reason,
+	}).Warn("operation stopped by context")
+	return true
+}
+
+// Middleware marks request contexts, so Classify can tell their client
+// hanging up from the server canceling, and records requests whose
+// context ended before the handler returned, which is how a client
+// disconnect or a request timeout looks from the server side.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestKey{}, r.Context())
+		next.ServeHTTP(w, r.WithContext(ctx))
+		if err := ctx.Err(); err != nil {
+			Record(ctx, "http", err)
+		}
+	})
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// MissingContext returns the methods of the interface type iface whose
+// first parameter is not a context.Context. Packages call it from tests
+// to keep their storage, cache, and client interfaces cancelable.
+func MissingContext(iface reflect.Type) []string {
+	var missing []string
+	for i := 0; i < iface.NumMethod(); i++ {
+		m := iface.Method(i)
+		if m.Type.NumIn() == 0 || m.Type.In(0) != contextType {
+			missing = append(missing, m.Name)
+		}
+	}
+	return missing
+}
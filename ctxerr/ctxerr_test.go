@@ -0,0 +1,40 @@
+package ctxerr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestClassify checks that only a request's own context ending counts as
+// its client hanging up, not the server canceling work itself.
+func TestClassify(t *testing.T) {
+	background, cancel := context.WithCancel(context.Background())
+	cancel()
+	if got := Classify(background, background.Err()); got != Canceled {
+		t.Errorf("Classify(background job) = %q, want %q", got, Canceled)
+	}
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if got := Classify(expired, expired.Err()); got != DeadlineExceeded {
+		t.Errorf("Classify(deadline) = %q, want %q", got, DeadlineExceeded)
+	}
+
+	var own, client string
+	parent, hangUp := context.WithCancel(context.Background())
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		cancel()
+		own = Classify(ctx, ctx.Err())
+		hangUp()
+		client = Classify(r.Context(), r.Context().Err())
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(parent))
+	if own != Canceled {
+		t.Errorf("Classify(handler's own context) = %q, want %q", own, Canceled)
+	}
+	if client != ClientCanceled {
+		t.Errorf("Classify(request context) = %q, want %q", client, ClientCanceled)
+	}
+}
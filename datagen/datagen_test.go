@@ -0,0 +1,59 @@
+package datagen
+
+import (
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestDeterministic checks that generators with the same seed produce the
+// same data, and that different seeds produce different data.
+func TestDeterministic(t *testing.T) {
+	a, b, other := New(7), New(7), New(8)
+	ga, gb, gother := a.Greetings(20), b.Greetings(20), other.Greetings(20)
+	if !reflect.DeepEqual(ga, gb) {
+		t.Errorf("Greetings(20) with seed 7 differs between generators:\n%v\n%v", ga, gb)
+	}
+	if reflect.DeepEqual(ga, gother) {
+		t.Error("Greetings(20) is the same for seeds 7 and 8")
+	}
+	if pa, pb := a.People(5), b.People(5); !reflect.DeepEqual(pa, pb) {
+		t.Errorf("People(5) with seed 7 differs between generators:\n%v\n%v", pa, pb)
+	}
+}
+
+// TestStable pins the first values of seed 1, so a change that reorders
+// or alters the output, and so every dataset built on it, is noticed.
+func TestStable(t *testing.T) {
+	g := New(1)
+	got := []string{g.Name(), g.Tenant(), g.Greeting().Message}
+	want := []string{"Zofia Costa", "river-summit-28", "Hi, Yusuf Usman. Welcome!"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("seed 1 = %q, want %q", got, want)
+	}
+}
+
+var tenantPattern = regexp.MustCompile(`^[a-z]+-[a-z]+-[0-9]{1,2}$`)
+
+// TestValues checks the shape of generated values.
+func TestValues(t *testing.T) {
+	g := New(3)
+	for i := 0; i < 200; i++ {
+		p := g.Person()
+		addr, err := mail.ParseAddress(p.Email)
+		if err != nil {
+			t.Errorf("Person().Email = %q: %v", p.Email, err)
+		} else if _, domain, _ := strings.Cut(addr.Address, "@"); !slices.Contains(domains, domain) {
+			t.Errorf("Person().Email = %q, want an example domain", p.Email)
+		}
+		if tenant := g.Tenant(); !tenantPattern.MatchString(tenant) {
+			t.Errorf("Tenant() = %q, want a word-word-number slug", tenant)
+		}
+		if gr := g.Greeting(); !strings.Contains(gr.Message, gr.Name) {
+			t.Errorf("Greeting() = %+v, want the name in the message", gr)
+		}
+	}
+}
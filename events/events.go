@@ -0,0 +1,73 @@
+// Package events is an in-process event bus. Resources publish changes to
+// it and integrations such as webhooks subscribe.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types published by the application.
+const (
+	GreetingCreated = "greeting.created"
+	GreetingUpdated = "greeting.updated"
+	GreetingDeleted = "greeting.deleted"
+	PresenceOnline  = "presence.online"
+	PresenceOffline = "presence.offline"
+	TrafficAnomaly  = "traffic.anomaly"
+)
+
+// Event is something that happened.
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// New returns an event of type typ carrying data, with a fresh ID.
+func New(typ string, data interface{}) Event {
+	return Event{ID: uuid.NewString(), Type: typ, Time: time.Now().UTC(), Data: data}
+}
+
+// Handler receives published events. Handlers run synchronously on the
+// publishing goroutine, so anything slow must hand off to its own
+// goroutine.
+type Handler func(ctx context.Context, e Event)
+
+// Bus fans events out to subscribers.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus returns a Bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers h for every event.
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish sends an event of type typ carrying data to every subscriber and
+// returns it. A nil Bus drops events, so publishers don't need to check.
+func (b *Bus) Publish(ctx context.Context, typ string, data interface{}) Event {
+	e := New(typ, data)
+	if b == nil {
+		return e
+	}
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(ctx, e)
+	}
+	return e
+}
@@ -0,0 +1,56 @@
+// Package features reports which optional subsystems were compiled in.
+// Each sits behind a Go build tag of its name, so minimal builds leave out
+// its code and heavy dependencies:
+//
+//	go build -tags grpc,s3 ./cmd
+//	bazel build --config=full //cmd
+//
+// Code belonging to a subsystem goes in files with its build tag and
+// registers the subsystem from init.
+package features
+
+import (
+	"slices"
+	"sync"
+)
+
+// The optional subsystems, by build tag.
+const (
+	GRPC  = "grpc"
+	Kafka = "kafka"
+	OIDC  = "oidc"
+	S3    = "s3"
+)
+
+// All lists every optional subsystem, compiled in or not.
+var All = []string{GRPC, Kafka, OIDC, S3}
+
+var (
+	mu       sync.Mutex
+	compiled []string
+)
+
+// register records that the subsystem name is compiled in.
+func register(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Contains(compiled, name) {
+		compiled = append(compiled, name)
+		slices.Sort(compiled)
+	}
+}
+
+// Compiled returns the subsystems compiled in, sorted. It is empty, not
+// nil, in a minimal build.
+func Compiled() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string{}, compiled...)
+}
+
+// Enabled reports whether the subsystem name is compiled in.
+func Enabled(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return slices.Contains(compiled, name)
+}
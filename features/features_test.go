@@ -0,0 +1,26 @@
+package features
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestCompiled checks that only registered subsystems are reported, in
+// order, whatever tags the test was built with.
+func TestCompiled(t *testing.T) {
+	got := Compiled()
+	if got == nil {
+		t.Fatal("Compiled() = nil, want an empty list at least")
+	}
+	if !slices.IsSorted(got) {
+		t.Errorf("Compiled() = %v, want it sorted", got)
+	}
+	for _, name := range All {
+		if Enabled(name) != slices.Contains(got, name) {
+			t.Errorf("Enabled(%s) = %v, but Compiled() = %v", name, Enabled(name), got)
+		}
+	}
+	if slices.ContainsFunc(got, func(name string) bool { return !slices.Contains(All, name) }) {
+		t.Errorf("Compiled() = %v, want only names from All", got)
+	}
+}
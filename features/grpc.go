@@ -0,0 +1,5 @@
+//go:build grpc
+
+package features
+
+func init() { register(GRPC) }
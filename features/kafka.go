@@ -0,0 +1,5 @@
+//go:build kafka
+
+package features
+
+func init() { register(Kafka) }
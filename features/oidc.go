@@ -0,0 +1,5 @@
+//go:build oidc
+
+package features
+
+func init() { register(OIDC) }
@@ -0,0 +1,5 @@
+//go:build s3
+
+package features
+
+func init() { register(S3) }
@@ -0,0 +1,350 @@
+// Package fieldcrypt encrypts sensitive fields, such as email addresses
+// and webhook secrets, before they reach storage. Models mark the fields
+// with an `encrypt:"true"` struct tag; a Store registered with the model
+// of a collection seals those fields of each record it writes and opens
+// them again on reads, so code above it sees plaintext and the backend
+// never does.
+//
+// Encryption is by envelope: each value gets a fresh AES-256-GCM data key,
+// which is itself sealed with a key-encryption key from the Keyring and
+// stored alongside. Sealed values name the version of the key that
+// sealed them, so keys can be rotated: a new primary key seals every
+// write, older keys still open what they sealed, and Rotate re-seals old
+// values in the background until the old keys can be dropped.
+package fieldcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Tag is the struct tag marking fields to encrypt, as `encrypt:"true"`.
+const Tag = "encrypt"
+
+// prefix starts sealed values: "enc:<version>:<sealed data key>:<sealed
+// value>", both sealed parts base64url-encoded.
+const prefix = "enc:"
+
+// ErrUnknownKey is returned for values sealed with a key version the
+// keyring doesn't hold.
+var ErrUnknownKey = errors.New("fieldcrypt: value sealed with an unknown key version")
+
+var (
+	reencrypted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fieldcrypt_reencrypted_records_total",
+		Help: "Records whose fields were re-sealed with the primary key, by collection.",
+	}, []string{"collection"})
+	openErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fieldcrypt_open_errors_total",
+		Help: "Sealed fields that failed to open on read, by collection.",
+	}, []string{"collection"})
+)
+
+// Keyring holds the key-encryption keys by version.
+type Keyring struct {
+	// Primary is the version new values are sealed with.
+	Primary string
+	// Keys are 32-byte AES-256 keys by version. Keep a retired version
+	// until Rotate has re-sealed everything it sealed.
+	Keys map[string][]byte
+}
+
+// Check reports keyrings that can't seal: a missing primary key, keys of
+// the wrong size, and versions that can't appear in a sealed value.
+func (k Keyring) Check() error {
+	if _, ok := k.Keys[k.Primary]; !ok {
+		return fmt.Errorf("fieldcrypt: primary key %q is not configured", k.Primary)
+	}
+	for version, key := range k.Keys {
+		if version == "" || strings.Contains(version, ":") {
+			return fmt.Errorf("fieldcrypt: key version %q must be non-empty and free of colons", version)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("fieldcrypt: key %q is %d bytes, want 32", version, len(key))
+		}
+	}
+	return nil
+}
+
+// Fields returns the JSON names of the fields of model, a struct or
+// pointer to one, tagged for encryption.
+func Fields(model interface{}) []string {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get(Tag) != "true" {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// seal returns raw, a JSON value, sealed with the primary key as a JSON
+// string. aad binds it to where it is stored.
+func (k Keyring) seal(raw json.RawMessage, aad string) (json.RawMessage, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	value, err := gcmSeal(dek, raw, aad)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := gcmSeal(k.Keys[k.Primary], dek, k.Primary)
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.RawURLEncoding
+	return json.Marshal(prefix + k.Primary + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(value))
+}
+
+// open returns the JSON value raw sealed, and the version of the key that
+// sealed it. Values that aren't sealed are returned as they are, with no
+// version.
+func (k Keyring) open(raw json.RawMessage, aad string) (json.RawMessage, string, error) {
+	var s string
+	if json.Unmarshal(raw, &s) != nil || !strings.HasPrefix(s, prefix) {
+		return raw, "", nil
+	}
+	parts := strings.Split(strings.TrimPrefix(s, prefix), ":")
+	if len(parts) != 3 {
+		return nil, "", errors.New("fieldcrypt: malformed sealed value")
+	}
+	version := parts[0]
+	kek, ok := k.Keys[version]
+	if !ok {
+		return nil, version, ErrUnknownKey
+	}
+	enc := base64.RawURLEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, version, fmt.Errorf("fieldcrypt: malformed data key: %w", err)
+	}
+	value, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, version, fmt.Errorf("fieldcrypt: malformed value: %w", err)
+	}
+	dek, err := gcmOpen(kek, wrapped, version)
+	if err != nil {
+		return nil, version, fmt.Errorf("fieldcrypt: opening data key: %w", err)
+	}
+	plain, err := gcmOpen(dek, value, aad)
+	if err != nil {
+		return nil, version, fmt.Errorf("fieldcrypt: opening value: %w", err)
+	}
+	return plain, version, nil
+}
+
+// gcmSeal encrypts plain with key, returning the nonce and ciphertext.
+func gcmSeal(key, plain []byte, aad string) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, []byte(aad)), nil
+}
+
+// gcmOpen decrypts what gcmSeal returned.
+func gcmOpen(key, sealed []byte, aad string) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(aad))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Store seals the tagged fields of registered collections on the way
+// into the wrapped store and opens them on the way out. Records of other
+// collections pass through untouched. Tenant copies of a collection,
+// named collection@tenant by storage.TenantStore, are sealed like it.
+type Store struct {
+	storage.Store
+	keys   Keyring
+	fields map[string][]string
+}
+
+// NewStore returns store with fields sealed by keys, or an error if keys
+// can't seal.
+func NewStore(store storage.Store, keys Keyring) (*Store, error) {
+	if err := keys.Check(); err != nil {
+		return nil, err
+	}
+	return &Store{Store: store, keys: keys, fields: make(map[string][]string)}, nil
+}
+
+// Register seals the fields of model tagged for encryption in the records
+// of collection. Call it before the store is used.
+func (s *Store) Register(collection string, model interface{}) {
+	s.fields[collection] = Fields(model)
+}
+
+// sealed returns the fields sealed in collection.
+func (s *Store) sealed(collection string) []string {
+	base, _, _ := strings.Cut(collection, "@")
+	return s.fields[base]
+}
+
+func aad(collection, id, field string) string {
+	return collection + "/" + id + "/" + field
+}
+
+// transform returns data with each of fields present replaced by fn of
+// its value.
+func transform(data json.RawMessage, fields []string, fn func(field string, raw json.RawMessage) (json.RawMessage, error)) (json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		// Not an object, so it has no fields to seal.
+		return data, nil
+	}
+	changed := false
+	for _, f := range fields {
+		raw, ok := obj[f]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		out, err := fn(f, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		obj[f], changed = out, true
+	}
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(obj)
+}
+
+func (s *Store) seal(collection, id string, data json.RawMessage) (json.RawMessage, error) {
+	fields := s.sealed(collection)
+	if len(fields) == 0 {
+		return data, nil
+	}
+	return transform(data, fields, func(f string, raw json.RawMessage) (json.RawMessage, error) {
+		return s.keys.seal(raw, aad(collection, id, f))
+	})
+}
+
+func (s *Store) open(rec storage.Record) (storage.Record, error) {
+	fields := s.sealed(rec.Collection)
+	if len(fields) == 0 {
+		return rec, nil
+	}
+	data, err := transform(rec.Data, fields, func(f string, raw json.RawMessage) (json.RawMessage, error) {
+		plain, _, err := s.keys.open(raw, aad(rec.Collection, rec.ID, f))
+		return plain, err
+	})
+	if err != nil {
+		openErrors.WithLabelValues(rec.Collection).Inc()
+		return storage.Record{}, fmt.Errorf("fieldcrypt: %s/%s: %w", rec.Collection, rec.ID, err)
+	}
+	rec.Data = data
+	return rec, nil
+}
+
+func (s *Store) Get(ctx context.Context, collection, id string) (storage.Record, error) {
+	rec, err := s.Store.Get(ctx, collection, id)
+	if err != nil {
+		return rec, err
+	}
+	return s.open(rec)
+}
+
+func (s *Store) List(ctx context.Context, collection string, opts storage.ListOptions) ([]storage.Record, error) {
+	recs, err := s.Store.List(ctx, collection, opts)
+	if err != nil {
+		return nil, err
+	}
+	for i, rec := range recs {
+		if recs[i], err = s.open(rec); err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+func (s *Store) Create(ctx context.Context, collection, id string, data json.RawMessage) (storage.Record, error) {
+	sealed, err := s.seal(collection, id, data)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	rec, err := s.Store.Create(ctx, collection, id, sealed)
+	if err != nil {
+		return rec, err
+	}
+	rec.Data = data
+	return rec, nil
+}
+
+func (s *Store) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (storage.Record, error) {
+	sealed, err := s.seal(collection, id, data)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	rec, err := s.Store.Update(ctx, collection, id, sealed, ifVersion)
+	if err != nil {
+		return rec, err
+	}
+	rec.Data = data
+	return rec, nil
+}
+
+// Begin wraps the wrapped store's native transactions, if it has them,
+// so their writes are sealed too, and otherwise compensates through s.
+func (s *Store) Begin(ctx context.Context) (storage.Tx, error) {
+	b, ok := s.Store.(storage.Beginner)
+	if !ok {
+		// Hide Begin, so storage.Begin compensates rather than calling back.
+		return storage.Begin(ctx, struct{ storage.Store }{s})
+	}
+	tx, err := b.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sealedTx{Store: &Store{Store: tx, keys: s.keys, fields: s.fields}, tx: tx}, nil
+}
+
+// sealedTx is a native transaction whose writes are sealed.
+type sealedTx struct {
+	*Store
+	tx storage.Tx
+}
+
+func (t *sealedTx) Commit(ctx context.Context) error   { return t.tx.Commit(ctx) }
+func (t *sealedTx) Rollback(ctx context.Context) error { return t.tx.Rollback(ctx) }
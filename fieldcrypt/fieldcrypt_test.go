@@ -0,0 +1,120 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+type contact struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty" encrypt:"true"`
+	Token string `encrypt:"true"`
+}
+
+func keyring(primary string, versions ...string) Keyring {
+	k := Keyring{Primary: primary, Keys: make(map[string][]byte)}
+	for i, v := range versions {
+		k.Keys[v] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+	return k
+}
+
+func newStore(t *testing.T, backing storage.Store, keys Keyring) *Store {
+	t.Helper()
+	s, err := NewStore(backing, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Register("contacts", contact{})
+	return s
+}
+
+// TestFields checks that tagged fields are named as they are in JSON.
+func TestFields(t *testing.T) {
+	if got := strings.Join(Fields(&contact{}), ","); got != "email,Token" {
+		t.Errorf("Fields(contact) = %s, want email,Token", got)
+	}
+}
+
+// TestStore checks that tagged fields are sealed in the backing store,
+// read back in plaintext, and bound to their record, and that other
+// collections pass through.
+func TestStore(t *testing.T) {
+	backing := storage.NewMemory()
+	s := newStore(t, backing, keyring("v1", "v1"))
+	ctx := context.Background()
+	in := `{"name":"Gladys","email":"gladys@example.com","Token":"s3cret"}`
+
+	rec, err := s.Create(ctx, "contacts", "a", json.RawMessage(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rec.Data) != in {
+		t.Errorf("Create() data = %s, want the plaintext", rec.Data)
+	}
+	raw, _ := backing.Get(ctx, "contacts", "a")
+	if strings.Contains(string(raw.Data), "gladys@") || strings.Contains(string(raw.Data), "s3cret") || !strings.Contains(string(raw.Data), `"name":"Gladys"`) {
+		t.Errorf("stored data = %s, want email and token sealed, name not", raw.Data)
+	}
+	var got contact
+	rec, _ = s.Get(ctx, "contacts", "a")
+	json.Unmarshal(rec.Data, &got)
+	if got != (contact{"Gladys", "gladys@example.com", "s3cret"}) {
+		t.Errorf("Get() = %+v, want the plaintext", got)
+	}
+	if recs, _ := s.List(ctx, "contacts", storage.ListOptions{}); len(recs) != 1 || !strings.Contains(string(recs[0].Data), "gladys@") {
+		t.Errorf("List() = %v, want the plaintext", recs)
+	}
+
+	// A sealed value copied to another record doesn't open there.
+	backing.Create(ctx, "contacts", "b", raw.Data)
+	if _, err := s.Get(ctx, "contacts", "b"); err == nil {
+		t.Errorf("Get(b) with a's sealed fields succeeded, want an error")
+	}
+
+	s.Create(ctx, "greetings", "g", json.RawMessage(`{"email":"x"}`))
+	if raw, _ := backing.Get(ctx, "greetings", "g"); string(raw.Data) != `{"email":"x"}` {
+		t.Errorf("unregistered collection stored %s, want it untouched", raw.Data)
+	}
+	if _, err := NewStore(backing, keyring("v2", "v1")); err == nil {
+		t.Errorf("NewStore() without the primary key succeeded, want an error")
+	}
+}
+
+// TestRotate checks that after a new primary key is added, Rotate
+// re-seals old and plaintext values with it, after which the old key can
+// be dropped.
+func TestRotate(t *testing.T) {
+	backing := storage.NewMemory()
+	ctx := context.Background()
+	old := newStore(t, backing, keyring("v1", "v1"))
+	old.Create(ctx, "contacts", "a", json.RawMessage(`{"email":"a@example.com"}`))
+	// Written before encryption was on.
+	backing.Create(ctx, "contacts", "b", json.RawMessage(`{"email":"b@example.com"}`))
+
+	s := newStore(t, backing, keyring("v2", "v1", "v2"))
+	n, err := s.Rotate(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("Rotate() = %d, %v, want 2 records re-sealed", n, err)
+	}
+	if n, _ := s.Rotate(ctx); n != 0 {
+		t.Errorf("second Rotate() = %d, want nothing left", n)
+	}
+
+	only := newStore(t, backing, Keyring{Primary: "v2", Keys: map[string][]byte{"v2": s.keys.Keys["v2"]}})
+	for _, id := range []string{"a", "b"} {
+		rec, err := only.Get(ctx, "contacts", id)
+		if err != nil || !strings.Contains(string(rec.Data), id+"@example.com") {
+			t.Errorf("Get(%s) with only v2 = %s, %v, want the plaintext", id, rec.Data, err)
+		}
+	}
+	if _, err := newStore(t, backing, keyring("v3", "v3")).Get(ctx, "contacts", "a"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Get() without the sealing key = %v, want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,117 @@
+package fieldcrypt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// rotateBatch is how many records Rotate lists at a time.
+const rotateBatch = 500
+
+// Rotate re-seals, with the primary key, every registered field sealed
+// with another key or not sealed at all, as written before encryption was
+// turned on. It returns how many records it rewrote. Records changed
+// while it runs are left to the write that changed them, which seals with
+// the primary key anyway. Tenant copies of collections aren't reached.
+func (s *Store) Rotate(ctx context.Context) (int, error) {
+	collections := make([]string, 0, len(s.fields))
+	for c := range s.fields {
+		collections = append(collections, c)
+	}
+	sort.Strings(collections)
+	total := 0
+	for _, c := range collections {
+		n, err := s.rotate(ctx, c)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("fieldcrypt: rotating %s: %w", c, err)
+		}
+	}
+	return total, nil
+}
+
+func (s *Store) rotate(ctx context.Context, collection string) (int, error) {
+	n := 0
+	var after *storage.Key
+	for {
+		recs, err := s.Store.List(ctx, collection, storage.ListOptions{After: after, Limit: rotateBatch})
+		if err != nil {
+			return n, err
+		}
+		for _, rec := range recs {
+			if !s.stale(rec) {
+				continue
+			}
+			plain, err := s.open(rec)
+			if err != nil {
+				return n, err
+			}
+			sealed, err := s.seal(collection, rec.ID, plain.Data)
+			if err != nil {
+				return n, err
+			}
+			switch _, err := s.Store.Update(ctx, collection, rec.ID, sealed, rec.Version); {
+			case err == nil:
+				n++
+				reencrypted.WithLabelValues(collection).Inc()
+			case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrVersionMismatch):
+			default:
+				return n, err
+			}
+		}
+		if len(recs) < rotateBatch {
+			return n, nil
+		}
+		last := recs[len(recs)-1].Key()
+		after = &last
+	}
+}
+
+// stale reports whether rec, as stored, has a registered field that isn't
+// sealed with the primary key.
+func (s *Store) stale(rec storage.Record) bool {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(rec.Data, &obj) != nil {
+		return false
+	}
+	for _, f := range s.sealed(rec.Collection) {
+		raw, ok := obj[f]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		if _, version, _ := s.keys.open(raw, aad(rec.Collection, rec.ID, f)); version != s.keys.Primary {
+			return true
+		}
+	}
+	return false
+}
+
+// Run calls Rotate at once, to pick up a primary key changed since the
+// last start, and then every interval until ctx is canceled, logging what
+// it re-sealed.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		n, err := s.Rotate(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Error("fieldcrypt: re-sealing fields")
+		}
+		if n > 0 {
+			logrus.WithField("records", n).Info("fieldcrypt: re-sealed fields with the primary key")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
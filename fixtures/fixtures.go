@@ -0,0 +1,125 @@
+// Package fixtures gives tests the shared corpus in testdata/ at the root
+// of the repository: sample XML documents, JWTs and config files, and
+// golden files of expected output.
+//
+// Under Bazel the corpus is found through runfiles, so tests using it
+// need data = ["//testdata"]; under go test it is found relative to this
+// package's source. Golden files are rewritten with go test's -update flag:
+//
+//	go test ./config -update
+//
+// Bazel tests run sandboxed and can't write to the source tree, so they
+// can only compare.
+package fixtures
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/bazel"
+)
+
+// Dir is the corpus directory, relative to the workspace root.
+const Dir = "testdata"
+
+var update = flag.Bool("update", false, "rewrite golden files in "+Dir+"/golden with the output of the tests")
+
+// Path returns the path of the corpus file name, such as
+// "xml/wadl.xml", failing t if it doesn't exist.
+func Path(t testing.TB, name string) string {
+	t.Helper()
+	path, err := resolve(name)
+	if err == nil {
+		_, err = os.Stat(path)
+	}
+	if err != nil {
+		t.Fatalf("fixture %s: %v", name, err)
+	}
+	return path
+}
+
+// resolve returns where the corpus file name is, whether or not it
+// exists.
+func resolve(name string) (string, error) {
+	rel := filepath.ToSlash(filepath.Join(Dir, name))
+	if bazel.BuiltWithBazel() {
+		return bazel.Runfile(rel)
+	}
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", fmt.Errorf("no caller information to find %s by", Dir)
+	}
+	return filepath.Join(filepath.Dir(filepath.Dir(file)), filepath.FromSlash(rel)), nil
+}
+
+// Read returns the contents of the corpus file name.
+func Read(t testing.TB, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(Path(t, name))
+	if err != nil {
+		t.Fatalf("fixture %s: %v", name, err)
+	}
+	return data
+}
+
+// Golden compares got with the golden file golden/name, reporting the
+// first differing line. With -update it writes got to the file instead.
+func Golden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	rel := filepath.Join("golden", name)
+	if *update {
+		if bazel.BuiltWithBazel() {
+			t.Fatalf("golden %s: run go test -update to rewrite golden files; Bazel tests can't write to the source tree", name)
+		}
+		path, err := resolve(rel)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(path, got, 0o644)
+		}
+		if err != nil {
+			t.Fatalf("golden %s: %v", name, err)
+		}
+		return
+	}
+	path, err := resolve(rel)
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("golden %s doesn't exist; run go test -update to create it", name)
+	}
+	if err != nil {
+		t.Fatalf("golden %s: %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from golden %s (run go test -update if the change is intended):\n%s", name, firstDiff(got, want))
+	}
+}
+
+// firstDiff describes the first line where got and want differ.
+func firstDiff(got, want []byte) string {
+	g := strings.Split(string(got), "\n")
+	w := strings.Split(string(want), "\n")
+	for i := 0; i < len(g) || i < len(w); i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl || i >= len(g) || i >= len(w) {
+			return fmt.Sprintf("line %d:\n  got:  %q\n  want: %q", i+1, gl, wl)
+		}
+	}
+	return "contents differ"
+}
@@ -0,0 +1,86 @@
+package fixtures
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TestXMLCorpus checks that the XML documents parse, except the one meant
+// not to.
+func TestXMLCorpus(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"xml/wadl.xml":      true,
+		"xml/slideshow.xml": true,
+		"xml/malformed.xml": false,
+	} {
+		_, err := xmlquery.Parse(bytes.NewReader(Read(t, name)))
+		if (err == nil) != valid {
+			t.Errorf("parsing %s: %v, want valid = %v", name, err, valid)
+		}
+	}
+}
+
+// TestJWTCorpus checks that the tokens verify, or fail to, as
+// jwt/README says.
+func TestJWTCorpus(t *testing.T) {
+	key := func(tok *jwt.Token) (interface{}, error) {
+		if _, ok := tok.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte("secret-key"), nil
+	}
+	tests := []struct {
+		name string
+		want uint32 // jwt.ValidationError flags; 0 for valid
+	}{
+		{"jwt/valid.jwt", 0},
+		{"jwt/expired.jwt", jwt.ValidationErrorExpired},
+		{"jwt/alg-none.jwt", jwt.ValidationErrorUnverifiable},
+		{"jwt/bad-signature.jwt", jwt.ValidationErrorSignatureInvalid},
+	}
+	for _, tt := range tests {
+		raw := strings.TrimSpace(string(Read(t, tt.name)))
+		_, err := jwt.Parse(raw, key)
+		var verr *jwt.ValidationError
+		switch {
+		case tt.want == 0 && err != nil:
+			t.Errorf("%s: %v, want valid", tt.name, err)
+		case tt.want != 0 && (!errors.As(err, &verr) || verr.Errors&tt.want == 0):
+			t.Errorf("%s: %v, want validation error %b", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestGolden checks comparison against a golden file and rewriting it.
+func TestGolden(t *testing.T) {
+	if got := firstDiff([]byte("a\nb\nc"), []byte("a\nb\nd")); !strings.Contains(got, "line 3") {
+		t.Errorf("firstDiff = %q, want line 3", got)
+	}
+	if got := firstDiff([]byte("a\n"), []byte("a\nb\n")); !strings.Contains(got, "line 2") {
+		t.Errorf("firstDiff = %q, want line 2", got)
+	}
+
+	want, err := os.ReadFile(Path(t, "golden/fixtures/example.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Golden(t, "fixtures/example.txt", want)
+}
+
+// TestCanonicalJSON checks key ordering and masking at any depth.
+func TestCanonicalJSON(t *testing.T) {
+	got, err := CanonicalJSON([]byte(`{"b": 1.50, "a": [{"id": "x", "n": "<y>"}], "id": 7}`), "id")
+	want := `{"a":[{"id":"<masked>","n":"<y>"}],"b":1.50,"id":"<masked>"}`
+	if err != nil || string(got) != want {
+		t.Errorf("CanonicalJSON = %s, %v, want %s", got, err, want)
+	}
+	if _, err := CanonicalJSON([]byte(`{} {}`)); err == nil {
+		t.Error("CanonicalJSON of two values = nil error, want an error")
+	}
+}
@@ -0,0 +1,112 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"path"
+	"testing"
+)
+
+// Masked replaces the values of masked fields in snapshots.
+const Masked = "<masked>"
+
+// Snapshots records API responses as golden files under
+// golden/api/<Version>/, so a change to a response contract shows up as a
+// golden file diff in review. Approve a change by rewriting the files
+// with -update.
+type Snapshots struct {
+	// Version is the API version the responses belong to. Bumping it
+	// starts a new set of golden files and leaves the old ones to compare
+	// against.
+	Version string
+	// Headers are the response headers recorded besides the status.
+	Headers []string
+	// Mask names JSON object fields, at any depth, whose values change
+	// from run to run, such as IDs and timestamps. Their values are
+	// recorded as Masked.
+	Mask []string
+}
+
+// snapshot is the golden file format.
+type snapshot struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	// Text holds bodies that aren't JSON.
+	Text string `json:"text,omitempty"`
+}
+
+// Record compares rec's response with the golden file for name.
+func (s Snapshots) Record(t testing.TB, name string, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	snap := snapshot{Status: rec.Code}
+	for _, h := range s.Headers {
+		if v := rec.Header().Get(h); v != "" {
+			if snap.Headers == nil {
+				snap.Headers = make(map[string]string)
+			}
+			snap.Headers[h] = v
+		}
+	}
+	if body := rec.Body.Bytes(); len(body) > 0 {
+		if canonical, err := CanonicalJSON(body, s.Mask...); err == nil {
+			snap.Body = canonical
+		} else {
+			snap.Text = string(body)
+		}
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(snap); err != nil {
+		t.Fatalf("snapshot %s: %v", name, err)
+	}
+	Golden(t, path.Join("api", s.Version, name+".json"), out.Bytes())
+}
+
+// CanonicalJSON re-encodes a JSON document with object keys sorted and the
+// values of fields named in mask replaced by Masked.
+func CanonicalJSON(data []byte, mask ...string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("more than one JSON value")
+	}
+	masked := make(map[string]bool, len(mask))
+	for _, m := range mask {
+		masked[m] = true
+	}
+	// encoding/json sorts map keys.
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(maskValues(v, masked)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+func maskValues(v any, mask map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			if mask[k] {
+				v[k] = Masked
+			} else {
+				v[k] = maskValues(field, mask)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = maskValues(v[i], mask)
+		}
+	}
+	return v
+}
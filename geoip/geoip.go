@@ -0,0 +1,225 @@
+// Package geoip looks up the country and network (ASN) of client IPs in
+// MaxMind-format (MMDB) databases such as GeoLite2-Country and GeoLite2-ASN,
+// and annotates requests with the result.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// Unknown is the country reported for addresses not in the database.
+const Unknown = "ZZ"
+
+var requestsByCountry = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_by_country_total",
+	Help: "Requests by client country (ISO 3166-1 alpha-2, ZZ if unknown).",
+}, []string{"country"})
+
+// Location is what the databases know about an address.
+type Location struct {
+	Country string `json:"country"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+}
+
+// Fields returns loc as log fields.
+func (loc Location) Fields() logrus.Fields {
+	f := logrus.Fields{"country": loc.Country}
+	if loc.ASN != 0 {
+		f["asn"] = loc.ASN
+	}
+	return f
+}
+
+// record is the subset of the GeoLite2 Country and ASN schemas we read.
+// Each database fills in its own fields.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// Lookuper resolves addresses to locations.
+type Lookuper interface {
+	Lookup(ip net.IP) (Location, error)
+}
+
+// file is one open database and the stat it was opened with.
+type file struct {
+	path    string
+	reader  *maxminddb.Reader
+	modTime time.Time
+	size    int64
+}
+
+// DB is a set of MMDB files whose results are merged, so a country
+// database and an ASN database can be used together. Refresh reopens files
+// that changed on disk.
+type DB struct {
+	mu    sync.RWMutex
+	files []*file
+}
+
+// Open opens the databases at paths.
+func Open(paths ...string) (*DB, error) {
+	db := &DB{}
+	for _, path := range paths {
+		f, err := openFile(path)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.files = append(db.files, f)
+	}
+	return db, nil
+}
+
+func openFile(path string) (*file, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &file{path: path, reader: r, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// Lookup returns what the databases know about ip. Addresses none of them
+// know have country Unknown.
+func (db *DB) Lookup(ip net.IP) (Location, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var rec record
+	for _, f := range db.files {
+		if err := f.reader.Lookup(ip, &rec); err != nil {
+			return Location{Country: Unknown}, err
+		}
+	}
+	loc := Location{Country: rec.Country.ISOCode, ASN: rec.ASN, ASOrg: rec.ASOrg}
+	if loc.Country == "" {
+		loc.Country = Unknown
+	}
+	return loc, nil
+}
+
+// Refresh reopens databases whose modification time or size changed and
+// reports whether any did. A file that fails to reopen keeps being served
+// from the old copy.
+func (db *DB) Refresh() (bool, error) {
+	db.mu.RLock()
+	files := append([]*file(nil), db.files...)
+	db.mu.RUnlock()
+
+	changed := false
+	var errs []error
+	for i, f := range files {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+			continue
+		}
+		nf, err := openFile(f.path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		db.mu.Lock()
+		db.files[i] = nf
+		db.mu.Unlock()
+		// No Lookup holds the old reader once we've had the write lock.
+		f.reader.Close()
+		changed = true
+	}
+	return changed, errors.Join(errs...)
+}
+
+// Watch calls Refresh every interval until ctx is done.
+func (db *DB) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := db.Refresh()
+			if err != nil {
+				logrus.WithError(err).Error("geoip: refreshing databases")
+			}
+			if changed {
+				logrus.Info("geoip: reloaded changed databases")
+			}
+		}
+	}
+}
+
+// Close closes every database.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var errs []error
+	for _, f := range db.files {
+		errs = append(errs, f.reader.Close())
+	}
+	db.files = nil
+	return errors.Join(errs...)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying loc.
+func NewContext(ctx context.Context, loc Location) context.Context {
+	return context.WithValue(ctx, contextKey{}, loc)
+}
+
+// FromContext returns the location stored in ctx by Middleware. ok is
+// false if there is none, for example because geo-IP is disabled.
+func FromContext(ctx context.Context) (loc Location, ok bool) {
+	loc, ok = ctx.Value(contextKey{}).(Location)
+	return loc, ok
+}
+
+// ClientIP returns the address of the peer that sent r.
+func ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// Middleware looks up the client address of every request in db, stores
+// the result in the request context, and counts requests by country.
+func Middleware(db Lookuper) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			loc := Location{Country: Unknown}
+			if ip := ClientIP(r); ip != nil {
+				var err error
+				if loc, err = db.Lookup(ip); err != nil {
+					logrus.WithError(err).WithField("ip", ip.String()).Debug("geoip: lookup failed")
+				}
+			}
+			requestsByCountry.WithLabelValues(loc.Country).Inc()
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), loc)))
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package geoip
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeMMDB writes an IPv4 MMDB file mapping the /8 network first.0.0.0
+// to a record with country iso_code.
+func writeMMDB(t *testing.T, path string, first byte, iso string) {
+	t.Helper()
+	str := func(s string) []byte { return append([]byte{0x40 | byte(len(s))}, s...) }
+	uint16v := func(n uint16) []byte { return []byte{0xa0 | 2, byte(n >> 8), byte(n)} }
+
+	// One tree node per bit of the first octet; the other branch at each
+	// level, and everything past the /8, is "no data".
+	const nodes = 8
+	var tree []byte
+	put := func(v uint32) { tree = append(tree, byte(v>>16), byte(v>>8), byte(v)) }
+	for i := 0; i < nodes; i++ {
+		next := uint32(i + 1)
+		if i == nodes-1 {
+			next = nodes + 16 // data section offset 0
+		}
+		if first>>(7-i)&1 == 0 {
+			put(next)
+			put(nodes)
+		} else {
+			put(nodes)
+			put(next)
+		}
+	}
+
+	data := []byte{0xe0 | 1}
+	data = append(data, str("country")...)
+	data = append(data, 0xe0|1)
+	data = append(data, str("iso_code")...)
+	data = append(data, str(iso)...)
+
+	meta := []byte{0xe0 | 6}
+	meta = append(meta, str("node_count")...)
+	meta = append(meta, uint16v(nodes)...)
+	meta = append(meta, str("record_size")...)
+	meta = append(meta, uint16v(24)...)
+	meta = append(meta, str("ip_version")...)
+	meta = append(meta, uint16v(4)...)
+	meta = append(meta, str("database_type")...)
+	meta = append(meta, str("Test-Country")...)
+	meta = append(meta, str("binary_format_major_version")...)
+	meta = append(meta, uint16v(2)...)
+	meta = append(meta, str("binary_format_minor_version")...)
+	meta = append(meta, uint16v(0)...)
+
+	var out []byte
+	out = append(out, tree...)
+	out = append(out, make([]byte, 16)...)
+	out = append(out, data...)
+	out = append(out, "\xab\xcd\xefMaxMind.com"...)
+	out = append(out, meta...)
+	if err := os.WriteFile(path, out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLookupRefresh checks lookups and that Refresh picks up a replaced
+// database file.
+func TestLookupRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeMMDB(t, path, 81, "DE")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"81.2.3.4", "DE"},
+		{"82.2.3.4", Unknown},
+	}
+	for _, tt := range tests {
+		if loc, err := db.Lookup(net.ParseIP(tt.ip)); err != nil || loc.Country != tt.want {
+			t.Errorf("Lookup(%s) = %+v, %v, want %s", tt.ip, loc, err, tt.want)
+		}
+	}
+
+	if changed, err := db.Refresh(); changed || err != nil {
+		t.Fatalf("Refresh() unchanged file = %v, %v, want false", changed, err)
+	}
+	writeMMDB(t, path, 81, "FR")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if changed, err := db.Refresh(); !changed || err != nil {
+		t.Fatalf("Refresh() after rewrite = %v, %v, want true", changed, err)
+	}
+	if loc, _ := db.Lookup(net.ParseIP("81.2.3.4")); loc.Country != "FR" {
+		t.Errorf("Lookup(81.2.3.4) after refresh = %+v, want FR", loc)
+	}
+}
+
+// TestMiddleware checks that the location lands in the request context.
+func TestMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeMMDB(t, path, 81, "DE")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	var got Location
+	h := Middleware(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+	req := httptest.NewRequest("GET", "/greet", nil)
+	req.RemoteAddr = "81.9.9.9:4321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if got.Country != "DE" {
+		t.Errorf("FromContext() = %+v, want DE", got)
+	}
+}
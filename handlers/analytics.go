@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/pii"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Analytics serves the /admin/analytics reports.
+type Analytics struct {
+	Aggregator *analytics.Aggregator
+	// PII hashes tenants unless the token grants pii.Scope.
+	PII *pii.Redactor
+}
+
+// NewAnalytics returns an Analytics handler reading from aggregator and
+// redacting rows with redactor.
+func NewAnalytics(aggregator *analytics.Aggregator, redactor *pii.Redactor) *Analytics {
+	return &Analytics{Aggregator: aggregator, PII: redactor}
+}
+
+// Report responds with usage rows as JSON. ?from= and ?to= (YYYY-MM-DD),
+// ?route=, ?tenant=, and ?country= filter the rows;
+// ?group_by=day|route|tenant|country sums them.
+func (h *Analytics) Report(w http.ResponseWriter, r *http.Request) {
+	rows, ok := h.rows(w, r)
+	if !ok {
+		return
+	}
+	respond.JSON(w, http.StatusOK, rows)
+}
+
+// Export is like Report but responds with CSV, for spreadsheets.
+func (h *Analytics) Export(w http.ResponseWriter, r *http.Request) {
+	rows, ok := h.rows(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="analytics.csv"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"day", "route", "tenant", "country", "count"})
+	for _, row := range rows {
+		out.Write([]string{csvSafe(row.Day), csvSafe(row.Route), csvSafe(row.Tenant), row.Country, strconv.FormatInt(row.Count, 10)})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Warn("analytics: writing CSV export")
+	}
+}
+
+// rows flushes pending counts, so reports include the latest requests, and
+// returns the rows r asks for.
+func (h *Analytics) rows(w http.ResponseWriter, r *http.Request) ([]analytics.Row, bool) {
+	q := r.URL.Query()
+	f := analytics.Filter{
+		From:    q.Get("from"),
+		To:      q.Get("to"),
+		Route:   q.Get("route"),
+		Tenant:  q.Get("tenant"),
+		Country: q.Get("country"),
+	}
+	for _, day := range []string{f.From, f.To} {
+		if _, err := time.Parse(analytics.DayLayout, day); day != "" && err != nil {
+			respond.Error(w, http.StatusBadRequest, "from and to must be dates like 2006-01-02")
+			return nil, false
+		}
+	}
+
+	if err := h.Aggregator.Flush(r.Context()); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Warn("analytics: flushing before report")
+	}
+	rows, err := h.Aggregator.Query(r.Context(), f)
+	if err != nil {
+		storageError(w, r, err)
+		return nil, false
+	}
+	if by := q.Get("group_by"); by != "" {
+		if rows, err = analytics.GroupBy(rows, by); err != nil {
+			respond.Error(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+	}
+	h.PII.Apply(r.Context(), rows)
+	return rows, true
+}
+
+// csvSafe defuses values a spreadsheet would run as a formula. Tenants
+// come from a request header, so they are untrusted.
+func csvSafe(s string) string {
+	if s != "" && (s[0] == '=' || s[0] == '+' || s[0] == '-' || s[0] == '@') {
+		return "'" + s
+	}
+	return s
+}
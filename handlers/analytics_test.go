@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/pii"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestAnalyticsExport checks the CSV export, including that a tenant
+// starting with "=" can't run as a spreadsheet formula.
+func TestAnalyticsExport(t *testing.T) {
+	a := analytics.NewAggregator(storage.NewMemory())
+	day := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	a.Add(day, "GET /greet", "acme", "DE", 3)
+	a.Add(day, "GET /greet", "=HYPERLINK(1)", "", 1)
+	h := NewAnalytics(a, nil)
+
+	rec := serve(http.HandlerFunc(h.Export), "GET", "/admin/analytics/export.csv?from=2026-01-01", "", nil)
+	want := "day,route,tenant,country,count\n" +
+		"2026-01-02,GET /greet,'=HYPERLINK(1),,1\n" +
+		"2026-01-02,GET /greet,acme,DE,3\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Fatalf("Export = %d %q, want %q", rec.Code, rec.Body, want)
+	}
+
+	if rec := serve(http.HandlerFunc(h.Report), "GET", "/admin/analytics?from=yesterday", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Report(from=yesterday) = %d, want 400", rec.Code)
+	}
+	rec = serve(http.HandlerFunc(h.Report), "GET", "/admin/analytics?group_by=route", "", nil)
+	if !strings.Contains(rec.Body.String(), `"count":4`) {
+		t.Errorf("Report(group_by=route) = %s, want a total of 4", rec.Body)
+	}
+}
+
+// TestAnalyticsPII checks that reports hash tenants unless the token
+// grants pii.Scope.
+func TestAnalyticsPII(t *testing.T) {
+	a := analytics.NewAggregator(storage.NewMemory())
+	a.Add(time.Now(), "GET /greet", "acme", "", 1)
+	h := NewAnalytics(a, pii.NewRedactor(nil))
+
+	rec := as(h.Report, jwt.MapClaims{"roles": []string{"admin"}}, "GET", "/admin/analytics", "", nil)
+	if strings.Contains(rec.Body.String(), "acme") || !strings.Contains(rec.Body.String(), `"tenant":"hash:`) {
+		t.Errorf("Report for an admin = %s, want the tenant hashed", rec.Body)
+	}
+	rec = as(h.Report, jwt.MapClaims{"roles": []string{"admin"}, "scope": pii.Scope}, "GET", "/admin/analytics", "", nil)
+	if !strings.Contains(rec.Body.String(), `"tenant":"acme"`) {
+		t.Errorf("Report with %s = %s, want the tenant in the clear", pii.Scope, rec.Body)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/approval"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// ApprovalsPath is where pending actions are served, by ID.
+const ApprovalsPath = "/admin/approvals/"
+
+// Kinds of actions held for approval.
+const (
+	KindPurge      = "retention.purge"
+	KindCacheFlush = "cache.flush"
+)
+
+// Approvals serves the pending destructive actions under ApprovalsPath,
+// which a second admin approves or either rejects.
+type Approvals struct {
+	Manager *approval.Manager
+}
+
+// NewApprovals returns an Approvals handler deciding with m.
+func NewApprovals(m *approval.Manager) *Approvals {
+	return &Approvals{Manager: m}
+}
+
+// List responds with the actions awaiting approval, oldest first.
+func (h *Approvals) List(w http.ResponseWriter, r *http.Request) {
+	actions, err := h.Manager.List(r.Context())
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, actions)
+}
+
+// Get responds with the action.
+func (h *Approvals) Get(w http.ResponseWriter, r *http.Request) {
+	a, err := h.Manager.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, a)
+}
+
+// Approve runs the action and responds with it and its result. The admin
+// who requested it gets 403.
+func (h *Approvals) Approve(w http.ResponseWriter, r *http.Request) {
+	a, err := h.Manager.Approve(r.Context(), subject(r), mux.Vars(r)["id"])
+	if err != nil {
+		approvalError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, a)
+}
+
+// Reject withdraws the action and responds with it.
+func (h *Approvals) Reject(w http.ResponseWriter, r *http.Request) {
+	a, err := h.Manager.Reject(r.Context(), subject(r), mux.Vars(r)["id"])
+	if err != nil {
+		approvalError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, a)
+}
+
+// requestApproval holds an action of kind for approval and responds 202 with it,
+// at its Location.
+func requestApproval(w http.ResponseWriter, r *http.Request, m *approval.Manager, kind string, params map[string]string) {
+	a, err := m.Request(r.Context(), subject(r), kind, params)
+	if err != nil {
+		approvalError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", ApprovalsPath+a.ID)
+	respond.JSON(w, http.StatusAccepted, a)
+}
+
+// approvalError responds to an error from approval.Manager.
+func approvalError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, approval.ErrSelfApproval):
+		respond.Error(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, approval.ErrDecided), errors.Is(err, approval.ErrExpired):
+		respond.Error(w, http.StatusConflict, err.Error())
+	case errors.Is(err, approval.ErrUnknownKind):
+		respond.Error(w, http.StatusBadRequest, err.Error())
+	default:
+		storageError(w, r, err)
+	}
+}
+
+// subject returns the sub claim of r's token, or "" without one.
+func subject(r *http.Request) string {
+	claims, _ := auth.FromContext(r.Context())
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// Cache serves POST /admin/cache/flush, which empties the shared cache,
+// signing everyone out, once a second admin approves.
+type Cache struct {
+	Cache     cache.Flusher
+	Approvals *approval.Manager
+}
+
+// NewCache returns a Cache handler flushing c once approvals approves.
+// Flushes run at once if approvals is nil.
+func NewCache(c cache.Flusher, approvals *approval.Manager) *Cache {
+	h := &Cache{Cache: c, Approvals: approvals}
+	if approvals != nil {
+		approvals.Register(KindCacheFlush, func(ctx context.Context, params map[string]string) (interface{}, error) {
+			c.Flush()
+			return map[string]bool{"flushed": true}, nil
+		})
+	}
+	return h
+}
+
+// Flush requests the flush, or flushes when approvals are off.
+func (h *Cache) Flush(w http.ResponseWriter, r *http.Request) {
+	if h.Approvals != nil {
+		requestApproval(w, r, h.Approvals, KindCacheFlush, nil)
+		return
+	}
+	h.Cache.Flush()
+	respond.JSON(w, http.StatusOK, map[string]bool{"flushed": true})
+}
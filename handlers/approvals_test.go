@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/approval"
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/retention"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestApprovals checks that a cache flush waits for a second admin, that
+// its requester can't approve it, and that a rejected purge never runs.
+func TestApprovals(t *testing.T) {
+	m := storage.NewMemory()
+	ctx := context.Background()
+	manager := approval.NewManager(m, audit.NewLog(m), 0)
+	c := cache.NewMemory(time.Minute, 0)
+	c.Set(ctx, "session", "gladys", 0)
+	flush := NewCache(c, manager)
+	h := NewApprovals(manager)
+	gladys, derin := jwt.MapClaims{"sub": "gladys"}, jwt.MapClaims{"sub": "derin"}
+
+	rec := as(flush.Flush, gladys, "POST", "/admin/cache/flush", "", nil)
+	if rec.Code != http.StatusAccepted || !strings.HasPrefix(rec.Header().Get("Location"), ApprovalsPath) {
+		t.Fatalf("Flush = %d %s, want 202 at %s...", rec.Code, rec.Header().Get("Location"), ApprovalsPath)
+	}
+	var pending approval.Action
+	json.Unmarshal(rec.Body.Bytes(), &pending)
+	if _, ok, _ := c.Get(ctx, "session"); !ok {
+		t.Error("cache flushed before approval")
+	}
+	id := map[string]string{"id": pending.ID}
+
+	if rec := as(h.List, derin, "GET", "/admin/approvals", "", nil); !strings.Contains(rec.Body.String(), pending.ID) {
+		t.Errorf("List = %s, want the pending flush", rec.Body)
+	}
+	if rec := as(h.Approve, gladys, "POST", "/admin/approvals/"+pending.ID+"/approve", "", id); rec.Code != http.StatusForbidden {
+		t.Errorf("Approve by its requester = %d, want 403", rec.Code)
+	}
+	rec = as(h.Approve, derin, "POST", "/admin/approvals/"+pending.ID+"/approve", "", id)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"approved"`) {
+		t.Errorf("Approve = %d %s, want 200 approved", rec.Code, rec.Body)
+	}
+	if _, ok, _ := c.Get(ctx, "session"); ok {
+		t.Error("cache not flushed after approval")
+	}
+	if rec := as(h.Approve, derin, "POST", "/admin/approvals/"+pending.ID+"/approve", "", id); rec.Code != http.StatusConflict {
+		t.Errorf("Approve twice = %d, want 409", rec.Code)
+	}
+
+	m.Create(ctx, GreetingsCollection, "old", json.RawMessage(`{}`))
+	p, _ := retention.NewPurger(m, retention.Policy{Collection: GreetingsCollection, MaxAge: time.Hour})
+	p.SetClock(func() time.Time { return time.Now().Add(2 * time.Hour) })
+	purge := NewRetention(p, manager)
+	rec = as(purge.Purge, gladys, "POST", "/admin/retention/purge", "", nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Purge = %d %s, want 202", rec.Code, rec.Body)
+	}
+	json.Unmarshal(rec.Body.Bytes(), &pending)
+	id = map[string]string{"id": pending.ID}
+	if rec := as(h.Reject, gladys, "DELETE", "/admin/approvals/"+pending.ID, "", id); rec.Code != http.StatusOK {
+		t.Errorf("Reject = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if _, err := m.Get(ctx, GreetingsCollection, "old"); err != nil {
+		t.Errorf("Get(old) after a rejected purge = %v, want it kept", err)
+	}
+}
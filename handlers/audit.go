@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// defaultAuditEntries is how many entries /admin/audit lists by default.
+const defaultAuditEntries = 100
+
+// Audit serves /admin/audit, the audit trail.
+type Audit struct {
+	Log *audit.Log
+}
+
+// NewAudit returns an Audit handler reading from log.
+func NewAudit(log *audit.Log) *Audit {
+	return &Audit{Log: log}
+}
+
+// List responds with up to ?limit= (default 100) of the latest entries,
+// newest first.
+func (h *Audit) List(w http.ResponseWriter, r *http.Request) {
+	n := defaultAuditEntries
+	if s := r.URL.Query().Get("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			respond.Error(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		n = v
+	}
+	entries, err := h.Log.List(r.Context(), storage.ListOptions{})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, entries)
+}
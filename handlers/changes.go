@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/server"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+const (
+	// changesBatch is how many changes are read from the outbox at a time.
+	changesBatch = 100
+	// changesKeepAlive is how often an idle event stream gets a comment,
+	// so proxies don't close it.
+	changesKeepAlive = 15 * time.Second
+)
+
+// Changes serves GET /changes, the feed of writes recorded by the outbox.
+type Changes struct {
+	Outbox *storage.Outbox
+}
+
+// NewChanges returns a Changes handler reading from outbox.
+func NewChanges(outbox *storage.Outbox) *Changes {
+	return &Changes{Outbox: outbox}
+}
+
+// changeWriter writes changes in one of the feed formats.
+type changeWriter interface {
+	write(c storage.Change) error
+	keepAlive() error
+}
+
+// ndjsonWriter writes one JSON change per line.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n ndjsonWriter) write(c storage.Change) error { return n.enc.Encode(c) }
+
+// keepAlive is a no-op: blank lines would trip strict NDJSON readers.
+func (n ndjsonWriter) keepAlive() error { return nil }
+
+// sseWriter writes server-sent events whose IDs are resume tokens, so
+// EventSource reconnects resume on its own through Last-Event-ID.
+type sseWriter struct {
+	w http.ResponseWriter
+}
+
+func (s sseWriter) write(c storage.Change) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "id: %s\nevent: %s\ndata: %s\n\n", c.Token, c.Op, data)
+	return err
+}
+
+func (s sseWriter) keepAlive() error {
+	_, err := fmt.Fprint(s.w, ": keep-alive\n\n")
+	return err
+}
+
+// Stream sends changes as NDJSON, or as server-sent events when the client
+// accepts text/event-stream. ?after= (or Last-Event-ID) is the token of
+// the last change the client has; without it the feed starts at the
+// oldest change kept. ?collection= limits the feed to one collection. The
+// stream stays open and follows new changes unless ?follow=false, which
+// ends it once the client is caught up. A token whose changes have been
+// trimmed gets 410, and the client must resync from the collections.
+// Requests acting for a tenant only get that tenant's changes.
+func (h *Changes) Stream(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tok := q.Get("after")
+	if tok == "" {
+		tok = r.Header.Get("Last-Event-ID")
+	}
+	var seq int64
+	if tok != "" {
+		var err error
+		if seq, err = h.Outbox.ParseToken(tok); err != nil {
+			changesError(w, r, err)
+			return
+		}
+	}
+	collection := q.Get("collection")
+	if collection != "" && !h.Outbox.Tracked(collection) {
+		respond.Error(w, http.StatusBadRequest, "collection "+collection+" has no change feed")
+		return
+	}
+	follow := q.Get("follow") != "false"
+
+	// Read the first batch before committing to a 200, so expired tokens
+	// still get a proper error.
+	changed := h.Outbox.Changed()
+	batch, err := h.Outbox.Since(r.Context(), seq, changesBatch)
+	if err != nil {
+		changesError(w, r, err)
+		return
+	}
+
+	var out changeWriter
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.Header().Set("Content-Type", "text/event-stream")
+		out = sseWriter{w}
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		out = ndjsonWriter{json.NewEncoder(w)}
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	keepAlive := time.NewTicker(changesKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		for _, c := range batch {
+			seq = c.Seq
+			if collection != "" && c.Collection != collection {
+				continue
+			}
+			if out.write(c) != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if len(batch) < changesBatch {
+			if !follow || !waitForChange(r, out, flusher, keepAlive.C, changed) {
+				return
+			}
+		}
+		changed = h.Outbox.Changed()
+		if batch, err = h.Outbox.Since(r.Context(), seq, changesBatch); err != nil {
+			// Headers are gone; ending the stream makes the client
+			// reconnect and get the error then.
+			return
+		}
+	}
+}
+
+// waitForChange blocks until changed is closed, sending keep-alives meanwhile. It
+// returns false if the client has gone.
+func waitForChange(r *http.Request, out changeWriter, flusher http.Flusher, keepAlive <-chan time.Time, changed <-chan struct{}) bool {
+	for {
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-server.Draining(r.Context()):
+			// The server is shutting down; the client reconnects
+			// elsewhere and resumes from its last token.
+			return false
+		case <-changed:
+			return true
+		case <-keepAlive:
+			if out.keepAlive() != nil {
+				return false
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// changesError maps outbox errors to statuses.
+func changesError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrInvalidToken):
+		respond.Error(w, http.StatusBadRequest, "invalid change token")
+	case errors.Is(err, storage.ErrHistoryExpired):
+		respond.Error(w, http.StatusGone, "changes after that token are no longer kept; resync and start a new feed")
+	default:
+		storageError(w, r, err)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestChangesStream reads the feed without following, in both formats,
+// and resumes from a token.
+func TestChangesStream(t *testing.T) {
+	ctx := context.Background()
+	o := storage.NewOutbox(storage.NewMemory(), GreetingsCollection)
+	o.Create(ctx, GreetingsCollection, "a", []byte(`{}`))
+	o.Create(ctx, GreetingsCollection, "b", []byte(`{}`))
+	h := http.HandlerFunc(NewChanges(o).Stream)
+
+	rec := serve(h, "GET", "/changes?follow=false", "", nil)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if rec.Code != http.StatusOK || len(lines) != 2 || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("GET /changes = %d %q, want two NDJSON lines", rec.Code, rec.Body)
+	}
+
+	rec = serve(h, "GET", "/changes?follow=false", "", http.Header{
+		"Accept":        {"text/event-stream"},
+		"Last-Event-Id": {o.Token(1)},
+	})
+	if body := rec.Body.String(); !strings.HasPrefix(body, "id: "+o.Token(2)+"\nevent: create\n") || strings.Count(body, "id: ") != 1 {
+		t.Errorf("SSE resumed after 1 = %q, want only change 2", body)
+	}
+
+	if rec := serve(h, "GET", "/changes?after=nonsense", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET ?after=nonsense = %d, want 400", rec.Code)
+	}
+	if rec := serve(h, "GET", "/changes?collection=secrets", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET ?collection=secrets = %d, want 400", rec.Code)
+	}
+}
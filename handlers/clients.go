@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// defaultActiveWindow is how far back /admin/clients looks by default.
+const defaultActiveWindow = 24 * time.Hour
+
+// Clients serves the /admin/clients list of active integrations.
+type Clients struct {
+	Registry *clients.Registry
+}
+
+// NewClients returns a Clients handler reading from registry.
+func NewClients(registry *clients.Registry) *Clients {
+	return &Clients{Registry: registry}
+}
+
+// List responds with the clients seen within ?since= (a duration such as
+// 1h, default 24h), busiest first.
+func (h *Clients) List(w http.ResponseWriter, r *http.Request) {
+	window := defaultActiveWindow
+	if s := r.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			respond.Error(w, http.StatusBadRequest, "since must be a positive duration such as 1h")
+			return
+		}
+		window = d
+	}
+	active := h.Registry.Active(time.Now().Add(-window))
+	if active == nil {
+		active = []clients.Client{}
+	}
+	respond.JSON(w, http.StatusOK, active)
+}
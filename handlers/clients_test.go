@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+)
+
+// TestClientsList checks that recorded clients are listed and that a bad
+// window is rejected.
+func TestClientsList(t *testing.T) {
+	reg := clients.NewRegistry(clients.Config{})
+	reg.Allow(clients.Identity{Name: "mobile-app", Version: "2.0"})
+	h := NewClients(reg)
+
+	rec := serve(http.HandlerFunc(h.List), "GET", "/admin/clients?since=1h", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"mobile-app"`) {
+		t.Errorf("List = %d %s, want mobile-app listed", rec.Code, rec.Body)
+	}
+	if rec := serve(http.HandlerFunc(h.List), "GET", "/admin/clients?since=yesterday", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("List(since=yesterday) = %d, want 400", rec.Code)
+	}
+}
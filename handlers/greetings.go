@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/contentfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/ctxerr"
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/normalize"
+	"github.com/Shulammite-Aso/bazel-demo-app/paginate"
+	"github.com/Shulammite-Aso/bazel-demo-app/patch"
+	"github.com/Shulammite-Aso/bazel-demo-app/pkg/greetings"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/sanitize"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/txn"
+)
+
+// GreetingsCollection is the storage collection saved greetings live in.
+// It doubles as the resource type for sparse fieldsets.
+const GreetingsCollection = "greetings"
+
+// SavedGreeting is the stored form of a greeting. Name is who it greets,
+// hashed in logs and exports.
+type SavedGreeting struct {
+	Name    string `json:"name" validate:"required,max=256" pii:"hash"`
+	Message string `json:"message" validate:"required,max=1024"`
+}
+
+// greetingResponse is how a saved greeting is rendered.
+type greetingResponse struct {
+	ID string `json:"id"`
+	SavedGreeting
+	Version   int64             `json:"version"`
+	CreatedAt respond.Timestamp `json:"created_at"`
+	UpdatedAt respond.Timestamp `json:"updated_at"`
+}
+
+// Greetings serves the /greetings resource: saved greetings that can be
+// listed, fetched, and updated. Updates use optimistic concurrency through
+// ETag and If-Match.
+type Greetings struct {
+	Store storage.Store
+	// Cursors signs list pagination cursors.
+	Cursors *paginate.Signer
+	// Events, if set, receives greeting.created/updated/deleted events.
+	Events *events.Bus
+	// Filter, if set, rejects names and messages before they are stored.
+	Filter   *contentfilter.Filter
+	validate *validator.Validate
+	policy   *sanitize.Policy
+}
+
+// NewGreetings returns a Greetings handler backed by store, signing list
+// cursors with cursors.
+func NewGreetings(store storage.Store, cursors *paginate.Signer) *Greetings {
+	return &Greetings{
+		Store:    store,
+		Cursors:  cursors,
+		validate: validator.New(),
+		policy:   sanitize.BasicPolicy(),
+	}
+}
+
+// List responds with a page of saved greetings, oldest first. Clients page
+// with ?page=&per_page= or by following the cursor in the Link header.
+// ?fields= limits the fields returned. Pages carry a weak ETag and a
+// Last-Modified time, so polling clients can send If-None-Match or
+// If-Modified-Since and get 304 when nothing changed. ?since= switches to
+// a delta response; see changes.
+func (g *Greetings) List(w http.ResponseWriter, r *http.Request) {
+	if since := r.URL.Query().Get("since"); since != "" {
+		g.changes(w, r, since)
+		return
+	}
+	// Taken before reading, so changes made while the page is built are
+	// reported as modified next time rather than missed.
+	asOf := time.Now()
+	if g.unchangedSince(w, r) {
+		return
+	}
+
+	p, err := paginate.Parse(r, g.Cursors)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := storage.ListOptions{Limit: p.PerPage + 1}
+	if p.After != nil {
+		opts.After = &storage.Key{CreatedAt: p.After.CreatedAt, ID: p.After.ID}
+	} else {
+		opts.Offset = p.Offset()
+	}
+
+	recs, err := g.Store.List(r.Context(), GreetingsCollection, opts)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	hasMore := len(recs) > p.PerPage
+	if hasMore {
+		recs = recs[:p.PerPage]
+	}
+
+	out := make([]greetingResponse, 0, len(recs))
+	for _, rec := range recs {
+		resp, err := g.render(r, rec)
+		if err != nil {
+			storageError(w, r, err)
+			return
+		}
+		out = append(out, resp)
+	}
+	if hasMore {
+		last := recs[len(recs)-1]
+		paginate.SetNext(w, r, g.Cursors, p, true, paginate.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	w.Header().Set("Last-Modified", asOf.UTC().Format(http.TimeFormat))
+	if respond.NotModified(w, r, pageETag(r, recs)) {
+		return
+	}
+	respond.JSONFields(w, r, http.StatusOK, GreetingsCollection, out)
+}
+
+// pageETag returns a weak tag for a page of records: it changes when any
+// of them does, or when the page holds different records. The query is
+// included because ?fields= and the locale change the body.
+func pageETag(r *http.Request, recs []storage.Record) string {
+	h := sha256.New()
+	io.WriteString(h, r.URL.RawQuery+"\x00"+r.Header.Get("Accept-Language"))
+	for _, rec := range recs {
+		io.WriteString(h, "\x00"+respond.ETag(rec.ID, rec.Version))
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:8]) + `"`
+}
+
+// unchangedSince handles If-Modified-Since on the list: if no greeting has
+// been created, updated, or deleted since then it responds 304 and returns
+// true. HTTP dates have whole seconds, so the check errs towards reporting
+// changes made in the same second as the client's copy.
+func (g *Greetings) unchangedSince(w http.ResponseWriter, r *http.Request) bool {
+	header := r.Header.Get("If-Modified-Since")
+	if header == "" || r.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	changed, err := g.Store.List(r.Context(), GreetingsCollection, storage.ListOptions{UpdatedSince: since, Limit: 1})
+	if err != nil || len(changed) > 0 {
+		return false
+	}
+	deleted, err := g.Store.Deleted(r.Context(), GreetingsCollection, since)
+	if err != nil || len(deleted) > 0 {
+		return false
+	}
+	w.Header().Set("Last-Modified", header)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// greetingChanges is the delta response of GET /greetings?since=.
+type greetingChanges struct {
+	// Changed holds greetings created or updated since then, oldest first.
+	Changed []greetingResponse `json:"changed"`
+	// Deleted holds the IDs of greetings deleted since then.
+	Deleted []string `json:"deleted"`
+	// Next is the since value for the next poll.
+	Next string `json:"next"`
+}
+
+// changes responds with the greetings created, updated, or deleted at or
+// after since, an RFC 3339 timestamp, normally the Next value of the
+// previous delta. A greeting changed again during the request may be
+// reported twice, which is safe to apply. If deletions that old have been
+// forgotten it responds 410 and the client must fetch the full list again.
+func (g *Greetings) changes(w http.ResponseWriter, r *http.Request, sinceParam string) {
+	since, err := time.Parse(time.RFC3339Nano, sinceParam)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+		return
+	}
+	asOf := time.Now()
+	recs, err := g.Store.List(r.Context(), GreetingsCollection, storage.ListOptions{UpdatedSince: since})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	tombstones, err := g.Store.Deleted(r.Context(), GreetingsCollection, since)
+	if errors.Is(err, storage.ErrHistoryExpired) {
+		respond.Error(w, http.StatusGone, "changes that old are no longer kept; list all greetings again")
+		return
+	}
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].UpdatedAt.Before(recs[j].UpdatedAt) })
+	out := greetingChanges{Changed: make([]greetingResponse, 0, len(recs)), Deleted: []string{}, Next: asOf.UTC().Format(time.RFC3339Nano)}
+	recreated := make(map[string]time.Time, len(recs))
+	for _, rec := range recs {
+		resp, err := g.render(r, rec)
+		if err != nil {
+			storageError(w, r, err)
+			return
+		}
+		out.Changed = append(out.Changed, resp)
+		recreated[rec.ID] = rec.CreatedAt
+	}
+	for _, t := range tombstones {
+		// A greeting deleted and then created again under the same ID
+		// still exists.
+		if created, ok := recreated[t.ID]; ok && !created.Before(t.DeletedAt) {
+			continue
+		}
+		out.Deleted = append(out.Deleted, t.ID)
+	}
+	respond.JSON(w, http.StatusOK, out)
+}
+
+// Get responds with one saved greeting and its ETag.
+func (g *Greetings) Get(w http.ResponseWriter, r *http.Request) {
+	rec, err := g.Store.Get(r.Context(), GreetingsCollection, mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	g.write(w, r, http.StatusOK, rec)
+}
+
+// Create saves a new greeting. If the body has no message, one is
+// generated for the name.
+func (g *Greetings) Create(w http.ResponseWriter, r *http.Request) {
+	var in SavedGreeting
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if in.Message == "" {
+		in.Message, _ = greetings.Hello(in.Name)
+	}
+	data, ok := g.prepare(w, r, in)
+	if !ok {
+		return
+	}
+
+	rec, err := g.store(r).Create(r.Context(), GreetingsCollection, uuid.NewString(), data)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/greetings/"+rec.ID)
+	g.publish(r, events.GreetingCreated, rec)
+	g.write(w, r, http.StatusCreated, rec)
+}
+
+// maxImport caps the greetings of one import.
+const maxImport = 1000
+
+// importedGreeting is one greeting of an import, optionally with its ID.
+type importedGreeting struct {
+	ID string `json:"id"`
+	SavedGreeting
+}
+
+// Import handles POST /greetings/import: it creates every greeting of a
+// JSON array, at most 1000, and responds with them. A greeting without an
+// id gets a new one. Run with the txn middleware, the import is all or
+// nothing: an invalid greeting or a taken id rolls back the ones before
+// it.
+func (g *Greetings) Import(w http.ResponseWriter, r *http.Request) {
+	var in []importedGreeting
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if len(in) > maxImport {
+		respond.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d greetings can be imported at once", maxImport))
+		return
+	}
+	recs := make([]storage.Record, 0, len(in))
+	for _, item := range in {
+		if item.Message == "" {
+			item.Message, _ = greetings.Hello(item.Name)
+		}
+		data, ok := g.prepare(w, r, item.SavedGreeting)
+		if !ok {
+			return
+		}
+		if item.ID == "" {
+			item.ID = uuid.NewString()
+		}
+		rec, err := g.store(r).Create(r.Context(), GreetingsCollection, item.ID, data)
+		if err != nil {
+			storageError(w, r, err)
+			return
+		}
+		recs = append(recs, rec)
+	}
+
+	out := make([]greetingResponse, 0, len(recs))
+	for _, rec := range recs {
+		g.publish(r, events.GreetingCreated, rec)
+		resp, err := g.render(r, rec)
+		if err != nil {
+			storageError(w, r, err)
+			return
+		}
+		out = append(out, resp)
+	}
+	respond.JSONFields(w, r, http.StatusCreated, GreetingsCollection, out)
+}
+
+// Replace handles PUT: it replaces a saved greeting. The request must carry
+// the greeting's current ETag in If-Match.
+func (g *Greetings) Replace(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	g.update(w, r, func(json.RawMessage) ([]byte, error) { return body, nil })
+}
+
+// Patch handles PATCH with a JSON Patch (application/json-patch+json) or
+// JSON Merge Patch (application/merge-patch+json) body. Plain
+// application/json is treated as a merge patch. The request must carry the
+// greeting's current ETag in If-Match.
+func (g *Greetings) Patch(w http.ResponseWriter, r *http.Request) {
+	var apply func(doc, p []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case patch.JSONPatchType:
+		apply = patch.Apply
+	case patch.MergePatchType, "application/json", "":
+		apply = patch.Merge
+	default:
+		w.Header().Set("Accept-Patch", patch.JSONPatchType+", "+patch.MergePatchType)
+		respond.Error(w, http.StatusUnsupportedMediaType, "unsupported patch format "+mediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	g.update(w, r, func(cur json.RawMessage) ([]byte, error) { return apply(cur, body) })
+}
+
+// Delete removes a saved greeting. If-Match is honoured when present.
+func (g *Greetings) Delete(w http.ResponseWriter, r *http.Request) {
+	rec, err := g.Store.Get(r.Context(), GreetingsCollection, mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if r.Header.Get("If-Match") != "" && !respond.CheckIfMatch(w, r, respond.ETag(rec.ID, rec.Version)) {
+		return
+	}
+	if err := g.store(r).Delete(r.Context(), GreetingsCollection, rec.ID, rec.Version); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	g.publish(r, events.GreetingDeleted, rec)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// update checks If-Match against the stored greeting, computes the new
+// document with change, and writes it back conditionally on the version
+// that was checked. The resulting document is validated like a PUT body.
+func (g *Greetings) update(w http.ResponseWriter, r *http.Request, change func(cur json.RawMessage) ([]byte, error)) {
+	rec, err := g.Store.Get(r.Context(), GreetingsCollection, mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if !respond.CheckIfMatch(w, r, respond.ETag(rec.ID, rec.Version)) {
+		return
+	}
+
+	doc, err := change(rec.Data)
+	if err != nil {
+		respond.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	var next SavedGreeting
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&next); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid greeting: "+err.Error())
+		return
+	}
+	data, ok := g.prepare(w, r, next)
+	if !ok {
+		return
+	}
+
+	rec, err = g.store(r).Update(r.Context(), GreetingsCollection, rec.ID, data, rec.Version)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	g.publish(r, events.GreetingUpdated, rec)
+	g.write(w, r, http.StatusOK, rec)
+}
+
+// prepare normalizes, sanitizes, validates, and filters in, and returns
+// it encoded for storage. On failure it responds, with 400 for invalid
+// greetings, and returns false.
+func (g *Greetings) prepare(w http.ResponseWriter, r *http.Request, in SavedGreeting) (json.RawMessage, bool) {
+	var err error
+	if in.Name, err = normalize.String(in.Name, 0); err != nil {
+		respond.Error(w, http.StatusBadRequest, "name: "+err.Error())
+		return nil, false
+	}
+	if in.Message, err = normalize.String(in.Message, 0); err != nil {
+		respond.Error(w, http.StatusBadRequest, "message: "+err.Error())
+		return nil, false
+	}
+	in.Message = g.policy.Sanitize(in.Message)
+
+	if err := g.validate.Struct(in); err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	for _, f := range []struct{ field, text string }{{"name", in.Name}, {"message", in.Message}} {
+		if err := g.Filter.Check(r.Context(), f.field, f.text); err != nil {
+			checkError(w, err)
+			return nil, false
+		}
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return data, true
+}
+
+// store returns the store r writes to: its transaction, when the txn
+// middleware started one, and otherwise g.Store.
+func (g *Greetings) store(r *http.Request) storage.Store {
+	return txn.Store(r.Context(), g.Store)
+}
+
+func (g *Greetings) render(r *http.Request, rec storage.Record) (greetingResponse, error) {
+	resp := greetingResponse{
+		ID:        rec.ID,
+		Version:   rec.Version,
+		CreatedAt: respond.Time(r, rec.CreatedAt),
+		UpdatedAt: respond.Time(r, rec.UpdatedAt),
+	}
+	err := json.Unmarshal(rec.Data, &resp.SavedGreeting)
+	return resp, err
+}
+
+func (g *Greetings) write(w http.ResponseWriter, r *http.Request, status int, rec storage.Record) {
+	resp, err := g.render(r, rec)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", respond.ETag(rec.ID, rec.Version))
+	respond.JSONFields(w, r, status, GreetingsCollection, resp)
+}
+
+// greetingEvent is the data of greeting events.
+type greetingEvent struct {
+	ID string `json:"id"`
+	SavedGreeting
+	Version int64 `json:"version"`
+}
+
+func (g *Greetings) publish(r *http.Request, typ string, rec storage.Record) {
+	data := greetingEvent{ID: rec.ID, Version: rec.Version}
+	json.Unmarshal(rec.Data, &data.SavedGreeting)
+	g.Events.Publish(r.Context(), typ, data)
+}
+
+// storageError maps a storage error to a response.
+func storageError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		respond.Error(w, http.StatusNotFound, "not found")
+	case errors.Is(err, storage.ErrExists):
+		respond.Error(w, http.StatusConflict, "already exists")
+	case errors.Is(err, storage.ErrVersionMismatch):
+		respond.Error(w, http.StatusPreconditionFailed, "resource has been modified; fetch it again and retry")
+	case errors.Is(err, storage.ErrNoTenant):
+		respond.Error(w, http.StatusBadRequest, "name a tenant with "+analytics.TenantHeader)
+	case ctxerr.Record(r.Context(), "storage", err):
+		respond.Error(w, http.StatusServiceUnavailable, "request canceled")
+	default:
+		respond.Error(w, http.StatusInternalServerError, "storage error")
+	}
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/contentfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/paginate"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/txn"
+)
+
+func newGreetingsRouter() *mux.Router {
+	g := NewGreetings(storage.NewMemory(), paginate.NewSigner(nil))
+	r := mux.NewRouter()
+	r.HandleFunc("/greetings", g.Create).Methods("POST")
+	r.HandleFunc("/greetings/{id}", g.Get).Methods("GET")
+	r.HandleFunc("/greetings/{id}", g.Replace).Methods("PUT")
+	r.HandleFunc("/greetings/{id}", g.Patch).Methods("PATCH")
+	return r
+}
+
+func serve(h http.Handler, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestGreetingsIfMatch walks a saved greeting through conditional updates:
+// missing If-Match, a matching tag, and a stale tag.
+func TestGreetingsIfMatch(t *testing.T) {
+	h := newGreetingsRouter()
+
+	rec := serve(h, "POST", "/greetings", `{"name": "Gladys", "message": "Hi <b>Gladys</b><script>x()</script>"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /greetings = %d %s, want 201", rec.Code, rec.Body)
+	}
+	var created greetingResponse
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.Message != "Hi <b>Gladys</b>" {
+		t.Errorf("stored message = %q, want sanitized %q", created.Message, "Hi <b>Gladys</b>")
+	}
+	path := "/greetings/" + created.ID
+	etag := rec.Header().Get("ETag")
+
+	if rec := serve(h, "PATCH", path, `{"message": "Hello"}`, nil); rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("PATCH without If-Match = %d, want 428", rec.Code)
+	}
+
+	rec = serve(h, "PATCH", path, `{"message": "Hello"}`, http.Header{"If-Match": {etag}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH with current ETag = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") == etag {
+		t.Fatalf("ETag unchanged after update")
+	}
+
+	rec = serve(h, "PUT", path, `{"name": "Gladys", "message": "Hey"}`, http.Header{"If-Match": {etag}})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT with stale ETag = %d, want 412", rec.Code)
+	}
+}
+
+// TestGreetingsFields checks that ?fields= and fields[greetings]= trim the
+// list response.
+func TestGreetingsFields(t *testing.T) {
+	g := NewGreetings(storage.NewMemory(), paginate.NewSigner(nil))
+	h := mux.NewRouter()
+	h.HandleFunc("/greetings", g.Create).Methods("POST")
+	h.HandleFunc("/greetings", g.List).Methods("GET")
+	serve(h, "POST", "/greetings", `{"name": "Gladys"}`, nil)
+
+	for _, target := range []string{"/greetings?fields=name", "/greetings?fields[greetings]=name"} {
+		rec := serve(h, "GET", target, "", nil)
+		var got []map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 1 {
+			t.Fatalf("GET %s = %s, want one greeting", target, rec.Body)
+		}
+		if len(got[0]) != 2 || got[0]["id"] == nil || got[0]["name"] != "Gladys" {
+			t.Errorf("GET %s = %v, want only id and name", target, got[0])
+		}
+	}
+}
+
+// TestGreetingsPatchFormats checks JSON Patch, merge patch, and rejection
+// of patches that produce an invalid greeting or use an unknown format.
+func TestGreetingsPatchFormats(t *testing.T) {
+	h := newGreetingsRouter()
+	rec := serve(h, "POST", "/greetings", `{"name": "Gladys", "message": "Hi"}`, nil)
+	var created greetingResponse
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	path := "/greetings/" + created.ID
+	etag := rec.Header().Get("ETag")
+
+	tests := []struct {
+		contentType, body string
+		want              int
+	}{
+		{"application/json-patch+json", `[{"op":"replace","path":"/message","value":"Hey"}]`, http.StatusOK},
+		{"application/merge-patch+json", `{"message":"Hello"}`, http.StatusOK},
+		{"application/merge-patch+json", `{"name":null}`, http.StatusBadRequest},
+		{"application/json-patch+json", `[{"op":"add","path":"/extra","value":1}]`, http.StatusBadRequest},
+		{"application/json-patch+json", `[{"op":"test","path":"/name","value":"Derin"}]`, http.StatusUnprocessableEntity},
+		{"text/plain", `message=Hello`, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		rec := serve(h, "PATCH", path, tt.body, http.Header{"If-Match": {etag}, "Content-Type": {tt.contentType}})
+		if rec.Code != tt.want {
+			t.Errorf("PATCH %s %s = %d %s, want %d", tt.contentType, tt.body, rec.Code, rec.Body, tt.want)
+		}
+		if rec.Code == http.StatusOK {
+			etag = rec.Header().Get("ETag")
+		}
+	}
+}
+
+// TestGreetingsPagination walks the list with cursors and with pages and
+// checks every greeting is seen exactly once.
+func TestGreetingsPagination(t *testing.T) {
+	g := NewGreetings(storage.NewMemory(), paginate.NewSigner(nil))
+	h := mux.NewRouter()
+	h.HandleFunc("/greetings", g.Create).Methods("POST")
+	h.HandleFunc("/greetings", g.List).Methods("GET")
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		serve(h, "POST", "/greetings", `{"name": "`+name+`"}`, nil)
+	}
+
+	for _, start := range []string{"/greetings?per_page=2", "/greetings?page=1&per_page=2"} {
+		seen := map[string]bool{}
+		target := start
+		for pages := 0; target != ""; pages++ {
+			if pages > 5 {
+				t.Fatalf("%s: too many pages", start)
+			}
+			rec := serve(h, "GET", target, "", nil)
+			var page []greetingResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("GET %s = %d %s", target, rec.Code, rec.Body)
+			}
+			for _, gr := range page {
+				if seen[gr.Name] {
+					t.Errorf("%s: %s returned twice", start, gr.Name)
+				}
+				seen[gr.Name] = true
+			}
+			target = ""
+			if link := rec.Header().Get("Link"); link != "" {
+				target = link[1:strings.Index(link, ">")]
+			}
+		}
+		if len(seen) != 5 {
+			t.Errorf("%s: saw %d greetings, want 5", start, len(seen))
+		}
+	}
+}
+
+// TestGreetingsChanges polls the list with If-None-Match and ?since= and
+// checks that only changes are sent.
+func TestGreetingsChanges(t *testing.T) {
+	g := NewGreetings(storage.NewMemory(), paginate.NewSigner(nil))
+	h := mux.NewRouter()
+	h.HandleFunc("/greetings", g.Create).Methods("POST")
+	h.HandleFunc("/greetings", g.List).Methods("GET")
+	h.HandleFunc("/greetings/{id}", g.Delete).Methods("DELETE")
+	var first greetingResponse
+	json.Unmarshal(serve(h, "POST", "/greetings", `{"name": "a"}`, nil).Body.Bytes(), &first)
+
+	rec := serve(h, "GET", "/greetings", "", nil)
+	etag := rec.Header().Get("ETag")
+	if rec := serve(h, "GET", "/greetings", "", http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+		t.Errorf("GET with current ETag = %d, want 304", rec.Code)
+	}
+
+	var delta greetingChanges
+	json.Unmarshal(serve(h, "GET", "/greetings?since=2000-01-01T00:00:00Z", "", nil).Body.Bytes(), &delta)
+	if len(delta.Changed) != 1 || delta.Next == "" {
+		t.Fatalf("first delta = %+v, want the one greeting", delta)
+	}
+	next := delta.Next
+
+	serve(h, "POST", "/greetings", `{"name": "b"}`, nil)
+	serve(h, "DELETE", "/greetings/"+first.ID, "", nil)
+	if rec := serve(h, "GET", "/greetings", "", http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusOK {
+		t.Errorf("GET with stale ETag = %d, want 200", rec.Code)
+	}
+
+	delta = greetingChanges{}
+	json.Unmarshal(serve(h, "GET", "/greetings?since="+next, "", nil).Body.Bytes(), &delta)
+	if len(delta.Changed) != 1 || delta.Changed[0].Name != "b" || len(delta.Deleted) != 1 || delta.Deleted[0] != first.ID {
+		t.Errorf("second delta = %+v, want b changed and %s deleted", delta, first.ID)
+	}
+	if rec := serve(h, "GET", "/greetings?since=yesterday", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET ?since=yesterday = %d, want 400", rec.Code)
+	}
+}
+
+// TestGreetingsImport imports greetings in a transaction and checks that a
+// failing import keeps none of them.
+func TestGreetingsImport(t *testing.T) {
+	store := storage.NewMemory()
+	g := NewGreetings(store, paginate.NewSigner(nil))
+	h := txn.Middleware(store)(http.HandlerFunc(g.Import))
+	count := func() int {
+		recs, _ := store.List(context.Background(), GreetingsCollection, storage.ListOptions{})
+		return len(recs)
+	}
+
+	rec := serve(h, "POST", "/greetings/import", `[{"id":"a","name":"Gladys"},{"name":"Derin","message":"Hey, Derin"}]`, nil)
+	if rec.Code != http.StatusCreated || count() != 2 {
+		t.Fatalf("POST /greetings/import = %d %s with %d stored, want 201 with 2", rec.Code, rec.Body, count())
+	}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"taken id", `[{"id":"b","name":"Ines"},{"id":"a","name":"Gladys"}]`, http.StatusConflict},
+		{"invalid greeting", `[{"id":"b","name":"Ines"},{"name":""}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := serve(h, "POST", "/greetings/import", tt.body, nil); rec.Code != tt.status {
+			t.Errorf("%s: POST /greetings/import = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.status)
+		}
+		if n := count(); n != 2 {
+			t.Errorf("%s: %d greetings stored after a failed import, want 2", tt.name, n)
+		}
+	}
+}
+
+// TestGreetingsContentFilter checks that rejected names and messages are
+// neither stored nor greeted.
+func TestGreetingsContentFilter(t *testing.T) {
+	filter, err := contentfilter.New(contentfilter.Config{Words: []string{"darn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemory()
+	g := NewGreetings(store, paginate.NewSigner(nil))
+	g.Filter = filter
+	tr := NewTranslations(i18n.NewCatalog(store))
+	tr.Filter = filter
+	h := mux.NewRouter()
+	h.HandleFunc("/greetings", g.Create).Methods("POST")
+	h.HandleFunc("/greet", tr.Greet).Methods("GET")
+	h.HandleFunc("/greet-many", tr.GreetMany).Methods("GET")
+
+	for _, tc := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{"POST", "/greetings", `{"name": "Gladys", "message": "Darn you, Gladys"}`, http.StatusUnprocessableEntity},
+		{"POST", "/greetings", `{"name": "Darn"}`, http.StatusUnprocessableEntity},
+		{"POST", "/greetings", `{"name": "Gladys", "message": "Hi, Gladys"}`, http.StatusCreated},
+		{"GET", "/greet?name=darn", "", http.StatusUnprocessableEntity},
+		{"GET", "/greet-many?name=Gladys&name=Darn", "", http.StatusUnprocessableEntity},
+		{"GET", "/greet?name=Gladys", "", http.StatusOK},
+	} {
+		rec := serve(h, tc.method, tc.target, tc.body, nil)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s %s = %d %s, want %d", tc.method, tc.target, tc.body, rec.Code, rec.Body, tc.want)
+		}
+		if rec.Code == http.StatusUnprocessableEntity && strings.Contains(strings.ToLower(rec.Body.String()), "darn") {
+			t.Errorf("%s %s = %s, want the rejected text not echoed", tc.method, tc.target, rec.Body)
+		}
+	}
+	if recs, _ := store.List(context.Background(), GreetingsCollection, storage.ListOptions{}); len(recs) != 1 {
+		t.Errorf("stored %d greetings, want 1", len(recs))
+	}
+}
@@ -2,34 +2,194 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/Shulammite-Aso/bazel-demo-app/contentfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/normalize"
 	"github.com/Shulammite-Aso/bazel-demo-app/pkg/greetings"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
 )
 
+// defaultName is greeted when the request doesn't name anyone.
+const defaultName = "Shula"
+
+// MaxGreetMany is the most names a single GreetMany request may contain.
+const MaxGreetMany = 100000
+
+// defaultNames are greeted by GreetMany when the request doesn't name
+// anyone.
+var defaultNames = []string{"Prisca", "Nana", "Derin"}
+
+// Greet responds with a greeting for the ?name= query parameter.
 func Greet(w http.ResponseWriter, r *http.Request) {
-	log.SetPrefix("greetings: ")
-	log.SetFlags(0)
-	greeting, err := greetings.Hello("Shula")
+	greet(w, r, greetings.Check, greetings.Hello)
+}
 
+// greet greets the name of r with hello if check accepts it.
+func greet(w http.ResponseWriter, r *http.Request, check func(string) error, hello func(string) (string, error)) {
+	name := queryName(r)
+	if err := check(name); err != nil {
+		checkError(w, err)
+		return
+	}
+	greeting, err := hello(name)
 	if err != nil {
-		log.Fatal(err)
+		checkError(w, err)
+		return
 	}
 
-	w.Write([]byte(greeting))
+	respond.Text(w, http.StatusOK, greeting)
+}
 
+// queryName returns the ?name= query parameter, or defaultName without
+// one.
+func queryName(r *http.Request) string {
+	if r.URL.Query().Has("name") {
+		return r.URL.Query().Get("name")
+	}
+	return defaultName
 }
 
+// GreetMany responds with a JSON object mapping each name to a greeting.
+// Names come from repeated ?name= query parameters or, for POST, from a
+// JSON array in the body. The response is streamed, so large requests
+// don't hold every message in memory at once.
 func GreetMany(w http.ResponseWriter, r *http.Request) {
+	greetMany(w, r, greetings.Check, greetings.Hello)
+}
 
-	names := []string{"Prisca", "Nana", "Derin"}
+// greetMany greets the names of r with hello once check accepts all of
+// them, and responds once every greeting has succeeded.
+func greetMany(w http.ResponseWriter, r *http.Request, check func(string) error, hello func(string) (string, error)) {
+	names := r.URL.Query()["name"]
+	if r.Method == http.MethodPost {
+		var err error
+		if names, err = decodeNames(r); err != nil {
+			respond.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if len(names) == 0 {
+		names = defaultNames
+	}
 
-	// Request greeting messages for the names.
-	messages, err := greetings.Hellos(names)
-	if err != nil {
-		log.Fatal(err)
+	// Check and greet everything up front, keeping the messages; once
+	// streaming starts the status is already sent.
+	for _, name := range names {
+		if err := check(name); err != nil {
+			checkError(w, err)
+			return
+		}
+	}
+	type greeting struct{ name, message string }
+	out := make([]greeting, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		message, err := hello(name)
+		if err != nil {
+			checkError(w, err)
+			return
+		}
+		out = append(out, greeting{name, message})
+	}
+
+	obj := respond.StreamObject(w, http.StatusOK)
+	for _, g := range out {
+		obj.Field(g.name, g.message)
+	}
+	obj.Close()
+}
+
+// greetManyBuffered is a rewrite of greetMany, served to a share of
+// /greet-many traffic through canary routing. It checks and greets each
+// name in one pass, keeping the messages until all have succeeded, instead
+// of checking every name before greeting any. Responses are the same.
+func greetManyBuffered(w http.ResponseWriter, r *http.Request, check func(string) error, hello func(string) (string, error)) {
+	names := r.URL.Query()["name"]
+	if r.Method == http.MethodPost {
+		var err error
+		if names, err = decodeNames(r); err != nil {
+			respond.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if len(names) == 0 {
+		names = defaultNames
+	}
+
+	type greeting struct{ name, message string }
+	out := make([]greeting, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if err := check(name); err != nil {
+			checkError(w, err)
+			return
+		}
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		message, err := hello(name)
+		if err != nil {
+			checkError(w, err)
+			return
+		}
+		out = append(out, greeting{name, message})
+	}
+
+	obj := respond.StreamObject(w, http.StatusOK)
+	for _, g := range out {
+		obj.Field(g.name, g.message)
 	}
+	obj.Close()
+}
 
-	json.NewEncoder(w).Encode(messages)
+// checkError responds to err from checking or greeting a name: 422 if the
+// content filter rejected it, 503 if the filter couldn't tell, and 400
+// otherwise.
+func checkError(w http.ResponseWriter, err error) {
+	var rejected *contentfilter.Rejection
+	switch {
+	case errors.As(err, &rejected):
+		respond.Error(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, contentfilter.ErrUnavailable):
+		respond.Error(w, http.StatusServiceUnavailable, "names can't be checked right now; try again later")
+	default:
+		respond.Error(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// decodeNames reads a JSON array of names from the request body one
+// element at a time, normalizing each like query input.
+func decodeNames(r *http.Request) ([]string, error) {
+	dec := json.NewDecoder(r.Body)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("body must be a JSON array of names")
+	}
+
+	var names []string
+	for dec.More() {
+		if len(names) == MaxGreetMany {
+			return nil, fmt.Errorf("too many names (max %d)", MaxGreetMany)
+		}
+		var name string
+		if err := dec.Decode(&name); err != nil {
+			return nil, fmt.Errorf("name %d: %v", len(names), err)
+		}
+		name, err := normalize.String(name, normalize.DefaultMaxLen)
+		if err != nil {
+			return nil, fmt.Errorf("name %d: %v", len(names), err)
+		}
+		names = append(names, name)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("body must be a JSON array of names")
+	}
+	return names, nil
 }
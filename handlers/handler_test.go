@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/pkg/greetings"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// TestGreetManyPost checks that names posted as a JSON array each get a
+// greeting, with duplicates collapsed.
+func TestGreetManyPost(t *testing.T) {
+	body := `["Gladys", "Derin", "Gladys"]`
+	req := httptest.NewRequest(http.MethodPost, "/greet-many", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	GreetMany(rec, req)
+
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GreetMany(%s) = %d %q, want 200 and a JSON object", body, rec.Code, rec.Body)
+	}
+	if len(got) != 2 || got["Gladys"] == "" || got["Derin"] == "" {
+		t.Fatalf("GreetMany(%s) = %v, want greetings for Gladys and Derin", body, got)
+	}
+}
+
+// TestGreetManyEmptyName checks that an empty name is rejected before any
+// output is streamed.
+func TestGreetManyEmptyName(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/greet-many", bytes.NewBufferString(`["Gladys", " "]`))
+	rec := httptest.NewRecorder()
+	GreetMany(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("GreetMany with empty name = %d, want 400", rec.Code)
+	}
+}
+
+// TestGreetManyBuffered checks that the canary rewrite of greetMany
+// answers exactly like the original.
+func TestGreetManyBuffered(t *testing.T) {
+	tests := []struct {
+		method, target, body string
+	}{
+		{http.MethodGet, "/greet-many", ""},
+		{http.MethodGet, "/greet-many?name=Gladys&name=Derin&name=Gladys", ""},
+		{http.MethodPost, "/greet-many", `["Derin", "Gladys", "Derin"]`},
+		{http.MethodPost, "/greet-many", `["Gladys", " "]`},
+		{http.MethodPost, "/greet-many", `{"name": "Gladys"}`},
+	}
+	// greetings.Hello picks formats at random.
+	hello := func(name string) (string, error) { return "Hi, " + name, nil }
+	for _, tt := range tests {
+		want := httptest.NewRecorder()
+		greetMany(want, httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(tt.body)), greetings.Check, hello)
+		got := httptest.NewRecorder()
+		greetManyBuffered(got, httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(tt.body)), greetings.Check, hello)
+		if got.Code != want.Code || got.Body.String() != want.Body.String() {
+			t.Errorf("greetManyBuffered(%s %s %s) = %d %q, want %d %q", tt.method, tt.target, tt.body, got.Code, got.Body, want.Code, want.Body)
+		}
+	}
+}
+
+// BenchmarkGreetMany compares the streamed GreetMany response with
+// decoding the whole request, building the whole map, and encoding it in
+// one go, for a large request.
+func BenchmarkGreetMany(b *testing.B) {
+	names := make([]string, 10000)
+	for i := range names {
+		names[i] = fmt.Sprintf("name-%d", i)
+	}
+	body, _ := json.Marshal(names)
+
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var decoded []string
+			json.Unmarshal(body, &decoded)
+			messages, _ := greetings.Hellos(decoded)
+			respond.JSON(httptest.NewRecorder(), http.StatusOK, messages)
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/greet-many", bytes.NewReader(body))
+			GreetMany(httptest.NewRecorder(), req)
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Impersonation defaults.
+const (
+	// DefaultImpersonationTTL is how long impersonation tokens last when
+	// the request doesn't say.
+	DefaultImpersonationTTL = 15 * time.Minute
+	// DefaultMaxImpersonationTTL caps how long they may last.
+	DefaultMaxImpersonationTTL = time.Hour
+)
+
+// Impersonation serves POST /admin/impersonate, which issues admins a
+// short-lived token acting as a user, for support to reproduce what the
+// user sees. Issuing it is audited, and so is every request made with it.
+type Impersonation struct {
+	Issuer *auth.Verifier
+	Audit  *audit.Log
+	// MaxTTL caps how long tokens last.
+	MaxTTL time.Duration
+	// Denied are the scopes tokens may not be issued with, such as admin.
+	// Any other scope is granted as requested, whether or not the user has
+	// it: the user's own scopes aren't known without their password.
+	Denied []string
+}
+
+// NewImpersonation returns an Impersonation handler issuing tokens with
+// issuer, valid for at most maxTTL and never granting denied, and
+// auditing to log.
+func NewImpersonation(issuer *auth.Verifier, log *audit.Log, maxTTL time.Duration, denied ...string) *Impersonation {
+	if maxTTL <= 0 {
+		maxTTL = DefaultMaxImpersonationTTL
+	}
+	return &Impersonation{Issuer: issuer, Audit: log, MaxTTL: maxTTL, Denied: denied}
+}
+
+// impersonationRequest is the body of POST /admin/impersonate. TTL is a
+// duration such as 10m; Scope lists the scopes to grant, space-separated.
+type impersonationRequest struct {
+	User   string `json:"user"`
+	TTL    string `json:"ttl"`
+	Scope  string `json:"scope"`
+	Reason string `json:"reason"`
+}
+
+// Post issues a token acting as the body's user and responds with it as
+// a login does. The body must give a reason, which is audited with the
+// token's lifetime and scopes.
+func (h *Impersonation) Post(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.FromContext(r.Context())
+	actor, _ := claims["sub"].(string)
+	var in impersonationRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	in.User, in.Reason = strings.TrimSpace(in.User), strings.TrimSpace(in.Reason)
+	if in.User == "" || in.Reason == "" {
+		respond.Error(w, http.StatusBadRequest, "user and reason are required")
+		return
+	}
+	if in.User == actor {
+		respond.Error(w, http.StatusBadRequest, "you can't impersonate yourself")
+		return
+	}
+	ttl := DefaultImpersonationTTL
+	if in.TTL != "" {
+		d, err := time.ParseDuration(in.TTL)
+		if err != nil || d <= 0 {
+			respond.Error(w, http.StatusBadRequest, "ttl must be a positive duration such as 10m")
+			return
+		}
+		ttl = d
+	}
+	if ttl > h.MaxTTL {
+		respond.Error(w, http.StatusBadRequest, "ttl may be at most "+h.MaxTTL.String())
+		return
+	}
+	scopes := strings.Fields(in.Scope)
+	for _, s := range scopes {
+		for _, d := range h.Denied {
+			if s == d {
+				respond.Error(w, http.StatusForbidden, "impersonation tokens can't grant "+s)
+				return
+			}
+		}
+	}
+
+	token, err := h.Issuer.Impersonate(claims, in.User, scopes, ttl)
+	switch {
+	case errors.Is(err, auth.ErrNestedImpersonation):
+		respond.Error(w, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, auth.ErrCannotSign):
+		respond.Error(w, http.StatusServiceUnavailable, "this server only verifies tokens; impersonate at the service that issues them")
+		return
+	case err != nil:
+		respond.Error(w, http.StatusInternalServerError, "signing token: "+err.Error())
+		return
+	}
+	// No token leaves without its entry in the trail.
+	_, err = h.Audit.Record(r.Context(), audit.Entry{Actor: actor, Action: audit.ActionImpersonate, Target: in.User, Details: map[string]interface{}{
+		"ttl":    ttl.String(),
+		"scope":  strings.Join(scopes, " "),
+		"reason": in.Reason,
+	}})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, loginResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(ttl / time.Second)})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestImpersonation checks that admins get a token acting as the user,
+// audited with their reason, and that denied scopes, overlong lifetimes
+// and missing reasons are refused.
+func TestImpersonation(t *testing.T) {
+	m := storage.NewMemory()
+	verifier, _ := auth.NewVerifier(auth.Config{SigningKey: "k", Keys: map[string]auth.Key{"k": {Secret: []byte(auth.DevSecret)}}})
+	trail := audit.NewLog(m)
+	h := NewImpersonation(verifier, trail, 0, "admin")
+	admin := jwt.MapClaims{"sub": "ada", "roles": []interface{}{"admin"}}
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"user":"gladys","reason":"ticket 12"}`, http.StatusOK},
+		{`{"user":"gladys"}`, http.StatusBadRequest},
+		{`{"user":"ada","reason":"curious"}`, http.StatusBadRequest},
+		{`{"user":"gladys","reason":"ticket 12","ttl":"2h"}`, http.StatusBadRequest},
+		{`{"user":"gladys","reason":"ticket 12","scope":"greet:write admin"}`, http.StatusForbidden},
+	}
+	var token string
+	for _, tt := range tests {
+		rec := as(h.Post, admin, "POST", "/admin/impersonate", tt.body, nil)
+		if rec.Code != tt.status {
+			t.Errorf("Post(%s) = %d %s, want %d", tt.body, rec.Code, rec.Body, tt.status)
+		}
+		if rec.Code == http.StatusOK {
+			var out loginResponse
+			json.Unmarshal(rec.Body.Bytes(), &out)
+			token = out.AccessToken
+		}
+	}
+
+	claims, err := verifier.Verify(token)
+	if actor, _ := auth.Impersonator(claims); err != nil || actor != "ada" || claims["sub"] != "gladys" {
+		t.Errorf("Verify(issued token) = %v, %v, want ada acting as gladys", claims, err)
+	}
+	if rec := as(h.Post, claims, "POST", "/admin/impersonate", `{"user":"derin","reason":"again"}`, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Post by an impersonation token = %d, want 403", rec.Code)
+	}
+	entries, _ := trail.List(context.Background(), storage.ListOptions{})
+	if len(entries) != 1 || entries[0].Action != audit.ActionImpersonate || entries[0].Actor != "ada" || entries[0].Details["reason"] != "ticket 12" {
+		t.Errorf("audit trail = %+v, want the one token issued", entries)
+	}
+}
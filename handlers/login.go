@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Login serves POST /login, which exchanges a username and password for a
+// bearer token, and, when Sessions is set, POST /token/refresh and POST
+// /logout, which renew and end the session a login starts.
+type Login struct {
+	Credentials auth.Credentials
+	// Issuer signs the tokens.
+	Issuer *auth.Verifier
+	// TTL is how long tokens are valid.
+	TTL time.Duration
+	// Claims are added to every token, such as {iss: bazel-demo-app}. A
+	// user's own claims take precedence; sub, iat and exp are always set by
+	// the login.
+	Claims map[string]interface{}
+	// Sessions, if set, keeps the refresh tokens logins are issued with.
+	Sessions *auth.Sessions
+}
+
+// NewLogin returns a Login handler checking passwords with credentials and
+// issuing tokens valid for ttl.
+func NewLogin(credentials auth.Credentials, issuer *auth.Verifier, ttl time.Duration) *Login {
+	return &Login{Credentials: credentials, Issuer: issuer, TTL: ttl}
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// loginResponse follows the OAuth 2.0 token response (RFC 6749 section
+// 5.1), so existing client libraries can read it.
+type loginResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	// ExpiresIn is the token's lifetime in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+	// RefreshToken renews the access token at POST /token/refresh. It is
+	// only set when sessions are on, and can be used once.
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Post checks the JSON body's username and password and responds with a
+// token whose sub claim is the username, and a refresh token when sessions
+// are on. Wrong credentials get 401 without
+// saying whether the user exists.
+func (h *Login) Post(w http.ResponseWriter, r *http.Request) {
+	var in loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if in.Username == "" || in.Password == "" {
+		respond.Error(w, http.StatusBadRequest, "username and password are required")
+		return
+	}
+	userClaims, err := h.Credentials.Authenticate(r.Context(), in.Username, in.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		respond.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Error("login: checking credentials")
+		respond.Error(w, http.StatusServiceUnavailable, "credentials can't be checked right now")
+		return
+	}
+
+	claims := make(jwt.MapClaims, len(h.Claims)+len(userClaims)+1)
+	for k, v := range h.Claims {
+		claims[k] = v
+	}
+	for k, v := range userClaims {
+		claims[k] = v
+	}
+	claims["sub"] = in.Username
+	var refresh string
+	if h.Sessions != nil {
+		if refresh, err = h.Sessions.Create(r.Context(), claims); err != nil {
+			logrus.WithContext(r.Context()).WithError(err).Error("login: starting session")
+			respond.Error(w, http.StatusServiceUnavailable, "sessions can't be stored right now")
+			return
+		}
+	}
+	h.issue(w, claims, refresh)
+}
+
+// Refresh exchanges the JSON body's refresh token for a new access token
+// and a new refresh token; the old one stops working. The access token
+// carries the claims of the original login.
+func (h *Login) Refresh(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeRefresh(w, r)
+	if !ok {
+		return
+	}
+	claims, refresh, err := h.Sessions.Rotate(r.Context(), in.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		respond.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Error("login: refreshing session")
+		respond.Error(w, http.StatusServiceUnavailable, "sessions can't be loaded right now")
+		return
+	}
+	h.issue(w, claims, refresh)
+}
+
+// Logout revokes the JSON body's refresh token, ending its session. It
+// responds 204 whether or not the token was valid. Access tokens already
+// issued stay valid until they expire, which TTL bounds.
+func (h *Login) Logout(w http.ResponseWriter, r *http.Request) {
+	in, ok := decodeRefresh(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Sessions.Revoke(r.Context(), in.RefreshToken); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Error("login: ending session")
+		respond.Error(w, http.StatusServiceUnavailable, "sessions can't be revoked right now")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeRefresh(w http.ResponseWriter, r *http.Request) (refreshRequest, bool) {
+	var in refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return in, false
+	}
+	if in.RefreshToken == "" {
+		respond.Error(w, http.StatusBadRequest, "refresh_token is required")
+		return in, false
+	}
+	return in, true
+}
+
+// issue responds with an access token carrying claims, and refresh if set.
+func (h *Login) issue(w http.ResponseWriter, claims jwt.MapClaims, refresh string) {
+	token, err := h.Issuer.Issue(claims, h.TTL)
+	if errors.Is(err, auth.ErrCannotSign) {
+		respond.Error(w, http.StatusServiceUnavailable, "this server only verifies tokens; log in at the service that issues them")
+		return
+	}
+	if err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, loginResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(h.TTL / time.Second),
+		RefreshToken: refresh,
+	})
+}
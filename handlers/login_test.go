@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+)
+
+// TestLogin logs in with good and bad credentials, checks the claims of
+// the token issued, and refreshes it until logging out.
+func TestLogin(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	users := auth.StaticCredentials{"gladys": {
+		PasswordHash: string(hash),
+		Claims:       map[string]interface{}{"role": "admin", "sub": "root"},
+	}}
+	verifier, err := auth.NewVerifier(auth.Config{SigningKey: "k", Keys: map[string]auth.Key{"k": {Secret: []byte("s")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewLogin(users, verifier, 15*time.Minute)
+	h.Claims = map[string]interface{}{"iss": "bazel-demo-app", "role": "user"}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"right password", `{"username":"gladys","password":"hunter2"}`, http.StatusOK},
+		{"wrong password", `{"username":"gladys","password":"hunter3"}`, http.StatusUnauthorized},
+		{"unknown user", `{"username":"derin","password":"hunter2"}`, http.StatusUnauthorized},
+		{"no password", `{"username":"gladys"}`, http.StatusBadRequest},
+		{"not JSON", `username=gladys`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := serve(http.HandlerFunc(h.Post), "POST", "/login", tt.body, nil)
+		if rec.Code != tt.status {
+			t.Errorf("%s: POST /login = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.status)
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var resp loginResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if resp.TokenType != "Bearer" || resp.ExpiresIn != 900 {
+			t.Errorf("%s: POST /login = %s, want a Bearer token expiring in 900s", tt.name, rec.Body)
+		}
+		claims, err := verifier.Verify(resp.AccessToken)
+		if err != nil {
+			t.Fatalf("%s: Verify(access_token): %v", tt.name, err)
+		}
+		// The user's claims override the defaults, but not sub.
+		if claims["sub"] != "gladys" || claims["role"] != "admin" || claims["iss"] != "bazel-demo-app" {
+			t.Errorf("%s: token claims = %v, want sub gladys, role admin, iss bazel-demo-app", tt.name, claims)
+		}
+	}
+
+	// Refresh and log out with the refresh token of a login.
+	h.Sessions = auth.NewSessions(cache.NewMemory(time.Hour, 0), time.Hour)
+	var resp loginResponse
+	json.Unmarshal(serve(http.HandlerFunc(h.Post), "POST", "/login", tests[0].body, nil).Body.Bytes(), &resp)
+	if resp.RefreshToken == "" {
+		t.Fatal("POST /login with sessions on returned no refresh_token")
+	}
+	spent := `{"refresh_token":"` + resp.RefreshToken + `"}`
+	rec := serve(http.HandlerFunc(h.Refresh), "POST", "/token/refresh", spent, nil)
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /token/refresh = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if claims, err := verifier.Verify(resp.AccessToken); err != nil || claims["role"] != "admin" {
+		t.Errorf("refreshed token claims = %v, %v, want the login's", claims, err)
+	}
+	if rec := serve(http.HandlerFunc(h.Refresh), "POST", "/token/refresh", spent, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /token/refresh with a spent token = %d, want 401", rec.Code)
+	}
+	current := `{"refresh_token":"` + resp.RefreshToken + `"}`
+	if rec := serve(http.HandlerFunc(h.Logout), "POST", "/logout", current, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("POST /logout = %d, want 204", rec.Code)
+	}
+	if rec := serve(http.HandlerFunc(h.Refresh), "POST", "/token/refresh", current, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /token/refresh after logout = %d, want 401", rec.Code)
+	}
+
+	verifyOnly, _ := auth.NewVerifier(auth.Config{Keys: map[string]auth.Key{"k": {Secret: []byte("s")}}})
+	h.Issuer = verifyOnly
+	if rec := serve(http.HandlerFunc(h.Post), "POST", "/login", tests[0].body, nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /login on a verify-only server = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/notify"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// templateResponse is how a notification template is rendered.
+type templateResponse struct {
+	ID string `json:"id"`
+	notify.Template
+	Version   int64             `json:"version"`
+	CreatedAt respond.Timestamp `json:"created_at"`
+	UpdatedAt respond.Timestamp `json:"updated_at"`
+}
+
+// preferencesResponse is how a user's notification preferences are
+// rendered.
+type preferencesResponse struct {
+	User string `json:"user"`
+	notify.Preferences
+	Version int64 `json:"version"`
+}
+
+// Notifications serves the notification template admin API and per-user
+// notification preferences.
+type Notifications struct {
+	Service  *notify.Service
+	validate *validator.Validate
+}
+
+// NewNotifications returns a Notifications handler using service.
+func NewNotifications(service *notify.Service) *Notifications {
+	return &Notifications{Service: service, validate: validator.New()}
+}
+
+// ListTemplates responds with every template.
+func (h *Notifications) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	recs, err := h.Service.Store.List(r.Context(), notify.TemplatesCollection, storage.ListOptions{})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	out := make([]templateResponse, 0, len(recs))
+	for _, rec := range recs {
+		var t notify.Template
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			storageError(w, r, err)
+			return
+		}
+		out = append(out, renderTemplate(r, rec, t))
+	}
+	respond.JSON(w, http.StatusOK, out)
+}
+
+// GetTemplate responds with one template and its ETag.
+func (h *Notifications) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, rec, err := h.Service.Template(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.writeTemplate(w, r, http.StatusOK, rec, t)
+}
+
+// CreateTemplate adds a template. Its ID is "<event>.<channel>", so there
+// is at most one template per event and channel.
+func (h *Notifications) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var t notify.Template
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	data, ok := h.prepareTemplate(w, t)
+	if !ok {
+		return
+	}
+	rec, err := h.Service.Store.Create(r.Context(), notify.TemplatesCollection, t.ID(), data)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/notification-templates/"+rec.ID)
+	h.writeTemplate(w, r, http.StatusCreated, rec, t)
+}
+
+// ReplaceTemplate handles PUT. The event and channel can't change, and the
+// request must carry the template's current ETag in If-Match.
+func (h *Notifications) ReplaceTemplate(w http.ResponseWriter, r *http.Request) {
+	_, rec, err := h.Service.Template(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if !respond.CheckIfMatch(w, r, respond.ETag(rec.ID, rec.Version)) {
+		return
+	}
+
+	var t notify.Template
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if t.ID() != rec.ID {
+		respond.Error(w, http.StatusBadRequest, "event and channel must match template "+rec.ID)
+		return
+	}
+	data, ok := h.prepareTemplate(w, t)
+	if !ok {
+		return
+	}
+	rec, err = h.Service.Store.Update(r.Context(), notify.TemplatesCollection, rec.ID, data, rec.Version)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.writeTemplate(w, r, http.StatusOK, rec, t)
+}
+
+// DeleteTemplate removes a template. Notifications for its event and
+// channel stop until a new one is added.
+func (h *Notifications) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.Store.Delete(r.Context(), notify.TemplatesCollection, mux.Vars(r)["id"], 0); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewTemplate renders a stored template without sending it. The body,
+// if any, is a JSON object used as the event data; otherwise placeholder
+// greeting data is used.
+func (h *Notifications) PreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	t, _, err := h.Service.Template(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	e := notify.SampleEvent(t.Event)
+	var data map[string]interface{}
+	switch err := json.NewDecoder(r.Body).Decode(&data); {
+	case errors.Is(err, io.EOF):
+	case err != nil:
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	default:
+		e = events.New(t.Event, data)
+	}
+	m, err := t.Render(e)
+	if err != nil {
+		respond.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	respond.JSON(w, http.StatusOK, m)
+}
+
+// GetPreferences responds with a user's notification preferences. Only
+// the user or an admin may read them.
+func (h *Notifications) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	user := mux.Vars(r)["user"]
+	if _, ok := actsFor(r, user); !ok {
+		respond.Error(w, http.StatusForbidden, "only the user or an admin may read their notification preferences")
+		return
+	}
+	p, rec, err := h.Service.Preferences(r.Context(), user)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.writePreferences(w, http.StatusOK, user, rec, p)
+}
+
+// PutPreferences creates or replaces a user's notification preferences,
+// for the user or an admin. Replacing existing preferences requires their
+// current ETag in If-Match.
+func (h *Notifications) PutPreferences(w http.ResponseWriter, r *http.Request) {
+	user := mux.Vars(r)["user"]
+	if _, ok := actsFor(r, user); !ok {
+		respond.Error(w, http.StatusForbidden, "only the user or an admin may change their notification preferences")
+		return
+	}
+	_, rec, err := h.Service.Preferences(r.Context(), user)
+	exists := err == nil
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		storageError(w, r, err)
+		return
+	}
+	if exists && !respond.CheckIfMatch(w, r, respond.ETag(rec.ID, rec.Version)) {
+		return
+	}
+
+	var p notify.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if err := h.validate.Struct(p); err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if exists {
+		rec, err = h.Service.Store.Update(r.Context(), notify.PreferencesCollection, user, data, rec.Version)
+	} else {
+		rec, err = h.Service.Store.Create(r.Context(), notify.PreferencesCollection, user, data)
+		status = http.StatusCreated
+	}
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.writePreferences(w, status, user, rec, p)
+}
+
+func (h *Notifications) prepareTemplate(w http.ResponseWriter, t notify.Template) (json.RawMessage, bool) {
+	if err := h.validate.Struct(t); err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if err := t.Check(); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid template: "+err.Error())
+		return nil, false
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return data, true
+}
+
+func (h *Notifications) writeTemplate(w http.ResponseWriter, r *http.Request, status int, rec storage.Record, t notify.Template) {
+	w.Header().Set("ETag", respond.ETag(rec.ID, rec.Version))
+	respond.JSON(w, status, renderTemplate(r, rec, t))
+}
+
+func (h *Notifications) writePreferences(w http.ResponseWriter, status int, user string, rec storage.Record, p notify.Preferences) {
+	w.Header().Set("ETag", respond.ETag(rec.ID, rec.Version))
+	respond.JSON(w, status, preferencesResponse{User: user, Preferences: p, Version: rec.Version})
+}
+
+func renderTemplate(r *http.Request, rec storage.Record, t notify.Template) templateResponse {
+	return templateResponse{
+		ID:        rec.ID,
+		Template:  t,
+		Version:   rec.Version,
+		CreatedAt: respond.Time(r, rec.CreatedAt),
+		UpdatedAt: respond.Time(r, rec.UpdatedAt),
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/notify"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestNotificationTemplates checks template validation and previews with
+// sample and caller-supplied data.
+func TestNotificationTemplates(t *testing.T) {
+	n := NewNotifications(notify.NewService(storage.NewMemory()))
+	h := mux.NewRouter()
+	h.HandleFunc("/notification-templates", n.CreateTemplate).Methods("POST")
+	h.HandleFunc("/notification-templates/{id}/preview", n.PreviewTemplate).Methods("POST")
+
+	if rec := serve(h, "POST", "/notification-templates", `{"event": "greeting.created", "channel": "slack", "body": "{{.data.name"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("POST with bad template syntax = %d, want 400", rec.Code)
+	}
+	rec := serve(h, "POST", "/notification-templates", `{"event": "greeting.created", "channel": "slack", "body": "Hi {{.data.name}}"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /notification-templates = %d %s, want 201", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		body string
+		code int
+		want string
+	}{
+		{"", http.StatusOK, "Hi Gladys"},
+		{`{"name": "Ada"}`, http.StatusOK, "Hi Ada"},
+		{`{"other": 1}`, http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		rec := serve(h, "POST", "/notification-templates/greeting.created.slack/preview", tt.body, nil)
+		var m notify.Message
+		json.Unmarshal(rec.Body.Bytes(), &m)
+		if rec.Code != tt.code || m.Body != tt.want {
+			t.Errorf("preview(%q) = %d %q, want %d %q", tt.body, rec.Code, m.Body, tt.code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/plans"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Plans serves /admin/plans, the configured plans, and
+// /admin/plans/assignments, which tenants and clients are on which.
+type Plans struct {
+	Service *plans.Service
+}
+
+// NewPlans returns a Plans handler managing s.
+func NewPlans(s *plans.Service) *Plans {
+	return &Plans{Service: s}
+}
+
+// plansResponse is the body of GET /admin/plans.
+type plansResponse struct {
+	Default string       `json:"default"`
+	Plans   []plans.Plan `json:"plans"`
+}
+
+// List responds with the plans, by name, and the default one.
+func (h *Plans) List(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, plansResponse{Default: h.Service.Default, Plans: h.Service.Plans()})
+}
+
+// Assignments responds with the stored assignments, oldest first.
+func (h *Plans) Assignments(w http.ResponseWriter, r *http.Request) {
+	assignments, err := h.Service.Assignments(r.Context())
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, assignments)
+}
+
+// Assign puts {subject}, tenant:<tenant> or client:<client>, on the plan
+// of the body, {"plan": "pro"}.
+func (h *Plans) Assign(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Plan string `json:"plan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	a, err := h.Service.Assign(r.Context(), mux.Vars(r)["subject"], in.Plan)
+	switch {
+	case errors.Is(err, plans.ErrInvalidSubject), errors.Is(err, plans.ErrUnknownPlan):
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		storageError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, a)
+}
+
+// Unassign returns {subject} to the default plan.
+func (h *Plans) Unassign(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.Unassign(r.Context(), mux.Vars(r)["subject"]); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
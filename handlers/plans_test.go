@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/plans"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestPlans checks that admins can assign a plan, see it, and undo it,
+// and that unknown plans and subjects are rejected.
+func TestPlans(t *testing.T) {
+	s, _ := plans.NewService(storage.NewMemory(), plans.Defaults, plans.Free)
+	h := NewPlans(s)
+	admin := jwt.MapClaims{"sub": "gladys", "roles": []interface{}{"admin"}}
+	acme := map[string]string{"subject": "tenant:acme"}
+
+	if rec := as(h.List, admin, "GET", "/admin/plans", "", nil); !strings.Contains(rec.Body.String(), `"default":"free"`) {
+		t.Errorf("List = %s, want the default plan", rec.Body)
+	}
+	if rec := as(h.Assign, admin, "PUT", "/admin/plans/assignments/tenant:acme", `{"plan":"gold"}`, acme); rec.Code != http.StatusBadRequest {
+		t.Errorf("Assign(gold) = %d, want 400", rec.Code)
+	}
+	if rec := as(h.Assign, admin, "PUT", "/admin/plans/assignments/acme", `{"plan":"pro"}`, map[string]string{"subject": "acme"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Assign(acme) = %d, want 400", rec.Code)
+	}
+	if rec := as(h.Assign, admin, "PUT", "/admin/plans/assignments/tenant:acme", `{"plan":"pro"}`, acme); rec.Code != http.StatusOK {
+		t.Errorf("Assign = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if rec := as(h.Assignments, admin, "GET", "/admin/plans/assignments", "", nil); !strings.Contains(rec.Body.String(), `"subject":"tenant:acme","plan":"pro"`) {
+		t.Errorf("Assignments = %s, want acme on pro", rec.Body)
+	}
+	if rec := as(h.Unassign, admin, "DELETE", "/admin/plans/assignments/tenant:acme", "", acme); rec.Code != http.StatusNoContent {
+		t.Errorf("Unassign = %d, want 204", rec.Code)
+	}
+	if rec := as(h.Unassign, admin, "DELETE", "/admin/plans/assignments/tenant:acme", "", acme); rec.Code != http.StatusNotFound {
+		t.Errorf("Unassign again = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/presence"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Presence serves GET /presence, the users with open streaming
+// connections.
+type Presence struct {
+	Tracker *presence.Tracker
+}
+
+// NewPresence returns a Presence handler reading from tracker.
+func NewPresence(tracker *presence.Tracker) *Presence {
+	return &Presence{Tracker: tracker}
+}
+
+// List responds with the users present in the tenant named by ?tenant=,
+// or else by the X-Tenant-ID header.
+func (h *Presence) List(w http.ResponseWriter, r *http.Request) {
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		tenant = r.Header.Get(analytics.TenantHeader)
+	}
+	if tenant == "" {
+		tenant = analytics.Anonymous
+	}
+	entries, err := h.Tracker.List(r.Context(), tenant)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if entries == nil {
+		entries = []presence.Entry{}
+	}
+	respond.JSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/operations"
+	"github.com/Shulammite-Aso/bazel-demo-app/privacy"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// OperationsPath is where operations are polled, by ID.
+const OperationsPath = "/operations/"
+
+// Privacy serves the data export and erasure requests of
+// /users/{user}/export and /users/{user}/erase. Users may make them for
+// themselves, and admins for anyone.
+type Privacy struct {
+	Service    *privacy.Service
+	Operations *operations.Manager
+}
+
+// NewPrivacy returns a Privacy handler running exports as operations of
+// ops.
+func NewPrivacy(s *privacy.Service, ops *operations.Manager) *Privacy {
+	return &Privacy{Service: s, Operations: ops}
+}
+
+// erasureRequest is the body of an erasure request. Confirm must repeat
+// the user being erased, so a stray request erases no one.
+type erasureRequest struct {
+	Confirm string `json:"confirm"`
+}
+
+// Export starts exporting everything stored about the user and responds
+// 202 with the operation, which is polled at its Location until its
+// result holds the privacy.Bundle.
+func (h *Privacy) Export(w http.ResponseWriter, r *http.Request) {
+	user := mux.Vars(r)["user"]
+	actor, ok := actsFor(r, user)
+	if !ok {
+		respond.Error(w, http.StatusForbidden, "only the user or an admin may export their data")
+		return
+	}
+	op, err := h.Operations.Start(r.Context(), privacy.ActionExport, actor, func(ctx context.Context) (interface{}, error) {
+		return h.Service.Export(ctx, actor, user)
+	})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", OperationsPath+op.ID)
+	respond.JSON(w, http.StatusAccepted, op)
+}
+
+// Erase deletes or anonymizes everything stored about the user once the
+// body confirms who, and responds with the privacy.Report.
+func (h *Privacy) Erase(w http.ResponseWriter, r *http.Request) {
+	user := mux.Vars(r)["user"]
+	actor, ok := actsFor(r, user)
+	if !ok {
+		respond.Error(w, http.StatusForbidden, "only the user or an admin may erase their data")
+		return
+	}
+	var in erasureRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Confirm != user {
+		respond.Error(w, http.StatusBadRequest, `confirm the erasure with {"confirm": "`+user+`"}`)
+		return
+	}
+	rep, err := h.Service.Erase(r.Context(), actor, user)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	respond.JSON(w, http.StatusOK, rep)
+}
+
+// Operations serves operations at OperationsPath to whoever started them,
+// and to admins.
+type Operations struct {
+	Manager *operations.Manager
+}
+
+// NewOperations returns an Operations handler reading from m.
+func NewOperations(m *operations.Manager) *Operations {
+	return &Operations{Manager: m}
+}
+
+// Get responds with the operation, asking clients to poll again after a
+// second while it is running. Other users' operations are not found.
+func (h *Operations) Get(w http.ResponseWriter, r *http.Request) {
+	op, err := h.Manager.Get(r.Context(), mux.Vars(r)["id"])
+	if err == nil && op.Owner != "" {
+		if _, ok := actsFor(r, op.Owner); !ok {
+			respond.Error(w, http.StatusNotFound, "not found")
+			return
+		}
+	}
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if !op.Done {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, op)
+}
+
+// actsFor returns the subject of r's claims, and whether it may act for
+// user: it is the user, or an admin.
+func actsFor(r *http.Request, user string) (string, bool) {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok {
+		return "", false
+	}
+	sub, _ := claims["sub"].(string)
+	return sub, sub == user || auth.Grants(claims)["admin"]
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/operations"
+	"github.com/Shulammite-Aso/bazel-demo-app/privacy"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// as serves a request to h as if it matched a route with vars and came
+// with claims.
+func as(h http.HandlerFunc, claims jwt.MapClaims, method, target, body string, vars map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req = mux.SetURLVars(req.WithContext(auth.NewContext(req.Context(), claims)), vars)
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+// TestPrivacy walks an export through its operation and an erasure
+// through its confirmation, and checks that users can't act for others.
+func TestPrivacy(t *testing.T) {
+	m := storage.NewMemory()
+	ctx := context.Background()
+	m.Create(ctx, GreetingsCollection, "a", json.RawMessage(`{"name":"gladys","message":"Hi"}`))
+	svc, _ := privacy.NewService(m, audit.NewLog(m), privacy.Source{Collection: GreetingsCollection, Field: "name", Erase: privacy.Anonymize})
+	ops := operations.NewManager(m)
+	h, poll := NewPrivacy(svc, ops), NewOperations(ops)
+	gladys, derin := jwt.MapClaims{"sub": "gladys"}, jwt.MapClaims{"sub": "derin"}
+	user := map[string]string{"user": "gladys"}
+
+	if rec := as(h.Export, derin, "POST", "/users/gladys/export", "", user); rec.Code != http.StatusForbidden {
+		t.Errorf("Export by another user = %d, want 403", rec.Code)
+	}
+	rec := as(h.Export, gladys, "POST", "/users/gladys/export", "", user)
+	if rec.Code != http.StatusAccepted || !strings.HasPrefix(rec.Header().Get("Location"), OperationsPath) {
+		t.Fatalf("Export = %d with Location %q, want 202 and an operation", rec.Code, rec.Header().Get("Location"))
+	}
+	ops.Wait()
+	id := strings.TrimPrefix(rec.Header().Get("Location"), OperationsPath)
+	if rec := as(poll.Get, derin, "GET", OperationsPath+id, "", map[string]string{"id": id}); rec.Code != http.StatusNotFound {
+		t.Errorf("Get(operation) by another user = %d, want 404", rec.Code)
+	}
+	rec = as(poll.Get, gladys, "GET", OperationsPath+id, "", map[string]string{"id": id})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"done":true`) || !strings.Contains(rec.Body.String(), `"message":"Hi"`) {
+		t.Errorf("Get(operation) = %d %s, want the finished export", rec.Code, rec.Body)
+	}
+
+	if rec := as(h.Erase, gladys, "POST", "/users/gladys/erase", `{"confirm":"derin"}`, user); rec.Code != http.StatusBadRequest {
+		t.Errorf("Erase without confirming = %d, want 400", rec.Code)
+	}
+	admin := jwt.MapClaims{"sub": "root", "roles": []interface{}{"admin"}}
+	rec = as(h.Erase, admin, "POST", "/users/gladys/erase", `{"confirm":"gladys"}`, user)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"verified":true`) {
+		t.Errorf("Erase by an admin = %d %s, want a verified erasure", rec.Code, rec.Body)
+	}
+
+	rec = serve(http.HandlerFunc(NewAudit(audit.NewLog(m)).List), "GET", "/admin/audit?limit=1", "", nil)
+	var entries []audit.Entry
+	json.Unmarshal(rec.Body.Bytes(), &entries)
+	if len(entries) != 1 || entries[0].Action != privacy.ActionErase || entries[0].Actor != "root" {
+		t.Errorf("List(limit=1) = %s, want the erasure, the latest entry", rec.Body)
+	}
+}
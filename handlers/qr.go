@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/qr"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Bounds of the ?size= of /qr, in pixels.
+const (
+	DefaultQRSize = 256
+	MaxQRSize     = 2048
+)
+
+// QR serves /qr: QR codes of arbitrary data as PNG or SVG images.
+type QR struct {
+	// Cache keeps rendered images, so popular codes aren't encoded again;
+	// nil renders every request.
+	Cache cache.Cache
+}
+
+// NewQR returns a QR handler caching images in c, which may be nil.
+func NewQR(c cache.Cache) *QR {
+	return &QR{Cache: c}
+}
+
+// Get responds with the QR code of ?data=, ?size= pixels wide (256 by
+// default), at error correction ?level= L, M (the default), Q or H.
+// ?format=png or svg picks the format; without it, clients accepting
+// image/svg+xml get SVG and others PNG. A query always renders the same
+// image, so responses may be cached for a day and revalidated by ETag.
+func (h *QR) Get(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	data := q.Get("data")
+	if data == "" {
+		respond.Error(w, http.StatusBadRequest, "data is required")
+		return
+	}
+	size := DefaultQRSize
+	if s := q.Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxQRSize {
+			respond.Error(w, http.StatusBadRequest, fmt.Sprintf("size must be an integer from 1 to %d", MaxQRSize))
+			return
+		}
+		size = n
+	}
+	level := qr.M
+	if s := q.Get("level"); s != "" {
+		var err error
+		if level, err = qr.ParseLevel(s); err != nil {
+			respond.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	format := q.Get("format")
+	switch format {
+	case "":
+		format = "png"
+		if strings.Contains(r.Header.Get("Accept"), "image/svg+xml") {
+			format = "svg"
+		}
+	case "png", "svg":
+	default:
+		respond.Error(w, http.StatusBadRequest, "format must be png or svg")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(data))
+	key := fmt.Sprintf("qr:%s:%d:%s:%s", format, size, level, hex.EncodeToString(sum[:]))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Add("Vary", "Accept")
+	if respond.NotModified(w, r, respond.ETag(key, 0)) {
+		return
+	}
+
+	img, err := h.render(r, key, []byte(data), size, level, format)
+	if err != nil {
+		// Errors aren't the image the caching headers describe.
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		if errors.Is(err, qr.ErrTooLong) {
+			respond.Error(w, http.StatusBadRequest, fmt.Sprintf("data is too long for a QR code at level %s", level))
+			return
+		}
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	contentType := "image/png"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(img)
+}
+
+// render returns the image of data from the cache, or encodes it and
+// caches it under key.
+func (h *QR) render(r *http.Request, key string, data []byte, size int, level qr.Level, format string) ([]byte, error) {
+	if h.Cache != nil {
+		if v, ok, err := h.Cache.Get(r.Context(), key); err == nil && ok {
+			if img, ok := v.([]byte); ok {
+				return img, nil
+			}
+		}
+	}
+	code, err := qr.Encode(data, level)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if format == "svg" {
+		err = code.SVG(&buf, size)
+	} else {
+		err = code.PNG(&buf, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if h.Cache != nil {
+		h.Cache.Set(r.Context(), key, buf.Bytes(), 0)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+)
+
+// TestQR checks the formats /qr negotiates, its validation, and that
+// codes are cached and revalidated.
+func TestQR(t *testing.T) {
+	lru := cache.NewLRU(0, 0, 0)
+	h := NewQR(lru).Get
+
+	rec := serve(http.HandlerFunc(h), "GET", "/qr?data=Gladys&size=100", "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("GET /qr = %d (%s), want a PNG", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil || img.Bounds().Dx() != 87 {
+		t.Errorf("GET /qr?size=100 = %v, %v, want an 87px PNG of 3px modules", img.Bounds(), err)
+	}
+	if lru.Len() != 1 {
+		t.Errorf("cached %d images, want 1", lru.Len())
+	}
+	etag := rec.Header().Get("ETag")
+	rec = serve(http.HandlerFunc(h), "GET", "/qr?data=Gladys&size=100", "", http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("GET /qr with If-None-Match = %d, want 304", rec.Code)
+	}
+
+	for target, accept := range map[string]string{
+		"/qr?data=Gladys&level=h":    "image/svg+xml,image/*",
+		"/qr?data=Gladys&format=svg": "",
+	} {
+		rec := serve(http.HandlerFunc(h), "GET", target, "", http.Header{"Accept": {accept}})
+		if rec.Header().Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(rec.Body.String(), "<svg") {
+			t.Errorf("GET %s (Accept %q) = %s, want SVG", target, accept, rec.Header().Get("Content-Type"))
+		}
+	}
+
+	for _, target := range []string{
+		"/qr",
+		"/qr?data=Gladys&size=0",
+		"/qr?data=Gladys&level=Z",
+		"/qr?data=Gladys&format=gif",
+		"/qr?data=" + strings.Repeat("a", 1300) + "&level=H",
+	} {
+		rec := serve(http.HandlerFunc(h), "GET", target, "", nil)
+		if rec.Code != http.StatusBadRequest || rec.Header().Get("Cache-Control") == "public, max-age=86400" {
+			t.Errorf("GET %.40s = %d (Cache-Control %q), want an uncached 400", target, rec.Code, rec.Header().Get("Cache-Control"))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/querylog"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// defaultSlowQueries is how many queries /admin/queries/slow lists by
+// default.
+const defaultSlowQueries = 20
+
+// Queries serves /admin/queries/slow, the slowest recent storage queries.
+type Queries struct {
+	Log *querylog.Store
+}
+
+// NewQueries returns a Queries handler reading from log.
+func NewQueries(log *querylog.Store) *Queries {
+	return &Queries{Log: log}
+}
+
+// Slowest responds with up to ?limit= (default 20) of the recent queries,
+// slowest first.
+func (h *Queries) Slowest(w http.ResponseWriter, r *http.Request) {
+	n := defaultSlowQueries
+	if s := r.URL.Query().Get("limit"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			respond.Error(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		n = v
+	}
+	slowest := h.Log.Slowest(n)
+	if slowest == nil {
+		slowest = []querylog.Query{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, slowest)
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/querylog"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestQueriesSlowest checks that recent queries are listed and that a bad
+// limit is rejected.
+func TestQueriesSlowest(t *testing.T) {
+	log := querylog.New(storage.NewMemory(), querylog.Config{})
+	log.Get(context.Background(), "greetings", "a")
+	h := NewQueries(log)
+
+	rec := serve(http.HandlerFunc(h.Slowest), "GET", "/admin/queries/slow?limit=5", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"method":"Get"`) {
+		t.Errorf("Slowest = %d %s, want the Get listed", rec.Code, rec.Body)
+	}
+	if rec := serve(http.HandlerFunc(h.Slowest), "GET", "/admin/queries/slow?limit=all", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Slowest(limit=all) = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/approval"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/retention"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Retention serves /admin/retention/purge, which applies the retention
+// policies on demand.
+type Retention struct {
+	Purger *retention.Purger
+	// Approvals holds purges until a second admin approves them; nil
+	// purges at once.
+	Approvals *approval.Manager
+}
+
+// NewRetention returns a Retention handler purging with p once approvals
+// approves, or at once if approvals is nil.
+func NewRetention(p *retention.Purger, approvals *approval.Manager) *Retention {
+	if approvals != nil {
+		approvals.Register(KindPurge, func(ctx context.Context, _ map[string]string) (interface{}, error) {
+			return p.Purge(storage.Unscoped(ctx), false)
+		})
+	}
+	return &Retention{Purger: p, Approvals: approvals}
+}
+
+// Purge applies the retention policies and responds with what each one
+// expired and deleted. With ?dry_run=true nothing is deleted. A policy
+// that fails is reported in its result, and the response is a 500. With
+// Approvals, a purge that isn't a dry run is held for approval instead,
+// and the response is a 202 with the pending action.
+func (h *Retention) Purge(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if s := r.URL.Query().Get("dry_run"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			respond.Error(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+		dryRun = v
+	}
+	if !dryRun && h.Approvals != nil {
+		requestApproval(w, r, h.Approvals, KindPurge, nil)
+		return
+	}
+	// Policies name whole collections, whichever tenant asked.
+	results, err := h.Purger.Purge(storage.Unscoped(r.Context()), dryRun)
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, status, results)
+}
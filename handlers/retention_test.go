@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/retention"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestRetentionPurge checks that a dry run reports without deleting, that
+// a purge deletes, and that a bad dry_run is rejected.
+func TestRetentionPurge(t *testing.T) {
+	m := storage.NewMemory()
+	ctx := context.Background()
+	m.Create(ctx, GreetingsCollection, "old", json.RawMessage(`{}`))
+	p, err := retention.NewPurger(m, retention.Policy{Collection: GreetingsCollection, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetClock(func() time.Time { return time.Now().Add(2 * time.Hour) })
+	h := http.HandlerFunc(NewRetention(p, nil).Purge)
+
+	rec := serve(h, "POST", "/admin/retention/purge?dry_run=true", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"expired":1,"purged":0,"dry_run":true`) {
+		t.Errorf("Purge(dry run) = %d %s, want one expired and none purged", rec.Code, rec.Body)
+	}
+	rec = serve(h, "POST", "/admin/retention/purge", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"purged":1`) {
+		t.Errorf("Purge = %d %s, want one purged", rec.Code, rec.Body)
+	}
+	if _, err := m.Get(ctx, GreetingsCollection, "old"); err != storage.ErrNotFound {
+		t.Errorf("Get(old) after a purge = %v, want ErrNotFound", err)
+	}
+	if rec := serve(h, "POST", "/admin/retention/purge?dry_run=maybe", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Purge(dry_run=maybe) = %d, want 400", rec.Code)
+	}
+}
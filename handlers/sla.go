@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/sla"
+)
+
+// SLA serves the /admin/sla report of each endpoint's availability and
+// latency.
+type SLA struct {
+	Recorder *sla.Recorder
+	now      func() time.Time
+}
+
+// NewSLA returns an SLA handler reporting from rec.
+func NewSLA(rec *sla.Recorder) *SLA {
+	return &SLA{Recorder: rec, now: time.Now}
+}
+
+// Report responds with the service levels of every endpoint over the
+// last ?since= (a duration such as 24h or 168h; default 24h), busiest
+// first. Pending requests are flushed first, so the report is current.
+func (h *SLA) Report(w http.ResponseWriter, r *http.Request) {
+	since := sla.DefaultSince
+	if s := r.URL.Query().Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			respond.Error(w, http.StatusBadRequest, "since must be a positive duration such as 24h")
+			return
+		}
+		since = d
+	}
+	if err := h.Recorder.Flush(r.Context()); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Warn("sla: flushing before report")
+	}
+	endpoints, err := h.Recorder.Report(r.Context(), h.now().Add(-since))
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, endpoints)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/sla"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestSLAReport checks that the report includes requests not yet flushed
+// and that a bad since is rejected.
+func TestSLAReport(t *testing.T) {
+	rec := sla.NewRecorder(storage.NewMemory())
+	rec.Observe("GET /greet", http.StatusOK, 3*time.Millisecond)
+	h := NewSLA(rec)
+
+	if got := serve(http.HandlerFunc(h.Report), "GET", "/admin/sla?since=1h", "", nil); got.Code != http.StatusOK || !strings.Contains(got.Body.String(), `"route":"GET /greet"`) {
+		t.Errorf("Report(1h) = %d %s, want GET /greet's report", got.Code, got.Body)
+	}
+	if got := serve(http.HandlerFunc(h.Report), "GET", "/admin/sla?since=yesterday", "", nil); got.Code != http.StatusBadRequest {
+		t.Errorf("Report(since=yesterday) = %d, want 400", got.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/limits"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Stats serves /admin/stats, a snapshot of the process's runtime state.
+type Stats struct {
+	// Limits is what limits.Apply found and set at startup.
+	Limits  limits.Report
+	started time.Time
+}
+
+// NewStats returns a Stats handler reporting limits, counting uptime from
+// now.
+func NewStats(report limits.Report) *Stats {
+	return &Stats{Limits: report, started: time.Now()}
+}
+
+type memoryStats struct {
+	HeapAlloc uint64 `json:"heap_alloc_bytes"`
+	HeapSys   uint64 `json:"heap_sys_bytes"`
+	Sys       uint64 `json:"sys_bytes"`
+	NextGC    uint64 `json:"next_gc_bytes"`
+	NumGC     uint32 `json:"num_gc"`
+}
+
+type statsResponse struct {
+	UptimeSeconds float64       `json:"uptime_seconds"`
+	Goroutines    int           `json:"goroutines"`
+	Memory        memoryStats   `json:"memory"`
+	Limits        limits.Report `json:"limits"`
+}
+
+// Get responds with uptime, goroutine and memory figures, and the cgroup
+// limits the runtime was sized to.
+func (h *Stats) Get(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, statsResponse{
+		UptimeSeconds: time.Since(h.started).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		Memory: memoryStats{
+			HeapAlloc: m.HeapAlloc,
+			HeapSys:   m.HeapSys,
+			Sys:       m.Sys,
+			NextGC:    m.NextGC,
+			NumGC:     m.NumGC,
+		},
+		Limits: h.Limits,
+	})
+}
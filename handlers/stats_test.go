@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/limits"
+)
+
+// TestStats checks that the stats include the startup limits report.
+func TestStats(t *testing.T) {
+	report := limits.Report{
+		Detected: limits.Limits{CgroupVersion: 2, CPU: 1.5, Memory: 512 << 20},
+		Runtime:  limits.Runtime{NumCPU: 8, GOMAXPROCS: 2, GOMAXPROCSSource: "cgroup"},
+	}
+	rec := serve(http.HandlerFunc(NewStats(report).Get), "GET", "/admin/stats", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Get = %d, want 200", rec.Code)
+	}
+	var got statsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Limits != report {
+		t.Errorf("Get limits = %+v, want %+v", got.Limits, report)
+	}
+	if got.Goroutines == 0 || got.Memory.Sys == 0 {
+		t.Errorf("Get = %+v, want runtime figures", got)
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/status"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// statusPage renders a status.Summary for browsers.
+var statusPage = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Service status</title></head>
+<body>
+<h1>Service status: {{.Status}}</h1>
+<h2>Components</h2>
+<ul>{{range .Components}}
+<li>{{.Name}}: {{.Status}}</li>{{end}}
+</ul>
+<h2>Incidents</h2>
+{{range .Incidents}}<article>
+<h3>{{.Title}} ({{.Status}})</h3>
+<p>Started {{.StartedAt.Format "2006-01-02 15:04 MST"}}{{with .ResolvedAt}}, resolved {{.Format "2006-01-02 15:04 MST"}}{{end}}</p>
+{{with .Message}}<p>{{.}}</p>{{end}}
+</article>
+{{else}}<p>No recent incidents.</p>
+{{end}}<footer>Updated {{.UpdatedAt.Format "2006-01-02 15:04:05 MST"}}</footer>
+</body>
+</html>
+`))
+
+// Status serves the public status page, the internal health report, and
+// the admin API for incidents.
+type Status struct {
+	Reporter *status.Reporter
+	validate *validator.Validate
+}
+
+// NewStatus returns a Status handler using reporter.
+func NewStatus(reporter *status.Reporter) *Status {
+	return &Status{Reporter: reporter, validate: validator.New()}
+}
+
+// Page responds with the public status summary. It never includes check
+// errors or other internal detail. Browsers, and ?format=html, get an
+// HTML page; everyone else gets JSON.
+func (h *Status) Page(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Reporter.Summary(r.Context())
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	w.Header().Add("Vary", "Accept")
+	if wantsHTML(r) {
+		respond.HTML(w, http.StatusOK, statusPage, s)
+		return
+	}
+	respond.JSON(w, http.StatusOK, s)
+}
+
+// Health is the liveness probe: it responds 200 whenever the process is
+// serving requests, whatever state its dependencies are in, so an outage
+// elsewhere doesn't get the process restarted.
+func (h *Status) Health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready is the readiness probe: it responds with the result of every
+// check, including error detail, with 503 until the server has started
+// and every check passes, and again once it is shutting down. It is for
+// load balancers and operators, not the public.
+func (h *Status) Ready(w http.ResponseWriter, r *http.Request) {
+	rd := h.Reporter.Readiness(r.Context())
+	code := http.StatusOK
+	if !rd.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, code, rd)
+}
+
+// ListIncidents responds with every incident, including old ones.
+func (h *Status) ListIncidents(w http.ResponseWriter, r *http.Request) {
+	recs, err := h.Reporter.Store.List(r.Context(), status.IncidentsCollection, storage.ListOptions{})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	out := make([]status.PublicIncident, 0, len(recs))
+	for _, rec := range recs {
+		var in status.Incident
+		if err := json.Unmarshal(rec.Data, &in); err != nil {
+			storageError(w, r, err)
+			return
+		}
+		out = append(out, status.PublicIncident{ID: rec.ID, Incident: in})
+	}
+	respond.JSON(w, http.StatusOK, out)
+}
+
+// CreateIncident adds an incident.
+func (h *Status) CreateIncident(w http.ResponseWriter, r *http.Request) {
+	in, data, ok := h.decodeIncident(w, r)
+	if !ok {
+		return
+	}
+	rec, err := h.Reporter.Store.Create(r.Context(), status.IncidentsCollection, uuid.NewString(), data)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/admin/incidents/"+rec.ID)
+	w.Header().Set("ETag", respond.ETag(rec.ID, rec.Version))
+	respond.JSON(w, http.StatusCreated, status.PublicIncident{ID: rec.ID, Incident: in})
+}
+
+// ReplaceIncident handles PUT, typically to post an update or resolve the
+// incident. The request must carry the current ETag in If-Match.
+func (h *Status) ReplaceIncident(w http.ResponseWriter, r *http.Request) {
+	rec, err := h.Reporter.Store.Get(r.Context(), status.IncidentsCollection, mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if !respond.CheckIfMatch(w, r, respond.ETag(rec.ID, rec.Version)) {
+		return
+	}
+	in, data, ok := h.decodeIncident(w, r)
+	if !ok {
+		return
+	}
+	rec, err = h.Reporter.Store.Update(r.Context(), status.IncidentsCollection, rec.ID, data, rec.Version)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", respond.ETag(rec.ID, rec.Version))
+	respond.JSON(w, http.StatusOK, status.PublicIncident{ID: rec.ID, Incident: in})
+}
+
+// DeleteIncident removes an incident from the page entirely.
+func (h *Status) DeleteIncident(w http.ResponseWriter, r *http.Request) {
+	if err := h.Reporter.Store.Delete(r.Context(), status.IncidentsCollection, mux.Vars(r)["id"], 0); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeIncident reads and validates an incident. Resolved incidents must
+// say when they were resolved, so they age off the public page.
+func (h *Status) decodeIncident(w http.ResponseWriter, r *http.Request) (status.Incident, json.RawMessage, bool) {
+	var in status.Incident
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return in, nil, false
+	}
+	if err := h.validate.Struct(in); err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return in, nil, false
+	}
+	if in.Status == status.Resolved && in.ResolvedAt == nil {
+		respond.Error(w, http.StatusBadRequest, "resolved incidents need resolved_at")
+		return in, nil, false
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return in, nil, false
+	}
+	return in, data, true
+}
+
+// wantsHTML reports whether r asked for an HTML response.
+func wantsHTML(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "html"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/health"
+	"github.com/Shulammite-Aso/bazel-demo-app/status"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestStatusPage checks that /status hides check errors that /readyz
+// reports, and that incident text is escaped on the HTML page.
+func TestStatusPage(t *testing.T) {
+	checks := health.NewRegistry()
+	checks.Register("storage", 0, func(context.Context) error { return errors.New("dial tcp 10.0.0.7:5432") })
+	st := NewStatus(&status.Reporter{Store: storage.NewMemory(), Health: checks})
+	h := mux.NewRouter()
+	h.HandleFunc("/status", st.Page).Methods("GET")
+	h.HandleFunc("/readyz", st.Ready).Methods("GET")
+	h.HandleFunc("/admin/incidents", st.CreateIncident).Methods("POST")
+
+	rec := serve(h, "POST", "/admin/incidents", `{"title": "<script>x()</script>", "status": "investigating", "impact": "minor", "started_at": "2026-01-02T03:04:05Z"}`, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /admin/incidents = %d %s, want 201", rec.Code, rec.Body)
+	}
+
+	rec = serve(h, "GET", "/status", "", nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "10.0.0.7") {
+		t.Fatalf("GET /status = %d %s, want 200 without check errors", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"status":"major_outage"`) {
+		t.Errorf("GET /status = %s, want major_outage", rec.Body)
+	}
+
+	rec = serve(h, "GET", "/status", "", http.Header{"Accept": {"text/html"}})
+	if body := rec.Body.String(); !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || strings.Contains(body, "<script>") {
+		t.Errorf("GET /status as HTML = %q %s, want escaped HTML", rec.Header().Get("Content-Type"), body)
+	}
+
+	st.Reporter.SetStarted(true)
+	if rec := serve(h, "GET", "/readyz", "", nil); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "10.0.0.7") {
+		t.Errorf("GET /readyz = %d %s, want 503 with the check error", rec.Code, rec.Body)
+	}
+}
+
+// TestProbes checks that /healthz answers whatever the checks say, and
+// that /readyz waits for the server to start and for dependencies.
+func TestProbes(t *testing.T) {
+	upstream := errors.New("upstream unreachable")
+	checks := health.NewRegistry()
+	checks.RegisterDependency("upstream", 0, func(context.Context) error { return upstream })
+	st := NewStatus(&status.Reporter{Store: storage.NewMemory(), Health: checks})
+	h := mux.NewRouter()
+	h.HandleFunc("/healthz", st.Health).Methods("GET")
+	h.HandleFunc("/readyz", st.Ready).Methods("GET")
+
+	if rec := serve(h, "GET", "/healthz", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200 while a dependency is down", rec.Code)
+	}
+	upstream = nil
+	if rec := serve(h, "GET", "/readyz", "", nil); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"started":false`) {
+		t.Errorf("GET /readyz before starting = %d %s, want 503 not started", rec.Code, rec.Body)
+	}
+	st.Reporter.SetStarted(true)
+	if rec := serve(h, "GET", "/readyz", "", nil); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"upstream"`) {
+		t.Errorf("GET /readyz once started = %d %s, want 200 with the upstream check", rec.Code, rec.Body)
+	}
+}
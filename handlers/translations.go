@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/contentfilter"
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/locale"
+	"github.com/Shulammite-Aso/bazel-demo-app/pipeline"
+	"github.com/Shulammite-Aso/bazel-demo-app/pkg/greetings"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/tts"
+)
+
+// translationResponse is how a stored translation is rendered.
+type translationResponse struct {
+	Lang string `json:"lang"`
+	i18n.Translation
+	Version   int64             `json:"version"`
+	CreatedAt respond.Timestamp `json:"created_at"`
+	UpdatedAt respond.Timestamp `json:"updated_at"`
+}
+
+// Translations serves localized greetings from a catalog and the admin
+// API that edits the catalog's stored translations. Every change reloads
+// the catalog, so new languages are served straight away.
+type Translations struct {
+	Catalog *i18n.Catalog
+	// Pipeline generates the greetings; by default it localizes them from
+	// Catalog and renders them.
+	Pipeline *pipeline.Pipeline
+	// Filter, if set, rejects names before they are greeted.
+	Filter *contentfilter.Filter
+	// Speaker speaks the greetings of Audio.
+	Speaker  *tts.Speaker
+	validate *validator.Validate
+}
+
+// NewTranslations returns a Translations handler using catalog.
+func NewTranslations(catalog *i18n.Catalog) *Translations {
+	return &Translations{Catalog: catalog, Pipeline: pipeline.Default(catalog), validate: validator.New()}
+}
+
+// Greet is like the package-level Greet but answers in the best catalog
+// language for the request.
+func (h *Translations) Greet(w http.ResponseWriter, r *http.Request) {
+	greet(w, r, h.check(r), h.hello(w, r))
+}
+
+// GreetMany is like the package-level GreetMany but answers in the best
+// catalog language for the request.
+func (h *Translations) GreetMany(w http.ResponseWriter, r *http.Request) {
+	greetMany(w, r, h.check(r), h.hello(w, r))
+}
+
+// GreetManyBuffered is GreetMany through greetManyBuffered, the canary
+// variant of /greet-many.
+func (h *Translations) GreetManyBuffered(w http.ResponseWriter, r *http.Request) {
+	greetManyBuffered(w, r, h.check(r), h.hello(w, r))
+}
+
+// Audio responds with the greeting of Greet spoken in ?voice=, by default
+// the greeting's language. The audio is streamed from the speaker's store
+// rather than buffered.
+func (h *Translations) Audio(w http.ResponseWriter, r *http.Request) {
+	name := queryName(r)
+	if err := h.check(r)(name); err != nil {
+		checkError(w, err)
+		return
+	}
+	greeting, err := h.hello(w, r)(name)
+	if err != nil {
+		checkError(w, err)
+		return
+	}
+	voice := r.URL.Query().Get("voice")
+	if voice == "" {
+		voice = w.Header().Get("Content-Language")
+	}
+
+	audio, info, err := h.Speaker.Speak(r.Context(), greeting, voice)
+	switch {
+	case errors.Is(err, tts.ErrVoice):
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		logrus.WithContext(r.Context()).WithError(err).Error("tts: synthesizing greeting")
+		respond.Error(w, http.StatusServiceUnavailable, "audio can't be synthesized right now; try again later")
+		return
+	}
+	defer audio.Close()
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, audio); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Warn("tts: streaming audio")
+	}
+}
+
+// check returns a check of names for r: that they can be greeted, and
+// that the content filter lets them through.
+func (h *Translations) check(r *http.Request) func(string) error {
+	return func(name string) error {
+		if err := greetings.Check(name); err != nil {
+			return err
+		}
+		return h.Filter.Check(r.Context(), "name", name)
+	}
+}
+
+// hello returns a Hello running the pipeline for r's languages. Each
+// greeting advertises the language the pipeline put it in, if any, in
+// Content-Language; streamed responses send the first greeting's.
+func (h *Translations) hello(w http.ResponseWriter, r *http.Request) func(string) (string, error) {
+	prefs := locale.Preferences(r)
+	return func(name string) (string, error) {
+		g, err := h.Pipeline.Greet(r.Context(), name, prefs...)
+		if err == nil && g.Lang != language.Und {
+			w.Header().Set("Content-Language", g.Lang.String())
+		}
+		return g.Message, err
+	}
+}
+
+// List responds with every stored translation. The built-in English
+// formats are only listed if they have been overridden.
+func (h *Translations) List(w http.ResponseWriter, r *http.Request) {
+	recs, err := h.Catalog.Store.List(r.Context(), i18n.TranslationsCollection, storage.ListOptions{})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	out := make([]translationResponse, 0, len(recs))
+	for _, rec := range recs {
+		var t i18n.Translation
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			storageError(w, r, err)
+			return
+		}
+		out = append(out, renderTranslation(r, rec, t))
+	}
+	respond.JSON(w, http.StatusOK, out)
+}
+
+// Get responds with the stored translation for {lang}.
+func (h *Translations) Get(w http.ResponseWriter, r *http.Request) {
+	lang, ok := h.lang(w, r)
+	if !ok {
+		return
+	}
+	rec, err := h.Catalog.Store.Get(r.Context(), i18n.TranslationsCollection, lang)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	var t i18n.Translation
+	if err := json.Unmarshal(rec.Data, &t); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.write(w, r, http.StatusOK, rec, t)
+}
+
+// Put creates or replaces the translation for {lang}. Replacing an
+// existing translation requires its current ETag in If-Match; with
+// If-None-Match: * the request only creates, and gets 412 if the
+// translation exists, as it does if another request creates it first.
+func (h *Translations) Put(w http.ResponseWriter, r *http.Request) {
+	lang, ok := h.lang(w, r)
+	if !ok {
+		return
+	}
+	rec, err := h.Catalog.Store.Get(r.Context(), i18n.TranslationsCollection, lang)
+	exists := err == nil
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		storageError(w, r, err)
+		return
+	}
+	if exists && r.Header.Get("If-None-Match") == "*" {
+		respond.PreconditionFailed(w, respond.ETag(rec.ID, rec.Version))
+		return
+	}
+	if exists && !respond.CheckIfMatch(w, r, respond.ETag(rec.ID, rec.Version)) {
+		return
+	}
+
+	var t i18n.Translation
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if err := h.validate.Struct(t); err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := t.Check(); err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if exists {
+		rec, err = h.Catalog.Store.Update(r.Context(), i18n.TranslationsCollection, lang, data, rec.Version)
+	} else {
+		rec, err = h.Catalog.Store.Create(r.Context(), i18n.TranslationsCollection, lang, data)
+		status = http.StatusCreated
+	}
+	if errors.Is(err, storage.ErrExists) {
+		respond.Error(w, http.StatusPreconditionFailed, "translation was created meanwhile; fetch it and retry with If-Match")
+		return
+	}
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.reload(r)
+	h.write(w, r, status, rec, t)
+}
+
+// Delete removes the stored translation for {lang}. Deleting an English
+// override restores the built-in formats.
+func (h *Translations) Delete(w http.ResponseWriter, r *http.Request) {
+	lang, ok := h.lang(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Catalog.Store.Delete(r.Context(), i18n.TranslationsCollection, lang, 0); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.reload(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lang returns the canonical form of the {lang} path variable, so "pt-br"
+// and "pt-BR" name the same translation.
+func (h *Translations) lang(w http.ResponseWriter, r *http.Request) (string, bool) {
+	tag, err := i18n.ParseLang(mux.Vars(r)["lang"])
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid language tag")
+		return "", false
+	}
+	return tag.String(), true
+}
+
+// reload refreshes the catalog after a change. The change is already
+// stored, so a failure here only delays it until the next periodic reload.
+func (h *Translations) reload(r *http.Request) {
+	if err := h.Catalog.Reload(r.Context()); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Warn("i18n: reloading catalog after change")
+	}
+}
+
+func (h *Translations) write(w http.ResponseWriter, r *http.Request, status int, rec storage.Record, t i18n.Translation) {
+	w.Header().Set("ETag", respond.ETag(rec.ID, rec.Version))
+	respond.JSON(w, status, renderTranslation(r, rec, t))
+}
+
+func renderTranslation(r *http.Request, rec storage.Record, t i18n.Translation) translationResponse {
+	return translationResponse{
+		Lang:        rec.ID,
+		Translation: t,
+		Version:     rec.Version,
+		CreatedAt:   respond.Time(r, rec.CreatedAt),
+		UpdatedAt:   respond.Time(r, rec.UpdatedAt),
+	}
+}
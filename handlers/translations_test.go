@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/text/language"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/objectstore"
+	"github.com/Shulammite-Aso/bazel-demo-app/pipeline"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/tts"
+)
+
+// TestTranslationsHotReload checks that a translation added through the
+// admin API is served by /greet without a restart, and that deleting it
+// falls back to English.
+func TestTranslationsHotReload(t *testing.T) {
+	tr := NewTranslations(i18n.NewCatalog(storage.NewMemory()))
+	h := mux.NewRouter()
+	h.HandleFunc("/greet", tr.Greet).Methods("GET")
+	h.HandleFunc("/greeting-translations/{lang}", tr.Put).Methods("PUT")
+	h.HandleFunc("/greeting-translations/{lang}", tr.Delete).Methods("DELETE")
+	pt := http.Header{"Accept-Language": {"pt-BR"}}
+
+	if rec := serve(h, "PUT", "/greeting-translations/pt", `{"formats": ["hola %d"]}`, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("PUT with a bad format = %d, want 400", rec.Code)
+	}
+	if rec := serve(h, "PUT", "/greeting-translations/pt", `{"formats": ["Oi, %v!"]}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT /greeting-translations/pt = %d %s, want 201", rec.Code, rec.Body)
+	}
+
+	rec := serve(h, "GET", "/greet?name=Gladys", "", pt)
+	if got := rec.Body.String(); got != "Oi, Gladys!" || rec.Header().Get("Content-Language") != "pt" {
+		t.Fatalf("GET /greet in pt = %q (%s), want %q (pt)", got, rec.Header().Get("Content-Language"), "Oi, Gladys!")
+	}
+
+	if rec := serve(h, "DELETE", "/greeting-translations/pt", "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE /greeting-translations/pt = %d, want 204", rec.Code)
+	}
+	if rec := serve(h, "GET", "/greet?name=Gladys", "", pt); rec.Header().Get("Content-Language") != "en" {
+		t.Fatalf("GET /greet after delete Content-Language = %q, want en", rec.Header().Get("Content-Language"))
+	}
+}
+
+// TestTranslationsCreate checks that If-None-Match: * only creates, and
+// that losing a race to create a translation gets 412 rather than 409.
+func TestTranslationsCreate(t *testing.T) {
+	store := &racingStore{Store: storage.NewMemory()}
+	tr := NewTranslations(i18n.NewCatalog(store))
+	h := mux.NewRouter()
+	h.HandleFunc("/greeting-translations/{lang}", tr.Put).Methods("PUT")
+	createOnly := http.Header{"If-None-Match": {"*"}}
+
+	if rec := serve(h, "PUT", "/greeting-translations/pt", `{"formats": ["Oi, %v!"]}`, createOnly); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT with If-None-Match: * = %d %s, want 201", rec.Code, rec.Body)
+	}
+	rec := serve(h, "PUT", "/greeting-translations/pt", `{"formats": ["Olá, %v!"]}`, createOnly)
+	if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("ETag") == "" {
+		t.Errorf("PUT with If-None-Match: * over a translation = %d (ETag %q), want 412 with its ETag", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	store.race = true
+	if rec := serve(h, "PUT", "/greeting-translations/es", `{"formats": ["Hola, %v!"]}`, nil); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT losing a race to create = %d %s, want 412", rec.Code, rec.Body)
+	}
+}
+
+// racingStore stands in for a store another request writes to: when race
+// is set, Get creates the record it misses before reporting it missing.
+type racingStore struct {
+	storage.Store
+	race bool
+}
+
+func (s *racingStore) Get(ctx context.Context, collection, id string) (storage.Record, error) {
+	rec, err := s.Store.Get(ctx, collection, id)
+	if s.race && errors.Is(err, storage.ErrNotFound) {
+		s.Store.Create(ctx, collection, id, []byte(`{"formats": ["%v"]}`))
+	}
+	return rec, err
+}
+
+// TestTranslationsPipeline checks that /greet and /greet-many greet
+// through the handler's pipeline.
+func TestTranslationsPipeline(t *testing.T) {
+	catalog := i18n.NewCatalog(storage.NewMemory())
+	tr := NewTranslations(catalog)
+	tr.Pipeline.Use(pipeline.Profanity([]string{"darn"}, '*'), pipeline.Emoji("👋", false))
+	h := mux.NewRouter()
+	h.HandleFunc("/greet", tr.Greet).Methods("GET")
+	h.HandleFunc("/greet-many", tr.GreetMany).Methods("GET")
+
+	rec := serve(h, "GET", "/greet?name=Darn", "", nil)
+	if got := rec.Body.String(); !strings.Contains(got, "****") || !strings.HasSuffix(got, " 👋") {
+		t.Errorf("GET /greet?name=Darn = %q, want the name masked and 👋 added", got)
+	}
+	rec = serve(h, "GET", "/greet-many?name=Darn&name=Gladys", "", nil)
+	if got := rec.Body.String(); strings.Count(got, "****") != 1 || strings.Count(got, "👋") != 2 {
+		t.Errorf("GET /greet-many = %s, want both greetings filtered and decorated", got)
+	}
+}
+
+// TestTranslationsStageError checks that a pipeline stage failing fails
+// the request, on /greet-many too, instead of sending empty greetings.
+func TestTranslationsStageError(t *testing.T) {
+	pipeline.Register("fail", func(pipeline.Spec, pipeline.Env) (pipeline.Stage, error) {
+		return func(ctx context.Context, g *pipeline.Greeting) error {
+			return errors.New("stage failed")
+		}, nil
+	})
+	catalog := i18n.NewCatalog(storage.NewMemory())
+	tr := NewTranslations(catalog)
+	p, err := pipeline.Build([]pipeline.Spec{{Type: "localize"}, {Type: "fail"}, {Type: "template"}}, pipeline.Env{Catalog: catalog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Pipeline = p
+	h := mux.NewRouter()
+	h.HandleFunc("/greet", tr.Greet).Methods("GET")
+	h.HandleFunc("/greet-many", tr.GreetMany).Methods("GET")
+	h.HandleFunc("/greet-many-buffered", tr.GreetManyBuffered).Methods("GET")
+
+	for _, target := range []string{"/greet?name=Gladys", "/greet-many?name=Gladys&name=Ada", "/greet-many-buffered?name=Gladys"} {
+		if rec := serve(h, "GET", target, "", nil); rec.Code == http.StatusOK || !strings.Contains(rec.Body.String(), "stage failed") {
+			t.Errorf("GET %s = %d %s, want the stage's error", target, rec.Code, rec.Body)
+		}
+	}
+}
+
+// TestTranslationsContentLanguage checks that Content-Language is the
+// language the pipeline greeted in, on streamed responses too, and that it
+// is the default voice of /greet/audio.
+func TestTranslationsContentLanguage(t *testing.T) {
+	catalog := i18n.NewCatalog(storage.NewMemory())
+	tr := NewTranslations(catalog)
+	tr.Pipeline = pipeline.New(pipeline.Localize(catalog), func(ctx context.Context, g *pipeline.Greeting) error {
+		g.Lang = language.French
+		return nil
+	}, pipeline.Template())
+	tr.Speaker = tts.NewSpeaker(tts.ProviderFunc(func(ctx context.Context, text, voice string) (tts.Audio, error) {
+		return tts.Audio{ContentType: "audio/mpeg", Data: []byte(voice + ": " + text)}, nil
+	}), objectstore.NewMemory(0, 0))
+	h := mux.NewRouter()
+	h.HandleFunc("/greet", tr.Greet).Methods("GET")
+	h.HandleFunc("/greet-many", tr.GreetMany).Methods("GET")
+	h.HandleFunc("/greet/audio", tr.Audio).Methods("GET")
+
+	for _, target := range []string{"/greet?name=Gladys", "/greet-many?name=Gladys&name=Ada"} {
+		if rec := serve(h, "GET", target, "", nil); rec.Header().Get("Content-Language") != "fr" {
+			t.Errorf("GET %s Content-Language = %q, want fr", target, rec.Header().Get("Content-Language"))
+		}
+	}
+	if rec := serve(h, "GET", "/greet/audio?name=Gladys", "", nil); !strings.HasPrefix(rec.Body.String(), "fr: ") {
+		t.Errorf("GET /greet/audio = %q, want it spoken in voice fr", rec.Body)
+	}
+}
+
+// TestTranslationsAudio checks that /greet/audio speaks the greeting in
+// the requested voice, defaulting to its language, and rejects bad voices.
+func TestTranslationsAudio(t *testing.T) {
+	tr := NewTranslations(i18n.NewCatalog(storage.NewMemory()))
+	tr.Speaker = tts.NewSpeaker(tts.ProviderFunc(func(ctx context.Context, text, voice string) (tts.Audio, error) {
+		return tts.Audio{ContentType: "audio/mpeg", Data: []byte(voice + ": " + text)}, nil
+	}), objectstore.NewMemory(0, 0))
+	h := mux.NewRouter()
+	h.HandleFunc("/greet/audio", tr.Audio).Methods("GET")
+
+	for target, voice := range map[string]string{
+		"/greet/audio?name=Gladys":          "en",
+		"/greet/audio?name=Gladys&voice=f5": "f5",
+	} {
+		rec := serve(h, "GET", target, "", nil)
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK || !strings.HasPrefix(body, voice+": ") || !strings.Contains(body, "Gladys") || rec.Header().Get("Content-Type") != "audio/mpeg" {
+			t.Errorf("GET %s = %d %q (%s), want Gladys greeted in voice %s as audio/mpeg", target, rec.Code, body, rec.Header().Get("Content-Type"), voice)
+		}
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(body)) {
+			t.Errorf("GET %s Content-Length = %s, want %d", target, got, len(body))
+		}
+	}
+	if rec := serve(h, "GET", "/greet/audio?voice=../x", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /greet/audio?voice=../x = %d, want 400", rec.Code)
+	}
+}
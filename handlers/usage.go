@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/metering"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Usage serves the /admin/usage records, for billing.
+type Usage struct {
+	Meter *metering.Meter
+}
+
+// NewUsage returns a Usage handler reading from meter.
+func NewUsage(meter *metering.Meter) *Usage {
+	return &Usage{Meter: meter}
+}
+
+// Report responds with usage records as JSON. ?from= and ?to= (RFC 3339)
+// select the periods starting in [from, to); ?tenant= and ?meter= filter
+// the records.
+func (h *Usage) Report(w http.ResponseWriter, r *http.Request) {
+	records, ok := h.records(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, records)
+}
+
+// Export is like Report but responds with CSV, for billing systems that
+// import files.
+func (h *Usage) Export(w http.ResponseWriter, r *http.Request) {
+	records, ok := h.records(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"tenant", "meter", "period_start", "period_end", "quantity"})
+	for _, rec := range records {
+		out.Write([]string{
+			csvSafe(rec.Tenant),
+			rec.Meter,
+			rec.PeriodStart.Format(time.RFC3339),
+			rec.PeriodEnd.Format(time.RFC3339),
+			strconv.FormatInt(rec.Quantity, 10),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Warn("metering: writing CSV export")
+	}
+}
+
+// records flushes pending usage, so exports include the latest requests,
+// and returns the records r asks for.
+func (h *Usage) records(w http.ResponseWriter, r *http.Request) ([]metering.Record, bool) {
+	q := r.URL.Query()
+	f := metering.Filter{Tenant: q.Get("tenant"), Meter: q.Get("meter")}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			respond.Error(w, http.StatusBadRequest, "from and to must be times like 2006-01-02T15:04:05Z")
+			return nil, false
+		}
+		*p.t = t
+	}
+
+	if err := h.Meter.Flush(r.Context()); err != nil {
+		logrus.WithContext(r.Context()).WithError(err).Warn("metering: flushing before export")
+	}
+	records, err := h.Meter.Query(r.Context(), f)
+	if err != nil {
+		storageError(w, r, err)
+		return nil, false
+	}
+	return records, true
+}
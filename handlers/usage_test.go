@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/metering"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestUsageExport checks the CSV export of usage records and that bad
+// times are rejected.
+func TestUsageExport(t *testing.T) {
+	m := metering.NewMeter(storage.NewMemory(), time.Hour)
+	m.SetClock(func() time.Time { return time.Date(2026, 1, 2, 12, 30, 0, 0, time.UTC) })
+	m.Add("acme", metering.Requests, 3)
+	m.Add("=cmd", metering.IDs, 1)
+	h := NewUsage(m)
+
+	rec := serve(http.HandlerFunc(h.Export), "GET", "/admin/usage/export.csv?from=2026-01-02T00:00:00Z", "", nil)
+	want := "tenant,meter,period_start,period_end,quantity\n" +
+		"'=cmd,ids_generated,2026-01-02T12:00:00Z,2026-01-02T13:00:00Z,1\n" +
+		"acme,requests,2026-01-02T12:00:00Z,2026-01-02T13:00:00Z,3\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want {
+		t.Fatalf("Export = %d %q, want %q", rec.Code, rec.Body, want)
+	}
+	if rec := serve(http.HandlerFunc(h.Report), "GET", "/admin/usage?to=2026-01-03T00:00:00Z&tenant=acme", "", nil); !strings.Contains(rec.Body.String(), `"tenant":"acme"`) {
+		t.Errorf("Report(tenant=acme) = %s, want acme's record", rec.Body)
+	}
+	if rec := serve(http.HandlerFunc(h.Report), "GET", "/admin/usage?from=yesterday", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Report(from=yesterday) = %d, want 400", rec.Code)
+	}
+}
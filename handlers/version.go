@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/buildinfo"
+	"github.com/Shulammite-Aso/bazel-demo-app/config"
+	"github.com/Shulammite-Aso/bazel-demo-app/features"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Version serves /version: what is running and with which configuration.
+type Version struct {
+	Config *config.Fingerprints
+}
+
+// NewVersion returns a Version handler reporting the fingerprints of
+// config.
+func NewVersion(fingerprints *config.Fingerprints) *Version {
+	return &Version{Config: fingerprints}
+}
+
+type versionResponse struct {
+	buildinfo.Build
+	// Features are the optional subsystems compiled in.
+	Features []string                    `json:"features"`
+	Config   config.FingerprintsSnapshot `json:"config_fingerprint"`
+}
+
+// Get responds with the build, as the version subcommand prints it, the
+// optional subsystems compiled in, and the configuration fingerprints,
+// which should match across replicas of a deployment.
+func (h *Version) Get(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, versionResponse{
+		Build:    buildinfo.Current(),
+		Features: features.Compiled(),
+		Config:   h.Config.Snapshot(),
+	})
+}
+
+// Integrity responds with the running binary's SHA-256, Go build info, and
+// Bazel stamp values, for comparing against a release.
+func Integrity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	respond.JSON(w, http.StatusOK, buildinfo.Read())
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/buildinfo"
+	"github.com/Shulammite-Aso/bazel-demo-app/config"
+)
+
+// TestVersion checks that /version reports the build fields deployments
+// and monitoring read, uncached.
+func TestVersion(t *testing.T) {
+	v := viper.New()
+	v.Set("port", 5000)
+	fp, err := config.NewFingerprints(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(http.HandlerFunc(NewVersion(fp).Get), "GET", "/version", "", nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("GET /version = %d (Cache-Control %q), want 200 no-store", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["version"] != buildinfo.Current().Version || got["go_version"] != runtime.Version() {
+		t.Errorf("GET /version = %s, want version %s and go_version %s", rec.Body, buildinfo.Current().Version, runtime.Version())
+	}
+	for _, key := range []string{"stamped", "features", "config_fingerprint"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("GET /version = %s, want a %s field", rec.Body, key)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+	"github.com/Shulammite-Aso/bazel-demo-app/webhooks"
+)
+
+// subscriptionResponse is how a webhook subscription is rendered. The
+// secret is write-only.
+type subscriptionResponse struct {
+	ID        string            `json:"id"`
+	URL       string            `json:"url"`
+	Events    []string          `json:"events"`
+	Active    bool              `json:"active"`
+	Version   int64             `json:"version"`
+	CreatedAt respond.Timestamp `json:"created_at"`
+	UpdatedAt respond.Timestamp `json:"updated_at"`
+}
+
+// Webhooks serves the /webhooks management API.
+type Webhooks struct {
+	Service  *webhooks.Service
+	validate *validator.Validate
+}
+
+// NewWebhooks returns a Webhooks handler using service.
+func NewWebhooks(service *webhooks.Service) *Webhooks {
+	return &Webhooks{Service: service, validate: validator.New()}
+}
+
+// List responds with every subscription.
+func (h *Webhooks) List(w http.ResponseWriter, r *http.Request) {
+	recs, err := h.Service.Store.List(r.Context(), webhooks.SubscriptionsCollection, storage.ListOptions{})
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	out := make([]subscriptionResponse, 0, len(recs))
+	for _, rec := range recs {
+		var sub webhooks.Subscription
+		if err := json.Unmarshal(rec.Data, &sub); err != nil {
+			storageError(w, r, err)
+			return
+		}
+		out = append(out, renderSubscription(r, rec, sub))
+	}
+	respond.JSON(w, http.StatusOK, out)
+}
+
+// Get responds with one subscription and its ETag.
+func (h *Webhooks) Get(w http.ResponseWriter, r *http.Request) {
+	sub, rec, err := h.Service.Subscription(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.write(w, r, http.StatusOK, rec, sub)
+}
+
+// Create adds a subscription. New subscriptions are active unless the
+// body says otherwise.
+func (h *Webhooks) Create(w http.ResponseWriter, r *http.Request) {
+	sub := webhooks.Subscription{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	data, ok := h.prepare(w, sub)
+	if !ok {
+		return
+	}
+	rec, err := h.Service.Store.Create(r.Context(), webhooks.SubscriptionsCollection, uuid.NewString(), data)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/webhooks/"+rec.ID)
+	h.write(w, r, http.StatusCreated, rec, sub)
+}
+
+// Replace handles PUT. An empty secret keeps the current one. The request
+// must carry the subscription's current ETag in If-Match.
+func (h *Webhooks) Replace(w http.ResponseWriter, r *http.Request) {
+	cur, rec, err := h.Service.Subscription(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if !respond.CheckIfMatch(w, r, respond.ETag(rec.ID, rec.Version)) {
+		return
+	}
+
+	var sub webhooks.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if sub.Secret == "" {
+		sub.Secret = cur.Secret
+	}
+	data, ok := h.prepare(w, sub)
+	if !ok {
+		return
+	}
+	rec, err = h.Service.Store.Update(r.Context(), webhooks.SubscriptionsCollection, rec.ID, data, rec.Version)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	h.write(w, r, http.StatusOK, rec, sub)
+}
+
+// Delete removes a subscription. Its delivery log is kept.
+func (h *Webhooks) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.Service.Store.Delete(r.Context(), webhooks.SubscriptionsCollection, mux.Vars(r)["id"], 0); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries responds with the delivery log of a subscription.
+func (h *Webhooks) Deliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, _, err := h.Service.Subscription(r.Context(), id); err != nil {
+		storageError(w, r, err)
+		return
+	}
+	log, err := h.Service.Deliveries(r.Context(), id)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	if log == nil {
+		log = []webhooks.Delivery{}
+	}
+	respond.JSON(w, http.StatusOK, log)
+}
+
+// Test sends a webhook.test event to the subscription right away, even if
+// it is inactive, and responds with the delivery result.
+func (h *Webhooks) Test(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	sub, _, err := h.Service.Subscription(r.Context(), id)
+	if err != nil {
+		storageError(w, r, err)
+		return
+	}
+	e := events.New(webhooks.TestEvent, map[string]string{"subscription_id": id})
+	respond.JSON(w, http.StatusOK, h.Service.Deliver(r.Context(), id, sub, e))
+}
+
+func (h *Webhooks) prepare(w http.ResponseWriter, sub webhooks.Subscription) (json.RawMessage, bool) {
+	if err := h.validate.Struct(sub); err != nil {
+		respond.Error(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	data, err := json.Marshal(sub)
+	if err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return data, true
+}
+
+func (h *Webhooks) write(w http.ResponseWriter, r *http.Request, status int, rec storage.Record, sub webhooks.Subscription) {
+	w.Header().Set("ETag", respond.ETag(rec.ID, rec.Version))
+	respond.JSON(w, status, renderSubscription(r, rec, sub))
+}
+
+func renderSubscription(r *http.Request, rec storage.Record, sub webhooks.Subscription) subscriptionResponse {
+	return subscriptionResponse{
+		ID:        rec.ID,
+		URL:       sub.URL,
+		Events:    sub.Events,
+		Active:    sub.Active,
+		Version:   rec.Version,
+		CreatedAt: respond.Time(r, rec.CreatedAt),
+		UpdatedAt: respond.Time(r, rec.UpdatedAt),
+	}
+}
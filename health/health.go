@@ -0,0 +1,244 @@
+// Package health is the registry of health checks. Subsystems register a
+// named check with a timeout; the status page, readiness probe, systemd
+// watchdog and healthcheck command all report from the same registry, so
+// a new check shows up everywhere at once.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// DefaultTimeout bounds checks registered without a timeout.
+const DefaultTimeout = 2 * time.Second
+
+// Check outcomes.
+const (
+	Pass    = "pass"
+	Fail    = "fail"
+	Timeout = "timeout"
+)
+
+// Func checks one thing, returning why it is unhealthy or nil.
+type Func func(ctx context.Context) error
+
+// Check is a registered check.
+type Check struct {
+	Name string
+	Func Func
+	// Timeout bounds each run of Func.
+	Timeout time.Duration
+	// Dependency marks checks of services the server needs but a restart
+	// can't fix, such as an upstream API. They count for readiness only,
+	// not liveness or the status page.
+	Dependency bool
+}
+
+// Result is the outcome of one run of a check. Error is internal detail,
+// never shown publicly.
+type Result struct {
+	Name       string        `json:"name"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	Latency    time.Duration `json:"latency_ns"`
+	Dependency bool          `json:"dependency,omitempty"`
+}
+
+// Registry holds the registered checks, in registration order. The zero
+// Registry is empty and ready to use, and a nil one has no checks.
+type Registry struct {
+	mu     sync.RWMutex
+	checks []Check
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a check of the server itself, run with timeout, or
+// DefaultTimeout if it is zero. Registering a name twice replaces the
+// check.
+func (r *Registry) Register(name string, timeout time.Duration, check Func) {
+	r.add(Check{Name: name, Func: check, Timeout: timeout})
+}
+
+// RegisterDependency is like Register for a dependency: its failures make
+// the server unready but not unhealthy.
+func (r *Registry) RegisterDependency(name string, timeout time.Duration, check Func) {
+	r.add(Check{Name: name, Func: check, Timeout: timeout, Dependency: true})
+}
+
+func (r *Registry) add(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.checks {
+		if r.checks[i].Name == c.Name {
+			r.checks[i] = c
+			return
+		}
+	}
+	r.checks = append(r.checks, c)
+}
+
+// Checks returns the registered checks.
+func (r *Registry) Checks() []Check {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Check(nil), r.checks...)
+}
+
+// Run runs the checks concurrently, dependencies too if dependencies is
+// true, and returns the results in registration order.
+func (r *Registry) Run(ctx context.Context, dependencies bool) []Result {
+	var checks []Check
+	for _, c := range r.Checks() {
+		if dependencies || !c.Dependency {
+			checks = append(checks, c)
+		}
+	}
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+func run(ctx context.Context, c Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.Func(ctx)
+	res := Result{Name: c.Name, Status: Pass, Latency: time.Since(start), Dependency: c.Dependency}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil:
+		res.Status, res.Error = Timeout, fmt.Sprintf("no answer within %s: %v", c.Timeout, err)
+	default:
+		res.Status, res.Error = Fail, err.Error()
+	}
+	return res
+}
+
+// Healthy runs every check but the dependencies and returns an error
+// naming those that failed, or nil if all passed.
+func (r *Registry) Healthy(ctx context.Context) error {
+	var failed []string
+	for _, res := range r.Run(ctx, false) {
+		if res.Status != Pass {
+			failed = append(failed, res.Name+": "+res.Error)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("unhealthy components: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Storage returns a check that store answers reads.
+func Storage(store storage.Store) Func {
+	return func(ctx context.Context) error {
+		_, err := store.Get(ctx, "status_probe", "probe")
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+}
+
+// Cache returns a check that c stores and returns values.
+func Cache(c cache.Cache) Func {
+	return func(ctx context.Context) error {
+		if err := c.Set(ctx, "status_probe", "probe", time.Minute); err != nil {
+			return err
+		}
+		if _, ok, err := c.Get(ctx, "status_probe"); err != nil {
+			return err
+		} else if !ok {
+			return errors.New("cache: probe value not found after storing it")
+		}
+		return nil
+	}
+}
+
+// HTTP returns a check that url answers a GET through client with
+// anything but a 5xx.
+func HTTP(client *http.Client, url string) Func {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// Readiness is the /readyz report.
+type Readiness struct {
+	// Ready is whether the service should be sent traffic: it has
+	// started, and every check passed.
+	Ready bool `json:"ready"`
+	// Started is false until the server is serving, and again once it is
+	// shutting down.
+	Started bool     `json:"started"`
+	Checks  []Result `json:"checks"`
+}
+
+// Fetch requests the readiness report of the server at baseURL. An
+// unready server answers 503 with its report, so that is no error.
+func Fetch(ctx context.Context, client *http.Client, baseURL string) (Readiness, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return Readiness{}, err
+	}
+	u.Path = "/readyz"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Readiness{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Readiness{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return Readiness{}, fmt.Errorf("%s: %s: %s", u, resp.Status, body)
+	}
+	var rep Readiness
+	if err := json.NewDecoder(resp.Body).Decode(&rep); err != nil {
+		return Readiness{}, fmt.Errorf("%s: decoding report: %w", u, err)
+	}
+	return rep, nil
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ok(context.Context) error     { return nil }
+func broken(context.Context) error { return errors.New("connection refused to 10.0.0.7") }
+
+// TestRun checks each outcome, that results come in registration order,
+// and that dependencies only run when asked for.
+func TestRun(t *testing.T) {
+	r := NewRegistry()
+	r.Register("storage", 0, ok)
+	r.Register("cache", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	r.RegisterDependency("upstream", 0, broken)
+	r.Register("storage", 0, broken)
+
+	got := r.Run(context.Background(), true)
+	want := []struct{ name, status string }{{"storage", Fail}, {"cache", Timeout}, {"upstream", Fail}}
+	if len(got) != len(want) {
+		t.Fatalf("Run(true) = %+v, want %d results", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Name != w.name || got[i].Status != w.status || got[i].Error == "" {
+			t.Errorf("Run(true)[%d] = %+v, want %s %s with an error", i, got[i], w.name, w.status)
+		}
+	}
+	if got[1].Latency < 10*time.Millisecond {
+		t.Errorf("cache latency = %s, want at least its 10ms timeout", got[1].Latency)
+	}
+	if got := r.Run(context.Background(), false); len(got) != 2 {
+		t.Errorf("Run(false) = %+v, want the upstream dependency left out", got)
+	}
+	if got := (*Registry)(nil).Run(context.Background(), true); len(got) != 0 {
+		t.Errorf("nil Run(true) = %+v, want no results", got)
+	}
+}
+
+// TestHealthy checks that failing checks are named in the error, and
+// that dependencies aren't.
+func TestHealthy(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+	r.Register("api", 0, ok)
+	r.RegisterDependency("upstream", 0, broken)
+	if err := r.Healthy(ctx); err != nil {
+		t.Errorf("Healthy() = %v, want nil", err)
+	}
+	r.Register("storage", 0, broken)
+	err := r.Healthy(ctx)
+	if err == nil || !strings.Contains(err.Error(), "storage") || strings.Contains(err.Error(), "api") || strings.Contains(err.Error(), "upstream") {
+		t.Errorf("Healthy() = %v, want an error naming storage only", err)
+	}
+}
+
+// TestFetch checks that an unready server's report is read rather than
+// treated as an error.
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"ready":false,"started":true,"checks":[{"name":"storage","status":"fail","error":"down","latency_ns":1000}]}`))
+	}))
+	defer srv.Close()
+
+	rd, err := Fetch(context.Background(), srv.Client(), srv.URL+"/ignored")
+	if err != nil || rd.Ready || !rd.Started || len(rd.Checks) != 1 || rd.Checks[0].Status != Fail {
+		t.Errorf("Fetch() = %+v, %v, want one failed check", rd, err)
+	}
+}
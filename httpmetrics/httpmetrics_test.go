@@ -0,0 +1,43 @@
+package httpmetrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// TestMiddleware checks that requests are counted and timed by route
+// template, method, and status, and that nothing is left in flight.
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/greetings/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "missing" {
+			http.NotFound(w, r)
+		}
+	})
+	router.Handle("/metrics", promhttp.Handler())
+	for _, target := range []string{"/greetings/1", "/greetings/2", "/greetings/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`http_requests_total{code="200",method="GET",route="/greetings/{id}"} 2`,
+		`http_requests_total{code="404",method="GET",route="/greetings/{id}"} 1`,
+		`http_request_duration_seconds_count{code="200",method="GET",route="/greetings/{id}"} 2`,
+		`http_requests_in_flight{method="GET",route="/greetings/{id}"} 0`,
+		`http_requests_in_flight{method="GET",route="/metrics"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics doesn't contain %s", want)
+		}
+	}
+}
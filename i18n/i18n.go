@@ -0,0 +1,156 @@
+// Package i18n is the greeting catalog: message formats per language, with
+// English built in and further translations kept in storage so they can be
+// changed at runtime.
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/pkg/greetings"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TranslationsCollection is the storage collection translations live in,
+// keyed by canonical BCP 47 tag.
+const TranslationsCollection = "greeting_translations"
+
+// Fallback is the language of the built-in formats, used when nothing
+// better matches.
+var Fallback = language.English
+
+// Translation is the stored set of greeting formats for one language.
+type Translation struct {
+	// Formats each contain a single %v for the name.
+	Formats []string `json:"formats" validate:"required,min=1,max=50,dive,required,max=512"`
+}
+
+// Check reports the first format that doesn't have exactly one %v or uses
+// any other verb.
+func (t Translation) Check() error {
+	for i, f := range t.Formats {
+		f = strings.ReplaceAll(f, "%%", "")
+		if strings.Count(f, "%v") != 1 || strings.Count(f, "%") != 1 {
+			return fmt.Errorf("format %d must contain exactly one %%v and no other verbs", i)
+		}
+	}
+	return nil
+}
+
+// ParseLang parses a BCP 47 language tag such as "pt-BR".
+func ParseLang(s string) (language.Tag, error) {
+	tag, err := language.Parse(s)
+	if err != nil {
+		return language.Und, err
+	}
+	if tag == language.Und {
+		return language.Und, errors.New("i18n: undetermined language")
+	}
+	return tag, nil
+}
+
+// Catalog is an in-memory snapshot of the greeting formats in every
+// language. Reload refreshes it from storage.
+type Catalog struct {
+	Store storage.Store
+
+	mu      sync.RWMutex
+	langs   []language.Tag
+	formats map[language.Tag][]string
+	matcher language.Matcher
+}
+
+// NewCatalog returns a catalog backed by store holding only the built-in
+// formats. Call Reload to pick up stored translations.
+func NewCatalog(store storage.Store) *Catalog {
+	c := &Catalog{Store: store}
+	c.set(nil)
+	return c
+}
+
+// set replaces the snapshot with the built-in formats overlaid by stored.
+func (c *Catalog) set(stored map[language.Tag][]string) {
+	formats := map[language.Tag][]string{Fallback: greetings.Formats}
+	for tag, f := range stored {
+		formats[tag] = f
+	}
+	langs := []language.Tag{Fallback}
+	for tag := range formats {
+		if tag != Fallback {
+			langs = append(langs, tag)
+		}
+	}
+	// Keep the fallback first; it's what the matcher returns when nothing
+	// matches.
+	sort.Slice(langs[1:], func(i, j int) bool { return langs[i+1].String() < langs[j+1].String() })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.formats, c.langs, c.matcher = formats, langs, language.NewMatcher(langs)
+}
+
+// Reload replaces the snapshot with the built-in formats overlaid by the
+// translations in storage.
+func (c *Catalog) Reload(ctx context.Context) error {
+	recs, err := c.Store.List(ctx, TranslationsCollection, storage.ListOptions{})
+	if err != nil {
+		return err
+	}
+	stored := make(map[language.Tag][]string, len(recs))
+	for _, rec := range recs {
+		tag, err := ParseLang(rec.ID)
+		if err != nil {
+			continue
+		}
+		var t Translation
+		if err := json.Unmarshal(rec.Data, &t); err != nil || t.Check() != nil {
+			logrus.WithField("lang", rec.ID).Warn("i18n: skipping invalid stored translation")
+			continue
+		}
+		stored[tag] = t.Formats
+	}
+	c.set(stored)
+	return nil
+}
+
+// Watch reloads the catalog every interval until ctx is done, so changes
+// made through other instances show up here too.
+func (c *Catalog) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Reload(ctx); err != nil && ctx.Err() == nil {
+				logrus.WithError(err).Error("i18n: reloading catalog")
+			}
+		}
+	}
+}
+
+// Languages returns the languages in the catalog, fallback first.
+func (c *Catalog) Languages() []language.Tag {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]language.Tag(nil), c.langs...)
+}
+
+// Match returns the best catalog language for prefs and its formats.
+func (c *Catalog) Match(prefs ...language.Tag) (language.Tag, []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, i, _ := c.matcher.Match(prefs...)
+	tag := c.langs[i]
+	return tag, c.formats[tag]
+}
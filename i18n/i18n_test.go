@@ -0,0 +1,56 @@
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"golang.org/x/text/language"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestCheck checks the format rules for translations.
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		format string
+		ok     bool
+	}{
+		{"Ol\u00e1, %v!", true},
+		{"100%% %v", true},
+		{"Hallo!", false},
+		{"%v und %v", false},
+		{"%d", false},
+	}
+	for _, tt := range tests {
+		if err := (Translation{Formats: []string{tt.format}}).Check(); (err == nil) != tt.ok {
+			t.Errorf("Check(%q) = %v, want ok %v", tt.format, err, tt.ok)
+		}
+	}
+}
+
+// TestReload checks that stored translations show up after Reload and
+// that unmatched languages fall back to English.
+func TestReload(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	c := NewCatalog(store)
+
+	if tag, _ := c.Match(language.MustParse("pt-BR")); tag != Fallback {
+		t.Fatalf("Match(pt-BR) before reload = %v, want %v", tag, Fallback)
+	}
+
+	data, _ := json.Marshal(Translation{Formats: []string{"Ol\u00e1, %v!"}})
+	store.Create(ctx, TranslationsCollection, "pt", data)
+	if err := c.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	tag, formats := c.Match(language.MustParse("pt-BR"))
+	if tag != language.Portuguese || len(formats) != 1 || formats[0] != "Ol\u00e1, %v!" {
+		t.Fatalf("Match(pt-BR) = %v, %q, want pt and the stored format", tag, formats)
+	}
+	if tag, _ := c.Match(language.Japanese); tag != Fallback {
+		t.Errorf("Match(ja) = %v, want %v", tag, Fallback)
+	}
+}
@@ -0,0 +1,139 @@
+// Package ipfilter admits or rejects requests by the address they come
+// from, matched against allowed and denied CIDR ranges. It is meant for
+// routes such as /admin/* that only an office or VPN should reach.
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// ActionDenied is the audit action recorded for a rejected request.
+const ActionDenied = "ipfilter.denied"
+
+var denied = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "ipfilter_denied_requests_total",
+	Help: "Requests rejected with 403 for the address they came from.",
+})
+
+// Filter holds the ranges requests are matched against.
+type Filter struct {
+	allow, deny []netip.Prefix
+	// Audit records every rejected request; nil records none.
+	Audit *audit.Log
+}
+
+// New returns a filter admitting addresses in allow, or any address if
+// allow is empty, unless they are in deny. Ranges are CIDRs such as
+// 10.0.0.0/8 or 2001:db8::/32; a bare address is a range of one.
+func New(allow, deny []string) (*Filter, error) {
+	f := &Filter{}
+	var err error
+	if f.allow, err = parse(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parse(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parse(ranges []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(ranges))
+	for _, s := range ranges {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("ipfilter: %q is not an address or CIDR range", s)
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("ipfilter: %q is not an address or CIDR range", s)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+// Allowed reports whether addr may make requests. Deny ranges win over
+// allow ranges. An invalid addr is only allowed when there are no allow
+// ranges.
+func (f *Filter) Allowed(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return len(f.allow) == 0
+	}
+	// IPv4 clients of a dual-stack listener show up as ::ffff:a.b.c.d.
+	addr = addr.Unmap()
+	for _, p := range f.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the peer that sent r, or the zero
+// Addr if it can't be parsed.
+func clientAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr
+}
+
+// Middleware rejects requests whose path match accepts, such as a
+// routes.Match, with 403 unless their address is Allowed. Other paths
+// pass through.
+func (f *Filter) Middleware(match func(path string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr := clientAddr(r)
+			if !match(r.URL.Path) || f.Allowed(addr) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			denied.Inc()
+			ip := addr.String()
+			if !addr.IsValid() {
+				ip = r.RemoteAddr
+			}
+			log := logrus.WithContext(r.Context()).WithFields(logrus.Fields{
+				"ip":     ip,
+				"method": r.Method,
+				"path":   r.URL.Path,
+			})
+			log.Warn("request rejected by IP filter")
+			if f.Audit != nil {
+				_, err := f.Audit.Record(r.Context(), audit.Entry{Actor: ip, Action: ActionDenied, Target: r.Method + " " + r.URL.Path})
+				if err != nil {
+					log.WithError(err).Error("audit: recording rejected request")
+				}
+			}
+			respond.Error(w, http.StatusForbidden, "requests from this address are not allowed")
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package ipfilter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestAllowed checks that deny ranges win, that allow ranges are required
+// when set, and that mapped IPv4 addresses match IPv4 ranges.
+func TestAllowed(t *testing.T) {
+	f, err := New([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.0.7", "10.1.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{
+		"10.2.3.4":        true,
+		"::ffff:10.2.3.4": true,
+		"2001:db8::1":     true,
+		"10.0.0.7":        false,
+		"10.1.2.3":        false,
+		"192.0.2.1":       false,
+		"2001:db9::1":     false,
+		"::ffff:10.1.2.3": false,
+	} {
+		if got := f.Allowed(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", addr, got, want)
+		}
+	}
+	if f.Allowed(netip.Addr{}) {
+		t.Error("Allowed(invalid) = true with allow ranges, want false")
+	}
+
+	open, _ := New(nil, []string{"192.0.2.0/24"})
+	if !open.Allowed(netip.MustParseAddr("198.51.100.1")) || open.Allowed(netip.MustParseAddr("192.0.2.9")) {
+		t.Error("Allowed without allow ranges should admit every address not denied")
+	}
+
+	if _, err := New([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Error("New(10.0.0.0/33) = nil error, want an invalid range")
+	}
+}
+
+// TestMiddleware checks that only matched paths are filtered and that
+// rejections are audited.
+func TestMiddleware(t *testing.T) {
+	f, _ := New([]string{"10.0.0.0/8"}, nil)
+	log := audit.NewLog(storage.NewMemory())
+	f.Audit = log
+	h := f.Middleware(func(path string) bool { return strings.HasPrefix(path, "/admin/") })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tc := range []struct {
+		path, addr string
+		want       int
+	}{
+		{"/admin/audit", "10.0.0.1:1234", http.StatusOK},
+		{"/admin/audit", "192.0.2.1:1234", http.StatusForbidden},
+		{"/greet", "192.0.2.1:1234", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.RemoteAddr = tc.addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("GET %s from %s = %d, want %d", tc.path, tc.addr, rec.Code, tc.want)
+		}
+	}
+
+	entries, err := log.List(context.Background(), storage.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != ActionDenied || entries[0].Actor != "192.0.2.1" || entries[0].Target != "GET /admin/audit" {
+		t.Errorf("audit entries = %+v, want one %s by 192.0.2.1", entries, ActionDenied)
+	}
+}
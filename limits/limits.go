@@ -0,0 +1,237 @@
+// Package limits detects the CPU and memory limits a container's cgroup
+// imposes, and sizes the Go runtime to them: GOMAXPROCS to the CPU quota,
+// so the scheduler doesn't run more threads than the quota pays for and
+// get throttled, and GOMEMLIMIT below the memory limit, so the GC works
+// harder before the kernel's OOM killer steps in.
+package limits
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// DefaultMemoryFraction is the share of the memory limit GOMEMLIMIT is set
+// to, leaving the rest for non-heap memory the GC doesn't account for.
+const DefaultMemoryFraction = 0.9
+
+// unlimitedMemory is the threshold above which cgroup v1 memory limits
+// mean "no limit"; the kernel reports a page-rounded math.MaxInt64.
+const unlimitedMemory = 1 << 62
+
+// Limits are the cgroup limits of the process. Zero values mean no limit.
+type Limits struct {
+	// CgroupVersion is 1 or 2, or 0 when no cgroup was found.
+	CgroupVersion int `json:"cgroup_version"`
+	// CPU is the quota in cores, such as 1.5.
+	CPU float64 `json:"cpu_limit,omitempty"`
+	// Memory is in bytes.
+	Memory int64 `json:"memory_limit_bytes,omitempty"`
+}
+
+// Runtime are the Go runtime settings in effect.
+type Runtime struct {
+	NumCPU     int `json:"num_cpu"`
+	GOMAXPROCS int `json:"gomaxprocs"`
+	// GOMEMLIMIT is math.MaxInt64 when there is no limit.
+	GOMEMLIMIT int64 `json:"gomemlimit_bytes"`
+	// Sources say where each setting came from: "cgroup", "env" or
+	// "default".
+	GOMAXPROCSSource string `json:"gomaxprocs_source"`
+	GOMEMLIMITSource string `json:"gomemlimit_source"`
+}
+
+// Report is what was detected and what was applied.
+type Report struct {
+	Detected Limits  `json:"detected"`
+	Runtime  Runtime `json:"runtime"`
+}
+
+// Detect reads the limits of the process's cgroup.
+func Detect() (Limits, error) {
+	return DetectFS(os.DirFS("/"))
+}
+
+// DetectFS reads cgroup limits from fsys, laid out like the root
+// filesystem. It returns zero Limits, with no error, when there is no
+// cgroup filesystem, as outside Linux.
+func DetectFS(fsys fs.FS) (Limits, error) {
+	f, err := fsys.Open("proc/self/cgroup")
+	if errors.Is(err, fs.ErrNotExist) {
+		return Limits{}, nil
+	}
+	if err != nil {
+		return Limits{}, fmt.Errorf("limits: %w", err)
+	}
+	defer f.Close()
+
+	// Each line is hierarchy-ID:controllers:path. cgroup v2 has a single
+	// line with ID 0 and no controllers.
+	v1 := make(map[string]string)
+	var v2 string
+	isV2 := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.SplitN(sc.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2, isV2 = parts[2], true
+			continue
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			v1[c] = parts[2]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Limits{}, fmt.Errorf("limits: reading proc/self/cgroup: %w", err)
+	}
+
+	// Hybrid hosts list both; the v1 controllers are the ones enforced.
+	cpu, hasCPU := v1["cpu"]
+	mem, hasMemory := v1["memory"]
+	if hasCPU || hasMemory {
+		l := Limits{CgroupVersion: 1}
+		if hasCPU {
+			l.CPU = cpuV1(fsys, cgroupDirs(fsys, "sys/fs/cgroup/cpu", cpu))
+		}
+		if hasMemory {
+			l.Memory = memoryV1(fsys, cgroupDirs(fsys, "sys/fs/cgroup/memory", mem))
+		}
+		return l, nil
+	}
+	if isV2 {
+		dirs := cgroupDirs(fsys, "sys/fs/cgroup", v2)
+		return Limits{CgroupVersion: 2, CPU: cpuV2(fsys, dirs), Memory: memoryV2(fsys, dirs)}, nil
+	}
+	return Limits{}, nil
+}
+
+// cgroupDirs returns the directories whose limits apply to the cgroup at
+// p, from the cgroup itself up to the mount root: a parent's limit binds
+// its children too. Without a cgroup namespace p may not exist under the
+// mount, in which case the mount root is the container's own cgroup.
+func cgroupDirs(fsys fs.FS, mount, p string) []string {
+	dir := path.Join(mount, p)
+	if _, err := fs.Stat(fsys, dir); err != nil {
+		return []string{mount}
+	}
+	var dirs []string
+	for ; dir != mount && strings.HasPrefix(dir, mount); dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	return append(dirs, mount)
+}
+
+// readFile returns the trimmed contents of name, or "" if it can't be
+// read.
+func readFile(fsys fs.FS, name string) string {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// cpuV2 returns the tightest cpu.max quota in dirs, in cores.
+func cpuV2(fsys fs.FS, dirs []string) float64 {
+	var cores float64
+	for _, d := range dirs {
+		// "max 100000", or "quota period" in microseconds.
+		fields := strings.Fields(readFile(fsys, path.Join(d, "cpu.max")))
+		if len(fields) != 2 || fields[0] == "max" {
+			continue
+		}
+		cores = tighter(cores, quota(fields[0], fields[1]))
+	}
+	return cores
+}
+
+// cpuV1 returns the tightest CFS quota in dirs, in cores.
+func cpuV1(fsys fs.FS, dirs []string) float64 {
+	var cores float64
+	for _, d := range dirs {
+		cores = tighter(cores, quota(readFile(fsys, path.Join(d, "cpu.cfs_quota_us")), readFile(fsys, path.Join(d, "cpu.cfs_period_us"))))
+	}
+	return cores
+}
+
+// quota returns quota/period, or 0 if either isn't a positive number.
+func quota(q, period string) float64 {
+	qv, err1 := strconv.ParseFloat(q, 64)
+	pv, err2 := strconv.ParseFloat(period, 64)
+	if err1 != nil || err2 != nil || qv <= 0 || pv <= 0 {
+		return 0
+	}
+	return qv / pv
+}
+
+// tighter returns the smaller non-zero limit of a and b.
+func tighter[T float64 | int64](a, b T) T {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// memoryV2 returns the tightest memory.max in dirs.
+func memoryV2(fsys fs.FS, dirs []string) int64 {
+	var limit int64
+	for _, d := range dirs {
+		n, err := strconv.ParseInt(readFile(fsys, path.Join(d, "memory.max")), 10, 64)
+		if err == nil && n > 0 {
+			limit = tighter(limit, n)
+		}
+	}
+	return limit
+}
+
+// memoryV1 returns the tightest memory.limit_in_bytes in dirs.
+func memoryV1(fsys fs.FS, dirs []string) int64 {
+	var limit int64
+	for _, d := range dirs {
+		n, err := strconv.ParseInt(readFile(fsys, path.Join(d, "memory.limit_in_bytes")), 10, 64)
+		if err == nil && n > 0 && n < unlimitedMemory {
+			limit = tighter(limit, n)
+		}
+	}
+	return limit
+}
+
+// Apply sizes the runtime to l: GOMAXPROCS to the CPU quota rounded up,
+// and GOMEMLIMIT to memoryFraction of the memory limit. Settings made
+// through the GOMAXPROCS and GOMEMLIMIT environment variables win. It
+// returns the settings in effect afterwards.
+func Apply(l Limits, memoryFraction float64) Runtime {
+	r := Runtime{NumCPU: runtime.NumCPU(), GOMAXPROCSSource: "default", GOMEMLIMITSource: "default"}
+	switch {
+	case os.Getenv("GOMAXPROCS") != "":
+		r.GOMAXPROCSSource = "env"
+	case l.CPU > 0:
+		procs := int(math.Ceil(l.CPU))
+		if procs < r.NumCPU {
+			runtime.GOMAXPROCS(procs)
+			r.GOMAXPROCSSource = "cgroup"
+		}
+	}
+	switch {
+	case os.Getenv("GOMEMLIMIT") != "":
+		r.GOMEMLIMITSource = "env"
+	case l.Memory > 0 && memoryFraction > 0:
+		debug.SetMemoryLimit(int64(float64(l.Memory) * math.Min(memoryFraction, 1)))
+		r.GOMEMLIMITSource = "cgroup"
+	}
+	r.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	// A negative limit reads the current one without changing it.
+	r.GOMEMLIMIT = debug.SetMemoryLimit(-1)
+	return r
+}
@@ -0,0 +1,95 @@
+package limits
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"testing/fstest"
+)
+
+// file returns a MapFS file holding s.
+func file(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+// TestDetectFS checks limit detection across cgroup layouts.
+func TestDetectFS(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   fstest.MapFS
+		want Limits
+	}{
+		{"no cgroups", fstest.MapFS{}, Limits{}},
+		{"v2 unlimited", fstest.MapFS{
+			"proc/self/cgroup":         file("0::/\n"),
+			"sys/fs/cgroup/cpu.max":    file("max 100000\n"),
+			"sys/fs/cgroup/memory.max": file("max\n"),
+		}, Limits{CgroupVersion: 2}},
+		{"v2 namespaced", fstest.MapFS{
+			"proc/self/cgroup":         file("0::/\n"),
+			"sys/fs/cgroup/cpu.max":    file("150000 100000\n"),
+			"sys/fs/cgroup/memory.max": file("536870912\n"),
+		}, Limits{CgroupVersion: 2, CPU: 1.5, Memory: 512 << 20}},
+		{"v2 parent limit binds", fstest.MapFS{
+			"proc/self/cgroup":                        file("0::/kubepods/pod1/app\n"),
+			"sys/fs/cgroup/kubepods/pod1/cpu.max":     file("200000 100000\n"),
+			"sys/fs/cgroup/kubepods/pod1/app/cpu.max": file("max 100000\n"),
+			"sys/fs/cgroup/kubepods/pod1/memory.max":  file("1073741824\n"),
+			"sys/fs/cgroup/kubepods/memory.max":       file("268435456\n"),
+		}, Limits{CgroupVersion: 2, CPU: 2, Memory: 256 << 20}},
+		{"v2 path outside namespace", fstest.MapFS{
+			"proc/self/cgroup":         file("0::/docker/abc\n"),
+			"sys/fs/cgroup/cpu.max":    file("50000 100000\n"),
+			"sys/fs/cgroup/memory.max": file("max\n"),
+		}, Limits{CgroupVersion: 2, CPU: 0.5}},
+		{"v1", fstest.MapFS{
+			"proc/self/cgroup":                           file("12:memory:/\n4:cpu,cpuacct:/\n0::/\n"),
+			"sys/fs/cgroup/cpu/cpu.cfs_quota_us":         file("300000\n"),
+			"sys/fs/cgroup/cpu/cpu.cfs_period_us":        file("100000\n"),
+			"sys/fs/cgroup/memory/memory.limit_in_bytes": file("2147483648\n"),
+		}, Limits{CgroupVersion: 1, CPU: 3, Memory: 2 << 30}},
+		{"v1 unlimited", fstest.MapFS{
+			"proc/self/cgroup":                           file("12:memory:/\n4:cpu,cpuacct:/\n"),
+			"sys/fs/cgroup/cpu/cpu.cfs_quota_us":         file("-1\n"),
+			"sys/fs/cgroup/cpu/cpu.cfs_period_us":        file("100000\n"),
+			"sys/fs/cgroup/memory/memory.limit_in_bytes": file("9223372036854771712\n"),
+		}, Limits{CgroupVersion: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFS(tt.fs)
+			if err != nil {
+				t.Fatalf("DetectFS() = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DetectFS() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestApply checks that limits size the runtime and that the environment
+// overrides them.
+func TestApply(t *testing.T) {
+	procs, memLimit := runtime.GOMAXPROCS(0), debug.SetMemoryLimit(-1)
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetMemoryLimit(memLimit)
+	})
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+
+	got := Apply(Limits{CgroupVersion: 2, CPU: 0.5, Memory: 1000 << 20}, 0.5)
+	if runtime.NumCPU() > 1 && (got.GOMAXPROCS != 1 || got.GOMAXPROCSSource != "cgroup") {
+		t.Errorf("Apply() GOMAXPROCS = %d (%s), want 1 (cgroup)", got.GOMAXPROCS, got.GOMAXPROCSSource)
+	}
+	if got.GOMEMLIMIT != 500<<20 || got.GOMEMLIMITSource != "cgroup" {
+		t.Errorf("Apply() GOMEMLIMIT = %d (%s), want %d (cgroup)", got.GOMEMLIMIT, got.GOMEMLIMITSource, 500<<20)
+	}
+
+	debug.SetMemoryLimit(math.MaxInt64)
+	t.Setenv("GOMEMLIMIT", "off")
+	got = Apply(Limits{Memory: 1000 << 20}, 0.5)
+	if got.GOMEMLIMIT != math.MaxInt64 || got.GOMEMLIMITSource != "env" {
+		t.Errorf("Apply() with GOMEMLIMIT set = %d (%s), want no limit (env)", got.GOMEMLIMIT, got.GOMEMLIMITSource)
+	}
+}
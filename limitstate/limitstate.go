@@ -0,0 +1,126 @@
+// Package limitstate keeps rate-limit buckets and quota counts across
+// restarts. Limiters keep answering from memory; a Syncer saves their
+// state to storage every interval and on shutdown, and restores it when
+// they are registered, so a deploy doesn't hand every client a fresh
+// burst and quota.
+package limitstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Collection is the storage collection states live in, one record per
+// registered limiter.
+const Collection = "limiter_state"
+
+// DefaultInterval is how often states are saved by default. What was
+// used since the last save is forgotten by a crash, but not by a clean
+// shutdown.
+const DefaultInterval = 30 * time.Second
+
+// Stateful is a limiter whose state can be saved and restored, such as a
+// middleware.Limiter, clients.Registry or plans.Service.
+type Stateful interface {
+	// State returns the limiter's state.
+	State() (json.RawMessage, error)
+	// Restore merges a state State returned, possibly by an earlier
+	// process, into the limiter's.
+	Restore(data json.RawMessage) error
+}
+
+// Syncer saves and restores the state of registered limiters.
+type Syncer struct {
+	Store storage.Store
+
+	mu       sync.Mutex
+	limiters map[string]Stateful
+}
+
+// NewSyncer returns a syncer keeping states in store.
+func NewSyncer(store storage.Store) *Syncer {
+	return &Syncer{Store: store, limiters: make(map[string]Stateful)}
+}
+
+// Register restores l from the state saved under name, if any, and saves
+// it under name from then on. A state that can't be read is logged and
+// skipped, as fresh limits are better than none.
+func (s *Syncer) Register(ctx context.Context, name string, l Stateful) {
+	s.mu.Lock()
+	s.limiters[name] = l
+	s.mu.Unlock()
+
+	rec, err := s.Store.Get(storage.Unscoped(ctx), Collection, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return
+	}
+	if err == nil {
+		err = l.Restore(rec.Data)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("limiter", name).Warn("limitstate: restoring state")
+	}
+}
+
+// Save saves the state of every registered limiter, returning the first
+// error but trying them all.
+func (s *Syncer) Save(ctx context.Context) error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.limiters))
+	for name := range s.limiters {
+		names = append(names, name)
+	}
+	limiters := s.limiters
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	ctx = storage.Unscoped(ctx)
+	var firstErr error
+	for _, name := range names {
+		if err := s.save(ctx, name, limiters[name]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *Syncer) save(ctx context.Context, name string, l Stateful) error {
+	data, err := l.State()
+	if err != nil {
+		return err
+	}
+	// Each save is a whole state, so the last one wins.
+	_, err = s.Store.Update(ctx, Collection, name, data, 0)
+	if errors.Is(err, storage.ErrNotFound) {
+		_, err = s.Store.Create(ctx, Collection, name, data)
+	}
+	return err
+}
+
+// Run saves every interval until ctx is done, then saves once more.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the last save needs its own.
+			if err := s.Save(context.Background()); err != nil {
+				logrus.WithError(err).Error("limitstate: final save")
+			}
+			return
+		case <-ticker.C:
+			if err := s.Save(ctx); err != nil {
+				logrus.WithError(err).Error("limitstate: saving state")
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package limitstate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/middleware"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestSyncer checks that a limiter registered under a saved name starts
+// from the saved state, and that saving again overwrites it.
+func TestSyncer(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	s := NewSyncer(store)
+	l := middleware.NewLimiter(1, 1)
+	l.SetClock(clock)
+	s.Register(ctx, "ratelimit", l)
+	l.Allow("192.0.2.1")
+	if err := s.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	l.Allow("192.0.2.2")
+	if err := s.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := middleware.NewLimiter(1, 1)
+	restored.SetClock(clock)
+	NewSyncer(store).Register(ctx, "ratelimit", restored)
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		if ok, _ := restored.Allow(ip); ok {
+			t.Errorf("Allow(%s) after Register = true, want its saved bucket restored", ip)
+		}
+	}
+	if ok, _ := restored.Allow("192.0.2.3"); !ok {
+		t.Error("Allow(192.0.2.3) after Register = false, want a fresh bucket")
+	}
+
+	fresh := middleware.NewLimiter(1, 1)
+	NewSyncer(store).Register(ctx, "other", fresh)
+	if ok, _ := fresh.Allow("192.0.2.1"); !ok {
+		t.Error("Allow on a limiter with no saved state = false, want a fresh bucket")
+	}
+}
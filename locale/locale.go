@@ -0,0 +1,135 @@
+// Package locale picks the language for a request and formats dates and
+// numbers for display in that language.
+package locale
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Supported lists the languages responses can be localized into. The first
+// entry is the fallback.
+var Supported = []language.Tag{
+	language.AmericanEnglish,
+	language.BritishEnglish,
+	language.German,
+	language.French,
+	language.Spanish,
+	language.Japanese,
+}
+
+var matcher = language.NewMatcher(Supported)
+
+type (
+	contextKey  struct{}
+	locationKey struct{}
+)
+
+// Negotiate returns the best supported language for r.
+func Negotiate(r *http.Request) language.Tag {
+	_, i, _ := matcher.Match(Preferences(r)...)
+	return Supported[i]
+}
+
+// Preferences returns the languages the client asked for, most preferred
+// first. An explicit ?lang= query parameter wins over the Accept-Language
+// header.
+func Preferences(r *http.Request) []language.Tag {
+	var prefs []language.Tag
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if tag, err := language.Parse(lang); err == nil {
+			prefs = append(prefs, tag)
+		}
+	}
+	accept, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	return append(prefs, accept...)
+}
+
+// Location returns the time zone the client asked for with ?tz= or the
+// Time-Zone header, as an IANA name such as "Europe/Berlin". Unknown or
+// missing zones mean UTC.
+func Location(r *http.Request) *time.Location {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		name = r.Header.Get("Time-Zone")
+	}
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Middleware negotiates the request language and time zone, stores them in
+// the request context, and advertises the language in the Content-Language
+// header.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag := Negotiate(r)
+		w.Header().Set("Content-Language", tag.String())
+		w.Header().Add("Vary", "Accept-Language, Time-Zone")
+		ctx := NewContext(r.Context(), tag)
+		ctx = context.WithValue(ctx, locationKey{}, Location(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// NewContext returns a copy of ctx carrying tag.
+func NewContext(ctx context.Context, tag language.Tag) context.Context {
+	return context.WithValue(ctx, contextKey{}, tag)
+}
+
+// FromContext returns the language stored in ctx, or the fallback language
+// if there is none.
+func FromContext(ctx context.Context) language.Tag {
+	if tag, ok := ctx.Value(contextKey{}).(language.Tag); ok {
+		return tag
+	}
+	return Supported[0]
+}
+
+// LocationFromContext returns the time zone stored in ctx by Middleware, or
+// UTC if there is none.
+func LocationFromContext(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// FormatNumber formats n with the digit grouping and decimal separator of
+// tag.
+func FormatNumber(tag language.Tag, n interface{}) string {
+	return message.NewPrinter(tag).Sprint(number.Decimal(n))
+}
+
+// dateLayouts maps languages to time.Format layouts for display dates.
+var dateLayouts = map[string]string{
+	"en-US": "01/02/2006 3:04 PM MST",
+	"en-GB": "02/01/2006 15:04 MST",
+	"de":    "02.01.2006 15:04 MST",
+	"fr":    "02/01/2006 15:04 MST",
+	"es":    "02/01/2006 15:04 MST",
+	"ja":    "2006/01/02 15:04 MST",
+}
+
+// FormatDate formats t for display to readers of tag. Machine-readable
+// output should keep using RFC 3339.
+func FormatDate(tag language.Tag, t time.Time) string {
+	if layout, ok := dateLayouts[tag.String()]; ok {
+		return t.Format(layout)
+	}
+	base, _ := tag.Base()
+	if layout, ok := dateLayouts[base.String()]; ok {
+		return t.Format(layout)
+	}
+	return t.Format(dateLayouts["en-US"])
+}
@@ -0,0 +1,44 @@
+package locale
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// TestNegotiate checks that ?lang= overrides Accept-Language and that
+// unsupported languages fall back to American English.
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		url, accept string
+		want        language.Tag
+	}{
+		{"/greet", "de-DE,de;q=0.9", language.German},
+		{"/greet?lang=fr", "de-DE", language.French},
+		{"/greet", "en-GB", language.BritishEnglish},
+		{"/greet", "xx", language.AmericanEnglish},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		r.Header.Set("Accept-Language", tt.accept)
+		if got := Negotiate(r); got != tt.want {
+			t.Errorf("Negotiate(%s, %q) = %v, want %v", tt.url, tt.accept, got, tt.want)
+		}
+	}
+}
+
+// TestFormat checks number and date formatting for a couple of languages.
+func TestFormat(t *testing.T) {
+	if got := FormatNumber(language.German, 1234567.5); got != "1.234.567,5" {
+		t.Errorf("FormatNumber(de) = %q, want %q", got, "1.234.567,5")
+	}
+	if got := FormatNumber(language.AmericanEnglish, 1234567); got != "1,234,567" {
+		t.Errorf("FormatNumber(en-US) = %q, want %q", got, "1,234,567")
+	}
+	ts := time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC)
+	if got := FormatDate(language.German, ts); got != "09.03.2024 14:05 UTC" {
+		t.Errorf("FormatDate(de) = %q, want %q", got, "09.03.2024 14:05 UTC")
+	}
+}
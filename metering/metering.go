@@ -0,0 +1,270 @@
+// Package metering counts billable usage per tenant: requests served,
+// IDs generated for new records, and bytes written to storage. Counts are
+// kept in memory and merged into one usage record per tenant, meter and
+// period, which an external billing system can export and price.
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Collection is the storage collection usage records live in.
+const Collection = "usage_records"
+
+// DefaultPeriod is how much time one usage record covers.
+const DefaultPeriod = time.Hour
+
+// Meters, as they appear in Record.Meter.
+const (
+	Requests = "requests"
+	// IDs counts records created, each of which was given a new ID.
+	IDs = "ids_generated"
+	// StorageBytes counts the bytes of record data written by creates and
+	// updates.
+	StorageBytes = "storage_bytes"
+)
+
+// maxUpdateRetries bounds retries when another instance updates the same
+// record between our read and write.
+const maxUpdateRetries = 5
+
+// Record is the usage of one meter by one tenant over [PeriodStart,
+// PeriodEnd). Tenant is analytics.Anonymous for usage naming none.
+type Record struct {
+	Tenant      string    `json:"tenant"`
+	Meter       string    `json:"meter"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Quantity    int64     `json:"quantity"`
+}
+
+type key struct {
+	start         time.Time
+	tenant, meter string
+}
+
+// id returns the storage ID of the record for k.
+func (k key) id() string {
+	return strconv.FormatInt(k.start.Unix(), 10) + "|" + url.PathEscape(k.tenant) + "|" + k.meter
+}
+
+// Meter counts usage and flushes it to Store.
+type Meter struct {
+	Store storage.Store
+	// Period is how much time one record covers, from the Unix epoch.
+	Period time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	pending map[key]int64
+}
+
+// NewMeter returns a meter flushing records covering period, or
+// DefaultPeriod if it isn't positive, to store.
+func NewMeter(store storage.Store, period time.Duration) *Meter {
+	if period <= 0 {
+		period = DefaultPeriod
+	}
+	return &Meter{Store: store, Period: period, now: time.Now, pending: make(map[key]int64)}
+}
+
+// SetClock makes the meter date usage by now instead of the wall clock,
+// for tests.
+func (m *Meter) SetClock(now func() time.Time) {
+	m.now = now
+}
+
+// Add counts n of meter for tenant now.
+func (m *Meter) Add(tenant, meter string, n int64) {
+	k := key{start: m.now().UTC().Truncate(m.Period), tenant: tenant, meter: meter}
+	m.mu.Lock()
+	m.pending[k] += n
+	m.mu.Unlock()
+}
+
+// Tenant returns the tenant usage in ctx is billed to: the one the
+// request acts for, or analytics.Anonymous.
+func Tenant(ctx context.Context) string {
+	if tenant, ok := storage.TenantFrom(ctx); ok {
+		return tenant
+	}
+	return analytics.Anonymous
+}
+
+// Middleware counts every request for its tenant. Without tenancy, the
+// tenant is the one named by analytics.TenantHeader, as analytics counts
+// it, so install it after tenancy.Middleware.
+func (m *Meter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := Tenant(r.Context())
+		if h := strings.TrimSpace(r.Header.Get(analytics.TenantHeader)); tenant == analytics.Anonymous && h != "" {
+			tenant = h
+		}
+		m.Add(tenant, Requests, 1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Flush merges pending usage into storage. Usage that fails to merge is
+// put back and retried on the next flush.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[key]int64)
+	m.mu.Unlock()
+
+	var firstErr error
+	for k, n := range pending {
+		if err := m.merge(ctx, k, n); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			m.mu.Lock()
+			m.pending[k] += n
+			m.mu.Unlock()
+		}
+	}
+	return firstErr
+}
+
+func (m *Meter) merge(ctx context.Context, k key, n int64) error {
+	for i := 0; i < maxUpdateRetries; i++ {
+		rec, err := m.Store.Get(ctx, Collection, k.id())
+		if errors.Is(err, storage.ErrNotFound) {
+			data, _ := json.Marshal(Record{Tenant: k.tenant, Meter: k.meter, PeriodStart: k.start, PeriodEnd: k.start.Add(m.Period), Quantity: n})
+			_, err = m.Store.Create(ctx, Collection, k.id(), data)
+			if errors.Is(err, storage.ErrExists) {
+				continue
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		var r Record
+		if err := json.Unmarshal(rec.Data, &r); err != nil {
+			return err
+		}
+		r.Quantity += n
+		data, _ := json.Marshal(r)
+		_, err = m.Store.Update(ctx, Collection, rec.ID, data, rec.Version)
+		if !errors.Is(err, storage.ErrVersionMismatch) {
+			return err
+		}
+	}
+	return storage.ErrVersionMismatch
+}
+
+// Run flushes every interval until ctx is done, then flushes once more.
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the last flush needs its own.
+			if err := m.Flush(context.Background()); err != nil {
+				logrus.WithError(err).Error("metering: final flush")
+			}
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				logrus.WithError(err).Error("metering: flushing usage")
+			}
+		}
+	}
+}
+
+// Filter selects records. Zero fields match everything; records are
+// selected if their period starts at or after From and before To.
+type Filter struct {
+	From, To      time.Time
+	Tenant, Meter string
+}
+
+func (f Filter) match(r Record) bool {
+	return (f.From.IsZero() || !r.PeriodStart.Before(f.From)) &&
+		(f.To.IsZero() || r.PeriodStart.Before(f.To)) &&
+		(f.Tenant == "" || r.Tenant == f.Tenant) &&
+		(f.Meter == "" || r.Meter == f.Meter)
+}
+
+// Query returns the stored records matching f, sorted by period, tenant
+// and meter. Usage not yet flushed isn't included.
+func (m *Meter) Query(ctx context.Context, f Filter) ([]Record, error) {
+	recs, err := m.Store.List(ctx, Collection, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := []Record{}
+	for _, rec := range recs {
+		var r Record
+		if err := json.Unmarshal(rec.Data, &r); err == nil && f.match(r) {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if !a.PeriodStart.Equal(b.PeriodStart) {
+			return a.PeriodStart.Before(b.PeriodStart)
+		}
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Meter < b.Meter
+	})
+	return out, nil
+}
+
+// Store is a storage.Store that meters the IDs generated and bytes
+// written by creates and updates in its collections.
+type Store struct {
+	storage.Store
+	meter   *Meter
+	metered map[string]bool
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// Wrap returns store metering writes to collections with m.
+func (m *Meter) Wrap(store storage.Store, collections ...string) *Store {
+	s := &Store{Store: store, meter: m, metered: make(map[string]bool)}
+	for _, c := range collections {
+		s.metered[c] = true
+	}
+	return s
+}
+
+// Create creates the record, counting its ID and bytes once it is stored.
+func (s *Store) Create(ctx context.Context, collection, id string, data json.RawMessage) (storage.Record, error) {
+	rec, err := s.Store.Create(ctx, collection, id, data)
+	if err == nil && s.metered[collection] {
+		tenant := Tenant(ctx)
+		s.meter.Add(tenant, IDs, 1)
+		s.meter.Add(tenant, StorageBytes, int64(len(data)))
+	}
+	return rec, err
+}
+
+// Update updates the record, counting its bytes once it is stored.
+func (s *Store) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (storage.Record, error) {
+	rec, err := s.Store.Update(ctx, collection, id, data, ifVersion)
+	if err == nil && s.metered[collection] {
+		s.meter.Add(Tenant(ctx), StorageBytes, int64(len(data)))
+	}
+	return rec, err
+}
@@ -0,0 +1,65 @@
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestMeter checks that requests and writes are counted per tenant and
+// period, that unmetered collections aren't, and that flushes add up.
+func TestMeter(t *testing.T) {
+	m := storage.NewMemory()
+	meter := NewMeter(m, time.Hour)
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+	meter.SetClock(func() time.Time { return now })
+	store := meter.Wrap(m, "greetings")
+	acme := storage.WithTenant(context.Background(), "acme")
+
+	store.Create(acme, "greetings", "a", json.RawMessage(`{"name":"Gladys"}`))
+	store.Update(acme, "greetings", "a", json.RawMessage(`{"name":"Derin"}`), 0)
+	store.Create(acme, "webhook_subscriptions", "b", json.RawMessage(`{}`))
+	h := meter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/greetings", nil)
+	req.Header.Set(analytics.TenantHeader, "acme")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if err := meter.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Hour)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/greetings", nil))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	meter.Flush(context.Background())
+
+	got, err := meter.Query(context.Background(), Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	want := []Record{
+		{"acme", IDs, start, start.Add(time.Hour), 1},
+		{"acme", Requests, start, start.Add(time.Hour), 1},
+		{"acme", StorageBytes, start, start.Add(time.Hour), 33},
+		{"acme", Requests, start.Add(time.Hour), start.Add(2 * time.Hour), 1},
+		{analytics.Anonymous, Requests, start.Add(time.Hour), start.Add(2 * time.Hour), 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Query = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if g := got[i]; g.Tenant != want[i].Tenant || g.Meter != want[i].Meter || !g.PeriodStart.Equal(want[i].PeriodStart) ||
+			!g.PeriodEnd.Equal(want[i].PeriodEnd) || g.Quantity != want[i].Quantity {
+			t.Errorf("Query[%d] = %+v, want %+v", i, g, want[i])
+		}
+	}
+
+	if got, _ := meter.Query(context.Background(), Filter{From: start.Add(time.Hour), Tenant: "acme"}); len(got) != 1 {
+		t.Errorf("Query(acme, second period) = %+v, want one record", got)
+	}
+}
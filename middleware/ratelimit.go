@@ -0,0 +1,200 @@
+// Package middleware holds HTTP middleware that routes opt in to, rather
+// than layers every request passes through.
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// DefaultMaxKeys bounds how many clients a Limiter tracks at once.
+const DefaultMaxKeys = 10000
+
+var rateLimited = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "http_rate_limited_requests_total",
+	Help: "Requests rejected by the per-IP rate limiter.",
+})
+
+// bucket is one client's tokens as of Filled.
+type bucket struct {
+	Tokens float64   `json:"tokens"`
+	Filled time.Time `json:"filled"`
+}
+
+// Limiter is a token-bucket rate limiter: each key, by default the
+// client IP, may make Burst requests at once and RPS a second after that.
+// It is safe for concurrent use.
+type Limiter struct {
+	rps   float64
+	burst float64
+	// Key returns the bucket a request draws from.
+	Key func(r *http.Request) string
+	// MaxKeys bounds the buckets tracked. When it is reached, buckets
+	// that have refilled are forgotten, as a fresh bucket is the same;
+	// if none have, every bucket is.
+	MaxKeys int
+	now     func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter returns a limiter allowing rps requests a second per client
+// IP, in bursts of up to burst. A burst of zero or less is one second's
+// worth of rps.
+func NewLimiter(rps float64, burst int) *Limiter {
+	b := float64(burst)
+	if burst <= 0 {
+		b = math.Max(1, math.Ceil(rps))
+	}
+	return &Limiter{
+		rps:     rps,
+		burst:   b,
+		Key:     ClientIP,
+		MaxKeys: DefaultMaxKeys,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// SetClock makes the limiter refill buckets by now instead of the wall
+// clock, for tests. Call it before the limiter is used.
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// Allow takes a token from key's bucket and reports whether there was
+// one. When there wasn't, retryAfter says when there will be.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	if l.rps <= 0 {
+		return true, 0
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.buckets[key]
+	if b == nil {
+		if len(l.buckets) >= l.MaxKeys {
+			l.sweep(now)
+		}
+		b = &bucket{Tokens: l.burst, Filled: now}
+		l.buckets[key] = b
+	}
+	b.Tokens = math.Min(l.burst, b.Tokens+now.Sub(b.Filled).Seconds()*l.rps)
+	b.Filled = now
+	if b.Tokens < 1 {
+		return false, time.Duration((1 - b.Tokens) / l.rps * float64(time.Second))
+	}
+	b.Tokens--
+	return true, 0
+}
+
+// sweep forgets the buckets that have refilled by now, or every bucket if
+// none have.
+func (l *Limiter) sweep(now time.Time) {
+	full := l.refill()
+	for key, b := range l.buckets {
+		if now.Sub(b.Filled) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	if len(l.buckets) >= l.MaxKeys {
+		l.buckets = make(map[string]*bucket)
+	}
+}
+
+// refill returns how long an empty bucket takes to fill.
+func (l *Limiter) refill() time.Duration {
+	return time.Duration(l.burst / l.rps * float64(time.Second))
+}
+
+// State returns the buckets that haven't refilled, as JSON, so they can
+// be restored after a restart. It implements limitstate.Stateful.
+func (l *Limiter) State() (json.RawMessage, error) {
+	if l.rps <= 0 {
+		return json.Marshal(map[string]*bucket{})
+	}
+	now := l.now()
+	full := l.refill()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	drained := make(map[string]*bucket)
+	for key, b := range l.buckets {
+		if now.Sub(b.Filled) < full {
+			drained[key] = &bucket{Tokens: b.Tokens, Filled: b.Filled}
+		}
+	}
+	return json.Marshal(drained)
+}
+
+// Restore sets the buckets saved by State, leaving keys that already have
+// one, which are newer. Restored buckets refill for the time since they
+// were saved.
+func (l *Limiter) Restore(data json.RawMessage) error {
+	var saved map[string]*bucket
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range saved {
+		if _, ok := l.buckets[key]; ok || len(l.buckets) >= l.MaxKeys {
+			continue
+		}
+		l.buckets[key] = b
+	}
+	return nil
+}
+
+// Middleware rejects requests over their key's limit with 429 and a
+// Retry-After in whole seconds.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := l.Allow(l.Key(r)); !ok {
+			rateLimited.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			respond.Error(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Limit wraps a single route's handler in Middleware.
+func (l *Limiter) Limit(h http.HandlerFunc) http.HandlerFunc {
+	return l.Middleware(h).ServeHTTP
+}
+
+// For returns Middleware applied only to requests whose path match
+// accepts, such as a routes.Match, so a router can limit some routes.
+func (l *Limiter) For(match func(path string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := l.Middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if match(r.URL.Path) {
+				limited.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address of the peer that sent r, without its port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestLimiter checks that each IP gets its burst, is then refused with a
+// Retry-After until a token refills, and doesn't drain other IPs' buckets.
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(0.5, 2)
+	l.SetClock(func() time.Time { return now })
+	h := l.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func(addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/greet", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := serve("192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200 within the burst", i+1, rec.Code)
+		}
+	}
+	rec := serve("192.0.2.1:5678")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("request 3 = %d with Retry-After %q, want 429 and 2", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("192.0.2.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("request from another IP = %d, want 200", rec.Code)
+	}
+	now = now.Add(2 * time.Second)
+	if rec := serve("192.0.2.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("request after refilling = %d, want 200", rec.Code)
+	}
+}
+
+// TestFor checks that only the paths matched are limited.
+func TestFor(t *testing.T) {
+	l := NewLimiter(1, 1)
+	h := l.For(func(path string) bool { return path == "/login" })(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	codes := map[string][]int{}
+	for _, path := range []string{"/login", "/login", "/greet", "/greet"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		codes[path] = append(codes[path], rec.Code)
+	}
+	if c := codes["/login"]; c[1] != http.StatusTooManyRequests {
+		t.Errorf("/login twice = %v, want the second limited", c)
+	}
+	if c := codes["/greet"]; c[0] != http.StatusOK || c[1] != http.StatusOK {
+		t.Errorf("/greet twice = %v, want neither limited", c)
+	}
+}
+
+// TestSweep checks that reaching MaxKeys forgets refilled buckets first.
+func TestSweep(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(1, 1)
+	l.MaxKeys = 2
+	l.SetClock(func() time.Time { return now })
+	l.Allow("a")
+	now = now.Add(time.Minute)
+	l.Allow("b")
+	l.Allow("c")
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 2 {
+		t.Errorf("buckets = %v, want a forgotten and b and c kept", l.buckets)
+	}
+}
+
+// TestState checks that drained buckets survive a State and Restore into
+// a new limiter, and that full ones aren't saved.
+func TestState(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(1, 2)
+	l.SetClock(func() time.Time { return now })
+	l.Allow("drained")
+	l.Allow("drained")
+	l.Allow("full")
+	now = now.Add(time.Second)
+	l.Allow("full")
+	now = now.Add(5 * time.Second)
+	// drained was emptied a moment ago; full has refilled since.
+	l.Allow("drained")
+	l.Allow("drained")
+	state, err := l.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewLimiter(1, 2)
+	restored.SetClock(func() time.Time { return now })
+	if err := restored.Restore(state); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := restored.Allow("drained"); ok {
+		t.Error("Allow(drained) after Restore = true, want its empty bucket restored")
+	}
+	if len(restored.buckets) != 1 {
+		t.Errorf("restored %d buckets, want only the drained one", len(restored.buckets))
+	}
+}
@@ -0,0 +1,229 @@
+// Package mirror copies a sample of live requests to a shadow upstream,
+// such as a canary build, after the client has had its response, and
+// counts how often the shadow's response differs. The client never waits
+// for or sees the shadow.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Header marks requests sent to the shadow, so it can tell them apart and
+// avoid side effects such as notifications.
+const Header = "X-Mirrored-Request"
+
+// Results counted in mirror_requests_total.
+const (
+	ResultMatch          = "match"
+	ResultStatusMismatch = "status_mismatch"
+	ResultBodyMismatch   = "body_mismatch"
+	ResultError          = "error"
+	// ResultDropped means the request was sampled but not sent: too many
+	// were in flight already, or its body was too large to copy.
+	ResultDropped = "dropped"
+)
+
+var mirrored = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "mirror_requests_total",
+	Help: "Requests sampled for mirroring to the shadow upstream, by route and result.",
+}, []string{"route", "result"})
+
+// Config controls mirroring.
+type Config struct {
+	// URL is the shadow upstream; request paths are appended to it.
+	URL string
+	// Percent of eligible requests mirrored, from 0 to 100.
+	Percent float64
+	// Methods eligible for mirroring. Defaults to GET and HEAD, so writes
+	// aren't applied twice unless asked for.
+	Methods []string
+	// Timeout bounds each shadow request.
+	Timeout time.Duration
+	// MaxBody is the largest request body copied; larger requests aren't
+	// mirrored.
+	MaxBody int64
+	// MaxInFlight caps concurrent shadow requests; samples beyond it are
+	// dropped rather than queued.
+	MaxInFlight int
+}
+
+// DefaultConfig is used for zero fields of a Config.
+var DefaultConfig = Config{
+	Methods:     []string{http.MethodGet, http.MethodHead},
+	Timeout:     5 * time.Second,
+	MaxBody:     1 << 20,
+	MaxInFlight: 64,
+}
+
+// Mirror sends sampled requests to the shadow upstream.
+type Mirror struct {
+	cfg    Config
+	target *url.URL
+	client *http.Client
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	// sample returns a number in [0, 100); replaced in tests.
+	sample func() float64
+}
+
+// New returns a Mirror for cfg.
+func New(cfg Config) (*Mirror, error) {
+	target, err := url.Parse(cfg.URL)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("mirror: invalid upstream URL %q", cfg.URL)
+	}
+	if cfg.Percent < 0 || cfg.Percent > 100 {
+		return nil, fmt.Errorf("mirror: percent %v is outside 0-100", cfg.Percent)
+	}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = DefaultConfig.Methods
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConfig.Timeout
+	}
+	if cfg.MaxBody <= 0 {
+		cfg.MaxBody = DefaultConfig.MaxBody
+	}
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = DefaultConfig.MaxInFlight
+	}
+	return &Mirror{
+		cfg:    cfg,
+		target: target,
+		client: &http.Client{Timeout: cfg.Timeout},
+		slots:  make(chan struct{}, cfg.MaxInFlight),
+		sample: func() float64 { return rand.Float64() * 100 },
+	}, nil
+}
+
+// Wait blocks until every shadow request sent so far has finished.
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
+
+// Middleware serves requests as usual and mirrors the sampled ones once
+// the response is complete. Streamed responses, which flush before they
+// end, aren't mirrored. It needs the matched route, so it goes inside the
+// router.
+func (m *Mirror) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(Header) != "" || !slices.Contains(m.cfg.Methods, r.Method) || m.sample() >= m.cfg.Percent {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := "unmatched"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tmpl, err := cur.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, m.cfg.MaxBody+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil || int64(len(body)) > m.cfg.MaxBody {
+			mirrored.WithLabelValues(route, ResultDropped).Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK, sum: sha256.New()}
+		next.ServeHTTP(rec, r)
+		if rec.flushed {
+			return
+		}
+
+		select {
+		case m.slots <- struct{}{}:
+		default:
+			mirrored.WithLabelValues(route, ResultDropped).Inc()
+			return
+		}
+		shadow := r.Clone(context.Background())
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer func() { <-m.slots }()
+			mirrored.WithLabelValues(route, m.send(shadow, body, rec.status, rec.sum.Sum(nil))).Inc()
+		}()
+	})
+}
+
+// send replays r with body against the shadow and compares its response
+// with the primary's status and body digest.
+func (m *Mirror) send(r *http.Request, body []byte, status int, digest []byte) string {
+	u := *m.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequest(r.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return ResultError
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range []string{"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"} {
+		req.Header.Del(h)
+	}
+	req.Header.Set(Header, "1")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return ResultError
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil && !errors.Is(err, io.EOF) {
+		return ResultError
+	}
+	switch {
+	case resp.StatusCode != status:
+		return ResultStatusMismatch
+	case !bytes.Equal(h.Sum(nil), digest):
+		return ResultBodyMismatch
+	}
+	return ResultMatch
+}
+
+// recorder passes a response through while hashing its body.
+type recorder struct {
+	http.ResponseWriter
+	status  int
+	wrote   bool
+	flushed bool
+	sum     hash.Hash
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if !rec.wrote {
+		rec.status, rec.wrote = code, true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wrote = true
+	rec.sum.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Flush() {
+	rec.flushed = true
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,107 @@
+package mirror
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// shadowServer returns a server answering with status and body and
+// recording the requests it gets.
+func shadowServer(t *testing.T, status int, body string) (*httptest.Server, func() []*http.Request) {
+	var mu sync.Mutex
+	var got []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(b)))
+		mu.Lock()
+		got = append(got, r)
+		mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*http.Request(nil), got...)
+	}
+}
+
+// TestMiddleware checks that sampled requests reach the shadow unchanged
+// after the client's response, and that others don't.
+func TestMiddleware(t *testing.T) {
+	srv, requests := shadowServer(t, http.StatusOK, "hello")
+	m, err := New(Config{URL: srv.URL + "/base", Percent: 50, Methods: []string{"GET", "POST"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []float64{10, 90, 10}
+	m.sample = func() float64 { s := samples[0]; samples = samples[1:]; return s }
+	h := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		io.WriteString(w, "hello"+string(b))
+	}))
+
+	for _, body := range []string{"", "skipped", "!"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("POST", "/greet?name=Gladys", strings.NewReader(body)))
+		if got := rec.Body.String(); got != "hello"+body {
+			t.Errorf("response = %q, want %q", got, "hello"+body)
+		}
+	}
+	m.Wait()
+
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("shadow got %d requests, want 2", len(got))
+	}
+	// Shadow requests run concurrently, so either may have arrived first.
+	r := got[0]
+	b, _ := io.ReadAll(r.Body)
+	if len(b) == 0 {
+		r = got[1]
+		b, _ = io.ReadAll(r.Body)
+	}
+	if r.URL.Path != "/base/greet" || r.URL.RawQuery != "name=Gladys" || string(b) != "!" || r.Header.Get(Header) == "" {
+		t.Errorf("shadow request = %s %s %q %v, want POST /base/greet?name=Gladys with body and %s", r.Method, r.URL, b, r.Header, Header)
+	}
+}
+
+// TestSend checks how shadow responses are compared with the primary's.
+func TestSend(t *testing.T) {
+	digest := sha256.Sum256([]byte("hello"))
+	tests := []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{http.StatusOK, "hello", ResultMatch},
+		{http.StatusOK, "hullo", ResultBodyMismatch},
+		{http.StatusInternalServerError, "hello", ResultStatusMismatch},
+	}
+	for _, tt := range tests {
+		srv, _ := shadowServer(t, tt.status, tt.body)
+		m, err := New(Config{URL: srv.URL, Percent: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/greet", nil)
+		if got := m.send(req, nil, http.StatusOK, digest[:]); got != tt.want {
+			t.Errorf("send() against %d %q = %s, want %s", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
+
+// TestNew checks config validation.
+func TestNew(t *testing.T) {
+	for _, cfg := range []Config{{URL: "not a url"}, {URL: "http://canary", Percent: 150}} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) = nil error, want an error", cfg)
+		}
+	}
+}
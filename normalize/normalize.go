@@ -0,0 +1,75 @@
+// Package normalize canonicalizes client input before handlers see it, so
+// that visually identical strings are stored and compared as one value.
+package normalize
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// DefaultMaxLen is the maximum length, in characters, of a single input
+// value when no other limit is configured.
+const DefaultMaxLen = 256
+
+var (
+	// ErrNullByte is returned for input containing a NUL character.
+	ErrNullByte = errors.New("input contains a null byte")
+	// ErrInvalidUTF8 is returned for input that isn't valid UTF-8.
+	ErrInvalidUTF8 = errors.New("input is not valid UTF-8")
+	// ErrTooLong is returned for input longer than the allowed maximum.
+	ErrTooLong = errors.New("input is too long")
+)
+
+// String returns s trimmed of surrounding whitespace and in Unicode NFC.
+// It rejects null bytes, invalid UTF-8, and values longer than maxLen
+// characters after normalization. A maxLen of zero disables the length
+// check.
+func String(s string, maxLen int) (string, error) {
+	if strings.IndexByte(s, 0) >= 0 {
+		return "", ErrNullByte
+	}
+	if !utf8.ValidString(s) {
+		return "", ErrInvalidUTF8
+	}
+	s = norm.NFC.String(strings.TrimSpace(s))
+	if maxLen > 0 && utf8.RuneCountInString(s) > maxLen {
+		return "", fmt.Errorf("%w (max %d characters)", ErrTooLong, maxLen)
+	}
+	return s, nil
+}
+
+// Query returns middleware that normalizes every query parameter value with
+// String before calling the next handler. Requests with values that can't
+// be normalized are rejected with 400. raw names, by path, parameters left
+// exactly as sent, such as data to encode byte for byte, whose handlers
+// check them themselves.
+func Query(maxLen int, raw map[string][]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			for key, values := range query {
+				if slices.Contains(raw[r.URL.Path], key) {
+					continue
+				}
+				for i, v := range values {
+					n, err := String(v, maxLen)
+					if err != nil {
+						respond.Error(w, http.StatusBadRequest, fmt.Sprintf("query parameter %q: %v", key, err))
+						return
+					}
+					values[i] = n
+				}
+			}
+			r.URL.RawQuery = query.Encode()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
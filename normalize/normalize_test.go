@@ -0,0 +1,29 @@
+package normalize
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestString checks trimming, NFC composition, and the rejection rules.
+func TestString(t *testing.T) {
+	tests := []struct {
+		in      string
+		maxLen  int
+		want    string
+		wantErr error
+	}{
+		{"  Gladys\t", 0, "Gladys", nil},
+		{"Jose\u0301", 0, "Jos\u00e9", nil},
+		{"Gla\x00dys", 0, "", ErrNullByte},
+		{"\xff", 0, "", ErrInvalidUTF8},
+		{"Jose\u0301", 4, "Jos\u00e9", nil},
+		{"Gladys", 3, "", ErrTooLong},
+	}
+	for _, tt := range tests {
+		got, err := String(tt.in, tt.maxLen)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("String(%q, %d) = %q, %v, want %q, %v", tt.in, tt.maxLen, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Package notify sends event notifications to users over email and Slack,
+// using admin-managed message templates and per-user preferences.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/template"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Storage collections used by the package.
+const (
+	TemplatesCollection   = "notification_templates"
+	PreferencesCollection = "notification_preferences"
+)
+
+// Notification channels.
+const (
+	Email = "email"
+	Slack = "slack"
+)
+
+// Template is a stored message template for one event type on one
+// channel. Subject and Body are text/template sources executed against the
+// event's JSON form, so {{.type}} is the event type and {{.data.name}} a
+// field of its data.
+type Template struct {
+	Event   string `json:"event" validate:"required"`
+	Channel string `json:"channel" validate:"required,oneof=email slack"`
+	// Subject is used by email only.
+	Subject string `json:"subject,omitempty" validate:"max=256"`
+	Body    string `json:"body" validate:"required,max=8192"`
+}
+
+// TemplateID returns the storage ID of the template for event on channel.
+func TemplateID(event, channel string) string {
+	return event + "." + channel
+}
+
+// ID returns the template's storage ID.
+func (t Template) ID() string {
+	return TemplateID(t.Event, t.Channel)
+}
+
+// Check parses the subject and body and reports the first syntax error.
+func (t Template) Check() error {
+	_, _, err := t.parse()
+	return err
+}
+
+func (t Template) parse() (subject, body *template.Template, err error) {
+	subject, err = template.New("subject").Option("missingkey=error").Parse(t.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err = template.New("body").Option("missingkey=error").Parse(t.Body)
+	return subject, body, err
+}
+
+// Message is a rendered notification.
+type Message struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+}
+
+// Render executes t against e.
+func (t Template) Render(e events.Event) (Message, error) {
+	subject, body, err := t.parse()
+	if err != nil {
+		return Message{}, err
+	}
+	// Go through JSON so templates see the same field names webhook
+	// subscribers do, whatever Go type the event data has.
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return Message{}, err
+	}
+	var data map[string]interface{}
+	json.Unmarshal(raw, &data)
+
+	m := Message{Channel: t.Channel}
+	var b bytes.Buffer
+	if err := subject.Execute(&b, data); err != nil {
+		return Message{}, err
+	}
+	m.Subject = b.String()
+	b.Reset()
+	if err := body.Execute(&b, data); err != nil {
+		return Message{}, err
+	}
+	m.Body = b.String()
+	return m, nil
+}
+
+// Preferences are a user's notification settings.
+type Preferences struct {
+	// Email and SlackUser are where to send; an empty address turns the
+	// channel off. Email is encrypted at rest. Both are personal and
+	// redacted from logs and exports.
+	Email     string `json:"email,omitempty" validate:"omitempty,email" encrypt:"true" pii:"redact"`
+	SlackUser string `json:"slack_user,omitempty" validate:"max=64" pii:"redact"`
+	// Muted lists event types the user doesn't want notifications for.
+	Muted []string `json:"muted,omitempty" validate:"dive,required"`
+}
+
+// Address returns where to send notifications of event on channel, or ""
+// if the user doesn't want them.
+func (p Preferences) Address(channel, event string) string {
+	for _, m := range p.Muted {
+		if m == event {
+			return ""
+		}
+	}
+	switch channel {
+	case Email:
+		return p.Email
+	case Slack:
+		return p.SlackUser
+	}
+	return ""
+}
+
+// Sender delivers rendered messages on one channel.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Service renders and sends notifications.
+type Service struct {
+	Store storage.Store
+	// Senders maps channel names to their senders. Channels without a
+	// sender are skipped.
+	Senders map[string]Sender
+}
+
+// NewService returns a Service backed by store with no senders.
+func NewService(store storage.Store) *Service {
+	return &Service{Store: store, Senders: make(map[string]Sender)}
+}
+
+// Template loads the template with id.
+func (s *Service) Template(ctx context.Context, id string) (Template, storage.Record, error) {
+	var t Template
+	rec, err := s.Store.Get(ctx, TemplatesCollection, id)
+	if err != nil {
+		return t, rec, err
+	}
+	err = json.Unmarshal(rec.Data, &t)
+	return t, rec, err
+}
+
+// Preferences loads the preferences of user. Users who never saved any get
+// the zero value, which sends nothing.
+func (s *Service) Preferences(ctx context.Context, user string) (Preferences, storage.Record, error) {
+	var p Preferences
+	rec, err := s.Store.Get(ctx, PreferencesCollection, user)
+	if err != nil {
+		return p, rec, err
+	}
+	err = json.Unmarshal(rec.Data, &p)
+	return p, rec, err
+}
+
+// Notify sends e to user on every channel the user has an address for and
+// there is a template and a sender for. It returns the messages sent.
+func (s *Service) Notify(ctx context.Context, user string, e events.Event) ([]Message, error) {
+	prefs, _, err := s.Preferences(ctx, user)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sent []Message
+	for _, channel := range []string{Email, Slack} {
+		to := prefs.Address(channel, e.Type)
+		sender := s.Senders[channel]
+		if to == "" || sender == nil {
+			continue
+		}
+		t, _, err := s.Template(ctx, TemplateID(e.Type, channel))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return sent, err
+		}
+		m, err := t.Render(e)
+		if err != nil {
+			return sent, fmt.Errorf("notify: rendering %s: %w", t.ID(), err)
+		}
+		m.To = to
+		if err := sender.Send(ctx, m); err != nil {
+			return sent, fmt.Errorf("notify: sending %s to %s: %w", channel, to, err)
+		}
+		sent = append(sent, m)
+	}
+	return sent, nil
+}
+
+// SampleEvent returns an event of type typ with placeholder greeting data,
+// for previewing templates.
+func SampleEvent(typ string) events.Event {
+	return events.New(typ, map[string]interface{}{
+		"id":      "00000000-0000-0000-0000-000000000000",
+		"name":    "Gladys",
+		"message": "Hello, Gladys!",
+		"version": 1,
+	})
+}
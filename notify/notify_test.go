@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+type recordSender []Message
+
+func (s *recordSender) Send(ctx context.Context, m Message) error {
+	*s = append(*s, m)
+	return nil
+}
+
+// TestRender checks that templates see the event's JSON field names and
+// that unknown keys are an error rather than "<no value>".
+func TestRender(t *testing.T) {
+	e := SampleEvent(events.GreetingCreated)
+	tests := []struct {
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{"{{.type}}: {{.data.name}}", "greeting.created: Gladys", false},
+		{"{{.data.nope}}", "", true},
+	}
+	for _, tt := range tests {
+		m, err := Template{Event: e.Type, Channel: Slack, Body: tt.body}.Render(e)
+		if m.Body != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Render(%q) = %q, %v, want %q, error %v", tt.body, m.Body, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestNotify checks that only channels with an address, a template, and a
+// sender are used, and that muted events send nothing.
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	s := NewService(store)
+	var email, slack recordSender
+	s.Senders[Email] = &email
+	s.Senders[Slack] = &slack
+
+	for _, tmpl := range []Template{
+		{Event: events.GreetingCreated, Channel: Email, Subject: "New greeting", Body: "{{.data.message}}"},
+		{Event: events.GreetingCreated, Channel: Slack, Body: "{{.data.message}}"},
+	} {
+		data, _ := json.Marshal(tmpl)
+		store.Create(ctx, TemplatesCollection, tmpl.ID(), data)
+	}
+	data, _ := json.Marshal(Preferences{Email: "gladys@example.com", Muted: []string{events.GreetingDeleted}})
+	store.Create(ctx, PreferencesCollection, "gladys", data)
+
+	sent, err := s.Notify(ctx, "gladys", SampleEvent(events.GreetingCreated))
+	if err != nil || len(sent) != 1 || len(email) != 1 || len(slack) != 0 {
+		t.Fatalf("Notify(created) = %+v, %v, want one email", sent, err)
+	}
+	if email[0].To != "gladys@example.com" || email[0].Body != "Hello, Gladys!" {
+		t.Errorf("email = %+v, want rendered message to gladys@example.com", email[0])
+	}
+
+	if sent, err := s.Notify(ctx, "gladys", SampleEvent(events.GreetingDeleted)); err != nil || len(sent) != 0 {
+		t.Errorf("Notify(muted) = %+v, %v, want nothing", sent, err)
+	}
+	if sent, err := s.Notify(ctx, "nobody", SampleEvent(events.GreetingCreated)); err != nil || len(sent) != 0 {
+		t.Errorf("Notify(no preferences) = %+v, %v, want nothing", sent, err)
+	}
+}
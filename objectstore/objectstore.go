@@ -0,0 +1,184 @@
+// Package objectstore keeps binary objects, such as generated audio, by
+// key. Objects are written whole and read back as streams, so large ones
+// can be copied to a response without holding them in memory.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+)
+
+// ErrNotFound is returned by Get for keys with no object.
+var ErrNotFound = errors.New("objectstore: not found")
+
+// Info describes an object.
+type Info struct {
+	ContentType string
+	Size        int64
+}
+
+// Store keeps objects by key. Keys are slash-separated paths such as
+// "tts/3f2a", without "." or ".." elements.
+type Store interface {
+	// Get opens the object at key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, Info, error)
+	// Put stores the contents of r at key, replacing any object there.
+	Put(ctx context.Context, key, contentType string, r io.Reader) error
+}
+
+// checkKey rejects keys that aren't valid paths.
+func checkKey(key string) error {
+	if !fs.ValidPath(key) || key == "." {
+		return fmt.Errorf("objectstore: invalid key %q", key)
+	}
+	return nil
+}
+
+// Memory is a Store holding objects in memory, evicting the least
+// recently used ones past its limits.
+type Memory struct {
+	objects *cache.LRU
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns a Memory holding at most maxObjects objects and about
+// maxBytes bytes. A zero limit is unbounded.
+func NewMemory(maxObjects, maxBytes int) *Memory {
+	return &Memory{objects: cache.NewLRU(maxObjects, maxBytes, 0)}
+}
+
+// object is an object held by Memory.
+type object struct {
+	contentType string
+	data        []byte
+}
+
+// Size reports the object's size to the LRU.
+func (o object) Size() int { return len(o.data) + len(o.contentType) }
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	if err := checkKey(key); err != nil {
+		return nil, Info{}, err
+	}
+	v, ok, err := m.objects.Get(ctx, key)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	if !ok {
+		return nil, Info{}, ErrNotFound
+	}
+	o := v.(object)
+	return io.NopCloser(bytes.NewReader(o.data)), Info{ContentType: o.contentType, Size: int64(len(o.data))}, nil
+}
+
+func (m *Memory) Put(ctx context.Context, key, contentType string, r io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("objectstore: %s: %w", key, err)
+	}
+	return m.objects.Set(ctx, key, object{contentType: contentType, data: data}, 0)
+}
+
+// Dir is a Store keeping each object in a file under a directory, with
+// its content type in a ".type" file beside it. Objects are written to a
+// temporary file and renamed into place, so readers never see a partial
+// object.
+type Dir struct {
+	root string
+}
+
+var _ Store = (*Dir)(nil)
+
+// NewDir returns a Dir storing objects under root, creating it if need be.
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("objectstore: %w", err)
+	}
+	return &Dir{root: root}, nil
+}
+
+// checkKey also rejects keys naming the ".type" files.
+func (d *Dir) checkKey(key string) error {
+	if strings.HasSuffix(key, ".type") {
+		return fmt.Errorf("objectstore: invalid key %q", key)
+	}
+	return checkKey(key)
+}
+
+func (d *Dir) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(key))
+}
+
+func (d *Dir) Get(ctx context.Context, key string) (io.ReadCloser, Info, error) {
+	if err := d.checkKey(key); err != nil {
+		return nil, Info{}, err
+	}
+	f, err := os.Open(d.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Info{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Info{}, fmt.Errorf("objectstore: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, Info{}, fmt.Errorf("objectstore: %w", err)
+	}
+	contentType, err := os.ReadFile(d.path(key) + ".type")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		f.Close()
+		return nil, Info{}, fmt.Errorf("objectstore: %w", err)
+	}
+	return f, Info{ContentType: strings.TrimSpace(string(contentType)), Size: st.Size()}, nil
+}
+
+func (d *Dir) Put(ctx context.Context, key, contentType string, r io.Reader) error {
+	if err := d.checkKey(key); err != nil {
+		return err
+	}
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	// The type goes first: an object without its type reads as untyped,
+	// but a stale type beside a new object would be wrong.
+	if err := writeFile(path+".type", strings.NewReader(contentType)); err != nil {
+		return err
+	}
+	return writeFile(path, r)
+}
+
+// writeFile writes r's contents to path through a temporary file renamed
+// into place.
+func writeFile(path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("objectstore: writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("objectstore: writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("objectstore: %w", err)
+	}
+	return nil
+}
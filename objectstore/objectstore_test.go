@@ -0,0 +1,59 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestStores checks that both stores read back what was put, with its
+// type and size, and reject invalid keys.
+func TestStores(t *testing.T) {
+	dir, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for name, s := range map[string]Store{"memory": NewMemory(0, 0), "dir": dir} {
+		if _, _, err := s.Get(ctx, "tts/abc"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get(missing) = %v, want ErrNotFound", name, err)
+		}
+		for _, data := range []string{"RIFF old", "RIFF new"} {
+			if err := s.Put(ctx, "tts/abc", "audio/wav", strings.NewReader(data)); err != nil {
+				t.Fatalf("%s: Put() = %v", name, err)
+			}
+		}
+		rc, info, err := s.Get(ctx, "tts/abc")
+		if err != nil {
+			t.Fatalf("%s: Get() = %v", name, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(got) != "RIFF new" || info != (Info{ContentType: "audio/wav", Size: 8}) {
+			t.Errorf("%s: Get() = %q, %+v, want the replacing object", name, got, info)
+		}
+		for _, key := range []string{"", "../escape", "/abs", "a//b"} {
+			if err := s.Put(ctx, key, "", strings.NewReader("x")); err == nil {
+				t.Errorf("%s: Put(%q) = nil error, want one", name, key)
+			}
+		}
+	}
+}
+
+// TestMemoryEvicts checks that Memory drops the least recently used
+// objects past its limit.
+func TestMemoryEvicts(t *testing.T) {
+	m := NewMemory(2, 0)
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c"} {
+		m.Put(ctx, key, "text/plain", strings.NewReader(key))
+	}
+	if _, _, err := m.Get(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(a) = %v, want ErrNotFound once evicted", err)
+	}
+	if _, _, err := m.Get(ctx, "c"); err != nil {
+		t.Errorf("Get(c) = %v, want nil", err)
+	}
+}
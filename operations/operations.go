@@ -0,0 +1,121 @@
+// Package operations runs long-running work in the background, so a
+// request can answer 202 Accepted with an operation clients poll until it
+// is done rather than holding the connection open. Operations are stored
+// records, so any replica can answer for one, and they outlive the
+// request that started them.
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Collection is the storage collection operations live in.
+const Collection = "operations"
+
+// Results counted in operations_total.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+var finished = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "operations_total",
+	Help: "Long-running operations finished, by kind and result.",
+}, []string{"kind", "result"})
+
+// Operation is the state of a piece of background work.
+type Operation struct {
+	ID string `json:"id"`
+	// Kind names the work, such as privacy.export.
+	Kind string `json:"kind"`
+	// Owner is who started it, if anyone did.
+	Owner string `json:"owner,omitempty"`
+	Done  bool   `json:"done"`
+	// Error is why the work failed, if it did.
+	Error string `json:"error,omitempty"`
+	// Result is what the work returned, once it is done.
+	Result    json.RawMessage `json:"result,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Manager starts operations and tells their state.
+type Manager struct {
+	Store storage.Store
+	wg    sync.WaitGroup
+}
+
+// NewManager returns a manager keeping operations in store.
+func NewManager(store storage.Store) *Manager {
+	return &Manager{Store: store}
+}
+
+// Start stores a new pending operation of kind, started by owner, and runs
+// work in the background. The operation is marked done with what work
+// returns, as JSON, or with its error. work gets ctx without its
+// cancellation, so it keeps running after the request that started it
+// ends, with the request's tenant and claims still in it.
+func (m *Manager) Start(ctx context.Context, kind, owner string, work func(ctx context.Context) (interface{}, error)) (Operation, error) {
+	op := Operation{ID: uuid.NewString(), Kind: kind, Owner: owner}
+	data, _ := json.Marshal(op)
+	rec, err := m.Store.Create(ctx, Collection, op.ID, data)
+	if err != nil {
+		return Operation{}, err
+	}
+	op = fromRecord(op, rec)
+
+	m.wg.Add(1)
+	go func(ctx context.Context, rec storage.Record) {
+		defer m.wg.Done()
+		done := op
+		done.Done = true
+		result := ResultOK
+		v, err := work(ctx)
+		if err == nil {
+			done.Result, err = json.Marshal(v)
+		}
+		if err != nil {
+			done.Error, done.Result, result = err.Error(), nil, ResultError
+		}
+		finished.WithLabelValues(kind, result).Inc()
+		data, _ := json.Marshal(done)
+		if _, err := m.Store.Update(ctx, Collection, op.ID, data, rec.Version); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"operation": op.ID, "kind": kind}).Error("operations: saving result")
+		}
+	}(context.WithoutCancel(ctx), rec)
+	return op, nil
+}
+
+// Get returns the operation with id, or storage.ErrNotFound.
+func (m *Manager) Get(ctx context.Context, id string) (Operation, error) {
+	rec, err := m.Store.Get(ctx, Collection, id)
+	if err != nil {
+		return Operation{}, err
+	}
+	var op Operation
+	if err := json.Unmarshal(rec.Data, &op); err != nil {
+		return Operation{}, err
+	}
+	return fromRecord(op, rec), nil
+}
+
+// Wait blocks until every started operation is done, for tests and
+// shutdown.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+func fromRecord(op Operation, rec storage.Record) Operation {
+	op.ID, op.CreatedAt, op.UpdatedAt = rec.ID, rec.CreatedAt, rec.UpdatedAt
+	return op
+}
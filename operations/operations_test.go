@@ -0,0 +1,55 @@
+package operations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+type ctxKey struct{}
+
+// TestStart checks that an operation is pending until its work returns,
+// then done with its result or error, and that work keeps the values of
+// a context canceled after it started.
+func TestStart(t *testing.T) {
+	m := NewManager(storage.NewMemory())
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "tenant"))
+	release := make(chan struct{})
+
+	op, err := m.Start(ctx, "export", "gladys", func(ctx context.Context) (interface{}, error) {
+		<-release
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return map[string]interface{}{"tenant": ctx.Value(ctxKey{})}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if got, _ := m.Get(context.Background(), op.ID); got.Done || got.Owner != "gladys" {
+		t.Errorf("Get() while running = %+v, want a pending operation owned by gladys", got)
+	}
+	close(release)
+	m.Wait()
+	got, err := m.Get(context.Background(), op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Done || got.Error != "" || string(got.Result) != `{"tenant":"tenant"}` {
+		t.Errorf("Get() when done = %+v, want the result", got)
+	}
+
+	op, _ = m.Start(context.Background(), "export", "", func(context.Context) (interface{}, error) {
+		return nil, errors.New("disk full")
+	})
+	m.Wait()
+	if got, _ := m.Get(context.Background(), op.ID); !got.Done || got.Error != "disk full" {
+		t.Errorf("Get() of a failed operation = %+v, want its error", got)
+	}
+	if _, err := m.Get(context.Background(), "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get(missing) = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,55 @@
+package paginate
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCursorRoundTrip checks that cursors decode to what was encoded and
+// that tampered or foreign cursors are rejected.
+func TestCursorRoundTrip(t *testing.T) {
+	s := NewSigner([]byte("k1"))
+	c := Cursor{CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ID: "abc"}
+	tok := s.Encode(c)
+
+	got, err := s.Decode(tok)
+	if err != nil || !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Fatalf("Decode(Encode(%v)) = %v, %v", c, got, err)
+	}
+	if _, err := NewSigner([]byte("k2")).Decode(tok); err != ErrInvalidCursor {
+		t.Errorf("Decode with another key = %v, want ErrInvalidCursor", err)
+	}
+	forged := NewSigner([]byte("k2")).Encode(Cursor{ID: "zzz"})
+	if _, err := s.Decode(forged[:len(forged)-2] + tok[len(tok)-2:]); err != ErrInvalidCursor {
+		t.Errorf("Decode of tampered cursor = %v, want ErrInvalidCursor", err)
+	}
+}
+
+// TestParse checks parameter defaults and validation.
+func TestParse(t *testing.T) {
+	s := NewSigner(nil)
+	tests := []struct {
+		query   string
+		wantErr bool
+		page    int
+		perPage int
+	}{
+		{"", false, 1, DefaultPerPage},
+		{"?page=3&per_page=10", false, 3, 10},
+		{"?per_page=1000", true, 0, 0},
+		{"?page=0", true, 0, 0},
+		{"?cursor=bogus", true, 0, 0},
+		{"?page=2&cursor=" + s.Encode(Cursor{ID: "a"}), true, 0, 0},
+	}
+	for _, tt := range tests {
+		p, err := Parse(httptest.NewRequest("GET", "/greetings"+tt.query, nil), s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (p.Page != tt.page || p.PerPage != tt.perPage) {
+			t.Errorf("Parse(%q) = %+v, want page %d per_page %d", tt.query, p, tt.page, tt.perPage)
+		}
+	}
+}
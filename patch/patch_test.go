@@ -0,0 +1,74 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result is not JSON: %s", got)
+	}
+	json.Unmarshal([]byte(want), &w)
+	return reflect.DeepEqual(g, w)
+}
+
+// TestMerge runs a few of the RFC 7396 examples.
+func TestMerge(t *testing.T) {
+	tests := []struct{ doc, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	}
+	for _, tt := range tests {
+		got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+		if err != nil || !jsonEqual(t, got, tt.want) {
+			t.Errorf("Merge(%s, %s) = %s, %v, want %s", tt.doc, tt.patch, got, err, tt.want)
+		}
+	}
+}
+
+// TestApply covers each JSON Patch operation.
+func TestApply(t *testing.T) {
+	doc := `{"name":"Gladys","tags":["a","b"],"meta":{"x":1}}`
+	tests := []struct{ ops, want string }{
+		{`[{"op":"replace","path":"/name","value":"Derin"}]`, `{"name":"Derin","tags":["a","b"],"meta":{"x":1}}`},
+		{`[{"op":"add","path":"/tags/1","value":"z"}]`, `{"name":"Gladys","tags":["a","z","b"],"meta":{"x":1}}`},
+		{`[{"op":"add","path":"/tags/-","value":"c"}]`, `{"name":"Gladys","tags":["a","b","c"],"meta":{"x":1}}`},
+		{`[{"op":"remove","path":"/tags/0"}]`, `{"name":"Gladys","tags":["b"],"meta":{"x":1}}`},
+		{`[{"op":"move","from":"/meta/x","path":"/x"}]`, `{"name":"Gladys","tags":["a","b"],"meta":{},"x":1}`},
+		{`[{"op":"copy","from":"/name","path":"/meta/name"}]`, `{"name":"Gladys","tags":["a","b"],"meta":{"x":1,"name":"Gladys"}}`},
+		{`[{"op":"test","path":"/name","value":"Gladys"},{"op":"remove","path":"/meta"}]`, `{"name":"Gladys","tags":["a","b"]}`},
+	}
+	for _, tt := range tests {
+		got, err := Apply([]byte(doc), []byte(tt.ops))
+		if err != nil || !jsonEqual(t, got, tt.want) {
+			t.Errorf("Apply(%s) = %s, %v, want %s", tt.ops, got, err, tt.want)
+		}
+	}
+}
+
+// TestApplyErrors checks that failing patches report an error.
+func TestApplyErrors(t *testing.T) {
+	doc := []byte(`{"name":"Gladys","tags":["a"]}`)
+	if _, err := Apply(doc, []byte(`[{"op":"test","path":"/name","value":"Derin"}]`)); !errors.Is(err, ErrTestFailed) {
+		t.Errorf("failed test op error = %v, want ErrTestFailed", err)
+	}
+	for _, ops := range []string{
+		`[{"op":"remove","path":"/missing"}]`,
+		`[{"op":"add","path":"/tags/5","value":1}]`,
+		`[{"op":"replace","path":"/name"}]`,
+		`[{"op":"frobnicate","path":"/name"}]`,
+		`{"op":"remove","path":"/name"}`,
+	} {
+		if _, err := Apply(doc, []byte(ops)); err == nil {
+			t.Errorf("Apply(%s) = nil error, want error", ops)
+		}
+	}
+}
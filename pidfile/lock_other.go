@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package pidfile
+
+import "os"
+
+// lock is a no-op where there is no file locking; the PID is still
+// written.
+func lock(*os.File) error { return nil }
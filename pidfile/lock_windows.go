@@ -0,0 +1,22 @@
+//go:build windows
+
+package pidfile
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lock takes a non-blocking exclusive lock on f, released when f closes.
+// Windows locks are mandatory, so the locked byte lies past the PID,
+// leaving it readable by the instance that failed to start.
+func lock(f *os.File) error {
+	ol := &windows.Overlapped{OffsetHigh: 1}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return ErrLocked
+	}
+	return err
+}
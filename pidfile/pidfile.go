@@ -0,0 +1,77 @@
+// Package pidfile writes the process ID to a file that stays exclusively
+// locked while the process runs, so a second instance on the same host
+// fails fast instead of halfway through startup. The lock, not the file's
+// existence, is what counts: a PID file left behind by a crash is reused.
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by Acquire when another process holds the lock.
+var ErrLocked = errors.New("pidfile: locked by another process")
+
+// File is a held PID file.
+type File struct {
+	path string
+	file *os.File
+}
+
+// Acquire locks the file at path, creating it if needed, and writes the
+// current process ID to it. If another process holds the lock it returns
+// an error wrapping ErrLocked that names that process.
+func Acquire(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("pidfile: %w", err)
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		if !errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("pidfile: locking %s: %w", path, err)
+		}
+		if pid, ok := Read(path); ok {
+			return nil, fmt.Errorf("%w: %s is held by pid %d; is another instance running?", ErrLocked, path, pid)
+		}
+		return nil, fmt.Errorf("%w: %s; is another instance running?", ErrLocked, path)
+	}
+	err = f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("pidfile: writing %s: %w", path, err)
+	}
+	return &File{path: path, file: f}, nil
+}
+
+// Read returns the process ID recorded at path.
+func Read(path string) (int, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, err == nil && pid > 0
+}
+
+// Release removes the file and drops the lock.
+func (f *File) Release() error {
+	// Remove while still holding the lock, so a starting instance can't
+	// take it just before the file goes away. Windows won't remove open
+	// files, so there it is removed after closing.
+	removed := os.Remove(f.path) == nil
+	err := f.file.Close()
+	if !removed {
+		os.Remove(f.path)
+	}
+	return err
+}
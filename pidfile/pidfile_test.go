@@ -0,0 +1,62 @@
+//go:build unix || windows
+
+package pidfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestAcquire checks that a held PID file records this process, turns
+// away a second holder, and can be taken again once released.
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.pid")
+	f, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	}
+	if pid, ok := Read(path); !ok || pid != os.Getpid() {
+		t.Errorf("Read() = %d, %v, want %d, true", pid, ok, os.Getpid())
+	}
+
+	_, err = Acquire(path)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Acquire() = %v, want ErrLocked", err)
+	}
+	if !strings.Contains(err.Error(), "pid "+strconv.Itoa(os.Getpid())) {
+		t.Errorf("second Acquire() = %q, want it to name the holder", err)
+	}
+
+	if err := f.Release(); err != nil {
+		t.Fatalf("Release() = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Stat() after Release() = %v, want not exist", err)
+	}
+	f, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() after Release() = %v", err)
+	}
+	f.Release()
+}
+
+// TestAcquireStale checks that a PID file left behind by a crash doesn't
+// block startup.
+func TestAcquireStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.pid")
+	if err := os.WriteFile(path, []byte("999999999\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	}
+	defer f.Release()
+	if pid, _ := Read(path); pid != os.Getpid() {
+		t.Errorf("Read() = %d, want %d", pid, os.Getpid())
+	}
+}
@@ -0,0 +1,235 @@
+// Package pii keeps personal information out of logs, exports and
+// analytics. Models tag the fields holding it with `pii:"redact"`, which
+// replaces a value with Redacted, or `pii:"hash"`, which replaces it with
+// a keyed hash, so values can still be told apart and grouped by without
+// being readable. A Redactor applies the tags wherever data leaves the
+// service, unless the request's token grants Scope.
+package pii
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+)
+
+// Tag is the struct tag marking personal fields.
+const Tag = "pii"
+
+// What a tag does to a field's value.
+const (
+	Redact = "redact"
+	Hash   = "hash"
+)
+
+// Redacted replaces redacted values.
+const Redacted = "[redacted]"
+
+// Scope is the scope a token needs to see personal fields in the clear.
+const Scope = "pii:read"
+
+// hashPrefix starts hashed values.
+const hashPrefix = "hash:"
+
+// Fields returns how the fields of model, a struct or pointer to one, are
+// tagged, by JSON name.
+func Fields(model interface{}) map[string]string {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields := make(map[string]string)
+	for _, f := range tagged(t) {
+		name, _, _ := strings.Cut(t.Field(f.index).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(f.index).Name
+		}
+		fields[name] = f.mode
+	}
+	return fields
+}
+
+type field struct {
+	index int
+	mode  string
+}
+
+// tagged returns the tagged fields of t, if it is a struct.
+func tagged(t reflect.Type) []field {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		switch mode := t.Field(i).Tag.Get(Tag); mode {
+		case Redact, Hash:
+			fields = append(fields, field{i, mode})
+		}
+	}
+	return fields
+}
+
+// Visible reports whether ctx carries the claims of a token granting
+// Scope.
+func Visible(ctx context.Context) bool {
+	claims, ok := auth.FromContext(ctx)
+	return ok && auth.Grants(claims)[Scope]
+}
+
+// Redactor applies pii tags. A nil Redactor leaves everything as is. It
+// is safe for concurrent use once its models are registered.
+type Redactor struct {
+	key    []byte
+	fields map[string]map[string]string
+}
+
+// NewRedactor returns a redactor hashing with key. Without a key it
+// hashes with a random one, so hashes only match within the process.
+func NewRedactor(key []byte) *Redactor {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &Redactor{key: key, fields: make(map[string]map[string]string)}
+}
+
+// Register redacts the records of collection as model is tagged. Call it
+// before the redactor is used.
+func (r *Redactor) Register(collection string, model interface{}) {
+	r.fields[collection] = Fields(model)
+}
+
+// hash returns the keyed hash of s.
+func (r *Redactor) hash(s string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(s))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Data returns data, a record of collection, with its tagged fields
+// redacted, unless ctx is Visible. Records of unregistered collections and
+// records that aren't JSON objects are returned as they are.
+func (r *Redactor) Data(ctx context.Context, collection string, data json.RawMessage) json.RawMessage {
+	if r == nil || Visible(ctx) {
+		return data
+	}
+	base, _, _ := strings.Cut(collection, "@")
+	fields := r.fields[base]
+	if len(fields) == 0 {
+		return data
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		return data
+	}
+	for name, mode := range fields {
+		raw, ok := obj[name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		value := Redacted
+		if mode == Hash {
+			var s string
+			if json.Unmarshal(raw, &s) != nil {
+				s = string(raw)
+			}
+			value = r.hash(s)
+		}
+		obj[name], _ = json.Marshal(value)
+	}
+	out, err := json.Marshal(obj)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// Apply redacts the tagged fields of v in place, unless ctx is Visible. v
+// is a pointer to a struct or a slice of structs or pointers to them.
+// Tagged string fields are redacted or hashed; tagged fields of other
+// types are zeroed.
+func (r *Redactor) Apply(ctx context.Context, v interface{}) {
+	if r == nil || Visible(ctx) {
+		return
+	}
+	r.apply(reflect.ValueOf(v))
+}
+
+func (r *Redactor) apply(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			r.apply(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			r.apply(v.Index(i))
+		}
+	case reflect.Struct:
+		for _, f := range tagged(v.Type()) {
+			fv := v.Field(f.index)
+			switch {
+			case !fv.CanSet():
+			case fv.Kind() != reflect.String:
+				fv.SetZero()
+			case fv.String() == "":
+			case f.mode == Hash:
+				fv.SetString(r.hash(fv.String()))
+			default:
+				fv.SetString(Redacted)
+			}
+		}
+	}
+}
+
+// Hook is a logrus hook redacting the tagged fields of structs, and
+// pointers to them, logged as entry fields, unless the entry was logged
+// with a Visible context. The logged values themselves are left alone.
+type Hook struct {
+	Redactor *Redactor
+}
+
+func (Hook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h Hook) Fire(entry *logrus.Entry) error {
+	if h.Redactor == nil || entry.Context != nil && Visible(entry.Context) {
+		return nil
+	}
+	for k, v := range entry.Data {
+		t := reflect.TypeOf(v)
+		if t == nil {
+			continue
+		}
+		ptr := t.Kind() == reflect.Pointer
+		if ptr {
+			t = t.Elem()
+		}
+		if len(tagged(t)) == 0 {
+			continue
+		}
+		value := reflect.ValueOf(v)
+		if ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		cp := reflect.New(t)
+		cp.Elem().Set(value)
+		h.Redactor.apply(cp)
+		if ptr {
+			entry.Data[k] = cp.Interface()
+		} else {
+			entry.Data[k] = cp.Elem().Interface()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package pii
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+)
+
+type contact struct {
+	Name  string `json:"name" pii:"hash"`
+	Email string `json:"email,omitempty" pii:"redact"`
+	Age   int    `pii:"redact"`
+	Note  string `json:"note"`
+}
+
+// admin is a context whose token grants Scope.
+var admin = auth.NewContext(context.Background(), jwt.MapClaims{"scope": "admin " + Scope})
+
+// TestFields checks that tagged fields are named as they are in JSON.
+func TestFields(t *testing.T) {
+	got := Fields(&contact{})
+	if len(got) != 3 || got["name"] != Hash || got["email"] != Redact || got["Age"] != Redact {
+		t.Errorf("Fields(contact) = %v, want name hashed and email and Age redacted", got)
+	}
+}
+
+// TestData checks that records of registered collections, tenant copies
+// included, are redacted unless the context is visible.
+func TestData(t *testing.T) {
+	r := NewRedactor([]byte("key"))
+	r.Register("contacts", contact{})
+	data := json.RawMessage(`{"name":"gladys","email":"g@example.com","note":"hi"}`)
+
+	var got map[string]interface{}
+	json.Unmarshal(r.Data(context.Background(), "contacts@acme", data), &got)
+	if got["name"] != r.hash("gladys") || got["email"] != Redacted || got["note"] != "hi" {
+		t.Errorf("Data(contacts) = %v, want name hashed, email redacted and note kept", got)
+	}
+	if out := r.Data(admin, "contacts", data); string(out) != string(data) {
+		t.Errorf("Data(contacts) with %s = %s, want it unchanged", Scope, out)
+	}
+	if out := r.Data(context.Background(), "notes", data); string(out) != string(data) {
+		t.Errorf("Data(notes) = %s, want unregistered collections unchanged", out)
+	}
+	if got, again := r.hash("gladys"), NewRedactor([]byte("key")).hash("gladys"); got != again {
+		t.Errorf("hash(gladys) = %q and %q under the same key, want them equal", got, again)
+	}
+}
+
+// TestApply checks that structs are redacted in place, in slices too, and
+// that empty values are left empty.
+func TestApply(t *testing.T) {
+	r := NewRedactor(nil)
+	cs := []contact{{Name: "gladys", Email: "g@example.com", Age: 40, Note: "hi"}, {Name: "derin"}}
+	r.Apply(context.Background(), cs)
+	if c := cs[0]; c.Name != r.hash("gladys") || c.Email != Redacted || c.Age != 0 || c.Note != "hi" {
+		t.Errorf("Apply(contact) = %+v, want name hashed, email and age redacted", c)
+	}
+	if c := cs[1]; c.Email != "" {
+		t.Errorf("Apply(contact without email) = %+v, want email empty", c)
+	}
+
+	c := contact{Name: "gladys"}
+	r.Apply(admin, &c)
+	(*Redactor)(nil).Apply(context.Background(), &c)
+	if c.Name != "gladys" {
+		t.Errorf("Apply(contact) with %s or a nil redactor = %+v, want it unchanged", Scope, c)
+	}
+}
+
+// TestHook checks that logged structs are redacted, without changing the
+// caller's copy, unless logged with a visible context.
+func TestHook(t *testing.T) {
+	h := Hook{Redactor: NewRedactor(nil)}
+	c := &contact{Email: "g@example.com"}
+	entry := logrus.WithFields(logrus.Fields{"contact": c, "plain": contact{Email: "d@example.com"}, "n": 1})
+	h.Fire(entry)
+	if got := entry.Data["contact"].(*contact); got.Email != Redacted || c.Email != "g@example.com" {
+		t.Errorf("Fire: logged %+v, caller has %+v; want only the logged copy redacted", got, c)
+	}
+	if got := entry.Data["plain"].(contact); got.Email != Redacted {
+		t.Errorf("Fire: logged %+v, want email redacted", got)
+	}
+
+	entry = logrus.WithContext(admin).WithField("contact", c)
+	h.Fire(entry)
+	if got := entry.Data["contact"].(*contact); got.Email != "g@example.com" {
+		t.Errorf("Fire with %s: logged %+v, want it unchanged", Scope, got)
+	}
+}
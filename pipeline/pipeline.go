@@ -0,0 +1,271 @@
+// Package pipeline generates greetings as a series of stages: pick the
+// formats for the greeted's language, render the message, then filter and
+// decorate it. Stages are registered by type, like response hooks, and
+// chosen in configuration, so greetings can change without changes to the
+// handlers that serve them.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/pkg/greetings"
+)
+
+// Greeting is a greeting on its way through a pipeline. Stages read and
+// change it in turn.
+type Greeting struct {
+	Name string
+	// Langs are the languages the greeted prefers, best first.
+	Langs []language.Tag
+	// Lang is the language Formats are in, and Formats the formats the
+	// message is rendered from. Empty Formats render the built-in ones.
+	Lang    language.Tag
+	Formats []string
+	// Message is the greeting, empty until it's rendered.
+	Message string
+}
+
+// Stage changes a greeting. An error stops the pipeline.
+type Stage func(ctx context.Context, g *Greeting) error
+
+// Spec configures one stage. Which fields apply depends on Type.
+type Spec struct {
+	Type string `mapstructure:"type"`
+	// Words are the words a profanity stage masks; empty masks
+	// DefaultWords.
+	Words []string `mapstructure:"words"`
+	// Mask is the character masked words are replaced with, * by default.
+	Mask string `mapstructure:"mask"`
+	// Emoji is what an emoji stage adds, and Position where: suffix (the
+	// default) or prefix.
+	Emoji    string `mapstructure:"emoji"`
+	Position string `mapstructure:"position"`
+}
+
+// Env holds what stages may need besides their spec.
+type Env struct {
+	// Catalog is where the localize stage finds formats.
+	Catalog *i18n.Catalog
+}
+
+// Builder makes a stage from its spec.
+type Builder func(Spec, Env) (Stage, error)
+
+var (
+	buildersMu sync.RWMutex
+	builders   = map[string]Builder{
+		"emoji":     buildEmoji,
+		"localize":  buildLocalize,
+		"profanity": buildProfanity,
+		"template":  buildTemplate,
+	}
+)
+
+// Register makes a stage type available to configuration. Registering a
+// type twice replaces the builder.
+func Register(typ string, b Builder) {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	builders[typ] = b
+}
+
+// Types returns the registered stage types, sorted.
+func Types() []string {
+	buildersMu.RLock()
+	defer buildersMu.RUnlock()
+	return typesLocked()
+}
+
+// typesLocked is Types for callers holding buildersMu.
+func typesLocked() []string {
+	var out []string
+	for t := range builders {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DefaultSpecs are the stages of a pipeline nothing is configured for:
+// greetings in the best catalog language, unfiltered.
+var DefaultSpecs = []Spec{{Type: "localize"}, {Type: "template"}}
+
+// Pipeline runs stages in order.
+type Pipeline struct {
+	stages []Stage
+}
+
+// New returns a pipeline running stages in order.
+func New(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Default returns the pipeline of DefaultSpecs, localizing from catalog.
+func Default(catalog *i18n.Catalog) *Pipeline {
+	return New(Localize(catalog), Template())
+}
+
+// Build makes the pipeline of specs, in order.
+func Build(specs []Spec, env Env) (*Pipeline, error) {
+	buildersMu.RLock()
+	defer buildersMu.RUnlock()
+	stages := make([]Stage, 0, len(specs))
+	for i, s := range specs {
+		b, ok := builders[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("pipeline: stage %d: unknown type %q (have %s)", i, s.Type, strings.Join(typesLocked(), ", "))
+		}
+		st, err := b(s, env)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: stage %d (%s): %w", i, s.Type, err)
+		}
+		stages = append(stages, st)
+	}
+	return New(stages...), nil
+}
+
+// Use appends stages to p, for stages registered in code.
+func (p *Pipeline) Use(stages ...Stage) {
+	p.stages = append(p.stages, stages...)
+}
+
+// Run passes g through every stage and returns the result.
+func (p *Pipeline) Run(ctx context.Context, g Greeting) (Greeting, error) {
+	for _, st := range p.stages {
+		if err := st(ctx, &g); err != nil {
+			return g, err
+		}
+	}
+	return g, nil
+}
+
+// Hello runs a greeting for name in the languages langs, best first, and
+// returns its message. It fails like greetings.Hello for names that can't
+// be greeted.
+func (p *Pipeline) Hello(ctx context.Context, name string, langs ...language.Tag) (string, error) {
+	g, err := p.Greet(ctx, name, langs...)
+	return g.Message, err
+}
+
+// Greet is Hello returning the whole greeting, so callers can tell which
+// language it is in.
+func (p *Pipeline) Greet(ctx context.Context, name string, langs ...language.Tag) (Greeting, error) {
+	if err := greetings.Check(name); err != nil {
+		return Greeting{}, err
+	}
+	return p.Run(ctx, Greeting{Name: name, Langs: langs})
+}
+
+// Localize returns a stage picking the catalog language best matching
+// the greeting's Langs, and its formats.
+func Localize(catalog *i18n.Catalog) Stage {
+	return func(ctx context.Context, g *Greeting) error {
+		g.Lang, g.Formats = catalog.Match(g.Langs...)
+		return nil
+	}
+}
+
+func buildLocalize(_ Spec, env Env) (Stage, error) {
+	if env.Catalog == nil {
+		return nil, fmt.Errorf("no catalog to localize from")
+	}
+	return Localize(env.Catalog), nil
+}
+
+// Template returns a stage rendering the message from one of the
+// greeting's formats, picked at random.
+func Template() Stage {
+	return func(ctx context.Context, g *Greeting) error {
+		formats := g.Formats
+		if len(formats) == 0 {
+			formats = greetings.Formats
+		}
+		msg, err := greetings.HelloWith(formats, g.Name)
+		if err != nil {
+			return err
+		}
+		g.Message = msg
+		return nil
+	}
+}
+
+func buildTemplate(Spec, Env) (Stage, error) {
+	return Template(), nil
+}
+
+// DefaultWords are masked by a profanity stage that names none.
+var DefaultWords = []string{"arse", "bastard", "bollocks", "crap", "damn", "fuck", "shit"}
+
+// Profanity returns a stage masking every whole-word, case-insensitive
+// occurrence of words in the message with mask, one per letter, so a
+// greeting for a rude name can still be shown.
+func Profanity(words []string, mask rune) Stage {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return func(context.Context, *Greeting) error { return nil }
+	}
+	re := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return func(ctx context.Context, g *Greeting) error {
+		g.Message = re.ReplaceAllStringFunc(g.Message, func(word string) string {
+			return strings.Repeat(string(mask), utf8.RuneCountInString(word))
+		})
+		return nil
+	}
+}
+
+func buildProfanity(s Spec, _ Env) (Stage, error) {
+	words := s.Words
+	if len(words) == 0 {
+		words = DefaultWords
+	}
+	mask := '*'
+	if s.Mask != "" {
+		r, size := utf8.DecodeRuneInString(s.Mask)
+		if size != len(s.Mask) {
+			return nil, fmt.Errorf("mask must be one character, not %q", s.Mask)
+		}
+		mask = r
+	}
+	return Profanity(words, mask), nil
+}
+
+// Emoji returns a stage adding emoji to the message, before it if prefix
+// is true and after it otherwise, separated by a space.
+func Emoji(emoji string, prefix bool) Stage {
+	return func(ctx context.Context, g *Greeting) error {
+		if prefix {
+			g.Message = emoji + " " + g.Message
+		} else {
+			g.Message += " " + emoji
+		}
+		return nil
+	}
+}
+
+func buildEmoji(s Spec, _ Env) (Stage, error) {
+	emoji := s.Emoji
+	if emoji == "" {
+		emoji = "👋"
+	}
+	switch s.Position {
+	case "", "suffix":
+		return Emoji(emoji, false), nil
+	case "prefix":
+		return Emoji(emoji, true), nil
+	}
+	return nil, fmt.Errorf("position must be prefix or suffix, not %q", s.Position)
+}
@@ -0,0 +1,85 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/language"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/i18n"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestBuild checks the built-in stages run in the configured order, from
+// a catalog translation to a filtered, decorated message.
+func TestBuild(t *testing.T) {
+	store := storage.NewMemory()
+	data, _ := json.Marshal(i18n.Translation{Formats: []string{"Oi, %v!"}})
+	if _, err := store.Create(context.Background(), i18n.TranslationsCollection, "pt", data); err != nil {
+		t.Fatal(err)
+	}
+	catalog := i18n.NewCatalog(store)
+	if err := catalog.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Build([]Spec{
+		{Type: "localize"},
+		{Type: "template"},
+		{Type: "profanity", Words: []string{"darn"}},
+		{Type: "emoji", Emoji: "🎉", Position: "prefix"},
+	}, Env{Catalog: catalog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Hello(context.Background(), "Darn Gladys", language.MustParse("pt-BR"))
+	if want := "🎉 Oi, **** Gladys!"; got != want || err != nil {
+		t.Errorf("Hello(Darn Gladys, pt-BR) = %q, %v, want %q, nil", got, err, want)
+	}
+	if _, err := p.Hello(context.Background(), ""); err == nil {
+		t.Error(`Hello("") = nil error, want no name`)
+	}
+
+	for _, specs := range [][]Spec{
+		{{Type: "shout"}},
+		{{Type: "localize"}},
+		{{Type: "emoji", Position: "middle"}},
+		{{Type: "profanity", Mask: "##"}},
+	} {
+		if _, err := Build(specs, Env{}); err == nil {
+			t.Errorf("Build(%+v) = nil error, want one", specs)
+		}
+	}
+}
+
+// TestRegister checks that stage types registered in code can be
+// configured like the built-in ones.
+func TestRegister(t *testing.T) {
+	Register("shout", func(Spec, Env) (Stage, error) {
+		return func(ctx context.Context, g *Greeting) error {
+			g.Message = strings.ToUpper(g.Message)
+			return nil
+		}, nil
+	})
+	p, err := Build([]Spec{{Type: "template"}, {Type: "shout"}}, Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := p.Hello(context.Background(), "Gladys")
+	if !strings.Contains(got, "GLADYS") {
+		t.Errorf("Hello(Gladys) through shout = %q, want it upper-cased", got)
+	}
+}
+
+// TestProfanity checks that only whole words are masked, whatever their
+// case.
+func TestProfanity(t *testing.T) {
+	st := Profanity(DefaultWords, '*')
+	g := &Greeting{Message: "Hi, Damn Scrapbook. Welcome, damn!"}
+	st(context.Background(), g)
+	if want := "Hi, **** Scrapbook. Welcome, ****!"; g.Message != want {
+		t.Errorf("Profanity = %q, want %q", g.Message, want)
+	}
+}
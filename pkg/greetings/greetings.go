@@ -8,14 +8,29 @@ import (
 )
 
 func Hello(name string) (string, error) {
+	return HelloWith(Formats, name)
+}
 
-	if name == "" {
-		return "", errors.New("no name")
+// HelloWith is like Hello but picks the message from formats, each of
+// which contains a single %v for the name.
+func HelloWith(formats []string, name string) (string, error) {
+
+	if err := Check(name); err != nil {
+		return "", err
 	}
-	message := fmt.Sprintf(randomFormat(), name)
+	message := fmt.Sprintf(randomFormat(formats), name)
 	return message, nil
 }
 
+// Check returns the error Hello would return for name, without building a
+// message.
+func Check(name string) error {
+	if name == "" {
+		return errors.New("no name")
+	}
+	return nil
+}
+
 // Hellos returns a map that associates each of the named people
 // with a greeting message.
 func Hellos(names []string) (map[string]string, error) {
@@ -40,16 +55,16 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
-// randomFormat returns one of a set of greeting messages. The returned
-// message is selected at random.
-func randomFormat() string {
-	// A slice of message formats.
-	formats := []string{
-		"Hi, %v. Welcome!",
-		"Great to see you, %v!",
-		"Hail, %v! Well met!",
-	}
+// Formats are the built-in (English) greeting message formats.
+var Formats = []string{
+	"Hi, %v. Welcome!",
+	"Great to see you, %v!",
+	"Hail, %v! Well met!",
+}
 
+// randomFormat returns one of formats. The returned
+// message is selected at random.
+func randomFormat(formats []string) string {
 	// Return a randomly selected message format by specifying
 	// a random index for the slice of formats.
 	return formats[rand.Intn(len(formats))]
@@ -0,0 +1,466 @@
+// Package plans ties what a caller may do to the plan it is on, such as
+// free, pro or internal: its rate limit, its daily request quota and the
+// features it may use. Plans are configured; which subject, a tenant or
+// an API key's client, is on which plan is stored, so admins can move
+// subjects between plans without a restart.
+package plans
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/middleware"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Collection is the storage collection assignments live in, by subject.
+const Collection = "plan_assignments"
+
+// Built-in plan names.
+const (
+	Free     = "free"
+	Pro      = "pro"
+	Internal = "internal"
+)
+
+// Subject prefixes: assignments are to "tenant:<tenant>" or
+// "client:<client name>".
+const (
+	TenantPrefix = "tenant:"
+	ClientPrefix = "client:"
+)
+
+// Header names the plan a response was served under.
+const Header = "X-Plan"
+
+// AllFeatures in a plan's Features grants every feature.
+const AllFeatures = "*"
+
+// DefaultCacheTTL is how long a Service trusts an assignment it read
+// before reading it again, so another replica's changes show up.
+const DefaultCacheTTL = 30 * time.Second
+
+// Errors returned by Service.
+var (
+	ErrUnknownPlan    = errors.New("plans: no such plan")
+	ErrInvalidSubject = errors.New("plans: subject must be tenant:<tenant> or client:<client>")
+)
+
+var rejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "plan_rejected_requests_total",
+	Help: "Requests rejected by their plan, by plan and reason (rate, quota or feature).",
+}, []string{"plan", "reason"})
+
+// Plan is what subjects on it may do.
+type Plan struct {
+	Name string `json:"name" mapstructure:"-"`
+	// Limit is the sustained rate and burst of requests; a zero Rate is
+	// unlimited.
+	Limit clients.Limit `json:"limit" mapstructure:",squash"`
+	// Quota is how many requests a day, UTC, are allowed; zero is
+	// unlimited.
+	Quota int64 `json:"quota" mapstructure:"quota"`
+	// Features are the features the plan may use, or AllFeatures.
+	Features []string `json:"features" mapstructure:"features"`
+}
+
+// Allows reports whether p grants feature.
+func (p Plan) Allows(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature || f == AllFeatures {
+			return true
+		}
+	}
+	return false
+}
+
+// Defaults are the built-in plans.
+var Defaults = map[string]Plan{
+	Free:     {Limit: clients.Limit{Rate: 1, Burst: 10}, Quota: 1000, Features: []string{}},
+	Pro:      {Limit: clients.Limit{Rate: 20, Burst: 50}, Quota: 100000, Features: []string{"webhooks"}},
+	Internal: {Features: []string{AllFeatures}},
+}
+
+// Assignment puts a subject on a plan.
+type Assignment struct {
+	Subject   string    `json:"subject"`
+	Plan      string    `json:"plan"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// cached is an assignment as of read, or no plan if plan is "".
+type cached struct {
+	plan string
+	read time.Time
+}
+
+// usage is one subject's requests on day.
+type usage struct {
+	day   time.Time
+	count int64
+}
+
+// Service looks up subjects' plans and enforces them. It is safe for
+// concurrent use. A nil Service enforces nothing.
+type Service struct {
+	Store storage.Store
+	// Default is the plan of subjects without an assignment.
+	Default string
+	// CacheTTL is how long assignments are trusted before being read
+	// again.
+	CacheTTL time.Duration
+	plans    map[string]Plan
+	limiters map[string]*middleware.Limiter
+	now      func() time.Time
+
+	mu       sync.Mutex
+	assigned map[string]cached
+	used     map[string]*usage
+}
+
+// NewService returns a service with plans, keeping assignments in store
+// and putting subjects without one on def.
+func NewService(store storage.Store, plans map[string]Plan, def string) (*Service, error) {
+	if _, ok := plans[def]; !ok {
+		return nil, fmt.Errorf("%w: default %q", ErrUnknownPlan, def)
+	}
+	s := &Service{
+		Store:    store,
+		Default:  def,
+		CacheTTL: DefaultCacheTTL,
+		plans:    make(map[string]Plan, len(plans)),
+		limiters: make(map[string]*middleware.Limiter, len(plans)),
+		now:      time.Now,
+		assigned: make(map[string]cached),
+		used:     make(map[string]*usage),
+	}
+	for name, p := range plans {
+		p.Name = name
+		s.plans[name] = p
+		s.limiters[name] = middleware.NewLimiter(p.Limit.Rate, p.Limit.Burst)
+	}
+	return s, nil
+}
+
+// SetClock makes the service refill limits, count quotas and expire
+// cached assignments by now instead of the wall clock, for tests. Call it
+// before the service is used.
+func (s *Service) SetClock(now func() time.Time) {
+	s.now = now
+	for _, l := range s.limiters {
+		l.SetClock(now)
+	}
+}
+
+// Plans returns the configured plans by name.
+func (s *Service) Plans() []Plan {
+	out := make([]Plan, 0, len(s.plans))
+	for _, p := range s.plans {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Subject returns who r acts for: its tenant if it names one, and
+// otherwise its client.
+func Subject(r *http.Request) string {
+	if tenant, ok := storage.TenantFrom(r.Context()); ok {
+		return TenantPrefix + tenant
+	}
+	return ClientPrefix + clients.FromContext(r.Context()).Name
+}
+
+// validSubject reports whether subject has a known prefix and a name.
+func validSubject(subject string) bool {
+	for _, prefix := range []string{TenantPrefix, ClientPrefix} {
+		if name, ok := strings.CutPrefix(subject, prefix); ok && name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PlanFor returns subject's plan.
+func (s *Service) PlanFor(ctx context.Context, subject string) (Plan, error) {
+	now := s.now()
+	s.mu.Lock()
+	c, ok := s.assigned[subject]
+	s.mu.Unlock()
+	if !ok || now.Sub(c.read) >= s.CacheTTL {
+		a, err := s.get(ctx, subject)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return Plan{}, err
+		}
+		c = cached{plan: a.Plan, read: now}
+		s.mu.Lock()
+		s.assigned[subject] = c
+		s.mu.Unlock()
+	}
+	if p, ok := s.plans[c.plan]; ok {
+		return p, nil
+	}
+	// Unassigned, or assigned a plan since removed from the config.
+	return s.plans[s.Default], nil
+}
+
+func (s *Service) get(ctx context.Context, subject string) (Assignment, error) {
+	rec, err := s.Store.Get(storage.Unscoped(ctx), Collection, subject)
+	if err != nil {
+		return Assignment{}, err
+	}
+	return fromRecord(rec)
+}
+
+// Assignments returns the stored assignments, oldest first.
+func (s *Service) Assignments(ctx context.Context) ([]Assignment, error) {
+	recs, err := s.Store.List(storage.Unscoped(ctx), Collection, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Assignment, 0, len(recs))
+	for _, rec := range recs {
+		a, err := fromRecord(rec)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// Assign puts subject on plan.
+func (s *Service) Assign(ctx context.Context, subject, plan string) (Assignment, error) {
+	if !validSubject(subject) {
+		return Assignment{}, ErrInvalidSubject
+	}
+	if _, ok := s.plans[plan]; !ok {
+		return Assignment{}, ErrUnknownPlan
+	}
+	ctx = storage.Unscoped(ctx)
+	data, _ := json.Marshal(Assignment{Subject: subject, Plan: plan})
+	rec, err := s.Store.Update(ctx, Collection, subject, data, 0)
+	if errors.Is(err, storage.ErrNotFound) {
+		rec, err = s.Store.Create(ctx, Collection, subject, data)
+	}
+	if err != nil {
+		return Assignment{}, err
+	}
+	s.remember(subject, plan)
+	return fromRecord(rec)
+}
+
+// Unassign returns subject to the default plan.
+func (s *Service) Unassign(ctx context.Context, subject string) error {
+	if err := s.Store.Delete(storage.Unscoped(ctx), Collection, subject, 0); err != nil {
+		return err
+	}
+	s.remember(subject, "")
+	return nil
+}
+
+func (s *Service) remember(subject, plan string) {
+	s.mu.Lock()
+	s.assigned[subject] = cached{plan: plan, read: s.now()}
+	s.mu.Unlock()
+}
+
+// count records a request by subject and reports whether it is within
+// quota for the day. When it isn't, retryAfter says when the day ends.
+func (s *Service) count(subject string, quota int64) (ok bool, retryAfter time.Duration) {
+	if quota <= 0 {
+		return true, 0
+	}
+	now := s.now().UTC()
+	day := startOfDay(now)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.used[subject]
+	if u == nil || !u.day.Equal(day) {
+		if u == nil && len(s.used) >= middleware.DefaultMaxKeys {
+			s.forget(day)
+		}
+		u = &usage{day: day}
+		s.used[subject] = u
+	}
+	if u.count >= quota {
+		return false, day.AddDate(0, 0, 1).Sub(now)
+	}
+	u.count++
+	return true, 0
+}
+
+// startOfDay returns the start of t's day, UTC, which quotas are counted
+// by.
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// forget drops the counts of days before day.
+func (s *Service) forget(day time.Time) {
+	for subject, u := range s.used {
+		if u.day.Before(day) {
+			delete(s.used, subject)
+		}
+	}
+}
+
+// savedUsage is a subject's quota usage as State saves it.
+type savedUsage struct {
+	Day   time.Time `json:"day"`
+	Count int64     `json:"count"`
+}
+
+// savedState is the Service state State saves.
+type savedState struct {
+	// Limiters are the buckets of each plan's limiter.
+	Limiters map[string]json.RawMessage `json:"limiters"`
+	Quotas   map[string]savedUsage      `json:"quotas"`
+}
+
+// State returns the plans' rate-limit buckets and today's quota counts as
+// JSON, so they can be restored after a restart. It implements
+// limitstate.Stateful.
+func (s *Service) State() (json.RawMessage, error) {
+	saved := savedState{Limiters: make(map[string]json.RawMessage, len(s.limiters)), Quotas: make(map[string]savedUsage)}
+	for name, l := range s.limiters {
+		state, err := l.State()
+		if err != nil {
+			return nil, err
+		}
+		saved.Limiters[name] = state
+	}
+	day := startOfDay(s.now())
+	s.mu.Lock()
+	for subject, u := range s.used {
+		if u.day.Equal(day) {
+			saved.Quotas[subject] = savedUsage{Day: u.day, Count: u.count}
+		}
+	}
+	s.mu.Unlock()
+	return json.Marshal(saved)
+}
+
+// Restore sets the buckets and quota counts saved by State, leaving those
+// already in use, which are newer. Plans no longer configured are
+// skipped, and counts of past days are dropped as count would drop them.
+func (s *Service) Restore(data json.RawMessage) error {
+	var saved savedState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	for name, state := range saved.Limiters {
+		if l, ok := s.limiters[name]; ok {
+			if err := l.Restore(state); err != nil {
+				return err
+			}
+		}
+	}
+	day := startOfDay(s.now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for subject, u := range saved.Quotas {
+		if _, ok := s.used[subject]; ok || !u.Day.Equal(day) || len(s.used) >= middleware.DefaultMaxKeys {
+			continue
+		}
+		s.used[subject] = &usage{day: u.Day, count: u.Count}
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p Plan) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the plan stored in ctx by Middleware.
+func FromContext(ctx context.Context) (Plan, bool) {
+	p, ok := ctx.Value(contextKey{}).(Plan)
+	return p, ok
+}
+
+// Middleware looks up the plan of every request's Subject, rejecting
+// requests over its rate limit or daily quota with 429 and Retry-After,
+// and stores it in the request context. Requests whose path exempt
+// accepts, if it isn't nil, pass unmetered. Quotas are counted per
+// replica. Install it after the client and tenant are identified.
+func (s *Service) Middleware(exempt func(path string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if s == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt != nil && exempt(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			subject := Subject(r)
+			p, err := s.PlanFor(r.Context(), subject)
+			if err != nil {
+				respond.Error(w, http.StatusServiceUnavailable, "looking up plan: "+err.Error())
+				return
+			}
+			w.Header().Set(Header, p.Name)
+			ok, retryAfter := s.limiters[p.Name].Allow(subject)
+			reason := "rate"
+			if ok {
+				ok, retryAfter = s.count(subject, p.Quota)
+				reason = "quota"
+			}
+			if !ok {
+				rejected.WithLabelValues(p.Name, reason).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				if reason == "quota" {
+					respond.Error(w, http.StatusTooManyRequests, "daily quota of the "+p.Name+" plan exceeded")
+					return
+				}
+				respond.Error(w, http.StatusTooManyRequests, "rate limit of the "+p.Name+" plan exceeded")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+		})
+	}
+}
+
+// Feature wraps h so that only requests whose plan grants feature reach
+// it; others get 403. Requests without a plan, as when s is nil, pass.
+func (s *Service) Feature(feature string, h http.HandlerFunc) http.HandlerFunc {
+	if s == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := FromContext(r.Context()); ok && !p.Allows(feature) {
+			rejected.WithLabelValues(p.Name, "feature").Inc()
+			respond.Error(w, http.StatusForbidden, "the "+p.Name+" plan doesn't include "+feature)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func fromRecord(rec storage.Record) (Assignment, error) {
+	var a Assignment
+	if err := json.Unmarshal(rec.Data, &a); err != nil {
+		return Assignment{}, err
+	}
+	a.Subject, a.CreatedAt, a.UpdatedAt = rec.ID, rec.CreatedAt, rec.UpdatedAt
+	return a, nil
+}
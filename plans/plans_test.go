@@ -0,0 +1,126 @@
+package plans
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+func newService(t *testing.T, now *time.Time) *Service {
+	t.Helper()
+	s, err := NewService(storage.NewMemory(), map[string]Plan{
+		Free: {Limit: clients.Limit{Rate: 1, Burst: 2}, Quota: 3},
+		Pro:  {Features: []string{"webhooks"}},
+	}, Free)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetClock(func() time.Time { return *now })
+	return s
+}
+
+// call serves a request from client through s's Middleware and a handler
+// gated on the webhooks feature.
+func call(s *Service, client string) *httptest.ResponseRecorder {
+	h := s.Middleware(nil)(s.Feature("webhooks", func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/webhooks", nil)
+	req = req.WithContext(clients.NewContext(req.Context(), clients.Identity{Name: client}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestMiddleware checks that the default plan's rate limit, quota and
+// features apply until the client is assigned another plan.
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	s := newService(t, &now)
+
+	if rec := call(s, "mobile"); rec.Code != http.StatusForbidden || rec.Header().Get(Header) != Free {
+		t.Errorf("call on free = %d %s, want 403 from the free plan", rec.Code, rec.Header().Get(Header))
+	}
+	call(s, "mobile")
+	if rec := call(s, "mobile"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("call over the burst = %d, want 429", rec.Code)
+	}
+	now = now.Add(10 * time.Second)
+	call(s, "mobile")
+	rec := call(s, "mobile")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3590" {
+		t.Errorf("call over the quota = %d Retry-After %s, want 429 until midnight", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	now = now.Add(time.Hour)
+	if rec := call(s, "mobile"); rec.Code != http.StatusForbidden {
+		t.Errorf("call the next day = %d, want the quota reset", rec.Code)
+	}
+
+	if _, err := s.Assign(context.Background(), ClientPrefix+"mobile", Pro); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if rec := call(s, "mobile"); rec.Code != http.StatusOK || rec.Header().Get(Header) != Pro {
+			t.Fatalf("call %d on pro = %d %s, want 200 from the pro plan", i, rec.Code, rec.Header().Get(Header))
+		}
+	}
+}
+
+// TestState checks that today's quota counts survive a State and Restore
+// into a new service, and yesterday's don't.
+func TestState(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	s := newService(t, &now)
+	call(s, "mobile")
+	call(s, "mobile")
+	now = now.Add(10 * time.Second)
+	call(s, "mobile")
+	state, err := s.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newService(t, &now)
+	if err := restored.Restore(state); err != nil {
+		t.Fatal(err)
+	}
+	if rec := call(restored, "mobile"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("call after Restore = %d, want 429 from the restored quota", rec.Code)
+	}
+	now = now.Add(time.Hour)
+	restored = newService(t, &now)
+	restored.Restore(state)
+	if rec := call(restored, "mobile"); rec.Code != http.StatusForbidden {
+		t.Errorf("call the next day after Restore = %d, want yesterday's quota dropped", rec.Code)
+	}
+}
+
+// TestAssign checks that assignments are validated and can be undone.
+func TestAssign(t *testing.T) {
+	now := time.Now()
+	s := newService(t, &now)
+	ctx := context.Background()
+
+	if _, err := s.Assign(ctx, "mobile", Pro); err != ErrInvalidSubject {
+		t.Errorf("Assign(mobile) = %v, want ErrInvalidSubject", err)
+	}
+	if _, err := s.Assign(ctx, TenantPrefix+"acme", "gold"); err != ErrUnknownPlan {
+		t.Errorf("Assign(gold) = %v, want ErrUnknownPlan", err)
+	}
+	s.Assign(ctx, TenantPrefix+"acme", Pro)
+	if a, err := s.Assign(ctx, TenantPrefix+"acme", Free); err != nil || a.Plan != Free {
+		t.Errorf("Assign again = %+v, %v, want it moved to free", a, err)
+	}
+	if err := s.Unassign(ctx, TenantPrefix+"acme"); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := s.PlanFor(ctx, TenantPrefix+"acme"); p.Name != Free {
+		t.Errorf("PlanFor after Unassign = %s, want the default", p.Name)
+	}
+	if _, err := NewService(s.Store, Defaults, "gold"); err == nil {
+		t.Error("NewService(default gold) = nil error, want ErrUnknownPlan")
+	}
+}
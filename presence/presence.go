@@ -0,0 +1,221 @@
+// Package presence tracks which users currently hold a streaming
+// connection (server-sent events or WebSocket), per tenant. Entries live in
+// the cache with a TTL that open connections keep refreshing, so a crashed
+// instance's users drop out on their own. Users going online and offline
+// are published on the event bus.
+package presence
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+)
+
+// UserHeader names the user a request is made by. Connections without it
+// aren't tracked.
+const UserHeader = "X-User-ID"
+
+// DefaultTTL is how long an entry outlives its last refresh.
+const DefaultTTL = time.Minute
+
+// Entry is one user's presence.
+type Entry struct {
+	Tenant string `json:"tenant"`
+	User   string `json:"user"`
+	// Connections is the number of open connections on this instance.
+	Connections int       `json:"connections"`
+	Since       time.Time `json:"since"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// key identifies a user within a tenant.
+type key struct {
+	tenant, user string
+}
+
+func entryKey(k key) string {
+	return "presence:" + k.tenant + "\x00" + k.user
+}
+
+func indexKey(tenant string) string {
+	return "presence-index:" + tenant
+}
+
+// Tracker records connections. It is safe for concurrent use.
+type Tracker struct {
+	Cache  cache.Cache
+	Events *events.Bus
+	// TTL is how long entries stay in the cache without a refresh.
+	TTL time.Duration
+
+	mu    sync.Mutex
+	local map[key]*Entry
+}
+
+// NewTracker returns a tracker keeping entries in c and publishing changes
+// on bus.
+func NewTracker(c cache.Cache, bus *events.Bus, ttl time.Duration) *Tracker {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Tracker{Cache: c, Events: bus, TTL: ttl, local: make(map[key]*Entry)}
+}
+
+// Connect records a new connection by user in tenant, publishing
+// events.PresenceOnline if it is the user's first. Call the returned
+// function when the connection closes.
+func (t *Tracker) Connect(ctx context.Context, tenant, user string) (disconnect func()) {
+	k := key{tenant, user}
+	now := time.Now().UTC()
+	t.mu.Lock()
+	e := t.local[k]
+	first := e == nil
+	if first {
+		e = &Entry{Tenant: tenant, User: user, Since: now}
+		t.local[k] = e
+	}
+	e.Connections++
+	e.LastSeen = now
+	snapshot := *e
+	t.save(ctx, snapshot, first)
+	t.mu.Unlock()
+	if first {
+		t.Events.Publish(ctx, events.PresenceOnline, snapshot)
+	}
+
+	var once sync.Once
+	return func() { once.Do(func() { t.disconnect(k) }) }
+}
+
+// disconnect drops one connection of k, publishing events.PresenceOffline
+// when it was the last.
+func (t *Tracker) disconnect(k key) {
+	// The request context is done by now.
+	ctx := context.Background()
+	t.mu.Lock()
+	e := t.local[k]
+	e.Connections--
+	e.LastSeen = time.Now().UTC()
+	snapshot := *e
+	last := e.Connections == 0
+	if last {
+		delete(t.local, k)
+		if err := t.Cache.Delete(ctx, entryKey(k)); err != nil {
+			logrus.WithError(err).Warn("presence: removing entry")
+		}
+	} else {
+		t.save(ctx, snapshot, false)
+	}
+	t.mu.Unlock()
+	if last {
+		t.Events.Publish(ctx, events.PresenceOffline, snapshot)
+	}
+}
+
+// save writes e to the cache and, if addToIndex is set, makes sure the
+// tenant index lists the user. The caller holds t.mu.
+func (t *Tracker) save(ctx context.Context, e Entry, addToIndex bool) {
+	k := key{e.Tenant, e.User}
+	if err := t.Cache.Set(ctx, entryKey(k), e, t.TTL); err != nil {
+		logrus.WithError(err).Warn("presence: saving entry")
+		return
+	}
+	if !addToIndex {
+		return
+	}
+	users := t.index(ctx, e.Tenant)
+	for _, u := range users {
+		if u == e.User {
+			return
+		}
+	}
+	users = append(users, e.User)
+	if err := t.Cache.Set(ctx, indexKey(e.Tenant), users, cache.NoExpiration); err != nil {
+		logrus.WithError(err).Warn("presence: saving index")
+	}
+}
+
+// index returns the users ever indexed for tenant; some may have expired.
+func (t *Tracker) index(ctx context.Context, tenant string) []string {
+	v, ok, err := t.Cache.Get(ctx, indexKey(tenant))
+	if err != nil || !ok {
+		return nil
+	}
+	users, _ := v.([]string)
+	return append([]string(nil), users...)
+}
+
+// List returns the users present in tenant, ordered by user, pruning the
+// tenant index of users whose entries have expired.
+func (t *Tracker) List(ctx context.Context, tenant string) ([]Entry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []Entry
+	var live []string
+	users := t.index(ctx, tenant)
+	for _, u := range users {
+		v, ok, err := t.Cache.Get(ctx, entryKey(key{tenant, u}))
+		if err != nil {
+			return nil, err
+		}
+		if e, isEntry := v.(Entry); ok && isEntry {
+			out = append(out, e)
+			live = append(live, u)
+		}
+	}
+	if len(live) != len(users) {
+		if err := t.Cache.Set(ctx, indexKey(tenant), live, cache.NoExpiration); err != nil {
+			logrus.WithError(err).Warn("presence: pruning index")
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].User < out[j].User })
+	return out, nil
+}
+
+// Run refreshes the cache entries of open connections often enough that
+// they don't expire, until ctx is done.
+func (t *Tracker) Run(ctx context.Context) {
+	tick := time.NewTicker(t.TTL / 3)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			t.mu.Lock()
+			for _, e := range t.local {
+				// Re-index too, in case the cache evicted it.
+				t.save(ctx, *e, true)
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Track wraps a streaming handler so its connections count towards the
+// presence of the user named in UserHeader, in the tenant named in
+// analytics.TenantHeader.
+func (t *Tracker) Track(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Header.Get(UserHeader)
+		if user == "" {
+			h(w, r)
+			return
+		}
+		tenant := r.Header.Get(analytics.TenantHeader)
+		if tenant == "" {
+			tenant = analytics.Anonymous
+		}
+		disconnect := t.Connect(r.Context(), tenant, user)
+		defer disconnect()
+		h(w, r)
+	}
+}
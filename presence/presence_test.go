@@ -0,0 +1,55 @@
+package presence
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/cache"
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+)
+
+// TestTracker checks connection counting, listing per tenant, and that
+// only the first and last connection publish events.
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	bus := events.NewBus()
+	var mu sync.Mutex
+	var got []string
+	bus.Subscribe(func(ctx context.Context, e events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, e.Type+" "+e.Data.(Entry).User)
+	})
+	tr := NewTracker(cache.NewMemory(time.Minute, time.Minute), bus, time.Minute)
+
+	first := tr.Connect(ctx, "acme", "ann")
+	second := tr.Connect(ctx, "acme", "ann")
+	bob := tr.Connect(ctx, "acme", "bob")
+	tr.Connect(ctx, "other", "cy")
+
+	list, err := tr.List(ctx, "acme")
+	if err != nil || len(list) != 2 || list[0].User != "ann" || list[0].Connections != 2 {
+		t.Fatalf("List(acme) = %+v, %v, want ann with 2 connections and bob", list, err)
+	}
+
+	first()
+	first()
+	bob()
+	list, _ = tr.List(ctx, "acme")
+	if len(list) != 1 || list[0].Connections != 1 {
+		t.Errorf("List(acme) after disconnects = %+v, want ann with 1 connection", list)
+	}
+	second()
+
+	want := []string{"presence.online ann", "presence.online bob", "presence.online cy", "presence.offline bob", "presence.offline ann"}
+	if len(got) != len(want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package privacy exports and erases the data stored about a user, for
+// access and erasure requests under laws like the GDPR. Each Source says
+// which records in a collection belong to a user and whether erasing
+// deletes them or overwrites the fields that identify the user. Every
+// export and erasure is recorded in the audit trail.
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/pii"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// How a source's records are erased.
+const (
+	Delete    = "delete"
+	Anonymize = "anonymize"
+)
+
+// Audited actions.
+const (
+	ActionExport = "privacy.export"
+	ActionErase  = "privacy.erase"
+)
+
+// Erased replaces the fields anonymized records identified a user by.
+const Erased = "[erased]"
+
+// batchSize is how many records are listed at a time while scanning.
+const batchSize = 500
+
+var erased = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "privacy_erased_records_total",
+	Help: "Records erased for users, by collection and how (delete or anonymize).",
+}, []string{"collection", "how"})
+
+// Source is a collection holding data about users.
+type Source struct {
+	Collection string `mapstructure:"-"`
+	// Field is the top-level JSON field naming the user a record is
+	// about. If it is empty, records are keyed by user.
+	Field string `mapstructure:"field"`
+	// Erase is Delete, the default, or Anonymize.
+	Erase string `mapstructure:"erase"`
+	// Fields are the JSON fields Anonymize overwrites with Erased, besides
+	// Field.
+	Fields []string `mapstructure:"fields"`
+}
+
+// Check reports sources that can't be erased.
+func (src Source) Check() error {
+	switch {
+	case src.Collection == "":
+		return errors.New("privacy: a source has no collection")
+	case src.Erase != "" && src.Erase != Delete && src.Erase != Anonymize:
+		return fmt.Errorf("privacy: %s: erase must be %s or %s, not %q", src.Collection, Delete, Anonymize, src.Erase)
+	case src.Erase == Anonymize && src.Field == "":
+		return fmt.Errorf("privacy: %s: records keyed by user can't be anonymized, only deleted", src.Collection)
+	}
+	return nil
+}
+
+// owns reports whether rec, in src, is about user.
+func (src Source) owns(rec storage.Record, user string) bool {
+	if src.Field == "" {
+		return rec.ID == user
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(rec.Data, &fields) != nil {
+		return false
+	}
+	return fields[src.Field] == user
+}
+
+// Item is an exported record.
+type Item struct {
+	ID        string          `json:"id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Bundle is everything stored about a user, by collection.
+type Bundle struct {
+	User        string            `json:"user"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	Collections map[string][]Item `json:"collections"`
+}
+
+// Report is what an erasure did.
+type Report struct {
+	User string `json:"user"`
+	// Deleted and Anonymized count the records erased, by collection.
+	Deleted    map[string]int `json:"deleted"`
+	Anonymized map[string]int `json:"anonymized"`
+	// Verified is set once a fresh scan finds nothing left about the user.
+	Verified bool `json:"verified"`
+}
+
+// Service exports and erases users' data.
+type Service struct {
+	Store   storage.Store
+	Sources []Source
+	Audit   *audit.Log
+	// PII, if set, redacts the personal fields of exported records unless
+	// the exporting token grants pii.Scope.
+	PII *pii.Redactor
+	now func() time.Time
+}
+
+// NewService returns a service over the sources in store, auditing to
+// log, or an error if a source is invalid.
+func NewService(store storage.Store, log *audit.Log, sources ...Source) (*Service, error) {
+	for _, src := range sources {
+		if err := src.Check(); err != nil {
+			return nil, err
+		}
+	}
+	return &Service{Store: store, Sources: sources, Audit: log, now: time.Now}, nil
+}
+
+// SetClock makes the service date exports by now instead of the wall
+// clock, for tests.
+func (s *Service) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Export returns everything the sources hold about user, on behalf of
+// actor.
+func (s *Service) Export(ctx context.Context, actor, user string) (Bundle, error) {
+	b := Bundle{User: user, ExportedAt: s.now(), Collections: make(map[string][]Item)}
+	total := 0
+	for _, src := range s.Sources {
+		items := []Item{}
+		err := s.scan(ctx, src, user, func(rec storage.Record) error {
+			items = append(items, Item{ID: rec.ID, Data: s.PII.Data(ctx, src.Collection, rec.Data), CreatedAt: rec.CreatedAt, UpdatedAt: rec.UpdatedAt})
+			return nil
+		})
+		if err != nil {
+			return Bundle{}, fmt.Errorf("privacy: exporting %s: %w", src.Collection, err)
+		}
+		b.Collections[src.Collection] = items
+		total += len(items)
+	}
+	_, err := s.Audit.Record(ctx, audit.Entry{Actor: actor, Action: ActionExport, Target: user, Details: map[string]interface{}{
+		"records": total,
+	}})
+	return b, err
+}
+
+// Erase deletes or anonymizes every record the sources hold about user,
+// on behalf of actor, then scans again to verify none are left. The
+// erasure is audited even if it fails partway.
+func (s *Service) Erase(ctx context.Context, actor, user string) (Report, error) {
+	rep := Report{User: user, Deleted: make(map[string]int), Anonymized: make(map[string]int)}
+	err := s.erase(ctx, user, &rep)
+	if err == nil {
+		rep.Verified, err = s.verify(ctx, user)
+	}
+	details := map[string]interface{}{"deleted": rep.Deleted, "anonymized": rep.Anonymized, "verified": rep.Verified}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	_, aerr := s.Audit.Record(ctx, audit.Entry{Actor: actor, Action: ActionErase, Target: user, Details: details})
+	return rep, errors.Join(err, aerr)
+}
+
+func (s *Service) erase(ctx context.Context, user string, rep *Report) error {
+	for _, src := range s.Sources {
+		err := s.scan(ctx, src, user, func(rec storage.Record) error {
+			if src.Erase == Anonymize {
+				data, err := anonymize(rec.Data, append([]string{src.Field}, src.Fields...))
+				if err != nil {
+					return err
+				}
+				if _, err := s.Store.Update(ctx, src.Collection, rec.ID, data, rec.Version); err != nil {
+					return err
+				}
+				rep.Anonymized[src.Collection]++
+			} else {
+				if err := s.Store.Delete(ctx, src.Collection, rec.ID, rec.Version); err != nil && !errors.Is(err, storage.ErrNotFound) {
+					return err
+				}
+				rep.Deleted[src.Collection]++
+			}
+			erased.WithLabelValues(src.Collection, erasure(src)).Inc()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("privacy: erasing %s: %w", src.Collection, err)
+		}
+	}
+	return nil
+}
+
+// verify reports whether the sources hold nothing about user.
+func (s *Service) verify(ctx context.Context, user string) (bool, error) {
+	left := 0
+	for _, src := range s.Sources {
+		if err := s.scan(ctx, src, user, func(storage.Record) error { left++; return nil }); err != nil {
+			return false, fmt.Errorf("privacy: verifying %s: %w", src.Collection, err)
+		}
+	}
+	return left == 0, nil
+}
+
+// scan calls fn with each record of src about user.
+func (s *Service) scan(ctx context.Context, src Source, user string, fn func(storage.Record) error) error {
+	if src.Field == "" {
+		rec, err := s.Store.Get(ctx, src.Collection, user)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(rec)
+	}
+	var after *storage.Key
+	for {
+		recs, err := s.Store.List(ctx, src.Collection, storage.ListOptions{After: after, Limit: batchSize})
+		if err != nil {
+			return err
+		}
+		for _, rec := range recs {
+			if src.owns(rec, user) {
+				if err := fn(rec); err != nil {
+					return err
+				}
+			}
+		}
+		if len(recs) < batchSize {
+			return nil
+		}
+		last := recs[len(recs)-1].Key()
+		after = &last
+	}
+}
+
+// anonymize returns data with fields overwritten by Erased.
+func anonymize(data json.RawMessage, fields []string) (json.RawMessage, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if _, ok := obj[f]; ok {
+			obj[f] = Erased
+		}
+	}
+	return json.Marshal(obj)
+}
+
+func erasure(src Source) string {
+	if src.Erase == Anonymize {
+		return Anonymize
+	}
+	return Delete
+}
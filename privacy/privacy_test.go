@@ -0,0 +1,98 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/audit"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// newService returns a service over greetings, anonymized by name, and
+// preferences, keyed by user, holding data about gladys and derin.
+func newService(t *testing.T) (*Service, *storage.Memory, *audit.Log) {
+	t.Helper()
+	m := storage.NewMemory()
+	ctx := context.Background()
+	m.Create(ctx, "greetings", "a", json.RawMessage(`{"name":"gladys","message":"Hi gladys"}`))
+	m.Create(ctx, "greetings", "b", json.RawMessage(`{"name":"derin","message":"Hi derin"}`))
+	m.Create(ctx, "greetings", "c", json.RawMessage(`{"name":"gladys","message":"Bye gladys"}`))
+	m.Create(ctx, "preferences", "gladys", json.RawMessage(`{"email":true}`))
+	log := audit.NewLog(m)
+	s, err := NewService(m, log,
+		Source{Collection: "greetings", Field: "name", Erase: Anonymize, Fields: []string{"message"}},
+		Source{Collection: "preferences"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, m, log
+}
+
+// TestExport checks that a user's records are exported from every source,
+// and no one else's, and that the export is audited.
+func TestExport(t *testing.T) {
+	s, _, log := newService(t)
+	ctx := context.Background()
+	b, err := s.Export(ctx, "admin", "gladys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Collections["greetings"]) != 2 || len(b.Collections["preferences"]) != 1 {
+		t.Errorf("Export(gladys) = %+v, want 2 greetings and her preferences", b.Collections)
+	}
+	if b, _ := s.Export(ctx, "admin", "nobody"); len(b.Collections["greetings"]) != 0 || b.Collections["greetings"] == nil {
+		t.Errorf("Export(nobody) = %+v, want empty collections", b.Collections)
+	}
+	entries, _ := log.List(ctx, storage.ListOptions{})
+	if len(entries) != 2 || entries[0].Action != ActionExport || entries[0].Actor != "admin" || entries[0].Target != "gladys" {
+		t.Errorf("audit trail = %+v, want both exports", entries)
+	}
+}
+
+// TestErase checks that a user's records are anonymized or deleted per
+// source, that others' are left, and that the erasure is verified and
+// audited.
+func TestErase(t *testing.T) {
+	s, m, log := newService(t)
+	ctx := context.Background()
+	rep, err := s.Erase(ctx, "gladys", "gladys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Anonymized["greetings"] != 2 || rep.Deleted["preferences"] != 1 || !rep.Verified {
+		t.Errorf("Erase(gladys) = %+v, want 2 greetings anonymized, preferences deleted, verified", rep)
+	}
+	rec, _ := m.Get(ctx, "greetings", "a")
+	if string(rec.Data) != `{"message":"[erased]","name":"[erased]"}` {
+		t.Errorf("erased greeting = %s, want its name and message erased", rec.Data)
+	}
+	if rec, _ := m.Get(ctx, "greetings", "b"); string(rec.Data) != `{"name":"derin","message":"Hi derin"}` {
+		t.Errorf("derin's greeting = %s, want it untouched", rec.Data)
+	}
+	if _, err := m.Get(ctx, "preferences", "gladys"); err != storage.ErrNotFound {
+		t.Errorf("Get(preferences/gladys) = %v, want ErrNotFound", err)
+	}
+	entries, _ := log.List(ctx, storage.ListOptions{})
+	if len(entries) != 1 || entries[0].Action != ActionErase || entries[0].Details["verified"] != true {
+		t.Errorf("audit trail = %+v, want a verified erasure", entries)
+	}
+}
+
+// TestNewService checks that invalid sources are refused.
+func TestNewService(t *testing.T) {
+	tests := []struct {
+		name string
+		src  Source
+	}{
+		{"no collection", Source{}},
+		{"unknown erasure", Source{Collection: "greetings", Field: "name", Erase: "shred"}},
+		{"anonymize by key", Source{Collection: "preferences", Erase: Anonymize}},
+	}
+	for _, tt := range tests {
+		if _, err := NewService(storage.NewMemory(), nil, tt.src); err == nil {
+			t.Errorf("%s: NewService() succeeded, want an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// DebugPath is where Debug serves the net/http/pprof endpoints.
+const DebugPath = "/debug/pprof/"
+
+// Debug serves the standard net/http/pprof endpoints under DebugPath, for
+// go tool pprof to read straight from a running instance: the index, the
+// cmdline, CPU profile, symbol and trace endpoints, and every named
+// profile such as /debug/pprof/heap and /debug/pprof/goroutine. It has no
+// authentication of its own, so serve it on a separate listener bound to
+// an address only operators can reach.
+func Debug() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(DebugPath, pprof.Index)
+	mux.HandleFunc(DebugPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(DebugPath+"profile", pprof.Profile)
+	mux.HandleFunc(DebugPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(DebugPath+"trace", pprof.Trace)
+	return mux
+}
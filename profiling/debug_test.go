@@ -0,0 +1,34 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDebug checks that Debug serves the pprof index and named profiles,
+// and nothing outside DebugPath.
+func TestDebug(t *testing.T) {
+	h := Debug()
+	for target, want := range map[string]int{
+		"/debug/pprof/":                  http.StatusOK,
+		"/debug/pprof/goroutine?debug=1": http.StatusOK,
+		"/debug/pprof/heap":              http.StatusOK,
+		"/debug/pprof/cmdline":           http.StatusOK,
+		"/debug/pprof/no-such-profile":   http.StatusNotFound,
+		"/hello":                         http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", target, rec.Code, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DebugPath, nil))
+	if body := rec.Body.String(); !strings.Contains(body, "goroutine") {
+		t.Errorf("GET %s lists no goroutine profile: %s", DebugPath, body)
+	}
+}
@@ -0,0 +1,112 @@
+// Package profiling captures pprof profiles from a running server. A CPU
+// profile captured from production can be checked in as default.pgo to
+// drive profile-guided optimization of the next build.
+package profiling
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Paths the handlers are mounted at.
+const (
+	CPUPath  = "/admin/profile/cpu"
+	HeapPath = "/admin/profile/heap"
+)
+
+// DefaultDuration is how long a CPU profile runs when the request doesn't
+// say.
+const DefaultDuration = 30 * time.Second
+
+// Handler serves CPU and heap profiles.
+type Handler struct {
+	// MaxDuration caps the ?seconds= parameter of CPU captures.
+	MaxDuration time.Duration
+}
+
+// CPU records a CPU profile for ?seconds= (default 30) and writes it as the
+// response body. Only one CPU profile can run at a time; a concurrent
+// request gets 409.
+func (h *Handler) CPU(w http.ResponseWriter, r *http.Request) {
+	d := DefaultDuration
+	if s := r.URL.Query().Get("seconds"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			respond.Error(w, http.StatusBadRequest, "seconds must be a positive integer")
+			return
+		}
+		d = time.Duration(n) * time.Second
+	}
+	if h.MaxDuration > 0 && d > h.MaxDuration {
+		d = h.MaxDuration
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="default.pgo"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		respond.Error(w, http.StatusConflict, "a CPU profile is already being captured")
+		return
+	}
+
+	timer := time.NewTimer(d)
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+		timer.Stop()
+	}
+	pprof.StopCPUProfile()
+}
+
+// Heap writes a heap profile. With ?gc=1 a garbage collection runs first so
+// the profile reflects live objects only.
+func (h *Handler) Heap(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("gc") == "1" {
+		runtime.GC()
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="heap.pprof"`)
+	if err := pprof.Lookup("heap").WriteTo(w, 0); err != nil {
+		respond.Error(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// Capture requests a CPU profile of duration d from the server at baseURL
+// and copies it to out. token, if set, is sent as the bearer token the
+// admin-only route needs when the server authorizes requests.
+func Capture(ctx context.Context, baseURL, token string, d time.Duration, out io.Writer) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	u.Path = CPUPath
+	u.RawQuery = url.Values{"seconds": {strconv.Itoa(int(d / time.Second))}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("%s: %s: %s", u, resp.Status, body)
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
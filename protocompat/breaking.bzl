@@ -0,0 +1,30 @@
+"""Fails the build's tests on breaking changes to a protobuf API."""
+
+def proto_breaking_test(name, protos, against, **kwargs):
+    """Checks protos against the descriptor set of the last release.
+
+    Runs "bazel-demo-app proto breaking", so the rules are protocompat's.
+    After a release, replace the against file with the released
+    descriptor set:
+
+        bazel build //api:api_proto && cp bazel-bin/api/api_proto-descriptor-set.proto.bin api/released.binpb
+
+    Args:
+      name: name of the test.
+      protos: proto_library targets making up the current API.
+      against: the released descriptor set, usually a checked-in file.
+      **kwargs: passed to the sh_test.
+    """
+    native.sh_test(
+        name = name,
+        srcs = ["//protocompat:breaking_test.sh"],
+        args = [
+            "$(rootpath //cmd)",
+            "proto",
+            "breaking",
+            "--against",
+            "$(rootpath %s)" % against,
+        ] + ["$(rootpaths %s)" % p for p in protos],
+        data = ["//cmd", against] + protos,
+        **kwargs
+    )
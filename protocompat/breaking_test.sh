@@ -0,0 +1,3 @@
+#!/bin/sh
+# Runs the command proto_breaking_test passes, from the runfiles root.
+exec "$@"
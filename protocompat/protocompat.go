@@ -0,0 +1,280 @@
+// Package protocompat finds breaking changes between two versions of a
+// protobuf API, given as descriptor sets: what Bazel's proto_library
+// produces, or protoc --descriptor_set_out. The rules follow buf's
+// package-level checks, named the same way, so a type may move between
+// files of a package without it counting as a break.
+package protocompat
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Rules reported by Check.
+const (
+	MessageNoDelete        = "MESSAGE_NO_DELETE"
+	FieldNoDelete          = "FIELD_NO_DELETE_UNLESS_NUMBER_RESERVED"
+	FieldSameName          = "FIELD_SAME_NAME"
+	FieldSameType          = "FIELD_SAME_TYPE"
+	FieldSameLabel         = "FIELD_SAME_LABEL"
+	FieldSameOneof         = "FIELD_SAME_ONEOF"
+	EnumNoDelete           = "ENUM_NO_DELETE"
+	EnumValueNoDelete      = "ENUM_VALUE_NO_DELETE_UNLESS_NUMBER_RESERVED"
+	EnumValueSameName      = "ENUM_VALUE_SAME_NAME"
+	ServiceNoDelete        = "SERVICE_NO_DELETE"
+	RPCNoDelete            = "RPC_NO_DELETE"
+	RPCSameRequestType     = "RPC_SAME_REQUEST_TYPE"
+	RPCSameResponseType    = "RPC_SAME_RESPONSE_TYPE"
+	RPCSameClientStreaming = "RPC_SAME_CLIENT_STREAMING"
+	RPCSameServerStreaming = "RPC_SAME_SERVER_STREAMING"
+)
+
+// Change is one breaking change.
+type Change struct {
+	Rule string
+	// File is the file the element is in, in the current version if it
+	// still exists there and otherwise in the previous one.
+	File    string
+	Message string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s (%s)", c.File, c.Message, c.Rule)
+}
+
+// ReadSet reads a binary FileDescriptorSet from path.
+func ReadSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("%s: not a FileDescriptorSet: %w", path, err)
+	}
+	return set, nil
+}
+
+// Merge returns one set holding the files of sets, for a current version
+// spread over several proto_library targets. Files in more than one set
+// are kept once.
+func Merge(sets ...*descriptorpb.FileDescriptorSet) *descriptorpb.FileDescriptorSet {
+	out := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, s := range sets {
+		for _, f := range s.GetFile() {
+			if !seen[f.GetName()] {
+				seen[f.GetName()] = true
+				out.File = append(out.File, f)
+			}
+		}
+	}
+	return out
+}
+
+// index holds the elements of a descriptor set by fully qualified name.
+type index struct {
+	messages map[string]located[*descriptorpb.DescriptorProto]
+	enums    map[string]located[*descriptorpb.EnumDescriptorProto]
+	services map[string]located[*descriptorpb.ServiceDescriptorProto]
+}
+
+type located[T any] struct {
+	file string
+	desc T
+}
+
+func newIndex(set *descriptorpb.FileDescriptorSet) *index {
+	idx := &index{
+		messages: make(map[string]located[*descriptorpb.DescriptorProto]),
+		enums:    make(map[string]located[*descriptorpb.EnumDescriptorProto]),
+		services: make(map[string]located[*descriptorpb.ServiceDescriptorProto]),
+	}
+	for _, f := range set.GetFile() {
+		prefix := ""
+		if f.GetPackage() != "" {
+			prefix = f.GetPackage() + "."
+		}
+		idx.addMessages(f.GetName(), prefix, f.GetMessageType())
+		idx.addEnums(f.GetName(), prefix, f.GetEnumType())
+		for _, s := range f.GetService() {
+			idx.services[prefix+s.GetName()] = located[*descriptorpb.ServiceDescriptorProto]{f.GetName(), s}
+		}
+	}
+	return idx
+}
+
+func (idx *index) addMessages(file, prefix string, msgs []*descriptorpb.DescriptorProto) {
+	for _, m := range msgs {
+		name := prefix + m.GetName()
+		idx.messages[name] = located[*descriptorpb.DescriptorProto]{file, m}
+		idx.addMessages(file, name+".", m.GetNestedType())
+		idx.addEnums(file, name+".", m.GetEnumType())
+	}
+}
+
+func (idx *index) addEnums(file, prefix string, enums []*descriptorpb.EnumDescriptorProto) {
+	for _, e := range enums {
+		idx.enums[prefix+e.GetName()] = located[*descriptorpb.EnumDescriptorProto]{file, e}
+	}
+}
+
+// Check returns the changes from previous to current that break clients
+// built against previous, on the wire, in generated code, or in the JSON
+// mapping, sorted by file and then message.
+func Check(previous, current *descriptorpb.FileDescriptorSet) []Change {
+	prev, cur := newIndex(previous), newIndex(current)
+	var changes []Change
+	add := func(rule, file, format string, args ...any) {
+		changes = append(changes, Change{Rule: rule, File: file, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for name, p := range prev.messages {
+		c, ok := cur.messages[name]
+		if !ok {
+			add(MessageNoDelete, p.file, "message %q was deleted", name)
+			continue
+		}
+		fields := make(map[int32]*descriptorpb.FieldDescriptorProto)
+		for _, f := range c.desc.GetField() {
+			fields[f.GetNumber()] = f
+		}
+		for _, pf := range p.desc.GetField() {
+			cf, ok := fields[pf.GetNumber()]
+			if !ok {
+				if !reservedField(c.desc, pf.GetNumber()) {
+					add(FieldNoDelete, c.file, "field %d %q of %q was deleted without reserving its number", pf.GetNumber(), pf.GetName(), name)
+				}
+				continue
+			}
+			if pf.GetName() != cf.GetName() {
+				add(FieldSameName, c.file, "field %d of %q was renamed from %q to %q", pf.GetNumber(), name, pf.GetName(), cf.GetName())
+			}
+			if pt, ct := fieldType(pf), fieldType(cf); pt != ct {
+				add(FieldSameType, c.file, "field %d %q of %q changed type from %s to %s", pf.GetNumber(), cf.GetName(), name, pt, ct)
+			}
+			if pf.GetLabel() != cf.GetLabel() {
+				add(FieldSameLabel, c.file, "field %d %q of %q changed label from %s to %s", pf.GetNumber(), cf.GetName(), name, label(pf), label(cf))
+			}
+			if po, co := oneof(p.desc, pf), oneof(c.desc, cf); po != co {
+				add(FieldSameOneof, c.file, "field %d %q of %q moved from oneof %q to %q", pf.GetNumber(), cf.GetName(), name, po, co)
+			}
+		}
+	}
+
+	for name, p := range prev.enums {
+		c, ok := cur.enums[name]
+		if !ok {
+			add(EnumNoDelete, p.file, "enum %q was deleted", name)
+			continue
+		}
+		values := make(map[int32]string)
+		for _, v := range c.desc.GetValue() {
+			values[v.GetNumber()] = v.GetName()
+		}
+		for _, pv := range p.desc.GetValue() {
+			cv, ok := values[pv.GetNumber()]
+			switch {
+			case !ok && !reservedValue(c.desc, pv.GetNumber()):
+				add(EnumValueNoDelete, c.file, "value %d %q of enum %q was deleted without reserving its number", pv.GetNumber(), pv.GetName(), name)
+			case ok && cv != pv.GetName():
+				add(EnumValueSameName, c.file, "value %d of enum %q was renamed from %q to %q", pv.GetNumber(), name, pv.GetName(), cv)
+			}
+		}
+	}
+
+	for name, p := range prev.services {
+		c, ok := cur.services[name]
+		if !ok {
+			add(ServiceNoDelete, p.file, "service %q was deleted", name)
+			continue
+		}
+		methods := make(map[string]*descriptorpb.MethodDescriptorProto)
+		for _, m := range c.desc.GetMethod() {
+			methods[m.GetName()] = m
+		}
+		for _, pm := range p.desc.GetMethod() {
+			cm, ok := methods[pm.GetName()]
+			rpc := name + "." + pm.GetName()
+			if !ok {
+				add(RPCNoDelete, c.file, "RPC %q was deleted", rpc)
+				continue
+			}
+			if pm.GetInputType() != cm.GetInputType() {
+				add(RPCSameRequestType, c.file, "RPC %q changed request type from %q to %q", rpc, pm.GetInputType(), cm.GetInputType())
+			}
+			if pm.GetOutputType() != cm.GetOutputType() {
+				add(RPCSameResponseType, c.file, "RPC %q changed response type from %q to %q", rpc, pm.GetOutputType(), cm.GetOutputType())
+			}
+			if pm.GetClientStreaming() != cm.GetClientStreaming() {
+				add(RPCSameClientStreaming, c.file, "RPC %q changed client streaming from %t to %t", rpc, pm.GetClientStreaming(), cm.GetClientStreaming())
+			}
+			if pm.GetServerStreaming() != cm.GetServerStreaming() {
+				add(RPCSameServerStreaming, c.file, "RPC %q changed server streaming from %t to %t", rpc, pm.GetServerStreaming(), cm.GetServerStreaming())
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].File != changes[j].File {
+			return changes[i].File < changes[j].File
+		}
+		return changes[i].Message < changes[j].Message
+	})
+	return changes
+}
+
+// fieldType describes the type of f, naming message and enum types.
+func fieldType(f *descriptorpb.FieldDescriptorProto) string {
+	if f.GetTypeName() != "" {
+		return f.GetTypeName()
+	}
+	return strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+}
+
+// label returns f's label in lower case, as written in a .proto file.
+func label(f *descriptorpb.FieldDescriptorProto) string {
+	switch f.GetLabel() {
+	case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+		return "repeated"
+	case descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+		return "required"
+	}
+	return "optional"
+}
+
+// oneof returns the name of the real oneof f is in, or "" if none.
+// Synthetic oneofs of proto3 optional fields don't count.
+func oneof(m *descriptorpb.DescriptorProto, f *descriptorpb.FieldDescriptorProto) string {
+	if f.OneofIndex == nil || f.GetProto3Optional() {
+		return ""
+	}
+	return m.GetOneofDecl()[f.GetOneofIndex()].GetName()
+}
+
+// reservedField reports whether number is reserved in m.
+func reservedField(m *descriptorpb.DescriptorProto, number int32) bool {
+	for _, r := range m.GetReservedRange() {
+		// Message reserved ranges are end-exclusive.
+		if number >= r.GetStart() && number < r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+// reservedValue reports whether number is reserved in e.
+func reservedValue(e *descriptorpb.EnumDescriptorProto, number int32) bool {
+	for _, r := range e.GetReservedRange() {
+		// Enum reserved ranges are end-inclusive.
+		if number >= r.GetStart() && number <= r.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
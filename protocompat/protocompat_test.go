@@ -0,0 +1,161 @@
+package protocompat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// released is the previous version of a small API:
+//
+//	package greet.v1;
+//	message Greeting { string name = 1; repeated string tags = 2; oneof when { int64 at = 3; } }
+//	enum Tone { TONE_UNSPECIFIED = 0; TONE_WARM = 1; }
+//	service Greeter { rpc Greet(Greeting) returns (Greeting); }
+func released() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("greet/v1/greet.proto"),
+		Package: proto.String("greet.v1"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Greeting"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL),
+				field("tags", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_REPEATED),
+				{
+					Name:       proto.String("at"),
+					Number:     proto.Int32(3),
+					Type:       descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+					Label:      descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					OneofIndex: proto.Int32(0),
+				},
+			},
+			OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("when")}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Tone"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("TONE_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("TONE_WARM"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Greet"),
+				InputType:  proto.String(".greet.v1.Greeting"),
+				OutputType: proto.String(".greet.v1.Greeting"),
+			}},
+		}},
+	}}}
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+}
+
+// TestCheck applies one change at a time to the released API and checks
+// which rules, if any, it breaks.
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(f *descriptorpb.FileDescriptorProto)
+		want   []string
+	}{
+		{"unchanged", func(f *descriptorpb.FileDescriptorProto) {}, nil},
+		{"add field", func(f *descriptorpb.FileDescriptorProto) {
+			m := f.MessageType[0]
+			m.Field = append(m.Field, field("note", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL))
+		}, nil},
+		{"move to another file", func(f *descriptorpb.FileDescriptorProto) {
+			f.Name = proto.String("greet/v1/greeting.proto")
+		}, nil},
+		{"delete reserved field", func(f *descriptorpb.FileDescriptorProto) {
+			m := f.MessageType[0]
+			m.Field = []*descriptorpb.FieldDescriptorProto{m.Field[0], m.Field[2]}
+			m.ReservedRange = []*descriptorpb.DescriptorProto_ReservedRange{{Start: proto.Int32(2), End: proto.Int32(3)}}
+		}, nil},
+		{"delete field", func(f *descriptorpb.FileDescriptorProto) {
+			f.MessageType[0].Field = f.MessageType[0].Field[1:]
+		}, []string{FieldNoDelete}},
+		{"rename field", func(f *descriptorpb.FileDescriptorProto) {
+			f.MessageType[0].Field[0].Name = proto.String("full_name")
+		}, []string{FieldSameName}},
+		{"change field type", func(f *descriptorpb.FileDescriptorProto) {
+			f.MessageType[0].Field[0].Type = descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum()
+		}, []string{FieldSameType}},
+		{"make field repeated", func(f *descriptorpb.FileDescriptorProto) {
+			f.MessageType[0].Field[0].Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}, []string{FieldSameLabel}},
+		{"leave oneof", func(f *descriptorpb.FileDescriptorProto) {
+			f.MessageType[0].Field[2].OneofIndex = nil
+		}, []string{FieldSameOneof}},
+		{"delete message", func(f *descriptorpb.FileDescriptorProto) {
+			f.MessageType = nil
+		}, []string{MessageNoDelete}},
+		{"delete enum value", func(f *descriptorpb.FileDescriptorProto) {
+			f.EnumType[0].Value = f.EnumType[0].Value[:1]
+		}, []string{EnumValueNoDelete}},
+		{"delete reserved enum value", func(f *descriptorpb.FileDescriptorProto) {
+			e := f.EnumType[0]
+			e.Value = e.Value[:1]
+			e.ReservedRange = []*descriptorpb.EnumDescriptorProto_EnumReservedRange{{Start: proto.Int32(1), End: proto.Int32(1)}}
+		}, nil},
+		{"rename enum value", func(f *descriptorpb.FileDescriptorProto) {
+			f.EnumType[0].Value[1].Name = proto.String("TONE_FRIENDLY")
+		}, []string{EnumValueSameName}},
+		{"delete enum", func(f *descriptorpb.FileDescriptorProto) {
+			f.EnumType = nil
+		}, []string{EnumNoDelete}},
+		{"change RPC", func(f *descriptorpb.FileDescriptorProto) {
+			m := f.Service[0].Method[0]
+			m.InputType = proto.String(".greet.v1.Tone")
+			m.ServerStreaming = proto.Bool(true)
+		}, []string{RPCSameRequestType, RPCSameServerStreaming}},
+		{"delete RPC", func(f *descriptorpb.FileDescriptorProto) {
+			f.Service[0].Method = nil
+		}, []string{RPCNoDelete}},
+		{"delete service", func(f *descriptorpb.FileDescriptorProto) {
+			f.Service = nil
+		}, []string{ServiceNoDelete}},
+	}
+	for _, tt := range tests {
+		current := released()
+		tt.change(current.File[0])
+		var got []string
+		for _, c := range Check(released(), current) {
+			got = append(got, c.Rule)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: Check() rules = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestReadSet checks that a serialized set reads back, and that other
+// files are reported as not being descriptor sets.
+func TestReadSet(t *testing.T) {
+	dir := t.TempDir()
+	data, err := proto.Marshal(released())
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := filepath.Join(dir, "released.binpb")
+	bad := filepath.Join(dir, "released.txt")
+	os.WriteFile(good, data, 0o644)
+	os.WriteFile(bad, []byte("not a descriptor set"), 0o644)
+
+	set, err := ReadSet(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Check(released(), set); len(changes) != 0 {
+		t.Errorf("Check(released, ReadSet(released)) = %v, want none", changes)
+	}
+	if _, err := ReadSet(bad); err == nil {
+		t.Errorf("ReadSet(%s) succeeded, want an error", bad)
+	}
+}
@@ -0,0 +1,135 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// TestEncode checks a code module by module against one made by another
+// encoder.
+func TestEncode(t *testing.T) {
+	want := []string{
+		"#######...#.#.#.#.###.#######",
+		"#.....#...#.##.##.....#.....#",
+		"#.###.#.#.#...##...#..#.###.#",
+		"#.###.#.##.#....##..#.#.###.#",
+		"#.###.#.##.#.#..#.###.#.###.#",
+		"#.....#.#.##.###....#.#.....#",
+		"#######.#.#.#.#.#.#.#.#######",
+		"........#.####.##..##........",
+		"#.#####....##.##.#....#####..",
+		"..#.##...###....#..##.###...#",
+		".#.#.##.##..#..##...##.##....",
+		"##.##...#.....##..####.#.#.#.",
+		"...##.######...#.###.....##..",
+		"##.###.##.#####.##.#.####...#",
+		"#.########.#.###.#..#.#####..",
+		"#.#.#..##.#..#.##...##..#..#.",
+		"...#.##.#..##.#..#.#.....##..",
+		"######..#.#.#...#########.#.#",
+		"#.#.#.#.#......###..#...#.#..",
+		"#.####..###.#.#.#.###......#.",
+		"#.#...##.#.#...#.#.######.###",
+		"........##.######.#.#...#####",
+		"#######....#.####.###.#.###..",
+		"#.....#.##.###.##..##...#....",
+		"#.###.#.#####.#.##..#####.#..",
+		"#.###.#.#.##.#...#####.#.####",
+		"#.###.#.#####..##....#######.",
+		"#.....#...###.###...#.####.#.",
+		"#######.##.....#.#.#.####.#..",
+	}
+	c, err := Encode([]byte("https://example.com/greet?name=Gladys"), M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != 3 || c.Size != 29 || c.Mask != 2 {
+		t.Fatalf("Encode() = version %d, size %d, mask %d, want 3, 29, 2", c.Version, c.Size, c.Mask)
+	}
+	for y, row := range want {
+		var got strings.Builder
+		for x := 0; x < c.Size; x++ {
+			if c.Dark(x, y) {
+				got.WriteByte('#')
+			} else {
+				got.WriteByte('.')
+			}
+		}
+		if got.String() != row {
+			t.Errorf("row %d = %s, want %s", y, got.String(), row)
+		}
+	}
+}
+
+// TestEncodeVersions checks that data gets the smallest version holding
+// it, and that data too long for version 40 is refused.
+func TestEncodeVersions(t *testing.T) {
+	for _, tt := range []struct {
+		n       int
+		level   Level
+		version int
+	}{
+		{0, H, 1},
+		{17, L, 1},
+		{18, L, 2},
+		{7, H, 1},
+		{8, H, 2},
+		{2953, L, 40},
+		{1273, H, 40},
+	} {
+		c, err := Encode(bytes.Repeat([]byte("a"), tt.n), tt.level)
+		if err != nil || c.Version != tt.version || c.Size != tt.version*4+17 {
+			t.Errorf("Encode(%d bytes, %s) = %+v, %v, want version %d", tt.n, tt.level, c, err, tt.version)
+		}
+	}
+	if _, err := Encode(bytes.Repeat([]byte("a"), 2954), L); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode(2954 bytes, L) = %v, want ErrTooLong", err)
+	}
+}
+
+// TestParseLevel checks that levels parse in either case.
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"l": L, "M": M, "q": Q, "H": H} {
+		if got, err := ParseLevel(s); got != want || err != nil {
+			t.Errorf("ParseLevel(%q) = %s, %v, want %s", s, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("X"); err == nil {
+		t.Error(`ParseLevel("X") = nil error, want one`)
+	}
+}
+
+// TestRender checks the PNG's size and quiet zone, and that the SVG
+// scales the code to the requested size.
+func TestRender(t *testing.T) {
+	c, _ := Encode([]byte("Gladys"), M)
+	var buf bytes.Buffer
+	if err := c.PNG(&buf, 100); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 21 modules and the quiet zone are 29, at 3 pixels each.
+	scale := 3
+	if b := img.Bounds(); b.Dx() != 29*scale || b.Dy() != 29*scale {
+		t.Errorf("PNG(100) is %v, want %d pixels square", b, 29*scale)
+	}
+	if r, _, _, _ := img.At(QuietZone*scale-1, QuietZone*scale-1).RGBA(); r == 0 {
+		t.Error("PNG(100) quiet zone is dark, want light")
+	}
+	if r, _, _, _ := img.At(QuietZone*scale, QuietZone*scale).RGBA(); r != 0 {
+		t.Error("PNG(100) finder corner is light, want dark")
+	}
+
+	buf.Reset()
+	c.SVG(&buf, 300)
+	svg := buf.String()
+	if !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300" viewBox="0 0 29 29"`) || !strings.Contains(svg, "M4 4h7v1h-7z") {
+		t.Errorf("SVG(300) = %s, want a 300px view of 29 modules starting with a finder", svg)
+	}
+}
@@ -0,0 +1,61 @@
+package qr
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// QuietZone is the light border, in modules, renderings put around a code
+// so scanners can find it.
+const QuietZone = 4
+
+// Scale returns the whole pixels per module that fit c and its quiet zone
+// in size pixels, at least 1.
+func (c *Code) Scale(size int) int {
+	return max(1, size/(c.Size+2*QuietZone))
+}
+
+// PNG writes c as a PNG of Scale(size) pixels per module, at most size
+// pixels wide unless even one pixel per module is wider.
+func (c *Code) PNG(w io.Writer, size int) error {
+	scale := c.Scale(size)
+	width := (c.Size + 2*QuietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for py := 0; py < width; py++ {
+		for px := 0; px < width; px++ {
+			if c.Dark(px/scale-QuietZone, py/scale-QuietZone) {
+				img.Pix[py*img.Stride+px] = 1
+			}
+		}
+	}
+	return (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(w, img)
+}
+
+// SVG writes c as an SVG size pixels wide. Its path draws each run of
+// dark modules in a row as one rectangle.
+func (c *Code) SVG(w io.Writer, size int) error {
+	bw := bufio.NewWriter(w)
+	n := c.Size + 2*QuietZone
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	bw.WriteString(`<rect width="100%" height="100%" fill="#fff"/><path fill="#000" d="`)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; {
+			if !c.Dark(x, y) {
+				x++
+				continue
+			}
+			run := 1
+			for c.Dark(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(bw, "M%d %dh%dv1h-%dz", x+QuietZone, y+QuietZone, run, run)
+			x += run
+		}
+	}
+	bw.WriteString(`"/></svg>`)
+	return bw.Flush()
+}
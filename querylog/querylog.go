@@ -0,0 +1,225 @@
+// Package querylog times the queries made to a storage backend. Every
+// query is observed in a duration histogram, queries slower than a
+// threshold are logged, and the most recent queries are kept so the
+// slowest of them can be listed. Record IDs and data are redacted from
+// logs and listings, as they can hold personal information; only their
+// presence and size show.
+package querylog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Defaults for Config fields left zero.
+const (
+	DefaultSlowThreshold = 100 * time.Millisecond
+	DefaultRecent        = 1000
+)
+
+// Redacted stands in for parameter values kept out of logs.
+const Redacted = "[redacted]"
+
+var (
+	durations = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "storage_query_duration_seconds",
+		Help:    "Storage query latency by method and collection.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method", "collection"})
+	slowQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "storage_slow_queries_total",
+		Help: "Storage queries slower than the slow-query threshold, by method and collection.",
+	}, []string{"method", "collection"})
+)
+
+// Config configures a Store.
+type Config struct {
+	// SlowThreshold is the duration from which queries are logged as
+	// slow.
+	SlowThreshold time.Duration
+	// Recent is how many of the latest queries are kept for Slowest.
+	Recent int
+}
+
+// Query is one timed query.
+type Query struct {
+	Method     string `json:"method"`
+	Collection string `json:"collection"`
+	// Params holds the query's arguments, with IDs and data redacted.
+	Params    map[string]string `json:"params,omitempty"`
+	StartedAt time.Time         `json:"started_at"`
+	Duration  time.Duration     `json:"-"`
+	// Error is the query's error, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// MarshalJSON adds the duration in milliseconds.
+func (q Query) MarshalJSON() ([]byte, error) {
+	type plain Query
+	return json.Marshal(struct {
+		plain
+		DurationMS float64 `json:"duration_ms"`
+	}{plain(q), float64(q.Duration) / float64(time.Millisecond)})
+}
+
+// Store is a storage.Store that times the queries made to another. It is
+// safe for concurrent use.
+type Store struct {
+	store     storage.Store
+	threshold time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	recent []Query
+	next   int
+}
+
+// New returns a store timing the queries made to store.
+func New(store storage.Store, c Config) *Store {
+	if c.SlowThreshold <= 0 {
+		c.SlowThreshold = DefaultSlowThreshold
+	}
+	if c.Recent <= 0 {
+		c.Recent = DefaultRecent
+	}
+	return &Store{
+		store:     store,
+		threshold: c.SlowThreshold,
+		now:       time.Now,
+		recent:    make([]Query, 0, c.Recent),
+	}
+}
+
+// SetClock makes the store time queries by now instead of the wall clock,
+// for tests. Call it before the store is used.
+func (s *Store) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Slowest returns up to n of the recent queries, slowest first.
+func (s *Store) Slowest(n int) []Query {
+	s.mu.Lock()
+	out := append([]Query(nil), s.recent...)
+	s.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Duration > out[j].Duration })
+	if n >= 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// observe runs f as q, recording how long it took.
+func (s *Store) observe(q Query, f func() error) error {
+	q.StartedAt = s.now()
+	err := f()
+	q.Duration = s.now().Sub(q.StartedAt)
+	// Missing records and lost races are answers, not failures.
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrExists) && !errors.Is(err, storage.ErrVersionMismatch) {
+		q.Error = err.Error()
+	}
+	durations.WithLabelValues(q.Method, q.Collection).Observe(q.Duration.Seconds())
+	if q.Duration >= s.threshold {
+		slowQueries.WithLabelValues(q.Method, q.Collection).Inc()
+		fields := logrus.Fields{"method": q.Method, "collection": q.Collection, "duration": q.Duration}
+		for k, v := range q.Params {
+			fields["param."+k] = v
+		}
+		if q.Error != "" {
+			fields["error"] = q.Error
+		}
+		logrus.WithFields(fields).Warn("querylog: slow storage query")
+	}
+
+	s.mu.Lock()
+	if len(s.recent) < cap(s.recent) {
+		s.recent = append(s.recent, q)
+	} else {
+		s.recent[s.next] = q
+		s.next = (s.next + 1) % len(s.recent)
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// dataParam describes data without its content.
+func dataParam(data json.RawMessage) string {
+	return strconv.Itoa(len(data)) + " bytes"
+}
+
+func (s *Store) Get(ctx context.Context, collection, id string) (rec storage.Record, err error) {
+	q := Query{Method: "Get", Collection: collection, Params: map[string]string{"id": Redacted}}
+	err = s.observe(q, func() error { rec, err = s.store.Get(ctx, collection, id); return err })
+	return rec, err
+}
+
+func (s *Store) List(ctx context.Context, collection string, opts storage.ListOptions) (recs []storage.Record, err error) {
+	params := map[string]string{}
+	if opts.After != nil {
+		params["after"] = Redacted
+	}
+	if opts.Offset > 0 {
+		params["offset"] = strconv.Itoa(opts.Offset)
+	}
+	if opts.Limit > 0 {
+		params["limit"] = strconv.Itoa(opts.Limit)
+	}
+	if !opts.UpdatedSince.IsZero() {
+		params["updated_since"] = opts.UpdatedSince.UTC().Format(time.RFC3339)
+	}
+	q := Query{Method: "List", Collection: collection, Params: params}
+	err = s.observe(q, func() error { recs, err = s.store.List(ctx, collection, opts); return err })
+	return recs, err
+}
+
+func (s *Store) Create(ctx context.Context, collection, id string, data json.RawMessage) (rec storage.Record, err error) {
+	q := Query{Method: "Create", Collection: collection, Params: map[string]string{"id": Redacted, "data": dataParam(data)}}
+	err = s.observe(q, func() error { rec, err = s.store.Create(ctx, collection, id, data); return err })
+	return rec, err
+}
+
+func (s *Store) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (rec storage.Record, err error) {
+	params := map[string]string{"id": Redacted, "data": dataParam(data)}
+	if ifVersion != 0 {
+		params["if_version"] = strconv.FormatInt(ifVersion, 10)
+	}
+	q := Query{Method: "Update", Collection: collection, Params: params}
+	err = s.observe(q, func() error { rec, err = s.store.Update(ctx, collection, id, data, ifVersion); return err })
+	return rec, err
+}
+
+func (s *Store) Delete(ctx context.Context, collection, id string, ifVersion int64) error {
+	params := map[string]string{"id": Redacted}
+	if ifVersion != 0 {
+		params["if_version"] = strconv.FormatInt(ifVersion, 10)
+	}
+	q := Query{Method: "Delete", Collection: collection, Params: params}
+	return s.observe(q, func() error { return s.store.Delete(ctx, collection, id, ifVersion) })
+}
+
+func (s *Store) Deleted(ctx context.Context, collection string, since time.Time) (ts []storage.Tombstone, err error) {
+	q := Query{Method: "Deleted", Collection: collection, Params: map[string]string{"since": since.UTC().Format(time.RFC3339)}}
+	err = s.observe(q, func() error { ts, err = s.store.Deleted(ctx, collection, since); return err })
+	return ts, err
+}
+
+// Begin uses the wrapped store's native transactions if it has them, and
+// otherwise compensates through s, so the transaction's queries are timed
+// too.
+func (s *Store) Begin(ctx context.Context) (storage.Tx, error) {
+	if b, ok := s.store.(storage.Beginner); ok {
+		return b.Begin(ctx)
+	}
+	// Hide Begin, so storage.Begin compensates rather than calling back.
+	return storage.Begin(ctx, struct{ storage.Store }{s})
+}
@@ -0,0 +1,94 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// slow is a store taking a set time per query on a fake clock.
+type slow struct {
+	storage.Store
+	clock *time.Time
+	took  map[string]time.Duration
+}
+
+func (s *slow) Get(ctx context.Context, collection, id string) (storage.Record, error) {
+	*s.clock = s.clock.Add(s.took[id])
+	return s.Store.Get(ctx, collection, id)
+}
+
+// TestSlowest checks that recent queries are listed slowest first, that
+// only the most recent are kept, and that slow ones are logged without
+// their IDs.
+func TestSlowest(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	backing := &slow{Store: storage.NewMemory(), clock: &now, took: map[string]time.Duration{
+		"fast":        time.Millisecond,
+		"slow":        200 * time.Millisecond,
+		"gladys@mail": 500 * time.Millisecond,
+	}}
+	s := New(backing, Config{SlowThreshold: 100 * time.Millisecond, Recent: 3})
+	s.SetClock(func() time.Time { return now })
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	defer logrus.SetOutput(os.Stderr)
+
+	ctx := context.Background()
+	for _, id := range []string{"gladys@mail", "fast", "slow", "fast"} {
+		s.Get(ctx, "greetings", id)
+	}
+	got := s.Slowest(2)
+	if len(got) != 2 || got[0].Duration != 200*time.Millisecond || got[1].Duration != time.Millisecond {
+		t.Errorf("Slowest(2) = %+v, want the 200ms query then a 1ms one; the 500ms one aged out", got)
+	}
+	if got[0].Params["id"] != Redacted {
+		t.Errorf("Slowest(2)[0].Params = %v, want the id redacted", got[0].Params)
+	}
+	if n := strings.Count(logs.String(), "slow storage query"); n != 2 {
+		t.Errorf("logged %d slow queries, want 2", n)
+	}
+	if strings.Contains(logs.String(), "gladys@mail") {
+		t.Errorf("slow-query log shows a record ID: %s", logs.String())
+	}
+
+	data, _ := json.Marshal(got[0])
+	if !strings.Contains(string(data), `"duration_ms":200`) {
+		t.Errorf("json.Marshal(Query) = %s, want duration_ms", data)
+	}
+}
+
+// TestWrites checks that writes pass through with their data redacted,
+// and that transactions compensate through the log.
+func TestWrites(t *testing.T) {
+	s := New(storage.NewMemory(), Config{})
+	ctx := context.Background()
+	tx, err := storage.Begin(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Create(ctx, "greetings", "a", json.RawMessage(`{"name":"Gladys"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var methods []string
+	for _, q := range s.Slowest(-1) {
+		methods = append(methods, q.Method)
+		if q.Method == "Create" && q.Params["data"] != "17 bytes" {
+			t.Errorf("Create params = %v, want data as 17 bytes", q.Params)
+		}
+	}
+	if !strings.Contains(strings.Join(methods, ","), "Create") || !strings.Contains(strings.Join(methods, ","), "Delete") {
+		t.Errorf("queries = %v, want the Create and the Delete undoing it", methods)
+	}
+}
@@ -0,0 +1,96 @@
+// Package recovery turns a panicking handler into a 500 response, so one
+// bad request is logged and counted instead of taking its connection, or
+// the process, down with it.
+package recovery
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+var panics = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_panics_total",
+	Help: "Handler panics recovered, by route template.",
+}, []string{"route"})
+
+// Middleware recovers panics in next, logging them with their stack trace
+// and responding 500 with a JSON error if nothing was written yet. The
+// http.ErrAbortHandler panic handlers use to drop a connection is let
+// through.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &panicWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(p)
+			}
+			route := "unmatched"
+			if cur := mux.CurrentRoute(r); cur != nil {
+				if tmpl, err := cur.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+			panics.WithLabelValues(route).Inc()
+			logrus.WithContext(r.Context()).WithFields(logrus.Fields{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"route":  route,
+				"panic":  p,
+				"stack":  string(debug.Stack()),
+			}).Error("recovered from panic in handler")
+			if !pw.wrote {
+				respond.Error(w, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+		next.ServeHTTP(pw, r)
+	})
+}
+
+// panicWriter records whether the response was started, after which a
+// 500 can't be sent.
+type panicWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *panicWriter) WriteHeader(code int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *panicWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *panicWriter) Flush() {
+	w.wrote = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through.
+func (w *panicWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.wrote = true
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (w *panicWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
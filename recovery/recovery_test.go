@@ -0,0 +1,50 @@
+package recovery
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestMiddleware checks that a panic becomes a logged 500 with a JSON
+// body, that a response already started is left alone, and that
+// http.ErrAbortHandler still aborts.
+func TestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logrus.SetOutput(&logs)
+	defer logrus.SetOutput(os.Stderr)
+
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("started") {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		panic("nil map")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/greet", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("panicking handler = %d %s, want a 500 JSON error", rec.Code, rec.Body)
+	}
+	if !strings.Contains(logs.String(), "nil map") || !strings.Contains(logs.String(), "recovery_test.go") {
+		t.Errorf("log = %s, want the panic and its stack", logs.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/greet?started", nil))
+	if rec.Code != http.StatusAccepted || rec.Body.Len() != 0 {
+		t.Errorf("panic after WriteHeader = %d %q, want the 202 untouched", rec.Code, rec.Body)
+	}
+
+	abort := Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(http.ErrAbortHandler) }))
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler to propagate", p)
+		}
+	}()
+	abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
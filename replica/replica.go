@@ -0,0 +1,296 @@
+// Package replica spreads storage reads over read replicas of a primary
+// store. Get, List and Deleted go to a replica, taken in turn; writes, and
+// everything in a transaction, go to the primary. A replica that lags too
+// far behind is skipped, and a read a replica fails, or can't find the
+// record for, is retried on the primary, so reads after a write don't
+// miss a record that hasn't replicated yet.
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// PrimaryName is the target label of the primary in the metrics.
+const PrimaryName = "primary"
+
+// Results counted in storage_queries_total.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Reasons counted in storage_replica_fallbacks_total.
+const (
+	// ReasonStale is a read sent to the primary because every replica
+	// lags by more than the maximum or failed its last check.
+	ReasonStale = "stale"
+	// ReasonError is a read retried on the primary after the replica
+	// failed it.
+	ReasonError = "error"
+	// ReasonNotFound is a Get retried on the primary because the replica
+	// doesn't have the record, which may not have replicated yet.
+	ReasonNotFound = "not_found"
+)
+
+var (
+	queries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "storage_queries_total",
+		Help: "Storage queries by target and result.",
+	}, []string{"target", "result"})
+	inFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "storage_queries_in_flight",
+		Help: "Storage queries running on each target.",
+	}, []string{"target"})
+	lagSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "storage_replica_lag_seconds",
+		Help: "How far each replica was behind the primary at its last check.",
+	}, []string{"target"})
+	fallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "storage_replica_fallbacks_total",
+		Help: "Reads sent to the primary instead of a replica, by reason.",
+	}, []string{"reason"})
+)
+
+// Lagger is implemented by replicas that can tell how far behind the
+// primary they are, such as a Postgres standby comparing its replay
+// timestamp with the current time. Replicas that don't implement it are
+// always treated as up to date.
+type Lagger interface {
+	Lag(ctx context.Context) (time.Duration, error)
+}
+
+// Target is a read replica.
+type Target struct {
+	// Name labels the replica in metrics and logs.
+	Name  string
+	Store storage.Store
+}
+
+// Config configures a Store.
+type Config struct {
+	Replicas []Target
+	// MaxLag is how far behind the primary a replica may be and still
+	// serve reads. Zero means no limit.
+	MaxLag time.Duration
+}
+
+// Store is a storage.Store that routes reads to replicas. It is safe for
+// concurrent use.
+type Store struct {
+	primary  counted
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+type replica struct {
+	counted
+	// fresh is cleared by Check while the replica lags by more than the
+	// maximum or can't tell its lag.
+	fresh atomic.Bool
+}
+
+// New returns a store writing to primary and reading from c.Replicas.
+// Replicas serve reads from the start; Check, or Run, takes lagging ones
+// out of rotation. With no replicas every query goes to the primary.
+func New(primary storage.Store, c Config) (*Store, error) {
+	s := &Store{primary: counted{PrimaryName, primary}, maxLag: c.MaxLag}
+	seen := map[string]bool{PrimaryName: true}
+	for _, t := range c.Replicas {
+		switch {
+		case t.Name == "":
+			return nil, errors.New("replica: a replica has no name")
+		case seen[t.Name]:
+			return nil, fmt.Errorf("replica: name %q is used twice", t.Name)
+		case t.Store == nil:
+			return nil, fmt.Errorf("replica: %q has no store", t.Name)
+		}
+		seen[t.Name] = true
+		r := &replica{counted: counted{t.Name, t.Store}}
+		r.fresh.Store(true)
+		s.replicas = append(s.replicas, r)
+	}
+	return s, nil
+}
+
+// Check asks each replica that implements Lagger how far behind it is,
+// taking those over the maximum, or failing to answer, out of rotation
+// until a later check finds them caught up. It returns the errors of the
+// failed checks.
+func (s *Store) Check(ctx context.Context) error {
+	var errs []error
+	for _, r := range s.replicas {
+		l, ok := r.store.(Lagger)
+		if !ok {
+			continue
+		}
+		lag, err := l.Lag(ctx)
+		if err != nil {
+			r.fresh.Store(false)
+			errs = append(errs, fmt.Errorf("replica %q: %w", r.name, err))
+			continue
+		}
+		lagSeconds.WithLabelValues(r.name).Set(lag.Seconds())
+		r.fresh.Store(s.maxLag == 0 || lag <= s.maxLag)
+	}
+	return errors.Join(errs...)
+}
+
+// Run checks the replicas at once and then every interval until ctx is
+// done.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := s.Check(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("replica: checking replication lag")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// pick returns the next fresh replica in turn, or false if there is none.
+func (s *Store) pick() (*replica, bool) {
+	n := len(s.replicas)
+	start := s.next.Add(1)
+	for i := 0; i < n; i++ {
+		if r := s.replicas[(start+uint64(i))%uint64(n)]; r.fresh.Load() {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// read runs f on a replica, falling back to the primary as the package
+// documentation describes.
+func read[T any](s *Store, ctx context.Context, f func(storage.Store) (T, error)) (T, error) {
+	if len(s.replicas) == 0 {
+		return f(s.primary)
+	}
+	r, ok := s.pick()
+	if !ok {
+		fallbacks.WithLabelValues(ReasonStale).Inc()
+		return f(s.primary)
+	}
+	v, err := f(r)
+	switch {
+	case err == nil || ctx.Err() != nil:
+		return v, err
+	case errors.Is(err, storage.ErrNotFound):
+		fallbacks.WithLabelValues(ReasonNotFound).Inc()
+	case errors.Is(err, storage.ErrHistoryExpired):
+		// Replicas may keep a shorter history than the primary.
+		fallbacks.WithLabelValues(ReasonError).Inc()
+	default:
+		fallbacks.WithLabelValues(ReasonError).Inc()
+		logrus.WithError(err).WithField("replica", r.name).Warn("replica: read failed, retrying on the primary")
+	}
+	return f(s.primary)
+}
+
+// Get reads the record from a replica, or from the primary if the replica
+// doesn't have it.
+func (s *Store) Get(ctx context.Context, collection, id string) (storage.Record, error) {
+	return read(s, ctx, func(st storage.Store) (storage.Record, error) { return st.Get(ctx, collection, id) })
+}
+
+// List reads from a replica. A lagging replica within the maximum may
+// not list the latest writes.
+func (s *Store) List(ctx context.Context, collection string, opts storage.ListOptions) ([]storage.Record, error) {
+	return read(s, ctx, func(st storage.Store) ([]storage.Record, error) { return st.List(ctx, collection, opts) })
+}
+
+// Deleted reads from a replica, or from the primary if the replica's
+// history has expired.
+func (s *Store) Deleted(ctx context.Context, collection string, since time.Time) ([]storage.Tombstone, error) {
+	return read(s, ctx, func(st storage.Store) ([]storage.Tombstone, error) { return st.Deleted(ctx, collection, since) })
+}
+
+// Create writes to the primary.
+func (s *Store) Create(ctx context.Context, collection, id string, data json.RawMessage) (storage.Record, error) {
+	return s.primary.Create(ctx, collection, id, data)
+}
+
+// Update writes to the primary.
+func (s *Store) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (storage.Record, error) {
+	return s.primary.Update(ctx, collection, id, data, ifVersion)
+}
+
+// Delete writes to the primary.
+func (s *Store) Delete(ctx context.Context, collection, id string, ifVersion int64) error {
+	return s.primary.Delete(ctx, collection, id, ifVersion)
+}
+
+// Begin starts a transaction on the primary, so its reads see its own
+// writes and the records compensation restores are current.
+func (s *Store) Begin(ctx context.Context) (storage.Tx, error) {
+	if b, ok := s.primary.store.(storage.Beginner); ok {
+		return b.Begin(ctx)
+	}
+	return storage.Begin(ctx, s.primary)
+}
+
+// counted is a store whose queries are counted under name.
+type counted struct {
+	name  string
+	store storage.Store
+}
+
+// count runs f as a query on c, returning its error.
+func (c counted) count(f func() error) error {
+	g := inFlight.WithLabelValues(c.name)
+	g.Inc()
+	defer g.Dec()
+	err := f()
+	result := ResultOK
+	// A missing record or a lost race is an answer, not a failure.
+	if err != nil && !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrExists) && !errors.Is(err, storage.ErrVersionMismatch) {
+		result = ResultError
+	}
+	queries.WithLabelValues(c.name, result).Inc()
+	return err
+}
+
+func (c counted) Get(ctx context.Context, collection, id string) (rec storage.Record, err error) {
+	err = c.count(func() error { rec, err = c.store.Get(ctx, collection, id); return err })
+	return rec, err
+}
+
+func (c counted) List(ctx context.Context, collection string, opts storage.ListOptions) (recs []storage.Record, err error) {
+	err = c.count(func() error { recs, err = c.store.List(ctx, collection, opts); return err })
+	return recs, err
+}
+
+func (c counted) Create(ctx context.Context, collection, id string, data json.RawMessage) (rec storage.Record, err error) {
+	err = c.count(func() error { rec, err = c.store.Create(ctx, collection, id, data); return err })
+	return rec, err
+}
+
+func (c counted) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (rec storage.Record, err error) {
+	err = c.count(func() error { rec, err = c.store.Update(ctx, collection, id, data, ifVersion); return err })
+	return rec, err
+}
+
+func (c counted) Delete(ctx context.Context, collection, id string, ifVersion int64) error {
+	return c.count(func() error { return c.store.Delete(ctx, collection, id, ifVersion) })
+}
+
+func (c counted) Deleted(ctx context.Context, collection string, since time.Time) (ts []storage.Tombstone, err error) {
+	err = c.count(func() error { ts, err = c.store.Deleted(ctx, collection, since); return err })
+	return ts, err
+}
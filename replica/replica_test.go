@@ -0,0 +1,163 @@
+package replica
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// lagging is a replica that reports a set lag, or fails.
+type lagging struct {
+	storage.Store
+	lag time.Duration
+	err error
+}
+
+func (l *lagging) Lag(ctx context.Context) (time.Duration, error) { return l.lag, l.err }
+
+// broken is a replica whose reads all fail.
+type broken struct{ storage.Store }
+
+func (broken) Get(ctx context.Context, collection, id string) (storage.Record, error) {
+	return storage.Record{}, errors.New("connection refused")
+}
+
+func create(t *testing.T, s storage.Store, id, data string) {
+	t.Helper()
+	if _, err := s.Create(context.Background(), "c", id, json.RawMessage(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(t *testing.T, s storage.Store, id string) string {
+	t.Helper()
+	rec, err := s.Get(context.Background(), "c", id)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", id, err)
+	}
+	return string(rec.Data)
+}
+
+// TestRouting checks that reads go to the replica and writes to the
+// primary, and that a record the replica doesn't have is read from the
+// primary.
+func TestRouting(t *testing.T) {
+	primary, secondary := storage.NewMemory(), storage.NewMemory()
+	create(t, primary, "a", `"primary"`)
+	create(t, secondary, "a", `"replica"`)
+	s, err := New(primary, Config{Replicas: []Target{{Name: "r1", Store: secondary}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := get(t, s, "a"); got != `"replica"` {
+		t.Errorf("Get(a) = %s, want the replica's record", got)
+	}
+	create(t, s, "b", `"new"`)
+	if _, err := secondary.Get(context.Background(), "c", "b"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Create() wrote to the replica")
+	}
+	if got := get(t, s, "b"); got != `"new"` {
+		t.Errorf("Get(b) = %s, want the primary's record", got)
+	}
+	if _, err := s.Get(context.Background(), "c", "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+	recs, err := s.List(context.Background(), "c", storage.ListOptions{})
+	if err != nil || len(recs) != 1 {
+		t.Errorf("List() = %d records, %v; want the replica's 1", len(recs), err)
+	}
+}
+
+// TestStaleness checks that Check takes replicas over the maximum lag, or
+// failing to report it, out of rotation and puts them back once caught
+// up, and that reads fall back to the primary meanwhile.
+func TestStaleness(t *testing.T) {
+	primary := storage.NewMemory()
+	create(t, primary, "a", `"primary"`)
+	behind := &lagging{Store: storage.NewMemory(), lag: time.Minute}
+	create(t, behind, "a", `"behind"`)
+	s, err := New(primary, Config{Replicas: []Target{{Name: "r1", Store: behind}}, MaxLag: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, s, "a"); got != `"primary"` {
+		t.Errorf("Get(a) with a stale replica = %s, want the primary's record", got)
+	}
+	behind.lag = time.Second
+	s.Check(context.Background())
+	if got := get(t, s, "a"); got != `"behind"` {
+		t.Errorf("Get(a) once caught up = %s, want the replica's record", got)
+	}
+	behind.err = errors.New("timeout")
+	if err := s.Check(context.Background()); err == nil {
+		t.Error("Check() with a failing replica succeeded")
+	}
+	if got := get(t, s, "a"); got != `"primary"` {
+		t.Errorf("Get(a) after a failed check = %s, want the primary's record", got)
+	}
+}
+
+// TestFallback checks that reads a replica fails are retried on the
+// primary, and that other replicas take their turn.
+func TestFallback(t *testing.T) {
+	primary, healthy := storage.NewMemory(), storage.NewMemory()
+	create(t, primary, "a", `"primary"`)
+	create(t, healthy, "a", `"healthy"`)
+	s, err := New(primary, Config{Replicas: []Target{
+		{Name: "broken", Store: broken{storage.NewMemory()}},
+		{Name: "healthy", Store: healthy},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[get(t, s, "a")] = true
+	}
+	if !seen[`"primary"`] || !seen[`"healthy"`] || len(seen) != 2 {
+		t.Errorf("Get(a) results = %v, want the primary's and the healthy replica's", seen)
+	}
+}
+
+// TestBegin checks that transactions run on the primary.
+func TestBegin(t *testing.T) {
+	primary, secondary := storage.NewMemory(), storage.NewMemory()
+	s, _ := New(primary, Config{Replicas: []Target{{Name: "r1", Store: secondary}}})
+	tx, err := storage.Begin(context.Background(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	create(t, tx, "a", `"tx"`)
+	if got := get(t, tx, "a"); got != `"tx"` {
+		t.Errorf("Get(a) in the transaction = %s, want its own write", got)
+	}
+	if err := tx.Rollback(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primary.Get(context.Background(), "c", "a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get(a) after Rollback() error = %v, want ErrNotFound", err)
+	}
+}
+
+// TestNew checks that replicas need distinct names and a store.
+func TestNew(t *testing.T) {
+	for _, replicas := range [][]Target{
+		{{Name: "", Store: storage.NewMemory()}},
+		{{Name: "primary", Store: storage.NewMemory()}},
+		{{Name: "r1", Store: storage.NewMemory()}, {Name: "r1", Store: storage.NewMemory()}},
+		{{Name: "r1"}},
+	} {
+		if _, err := New(storage.NewMemory(), Config{Replicas: replicas}); err == nil {
+			t.Errorf("New(%v) succeeded, want an error", replicas)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package requestid gives every request an ID, sent back in the
+// X-Request-ID header and stamped on the log lines written while handling
+// it, so a client's report can be matched to the server's logs. IDs are
+// UUIDs or, where shorter, time-ordered IDs are wanted, snowflakes.
+package requestid
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/bwmarrin/snowflake"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Header carries request IDs, both ways.
+const Header = "X-Request-ID"
+
+// Field is the log field request IDs are logged under.
+const Field = "request_id"
+
+// Generator kinds accepted by NewGenerator.
+const (
+	KindUUID      = "uuid"
+	KindSnowflake = "snowflake"
+)
+
+// valid matches IDs accepted from clients: short, and safe to log and echo.
+var valid = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Generator returns a new request ID.
+type Generator func() string
+
+// UUID generates random UUIDs.
+func UUID() string {
+	return uuid.NewString()
+}
+
+// NewGenerator returns the generator of kind, KindUUID or KindSnowflake.
+// Snowflakes embed node, which must differ between replicas and be
+// between 0 and 1023.
+func NewGenerator(kind string, node int64) (Generator, error) {
+	switch kind {
+	case KindUUID, "":
+		return UUID, nil
+	case KindSnowflake:
+		n, err := snowflake.NewNode(node)
+		if err != nil {
+			return nil, fmt.Errorf("requestid: snowflake node: %w", err)
+		}
+		return func() string { return n.Generate().String() }, nil
+	}
+	return nil, fmt.Errorf("requestid: unknown generator %q; want %s or %s", kind, KindUUID, KindSnowflake)
+}
+
+// Middleware gives each request an ID: the one a client or proxy sent in
+// the X-Request-ID header, if it looks like one, or a new one from gen.
+// The ID is set on the response and stored in the request context.
+func Middleware(gen Generator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(Header)
+			if !valid.MatchString(id) {
+				id = gen()
+			}
+			w.Header().Set(Header, id)
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+		})
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the request ID id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx by Middleware.
+func FromContext(ctx context.Context) (id string, ok bool) {
+	id, ok = ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// Hook adds the request ID to log entries made with a request's context,
+// as by logrus.WithContext(r.Context()).
+type Hook struct{}
+
+// Levels returns every level.
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire adds the request ID of e's context, if it has one.
+func (Hook) Fire(e *logrus.Entry) error {
+	if e.Context == nil {
+		return nil
+	}
+	if id, ok := FromContext(e.Context); ok {
+		e.Data[Field] = id
+	}
+	return nil
+}
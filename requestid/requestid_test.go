@@ -0,0 +1,70 @@
+package requestid
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestMiddleware checks that requests get a new ID unless they bring a
+// plausible one, that it is echoed and in the context, and that log lines
+// made with the request context carry it.
+func TestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&logs)
+	logger.AddHook(Hook{})
+
+	var seen string
+	h := Middleware(func() string { return "generated" })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+		logger.WithContext(r.Context()).Info("handling")
+	}))
+	tests := []struct {
+		sent, want string
+	}{
+		{"", "generated"},
+		{"abc-123", "abc-123"},
+		{"<script>", "generated"},
+		{strings.Repeat("a", 65), "generated"},
+	}
+	for _, tt := range tests {
+		logs.Reset()
+		req := httptest.NewRequest("GET", "/greet", nil)
+		if tt.sent != "" {
+			req.Header.Set(Header, tt.sent)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get(Header); got != tt.want || seen != tt.want {
+			t.Errorf("sent %q: header %q, context %q, want %q", tt.sent, got, seen, tt.want)
+		}
+		if !strings.Contains(logs.String(), "request_id="+tt.want) {
+			t.Errorf("sent %q: log %q, want request_id=%s", tt.sent, logs.String(), tt.want)
+		}
+	}
+}
+
+// TestNewGenerator checks both kinds of ID and that bad settings are
+// refused.
+func TestNewGenerator(t *testing.T) {
+	for _, kind := range []string{KindUUID, KindSnowflake} {
+		gen, err := NewGenerator(kind, 7)
+		if err != nil {
+			t.Fatalf("NewGenerator(%s) = %v", kind, err)
+		}
+		if a, b := gen(), gen(); a == b || !valid.MatchString(a) {
+			t.Errorf("%s IDs %q, %q, want distinct valid IDs", kind, a, b)
+		}
+	}
+	if _, err := NewGenerator(KindSnowflake, 4096); err == nil {
+		t.Errorf("NewGenerator(snowflake, 4096) succeeded, want an error")
+	}
+	if _, err := NewGenerator("ulid", 0); err == nil {
+		t.Errorf("NewGenerator(ulid) succeeded, want an error")
+	}
+}
@@ -0,0 +1,71 @@
+package respond
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag returns the strong entity tag for version of the resource id. Every
+// stored resource uses it so that tags are computed the same way
+// everywhere.
+func ETag(id string, version int64) string {
+	sum := sha256.Sum256([]byte(id + "\x00" + strconv.FormatInt(version, 10)))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// CheckIfMatch enforces optimistic concurrency for a write to a resource
+// whose current tag is etag. It responds 428 if the request has no
+// If-Match header and 412 if none of its tags match, returning false in
+// both cases.
+func CheckIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		Error(w, http.StatusPreconditionRequired, "If-Match header with the resource's ETag is required")
+		return false
+	}
+	if !matchesETag(header, etag) {
+		PreconditionFailed(w, etag)
+		return false
+	}
+	return true
+}
+
+// NotModified handles If-None-Match for a read of a resource whose current
+// tag is etag. It sets the ETag header and, if the client already has
+// that version, responds 304 and returns true. Weak comparison is used, as
+// RFC 9110 requires for If-None-Match.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !matchesETag(weaken(header), weaken(etag)) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// weaken strips weak-tag prefixes so tags can be compared weakly.
+func weaken(tags string) string {
+	return strings.ReplaceAll(tags, "W/", "")
+}
+
+// PreconditionFailed responds 412 and tells the client the current tag.
+func PreconditionFailed(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	Error(w, http.StatusPreconditionFailed, "resource has been modified; fetch it again and retry")
+}
+
+// matchesETag reports whether an If-Match style header lists etag, using
+// strong comparison.
+func matchesETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package respond
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// RequestedFields returns the fields a client asked for with ?fields=a,b or
+// the JSON:API form ?fields[resourceType]=a,b, or nil if it didn't ask.
+func RequestedFields(r *http.Request, resourceType string) []string {
+	q := r.URL.Query()
+	list := q.Get("fields[" + resourceType + "]")
+	if list == "" {
+		list = q.Get("fields")
+	}
+	if list == "" {
+		return nil
+	}
+	var fields []string
+	for _, f := range strings.Split(list, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// JSONFields is like JSON but trims v down to the fields requested for
+// resourceType (see RequestedFields). v must encode to an object or an
+// array of objects; "id" is always kept so clients can still tell
+// resources apart.
+func JSONFields(w http.ResponseWriter, r *http.Request, status int, resourceType string, v interface{}) {
+	fields := RequestedFields(r, resourceType)
+	if fields == nil {
+		JSON(w, status, v)
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	keep := map[string]bool{"id": true}
+	for _, f := range fields {
+		keep[f] = true
+	}
+	JSON(w, status, selectFields(generic, keep))
+}
+
+func selectFields(v interface{}, keep map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			if !keep[k] {
+				delete(v, k)
+			}
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = selectFields(v[i], keep)
+		}
+		return v
+	}
+	return v
+}
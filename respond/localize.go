@@ -0,0 +1,34 @@
+package respond
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/locale"
+)
+
+// Timestamp is how times appear in JSON responses: RFC 3339 with an
+// explicit offset for machines, the IANA zone name, and a display string
+// localized for the request.
+type Timestamp struct {
+	RFC3339 string `json:"rfc3339"`
+	Zone    string `json:"zone"`
+	Display string `json:"display"`
+}
+
+// Time returns t as a Timestamp in the time zone and language negotiated by
+// locale.Middleware.
+func Time(r *http.Request, t time.Time) Timestamp {
+	loc := locale.LocationFromContext(r.Context())
+	t = t.In(loc)
+	return Timestamp{
+		RFC3339: t.Format(time.RFC3339),
+		Zone:    loc.String(),
+		Display: locale.FormatDate(locale.FromContext(r.Context()), t),
+	}
+}
+
+// Number returns n formatted for display in the request's language.
+func Number(r *http.Request, n interface{}) string {
+	return locale.FormatNumber(locale.FromContext(r.Context()), n)
+}
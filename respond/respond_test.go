@@ -0,0 +1,18 @@
+package respond
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestText checks that plain text is written as is, with sniffing off.
+func TestText(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Text(rec, 200, `Hello, O'Brien & <Gladys>!`)
+	if got := rec.Body.String(); got != `Hello, O'Brien & <Gladys>!` {
+		t.Errorf("Text() body = %q, want it unescaped", got)
+	}
+	if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+}
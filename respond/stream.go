@@ -0,0 +1,130 @@
+package respond
+
+import (
+	"net/http"
+	"sync"
+	"unicode/utf8"
+)
+
+// flushSize is how much an ObjectWriter buffers before writing to the
+// client.
+const flushSize = 32 << 10
+
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, flushSize+1024)
+		return &b
+	},
+}
+
+// ObjectWriter streams a JSON object of string members to a response
+// without holding the whole document in memory. Output is escaped the same
+// way as JSON.
+type ObjectWriter struct {
+	w   http.ResponseWriter
+	buf *[]byte
+	n   int
+	err error
+}
+
+// StreamObject starts a JSON object response with the given status. Call
+// Field for each member and Close when done.
+func StreamObject(w http.ResponseWriter, status int) *ObjectWriter {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	buf := bufPool.Get().(*[]byte)
+	*buf = append((*buf)[:0], '{')
+	return &ObjectWriter{w: w, buf: buf}
+}
+
+// Field appends a "key": "value" member.
+func (o *ObjectWriter) Field(key, value string) {
+	if o.err != nil {
+		return
+	}
+	b := *o.buf
+	if o.n > 0 {
+		b = append(b, ',')
+	}
+	b = appendString(b, key)
+	b = append(b, ':')
+	b = appendString(b, value)
+	*o.buf = b
+	o.n++
+
+	if len(b) >= flushSize {
+		o.flush()
+	}
+}
+
+// Close ends the object, writes any buffered output, and returns the
+// buffer to the pool. It returns the first write error, if any.
+func (o *ObjectWriter) Close() error {
+	if o.err == nil {
+		*o.buf = append(*o.buf, '}', '\n')
+		o.flush()
+	}
+	bufPool.Put(o.buf)
+	o.buf = nil
+	return o.err
+}
+
+func (o *ObjectWriter) flush() {
+	if _, err := o.w.Write(*o.buf); err != nil {
+		o.err = err
+	}
+	*o.buf = (*o.buf)[:0]
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString appends s as a JSON string, escaping HTML-significant
+// characters and U+2028/U+2029 like encoding/json does.
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
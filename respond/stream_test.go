@@ -0,0 +1,43 @@
+package respond
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestStreamObject checks that streamed output decodes back to the members
+// written, including characters that need escaping.
+func TestStreamObject(t *testing.T) {
+	members := map[string]string{
+		"plain":            "Hi, Gladys. Welcome!",
+		`quote"back\slash`: "line\nbreak\ttab",
+		"<script>":         "a & b > c",
+		"ctrl\x01":         "sep\u2028arator",
+		"bad utf8":         "Jos\xff",
+	}
+
+	rec := httptest.NewRecorder()
+	o := StreamObject(rec, 200)
+	for k, v := range members {
+		o.Field(k, v)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(rec.Body.String(), "<script>") {
+		t.Errorf("streamed output contains unescaped HTML: %s", rec.Body)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("streamed output is not valid JSON: %v\n%s", err, rec.Body)
+	}
+	members["bad utf8"] = "Jos\ufffd"
+	if !reflect.DeepEqual(got, members) {
+		t.Fatalf("decoded %v, want %v", got, members)
+	}
+}
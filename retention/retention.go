@@ -0,0 +1,221 @@
+// Package retention deletes records once they are older than their
+// collection's retention policy, such as greetings after 90 days. Purges
+// list and delete in batches, so a large backlog doesn't hold the store
+// for long, and can be run dry to report what they would delete.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// DefaultBatchSize is the batch size of purgers that don't set one.
+const DefaultBatchSize = 500
+
+// Fields a policy measures age by.
+const (
+	CreatedAt = "created_at"
+	UpdatedAt = "updated_at"
+)
+
+var (
+	purged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "retention_purged_records_total",
+		Help: "Records deleted by retention policies, by collection.",
+	}, []string{"collection"})
+	expired = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "retention_expired_records",
+		Help: "Records past their retention found by the last purge, dry runs included, by collection.",
+	}, []string{"collection"})
+	lastPurge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "retention_last_purge_timestamp_seconds",
+		Help: "When the last purge that deleted records finished without errors.",
+	})
+)
+
+// Policy is how long the records of a collection are kept.
+type Policy struct {
+	Collection string `json:"collection"`
+	// MaxAge is how old records may get before they are purged.
+	MaxAge time.Duration `json:"-"`
+	// Field is what age is measured from: CreatedAt, the default, or
+	// UpdatedAt, which keeps records as long as they are still edited.
+	Field string `json:"field"`
+}
+
+// Check reports policies that can't be applied.
+func (p Policy) Check() error {
+	switch {
+	case p.Collection == "":
+		return errors.New("retention: a policy has no collection")
+	case p.MaxAge <= 0:
+		return fmt.Errorf("retention: %s: max age must be positive", p.Collection)
+	case p.Field != "" && p.Field != CreatedAt && p.Field != UpdatedAt:
+		return fmt.Errorf("retention: %s: field must be %s or %s, not %q", p.Collection, CreatedAt, UpdatedAt, p.Field)
+	}
+	return nil
+}
+
+// Result is what a purge did to one collection.
+type Result struct {
+	Collection string `json:"collection"`
+	// Cutoff is the time records older than were expired.
+	Cutoff time.Time `json:"cutoff"`
+	// Expired counts the records found past the cutoff.
+	Expired int `json:"expired"`
+	// Purged counts the records deleted; none on a dry run. Records
+	// changed by someone else since they were listed are left alone.
+	Purged int  `json:"purged"`
+	DryRun bool `json:"dry_run"`
+	// Error is set if the purge stopped early.
+	Error string `json:"error,omitempty"`
+}
+
+// Purger applies retention policies to a store.
+type Purger struct {
+	Store    storage.Store
+	Policies []Policy
+	// Tenants, if set, is the TenantStore beneath Store. Policies on its
+	// tenant-scoped collections are applied to every tenant's records.
+	Tenants *storage.TenantStore
+	// BatchSize is how many records are listed, then deleted, at a time.
+	BatchSize int
+	now       func() time.Time
+}
+
+// NewPurger returns a purger applying policies to store, or an error if a
+// policy is invalid.
+func NewPurger(store storage.Store, policies ...Policy) (*Purger, error) {
+	seen := make(map[string]bool)
+	for _, p := range policies {
+		if err := p.Check(); err != nil {
+			return nil, err
+		}
+		if seen[p.Collection] {
+			return nil, fmt.Errorf("retention: %s has more than one policy", p.Collection)
+		}
+		seen[p.Collection] = true
+	}
+	return &Purger{Store: store, Policies: policies, BatchSize: DefaultBatchSize, now: time.Now}, nil
+}
+
+// SetClock makes the purger tell record age by now instead of the wall
+// clock, for tests.
+func (p *Purger) SetClock(now func() time.Time) {
+	p.now = now
+}
+
+// Purge applies every policy, deleting expired records unless dryRun is
+// set, and returns what it did per policy. A policy that fails doesn't
+// stop the others; the errors are joined.
+func (p *Purger) Purge(ctx context.Context, dryRun bool) ([]Result, error) {
+	now := p.now()
+	results := make([]Result, 0, len(p.Policies))
+	var errs []error
+	for _, policy := range p.Policies {
+		res, err := p.purgeTenants(ctx, policy, now.Add(-policy.MaxAge), dryRun)
+		if err != nil {
+			res.Error = err.Error()
+			errs = append(errs, fmt.Errorf("retention: %s: %w", policy.Collection, err))
+		}
+		expired.WithLabelValues(policy.Collection).Set(float64(res.Expired))
+		results = append(results, res)
+	}
+	if len(errs) == 0 && !dryRun {
+		lastPurge.Set(float64(p.now().Unix()))
+	}
+	return results, errors.Join(errs...)
+}
+
+// purgeTenants is purge for every tenant whose records policy's
+// collection holds, adding up what it did.
+func (p *Purger) purgeTenants(ctx context.Context, policy Policy, cutoff time.Time, dryRun bool) (Result, error) {
+	if p.Tenants == nil || !p.Tenants.Scoped(policy.Collection) {
+		return p.purge(ctx, policy, cutoff, dryRun)
+	}
+	total := Result{Collection: policy.Collection, Cutoff: cutoff, DryRun: dryRun}
+	err := p.Tenants.EachTenant(ctx, func(ctx context.Context) error {
+		res, err := p.purge(ctx, policy, cutoff, dryRun)
+		total.Expired += res.Expired
+		total.Purged += res.Purged
+		return err
+	})
+	return total, err
+}
+
+// purge applies policy, expiring records from before cutoff.
+func (p *Purger) purge(ctx context.Context, policy Policy, cutoff time.Time, dryRun bool) (Result, error) {
+	res := Result{Collection: policy.Collection, Cutoff: cutoff, DryRun: dryRun}
+	batch := p.BatchSize
+	if batch <= 0 {
+		batch = DefaultBatchSize
+	}
+	byCreation := policy.Field != UpdatedAt
+	var after *storage.Key
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		recs, err := p.Store.List(ctx, policy.Collection, storage.ListOptions{After: after, Limit: batch})
+		if err != nil {
+			return res, err
+		}
+		for _, rec := range recs {
+			age := rec.UpdatedAt
+			if byCreation {
+				age = rec.CreatedAt
+			}
+			if !age.Before(cutoff) {
+				if byCreation {
+					// Lists are in creation order, so the rest are newer.
+					return res, nil
+				}
+				continue
+			}
+			res.Expired++
+			if dryRun {
+				continue
+			}
+			// Only delete the version that was seen to be expired.
+			switch err := p.Store.Delete(ctx, policy.Collection, rec.ID, rec.Version); {
+			case err == nil:
+				res.Purged++
+				purged.WithLabelValues(policy.Collection).Inc()
+			case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrVersionMismatch):
+			default:
+				return res, err
+			}
+		}
+		if len(recs) < batch {
+			return res, nil
+		}
+		last := recs[len(recs)-1].Key()
+		after = &last
+	}
+}
+
+// Job returns a function for a schedule.Job that purges, logging what it
+// deleted, or would delete if dryRun is set.
+func (p *Purger) Job(dryRun bool) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		results, err := p.Purge(ctx, dryRun)
+		for _, res := range results {
+			logrus.WithFields(logrus.Fields{
+				"collection": res.Collection,
+				"cutoff":     res.Cutoff,
+				"expired":    res.Expired,
+				"purged":     res.Purged,
+				"dry_run":    res.DryRun,
+			}).Info("retention: purge finished")
+		}
+		return err
+	}
+}
@@ -0,0 +1,141 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// seed stores n greetings, one a day from start, and returns the store.
+func seed(t *testing.T, start time.Time, n int) *storage.Memory {
+	t.Helper()
+	m := storage.NewMemory()
+	now := start
+	m.SetClock(func() time.Time { return now })
+	for i := 0; i < n; i++ {
+		if _, err := m.Create(context.Background(), "greetings", fmt.Sprintf("g%02d", i), json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(24 * time.Hour)
+	}
+	return m
+}
+
+// TestPurge checks that records past the policy's age are deleted in
+// batches, that newer ones are kept, and that a dry run only counts them.
+func TestPurge(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := seed(t, start, 10)
+	p, err := NewPurger(m, Policy{Collection: "greetings", MaxAge: 5 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.BatchSize = 2
+	// Ten days in, greetings from days 0 to 4 are more than five days old.
+	p.SetClock(func() time.Time { return start.Add(10*24*time.Hour - time.Minute) })
+	ctx := context.Background()
+
+	got, err := p.Purge(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Expired != 5 || got[0].Purged != 0 || !got[0].DryRun {
+		t.Errorf("Purge(dry run) = %+v, want 5 expired and none purged", got)
+	}
+	if recs, _ := m.List(ctx, "greetings", storage.ListOptions{}); len(recs) != 10 {
+		t.Errorf("after a dry run, %d greetings are left, want 10", len(recs))
+	}
+
+	got, err = p.Purge(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Expired != 5 || got[0].Purged != 5 {
+		t.Errorf("Purge() = %+v, want 5 expired and purged", got)
+	}
+	recs, _ := m.List(ctx, "greetings", storage.ListOptions{})
+	if len(recs) != 5 || recs[0].ID != "g05" {
+		t.Errorf("after a purge, greetings start at %v of %d, want g05 of 5", recs[0].ID, len(recs))
+	}
+}
+
+// TestPurgeUpdated checks that policies by update time keep old records
+// that are still being edited.
+func TestPurgeUpdated(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := seed(t, start, 4)
+	later := start.Add(30 * 24 * time.Hour)
+	m.SetClock(func() time.Time { return later })
+	ctx := context.Background()
+	m.Update(ctx, "greetings", "g00", json.RawMessage(`{"edited":true}`), 0)
+
+	p, _ := NewPurger(m, Policy{Collection: "greetings", MaxAge: 7 * 24 * time.Hour, Field: UpdatedAt})
+	p.SetClock(func() time.Time { return later })
+	got, err := p.Purge(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Purged != 3 {
+		t.Errorf("Purge() purged %d, want 3", got[0].Purged)
+	}
+	if _, err := m.Get(ctx, "greetings", "g00"); err != nil {
+		t.Errorf("Get(g00) = %v, want the edited greeting kept", err)
+	}
+}
+
+// TestPurgeTenants checks that policies on tenant-scoped collections purge
+// every tenant's expired records, not only those of no tenant.
+func TestPurgeTenants(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := storage.NewMemory()
+	now := start
+	m.SetClock(func() time.Time { return now })
+	tenants := storage.NewTenantStore(m, "greetings")
+	acme := storage.WithTenant(context.Background(), "acme")
+	for _, id := range []string{"old", "new"} {
+		if _, err := tenants.Create(acme, "greetings", id, json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * 24 * time.Hour)
+	}
+
+	p, _ := NewPurger(tenants, Policy{Collection: "greetings", MaxAge: 15 * 24 * time.Hour})
+	p.Tenants = tenants
+	p.SetClock(func() time.Time { return now })
+	got, err := p.Purge(storage.Unscoped(context.Background()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Expired != 1 || got[0].Purged != 1 {
+		t.Errorf("Purge() = %+v, want acme's old greeting purged", got)
+	}
+	if _, err := tenants.Get(acme, "greetings", "old"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get(old) for acme error = %v, want ErrNotFound", err)
+	}
+	if _, err := tenants.Get(acme, "greetings", "new"); err != nil {
+		t.Errorf("Get(new) for acme = %v, want it kept", err)
+	}
+}
+
+// TestNewPurger checks that invalid policies are refused.
+func TestNewPurger(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []Policy
+	}{
+		{"no collection", []Policy{{MaxAge: time.Hour}}},
+		{"no max age", []Policy{{Collection: "greetings"}}},
+		{"unknown field", []Policy{{Collection: "greetings", MaxAge: time.Hour, Field: "deleted_at"}}},
+		{"duplicate", []Policy{{Collection: "greetings", MaxAge: time.Hour}, {Collection: "greetings", MaxAge: 2 * time.Hour}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewPurger(storage.NewMemory(), tt.policies...); err == nil {
+			t.Errorf("%s: NewPurger() succeeded, want an error", tt.name)
+		}
+	}
+}
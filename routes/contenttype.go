@@ -0,0 +1,71 @@
+package routes
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// unsupportedBody is the JSON shape of 415 responses.
+type unsupportedBody struct {
+	Error       string   `json:"error"`
+	ContentType string   `json:"content_type"`
+	Accepted    []string `json:"accepted"`
+}
+
+// accepts returns the media types rt takes.
+func (reg *Registry) accepts(rt *Route) []string {
+	if rt.Accepts != nil {
+		return rt.Accepts
+	}
+	return reg.DefaultAccepts
+}
+
+// hasBody reports whether r carries a request body.
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+}
+
+// ContentTypes is middleware that rejects request bodies whose
+// Content-Type isn't one the matched route accepts, with 415, instead of
+// letting the handler misparse them. A missing Content-Type on a body is
+// rejected too. Requests without a body, and routes not in the registry,
+// pass through.
+func (reg *Registry) ContentTypes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt := reg.Lookup(r)
+		if rt == nil || !hasBody(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		accepted := reg.accepts(rt)
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err == nil {
+			for _, t := range accepted {
+				if strings.EqualFold(mediaType, t) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			w.Header().Set("Accept-Post", strings.Join(accepted, ", "))
+		case http.MethodPatch:
+			w.Header().Set("Accept-Patch", strings.Join(accepted, ", "))
+		}
+		got := r.Header.Get("Content-Type")
+		msg := "unsupported content type " + got
+		if got == "" {
+			msg = "request body needs a Content-Type"
+		}
+		respond.JSON(w, http.StatusUnsupportedMediaType, unsupportedBody{
+			Error:       msg,
+			ContentType: got,
+			Accepted:    accepted,
+		})
+	})
+}
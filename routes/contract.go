@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is the subset of an OpenAPI 3.0 schema object the registry
+// documents responses with and Validate checks them against.
+type Schema struct {
+	// Type is object, array, string, integer, number or boolean.
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+}
+
+// Example is a request documented for a route, which Contract replays.
+type Example struct {
+	Name string `json:"name"`
+	// Method defaults to the route's first method.
+	Method string `json:"method,omitempty"`
+	// Target is the request path and query, such as /greetings?page=2.
+	Target string `json:"target"`
+	// Body is sent as application/json when set.
+	Body string `json:"body,omitempty"`
+	// Status is the response status the example should get. Its response
+	// schema, if the route declares one, is checked too.
+	Status int `json:"status"`
+}
+
+// Returns declares the JSON response schema of the route for status.
+func (rt *Route) Returns(status int, schema *Schema) *Route {
+	if rt.Responses == nil {
+		rt.Responses = make(map[int]*Schema)
+	}
+	rt.Responses[status] = schema
+	return rt
+}
+
+// Example adds a documented request to the route.
+func (rt *Route) Example(ex Example) *Route {
+	rt.Examples = append(rt.Examples, ex)
+	return rt
+}
+
+// responsesDoc returns the OpenAPI responses object of rt.
+func responsesDoc(rt *Route) map[string]interface{} {
+	out := map[string]interface{}{
+		"default": map[string]interface{}{"description": "See the response body."},
+	}
+	for status, schema := range rt.Responses {
+		out[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schema},
+			},
+		}
+	}
+	return out
+}
+
+// examplesDoc returns the examples of rt sent with method.
+func examplesDoc(rt *Route, method string) []Example {
+	var out []Example
+	for _, ex := range rt.Examples {
+		m := ex.Method
+		if m == "" {
+			m = rt.Methods[0]
+		}
+		if strings.EqualFold(m, method) {
+			ex.Method = strings.ToUpper(m)
+			out = append(out, ex)
+		}
+	}
+	return out
+}
+
+// Contract fetches the OpenAPI document from h, replays every example in
+// it against h, and returns a description of each response that doesn't
+// match the document: an unexpected status, a status the operation
+// doesn't declare, or a body that doesn't fit the declared schema.
+// Examples run in path order, then in the order they were added.
+func Contract(h http.Handler) ([]string, error) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: status %d", OpenAPIPath, rec.Code)
+	}
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", OpenAPIPath, err)
+	}
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var problems []string
+	for _, p := range paths {
+		methods := make([]string, 0, len(doc.Paths[p]))
+		for m := range doc.Paths[p] {
+			if m != "parameters" {
+				methods = append(methods, m)
+			}
+		}
+		sort.Strings(methods)
+		for _, m := range methods {
+			var op struct {
+				Responses map[string]struct {
+					Content map[string]struct {
+						Schema any `json:"schema"`
+					} `json:"content"`
+				} `json:"responses"`
+				Examples []Example `json:"x-examples"`
+			}
+			if err := json.Unmarshal(doc.Paths[p][m], &op); err != nil {
+				return nil, fmt.Errorf("decoding %s %s: %w", strings.ToUpper(m), p, err)
+			}
+			for _, ex := range op.Examples {
+				prefix := fmt.Sprintf("%s %s: example %q", ex.Method, p, ex.Name)
+				req := httptest.NewRequest(ex.Method, ex.Target, strings.NewReader(ex.Body))
+				if ex.Body != "" {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if rec.Code != ex.Status {
+					problems = append(problems, fmt.Sprintf("%s: status %d, want %d", prefix, rec.Code, ex.Status))
+					continue
+				}
+				resp, ok := op.Responses[strconv.Itoa(rec.Code)]
+				if !ok {
+					problems = append(problems, fmt.Sprintf("%s: status %d is not documented", prefix, rec.Code))
+					continue
+				}
+				media, ok := resp.Content["application/json"]
+				if !ok {
+					continue
+				}
+				var body any
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: body is not JSON: %v", prefix, err))
+					continue
+				}
+				for _, err := range Validate(media.Schema, body) {
+					problems = append(problems, fmt.Sprintf("%s: %v", prefix, err))
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+// Validate checks v, a decoded JSON value, against schema, which is a
+// Schema or a schema decoded from JSON, and returns every mismatch, each
+// naming where in v it is, such as $.items[0].name.
+func Validate(schema any, v any) []error {
+	var s Schema
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return []error{err}
+	}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return []error{err}
+	}
+	return s.check("$", v, nil)
+}
+
+// check appends the mismatches between v, at path, and s to errs.
+func (s *Schema) check(path string, v any, errs []error) []error {
+	if v == nil {
+		if !s.Nullable {
+			errs = append(errs, fmt.Errorf("%s: got null, want %s", path, s.Type))
+		}
+		return errs
+	}
+	if got := jsonType(v); got != s.Type && !(s.Type == "number" && got == "integer") {
+		return append(errs, fmt.Errorf("%s: got %s, want %s", path, got, s.Type))
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing required property %q", path, name))
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if pv, ok := v[name]; ok {
+				errs = s.Properties[name].check(path+"."+name, pv, errs)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	}
+	return errs
+}
+
+// jsonType returns the schema type of the decoded JSON value v.
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
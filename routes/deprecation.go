@@ -0,0 +1,101 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/clients"
+	"github.com/Shulammite-Aso/bazel-demo-app/useragent"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var deprecatedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_deprecated_requests_total",
+	Help: "Requests to deprecated routes by route and client.",
+}, []string{"route", "client"})
+
+// Deprecation announces that a route, or some of its fields, will be
+// removed.
+type Deprecation struct {
+	// Since is when the route was deprecated.
+	Since time.Time
+	// Sunset is when it will stop working. Zero means not yet decided.
+	Sunset time.Time
+	// Link points to migration notes or the replacement.
+	Link string
+	// Fields, when set, deprecates only these request or response fields
+	// and leaves the route itself supported. Field deprecations are only
+	// announced in the OpenAPI document, since the headers describe the
+	// whole resource.
+	Fields []string
+}
+
+// route reports whether d deprecates the whole route.
+func (d *Deprecation) route() bool {
+	return d != nil && len(d.Fields) == 0
+}
+
+// Versioned sets the API version the route belongs to.
+func (rt *Route) Versioned(version string) *Route {
+	rt.Version = version
+	return rt
+}
+
+// Deprecate marks the route, or the fields listed in d, as deprecated.
+func (rt *Route) Deprecate(d Deprecation) *Route {
+	rt.Deprecation = &d
+	return rt
+}
+
+// version returns the API version of rt.
+func (reg *Registry) version(rt *Route) string {
+	if rt.Version != "" {
+		return rt.Version
+	}
+	return reg.DefaultVersion
+}
+
+// clientLabel names the client of r for metrics: the name it identified
+// itself with, or else its browser or device class, never anything as
+// varied as the fingerprint.
+func clientLabel(r *http.Request) string {
+	if id := clients.FromContext(r.Context()); id.Name != clients.Anonymous {
+		return id.Name
+	}
+	c := useragent.FromContext(r.Context())
+	if c.Browser != "" {
+		return c.Browser
+	}
+	return c.Device
+}
+
+// Deprecations is middleware that sets API-Version on every registered
+// route's responses, and the Deprecation (RFC 9745), Sunset (RFC 8594),
+// and Link headers on deprecated ones, counting who still calls them. The
+// clients and useragent middleware must run first for the client label to
+// be useful.
+func (reg *Registry) Deprecations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rt := reg.Lookup(r)
+		if rt == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if v := reg.version(rt); v != "" {
+			w.Header().Set("API-Version", v)
+		}
+		if d := rt.Deprecation; d.route() {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+			if !d.Sunset.IsZero() {
+				w.Header().Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Link != "" {
+				w.Header().Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+			}
+			deprecatedRequests.WithLabelValues(rt.Path, clientLabel(r)).Inc()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
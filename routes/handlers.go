@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// bearerScheme names the security scheme of routes with requirements in
+// the OpenAPI document.
+const bearerScheme = "bearer"
+
+// maxSuggestions caps the routes suggested in a 404 response.
+const maxSuggestions = 3
+
+// notFoundBody is the JSON shape of 404 responses for unknown routes.
+type notFoundBody struct {
+	Error       string   `json:"error"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Docs        string   `json:"docs"`
+}
+
+// NotFound responds 404 with registered routes close to the requested
+// path and a link to the OpenAPI document. Install it as the router's
+// NotFoundHandler.
+func (reg *Registry) NotFound(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusNotFound, notFoundBody{
+		Error:       "no route for " + r.Method + " " + r.URL.Path,
+		Suggestions: reg.Suggest(r.URL.Path, maxSuggestions),
+		Docs:        OpenAPIPath,
+	})
+}
+
+// OpenAPI serves a minimal OpenAPI 3 document listing every registered
+// route, for tools and for clients who got a 404.
+func (reg *Registry) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, reg.Document("bazel-demo-app", "dev"))
+}
+
+// Document returns the OpenAPI document for the registered routes.
+func (reg *Registry) Document(title, version string) map[string]interface{} {
+	paths := make(map[string]interface{})
+	secured := false
+	for _, rt := range reg.routes {
+		item, _ := paths[rt.Path].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			if params := pathParams(rt.Path); len(params) > 0 {
+				item["parameters"] = params
+			}
+			paths[rt.Path] = item
+		}
+		for _, m := range rt.Methods {
+			op := map[string]interface{}{"responses": responsesDoc(rt)}
+			if rt.Summary != "" {
+				op["summary"] = rt.Summary
+			}
+			if v := reg.version(rt); v != "" {
+				op["x-api-version"] = v
+			}
+			if d := rt.Deprecation; d != nil {
+				op["deprecated"] = d.route()
+				op["x-deprecation"] = deprecationDoc(d)
+			}
+			if ex := examplesDoc(rt, m); len(ex) > 0 {
+				op["x-examples"] = ex
+			}
+			if len(rt.Requires) > 0 {
+				op["security"] = []map[string][]string{{bearerScheme: rt.Requires}}
+				secured = true
+			}
+			item[strings.ToLower(m)] = op
+		}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": title, "version": version},
+		"paths":   paths,
+	}
+	if secured {
+		doc["components"] = map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				bearerScheme: map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		}
+	}
+	return doc
+}
+
+// deprecationDoc describes d for the OpenAPI document.
+func deprecationDoc(d *Deprecation) map[string]interface{} {
+	doc := map[string]interface{}{"since": d.Since.UTC().Format(time.RFC3339)}
+	if !d.Sunset.IsZero() {
+		doc["sunset"] = d.Sunset.UTC().Format(time.RFC3339)
+	}
+	if d.Link != "" {
+		doc["link"] = d.Link
+	}
+	if len(d.Fields) > 0 {
+		doc["fields"] = d.Fields
+	}
+	return doc
+}
+
+// pathParams returns OpenAPI parameter objects for the {variables} in
+// path.
+func pathParams(path string) []map[string]interface{} {
+	var params []map[string]interface{}
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params = append(params, map[string]interface{}{
+				"name":     strings.Trim(seg, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]string{"type": "string"},
+			})
+		}
+	}
+	return params
+}
@@ -0,0 +1,215 @@
+// Package routes is the route registry. Every route is registered through
+// it, so the set of routes and their metadata can be listed, documented at
+// /openapi.json, and used to help clients who hit a route that doesn't
+// exist.
+package routes
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// OpenAPIPath is where the generated OpenAPI document is served.
+const OpenAPIPath = "/openapi.json"
+
+// Route is one registered path and method set.
+type Route struct {
+	Path    string
+	Methods []string
+	// Summary is a one-line description for the OpenAPI document.
+	Summary string
+	// Accepts lists the media types the route takes request bodies in.
+	// Nil means the registry's DefaultAccepts.
+	Accepts []string
+	// Version is the API version the route belongs to. Empty means the
+	// registry's DefaultVersion.
+	Version string
+	// Deprecation is set once the route or some of its fields are
+	// deprecated.
+	Deprecation *Deprecation
+	// Responses are the JSON response schemas by status, documented and
+	// checked by Contract.
+	Responses map[int]*Schema
+	// Examples are requests documented for the route, which Contract
+	// replays.
+	Examples []Example
+	// Requires lists the roles or scopes, such as admin or greet:write, a
+	// caller's token must grant. The middleware installed with
+	// auth.Verifier.Authorize enforces them.
+	Requires []string
+}
+
+// Registry registers routes on a mux.Router and remembers them.
+type Registry struct {
+	// DefaultAccepts is used for routes that don't declare Accepts.
+	DefaultAccepts []string
+	// DefaultVersion is used for routes that don't declare a Version.
+	DefaultVersion string
+	// Include, when set, limits the routes registered to those whose
+	// path it accepts; Handle drops the rest. See Match.
+	Include func(path string) bool
+
+	router *mux.Router
+	routes []*Route
+	byName map[string]*Route
+}
+
+// New returns a registry that registers routes on router.
+func New(router *mux.Router) *Registry {
+	return &Registry{
+		DefaultAccepts: []string{"application/json"},
+		DefaultVersion: "v1",
+		router:         router,
+		byName:         make(map[string]*Route),
+	}
+}
+
+// Handle registers h for path and methods and returns the route so
+// metadata can be added.
+func (reg *Registry) Handle(path string, h http.HandlerFunc, methods ...string) *Route {
+	rt := &Route{Path: path, Methods: methods}
+	if reg.Include != nil && !reg.Include(path) {
+		// Still return the route, so callers can chain metadata.
+		return rt
+	}
+	name := strings.Join(methods, ",") + " " + path
+	reg.router.HandleFunc(path, h).Methods(methods...).Name(name)
+	reg.routes = append(reg.routes, rt)
+	reg.byName[name] = rt
+	return rt
+}
+
+// Match returns an Include func accepting the paths that match any of
+// patterns. A pattern is a route path such as /greet, a prefix ending in
+// /* such as /admin/* (which also matches /admin), or * for every path.
+// No patterns match every path.
+func Match(patterns ...string) func(path string) bool {
+	return func(path string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, p := range patterns {
+			switch {
+			case p == "*" || p == path:
+				return true
+			case strings.HasSuffix(p, "/*"):
+				prefix := strings.TrimSuffix(p, "*")
+				if strings.HasPrefix(path, prefix) || path == strings.TrimSuffix(prefix, "/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// Describe sets the route's summary.
+func (rt *Route) Describe(summary string) *Route {
+	rt.Summary = summary
+	return rt
+}
+
+// Accept sets the media types the route takes request bodies in.
+func (rt *Route) Accept(types ...string) *Route {
+	rt.Accepts = types
+	return rt
+}
+
+// Require adds roles or scopes the route's callers must be granted.
+func (rt *Route) Require(grants ...string) *Route {
+	rt.Requires = append(rt.Requires, grants...)
+	return rt
+}
+
+// Required returns the roles and scopes the route r matched requires, for
+// auth.Verifier.Authorize.
+func (reg *Registry) Required(r *http.Request) []string {
+	if rt := reg.Lookup(r); rt != nil {
+		return rt.Requires
+	}
+	return nil
+}
+
+// Routes returns every registered route in registration order.
+func (reg *Registry) Routes() []*Route {
+	return append([]*Route(nil), reg.routes...)
+}
+
+// Lookup returns the registered route r matched, or nil if it matched none
+// (or a route registered directly on the router).
+func (reg *Registry) Lookup(r *http.Request) *Route {
+	cur := mux.CurrentRoute(r)
+	if cur == nil {
+		return nil
+	}
+	return reg.byName[cur.GetName()]
+}
+
+// Suggest returns up to n registered paths close to path, closest first.
+// Path variables in a template match any segment, so /greetings/abc is
+// compared against /greetings/{id} as /greetings/abc.
+func (reg *Registry) Suggest(path string, n int) []string {
+	type candidate struct {
+		path string
+		dist int
+	}
+	var found []candidate
+	seen := make(map[string]bool)
+	segs := strings.Split(path, "/")
+	for _, rt := range reg.routes {
+		if seen[rt.Path] {
+			continue
+		}
+		seen[rt.Path] = true
+		d := levenshtein(path, fill(rt.Path, segs))
+		// Allow roughly one typo per four characters, and at least two.
+		if limit := max(2, len(path)/4); d <= limit {
+			found = append(found, candidate{rt.Path, d})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	var out []string
+	for i := 0; i < len(found) && i < n; i++ {
+		out = append(out, found[i].path)
+	}
+	return out
+}
+
+// fill replaces the {variable} segments of tmpl with the request segments
+// at the same position, when both have the same number of segments.
+func fill(tmpl string, segs []string) string {
+	parts := strings.Split(tmpl, "/")
+	if len(parts) != len(segs) {
+		return tmpl
+	}
+	for i, p := range parts {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			parts[i] = segs[i]
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// levenshtein returns the edit distance between a and b in bytes.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
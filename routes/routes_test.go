@@ -0,0 +1,298 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestRegistry() (*mux.Router, *Registry) {
+	router := mux.NewRouter()
+	reg := New(router)
+	noop := func(http.ResponseWriter, *http.Request) {}
+	reg.Handle("/greet", noop, "GET")
+	reg.Handle("/greet-many", noop, "GET", "POST")
+	reg.Handle("/greetings", noop, "GET", "POST")
+	reg.Handle("/greetings/{id}", noop, "GET", "PUT")
+	reg.Handle("/webhooks", noop, "GET")
+	router.NotFoundHandler = http.HandlerFunc(reg.NotFound)
+	return router, reg
+}
+
+// TestSuggest checks typo suggestions, including paths with variables.
+func TestSuggest(t *testing.T) {
+	_, reg := newTestRegistry()
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/greting", []string{"/greetings"}},
+		{"/gret", []string{"/greet"}},
+		{"/greetngs/123", []string{"/greetings/{id}"}},
+		{"/webhook", []string{"/webhooks"}},
+		{"/totally/unrelated", nil},
+	}
+	for _, tt := range tests {
+		if got := reg.Suggest(tt.path, 3); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Suggest(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestNotFound checks the 404 body served for unknown routes.
+func TestNotFound(t *testing.T) {
+	router, _ := newTestRegistry()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/webhook", nil))
+
+	var body notFoundBody
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if rec.Code != http.StatusNotFound || !reflect.DeepEqual(body.Suggestions, []string{"/webhooks"}) || body.Docs != OpenAPIPath {
+		t.Fatalf("GET /webhook = %d %s, want 404 suggesting /webhooks", rec.Code, rec.Body)
+	}
+}
+
+// TestMatch checks route path patterns.
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{nil, "/greet", true},
+		{[]string{"*"}, "/greet", true},
+		{[]string{"/greet"}, "/greet", true},
+		{[]string{"/greet"}, "/greet-many", false},
+		{[]string{"/admin/*"}, "/admin/stats", true},
+		{[]string{"/admin/*"}, "/admin", true},
+		{[]string{"/admin/*"}, "/administrators", false},
+		{[]string{"/metrics", "/admin/*"}, "/metrics", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.patterns...)(tt.path); got != tt.want {
+			t.Errorf("Match(%q)(%q) = %v, want %v", tt.patterns, tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestInclude checks that routes outside Include aren't served or
+// documented.
+func TestInclude(t *testing.T) {
+	router := mux.NewRouter()
+	reg := New(router)
+	reg.Include = Match("/greet")
+	noop := func(http.ResponseWriter, *http.Request) {}
+	reg.Handle("/greet", noop, "GET")
+	reg.Handle("/admin/stats", noop, "GET").Describe("dropped")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/stats", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /admin/stats = %d, want 404", rec.Code)
+	}
+	if got := len(reg.Routes()); got != 1 {
+		t.Errorf("len(Routes()) = %d, want 1", got)
+	}
+}
+
+// TestDocument checks that every method of every route is documented and
+// path variables become parameters.
+func TestDocument(t *testing.T) {
+	_, reg := newTestRegistry()
+	paths := reg.Document("test", "1")["paths"].(map[string]interface{})
+	item := paths["/greetings/{id}"].(map[string]interface{})
+	if _, ok := item["put"]; !ok || len(item["parameters"].([]map[string]interface{})) != 1 {
+		t.Errorf("/greetings/{id} = %v, want put and one parameter", item)
+	}
+	if len(paths) != 5 {
+		t.Errorf("Document() has %d paths, want 5", len(paths))
+	}
+}
+
+// TestRequired checks that requirements are found for the matched route
+// and documented as bearer security.
+func TestRequired(t *testing.T) {
+	router, reg := newTestRegistry()
+	reg.Handle("/admin/stats", func(http.ResponseWriter, *http.Request) {}, "GET").Require("admin")
+	var got []string
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = reg.Required(r)
+			next.ServeHTTP(w, r)
+		})
+	})
+	for _, tt := range []struct {
+		path string
+		want []string
+	}{
+		{"/admin/stats", []string{"admin"}},
+		{"/greet", nil},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Required(GET %s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	doc := reg.Document("test", "1")
+	op := doc["paths"].(map[string]interface{})["/admin/stats"].(map[string]interface{})["get"].(map[string]interface{})
+	if want := []map[string][]string{{"bearer": {"admin"}}}; !reflect.DeepEqual(op["security"], want) {
+		t.Errorf("GET /admin/stats security = %v, want %v", op["security"], want)
+	}
+	if _, ok := doc["components"]; !ok {
+		t.Error("Document() has no components, want the bearer security scheme")
+	}
+}
+
+// TestContentTypes checks that bodies in undeclared media types are
+// rejected before the handler runs, and that per-route overrides apply.
+func TestContentTypes(t *testing.T) {
+	router := mux.NewRouter()
+	reg := New(router)
+	router.Use(reg.ContentTypes)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	reg.Handle("/greetings", ok, "POST")
+	reg.Handle("/greetings/{id}", ok, "PATCH").Accept("application/merge-patch+json")
+
+	tests := []struct {
+		method, target, contentType, body string
+		want                              int
+	}{
+		{"POST", "/greetings", "application/json", "{}", http.StatusNoContent},
+		{"POST", "/greetings", "application/json; charset=utf-8", "{}", http.StatusNoContent},
+		{"POST", "/greetings", "Application/JSON", "{}", http.StatusNoContent},
+		{"POST", "/greetings", "application/x-www-form-urlencoded", "a=b", http.StatusUnsupportedMediaType},
+		{"POST", "/greetings", "", "{}", http.StatusUnsupportedMediaType},
+		{"POST", "/greetings", "", "", http.StatusNoContent},
+		{"PATCH", "/greetings/1", "application/merge-patch+json", "{}", http.StatusNoContent},
+		{"PATCH", "/greetings/1", "application/json", "{}", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s (%q) = %d, want %d", tt.method, tt.target, tt.contentType, rec.Code, tt.want)
+		}
+	}
+
+	req := httptest.NewRequest("PATCH", "/greetings/1", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var body unsupportedBody
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if body.ContentType != "text/plain" || !reflect.DeepEqual(body.Accepted, []string{"application/merge-patch+json"}) ||
+		rec.Header().Get("Accept-Patch") != "application/merge-patch+json" {
+		t.Errorf("PATCH text/plain = %s (Accept-Patch %q), want accepted types listed", rec.Body, rec.Header().Get("Accept-Patch"))
+	}
+}
+
+// TestDeprecations checks the headers on deprecated routes and that
+// field-only deprecations leave them off.
+func TestDeprecations(t *testing.T) {
+	router := mux.NewRouter()
+	reg := New(router)
+	router.Use(reg.Deprecations)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	reg.Handle("/old", ok, "GET").Deprecate(Deprecation{Since: since, Sunset: sunset, Link: "/docs/migrate"})
+	reg.Handle("/fields", ok, "GET").Versioned("v2").Deprecate(Deprecation{Since: since, Fields: []string{"legacy"}})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/old", nil))
+	h := rec.Header()
+	if h.Get("Deprecation") != "@1767225600" || h.Get("Sunset") != "Wed, 01 Jul 2026 00:00:00 GMT" ||
+		h.Get("Link") != `</docs/migrate>; rel="deprecation"` || h.Get("API-Version") != "v1" {
+		t.Errorf("GET /old headers = %v, want Deprecation, Sunset, Link, and API-Version v1", h)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/fields", nil))
+	if h := rec.Header(); h.Get("Deprecation") != "" || h.Get("API-Version") != "v2" {
+		t.Errorf("GET /fields headers = %v, want API-Version v2 and no Deprecation", h)
+	}
+
+	op := reg.Document("test", "1")["paths"].(map[string]interface{})["/fields"].(map[string]interface{})["get"].(map[string]interface{})
+	if op["deprecated"] != false || op["x-deprecation"] == nil {
+		t.Errorf("/fields operation = %v, want field deprecation documented", op)
+	}
+}
+
+// TestValidate checks that values are matched against schemas by type,
+// required properties, and items, with the location of each mismatch.
+func TestValidate(t *testing.T) {
+	schema := &Schema{
+		Type:     "object",
+		Required: []string{"id", "tags"},
+		Properties: map[string]*Schema{
+			"id":    {Type: "string"},
+			"count": {Type: "integer"},
+			"ratio": {Type: "number"},
+			"note":  {Type: "string", Nullable: true},
+			"tags":  {Type: "array", Items: &Schema{Type: "string"}},
+		},
+	}
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{"id":"a","count":2,"ratio":2,"note":null,"tags":["x"]}`, nil},
+		{`{"id":"a","ratio":0.5,"tags":[]}`, nil},
+		{`{"id":1,"tags":["x",2]}`, []string{"$.id: got integer, want string", "$.tags[1]: got integer, want string"}},
+		{`{"count":1.5}`, []string{`$: missing required property "id"`, `$: missing required property "tags"`, "$.count: got number, want integer"}},
+		{`[]`, []string{"$: got array, want object"}},
+		{`null`, []string{"$: got null, want object"}},
+	}
+	for _, tt := range tests {
+		var v any
+		if err := json.Unmarshal([]byte(tt.body), &v); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, err := range Validate(schema, v) {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("Validate(%s) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+// TestContract checks that documented examples are replayed and that a
+// wrong status and a body off its schema are both reported.
+func TestContract(t *testing.T) {
+	router := mux.NewRouter()
+	reg := New(router)
+	item := &Schema{Type: "object", Required: []string{"name"}, Properties: map[string]*Schema{"name": {Type: "string"}}}
+	reg.Handle("/good", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Gladys"}`))
+	}, "GET").Returns(200, item).Example(Example{Name: "ok", Target: "/good", Status: 200})
+	reg.Handle("/bad", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":7}`))
+	}, "GET").Returns(200, item).Example(Example{Name: "ok", Target: "/bad", Status: 200}).
+		Example(Example{Name: "missing", Target: "/bad", Status: 404})
+	reg.Handle(OpenAPIPath, reg.OpenAPI, "GET")
+
+	got, err := Contract(router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`GET /bad: example "ok": $.name: got integer, want string`,
+		`GET /bad: example "missing": status 200, want 404`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Contract() = %q, want %q", got, want)
+	}
+}
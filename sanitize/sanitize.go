@@ -0,0 +1,155 @@
+// Package sanitize escapes and cleans strings before they are echoed back
+// to clients, so user-supplied input can't be used for stored or reflected
+// XSS.
+package sanitize
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Escape strictly escapes s so that it renders as literal text when placed
+// in an HTML document. This is the default for anything a client sent us.
+func Escape(s string) string {
+	return html.EscapeString(s)
+}
+
+// Policy is an allowlist of HTML elements and attributes. Anything not on
+// the list is dropped; the text content of dropped elements is kept, except
+// for elements such as <script> whose content is never safe to render.
+type Policy struct {
+	elements map[string]map[string]bool
+}
+
+// NewPolicy returns a policy that allows no markup at all.
+func NewPolicy() *Policy {
+	return &Policy{elements: make(map[string]map[string]bool)}
+}
+
+// BasicPolicy allows simple inline formatting and links, which is enough
+// for greeting messages and other short rich-text fields.
+func BasicPolicy() *Policy {
+	return NewPolicy().
+		AllowElements("b", "i", "em", "strong", "u", "br", "p", "span", "code").
+		AllowAttrs("a", "href", "title")
+}
+
+// AllowElements adds elements (without attributes) to the policy.
+func (p *Policy) AllowElements(names ...string) *Policy {
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if _, ok := p.elements[name]; !ok {
+			p.elements[name] = make(map[string]bool)
+		}
+	}
+	return p
+}
+
+// AllowAttrs allows element together with the named attributes.
+func (p *Policy) AllowAttrs(element string, attrs ...string) *Policy {
+	p.AllowElements(element)
+	allowed := p.elements[strings.ToLower(element)]
+	for _, attr := range attrs {
+		allowed[strings.ToLower(attr)] = true
+	}
+	return p
+}
+
+// dropContent lists elements whose content is discarded along with the tag.
+var dropContent = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+}
+
+// urlAttrs lists attributes that hold URLs and therefore need their scheme
+// checked.
+var urlAttrs = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"action": true,
+}
+
+// Sanitize parses s as an HTML fragment and re-renders it keeping only the
+// elements and attributes allowed by the policy. Text is always escaped.
+func (p *Policy) Sanitize(s string) string {
+	var b strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(s))
+	skipping := ""
+	depth := 0
+
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			// io.EOF or a malformed tail; either way what we have is safe.
+			return b.String()
+		}
+		tok := z.Token()
+
+		if skipping != "" {
+			switch {
+			case tt == xhtml.StartTagToken && tok.Data == skipping:
+				depth++
+			case tt == xhtml.EndTagToken && tok.Data == skipping:
+				depth--
+				if depth == 0 {
+					skipping = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case xhtml.TextToken:
+			b.WriteString(html.EscapeString(tok.Data))
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if dropContent[tok.Data] {
+				if tt == xhtml.StartTagToken {
+					skipping, depth = tok.Data, 1
+				}
+				continue
+			}
+			allowed, ok := p.elements[tok.Data]
+			if !ok {
+				continue
+			}
+			b.WriteString("<" + tok.Data)
+			for _, attr := range tok.Attr {
+				key := strings.ToLower(attr.Key)
+				if !allowed[key] || (urlAttrs[key] && !safeURL(attr.Val)) {
+					continue
+				}
+				b.WriteString(" " + key + `="` + html.EscapeString(attr.Val) + `"`)
+			}
+			if tt == xhtml.SelfClosingTagToken {
+				b.WriteString("/")
+			}
+			b.WriteString(">")
+		case xhtml.EndTagToken:
+			if _, ok := p.elements[tok.Data]; ok {
+				b.WriteString("</" + tok.Data + ">")
+			}
+		}
+	}
+}
+
+// safeURL reports whether u is relative or uses a scheme that can't run
+// script.
+func safeURL(u string) bool {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
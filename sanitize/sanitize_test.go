@@ -0,0 +1,33 @@
+package sanitize
+
+import "testing"
+
+// TestEscape checks that markup in plain text is neutralised.
+func TestEscape(t *testing.T) {
+	got := Escape(`<script>alert("x")</script>`)
+	want := `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;`
+	if got != want {
+		t.Fatalf(`Escape(script) = %q, want %q`, got, want)
+	}
+}
+
+// TestBasicPolicy runs fragments through BasicPolicy, checking that allowed
+// formatting survives and everything else is stripped.
+func TestBasicPolicy(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`Hi, <b>Gladys</b>!`, `Hi, <b>Gladys</b>!`},
+		{`<script>alert(1)</script>Gladys`, `Gladys`},
+		{`<img src=x onerror=alert(1)>Gladys`, `Gladys`},
+		{`<a href="javascript:alert(1)" onclick="x()">link</a>`, `<a>link</a>`},
+		{`<a href="https://example.com" title="t">link</a>`, `<a href="https://example.com" title="t">link</a>`},
+		{`<div>1 < 2</div>`, `1 &lt; 2`},
+	}
+	p := BasicPolicy()
+	for _, tt := range tests {
+		if got := p.Sanitize(tt.in); got != tt.want {
+			t.Errorf(`Sanitize(%q) = %q, want %q`, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCronNext checks next-run calculation, including schedules in a
+// non-UTC time zone across a DST change.
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no tzdata: %v", err)
+	}
+	from := time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"*/15 * * * *", time.UTC, time.Date(2024, 3, 30, 12, 15, 0, 0, time.UTC)},
+		{"@daily", time.UTC, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", berlin, time.Date(2024, 3, 31, 9, 0, 0, 0, berlin)},
+		{"30 2 * * *", berlin, time.Date(2024, 4, 1, 2, 30, 0, 0, berlin)},
+		{"0 0 1 * 1", time.UTC, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec, tt.loc)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error: %v", tt.spec, err)
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("ParseCron(%q, %v).Next = %v, want %v", tt.spec, tt.loc, got, tt.want)
+		}
+	}
+}
+
+// TestParseCronInvalid checks that malformed expressions are rejected.
+func TestParseCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(spec, nil); err == nil {
+			t.Errorf("ParseCron(%q) = nil error, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package schedule runs background jobs on cron schedules. Each job has
+// its own time zone, so "0 9 * * *" can mean 09:00 in Berlin for one job
+// and 09:00 in New York for another.
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Job is a named function run on a schedule.
+type Job struct {
+	Name string
+	Cron *Cron
+	Run  func(ctx context.Context) error
+}
+
+// Scheduler runs registered jobs until its context is canceled.
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs []Job
+	now  func() time.Time
+}
+
+// New returns an empty Scheduler.
+func New() *Scheduler {
+	return &Scheduler{now: time.Now}
+}
+
+// Add registers a job. Jobs added after Start are not picked up.
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+}
+
+// Jobs returns the registered jobs with their next run time.
+func (s *Scheduler) Jobs() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[string]time.Time, len(s.jobs))
+	for _, job := range s.jobs {
+		next[job.Name] = job.Cron.Next(s.now())
+	}
+	return next
+}
+
+// Start runs every registered job in its own goroutine and returns
+// immediately. The goroutines exit when ctx is canceled; wait on the
+// returned WaitGroup to know when they are done.
+func (s *Scheduler) Start(ctx context.Context) *sync.WaitGroup {
+	s.mu.Lock()
+	jobs := append([]Job(nil), s.jobs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	return &wg
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	log := logrus.WithField("job", job.Name)
+	for {
+		next := job.Cron.Next(s.now())
+		if next.IsZero() {
+			log.Warn("schedule never fires again; stopping job")
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		start := s.now()
+		if err := job.Run(ctx); err != nil {
+			log.WithError(err).Error("job failed")
+		} else {
+			log.WithField("duration", time.Since(start)).Debug("job finished")
+		}
+	}
+}
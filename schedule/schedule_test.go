@@ -0,0 +1,41 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// TestSchedulerStop checks that canceling the context stops every job
+// goroutine.
+func TestSchedulerStop(t *testing.T) {
+	c, err := ParseCron("* * * * *", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New()
+	for _, name := range []string{"a", "b"} {
+		s.Add(Job{Name: name, Cron: c, Run: func(context.Context) error { return nil }})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := s.Start(ctx)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler goroutines still running after cancel")
+	}
+}
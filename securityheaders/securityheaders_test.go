@@ -0,0 +1,39 @@
+package securityheaders
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestMiddleware checks that the configured headers are set, that empty
+// ones are left out, and that handlers can override them.
+func TestMiddleware(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.ReferrerPolicy = ""
+	h := Middleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/embed" {
+			w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/greet", nil))
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         DefaultFrameOptions,
+		"Referrer-Policy":         "",
+		"Content-Security-Policy": DefaultContentSecurityPolicy,
+	}
+	for k, v := range want {
+		if got := rec.Header().Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/embed", nil))
+	if got := rec.Header().Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("X-Frame-Options set by the handler = %q, want SAMEORIGIN", got)
+	}
+}
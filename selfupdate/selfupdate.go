@@ -0,0 +1,225 @@
+// Package selfupdate replaces the running binary with a newer release, for
+// bare-metal deployments without an orchestrator to do it.
+//
+// Releases are described by a manifest per channel at
+// <base URL>/<channel>.json:
+//
+//	{
+//	  "version": "v1.4.0",
+//	  "binaries": {
+//	    "linux/amd64": {
+//	      "url": "https://releases.example.com/v1.4.0/app-linux-amd64",
+//	      "sha256": "9f86d081...",
+//	      "signature": "base64 Ed25519 signature"
+//	    }
+//	  }
+//	}
+//
+// The signature covers SignedMessage(version, platform, sha256), so a
+// manifest can't pair a signed digest with another version or platform.
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// MaxBinarySize caps downloads, so a bad manifest can't fill the disk.
+const MaxBinarySize = 512 << 20
+
+// maxManifestSize caps manifest downloads.
+const maxManifestSize = 1 << 20
+
+// ErrUpToDate is returned by Update when the channel's version is the one
+// running.
+var ErrUpToDate = errors.New("selfupdate: already up to date")
+
+// ErrNoPublicKey is returned by Check and Update for updaters with
+// neither a PublicKey nor InsecureSkipSignature.
+var ErrNoPublicKey = errors.New("selfupdate: no public key to verify release signatures with")
+
+// Binary is one platform's build in a manifest.
+type Binary struct {
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Manifest describes the current release of a channel.
+type Manifest struct {
+	Version string `json:"version"`
+	// Binaries are keyed by GOOS/GOARCH.
+	Binaries map[string]Binary `json:"binaries"`
+}
+
+// Platform returns the manifest key of the running binary.
+func Platform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// SignedMessage is what release signatures sign.
+func SignedMessage(version, platform, sha256Hex string) []byte {
+	return []byte("bazel-demo-app release\n" + version + "\n" + platform + "\n" + strings.ToLower(sha256Hex) + "\n")
+}
+
+// Updater fetches and installs releases.
+type Updater struct {
+	// BaseURL is where channel manifests are served.
+	BaseURL string
+	// PublicKey verifies release signatures. Without one, releases are
+	// refused unless InsecureSkipSignature is set.
+	PublicKey ed25519.PublicKey
+	// InsecureSkipSignature accepts releases without a PublicKey,
+	// verifying only their checksum: that protects against corrupt
+	// downloads but not against a compromised release server.
+	InsecureSkipSignature bool
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (u *Updater) client() *http.Client {
+	if u.Client != nil {
+		return u.Client
+	}
+	return http.DefaultClient
+}
+
+// Check fetches the manifest of channel and returns it with this
+// platform's binary.
+func (u *Updater) Check(ctx context.Context, channel string) (Manifest, Binary, error) {
+	if channel == "" || strings.ContainsAny(channel, "/\\.") {
+		return Manifest{}, Binary{}, fmt.Errorf("selfupdate: invalid channel %q", channel)
+	}
+	manifestURL, err := url.JoinPath(u.BaseURL, channel+".json")
+	if err != nil {
+		return Manifest{}, Binary{}, fmt.Errorf("selfupdate: %w", err)
+	}
+	body, err := u.get(ctx, manifestURL)
+	if err != nil {
+		return Manifest{}, Binary{}, err
+	}
+	defer body.Close()
+	var m Manifest
+	if err := json.NewDecoder(io.LimitReader(body, maxManifestSize)).Decode(&m); err != nil {
+		return Manifest{}, Binary{}, fmt.Errorf("selfupdate: %s: %w", manifestURL, err)
+	}
+	b, ok := m.Binaries[Platform()]
+	if !ok {
+		return m, Binary{}, fmt.Errorf("selfupdate: release %s has no %s binary", m.Version, Platform())
+	}
+	if _, err := hex.DecodeString(b.SHA256); err != nil || len(b.SHA256) != sha256.Size*2 {
+		return m, Binary{}, fmt.Errorf("selfupdate: release %s: invalid sha256 %q", m.Version, b.SHA256)
+	}
+	if err := u.verify(m.Version, b); err != nil {
+		return m, Binary{}, err
+	}
+	return m, b, nil
+}
+
+// verify checks b's signature, or returns ErrNoPublicKey if there is no
+// key to check it with and u doesn't skip it.
+func (u *Updater) verify(version string, b Binary) error {
+	if u.PublicKey == nil {
+		if u.InsecureSkipSignature {
+			return nil
+		}
+		return ErrNoPublicKey
+	}
+	sig, err := base64.StdEncoding.DecodeString(b.Signature)
+	if err != nil || !ed25519.Verify(u.PublicKey, SignedMessage(version, Platform(), b.SHA256), sig) {
+		return fmt.Errorf("selfupdate: release %s: bad or missing signature", version)
+	}
+	return nil
+}
+
+func (u *Updater) get(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("selfupdate: %w", err)
+	}
+	resp, err := u.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("selfupdate: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("selfupdate: %s: %s", rawURL, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Update installs the channel's release over the executable at target
+// unless current is already that version, in which case it returns
+// ErrUpToDate. The new binary is downloaded next to target, verified, and
+// renamed over it, so target is never left half-written. It returns the
+// version installed.
+func (u *Updater) Update(ctx context.Context, channel, current, target string) (string, error) {
+	m, b, err := u.Check(ctx, channel)
+	if err != nil {
+		return "", err
+	}
+	if current != "" && m.Version == current {
+		return m.Version, ErrUpToDate
+	}
+	if err := u.Install(ctx, b, target); err != nil {
+		return "", err
+	}
+	return m.Version, nil
+}
+
+// Install downloads b, checks its SHA-256, and atomically replaces target
+// with it, keeping target's file mode.
+func (u *Updater) Install(ctx context.Context, b Binary, target string) error {
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("selfupdate: %w", err)
+	}
+	body, err := u.get(ctx, b.URL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".update-*")
+	if err != nil {
+		return fmt.Errorf("selfupdate: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(body, MaxBinarySize+1))
+	if err == nil && n > MaxBinarySize {
+		err = fmt.Errorf("binary is larger than %d bytes", MaxBinarySize)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("selfupdate: downloading %s: %w", b.URL, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, b.SHA256) {
+		return fmt.Errorf("selfupdate: %s: sha256 %s, want %s", b.URL, got, b.SHA256)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("selfupdate: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("selfupdate: replacing %s: %w", target, err)
+	}
+	return nil
+}
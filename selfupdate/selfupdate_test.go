@@ -0,0 +1,93 @@
+package selfupdate
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestUpdate installs a signed release and checks that bad checksums and
+// signatures, and updaters without a key, are refused without touching the
+// target.
+func TestUpdate(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	newBinary := []byte("new binary")
+	sum := sha256.Sum256(newBinary)
+	digest := hex.EncodeToString(sum[:])
+
+	var manifest Manifest
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stable.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(manifest)
+	})
+	mux.HandleFunc("/bin", func(w http.ResponseWriter, r *http.Request) { w.Write(newBinary) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	setRelease := func(sha string, signer ed25519.PrivateKey) {
+		sig := ed25519.Sign(signer, SignedMessage("v2", Platform(), sha))
+		manifest = Manifest{Version: "v2", Binaries: map[string]Binary{
+			Platform(): {URL: srv.URL + "/bin", SHA256: sha, Signature: base64.StdEncoding.EncodeToString(sig)},
+		}}
+	}
+	target := filepath.Join(t.TempDir(), "app")
+	os.WriteFile(target, []byte("old binary"), 0o755)
+	u := &Updater{BaseURL: srv.URL, PublicKey: pub}
+	ctx := context.Background()
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	setRelease(digest, otherKey)
+	if _, err := u.Update(ctx, "stable", "v1", target); err == nil {
+		t.Error("Update with a foreign signature succeeded, want an error")
+	}
+	wrong := sha256.Sum256([]byte("something else"))
+	setRelease(hex.EncodeToString(wrong[:]), priv)
+	if _, err := u.Update(ctx, "stable", "v1", target); err == nil {
+		t.Error("Update with a wrong checksum succeeded, want an error")
+	}
+	setRelease(digest, priv)
+	unkeyed := &Updater{BaseURL: srv.URL}
+	if _, err := unkeyed.Update(ctx, "stable", "v1", target); !errors.Is(err, ErrNoPublicKey) {
+		t.Errorf("Update without a public key = %v, want ErrNoPublicKey", err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "old binary" {
+		t.Fatalf("target after failed updates = %q, want it untouched", got)
+	}
+
+	setRelease(digest, priv)
+	if _, err := u.Update(ctx, "stable", "v2", target); err != ErrUpToDate {
+		t.Errorf("Update at the same version = %v, want ErrUpToDate", err)
+	}
+	if v, err := u.Update(ctx, "stable", "v1", target); err != nil || v != "v2" {
+		t.Fatalf("Update = %q, %v, want v2", v, err)
+	}
+	got, _ := os.ReadFile(target)
+	info, _ := os.Stat(target)
+	if string(got) != "new binary" || info.Mode().Perm() != 0o755 {
+		t.Errorf("target = %q mode %v, want the new binary, executable", got, info.Mode())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+		t.Errorf("directory has %d entries, want no leftover temp files", len(entries))
+	}
+
+	unsigned := filepath.Join(t.TempDir(), "app")
+	os.WriteFile(unsigned, []byte("old binary"), 0o755)
+	manifest.Binaries[Platform()] = Binary{URL: srv.URL + "/bin", SHA256: digest}
+	unkeyed.InsecureSkipSignature = true
+	if v, err := unkeyed.Update(ctx, "stable", "v1", unsigned); err != nil || v != "v2" {
+		t.Errorf("Update skipping signatures = %q, %v, want v2", v, err)
+	}
+
+	if _, _, err := u.Check(ctx, "../etc"); err == nil {
+		t.Error("Check(../etc) succeeded, want an invalid channel error")
+	}
+}
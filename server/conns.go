@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// Connection metrics. They are not labelled by client IP, which would make
+// a series per client; server_connection_ips counts them instead.
+var (
+	accepted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_connections_accepted_total",
+		Help: "Connections accepted, by listener and the address family of the client.",
+	}, []string{"listener", "family"})
+	openConns = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "server_open_connections",
+		Help: "Connections open, by listener.",
+	}, []string{"listener"})
+	connIPs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "server_connection_ips",
+		Help: "Distinct client IPs with a connection open, by listener.",
+	}, []string{"listener"})
+	rejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_connections_rejected_total",
+		Help: "Connections closed on accept because their client IP was at max_connections_per_ip, by listener.",
+	}, []string{"listener"})
+	handshakeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_tls_handshake_errors_total",
+		Help: "TLS handshakes that failed, by listener.",
+	}, []string{"listener"})
+)
+
+// trackingListener counts connections by listener and client IP, closing
+// those that would take an IP over maxPerIP.
+type trackingListener struct {
+	net.Listener
+	name string
+	// maxPerIP is the cap on open connections per client IP; zero means
+	// no cap.
+	maxPerIP int
+
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+func newTrackingListener(l net.Listener, name string, maxPerIP int) *trackingListener {
+	return &trackingListener{Listener: l, name: name, maxPerIP: maxPerIP, perIP: make(map[string]int)}
+}
+
+// clientIP returns the IP part of addr, or the whole address for
+// non-IP networks.
+func clientIP(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	return addr.String()
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := clientIP(conn.RemoteAddr())
+		if !l.add(ip) {
+			rejected.WithLabelValues(l.name).Inc()
+			logrus.WithFields(logrus.Fields{"listener": l.name, "ip": ip}).Debug("connection limit reached; closing")
+			conn.Close()
+			continue
+		}
+		accepted.WithLabelValues(l.name, Family(conn.RemoteAddr())).Inc()
+		return &trackedConn{Conn: conn, release: func() { l.remove(ip) }}, nil
+	}
+}
+
+// add counts a connection from ip, reporting false instead if ip is at
+// the cap.
+func (l *trackingListener) add(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return false
+	}
+	l.perIP[ip]++
+	openConns.WithLabelValues(l.name).Inc()
+	connIPs.WithLabelValues(l.name).Set(float64(len(l.perIP)))
+	return true
+}
+
+func (l *trackingListener) remove(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+	openConns.WithLabelValues(l.name).Dec()
+	connIPs.WithLabelValues(l.name).Set(float64(len(l.perIP)))
+}
+
+// connections returns the open connections from ip.
+func (l *trackingListener) connections(ip string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.perIP[ip]
+}
+
+// trackedConn releases its count when closed, however many times Close is
+// called.
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// errorLog returns the error log for a listener's http.Server. It counts
+// TLS handshake failures, which net/http only reports there, and passes
+// everything on to logrus.
+func errorLog(name string) *log.Logger {
+	return log.New(errorLogWriter{name}, "", 0)
+}
+
+type errorLogWriter struct {
+	name string
+}
+
+func (w errorLogWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimSpace(p))
+	entry := logrus.WithField("listener", w.name)
+	if bytes.HasPrefix(p, []byte("http: TLS handshake error")) {
+		handshakeErrors.WithLabelValues(w.name).Inc()
+		// Scanners and clients with old TLS stacks make these common.
+		entry.Debug(msg)
+	} else {
+		entry.Warn(msg)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestTrackingListener checks that connections over the per-IP cap are
+// closed on accept, and that closing one makes room for another.
+func TestTrackingListener(t *testing.T) {
+	inner, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTrackingListener(inner, "test", 2)
+	defer l.Close()
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	dial := func() net.Conn {
+		t.Helper()
+		c, err := net.Dial("tcp4", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	first, second := dial(), dial()
+	defer second.Close()
+	a, b := <-conns, <-conns
+	defer b.Close()
+	if got := l.connections("127.0.0.1"); got != 2 {
+		t.Errorf("connections(127.0.0.1) = %d, want 2", got)
+	}
+
+	third := dial()
+	defer third.Close()
+	third.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := third.Read(make([]byte, 1)); err == nil {
+		t.Error("third connection was kept open, want it closed")
+	}
+
+	first.Close()
+	a.Close()
+	a.Close()
+	if got := l.connections("127.0.0.1"); got != 1 {
+		t.Errorf("connections(127.0.0.1) after close = %d, want 1", got)
+	}
+	fourth := dial()
+	defer fourth.Close()
+	select {
+	case c := <-conns:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Error("connection after a close was not accepted")
+	}
+}
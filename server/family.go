@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Address families, as reported in metrics.
+const (
+	IPv4 = "ipv4"
+	IPv6 = "ipv6"
+	// Dual is a listener on the IPv6 wildcard that also accepts IPv4
+	// connections as IPv4-mapped addresses.
+	Dual = "dual"
+	Unix = "unix"
+)
+
+var listenerInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "server_listener_info",
+	Help: "Listeners being served, by name, address and address family.",
+}, []string{"listener", "address", "family"})
+
+// network returns the network c listens on: tcp unless Network says
+// otherwise.
+func (c Config) network() string {
+	if c.Network == "" {
+		return "tcp"
+	}
+	return c.Network
+}
+
+// validateAddress checks that c's address is host:port with a numeric
+// port and, if the host is an IP literal, that it belongs to c's network.
+// IPv6 literals must be bracketed, as in "[::1]:5000".
+func (c Config) validateAddress() error {
+	network := c.network()
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("network %q is not tcp, tcp4 or tcp6", network)
+	}
+	host, port, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return fmt.Errorf("address %q: %w", c.Address, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("address %q: port %q is not a number from 0 to 65535", c.Address, port)
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		// Empty, or a name resolved when listening.
+	case network == "tcp4" && ip.To4() == nil:
+		return fmt.Errorf("address %q: %s is not an IPv4 address", c.Address, host)
+	case network == "tcp6" && ip.To4() != nil:
+		return fmt.Errorf("address %q: %s is not an IPv6 address", c.Address, host)
+	}
+	return nil
+}
+
+// listenerFamily returns the family a listener bound to addr on network
+// accepts. Go binds tcp listeners on the IPv6 wildcard, which is what an
+// empty host becomes, as dual-stack where the platform allows it; tcp6
+// listeners are IPv6 only.
+func listenerFamily(network string, addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		if addr.Network() == "unix" {
+			return Unix
+		}
+		return addr.Network()
+	}
+	switch {
+	case tcp.IP.To4() != nil:
+		return IPv4
+	case tcp.IP.IsUnspecified() && network != "tcp6":
+		return Dual
+	default:
+		return IPv6
+	}
+}
+
+// Family returns the address family of a client address. IPv4-mapped IPv6
+// addresses, which dual-stack listeners report IPv4 clients as, are IPv4.
+func Family(addr net.Addr) string {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		if tcp.IP.To4() != nil {
+			return IPv4
+		}
+		return IPv6
+	}
+	if addr.Network() == "unix" {
+		return Unix
+	}
+	return addr.Network()
+}
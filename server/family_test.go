@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// TestValidateAddress checks address and network combinations, including
+// bracketed IPv6 literals.
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		network, address string
+		want             string
+	}{
+		{"", ":5000", ""},
+		{"", "0.0.0.0:5000", ""},
+		{"", "[::]:5000", ""},
+		{"", "[::1]:5000", ""},
+		{"", "[fe80::1%eth0]:5000", ""},
+		{"", "localhost:5000", ""},
+		{"tcp4", "127.0.0.1:5000", ""},
+		{"tcp6", "[::1]:5000", ""},
+		{"tcp6", ":5000", ""},
+		{"", "::1:5000", "too many colons"},
+		{"", "[::1]", "missing port"},
+		{"", "127.0.0.1", "missing port"},
+		{"", ":http", "not a number"},
+		{"", ":70000", "not a number"},
+		{"tcp4", "[::1]:5000", "not an IPv4 address"},
+		{"tcp6", "127.0.0.1:5000", "not an IPv6 address"},
+		{"tcp6", "[::ffff:127.0.0.1]:5000", "not an IPv6 address"},
+		{"udp", ":5000", "not tcp"},
+	}
+	for _, tt := range tests {
+		c := Config{Name: "a", Network: tt.network, Address: tt.address}
+		err := Validate([]Config{c})
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("Validate(%s %s) = %v, want %q", tt.network, tt.address, err, tt.want)
+		}
+	}
+}
+
+// TestFamily checks how client and listener addresses are classified.
+func TestFamily(t *testing.T) {
+	tests := []struct {
+		network string
+		addr    net.Addr
+		client  string
+		bound   string
+	}{
+		{"tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")}, IPv4, IPv4},
+		{"tcp", &net.TCPAddr{IP: net.ParseIP("::ffff:10.0.0.1")}, IPv4, IPv4},
+		{"tcp", &net.TCPAddr{IP: net.ParseIP("::1")}, IPv6, IPv6},
+		{"tcp", &net.TCPAddr{IP: net.IPv6unspecified}, IPv6, Dual},
+		{"tcp6", &net.TCPAddr{IP: net.IPv6unspecified}, IPv6, IPv6},
+		{"tcp", &net.TCPAddr{IP: net.IPv4zero}, IPv4, IPv4},
+		{"unix", &net.UnixAddr{Name: "/run/app.sock", Net: "unix"}, Unix, Unix},
+	}
+	for _, tt := range tests {
+		if got := Family(tt.addr); got != tt.client {
+			t.Errorf("Family(%v) = %s, want %s", tt.addr, got, tt.client)
+		}
+		if got := listenerFamily(tt.network, tt.addr); got != tt.bound {
+			t.Errorf("listenerFamily(%s, %v) = %s, want %s", tt.network, tt.addr, got, tt.bound)
+		}
+	}
+}
+
+// TestOpenFamilies listens on each kind of address and checks which
+// families it accepts. Families the host lacks are skipped.
+func TestOpenFamilies(t *testing.T) {
+	tests := []struct {
+		network, address string
+		family           string
+		dial             map[string]bool // loopback address -> accepted
+	}{
+		{"tcp4", "127.0.0.1:0", IPv4, map[string]bool{"127.0.0.1": true}},
+		{"tcp6", "[::1]:0", IPv6, map[string]bool{"::1": true}},
+		{"tcp6", "[::]:0", IPv6, map[string]bool{"::1": true, "127.0.0.1": false}},
+		{"tcp", ":0", Dual, map[string]bool{"::1": true, "127.0.0.1": true}},
+	}
+	for _, tt := range tests {
+		l, err := Open(Config{Name: "a", Network: tt.network, Address: tt.address}, nil)
+		if err != nil {
+			t.Logf("Open(%s %s): %v; skipping", tt.network, tt.address, err)
+			continue
+		}
+		if l.Family != tt.family {
+			// A platform without dual-stack sockets binds the wildcard
+			// as IPv4 only.
+			if tt.family == Dual && l.Family == IPv4 {
+				l.Listener.Close()
+				continue
+			}
+			t.Errorf("Open(%s %s).Family = %s, want %s", tt.network, tt.address, l.Family, tt.family)
+		}
+		go func() {
+			for {
+				conn, err := l.Listener.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		_, port, _ := net.SplitHostPort(l.Listener.Addr().String())
+		for host, want := range tt.dial {
+			if host == "::1" && !hasIPv6Loopback() {
+				continue
+			}
+			conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+			if got := err == nil; got != want {
+				t.Errorf("%s %s: dial %s accepted = %v, want %v", tt.network, tt.address, host, got, want)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		}
+		l.Listener.Close()
+	}
+}
+
+// hasIPv6Loopback reports whether ::1 can be listened on.
+func hasIPv6Loopback() bool {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
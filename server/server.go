@@ -0,0 +1,253 @@
+// Package server runs the process's HTTP listeners together: each with
+// its own address, TLS settings and handler, started at once and shut
+// down gracefully at once.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultName names the listener used when none are configured.
+const DefaultName = "default"
+
+// TLSConfig locates a listener's certificate. Setting ClientCAFile
+// requires clients to present a certificate signed by one of its CAs.
+type TLSConfig struct {
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// Enabled reports whether c asks for TLS.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Check reports settings that would fail to load: a certificate without
+// a key or the other way round, and files that don't exist.
+func (c TLSConfig) Check() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("tls needs both cert_file and key_file")
+	}
+	for _, f := range []struct{ key, path string }{
+		{"cert_file", c.CertFile},
+		{"key_file", c.KeyFile},
+		{"client_ca_file", c.ClientCAFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return fmt.Errorf("tls %s: %w", f.key, err)
+		}
+	}
+	return nil
+}
+
+// Load reads the files c names.
+func (c TLSConfig) Load() (*tls.Config, error) {
+	if err := c.Check(); err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", c.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// Config declares a listener.
+type Config struct {
+	Name string `mapstructure:"name"`
+	// Address is host:port, with IPv6 literals bracketed: "[::1]:5000".
+	// An empty host listens on every interface, dual-stack where the
+	// platform supports it; "0.0.0.0" is IPv4 only.
+	Address string `mapstructure:"address"`
+	// Network is tcp (the default), or tcp4 or tcp6 to listen on one
+	// address family only.
+	Network string `mapstructure:"network"`
+	// Routes limits the listener to some routes; see routes.Match. Empty
+	// serves every route.
+	Routes []string  `mapstructure:"routes"`
+	TLS    TLSConfig `mapstructure:"tls"`
+	// ReadTimeout bounds reading a whole request, and WriteTimeout writing
+	// a response. Zero means no limit. A write timeout also cuts off
+	// streams, so leave it unset on listeners serving /changes.
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// MaxConnsPerIP caps the connections open from one client IP; further
+	// ones are closed as soon as they are accepted. Zero means no cap.
+	MaxConnsPerIP int `mapstructure:"max_connections_per_ip"`
+}
+
+// Validate checks a set of listener declarations.
+func Validate(configs []Config) error {
+	names := make(map[string]bool)
+	for i, c := range configs {
+		switch {
+		case c.Name == "":
+			return fmt.Errorf("listeners[%d]: name is required", i)
+		case names[c.Name]:
+			return fmt.Errorf("listeners[%d]: duplicate name %q", i, c.Name)
+		case c.Address == "":
+			return fmt.Errorf("listener %s: address is required", c.Name)
+		case c.MaxConnsPerIP < 0:
+			return fmt.Errorf("listener %s: max_connections_per_ip is negative", c.Name)
+		}
+		if err := c.validateAddress(); err != nil {
+			return fmt.Errorf("listener %s: %w", c.Name, err)
+		}
+		if c.TLS.Enabled() {
+			if err := c.TLS.Check(); err != nil {
+				return fmt.Errorf("listener %s: %w", c.Name, err)
+			}
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// Listener is a socket with what to serve on it.
+type Listener struct {
+	Name     string
+	Listener net.Listener
+	Handler  http.Handler
+	// Family is the address family the listener accepts: IPv4, IPv6 or
+	// Dual. When empty, Serve works it out from the listener's address.
+	Family string
+	// TLS, when set, makes the listener serve HTTPS.
+	TLS           *tls.Config
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	MaxConnsPerIP int
+}
+
+// Open listens on c's address with h, loading c's TLS settings.
+func Open(c Config, h http.Handler) (Listener, error) {
+	var tlsConfig *tls.Config
+	if c.TLS.Enabled() {
+		var err error
+		if tlsConfig, err = c.TLS.Load(); err != nil {
+			return Listener{}, fmt.Errorf("listener %s: %w", c.Name, err)
+		}
+	}
+	l, err := net.Listen(c.network(), c.Address)
+	if err != nil {
+		return Listener{}, fmt.Errorf("listener %s: %w", c.Name, err)
+	}
+	return Listener{
+		Name:          c.Name,
+		Listener:      l,
+		Handler:       h,
+		Family:        listenerFamily(c.network(), l.Addr()),
+		TLS:           tlsConfig,
+		ReadTimeout:   c.ReadTimeout,
+		WriteTimeout:  c.WriteTimeout,
+		MaxConnsPerIP: c.MaxConnsPerIP,
+	}, nil
+}
+
+// Addr describes l for logs: its address, with https:// when it uses TLS.
+func (l Listener) Addr() string {
+	if l.TLS != nil {
+		return "https://" + l.Listener.Addr().String()
+	}
+	return l.Listener.Addr().String()
+}
+
+// drainingKey is the context key of the channel Draining returns.
+type drainingKey struct{}
+
+// Draining returns a channel that is closed when the server handling the
+// request ctx belongs to starts shutting down. Long-lived responses such
+// as event streams should end when it closes, since shutdown waits for
+// them; ordinary requests can ignore it and finish. Outside Serve it
+// returns nil, which never becomes ready.
+func Draining(ctx context.Context) <-chan struct{} {
+	ch, _ := ctx.Value(drainingKey{}).(chan struct{})
+	return ch
+}
+
+// Serve serves every listener until ctx is done or one of them fails, then
+// shuts them all down. Requests in flight get up to timeout to finish,
+// with their contexts intact; streams are told to end through Draining.
+// It returns the first listener error, or nil after a requested shutdown.
+func Serve(ctx context.Context, timeout time.Duration, listeners ...Listener) error {
+	draining := make(chan struct{})
+	base := context.WithValue(context.Background(), drainingKey{}, draining)
+	servers := make([]*http.Server, len(listeners))
+	serveErr := make(chan error, len(listeners))
+	for i, l := range listeners {
+		s := &http.Server{
+			Handler:      l.Handler,
+			TLSConfig:    l.TLS,
+			ReadTimeout:  l.ReadTimeout,
+			WriteTimeout: l.WriteTimeout,
+			ErrorLog:     errorLog(l.Name),
+			BaseContext:  func(net.Listener) context.Context { return base },
+		}
+		servers[i] = s
+		family := l.Family
+		if family == "" {
+			family = listenerFamily("tcp", l.Listener.Addr())
+		}
+		listenerInfo.WithLabelValues(l.Name, l.Listener.Addr().String(), family).Set(1)
+		go func(name string, ln net.Listener) {
+			var err error
+			if s.TLSConfig != nil {
+				// The certificates are already in TLSConfig.
+				err = s.ServeTLS(ln, "", "")
+			} else {
+				err = s.Serve(ln)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				err = fmt.Errorf("listener %s: %w", name, err)
+			}
+			serveErr <- err
+		}(l.Name, newTrackingListener(l.Listener, l.Name, l.MaxConnsPerIP))
+	}
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+	}
+	logrus.WithField("timeout", timeout).Info("shutting down; draining requests")
+	close(draining)
+	// ctx may be done already, so shutdown gets its own.
+	sctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for i, s := range servers {
+		if serr := s.Shutdown(sctx); serr != nil {
+			logrus.WithError(serr).WithField("listener", listeners[i].Name).Warn("closing connections")
+			s.Close()
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidate checks listener declarations.
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		configs []Config
+		want    string
+	}{
+		{[]Config{{Name: "public", Address: ":5000"}, {Name: "admin", Address: "127.0.0.1:9000"}}, ""},
+		{[]Config{{Address: ":5000"}}, "name is required"},
+		{[]Config{{Name: "a", Address: ":1"}, {Name: "a", Address: ":2"}}, "duplicate name"},
+		{[]Config{{Name: "a"}}, "address is required"},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.configs)
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("Validate(%+v) = %v, want %q", tt.configs, err, tt.want)
+		}
+	}
+}
+
+// TestServe checks that each listener serves its own handler and that
+// cancelling the context shuts them all down, letting in-flight requests
+// finish and ending open streams.
+func TestServe(t *testing.T) {
+	started := make(chan struct{}, 1)
+	handler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/stream":
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				<-Draining(r.Context())
+				return
+			case "/slow":
+				started <- struct{}{}
+				select {
+				case <-time.After(200 * time.Millisecond):
+				case <-r.Context().Done():
+					http.Error(w, "cancelled", http.StatusServiceUnavailable)
+					return
+				}
+			}
+			io.WriteString(w, body)
+		})
+	}
+	var listeners []Listener
+	for _, name := range []string{"public", "admin"} {
+		l, err := Open(Config{Name: name, Address: "127.0.0.1:0"}, handler(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, l)
+	}
+	public := "http://" + listeners[0].Listener.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, 5*time.Second, listeners...) }()
+
+	for _, l := range listeners {
+		resp, err := http.Get("http://" + l.Listener.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != l.Name {
+			t.Errorf("GET %s = %q, want %q", l.Name, body, l.Name)
+		}
+	}
+	stream, err := http.Get(public + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(public + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- string(body)
+	}()
+	<-started
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() = %v, want nil after cancel", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Serve() still running after cancel with an open stream")
+	}
+	if got := <-slow; got != "public" {
+		t.Errorf("in-flight GET /slow = %q, want it to finish with \"public\"", got)
+	}
+	if _, err := net.Dial("tcp", listeners[1].Listener.Addr().String()); err == nil {
+		t.Error("admin listener still accepting after shutdown")
+	}
+}
+
+// TestTLSCheck checks that incomplete and missing TLS files are reported
+// before they are loaded.
+func TestTLSCheck(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(cert, []byte("not checked yet"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "key.pem")
+	tests := []struct {
+		tls  TLSConfig
+		want string
+	}{
+		{TLSConfig{CertFile: cert, KeyFile: cert}, ""},
+		{TLSConfig{CertFile: cert}, "needs both"},
+		{TLSConfig{KeyFile: cert}, "needs both"},
+		{TLSConfig{CertFile: cert, KeyFile: missing}, "key_file"},
+		{TLSConfig{CertFile: cert, KeyFile: cert, ClientCAFile: missing}, "client_ca_file"},
+	}
+	for _, tt := range tests {
+		err := Validate([]Config{{Name: "public", Address: ":443", TLS: tt.tls}})
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("Validate(tls %+v) = %v, want %q", tt.tls, err, tt.want)
+		}
+	}
+}
+
+// TestOpenTLS checks that incomplete TLS settings are refused.
+func TestOpenTLS(t *testing.T) {
+	_, err := Open(Config{Name: "public", Address: "127.0.0.1:0", TLS: TLSConfig{CertFile: "cert.pem"}}, http.NotFoundHandler())
+	if err == nil {
+		t.Errorf("Open() with only cert_file = %v, want an error", err)
+	}
+}
@@ -0,0 +1,53 @@
+// Package service runs the server under the platform's service manager and
+// stops it on the platform's shutdown signals. On Windows it registers with
+// the Service Control Manager; elsewhere systemd (see package systemd)
+// manages the process and the registration functions return
+// ErrUnsupported.
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// DefaultName is the service name used when none is given.
+const DefaultName = "bazel-demo-app"
+
+// ErrUnsupported is returned by Install, Uninstall and Run on platforms
+// without a Windows-style service manager.
+var ErrUnsupported = errors.New("service: not supported on this platform")
+
+// Config describes a service registration.
+type Config struct {
+	Name        string
+	DisplayName string
+	Description string
+	// Executable is the binary the service manager starts, and Args the
+	// arguments it passes.
+	Executable string
+	Args       []string
+}
+
+// shutdownSignals ask the process to stop. On Unix these are what init
+// systems and terminals send. On Windows Go delivers os.Interrupt for
+// Ctrl+C and Ctrl+Break and syscall.SIGTERM when the console closes, the
+// user logs off or the system shuts down; services get none of these, as
+// the Service Control Manager stops them through Run instead.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// RunFunc runs the server until ctx is done.
+type RunFunc func(ctx context.Context) error
+
+// SignalContext returns a copy of parent that is done when the process is
+// asked to shut down: interrupt or SIGTERM on Unix, and Ctrl+C, Ctrl+Break
+// or the console closing, logging off or shutting down on Windows. Default
+// signal handling comes back once ctx is done, so a second signal kills
+// the process during a slow drain.
+func SignalContext(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	ctx, stop = signal.NotifyContext(parent, shutdownSignals...)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package service
+
+// IsService reports whether the process was started by the Windows Service
+// Control Manager, which it never is here.
+func IsService() (bool, error) { return false, nil }
+
+// Install registers a Windows service; it returns ErrUnsupported here.
+func Install(Config) error { return ErrUnsupported }
+
+// Uninstall removes a Windows service; it returns ErrUnsupported here.
+func Uninstall(string) error { return ErrUnsupported }
+
+// Run runs as a Windows service; it returns ErrUnsupported here.
+func Run(string, RunFunc) error { return ErrUnsupported }
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestSignalContext checks that SIGTERM ends the context.
+func TestSignalContext(t *testing.T) {
+	ctx, stop := SignalContext(context.Background())
+	defer stop()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("SignalContext() not done after SIGTERM")
+	}
+}
+
+// TestUnsupported checks that service management fails cleanly off
+// Windows.
+func TestUnsupported(t *testing.T) {
+	if ok, err := IsService(); ok || err != nil {
+		t.Errorf("IsService() = %v, %v, want false, nil", ok, err)
+	}
+	if err := Install(Config{Name: DefaultName}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Install() = %v, want ErrUnsupported", err)
+	}
+	if err := Uninstall(DefaultName); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Uninstall() = %v, want ErrUnsupported", err)
+	}
+	run := func(context.Context) error { return nil }
+	if err := Run(DefaultName, run); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Run() = %v, want ErrUnsupported", err)
+	}
+}
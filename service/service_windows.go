@@ -0,0 +1,131 @@
+//go:build windows
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// stopTimeout is how long Uninstall waits for a running service to stop.
+const stopTimeout = 30 * time.Second
+
+// IsService reports whether the process was started by the Service Control
+// Manager.
+func IsService() (bool, error) {
+	return svc.IsWindowsService()
+}
+
+// Install registers c as a service that starts automatically.
+func Install(c Config) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("service: connecting to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(c.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service: %s is already installed", c.Name)
+	}
+	s, err := m.CreateService(c.Name, c.Executable, mgr.Config{
+		DisplayName: c.DisplayName,
+		Description: c.Description,
+		StartType:   mgr.StartAutomatic,
+	}, c.Args...)
+	if err != nil {
+		return fmt.Errorf("service: creating %s: %w", c.Name, err)
+	}
+	defer s.Close()
+	// Restart after crashes, backing off a little each time.
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return fmt.Errorf("service: setting recovery actions of %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// Uninstall stops the named service if it is running and removes it.
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("service: connecting to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service: %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+	if st, err := s.Control(svc.Stop); err == nil {
+		deadline := time.Now().Add(stopTimeout)
+		for st.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(300 * time.Millisecond)
+			if st, err = s.Query(); err != nil {
+				break
+			}
+		}
+	} else if !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return fmt.Errorf("service: stopping %s: %w", name, err)
+	}
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("service: removing %s: %w", name, err)
+	}
+	return nil
+}
+
+// Run runs run as the named service, cancelling its context when the
+// Service Control Manager asks the service to stop or the system shuts
+// down. It returns once run has returned.
+func Run(name string, run RunFunc) error {
+	h := &handler{run: run}
+	if err := svc.Run(name, h); err != nil {
+		return fmt.Errorf("service: %w", err)
+	}
+	return h.err
+}
+
+// handler adapts a RunFunc to svc.Handler.
+type handler struct {
+	run RunFunc
+	err error
+}
+
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- h.run(ctx) }()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case h.err = <-done:
+			changes <- svc.Status{State: svc.StopPending}
+			if h.err != nil {
+				// A service-specific exit code makes the manager log the
+				// failure and apply the recovery actions.
+				return true, 1
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
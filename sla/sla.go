@@ -0,0 +1,370 @@
+// Package sla records every endpoint's availability and latency by the
+// hour, so teams without a metrics stack can still see how each endpoint
+// meets its service levels. Counts are kept in memory and merged into
+// storage, like analytics; Fetch reads the report from a running server
+// for the report sla command.
+package sla
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Collection is the storage collection hourly windows live in.
+const Collection = "sla_hourly"
+
+// Path is where the report is served.
+const Path = "/admin/sla"
+
+// DefaultSince is how far back reports look by default.
+const DefaultSince = 24 * time.Hour
+
+// Bounds are the upper bounds, in milliseconds, of the latency histogram
+// buckets. A last bucket counts everything slower.
+var Bounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// maxUpdateRetries bounds retries when another instance updates the same
+// window between our read and write.
+const maxUpdateRetries = 5
+
+// Window is one endpoint's requests during one UTC hour.
+type Window struct {
+	Hour  time.Time `json:"hour"`
+	Route string    `json:"route"`
+	// Requests counts every response; Errors those with a 5xx status.
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	// Buckets counts requests by latency, Buckets[i] those no slower than
+	// Bounds[i] but slower than Bounds[i-1].
+	Buckets []int64 `json:"buckets"`
+	// Millis is the sum of the requests' latencies.
+	Millis float64 `json:"millis"`
+}
+
+// add adds o's counts to w.
+func (w *Window) add(o *Window) {
+	w.Requests += o.Requests
+	w.Errors += o.Errors
+	w.Millis += o.Millis
+	if len(w.Buckets) < len(o.Buckets) {
+		w.Buckets = append(w.Buckets, make([]int64, len(o.Buckets)-len(w.Buckets))...)
+	}
+	for i, n := range o.Buckets {
+		w.Buckets[i] += n
+	}
+}
+
+type key struct {
+	hour  time.Time
+	route string
+}
+
+// id returns the storage ID of the window for k.
+func (k key) id() string {
+	return k.hour.Format("2006-01-02T15") + "|" + url.PathEscape(k.route)
+}
+
+// Recorder records requests and flushes them to Store.
+type Recorder struct {
+	Store storage.Store
+	now   func() time.Time
+
+	mu      sync.Mutex
+	pending map[key]*Window
+}
+
+// NewRecorder returns a Recorder flushing to store.
+func NewRecorder(store storage.Store) *Recorder {
+	return &Recorder{Store: store, now: time.Now, pending: make(map[key]*Window)}
+}
+
+// SetClock makes the recorder date requests by now instead of the wall
+// clock, for tests.
+func (rec *Recorder) SetClock(now func() time.Time) {
+	rec.now = now
+}
+
+// Middleware records every request under its method and route template,
+// or "unmatched". Install it inside the router, where the route is known.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tmpl, err := cur.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(sw, r)
+		rec.Observe(r.Method+" "+route, sw.status, time.Since(start))
+	})
+}
+
+// Observe records a request to route answered with status after d.
+func (rec *Recorder) Observe(route string, status int, d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(Bounds, ms)
+	k := key{hour: rec.now().UTC().Truncate(time.Hour), route: route}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	w := rec.pending[k]
+	if w == nil {
+		w = &Window{Hour: k.hour, Route: route, Buckets: make([]int64, len(Bounds)+1)}
+		rec.pending[k] = w
+	}
+	w.Requests++
+	if status >= 500 {
+		w.Errors++
+	}
+	w.Buckets[i]++
+	w.Millis += ms
+}
+
+// Flush merges pending windows into storage. Windows that fail to merge
+// are put back and retried on the next flush.
+func (rec *Recorder) Flush(ctx context.Context) error {
+	rec.mu.Lock()
+	pending := rec.pending
+	rec.pending = make(map[key]*Window)
+	rec.mu.Unlock()
+
+	var firstErr error
+	for k, w := range pending {
+		if err := rec.merge(ctx, k, w); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			rec.mu.Lock()
+			if cur := rec.pending[k]; cur != nil {
+				w.add(cur)
+			}
+			rec.pending[k] = w
+			rec.mu.Unlock()
+		}
+	}
+	return firstErr
+}
+
+func (rec *Recorder) merge(ctx context.Context, k key, w *Window) error {
+	for i := 0; i < maxUpdateRetries; i++ {
+		stored, err := rec.Store.Get(ctx, Collection, k.id())
+		if errors.Is(err, storage.ErrNotFound) {
+			data, _ := json.Marshal(w)
+			_, err = rec.Store.Create(ctx, Collection, k.id(), data)
+			if errors.Is(err, storage.ErrExists) {
+				continue
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+
+		var merged Window
+		if err := json.Unmarshal(stored.Data, &merged); err != nil {
+			return err
+		}
+		merged.add(w)
+		data, _ := json.Marshal(merged)
+		_, err = rec.Store.Update(ctx, Collection, stored.ID, data, stored.Version)
+		if !errors.Is(err, storage.ErrVersionMismatch) {
+			return err
+		}
+	}
+	return storage.ErrVersionMismatch
+}
+
+// Run flushes every interval until ctx is done, then flushes once more.
+func (rec *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is done, so the last flush needs its own.
+			if err := rec.Flush(context.Background()); err != nil {
+				logrus.WithError(err).Error("sla: final flush")
+			}
+			return
+		case <-ticker.C:
+			if err := rec.Flush(ctx); err != nil {
+				logrus.WithError(err).Error("sla: flushing windows")
+			}
+		}
+	}
+}
+
+// Endpoint is one endpoint's service levels over a report's hours.
+type Endpoint struct {
+	Route    string `json:"route"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+	// Availability is the fraction of requests not answered with a 5xx.
+	Availability float64 `json:"availability"`
+	// Latencies are in milliseconds. Percentiles are estimated from the
+	// histogram, so they are only as precise as Bounds.
+	MeanMillis float64 `json:"mean_ms"`
+	P50Millis  float64 `json:"p50_ms"`
+	P95Millis  float64 `json:"p95_ms"`
+	P99Millis  float64 `json:"p99_ms"`
+}
+
+// Report returns the service levels of every endpoint requested in the
+// stored hours starting at or after since truncated to the hour, busiest
+// first. Requests not yet flushed aren't included.
+func (rec *Recorder) Report(ctx context.Context, since time.Time) ([]Endpoint, error) {
+	windows, err := rec.Store.List(ctx, Collection, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	from := since.UTC().Truncate(time.Hour)
+	totals := make(map[string]*Window)
+	for _, stored := range windows {
+		var w Window
+		if err := json.Unmarshal(stored.Data, &w); err != nil || w.Hour.Before(from) {
+			continue
+		}
+		t := totals[w.Route]
+		if t == nil {
+			t = &Window{Route: w.Route}
+			totals[w.Route] = t
+		}
+		t.add(&w)
+	}
+
+	out := make([]Endpoint, 0, len(totals))
+	for _, t := range totals {
+		e := Endpoint{Route: t.Route, Requests: t.Requests, Errors: t.Errors, Availability: 1}
+		if t.Requests > 0 {
+			e.Availability = 1 - float64(t.Errors)/float64(t.Requests)
+			e.MeanMillis = t.Millis / float64(t.Requests)
+		}
+		e.P50Millis = Percentile(t.Buckets, 0.50)
+		e.P95Millis = Percentile(t.Buckets, 0.95)
+		e.P99Millis = Percentile(t.Buckets, 0.99)
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Route < out[j].Route
+	})
+	return out, nil
+}
+
+// Percentile estimates the q quantile, between 0 and 1, of the latencies
+// counted in buckets, interpolating within the bucket it falls in. The
+// slowest bucket has no upper bound, so quantiles in it are reported as
+// its lower bound.
+func Percentile(buckets []int64, q float64) float64 {
+	var total int64
+	for _, n := range buckets {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen float64
+	for i, n := range buckets {
+		if n == 0 || seen+float64(n) < rank {
+			seen += float64(n)
+			continue
+		}
+		if i >= len(Bounds) {
+			return Bounds[len(Bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = Bounds[i-1]
+		}
+		return lower + (Bounds[i]-lower)*math.Max(0, rank-seen)/float64(n)
+	}
+	return Bounds[len(Bounds)-1]
+}
+
+// Fetch requests the report of the last since from the server at
+// baseURL, authenticating with token if it isn't empty.
+func Fetch(ctx context.Context, client *http.Client, baseURL, token string, since time.Duration) ([]Endpoint, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = Path
+	u.RawQuery = url.Values{"since": {since.String()}}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return nil, fmt.Errorf("%s: %s: %s", u, resp.Status, body)
+	}
+	var out []Endpoint
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("%s: decoding report: %w", u, err)
+	}
+	return out, nil
+}
+
+// statusWriter records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.status, w.wrote = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streamed responses such as /changes through.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
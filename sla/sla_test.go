@@ -0,0 +1,91 @@
+package sla
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestReport checks that windows add up across flushes and hours, that
+// hours before since are left out, and the availability and percentiles
+// reported.
+func TestReport(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 30, 0, 0, time.UTC)
+	rec := NewRecorder(storage.NewMemory())
+	rec.SetClock(func() time.Time { return now })
+	rec.Observe("GET /greet", http.StatusOK, time.Hour)
+	now = now.Add(-3 * time.Hour)
+	rec.Observe("GET /greet", http.StatusOK, 3*time.Millisecond)
+	now = now.Add(3 * time.Hour)
+	if err := rec.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 98; i++ {
+		rec.Observe("GET /greet", http.StatusOK, 20*time.Millisecond)
+	}
+	rec.Observe("GET /greet", http.StatusServiceUnavailable, 20*time.Millisecond)
+	rec.Observe("POST /greetings", http.StatusCreated, 2*time.Millisecond)
+	if err := rec.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rec.Report(context.Background(), now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Route != "GET /greet" || got[1].Route != "POST /greetings" {
+		t.Fatalf("Report = %+v, want GET /greet then POST /greetings", got)
+	}
+	greet := got[0]
+	if greet.Requests != 100 || greet.Errors != 1 || greet.Availability != 0.99 {
+		t.Errorf("Report(GET /greet) = %+v, want 100 requests, 1 error, 0.99 available", greet)
+	}
+	if greet.P50Millis <= 10 || greet.P50Millis > 25 || greet.P99Millis != 25 {
+		t.Errorf("Report(GET /greet) p50 %v p99 %v, want both in the 10-25ms bucket", greet.P50Millis, greet.P99Millis)
+	}
+
+	if all, _ := rec.Report(context.Background(), now.Add(-4*time.Hour)); all[0].Requests != 101 {
+		t.Errorf("Report(4h) = %+v, want the earlier hour's request too", all)
+	}
+}
+
+// TestPercentile checks interpolation and the unbounded last bucket.
+func TestPercentile(t *testing.T) {
+	buckets := make([]int64, len(Bounds)+1)
+	buckets[0] = 50
+	buckets[len(Bounds)] = 50
+	if got := Percentile(buckets, 0.25); got != 2.5 {
+		t.Errorf("Percentile(0.25) = %v, want 2.5", got)
+	}
+	if got := Percentile(buckets, 0.99); got != Bounds[len(Bounds)-1] {
+		t.Errorf("Percentile(0.99) = %v, want the last bound", got)
+	}
+	if got := Percentile(make([]int64, len(Bounds)+1), 0.5); got != 0 {
+		t.Errorf("Percentile of nothing = %v, want 0", got)
+	}
+}
+
+// TestFetch checks that Fetch asks for the window and sends the token.
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != Path || r.URL.Query().Get("since") != "1h0m0s" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode([]Endpoint{{Route: "GET /greet", Requests: 3, Availability: 1}})
+	}))
+	defer srv.Close()
+
+	got, err := Fetch(context.Background(), srv.Client(), srv.URL, "secret", time.Hour)
+	if err != nil || len(got) != 1 || got[0].Requests != 3 {
+		t.Errorf("Fetch = %+v, %v, want GET /greet's report", got, err)
+	}
+	if _, err := Fetch(context.Background(), srv.Client(), srv.URL, "", time.Hour); err == nil {
+		t.Error("Fetch without the token = nil error, want the 400")
+	}
+}
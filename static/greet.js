@@ -0,0 +1,7 @@
+document.getElementById("greet").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const name = new FormData(e.target).get("name");
+  const res = await fetch("/greet?name=" + encodeURIComponent(name));
+  const message = document.getElementById("message");
+  message.textContent = res.ok ? await res.text() : (await res.json()).error;
+});
@@ -0,0 +1,159 @@
+// Package status works out the service status shown on the public status
+// page: component health plus an admin-managed list of incidents.
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/health"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// IncidentsCollection is the storage collection incidents live in.
+const IncidentsCollection = "incidents"
+
+// Overall and component statuses.
+const (
+	Operational = "operational"
+	Degraded    = "degraded"
+	MajorOutage = "major_outage"
+)
+
+// Incident lifecycle states.
+const (
+	Investigating = "investigating"
+	Identified    = "identified"
+	Monitoring    = "monitoring"
+	Resolved      = "resolved"
+)
+
+// RecentIncidents is how far back resolved incidents stay on the page.
+const RecentIncidents = 14 * 24 * time.Hour
+
+// Incident is an admin-written notice about a problem.
+type Incident struct {
+	Title  string `json:"title" validate:"required,max=200"`
+	Status string `json:"status" validate:"required,oneof=investigating identified monitoring resolved"`
+	// Impact is how badly the incident affects the overall status.
+	Impact     string     `json:"impact" validate:"required,oneof=none minor major"`
+	Message    string     `json:"message,omitempty" validate:"max=4096"`
+	StartedAt  time.Time  `json:"started_at" validate:"required"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// ComponentStatus is the public view of a component.
+type ComponentStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// PublicIncident is the public view of an incident.
+type PublicIncident struct {
+	ID string `json:"id"`
+	Incident
+}
+
+// Summary is the public status page content.
+type Summary struct {
+	Status     string            `json:"status"`
+	Components []ComponentStatus `json:"components"`
+	Incidents  []PublicIncident  `json:"incidents"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// Reporter reports the checks of Health and reads incidents from Store.
+type Reporter struct {
+	Store  storage.Store
+	Health *health.Registry
+
+	started atomic.Bool
+}
+
+// SetStarted records whether the server is serving, for Readiness.
+func (r *Reporter) SetStarted(started bool) {
+	r.started.Store(started)
+}
+
+// Readiness runs every check, dependencies included, and reports whether
+// the service is ready for traffic.
+func (r *Reporter) Readiness(ctx context.Context) health.Readiness {
+	rd := health.Readiness{Started: r.started.Load(), Checks: r.Health.Run(ctx, true)}
+	rd.Ready = rd.Started
+	for _, res := range rd.Checks {
+		if res.Status != health.Pass {
+			rd.Ready = false
+		}
+	}
+	return rd
+}
+
+// Healthy runs every check but the dependencies and returns an error
+// naming those that failed, or nil if all passed.
+func (r *Reporter) Healthy(ctx context.Context) error {
+	return r.Health.Healthy(ctx)
+}
+
+// Incidents returns unresolved incidents and those resolved within
+// RecentIncidents of now, newest first.
+func (r *Reporter) Incidents(ctx context.Context, now time.Time) ([]PublicIncident, error) {
+	recs, err := r.Store.List(ctx, IncidentsCollection, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := []PublicIncident{}
+	for _, rec := range recs {
+		var in Incident
+		if err := json.Unmarshal(rec.Data, &in); err != nil {
+			continue
+		}
+		if in.Status == Resolved && in.ResolvedAt != nil && now.Sub(*in.ResolvedAt) > RecentIncidents {
+			continue
+		}
+		out = append(out, PublicIncident{ID: rec.ID, Incident: in})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.After(out[j].StartedAt) })
+	return out, nil
+}
+
+// Summary builds the public status summary.
+func (r *Reporter) Summary(ctx context.Context) (Summary, error) {
+	now := time.Now().UTC()
+	incidents, err := r.Incidents(ctx, now)
+	if err != nil {
+		return Summary{}, err
+	}
+	results := r.Health.Run(ctx, false)
+
+	s := Summary{Status: Operational, Incidents: incidents, UpdatedAt: now}
+	down := 0
+	for _, res := range results {
+		c := ComponentStatus{Name: res.Name, Status: Operational}
+		if res.Status != health.Pass {
+			c.Status = MajorOutage
+			down++
+		}
+		s.Components = append(s.Components, c)
+	}
+	if down > 0 {
+		s.Status = Degraded
+		if down == len(results) {
+			s.Status = MajorOutage
+		}
+	}
+	for _, in := range incidents {
+		if in.Status == Resolved {
+			continue
+		}
+		switch {
+		case in.Impact == "major":
+			s.Status = MajorOutage
+		case in.Impact == "minor" && s.Status == Operational:
+			s.Status = Degraded
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/health"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+func ok(context.Context) error     { return nil }
+func broken(context.Context) error { return errors.New("connection refused to 10.0.0.7") }
+
+// component is a named check for registries.
+type component struct {
+	name  string
+	check health.Func
+}
+
+// registry returns a registry of components.
+func registry(components ...component) *health.Registry {
+	r := health.NewRegistry()
+	for _, c := range components {
+		r.Register(c.name, 0, c.check)
+	}
+	return r
+}
+
+// TestSummary checks how component results and active incidents combine
+// into the overall status.
+func TestSummary(t *testing.T) {
+	now := time.Now().UTC()
+	old := now.Add(-30 * 24 * time.Hour)
+	tests := []struct {
+		name       string
+		components []component
+		incidents  []Incident
+		want       string
+		shown      int
+	}{
+		{"all ok", []component{{"api", ok}, {"storage", ok}}, nil, Operational, 0},
+		{"one down", []component{{"api", ok}, {"storage", broken}}, nil, Degraded, 0},
+		{"all down", []component{{"api", broken}}, nil, MajorOutage, 0},
+		{"minor incident", []component{{"api", ok}}, []Incident{{Title: "Slow", Status: Monitoring, Impact: "minor", StartedAt: now}}, Degraded, 1},
+		{"major incident", []component{{"api", ok}}, []Incident{{Title: "Down", Status: Identified, Impact: "major", StartedAt: now}}, MajorOutage, 1},
+		{"old resolved", []component{{"api", ok}}, []Incident{{Title: "Old", Status: Resolved, Impact: "major", StartedAt: old, ResolvedAt: &old}}, Operational, 0},
+	}
+	for _, tt := range tests {
+		store := storage.NewMemory()
+		for i, in := range tt.incidents {
+			data, _ := json.Marshal(in)
+			store.Create(context.Background(), IncidentsCollection, string(rune('a'+i)), data)
+		}
+		r := &Reporter{Store: store, Health: registry(tt.components...)}
+		s, err := r.Summary(context.Background())
+		if err != nil || s.Status != tt.want || len(s.Incidents) != tt.shown {
+			t.Errorf("%s: Summary() = %s with %d incidents, %v, want %s with %d", tt.name, s.Status, len(s.Incidents), err, tt.want, tt.shown)
+		}
+	}
+}
+
+// TestReadiness checks that the server is only ready once started and
+// while every check passes, dependencies included, and that dependencies
+// don't make it unhealthy.
+func TestReadiness(t *testing.T) {
+	ctx := context.Background()
+	checks := registry(component{"storage", ok})
+	checks.RegisterDependency("upstream", 0, broken)
+	r := &Reporter{Health: checks}
+	if rd := r.Readiness(ctx); rd.Ready || rd.Started || len(rd.Checks) != 2 {
+		t.Errorf("Readiness() before starting = %+v, want not ready with 2 checks", rd)
+	}
+	r.SetStarted(true)
+	if rd := r.Readiness(ctx); rd.Ready || rd.Checks[1].Status != health.Fail {
+		t.Errorf("Readiness() with upstream down = %+v, want not ready", rd)
+	}
+	if err := r.Healthy(ctx); err != nil {
+		t.Errorf("Healthy() with upstream down = %v, want nil", err)
+	}
+	checks.RegisterDependency("upstream", 0, ok)
+	if rd := r.Readiness(ctx); !rd.Ready {
+		t.Errorf("Readiness() = %+v, want ready", rd)
+	}
+}
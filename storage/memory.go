@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tombstone retention limits for Memory. Deletions are forgotten once they
+// are older than TombstoneRetention or there are more than MaxTombstones
+// in a collection.
+const (
+	TombstoneRetention = 24 * time.Hour
+	MaxTombstones      = 10000
+)
+
+// Memory is a Store that keeps everything in process memory. It is the
+// default backend and the one tests use.
+type Memory struct {
+	mu          sync.RWMutex
+	collections map[string]map[string]Record
+	tombstones  map[string][]Tombstone
+	// forgotten is, per collection, when the newest forgotten deletion
+	// happened.
+	forgotten map[string]time.Time
+	now       func() time.Time
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		collections: make(map[string]map[string]Record),
+		tombstones:  make(map[string][]Tombstone),
+		forgotten:   make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+// SetClock makes the store timestamp writes and deletions by now instead
+// of the wall clock, for tests. Call it before the store is used.
+func (m *Memory) SetClock(now func() time.Time) {
+	m.now = now
+}
+
+func (m *Memory) Get(ctx context.Context, collection, id string) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rec, ok := m.collections[collection][id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+func (m *Memory) List(ctx context.Context, collection string, opts ListOptions) ([]Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	recs := make([]Record, 0, len(m.collections[collection]))
+	for _, rec := range m.collections[collection] {
+		if !opts.UpdatedSince.IsZero() && rec.UpdatedAt.Before(opts.UpdatedSince) {
+			continue
+		}
+		if opts.After == nil || opts.After.Before(rec.Key()) {
+			recs = append(recs, rec)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Key().Before(recs[j].Key()) })
+
+	if opts.Offset > 0 {
+		if opts.Offset >= len(recs) {
+			return nil, nil
+		}
+		recs = recs[opts.Offset:]
+	}
+	if opts.Limit > 0 && len(recs) > opts.Limit {
+		recs = recs[:opts.Limit]
+	}
+	return recs, nil
+}
+
+func (m *Memory) Create(ctx context.Context, collection, id string, data json.RawMessage) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.collections[collection]
+	if !ok {
+		c = make(map[string]Record)
+		m.collections[collection] = c
+	}
+	if _, ok := c[id]; ok {
+		return Record{}, ErrExists
+	}
+	now := m.now()
+	rec := Record{
+		Collection: collection,
+		ID:         id,
+		Data:       append(json.RawMessage(nil), data...),
+		Version:    1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	c[id] = rec
+	return rec, nil
+}
+
+func (m *Memory) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.collections[collection][id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	if ifVersion != 0 && rec.Version != ifVersion {
+		return Record{}, ErrVersionMismatch
+	}
+	rec.Data = append(json.RawMessage(nil), data...)
+	rec.Version++
+	rec.UpdatedAt = m.now()
+	m.collections[collection][id] = rec
+	return rec, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, collection, id string, ifVersion int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.collections[collection][id]
+	if !ok {
+		return ErrNotFound
+	}
+	if ifVersion != 0 && rec.Version != ifVersion {
+		return ErrVersionMismatch
+	}
+	delete(m.collections[collection], id)
+	m.bury(collection, Tombstone{ID: id, Version: rec.Version, DeletedAt: m.now()})
+	return nil
+}
+
+// bury records t and forgets tombstones beyond the retention limits. The
+// caller holds m.mu.
+func (m *Memory) bury(collection string, t Tombstone) {
+	ts := append(m.tombstones[collection], t)
+	cutoff := t.DeletedAt.Add(-TombstoneRetention)
+	drop := 0
+	for drop < len(ts) && (len(ts)-drop > MaxTombstones || ts[drop].DeletedAt.Before(cutoff)) {
+		drop++
+	}
+	if drop > 0 {
+		m.forgotten[collection] = ts[drop-1].DeletedAt
+		ts = append([]Tombstone(nil), ts[drop:]...)
+	}
+	m.tombstones[collection] = ts
+}
+
+func (m *Memory) Deleted(ctx context.Context, collection string, since time.Time) ([]Tombstone, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if f, ok := m.forgotten[collection]; ok && !since.After(f) {
+		return nil, ErrHistoryExpired
+	}
+	var out []Tombstone
+	for _, t := range m.tombstones[collection] {
+		if !t.DeletedAt.Before(since) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
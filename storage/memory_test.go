@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/ctxerr"
+)
+
+// TestStoreTakesContext audits the Store interface for methods that can't
+// be canceled.
+func TestStoreTakesContext(t *testing.T) {
+	if missing := ctxerr.MissingContext(reflect.TypeOf((*Store)(nil)).Elem()); len(missing) > 0 {
+		t.Fatalf("Store methods without a leading context.Context: %v", missing)
+	}
+}
+
+// TestMemoryVersioning checks that conditional writes only succeed against
+// the current version.
+func TestMemoryVersioning(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	rec, err := m.Create(ctx, "greetings", "a", json.RawMessage(`{"n":1}`))
+	if err != nil || rec.Version != 1 {
+		t.Fatalf("Create = %+v, %v, want version 1", rec, err)
+	}
+	if _, err := m.Create(ctx, "greetings", "a", nil); err != ErrExists {
+		t.Fatalf("second Create error = %v, want ErrExists", err)
+	}
+
+	rec, err = m.Update(ctx, "greetings", "a", json.RawMessage(`{"n":2}`), 1)
+	if err != nil || rec.Version != 2 {
+		t.Fatalf("Update(ifVersion 1) = %+v, %v, want version 2", rec, err)
+	}
+	if _, err := m.Update(ctx, "greetings", "a", json.RawMessage(`{"n":3}`), 1); err != ErrVersionMismatch {
+		t.Fatalf("stale Update error = %v, want ErrVersionMismatch", err)
+	}
+	if err := m.Delete(ctx, "greetings", "a", 1); err != ErrVersionMismatch {
+		t.Fatalf("stale Delete error = %v, want ErrVersionMismatch", err)
+	}
+	if err := m.Delete(ctx, "greetings", "a", 2); err != nil {
+		t.Fatalf("Delete(ifVersion 2) error = %v", err)
+	}
+	if _, err := m.Get(ctx, "greetings", "a"); err != ErrNotFound {
+		t.Fatalf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+// TestMemoryChanges checks UpdatedSince, tombstones, and that forgotten
+// deletions are reported as expired history.
+func TestMemoryChanges(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	m.Create(ctx, "greetings", "old", nil)
+	now = now.Add(time.Minute)
+	mark := now
+	m.Create(ctx, "greetings", "new", nil)
+	m.Delete(ctx, "greetings", "old", 0)
+
+	recs, _ := m.List(ctx, "greetings", ListOptions{UpdatedSince: mark})
+	if len(recs) != 1 || recs[0].ID != "new" {
+		t.Errorf("List(UpdatedSince) = %v, want only new", recs)
+	}
+	deleted, err := m.Deleted(ctx, "greetings", mark)
+	if err != nil || len(deleted) != 1 || deleted[0].ID != "old" || deleted[0].Version != 1 {
+		t.Errorf("Deleted(mark) = %+v, %v, want old at version 1", deleted, err)
+	}
+
+	now = now.Add(TombstoneRetention + time.Minute)
+	m.Delete(ctx, "greetings", "new", 0)
+	if _, err := m.Deleted(ctx, "greetings", mark); err != ErrHistoryExpired {
+		t.Errorf("Deleted(mark) after retention = %v, want ErrHistoryExpired", err)
+	}
+	if deleted, err := m.Deleted(ctx, "greetings", now); err != nil || len(deleted) != 1 {
+		t.Errorf("Deleted(now) = %v, %v, want the recent deletion", deleted, err)
+	}
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxCollection is the collection the outbox keeps its change log in.
+const OutboxCollection = "outbox"
+
+// Change operations.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// ErrInvalidToken is returned for change tokens that weren't issued by an
+// outbox.
+var ErrInvalidToken = errors.New("storage: invalid change token")
+
+// Change is one entry of the outbox: a write to a tracked collection.
+type Change struct {
+	// Seq numbers changes in the order they were made, from 1.
+	Seq        int64     `json:"seq"`
+	Op         string    `json:"op"`
+	Collection string    `json:"collection"`
+	ID         string    `json:"id"`
+	Version    int64     `json:"version"`
+	Time       time.Time `json:"time"`
+	// Data is the record after the change. Deletes have none.
+	Data json.RawMessage `json:"data,omitempty"`
+	// Tenant is the tenant the write was made for, if its context named
+	// one with WithTenant.
+	Tenant string `json:"tenant,omitempty"`
+	// Token resumes reading after this change. It is set by Since.
+	Token string `json:"token"`
+}
+
+// Outbox is a Store that also appends every successful write to the
+// tracked collections to a change log in OutboxCollection, so downstream
+// systems can follow changes in order and resume where they left off.
+//
+// The log is shared by every tenant, so changes record the tenant of the
+// write and Since only returns a tenant's own changes to a context naming
+// it.
+//
+// Writes to tracked collections are serialized so that sequence numbers
+// follow commit order. The record write and its log entry are two writes
+// to the underlying store, so a crash between them loses that entry.
+type Outbox struct {
+	Store
+	tracked map[string]bool
+	// epoch identifies this log. Tokens from another epoch, such as one
+	// before a restart of an in-memory store, are rejected as expired
+	// rather than silently skipping changes.
+	epoch string
+
+	mu      sync.Mutex
+	seq     int64
+	changed chan struct{}
+}
+
+var _ Store = (*Outbox)(nil)
+
+// NewOutbox returns an Outbox writing to store and logging writes to
+// collections.
+func NewOutbox(store Store, collections ...string) *Outbox {
+	o := &Outbox{Store: store, tracked: make(map[string]bool), changed: make(chan struct{})}
+	for _, c := range collections {
+		o.tracked[c] = true
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	o.epoch = hex.EncodeToString(b)
+	return o
+}
+
+// Tracked reports whether writes to collection are logged.
+func (o *Outbox) Tracked(collection string) bool {
+	return o.tracked[collection]
+}
+
+func (o *Outbox) Create(ctx context.Context, collection, id string, data json.RawMessage) (Record, error) {
+	if !o.tracked[collection] {
+		return o.Store.Create(ctx, collection, id, data)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rec, err := o.Store.Create(ctx, collection, id, data)
+	if err != nil {
+		return rec, err
+	}
+	return rec, o.log(ctx, OpCreate, rec)
+}
+
+func (o *Outbox) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (Record, error) {
+	if !o.tracked[collection] {
+		return o.Store.Update(ctx, collection, id, data, ifVersion)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	rec, err := o.Store.Update(ctx, collection, id, data, ifVersion)
+	if err != nil {
+		return rec, err
+	}
+	return rec, o.log(ctx, OpUpdate, rec)
+}
+
+func (o *Outbox) Delete(ctx context.Context, collection, id string, ifVersion int64) error {
+	if !o.tracked[collection] {
+		return o.Store.Delete(ctx, collection, id, ifVersion)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// The version goes in the log entry, so read it first; ifVersion
+	// still guards against a concurrent write by another process.
+	rec, err := o.Store.Get(ctx, collection, id)
+	if err != nil {
+		return err
+	}
+	if ifVersion != 0 && rec.Version != ifVersion {
+		return ErrVersionMismatch
+	}
+	if err := o.Store.Delete(ctx, collection, id, rec.Version); err != nil {
+		return err
+	}
+	rec.Data = nil
+	return o.log(ctx, OpDelete, rec)
+}
+
+// log appends a change for rec and wakes readers. The caller holds o.mu.
+// The write itself has already happened, so the entry is written even if
+// ctx has been canceled since.
+func (o *Outbox) log(ctx context.Context, op string, rec Record) error {
+	o.seq++
+	tenant, _ := TenantFrom(ctx)
+	c := Change{Seq: o.seq, Op: op, Collection: rec.Collection, ID: rec.ID, Version: rec.Version, Time: time.Now().UTC(), Data: rec.Data, Tenant: tenant}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("storage: outbox: %w", err)
+	}
+	if _, err := o.Store.Create(context.WithoutCancel(ctx), OutboxCollection, seqID(c.Seq), data); err != nil {
+		return fmt.Errorf("storage: outbox: %w", err)
+	}
+	close(o.changed)
+	o.changed = make(chan struct{})
+	return nil
+}
+
+// seqID is the outbox record ID of seq, padded so IDs sort numerically.
+func seqID(seq int64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// Changed returns a channel that is closed at the next change. Get it
+// before calling Since so no change can slip in between.
+func (o *Outbox) Changed() <-chan struct{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.changed
+}
+
+// Token returns the token that resumes reading after seq. Zero means from
+// the beginning.
+func (o *Outbox) Token(seq int64) string {
+	return o.epoch + "." + strconv.FormatInt(seq, 10)
+}
+
+// ParseToken returns the sequence number tok resumes after. It returns
+// ErrHistoryExpired for tokens from another epoch.
+func (o *Outbox) ParseToken(tok string) (int64, error) {
+	epoch, seqStr, ok := strings.Cut(tok, ".")
+	seq, err := strconv.ParseInt(seqStr, 10, 64)
+	if !ok || err != nil || seq < 0 {
+		return 0, ErrInvalidToken
+	}
+	if epoch != o.epoch {
+		return 0, ErrHistoryExpired
+	}
+	return seq, nil
+}
+
+// Since returns up to limit changes after seq, oldest first, each with
+// its resume token. A seq of zero starts at the oldest change still kept.
+// If ctx names a tenant, other tenants' changes are skipped. It returns
+// ErrHistoryExpired if changes after seq have been trimmed.
+func (o *Outbox) Since(ctx context.Context, seq int64, limit int) ([]Change, error) {
+	latest := o.current()
+	opts := ListOptions{}
+	if seq > 0 {
+		rec, err := o.Store.Get(ctx, OutboxCollection, seqID(seq))
+		switch {
+		case err == nil:
+			after := rec.Key()
+			opts.After = &after
+		case !errors.Is(err, ErrNotFound):
+			return nil, err
+		}
+	}
+	recs, err := o.Store.List(ctx, OutboxCollection, opts)
+	if err != nil {
+		return nil, err
+	}
+	tenant, scoped := TenantFrom(ctx)
+	var out []Change
+	seen := false
+	for _, rec := range recs {
+		var c Change
+		if err := json.Unmarshal(rec.Data, &c); err != nil {
+			return nil, fmt.Errorf("storage: outbox entry %s: %w", rec.ID, err)
+		}
+		if c.Seq <= seq {
+			continue
+		}
+		if !seen && seq > 0 && c.Seq > seq+1 {
+			return nil, ErrHistoryExpired
+		}
+		seen = true
+		if scoped && c.Tenant != tenant {
+			continue
+		}
+		c.Token = o.Token(c.Seq)
+		out = append(out, c)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	// Nothing left after seq although later changes were made: they have
+	// all been trimmed.
+	if !seen && seq > 0 && seq != latest {
+		return nil, ErrHistoryExpired
+	}
+	return out, nil
+}
+
+// current returns the latest sequence number.
+func (o *Outbox) current() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.seq
+}
+
+// Trim deletes log entries older than before and returns how many it
+// deleted. Readers whose position was trimmed get ErrHistoryExpired.
+func (o *Outbox) Trim(ctx context.Context, before time.Time) (int, error) {
+	recs, err := o.Store.List(ctx, OutboxCollection, ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, rec := range recs {
+		if !rec.CreatedAt.Before(before) {
+			break
+		}
+		if err := o.Store.Delete(ctx, OutboxCollection, rec.ID, 0); err != nil && !errors.Is(err, ErrNotFound) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Run trims entries older than retention every interval until ctx is
+// done.
+func (o *Outbox) Run(ctx context.Context, interval, retention time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			o.Trim(ctx, now.Add(-retention))
+		}
+	}
+}
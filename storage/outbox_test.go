@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestOutbox checks that tracked writes are logged in order, untracked
+// ones aren't, and tokens resume and expire.
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	o := NewOutbox(NewMemory(), "greetings")
+
+	o.Create(ctx, "greetings", "a", json.RawMessage(`{"n":1}`))
+	o.Create(ctx, "other", "x", nil)
+	o.Update(ctx, "greetings", "a", json.RawMessage(`{"n":2}`), 1)
+	o.Delete(ctx, "greetings", "a", 0)
+
+	all, err := o.Since(ctx, 0, 0)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("Since(0) = %+v, %v, want 3 changes", all, err)
+	}
+	for i, want := range []string{OpCreate, OpUpdate, OpDelete} {
+		if all[i].Op != want || all[i].Seq != int64(i+1) || all[i].ID != "a" {
+			t.Errorf("change %d = %+v, want %s of a", i, all[i], want)
+		}
+	}
+	if all[2].Version != 2 || all[2].Data != nil {
+		t.Errorf("delete = %+v, want version 2 and no data", all[2])
+	}
+
+	seq, err := o.ParseToken(all[0].Token)
+	if err != nil {
+		t.Fatalf("ParseToken(%q) error = %v", all[0].Token, err)
+	}
+	if rest, _ := o.Since(ctx, seq, 1); len(rest) != 1 || rest[0].Op != OpUpdate {
+		t.Errorf("Since(%d, 1) = %+v, want the update", seq, rest)
+	}
+	if _, err := NewOutbox(NewMemory()).ParseToken(all[0].Token); err != ErrHistoryExpired {
+		t.Errorf("ParseToken from another outbox = %v, want ErrHistoryExpired", err)
+	}
+	if _, err := o.ParseToken("garbage"); err != ErrInvalidToken {
+		t.Errorf("ParseToken(garbage) = %v, want ErrInvalidToken", err)
+	}
+
+	if n, err := o.Trim(ctx, time.Now().Add(time.Minute)); err != nil || n != 3 {
+		t.Fatalf("Trim = %d, %v, want 3", n, err)
+	}
+	if _, err := o.Since(ctx, seq, 0); err != ErrHistoryExpired {
+		t.Errorf("Since after Trim = %v, want ErrHistoryExpired", err)
+	}
+	if got, err := o.Since(ctx, 0, 0); err != nil || len(got) != 0 {
+		t.Errorf("Since(0) after Trim = %v, %v, want nothing", got, err)
+	}
+}
+
+// TestOutboxTenants checks that a tenant only reads its own changes, and
+// can resume after them past other tenants'.
+func TestOutboxTenants(t *testing.T) {
+	acme, globex := WithTenant(context.Background(), "acme"), WithTenant(context.Background(), "globex")
+	o := NewOutbox(NewTenantStore(NewMemory(), "greetings"), "greetings")
+
+	o.Create(acme, "greetings", "a", json.RawMessage(`{"n":1}`))
+	o.Create(globex, "greetings", "a", json.RawMessage(`{"n":2}`))
+	o.Create(globex, "greetings", "b", json.RawMessage(`{"n":3}`))
+
+	got, err := o.Since(acme, 0, 0)
+	if err != nil || len(got) != 1 || got[0].Tenant != "acme" || string(got[0].Data) != `{"n":1}` {
+		t.Fatalf("Since(0) for acme = %+v, %v, want only its create", got, err)
+	}
+	if rest, err := o.Since(acme, got[0].Seq, 0); err != nil || len(rest) != 0 {
+		t.Errorf("Since(%d) for acme = %+v, %v, want nothing", got[0].Seq, rest, err)
+	}
+	if got, err := o.Since(globex, 1, 0); err != nil || len(got) != 2 {
+		t.Errorf("Since(1) for globex = %+v, %v, want its two creates", got, err)
+	}
+	if all, err := o.Since(Unscoped(context.Background()), 0, 0); err != nil || len(all) != 3 {
+		t.Errorf("Since(0) unscoped = %+v, %v, want every change", all, err)
+	}
+}
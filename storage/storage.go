@@ -0,0 +1,98 @@
+// Package storage persists application resources as versioned JSON
+// documents grouped into collections.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a record doesn't exist.
+	ErrNotFound = errors.New("storage: record not found")
+	// ErrExists is returned when creating a record whose ID is taken.
+	ErrExists = errors.New("storage: record already exists")
+	// ErrVersionMismatch is returned when a conditional write names a
+	// version other than the current one.
+	ErrVersionMismatch = errors.New("storage: version mismatch")
+	// ErrHistoryExpired is returned when asked for deletions older than
+	// the store still remembers.
+	ErrHistoryExpired = errors.New("storage: change history expired")
+)
+
+// Record is one stored document and its metadata.
+type Record struct {
+	Collection string
+	ID         string
+	Data       json.RawMessage
+	// Version starts at 1 and increases on every update.
+	Version   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Tombstone records that a record was deleted, so clients syncing changes
+// can learn about it.
+type Tombstone struct {
+	ID string
+	// Version is the version the record had when it was deleted.
+	Version   int64
+	DeletedAt time.Time
+}
+
+// Key is the position of a record in list order.
+type Key struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Before reports whether k sorts before other.
+func (k Key) Before(other Key) bool {
+	if !k.CreatedAt.Equal(other.CreatedAt) {
+		return k.CreatedAt.Before(other.CreatedAt)
+	}
+	return k.ID < other.ID
+}
+
+// ListOptions selects a window of a List. The zero value lists everything.
+type ListOptions struct {
+	// After, if set, skips records up to and including this key.
+	After *Key
+	// Offset skips this many records (after applying After).
+	Offset int
+	// Limit caps the number of records returned; zero is unlimited.
+	Limit int
+	// UpdatedSince, if set, keeps only records created or updated at or
+	// after it. It is applied before After, Offset and Limit.
+	UpdatedSince time.Time
+}
+
+// Key returns the record's position in list order.
+func (r Record) Key() Key {
+	return Key{CreatedAt: r.CreatedAt, ID: r.ID}
+}
+
+// Store is implemented by storage backends. Every method takes a context
+// so remote backends can honour cancellation.
+type Store interface {
+	// Get returns the record with id, or ErrNotFound.
+	Get(ctx context.Context, collection, id string) (Record, error)
+	// List returns records in collection ordered by creation time, then
+	// ID, filtered and limited by opts.
+	List(ctx context.Context, collection string, opts ListOptions) ([]Record, error)
+	// Create stores a new record at version 1, or returns ErrExists.
+	Create(ctx context.Context, collection, id string, data json.RawMessage) (Record, error)
+	// Update replaces the data of an existing record. If ifVersion is
+	// non-zero the write only happens when the stored version matches;
+	// otherwise it returns ErrVersionMismatch.
+	Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (Record, error)
+	// Delete removes a record, with the same ifVersion semantics as
+	// Update.
+	Delete(ctx context.Context, collection, id string, ifVersion int64) error
+	// Deleted returns the records deleted from collection at or after
+	// since, oldest first. Stores keep a bounded history and return
+	// ErrHistoryExpired if some of those deletions have been forgotten.
+	Deleted(ctx context.Context, collection string, since time.Time) ([]Tombstone, error)
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// TenantsCollection is where a TenantStore records the tenants that have
+// written to it, for EachTenant.
+const TenantsCollection = "tenants"
+
+// ErrNoTenant is returned by a TenantStore for queries on a tenant-scoped
+// collection whose context names no tenant and isn't marked Unscoped.
+var ErrNoTenant = errors.New("storage: query on a tenant-scoped collection without a tenant")
+
+type (
+	tenantKey   struct{}
+	unscopedKey struct{}
+)
+
+// WithTenant returns a copy of ctx whose queries a TenantStore scopes to
+// tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant stored in ctx by WithTenant.
+func TenantFrom(ctx context.Context) (tenant string, ok bool) {
+	tenant, ok = ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// Unscoped returns a copy of ctx whose queries without a tenant a
+// TenantStore lets through to the records that belong to no tenant, for
+// admin tools and background jobs. It opts out of the guard, so use it
+// only where crossing tenants is intended.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// TenantStore keeps the records of tenant-scoped collections apart per
+// tenant. Every query on such a collection is confined to the tenant
+// named by its context: a tenant's Get, List and Deleted only see records
+// it wrote, and the same ID can exist once per tenant. Queries naming no
+// tenant fail with ErrNoTenant unless their context is Unscoped, so a
+// handler that forgets to pass the request context can't read across
+// tenants. Other collections are shared, as without the guard.
+//
+// Each tenant's records are kept in a collection of their own, named
+// collection@tenant; records are returned with their collection's plain
+// name. A TenantStore doesn't implement Beginner, so transactions on it
+// compensate through it and stay scoped.
+//
+// Tenants are recorded in TenantsCollection when they first create a
+// record, so jobs that must reach every tenant, such as retention, can go
+// through them with EachTenant.
+type TenantStore struct {
+	Store
+	scoped map[string]bool
+
+	mu    sync.Mutex
+	known map[string]bool
+}
+
+// NewTenantStore returns store with collections scoped to tenants.
+func NewTenantStore(store Store, collections ...string) *TenantStore {
+	scoped := make(map[string]bool, len(collections))
+	for _, c := range collections {
+		scoped[c] = true
+	}
+	return &TenantStore{Store: store, scoped: scoped, known: make(map[string]bool)}
+}
+
+// Tenants returns the tenants that have created records in s, in the
+// order they first did.
+func (s *TenantStore) Tenants(ctx context.Context) ([]string, error) {
+	recs, err := s.Store.List(ctx, TenantsCollection, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	tenants := make([]string, len(recs))
+	for i, rec := range recs {
+		tenants[i] = rec.ID
+	}
+	return tenants, nil
+}
+
+// EachTenant calls f with ctx scoped to each of s's tenants in turn, and
+// then with ctx Unscoped for the records that belong to no tenant, so
+// admin tools and background jobs reach every record of the scoped
+// collections. It stops at the first error.
+func (s *TenantStore) EachTenant(ctx context.Context, f func(ctx context.Context) error) error {
+	tenants, err := s.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := f(WithTenant(ctx, tenant)); err != nil {
+			return err
+		}
+	}
+	return f(Unscoped(WithTenant(ctx, "")))
+}
+
+// register records tenant in TenantsCollection, once per process.
+func (s *TenantStore) register(ctx context.Context, tenant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.known[tenant] {
+		return nil
+	}
+	if _, err := s.Store.Create(context.WithoutCancel(ctx), TenantsCollection, tenant, json.RawMessage(`{}`)); err != nil && !errors.Is(err, ErrExists) {
+		return err
+	}
+	s.known[tenant] = true
+	return nil
+}
+
+// Scoped reports whether collection is tenant-scoped.
+func (s *TenantStore) Scoped(collection string) bool {
+	return s.scoped[collection]
+}
+
+// collection returns the collection queries on collection in ctx go to.
+func (s *TenantStore) collection(ctx context.Context, collection string) (string, error) {
+	if !s.scoped[collection] {
+		return collection, nil
+	}
+	if tenant, ok := TenantFrom(ctx); ok {
+		return collection + "@" + tenant, nil
+	}
+	if unscoped, _ := ctx.Value(unscopedKey{}).(bool); unscoped {
+		return collection, nil
+	}
+	return "", ErrNoTenant
+}
+
+func (s *TenantStore) Get(ctx context.Context, collection, id string) (Record, error) {
+	c, err := s.collection(ctx, collection)
+	if err != nil {
+		return Record{}, err
+	}
+	rec, err := s.Store.Get(ctx, c, id)
+	rec.Collection = collection
+	return rec, err
+}
+
+func (s *TenantStore) List(ctx context.Context, collection string, opts ListOptions) ([]Record, error) {
+	c, err := s.collection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := s.Store.List(ctx, c, opts)
+	for i := range recs {
+		recs[i].Collection = collection
+	}
+	return recs, err
+}
+
+func (s *TenantStore) Create(ctx context.Context, collection, id string, data json.RawMessage) (Record, error) {
+	c, err := s.collection(ctx, collection)
+	if err != nil {
+		return Record{}, err
+	}
+	rec, err := s.Store.Create(ctx, c, id, data)
+	rec.Collection = collection
+	if tenant, ok := TenantFrom(ctx); ok && err == nil && s.scoped[collection] {
+		err = s.register(ctx, tenant)
+	}
+	return rec, err
+}
+
+func (s *TenantStore) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (Record, error) {
+	c, err := s.collection(ctx, collection)
+	if err != nil {
+		return Record{}, err
+	}
+	rec, err := s.Store.Update(ctx, c, id, data, ifVersion)
+	rec.Collection = collection
+	return rec, err
+}
+
+func (s *TenantStore) Delete(ctx context.Context, collection, id string, ifVersion int64) error {
+	c, err := s.collection(ctx, collection)
+	if err != nil {
+		return err
+	}
+	return s.Store.Delete(ctx, c, id, ifVersion)
+}
+
+func (s *TenantStore) Deleted(ctx context.Context, collection string, since time.Time) ([]Tombstone, error) {
+	c, err := s.collection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.Deleted(ctx, c, since)
+}
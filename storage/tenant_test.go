@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestTenantStore checks that tenants only see their own records in
+// scoped collections, that queries without a tenant are refused unless
+// unscoped, and that other collections are shared.
+func TestTenantStore(t *testing.T) {
+	s := NewTenantStore(NewMemory(), "greetings")
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	rec, err := s.Create(acme, "greetings", "g1", []byte(`"acme's"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Collection != "greetings" {
+		t.Errorf("Create().Collection = %q, want greetings", rec.Collection)
+	}
+	if _, err := s.Create(globex, "greetings", "g1", []byte(`"globex's"`)); err != nil {
+		t.Errorf("Create(g1) for a second tenant: %v", err)
+	}
+	if rec, err := s.Get(globex, "greetings", "g1"); err != nil || string(rec.Data) != `"globex's"` {
+		t.Errorf("Get(g1) for globex = %s, %v; want globex's record", rec.Data, err)
+	}
+	if err := s.Delete(globex, "greetings", "g1", 0); err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ := s.List(acme, "greetings", ListOptions{}); len(recs) != 1 || string(recs[0].Data) != `"acme's"` {
+		t.Errorf("List() for acme = %v, want only acme's record", recs)
+	}
+	if ts, _ := s.Deleted(acme, "greetings", rec.CreatedAt); len(ts) != 0 {
+		t.Errorf("Deleted() for acme = %v, want globex's deletion hidden", ts)
+	}
+
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "greetings", "g1"); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("Get() without a tenant error = %v, want ErrNoTenant", err)
+	}
+	if _, err := s.List(Unscoped(ctx), "greetings", ListOptions{}); err != nil {
+		t.Errorf("List() unscoped: %v", err)
+	}
+	if _, err := s.Create(ctx, "webhooks", "w1", []byte(`{}`)); err != nil {
+		t.Errorf("Create() in a shared collection without a tenant: %v", err)
+	}
+	if _, err := s.Get(acme, "webhooks", "w1"); err != nil {
+		t.Errorf("Get() in a shared collection for a tenant: %v", err)
+	}
+}
+
+// TestTenantStoreTx checks that transactions on a TenantStore stay scoped.
+func TestTenantStoreTx(t *testing.T) {
+	s := NewTenantStore(NewMemory(), "greetings")
+	acme := WithTenant(context.Background(), "acme")
+	tx, err := Begin(acme, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Create(acme, "greetings", "g1", []byte(`"x"`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Create(context.Background(), "greetings", "g2", []byte(`"x"`)); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("Create() in a transaction without a tenant error = %v, want ErrNoTenant", err)
+	}
+	if err := tx.Rollback(acme); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(acme, "greetings", "g1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(g1) after Rollback() error = %v, want ErrNotFound", err)
+	}
+}
+
+// TestEachTenant checks that EachTenant visits every tenant that has
+// created records, then the records of none.
+func TestEachTenant(t *testing.T) {
+	s := NewTenantStore(NewMemory(), "greetings")
+	for i, tenant := range []string{"globex", "acme", "acme"} {
+		if _, err := s.Create(WithTenant(context.Background(), tenant), "greetings", fmt.Sprint("g", i), []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Create(Unscoped(context.Background()), "greetings", "g", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var visited []string
+	counts := map[string]int{}
+	err := s.EachTenant(Unscoped(WithTenant(context.Background(), "acme")), func(ctx context.Context) error {
+		tenant, _ := TenantFrom(ctx)
+		recs, err := s.List(ctx, "greetings", ListOptions{})
+		visited = append(visited, tenant)
+		counts[tenant] = len(recs)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(visited, ","); got != "globex,acme," {
+		t.Errorf("EachTenant visited %q, want globex, acme and no tenant", got)
+	}
+	if counts["acme"] != 2 || counts["globex"] != 1 || counts[""] != 1 {
+		t.Errorf("records seen per tenant = %v, want acme 2, globex 1, none 1", counts)
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// ErrTxDone is returned by writes and by Commit and Rollback on a
+// transaction that has already been committed or rolled back.
+var ErrTxDone = errors.New("storage: transaction already finished")
+
+// Tx is a unit of work on a store: its writes are kept by Commit and
+// undone by Rollback. Exactly one of them should be called.
+type Tx interface {
+	Store
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// Beginner is implemented by stores with native transactions. Begin uses
+// them in preference to compensation.
+type Beginner interface {
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Begin starts a transaction on store. Stores that don't implement
+// Beginner get a compensating transaction: writes go to the store at once,
+// visible to everyone, and Rollback undoes them in reverse order. Undoing
+// is best effort. A record written by someone else in the meantime is left
+// alone, and rolling back restores data but not versions or timestamps: a
+// deleted record comes back at version 1 and its deletion stays in the
+// Deleted history.
+func Begin(ctx context.Context, store Store) (Tx, error) {
+	if b, ok := store.(Beginner); ok {
+		return b.Begin(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &compensating{Store: store}, nil
+}
+
+// compensating is a Tx that applies writes directly and records how to
+// undo each.
+type compensating struct {
+	Store
+
+	mu   sync.Mutex
+	undo []func(ctx context.Context) error
+	done bool
+}
+
+// record adds an undo step.
+func (t *compensating) record(step func(ctx context.Context) error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.undo = append(t.undo, step)
+}
+
+func (t *compensating) finished() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.done
+}
+
+func (t *compensating) Create(ctx context.Context, collection, id string, data json.RawMessage) (Record, error) {
+	if t.finished() {
+		return Record{}, ErrTxDone
+	}
+	rec, err := t.Store.Create(ctx, collection, id, data)
+	if err == nil {
+		t.record(func(ctx context.Context) error {
+			return t.Store.Delete(ctx, collection, id, rec.Version)
+		})
+	}
+	return rec, err
+}
+
+func (t *compensating) Update(ctx context.Context, collection, id string, data json.RawMessage, ifVersion int64) (Record, error) {
+	if t.finished() {
+		return Record{}, ErrTxDone
+	}
+	prev, err := t.Store.Get(ctx, collection, id)
+	if err != nil {
+		return Record{}, err
+	}
+	if ifVersion != 0 && prev.Version != ifVersion {
+		return Record{}, ErrVersionMismatch
+	}
+	rec, err := t.Store.Update(ctx, collection, id, data, prev.Version)
+	if err == nil {
+		t.record(func(ctx context.Context) error {
+			_, err := t.Store.Update(ctx, collection, id, prev.Data, rec.Version)
+			return err
+		})
+	}
+	return rec, err
+}
+
+func (t *compensating) Delete(ctx context.Context, collection, id string, ifVersion int64) error {
+	if t.finished() {
+		return ErrTxDone
+	}
+	prev, err := t.Store.Get(ctx, collection, id)
+	if err != nil {
+		return err
+	}
+	if ifVersion != 0 && prev.Version != ifVersion {
+		return ErrVersionMismatch
+	}
+	if err := t.Store.Delete(ctx, collection, id, prev.Version); err != nil {
+		return err
+	}
+	t.record(func(ctx context.Context) error {
+		_, err := t.Store.Create(ctx, collection, id, prev.Data)
+		return err
+	})
+	return nil
+}
+
+// finish marks the transaction done and returns its undo steps.
+func (t *compensating) finish() ([]func(ctx context.Context) error, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return nil, ErrTxDone
+	}
+	t.done = true
+	undo := t.undo
+	t.undo = nil
+	return undo, nil
+}
+
+func (t *compensating) Commit(ctx context.Context) error {
+	_, err := t.finish()
+	return err
+}
+
+// Rollback undoes every write, newest first, carrying on past failures
+// and returning them joined.
+func (t *compensating) Rollback(ctx context.Context) error {
+	undo, err := t.finish()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := len(undo) - 1; i >= 0; i-- {
+		if err := undo[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
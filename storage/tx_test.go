@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestCompensatingRollback writes through a transaction and checks that
+// rolling back restores the records' data, and that committing keeps it.
+func TestCompensatingRollback(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.Create(ctx, "c", "kept", []byte(`"old"`))
+	m.Create(ctx, "c", "gone", []byte(`"doomed"`))
+
+	tx, err := Begin(ctx, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Create(ctx, "c", "new", []byte(`"new"`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Update(ctx, "c", "kept", []byte(`"changed"`), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete(ctx, "c", "gone", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Update(ctx, "c", "kept", []byte(`"stale"`), 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("Update(stale version) error = %v, want ErrVersionMismatch", err)
+	}
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() = %v", err)
+	}
+
+	if _, err := m.Get(ctx, "c", "new"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(new) after rollback error = %v, want ErrNotFound", err)
+	}
+	for id, want := range map[string]string{"kept": `"old"`, "gone": `"doomed"`} {
+		if rec, err := m.Get(ctx, "c", id); err != nil || string(rec.Data) != want {
+			t.Errorf("Get(%s) after rollback = %s, %v, want %s", id, rec.Data, err, want)
+		}
+	}
+	if _, err := tx.Create(ctx, "c", "late", nil); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Create() after rollback error = %v, want ErrTxDone", err)
+	}
+
+	tx, _ = Begin(ctx, m)
+	tx.Create(ctx, "c", "committed", []byte(`1`))
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(ctx); !errors.Is(err, ErrTxDone) {
+		t.Errorf("Rollback() after commit error = %v, want ErrTxDone", err)
+	}
+	if _, err := m.Get(ctx, "c", "committed"); err != nil {
+		t.Errorf("Get(committed) after commit: %v", err)
+	}
+}
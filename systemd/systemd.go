@@ -0,0 +1,141 @@
+// Package systemd integrates with systemd without linking libsystemd:
+// sd_notify readiness and watchdog messages for Type=notify units, and the
+// listeners handed over by socket activation. Each function is a no-op
+// when the process isn't running under the matching systemd feature.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Notify states.
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// listenFDsStart is the first file descriptor passed by socket activation.
+const listenFDsStart = 3
+
+// Notify sends state to the service manager through $NOTIFY_SOCKET. It
+// returns false, with no error, when there is no socket to notify, such as
+// outside systemd or for units that aren't Type=notify.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if strings.HasPrefix(socket, "@") {
+		// Abstract namespace socket.
+		addr.Name = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, fmt.Errorf("systemd: notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("systemd: notify: %w", err)
+	}
+	return true, nil
+}
+
+// Status returns a Notify state setting the unit's status line.
+func Status(msg string) string {
+	return "STATUS=" + strings.ReplaceAll(msg, "\n", " ")
+}
+
+// WatchdogInterval returns the watchdog timeout systemd expects pings
+// within, from $WATCHDOG_USEC, and false if the watchdog isn't enabled for
+// this process.
+func WatchdogInterval() (time.Duration, bool) {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// RunWatchdog pings the systemd watchdog at half its interval for as long
+// as healthy reports no error, until ctx is done. While healthy fails the
+// pings stop, so systemd restarts a service that has hung or lost its
+// dependencies for longer than WatchdogSec. It returns at once if the
+// watchdog isn't enabled.
+func RunWatchdog(ctx context.Context, healthy func(ctx context.Context) error) {
+	interval, ok := WatchdogInterval()
+	if !ok {
+		return
+	}
+	tick := time.NewTicker(interval / 2)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			checkCtx, cancel := context.WithTimeout(ctx, interval/2)
+			err := healthy(checkCtx)
+			cancel()
+			if err != nil {
+				logrus.WithError(err).Warn("systemd: health check failed; withholding watchdog ping")
+				Notify(Status("unhealthy: " + err.Error()))
+				continue
+			}
+			if _, err := Notify(Watchdog); err != nil {
+				logrus.WithError(err).Warn("systemd: watchdog ping")
+			}
+		}
+	}
+}
+
+// Listeners returns the sockets passed by systemd socket activation, in
+// the order of the unit's Listen= lines, or nil if the process wasn't
+// socket-activated. It unsets the LISTEN_* variables so child processes
+// don't try to use them too.
+func Listeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	var listeners []net.Listener
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		l, err := net.FileListener(f)
+		// FileListener dups the descriptor.
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("systemd: socket %s: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,90 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// listenNotify returns a datagram socket standing in for systemd's notify
+// socket, with NOTIFY_SOCKET pointing at it.
+func listenNotify(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func read(t *testing.T, conn *net.UnixConn) string {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading notify socket: %v", err)
+	}
+	return string(buf[:n])
+}
+
+// TestNotify checks that states reach the socket and that Notify is a
+// no-op outside systemd.
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Fatalf("Notify without socket = %v, %v, want false, nil", sent, err)
+	}
+	conn := listenNotify(t)
+	if sent, err := Notify(Ready); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v, want true, nil", sent, err)
+	}
+	if got := read(t, conn); got != Ready {
+		t.Errorf("socket got %q, want %q", got, Ready)
+	}
+}
+
+// TestRunWatchdog checks that pings are only sent while healthy.
+func TestRunWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthy := make(chan error, 1)
+	healthy <- errors.New("storage down")
+	go RunWatchdog(ctx, func(context.Context) error {
+		select {
+		case err := <-healthy:
+			return err
+		default:
+			return nil
+		}
+	})
+	if got := read(t, conn); got != Status("unhealthy: storage down") {
+		t.Errorf("first message = %q, want the unhealthy status", got)
+	}
+	if got := read(t, conn); got != Watchdog {
+		t.Errorf("second message = %q, want %q", got, Watchdog)
+	}
+}
+
+// TestWatchdogInterval checks WATCHDOG_USEC and WATCHDOG_PID handling.
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "3000000")
+	t.Setenv("WATCHDOG_PID", "")
+	if d, ok := WatchdogInterval(); !ok || d != 3*time.Second {
+		t.Errorf("WatchdogInterval() = %v, %v, want 3s", d, ok)
+	}
+	t.Setenv("WATCHDOG_PID", "1")
+	if _, ok := WatchdogInterval(); ok && os.Getpid() != 1 {
+		t.Error("WatchdogInterval() for another PID = true, want false")
+	}
+}
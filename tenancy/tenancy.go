@@ -0,0 +1,64 @@
+// Package tenancy decides which tenant each request acts for, so a
+// storage.TenantStore can keep tenants' records apart. The tenant is the
+// tenant claim of the request's token when it has one, and otherwise the
+// X-Tenant-ID header of an authenticated request.
+package tenancy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Claim is the token claim naming the tenant a token was issued for.
+const Claim = "tenant"
+
+// validTenant matches acceptable tenant names.
+var validTenant = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Middleware stores the tenant of each request in its context with
+// storage.WithTenant. Requests sending a bearer token or API key are
+// authenticated by verifier, on every route, so their tenant claim can be
+// trusted. The X-Tenant-ID header is only accepted from authenticated
+// requests whose token names no tenant: anyone else could name any tenant
+// with it, so unauthenticated requests sending it get 401. Requests naming
+// an invalid tenant, or a tenant other than their token's, are rejected.
+// Requests whose path admin accepts may name none and then run
+// storage.Unscoped; requests elsewhere that name none are left to fail at
+// the first tenant-scoped query.
+func Middleware(verifier *auth.Verifier, admin func(path string) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return verifier.Optional(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := strings.TrimSpace(r.Header.Get(analytics.TenantHeader))
+			claims, authenticated := auth.FromContext(r.Context())
+			if claimed, _ := claims[Claim].(string); claimed != "" {
+				if tenant != "" && tenant != claimed {
+					respond.Error(w, http.StatusForbidden, "token is for another tenant than "+analytics.TenantHeader)
+					return
+				}
+				tenant = claimed
+			} else if tenant != "" && !authenticated {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				respond.Error(w, http.StatusUnauthorized, analytics.TenantHeader+" needs a bearer token or API key")
+				return
+			}
+			ctx := r.Context()
+			switch {
+			case tenant != "":
+				if !validTenant.MatchString(tenant) {
+					respond.Error(w, http.StatusBadRequest, "invalid "+analytics.TenantHeader)
+					return
+				}
+				ctx = storage.WithTenant(ctx, tenant)
+			case admin != nil && admin(r.URL.Path):
+				ctx = storage.Unscoped(ctx)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}))
+	}
+}
@@ -0,0 +1,73 @@
+package tenancy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/analytics"
+	"github.com/Shulammite-Aso/bazel-demo-app/auth"
+	"github.com/Shulammite-Aso/bazel-demo-app/routes"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestMiddleware checks where the tenant comes from, that only
+// authenticated requests may name one by header, and that admin paths
+// without one run unscoped.
+func TestMiddleware(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{SigningKey: "default", Keys: map[string]auth.Key{"default": {Secret: []byte(auth.DevSecret)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := verifier.Issue(jwt.MapClaims{"sub": "wile", Claim: "globex"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewTenantStore(storage.NewMemory(), "greetings")
+	var got string
+	h := Middleware(verifier, routes.Match("/admin/*"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = storage.TenantFrom(r.Context())
+		if _, err := store.List(r.Context(), "greetings", storage.ListOptions{}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+	tests := []struct {
+		name, path, header, token string
+		claims                    jwt.MapClaims
+		status                    int
+		tenant                    string
+	}{
+		{"header without a token", "/greetings", "acme", "", nil, http.StatusUnauthorized, ""},
+		{"header with a token", "/greetings", "acme", "", jwt.MapClaims{"sub": "ops"}, http.StatusOK, "acme"},
+		{"claim", "/greetings", "", "", jwt.MapClaims{Claim: "globex"}, http.StatusOK, "globex"},
+		{"claim and matching header", "/greetings", "globex", "", jwt.MapClaims{Claim: "globex"}, http.StatusOK, "globex"},
+		{"claim and other header", "/greetings", "acme", "", jwt.MapClaims{Claim: "globex"}, http.StatusForbidden, ""},
+		{"bearer token", "/greetings", "", token, nil, http.StatusOK, "globex"},
+		{"bearer token and other header", "/greetings", "acme", token, nil, http.StatusForbidden, ""},
+		{"invalid token", "/greetings", "acme", "not-a-token", nil, http.StatusUnauthorized, ""},
+		{"invalid", "/greetings", "../acme", "", jwt.MapClaims{"sub": "ops"}, http.StatusBadRequest, ""},
+		{"none", "/greetings", "", "", nil, http.StatusInternalServerError, ""},
+		{"admin", "/admin/stats", "", "", nil, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		got = ""
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(analytics.TenantHeader, tt.header)
+		}
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if tt.claims != nil {
+			req = req.WithContext(auth.NewContext(req.Context(), tt.claims))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status || got != tt.tenant {
+			t.Errorf("%s: GET %s = %d with tenant %q, want %d with %q", tt.name, tt.path, rec.Code, got, tt.status, tt.tenant)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package testserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/handlers"
+)
+
+// TestAdvance checks that records created through the API are stamped
+// with the server's clock.
+func TestAdvance(t *testing.T) {
+	srv := New(t)
+	create := func() string {
+		t.Helper()
+		resp, err := srv.Client.Post(srv.URL+"/greetings", "application/json", strings.NewReader(`{"name":"Gladys","message":"Hello, Gladys!"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("POST /greetings: status %d, want 201", resp.StatusCode)
+		}
+		var body struct {
+			CreatedAt struct {
+				RFC3339 string `json:"rfc3339"`
+			} `json:"created_at"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.CreatedAt.RFC3339
+	}
+	if got, want := create(), Epoch.Format(time.RFC3339); got != want {
+		t.Errorf("created_at = %s, want %s", got, want)
+	}
+	srv.Advance(time.Hour)
+	if got, want := create(), Epoch.Add(time.Hour).Format(time.RFC3339); got != want {
+		t.Errorf("created_at after Advance(1h) = %s, want %s", got, want)
+	}
+}
+
+// TestStore checks that data seeded through Store is served.
+func TestStore(t *testing.T) {
+	srv := New(t)
+	value, _ := json.Marshal(handlers.SavedGreeting{Name: "Derin", Message: "Hi, Derin!"})
+	if _, err := srv.Store().Create(context.Background(), handlers.GreetingsCollection, "seeded", value); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client.Get(srv.URL + "/greetings/seeded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /greetings/seeded: status %d, want 200", resp.StatusCode)
+	}
+}
+
+// TestSeed checks that seeded greetings are listed, and that the same seed
+// seeds the same greetings.
+func TestSeed(t *testing.T) {
+	a, b := New(t), New(t)
+	recs := a.Seed(t, 1, 3)
+	if string(recs[2].Data) != string(b.Seed(t, 1, 3)[2].Data) {
+		t.Errorf("Seed(1, 3) differs between servers")
+	}
+	resp, err := a.Client.Get(a.URL + "/greetings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var page []struct {
+		ID string `json:"id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&page)
+	if len(page) != 3 || page[0].ID != "greeting-000" {
+		t.Errorf("GET /greetings after Seed(1, 3) = %+v, want greeting-000 to greeting-002", page)
+	}
+}
+
+// TestFlushCache checks that flushing empties the cache.
+func TestFlushCache(t *testing.T) {
+	srv := New(t)
+	srv.mem.Cache.Set(context.Background(), "k", "v", 0)
+	srv.FlushCache()
+	if n := srv.mem.Cache.Len(); n != 0 {
+		t.Errorf("Len() after FlushCache = %d, want 0", n)
+	}
+}
+
+// TestToken checks that tokens from Token open protected routes.
+func TestToken(t *testing.T) {
+	srv := New(t)
+	req, _ := http.NewRequest("GET", srv.URL+"/greet-many?name=Gladys", nil)
+	req.Header.Set("Authorization", "Bearer "+srv.Token(t, jwt.MapClaims{"user": "gladys"}))
+	resp, err := srv.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /greet-many with a token: status %d, want 200", resp.StatusCode)
+	}
+}
+
+// TestLogin logs in as an added user and checks that the token opens
+// protected routes until it expires by the server's clock.
+func TestLogin(t *testing.T) {
+	srv := New(t)
+	srv.AddUser(t, "gladys", "hunter2", nil)
+	resp, err := srv.Client.Post(srv.URL+"/login", "application/json", strings.NewReader(`{"username":"gladys","password":"hunter2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var login struct {
+		AccessToken string `json:"access_token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&login)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /login: status %d, want 200", resp.StatusCode)
+	}
+
+	greet := func() int {
+		req, _ := http.NewRequest("GET", srv.URL+"/greet-many?name=Gladys", nil)
+		req.Header.Set("Authorization", "Bearer "+login.AccessToken)
+		resp, err := srv.Client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := greet(); got != http.StatusOK {
+		t.Errorf("GET /greet-many with the login token: status %d, want 200", got)
+	}
+	srv.Advance(2 * time.Hour)
+	if got := greet(); got != http.StatusUnauthorized {
+		t.Errorf("GET /greet-many with the login token 2h later: status %d, want 401", got)
+	}
+}
@@ -0,0 +1,238 @@
+// Package timeout bounds how long a handler may take. Each request's
+// context gets a deadline, so storage and upstream calls made with it are
+// canceled; if the handler hasn't responded by then, the client gets a 504
+// instead of waiting on it.
+package timeout
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/routes"
+)
+
+// DefaultTimeout is the default deadline for routes without an override.
+const DefaultTimeout = 30 * time.Second
+
+var timeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_request_timeouts_total",
+	Help: "Requests answered with 504 because their handler ran past its deadline, by route template.",
+}, []string{"route"})
+
+// Config sets the deadlines.
+type Config struct {
+	// Default is the deadline of routes Routes doesn't name. Zero or less
+	// means none.
+	Default time.Duration
+	// Routes overrides the deadline by route pattern, as routes.Match
+	// takes them: /greet, /admin/* or *. The most specific pattern
+	// matching a route wins. Zero or less means no deadline, for routes
+	// that stream.
+	Routes map[string]time.Duration
+}
+
+// For returns the deadline of the route template path.
+func (c Config) For(path string) time.Duration {
+	d, best := c.Default, -1
+	for p, t := range c.Routes {
+		if rank := specificity(p); rank > best && routes.Match(p)(path) {
+			d, best = t, rank
+		}
+	}
+	return d
+}
+
+// specificity ranks p so an exact path beats any prefix, a longer prefix
+// beats a shorter one, and * comes last.
+func specificity(p string) int {
+	switch {
+	case p == "*":
+		return 0
+	case strings.HasSuffix(p, "/*"):
+		return len(p)
+	}
+	return 1 << 20
+}
+
+// Middleware runs handlers under the deadline cfg sets for their route
+// and answers 504 for those that haven't written a response when it
+// passes. A handler that already started its response keeps it, and only
+// sees its context canceled. Install it inside the router, where the
+// route is known.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := "unmatched"
+			if cur := mux.CurrentRoute(r); cur != nil {
+				if tmpl, err := cur.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+			d := cfg.For(route)
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{w: w, header: make(http.Header), ctx: ctx}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				// Re-raised here, for recovery to handle.
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+				// A client hanging up isn't a timeout; ctxerr counts those.
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) && tw.timeOut() {
+					timeouts.WithLabelValues(route).Inc()
+					logrus.WithContext(r.Context()).WithFields(logrus.Fields{
+						"method":  r.Method,
+						"path":    r.URL.Path,
+						"route":   route,
+						"timeout": d,
+					}).Warn("handler timed out")
+					respond.Error(w, http.StatusGatewayTimeout, "the request took longer than "+d.String())
+					return
+				}
+				// The response was started, or the client left; either way
+				// the handler finishes it.
+				select {
+				case p := <-panicked:
+					panic(p)
+				case <-done:
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter passes the handler's response through until the deadline,
+// and drops it after a 504 was sent in its place. The handler gets its
+// own header map, copied into the response when it writes, so the 504
+// doesn't race with it.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	ctx    context.Context
+
+	mu       sync.Mutex
+	wrote    bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// expired reports whether the response timed out, marking it so if the
+// deadline passed before the handler started it; a handler woken by its
+// context may get here before Middleware does. The caller holds mu.
+func (tw *timeoutWriter) expired() bool {
+	if !tw.wrote && errors.Is(tw.ctx.Err(), context.DeadlineExceeded) {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
+
+// writeHeader copies the handler's headers and sends status. The caller
+// holds mu.
+func (tw *timeoutWriter) writeHeader(status int) {
+	if tw.wrote {
+		return
+	}
+	tw.wrote = true
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return
+	}
+	tw.writeHeader(status)
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(p)
+}
+
+// timeOut marks the response timed out, if the handler hasn't started
+// it, and reports whether it is.
+func (tw *timeoutWriter) timeOut() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.wrote {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
+
+// Flush lets streamed responses through.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return
+	}
+	tw.writeHeader(http.StatusOK)
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through. A hijacked connection counts as
+// a started response, so it never gets a 504.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expired() {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	conn, rw, err := http.NewResponseController(tw.w).Hijack()
+	if err == nil {
+		tw.wrote = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap gives http.ResponseController the underlying writer.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
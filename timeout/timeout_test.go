@@ -0,0 +1,93 @@
+package timeout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// TestFor checks that the most specific pattern sets a route's deadline.
+func TestFor(t *testing.T) {
+	cfg := Config{Default: time.Second, Routes: map[string]time.Duration{
+		"*":              2 * time.Second,
+		"/admin/*":       3 * time.Second,
+		"/admin/usage/*": 4 * time.Second,
+		"/changes":       0,
+	}}
+	for path, want := range map[string]time.Duration{
+		"/greet":                  2 * time.Second,
+		"/admin/audit":            3 * time.Second,
+		"/admin/usage/export.csv": 4 * time.Second,
+		"/changes":                0,
+	} {
+		if got := cfg.For(path); got != want {
+			t.Errorf("For(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if got := (Config{Default: time.Second}).For("/greet"); got != time.Second {
+		t.Errorf("For(/greet) without overrides = %v, want the default", got)
+	}
+}
+
+// TestMiddleware checks that a slow handler gets a 504 and a canceled
+// context, that a fast one is untouched, and that routes without a
+// deadline are let run.
+func TestMiddleware(t *testing.T) {
+	canceled := make(chan error, 1)
+	router := mux.NewRouter()
+	router.Use(Middleware(Config{Default: 20 * time.Millisecond, Routes: map[string]time.Duration{"/stream": 0}}))
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			canceled <- r.Context().Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+		w.Header().Set("X-Slow", "1")
+		w.Write([]byte("late"))
+	}
+	router.HandleFunc("/slow", slow)
+	router.HandleFunc("/stream", slow)
+	router.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/slow", nil))
+	if rec.Code != http.StatusGatewayTimeout || rec.Header().Get("X-Slow") != "" {
+		t.Errorf("GET /slow = %d %v, want 504 without the handler's headers", rec.Code, rec.Header())
+	}
+	if err := <-canceled; err != context.DeadlineExceeded {
+		t.Errorf("slow handler's context error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/fast", nil))
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Fast") != "1" {
+		t.Errorf("GET /fast = %d %v, want 201 with X-Fast", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/stream", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "late" {
+		t.Errorf("GET /stream = %d %q, want 200 late", rec.Code, rec.Body)
+	}
+}
+
+// TestMiddlewareStarted checks that a response started before the
+// deadline is kept.
+func TestMiddlewareStarted(t *testing.T) {
+	h := Middleware(Config{Default: 20 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		<-r.Context().Done()
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/job", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("GET /job = %d, want the 202 written before the deadline", rec.Code)
+	}
+}
@@ -0,0 +1,7 @@
+#!/usr/bin/env bash
+# Prints the stamp values for release builds; see the release config in
+# .bazelrc. buildinfo reports them at /version/integrity.
+set -euo pipefail
+
+echo "STABLE_GIT_COMMIT $(git rev-parse HEAD 2>/dev/null || echo unknown)"
+echo "STABLE_VERSION $(git describe --tags --always --dirty 2>/dev/null || echo dev)"
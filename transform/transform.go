@@ -0,0 +1,340 @@
+// Package transform applies hooks to responses on their way out: adding
+// headers, rewriting JSON fields, or injecting deprecation notices, set up
+// per route in configuration. Cross-cutting tweaks then don't need changes
+// to every handler.
+//
+// Hooked responses are buffered so they can be rewritten. Responses that
+// flush before they end, such as event streams, are passed through
+// untouched once they do.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Response is a buffered response a hook can change.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IsJSON reports whether the response has a JSON body.
+func (resp *Response) IsJSON() bool {
+	return strings.Contains(resp.Header.Get("Content-Type"), "json") && len(resp.Body) > 0
+}
+
+// Hook changes a response.
+type Hook func(r *http.Request, resp *Response) error
+
+// Spec configures one hook. Which fields apply depends on Type.
+type Spec struct {
+	Type    string `mapstructure:"type"`
+	Header  string `mapstructure:"header"`
+	Field   string `mapstructure:"field"`
+	To      string `mapstructure:"to"`
+	Value   string `mapstructure:"value"`
+	Message string `mapstructure:"message"`
+}
+
+// Builder makes a hook from its spec.
+type Builder func(Spec) (Hook, error)
+
+var (
+	buildersMu sync.RWMutex
+	builders   = map[string]Builder{
+		"deprecation":   buildDeprecation,
+		"remove_field":  buildRemoveField,
+		"remove_header": buildRemoveHeader,
+		"rename_field":  buildRenameField,
+		"set_field":     buildSetField,
+		"set_header":    buildSetHeader,
+	}
+)
+
+// Register makes a hook type available to configuration. Registering a
+// type twice replaces the builder.
+func Register(typ string, b Builder) {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	builders[typ] = b
+}
+
+// Types returns the registered hook types, sorted.
+func Types() []string {
+	buildersMu.RLock()
+	defer buildersMu.RUnlock()
+	return typesLocked()
+}
+
+// Build makes the hooks of specs, in order. JSON bodies rewritten by
+// field hooks are re-encoded with their object keys sorted.
+func Build(specs []Spec) ([]Hook, error) {
+	buildersMu.RLock()
+	defer buildersMu.RUnlock()
+	hooks := make([]Hook, 0, len(specs))
+	for i, s := range specs {
+		b, ok := builders[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("transform: hook %d: unknown type %q (have %s)", i, s.Type, strings.Join(typesLocked(), ", "))
+		}
+		h, err := b(s)
+		if err != nil {
+			return nil, fmt.Errorf("transform: hook %d (%s): %w", i, s.Type, err)
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, nil
+}
+
+// typesLocked is Types for callers holding buildersMu.
+func typesLocked() []string {
+	var out []string
+	for t := range builders {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Routes holds the hooks of each route, by route path template.
+type Routes map[string][]Hook
+
+// NewRoutes builds the hooks configured for each route.
+func NewRoutes(specs map[string][]Spec) (Routes, error) {
+	routes := make(Routes, len(specs))
+	for path, s := range specs {
+		hooks, err := Build(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(hooks) > 0 {
+			routes[path] = hooks
+		}
+	}
+	return routes, nil
+}
+
+// Middleware applies the hooks of the matched route. It needs the matched
+// route, so it goes inside the router.
+func (routes Routes) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var hooks []Hook
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tmpl, err := cur.GetPathTemplate(); err == nil {
+				hooks = routes[tmpl]
+			}
+		}
+		if len(hooks) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bw := &bufferedWriter{w: w, status: http.StatusOK}
+		next.ServeHTTP(bw, r)
+		if bw.streaming {
+			return
+		}
+		resp := &Response{Status: bw.status, Header: w.Header(), Body: bw.body.Bytes()}
+		for _, h := range hooks {
+			if err := h(r, resp); err != nil {
+				logrus.WithContext(r.Context()).WithError(err).WithField("path", r.URL.Path).Warn("transform: response hook failed; skipping it")
+			}
+		}
+		// The body may have changed length.
+		resp.Header.Del("Content-Length")
+		w.WriteHeader(resp.Status)
+		w.Write(resp.Body)
+	})
+}
+
+// bufferedWriter holds a response back until the handler is done, or
+// until it flushes, after which it passes everything through.
+type bufferedWriter struct {
+	w         http.ResponseWriter
+	status    int
+	wrote     bool
+	streaming bool
+	body      bytes.Buffer
+}
+
+func (bw *bufferedWriter) Header() http.Header { return bw.w.Header() }
+
+func (bw *bufferedWriter) WriteHeader(code int) {
+	if bw.streaming {
+		bw.w.WriteHeader(code)
+		return
+	}
+	if !bw.wrote {
+		bw.status, bw.wrote = code, true
+	}
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	if bw.streaming {
+		return bw.w.Write(b)
+	}
+	bw.wrote = true
+	return bw.body.Write(b)
+}
+
+func (bw *bufferedWriter) Flush() {
+	if !bw.streaming {
+		bw.streaming = true
+		bw.w.WriteHeader(bw.status)
+		bw.w.Write(bw.body.Bytes())
+		bw.body = bytes.Buffer{}
+	}
+	if f, ok := bw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func buildSetHeader(s Spec) (Hook, error) {
+	if s.Header == "" {
+		return nil, fmt.Errorf("header is required")
+	}
+	return func(r *http.Request, resp *Response) error {
+		resp.Header.Set(s.Header, s.Value)
+		return nil
+	}, nil
+}
+
+func buildRemoveHeader(s Spec) (Hook, error) {
+	if s.Header == "" {
+		return nil, fmt.Errorf("header is required")
+	}
+	return func(r *http.Request, resp *Response) error {
+		resp.Header.Del(s.Header)
+		return nil
+	}, nil
+}
+
+// buildSetField sets field to value, which is parsed as JSON when it is
+// valid JSON and used as a string otherwise.
+func buildSetField(s Spec) (Hook, error) {
+	if s.Field == "" {
+		return nil, fmt.Errorf("field is required")
+	}
+	var value interface{} = s.Value
+	if err := json.Unmarshal([]byte(s.Value), &value); err != nil {
+		value = s.Value
+	}
+	return rewrite(func(obj map[string]interface{}) {
+		setPath(obj, s.Field, value)
+	}), nil
+}
+
+func buildRemoveField(s Spec) (Hook, error) {
+	if s.Field == "" {
+		return nil, fmt.Errorf("field is required")
+	}
+	return rewrite(func(obj map[string]interface{}) {
+		if parent, key := lookupParent(obj, s.Field); parent != nil {
+			delete(parent, key)
+		}
+	}), nil
+}
+
+func buildRenameField(s Spec) (Hook, error) {
+	if s.Field == "" || s.To == "" {
+		return nil, fmt.Errorf("field and to are required")
+	}
+	return rewrite(func(obj map[string]interface{}) {
+		parent, key := lookupParent(obj, s.Field)
+		if parent == nil {
+			return
+		}
+		if v, ok := parent[key]; ok {
+			delete(parent, key)
+			setPath(obj, s.To, v)
+		}
+	}), nil
+}
+
+// buildDeprecation warns clients through a Warning header and, for JSON
+// object bodies, a deprecation_notice field.
+func buildDeprecation(s Spec) (Hook, error) {
+	if s.Message == "" {
+		return nil, fmt.Errorf("message is required")
+	}
+	setField := rewrite(func(obj map[string]interface{}) {
+		obj["deprecation_notice"] = s.Message
+	})
+	return func(r *http.Request, resp *Response) error {
+		resp.Header.Add("Warning", "299 - "+strconv.Quote(s.Message))
+		return setField(r, resp)
+	}, nil
+}
+
+// rewrite returns a hook applying edit to a JSON object body, or to each
+// object of a JSON array body. Other bodies are left alone.
+func rewrite(edit func(map[string]interface{})) Hook {
+	return func(r *http.Request, resp *Response) error {
+		if !resp.IsJSON() {
+			return nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(resp.Body))
+		// Keep numbers as written, so large IDs survive the round trip.
+		dec.UseNumber()
+		var body interface{}
+		if err := dec.Decode(&body); err != nil {
+			return err
+		}
+		switch v := body.(type) {
+		case map[string]interface{}:
+			edit(v)
+		case []interface{}:
+			for _, item := range v {
+				if obj, ok := item.(map[string]interface{}); ok {
+					edit(obj)
+				}
+			}
+		default:
+			return nil
+		}
+		out, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		resp.Body = append(out, '\n')
+		return nil
+	}
+}
+
+// lookupParent returns the object holding the last segment of a dotted
+// path, and that segment, or nil if the path doesn't exist.
+func lookupParent(obj map[string]interface{}, path string) (map[string]interface{}, string) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := obj[p].(map[string]interface{})
+		if !ok {
+			return nil, ""
+		}
+		obj = next
+	}
+	return obj, parts[len(parts)-1]
+}
+
+// setPath sets a dotted path, creating intermediate objects.
+func setPath(obj map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := obj[p].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			obj[p] = next
+		}
+		obj = next
+	}
+	obj[parts[len(parts)-1]] = value
+}
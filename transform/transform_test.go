@@ -0,0 +1,99 @@
+package transform
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestRouter serves body as JSON at /greetings/{id} and as an event
+// stream at /stream, with hooks per route.
+func newTestRouter(t *testing.T, specs map[string][]Spec, body string) *mux.Router {
+	routes, err := NewRoutes(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	router.Use(routes.Middleware)
+	router.HandleFunc("/greetings/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", "999")
+		io.WriteString(w, body)
+	})
+	router.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+		w.(http.Flusher).Flush()
+	})
+	return router
+}
+
+// TestMiddleware checks each built-in hook on a matched route, and that
+// other routes and streams are left alone.
+func TestMiddleware(t *testing.T) {
+	const body = `{"id":"1","message":"Hi","meta":{"lang":"en"},"big":12345678901234567890}` + "\n"
+	tests := []struct {
+		name string
+		spec Spec
+		want string
+	}{
+		{"set_field", Spec{Type: "set_field", Field: "meta.source", Value: `"cache"`},
+			`{"big":12345678901234567890,"id":"1","message":"Hi","meta":{"lang":"en","source":"cache"}}`},
+		{"set_field plain string", Spec{Type: "set_field", Field: "kind", Value: "greeting"},
+			`{"big":12345678901234567890,"id":"1","kind":"greeting","message":"Hi","meta":{"lang":"en"}}`},
+		{"remove_field", Spec{Type: "remove_field", Field: "meta.lang"},
+			`{"big":12345678901234567890,"id":"1","message":"Hi","meta":{}}`},
+		{"rename_field", Spec{Type: "rename_field", Field: "message", To: "text"},
+			`{"big":12345678901234567890,"id":"1","meta":{"lang":"en"},"text":"Hi"}`},
+		{"deprecation", Spec{Type: "deprecation", Message: "use /v2/greetings"},
+			`{"big":12345678901234567890,"deprecation_notice":"use /v2/greetings","id":"1","message":"Hi","meta":{"lang":"en"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, map[string][]Spec{"/greetings/{id}": {tt.spec}}, body)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("GET", "/greetings/1", nil))
+			if got := rec.Body.String(); got != tt.want+"\n" {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+			if rec.Header().Get("Content-Length") != "" {
+				t.Errorf("Content-Length = %q, want it dropped", rec.Header().Get("Content-Length"))
+			}
+		})
+	}
+
+	router := newTestRouter(t, map[string][]Spec{
+		"/greetings/{id}": {{Type: "set_header", Header: "X-Greeting", Value: "yes"}, {Type: "deprecation", Message: "old"}},
+		"/stream":         {{Type: "remove_field", Field: "id"}},
+	}, body)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/greetings/1", nil))
+	if rec.Header().Get("X-Greeting") != "yes" || rec.Header().Get("Warning") != `299 - "old"` {
+		t.Errorf("headers = %v, want X-Greeting and Warning", rec.Header())
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/stream", nil))
+	if rec.Body.String() != body {
+		t.Errorf("streamed body = %s, want it untouched", rec.Body)
+	}
+}
+
+// TestBuild checks that bad specs are refused and new types can be
+// registered.
+func TestBuild(t *testing.T) {
+	for _, s := range []Spec{{Type: "nope"}, {Type: "set_header"}, {Type: "rename_field", Field: "a"}} {
+		if _, err := Build([]Spec{s}); err == nil {
+			t.Errorf("Build(%+v) = nil error, want an error", s)
+		}
+	}
+	Register("test_status", func(Spec) (Hook, error) {
+		return func(r *http.Request, resp *Response) error { resp.Status = http.StatusTeapot; return nil }, nil
+	})
+	hooks, err := Build([]Spec{{Type: "test_status"}})
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("Build(test_status) = %d hooks, %v", len(hooks), err)
+	}
+}
@@ -0,0 +1,104 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// Local returns the local synthesizer: espeak-ng or espeak if either is
+// installed, and Tone otherwise, so audio can always be produced.
+func Local() Provider {
+	for _, name := range []string{"espeak-ng", "espeak"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return &Espeak{Path: path, Fallback: Tone{}}
+		}
+	}
+	return Tone{}
+}
+
+// Espeak synthesizes speech with the espeak-ng (or espeak) command, whose
+// voices are language tags such as "en" or "fr".
+type Espeak struct {
+	Path string
+	// Fallback, if set, synthesizes speech when the command fails, such
+	// as for a voice espeak doesn't have.
+	Fallback Provider
+}
+
+var _ Provider = (*Espeak)(nil)
+
+func (p *Espeak) Synthesize(ctx context.Context, text, voice string) (Audio, error) {
+	var out, stderr bytes.Buffer
+	// The text goes on stdin, so text starting with "-" isn't read as a
+	// flag.
+	cmd := exec.CommandContext(ctx, p.Path, "--stdout", "-v", strings.ToLower(voice))
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		err = fmt.Errorf("tts: %s: %w: %s", p.Path, err, strings.TrimSpace(stderr.String()))
+		if p.Fallback != nil && ctx.Err() == nil {
+			return p.Fallback.Synthesize(ctx, text, voice)
+		}
+		return Audio{}, err
+	}
+	return Audio{ContentType: "audio/wav", Data: out.Bytes()}, nil
+}
+
+// Tone parameters: 16-bit mono PCM at 8kHz, a tone per letter or digit
+// and a pause per space or punctuation mark.
+const (
+	toneRate    = 8000
+	toneLength  = toneRate * 7 / 100 // 70ms
+	pauseLength = toneRate * 4 / 100 // 40ms
+	toneRamp    = toneRate * 5 / 1000
+)
+
+// Tone is a stand-in synthesizer needing nothing installed: it renders
+// text as a WAV of tones, vowels low and other letters high, so every
+// text has distinct, deterministic audio. It ignores the voice.
+type Tone struct{}
+
+func (Tone) Synthesize(ctx context.Context, text, voice string) (Audio, error) {
+	var samples []int16
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			samples = append(samples, make([]int16, pauseLength)...)
+			continue
+		}
+		lower := unicode.ToLower(r)
+		freq := 560 + 20*float64(lower%20)
+		if strings.ContainsRune("aeiouy", lower) {
+			freq = 220 + 30*float64(lower%10)
+		}
+		for i := 0; i < toneLength; i++ {
+			gain := math.Min(1, float64(min(i, toneLength-1-i))/toneRamp)
+			samples = append(samples, int16(gain*8000*math.Sin(2*math.Pi*freq*float64(i)/toneRate)))
+		}
+	}
+	return Audio{ContentType: "audio/wav", Data: wav(samples)}, nil
+}
+
+// wav encodes 16-bit mono samples at toneRate as a WAV file.
+func wav(samples []int16) []byte {
+	var b bytes.Buffer
+	size := uint32(2 * len(samples))
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, 36+size)
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, binary.LittleEndian, struct {
+		ChunkSize                 uint32
+		Format, Channels          uint16
+		Rate, ByteRate            uint32
+		BlockAlign, BitsPerSample uint16
+	}{16, 1, 1, toneRate, 2 * toneRate, 2, 16})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, size)
+	binary.Write(&b, binary.LittleEndian, samples)
+	return b.Bytes()
+}
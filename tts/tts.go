@@ -0,0 +1,186 @@
+// Package tts speaks greetings. A Speaker synthesizes text through a
+// pluggable Provider, such as a hosted TTS API, falls back to a local
+// synthesizer when the provider fails, and keeps the audio in an object
+// store so each text and voice is synthesized once.
+package tts
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/objectstore"
+)
+
+// Where audio came from, the source label of tts_audio_total.
+const (
+	SourceCache    = "cache"
+	SourceProvider = "provider"
+	SourceFallback = "fallback"
+)
+
+// ErrVoice is returned for voice names that aren't a language tag or
+// voice identifier.
+var ErrVoice = errors.New("tts: voice must be letters, digits, '-', '_' or '+', up to 32 characters")
+
+var voicePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_+-]{0,31}$`)
+
+var audioServed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "tts_audio_total",
+	Help: "Audio greetings served, by whether they came from the cache, the provider, or the local fallback.",
+}, []string{"source"})
+
+// Audio is synthesized speech.
+type Audio struct {
+	ContentType string
+	Data        []byte
+}
+
+// Provider synthesizes text spoken in voice, a language tag such as
+// "fr" or a provider's own voice name.
+type Provider interface {
+	Synthesize(ctx context.Context, text, voice string) (Audio, error)
+}
+
+// ProviderFunc adapts a function to Provider.
+type ProviderFunc func(ctx context.Context, text, voice string) (Audio, error)
+
+func (f ProviderFunc) Synthesize(ctx context.Context, text, voice string) (Audio, error) {
+	return f(ctx, text, voice)
+}
+
+// Speaker synthesizes speech and caches it.
+type Speaker struct {
+	// Provider synthesizes speech; nil uses Fallback alone.
+	Provider Provider
+	// Fallback synthesizes speech when Provider fails; by default it is
+	// Local().
+	Fallback Provider
+	// Store caches audio under tts/, keyed by text and voice.
+	Store objectstore.Store
+}
+
+// NewSpeaker returns a Speaker using provider, which may be nil, with the
+// local fallback and store.
+func NewSpeaker(provider Provider, store objectstore.Store) *Speaker {
+	return &Speaker{Provider: provider, Fallback: Local(), Store: store}
+}
+
+// Key is where the audio of text in voice is stored.
+func Key(text, voice string) string {
+	sum := sha256.Sum256([]byte(voice + "\x00" + text))
+	return "tts/" + hex.EncodeToString(sum[:])
+}
+
+// Speak returns a stream of text spoken in voice, with its type and size,
+// from the store or else synthesized and stored. The caller closes it.
+func (s *Speaker) Speak(ctx context.Context, text, voice string) (io.ReadCloser, objectstore.Info, error) {
+	if !voicePattern.MatchString(voice) {
+		return nil, objectstore.Info{}, ErrVoice
+	}
+	key := Key(text, voice)
+	rc, info, err := s.Store.Get(ctx, key)
+	if err == nil {
+		audioServed.WithLabelValues(SourceCache).Inc()
+		return rc, info, nil
+	}
+	if !errors.Is(err, objectstore.ErrNotFound) {
+		logrus.WithContext(ctx).WithError(err).Warn("tts: reading cached audio")
+	}
+
+	audio, source, err := s.synthesize(ctx, text, voice)
+	if err != nil {
+		return nil, objectstore.Info{}, err
+	}
+	if err := s.Store.Put(ctx, key, audio.ContentType, bytes.NewReader(audio.Data)); err != nil {
+		logrus.WithContext(ctx).WithError(err).Warn("tts: caching audio")
+	}
+	audioServed.WithLabelValues(source).Inc()
+	return io.NopCloser(bytes.NewReader(audio.Data)), objectstore.Info{ContentType: audio.ContentType, Size: int64(len(audio.Data))}, nil
+}
+
+// synthesize runs the provider, or the fallback if it fails, and says
+// which produced the audio.
+func (s *Speaker) synthesize(ctx context.Context, text, voice string) (Audio, string, error) {
+	if s.Provider != nil {
+		audio, err := s.Provider.Synthesize(ctx, text, voice)
+		if err == nil {
+			return audio, SourceProvider, nil
+		}
+		if s.Fallback == nil {
+			return Audio{}, "", err
+		}
+		logrus.WithContext(ctx).WithError(err).Warn("tts: provider failed; using the local fallback")
+	}
+	fallback := s.Fallback
+	if fallback == nil {
+		fallback = Local()
+	}
+	audio, err := fallback.Synthesize(ctx, text, voice)
+	return audio, SourceFallback, err
+}
+
+// Remote is a hosted TTS API. It is POSTed {"text": ..., "voice": ...}
+// and answers with the audio, typed by its Content-Type.
+type Remote struct {
+	URL string
+	// Token is sent as a bearer token, if set.
+	Token string
+	// Client makes the calls; nil uses a client with a 10s timeout.
+	Client *http.Client
+}
+
+var _ Provider = (*Remote)(nil)
+
+// maxAudio bounds the audio read from a provider.
+const maxAudio = 10 << 20
+
+func (p *Remote) Synthesize(ctx context.Context, text, voice string) (Audio, error) {
+	body, _ := json.Marshal(map[string]string{"text": text, "voice": voice})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return Audio{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "audio/*")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Audio{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return Audio{}, fmt.Errorf("%s: %s: %s", p.URL, resp.Status, msg)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAudio+1))
+	if err != nil {
+		return Audio{}, fmt.Errorf("%s: reading audio: %w", p.URL, err)
+	}
+	if len(data) > maxAudio {
+		return Audio{}, fmt.Errorf("%s: audio is over %d bytes", p.URL, maxAudio)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return Audio{ContentType: contentType, Data: data}, nil
+}
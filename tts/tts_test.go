@@ -0,0 +1,103 @@
+package tts
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/objectstore"
+)
+
+// TestSpeakerCaches checks that each text and voice is synthesized once,
+// and that invalid voices are rejected.
+func TestSpeakerCaches(t *testing.T) {
+	calls := 0
+	provider := ProviderFunc(func(ctx context.Context, text, voice string) (Audio, error) {
+		calls++
+		return Audio{ContentType: "audio/mpeg", Data: []byte(voice + ":" + text)}, nil
+	})
+	s := NewSpeaker(provider, objectstore.NewMemory(0, 0))
+	ctx := context.Background()
+	for _, voice := range []string{"fr", "fr", "en"} {
+		rc, info, err := s.Speak(ctx, "Bonjour, Gladys!", voice)
+		if err != nil {
+			t.Fatalf("Speak(%s) = %v", voice, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if want := voice + ":Bonjour, Gladys!"; string(got) != want || info.ContentType != "audio/mpeg" || info.Size != int64(len(want)) {
+			t.Errorf("Speak(%s) = %q, %+v, want %q as audio/mpeg", voice, got, info, want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("provider called %d times, want 2 with audio cached", calls)
+	}
+	if _, _, err := s.Speak(ctx, "Hi", "-v evil"); !errors.Is(err, ErrVoice) {
+		t.Errorf("Speak() with a bad voice = %v, want ErrVoice", err)
+	}
+}
+
+// TestSpeakerFallback checks that a failing provider falls back to the
+// local synthesizer.
+func TestSpeakerFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	s := &Speaker{Provider: &Remote{URL: srv.URL}, Fallback: Tone{}, Store: objectstore.NewMemory(0, 0)}
+	rc, info, err := s.Speak(context.Background(), "Hello, Gladys!", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	head := make([]byte, 4)
+	io.ReadFull(rc, head)
+	if string(head) != "RIFF" || info.ContentType != "audio/wav" {
+		t.Errorf("Speak() = %q..., %+v, want the WAV fallback", head, info)
+	}
+}
+
+// TestRemote checks the request sent to a TTS API and the audio read
+// back.
+func TestRemote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/ogg")
+		io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+	audio, err := (&Remote{URL: srv.URL, Token: "secret"}).Synthesize(context.Background(), "Hi", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"text":"Hi","voice":"en"}`; string(audio.Data) != want || audio.ContentType != "audio/ogg" {
+		t.Errorf("Synthesize() = %q as %s, want %q as audio/ogg", audio.Data, audio.ContentType, want)
+	}
+	if _, err := (&Remote{URL: srv.URL}).Synthesize(context.Background(), "Hi", "en"); err == nil {
+		t.Error("Synthesize() without the token = nil error, want one")
+	}
+}
+
+// TestTone checks that Tone renders a well-formed WAV whose length
+// follows the text.
+func TestTone(t *testing.T) {
+	audio, _ := Tone{}.Synthesize(context.Background(), "Hi, Al", "en")
+	data := audio.Data
+	if len(data) < 44 || string(data[:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " || string(data[36:40]) != "data" {
+		t.Fatalf("Tone() header = %q, want a WAV header", data[:min(len(data), 44)])
+	}
+	samples := 4*toneLength + 2*pauseLength
+	if got := binary.LittleEndian.Uint32(data[40:44]); got != uint32(2*samples) || len(data) != 44+2*samples {
+		t.Errorf("Tone() data size = %d (%d bytes in all), want %d", got, len(data), 2*samples)
+	}
+	if got := binary.LittleEndian.Uint32(data[4:8]); got != uint32(len(data)-8) {
+		t.Errorf("Tone() RIFF size = %d, want %d", got, len(data)-8)
+	}
+}
@@ -0,0 +1,163 @@
+// Package txn runs each write request in a storage transaction, so a
+// handler making several writes, such as a bulk import, either keeps all
+// of them or none. The transaction commits when the handler responds with
+// a 2xx status and rolls back otherwise, or if it panics. Handlers reach it
+// through the request context with Store.
+package txn
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Results counted in storage_transactions_total.
+const (
+	ResultCommitted  = "committed"
+	ResultRolledBack = "rolled_back"
+	// ResultFailed is a transaction whose commit or rollback failed.
+	ResultFailed = "failed"
+)
+
+var transactions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "storage_transactions_total",
+	Help: "Request-scoped storage transactions by result.",
+}, []string{"result"})
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying tx.
+func NewContext(ctx context.Context, tx storage.Tx) context.Context {
+	return context.WithValue(ctx, contextKey{}, tx)
+}
+
+// FromContext returns the transaction stored in ctx by Middleware.
+func FromContext(ctx context.Context) (tx storage.Tx, ok bool) {
+	tx, ok = ctx.Value(contextKey{}).(storage.Tx)
+	return tx, ok
+}
+
+// Store returns the request's transaction, or fallback for requests not
+// running in one.
+func Store(ctx context.Context, fallback storage.Store) storage.Store {
+	if tx, ok := FromContext(ctx); ok {
+		return tx
+	}
+	return fallback
+}
+
+// Middleware runs requests other than GET, HEAD and OPTIONS in a
+// transaction on store. The transaction finishes when the handler sets
+// its status, before anything reaches the client, so a failed commit is
+// reported as a 500 in place of the handler's response.
+func Middleware(store storage.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			tx, err := storage.Begin(r.Context(), store)
+			if err != nil {
+				logrus.WithContext(r.Context()).WithError(err).Error("txn: beginning transaction")
+				respond.Error(w, http.StatusServiceUnavailable, "storage is unavailable")
+				return
+			}
+			tw := &txWriter{ResponseWriter: w, tx: tx, ctx: context.WithoutCancel(r.Context())}
+			defer func() {
+				if p := recover(); p != nil {
+					if !tw.done {
+						tw.finish(http.StatusInternalServerError)
+					}
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(tw, r.WithContext(NewContext(r.Context(), tx)))
+			if !tw.done {
+				// Nothing was written, which net/http sends as 200.
+				tw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+// txWriter finishes the transaction when the handler's status is known.
+type txWriter struct {
+	http.ResponseWriter
+	tx storage.Tx
+	// ctx outlives the request, so a client hanging up doesn't stop the
+	// commit or rollback.
+	ctx  context.Context
+	done bool
+	// failed is set when the commit failed and the handler's response is
+	// being replaced.
+	failed bool
+}
+
+// finish commits tx if status is 2xx and rolls it back otherwise. It
+// reports false if the commit failed; a failed rollback is only logged, as
+// the response is an error already.
+func (w *txWriter) finish(status int) bool {
+	w.done = true
+	if status < 200 || status >= 300 {
+		if err := w.tx.Rollback(w.ctx); err != nil {
+			transactions.WithLabelValues(ResultFailed).Inc()
+			logrus.WithContext(w.ctx).WithError(err).WithField("status", status).Error("txn: rolling back")
+			return true
+		}
+		transactions.WithLabelValues(ResultRolledBack).Inc()
+		return true
+	}
+	if err := w.tx.Commit(w.ctx); err != nil {
+		transactions.WithLabelValues(ResultFailed).Inc()
+		logrus.WithContext(w.ctx).WithError(err).WithField("status", status).Error("txn: committing")
+		return false
+	}
+	transactions.WithLabelValues(ResultCommitted).Inc()
+	return true
+}
+
+func (w *txWriter) WriteHeader(code int) {
+	if w.done || code < 200 {
+		if !w.failed {
+			w.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	if !w.finish(code) {
+		w.failed = true
+		// The handler's headers describe a write that didn't happen.
+		for _, h := range []string{"ETag", "Location", "Last-Modified"} {
+			w.Header().Del(h)
+		}
+		respond.Error(w.ResponseWriter, http.StatusInternalServerError, "committing the transaction failed")
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *txWriter) Write(b []byte) (int, error) {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *txWriter) Flush() {
+	if !w.done {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.failed {
+		f.Flush()
+	}
+}
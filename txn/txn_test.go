@@ -0,0 +1,97 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// failingCommit is a store whose native transactions can't commit; as in
+// a database, a failed commit keeps none of the writes.
+type failingCommit struct {
+	storage.Store
+}
+
+func (s failingCommit) Begin(ctx context.Context) (storage.Tx, error) {
+	tx, err := storage.Begin(ctx, s.Store)
+	return badTx{tx}, err
+}
+
+type badTx struct {
+	storage.Tx
+}
+
+func (t badTx) Commit(ctx context.Context) error {
+	t.Tx.Rollback(ctx)
+	return errors.New("disk full")
+}
+
+// TestMiddleware writes a record and then responds with each status, and
+// checks the write is kept only for 2xx responses.
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		status     int
+		panics     bool
+		failCommit bool
+		kept       bool
+		wantStatus int
+	}{
+		{"created", "POST", http.StatusCreated, false, false, true, http.StatusCreated},
+		{"no status", "POST", 0, false, false, true, http.StatusOK},
+		{"bad request", "POST", http.StatusBadRequest, false, false, false, http.StatusBadRequest},
+		{"conflict", "PUT", http.StatusConflict, false, false, false, http.StatusConflict},
+		{"panic", "POST", 0, true, false, false, 0},
+		{"commit fails", "POST", http.StatusCreated, false, true, false, http.StatusInternalServerError},
+		// GET isn't wrapped, so its writes are kept whatever it responds.
+		{"GET", "GET", http.StatusBadRequest, false, false, true, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		mem := storage.NewMemory()
+		var store storage.Store = mem
+		if tt.failCommit {
+			store = failingCommit{mem}
+		}
+		h := Middleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, inTx := FromContext(r.Context())
+			if inTx == (r.Method == "GET") {
+				t.Errorf("%s: in a transaction = %t", tt.name, inTx)
+			}
+			if _, err := Store(r.Context(), store).Create(r.Context(), "c", "id", []byte(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.panics {
+				panic("handler bug")
+			}
+			w.Header().Set("Location", "/c/id")
+			if tt.status != 0 {
+				w.WriteHeader(tt.status)
+			}
+			w.Write([]byte(`{"id":"id"}`))
+		}))
+
+		rec := httptest.NewRecorder()
+		func() {
+			defer func() {
+				if p := recover(); p != nil && !tt.panics {
+					t.Errorf("%s: panic %v", tt.name, p)
+				}
+			}()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/c", nil))
+		}()
+		if tt.wantStatus != 0 && rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.wantStatus)
+		}
+		if tt.failCommit && (rec.Header().Get("Location") != "" || rec.Body.String() == `{"id":"id"}`) {
+			t.Errorf("%s: response = %v %s, want the handler's replaced", tt.name, rec.Header(), rec.Body)
+		}
+		if _, err := mem.Get(context.Background(), "c", "id"); (err == nil) != tt.kept {
+			t.Errorf("%s: record kept = %t, want %t", tt.name, err == nil, tt.kept)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package upstream makes outbound HTTP calls. Every call takes a context so
+// it stops when the caller gives up.
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/antchfx/xmlquery"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/ctxerr"
+)
+
+// Client fetches documents from upstream services.
+type Client struct {
+	HTTP *http.Client
+}
+
+// New returns a Client using http.DefaultClient.
+func New() *Client {
+	return &Client{HTTP: http.DefaultClient}
+}
+
+// LoadXML fetches url and parses the body as XML.
+func (c *Client) LoadXML(ctx context.Context, url string) (*xmlquery.Node, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		ctxerr.Record(ctx, "upstream", err)
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	doc, err := xmlquery.Parse(resp.Body)
+	if err != nil {
+		ctxerr.Record(ctx, "upstream", err)
+		return nil, fmt.Errorf("parsing %s: %w", url, err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,47 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/fixtures"
+)
+
+// TestLoadXML fetches the corpus documents from a test server and
+// compares what is parsed out of them with golden files.
+func TestLoadXML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(fixtures.Read(t, strings.TrimPrefix(r.URL.Path, "/")))
+	}))
+	defer srv.Close()
+	c := &Client{HTTP: srv.Client()}
+
+	tests := []struct {
+		doc, xpath, golden string
+	}{
+		{"xml/wadl.xml", "//resource/@path", "upstream/wadl-resources.txt"},
+		{"xml/slideshow.xml", "//slide/title", "upstream/slideshow-titles.txt"},
+	}
+	for _, tt := range tests {
+		doc, err := c.LoadXML(context.Background(), srv.URL+"/"+tt.doc)
+		if err != nil {
+			t.Errorf("LoadXML(%s) = %v", tt.doc, err)
+			continue
+		}
+		var out strings.Builder
+		for _, n := range xmlquery.Find(doc, tt.xpath) {
+			out.WriteString(n.InnerText() + "\n")
+		}
+		fixtures.Golden(t, tt.golden, []byte(out.String()))
+	}
+
+	if _, err := c.LoadXML(context.Background(), srv.URL+"/xml/malformed.xml"); err == nil {
+		t.Error("LoadXML(malformed.xml) = nil error, want a parse error")
+	}
+}
@@ -0,0 +1,192 @@
+// Package useragent parses User-Agent headers into structured client
+// information (browser, OS, device class, bots) and fingerprints clients,
+// so logs, analytics, and rate limits can tell them apart.
+package useragent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// Device classes.
+const (
+	Desktop       = "desktop"
+	Mobile        = "mobile"
+	Tablet        = "tablet"
+	Bot           = "bot"
+	HealthChecker = "health_checker"
+	Unknown       = "unknown"
+)
+
+var requestsByDevice = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_by_device_total",
+	Help: "Requests by client device class (desktop, mobile, tablet, bot, health_checker, unknown).",
+}, []string{"device"})
+
+// DefaultHealthCheckers are User-Agent substrings of load balancers and
+// uptime monitors. They are matched case-insensitively.
+var DefaultHealthCheckers = []string{
+	"kube-probe",
+	"ELB-HealthChecker",
+	"GoogleHC",
+	"Consul Health Check",
+	"UptimeRobot",
+	"Pingdom",
+	"StatusCake",
+}
+
+// botPattern matches common crawler and automation tokens.
+var botPattern = regexp.MustCompile(`(?i)(bot|crawl|spider|slurp|curl|wget|python-requests|go-http-client|httpclient|headless)`)
+
+// Client is what we know about the software that sent a request.
+type Client struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	Device         string `json:"device"`
+	// Bot is true for crawlers, scripts, and health checkers.
+	Bot bool `json:"bot"`
+	// Fingerprint is a stable hash of the User-Agent and the Accept
+	// headers. It is not unique per user, only per client build and setup.
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Fields returns c as log fields.
+func (c Client) Fields() logrus.Fields {
+	f := logrus.Fields{"device": c.Device}
+	if c.Browser != "" {
+		f["browser"] = c.Browser
+	}
+	if c.OS != "" {
+		f["os"] = c.OS
+	}
+	return f
+}
+
+// browsers are checked in order; Edge and Opera UAs also contain
+// "Chrome", and Chrome UAs contain "Safari".
+var browsers = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`OPR/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+}
+
+// systems are checked in order; Android UAs also contain "Linux".
+var systems = []struct {
+	name, token string
+}{
+	{"Windows", "Windows"},
+	{"iOS", "iPhone"},
+	{"iOS", "iPad"},
+	{"Android", "Android"},
+	{"macOS", "Mac OS X"},
+	{"ChromeOS", "CrOS"},
+	{"Linux", "Linux"},
+}
+
+// Parser parses User-Agent headers.
+type Parser struct {
+	healthCheckers []string
+}
+
+// NewParser returns a parser that classifies User-Agents containing any of
+// healthCheckers, case-insensitively, as health checkers.
+func NewParser(healthCheckers []string) *Parser {
+	p := &Parser{}
+	for _, hc := range healthCheckers {
+		p.healthCheckers = append(p.healthCheckers, strings.ToLower(hc))
+	}
+	return p
+}
+
+// Parse classifies ua. It leaves Fingerprint empty.
+func (p *Parser) Parse(ua string) Client {
+	c := Client{Device: Unknown}
+	if ua == "" {
+		return c
+	}
+	lower := strings.ToLower(ua)
+	for _, hc := range p.healthCheckers {
+		if strings.Contains(lower, hc) {
+			c.Device, c.Bot = HealthChecker, true
+			return c
+		}
+	}
+	if botPattern.MatchString(ua) {
+		c.Device, c.Bot = Bot, true
+		return c
+	}
+
+	for _, b := range browsers {
+		if m := b.re.FindStringSubmatch(ua); m != nil {
+			c.Browser, c.BrowserVersion = b.name, m[1]
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(ua, s.token) {
+			c.OS = s.name
+			break
+		}
+	}
+	switch {
+	case strings.Contains(ua, "iPad") || (strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile")):
+		c.Device = Tablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone"):
+		c.Device = Mobile
+	case c.Browser != "" || c.OS != "":
+		c.Device = Desktop
+	}
+	return c
+}
+
+// Fingerprint hashes the request headers that describe the client
+// software.
+func Fingerprint(r *http.Request) string {
+	h := sha256.New()
+	for _, name := range []string{"User-Agent", "Accept", "Accept-Language", "Accept-Encoding"} {
+		h.Write([]byte(r.Header.Get(name)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying c.
+func NewContext(ctx context.Context, c Client) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the client stored in ctx by Middleware, or an
+// Unknown client if there is none.
+func FromContext(ctx context.Context) Client {
+	if c, ok := ctx.Value(contextKey{}).(Client); ok {
+		return c
+	}
+	return Client{Device: Unknown}
+}
+
+// Middleware parses the User-Agent of every request, stores the client in
+// the request context, and counts requests by device class.
+func (p *Parser) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := p.Parse(r.UserAgent())
+		c.Fingerprint = Fingerprint(r)
+		requestsByDevice.WithLabelValues(c.Device).Inc()
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), c)))
+	})
+}
@@ -0,0 +1,61 @@
+package useragent
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParse checks browser, OS, and device detection for common agents,
+// and that health checkers win over the generic bot rule.
+func TestParse(t *testing.T) {
+	p := NewParser(DefaultHealthCheckers)
+	tests := []struct {
+		ua   string
+		want Client
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			Client{Browser: "Edge", BrowserVersion: "120.0.2210.91", OS: "Windows", Device: Desktop},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			Client{Browser: "Safari", BrowserVersion: "17.2", OS: "iOS", Device: Mobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			Client{Browser: "Chrome", BrowserVersion: "120.0.0.0", OS: "Android", Device: Tablet},
+		},
+		{
+			"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			Client{Browser: "Firefox", BrowserVersion: "121.0", OS: "Linux", Device: Desktop},
+		},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", Client{Device: Bot, Bot: true}},
+		{"curl/8.4.0", Client{Device: Bot, Bot: true}},
+		{"kube-probe/1.29", Client{Device: HealthChecker, Bot: true}},
+		{"ELB-HealthChecker/2.0", Client{Device: HealthChecker, Bot: true}},
+		{"", Client{Device: Unknown}},
+	}
+	for _, tt := range tests {
+		if got := p.Parse(tt.ua); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+// TestFingerprint checks that the fingerprint follows the client headers
+// and nothing else.
+func TestFingerprint(t *testing.T) {
+	a := httptest.NewRequest("GET", "/greet", nil)
+	a.Header.Set("User-Agent", "curl/8.4.0")
+	b := httptest.NewRequest("GET", "/greetings?page=2", nil)
+	b.Header.Set("User-Agent", "curl/8.4.0")
+	c := httptest.NewRequest("GET", "/greet", nil)
+	c.Header.Set("User-Agent", "curl/8.5.0")
+
+	if Fingerprint(a) != Fingerprint(b) {
+		t.Errorf("Fingerprint differs for the same client on different paths")
+	}
+	if Fingerprint(a) == Fingerprint(c) {
+		t.Errorf("Fingerprint(%q) == Fingerprint(%q), want different", "curl/8.4.0", "curl/8.5.0")
+	}
+}
@@ -0,0 +1,107 @@
+// Package watchdog watches the goroutine count of the running process and
+// raises an alert when it keeps climbing, which is what a goroutine leak
+// in a long-lived stream or job looks like.
+package watchdog
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	goroutineAlerts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "watchdog_goroutine_growth_alerts_total",
+		Help: "Times the goroutine count grew monotonically past the configured threshold.",
+	})
+	goroutineSample = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "watchdog_goroutines",
+		Help: "Goroutine count at the last watchdog sample.",
+	})
+)
+
+// Config controls when the watchdog alerts.
+type Config struct {
+	// Interval between samples.
+	Interval time.Duration
+	// Threshold is the goroutine count below which growth is ignored.
+	Threshold int
+	// Samples is how many consecutive increases are needed to alert.
+	Samples int
+}
+
+// DefaultConfig is used for zero fields of a Config.
+var DefaultConfig = Config{
+	Interval:  30 * time.Second,
+	Threshold: 1000,
+	Samples:   10,
+}
+
+// Watchdog samples the goroutine count on an interval.
+type Watchdog struct {
+	cfg   Config
+	count func() int
+
+	last  int
+	rises int
+}
+
+// New returns a Watchdog using cfg, with zero fields taken from
+// DefaultConfig.
+func New(cfg Config) *Watchdog {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultConfig.Interval
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultConfig.Threshold
+	}
+	if cfg.Samples <= 0 {
+		cfg.Samples = DefaultConfig.Samples
+	}
+	return &Watchdog{cfg: cfg, count: runtime.NumGoroutine}
+}
+
+// Run samples until ctx is canceled.
+func (w *Watchdog) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.sample()
+		}
+	}
+}
+
+// sample takes one reading and reports whether it raised an alert. After
+// an alert the streak starts over, so a steady leak alerts once every
+// Samples intervals rather than on every tick.
+func (w *Watchdog) sample() bool {
+	n := w.count()
+	goroutineSample.Set(float64(n))
+
+	if n > w.last && w.last != 0 {
+		w.rises++
+	} else {
+		w.rises = 0
+	}
+	w.last = n
+
+	if w.rises < w.cfg.Samples || n < w.cfg.Threshold {
+		return false
+	}
+	w.rises = 0
+	goroutineAlerts.Inc()
+	logrus.WithFields(logrus.Fields{
+		"goroutines": n,
+		"threshold":  w.cfg.Threshold,
+		"samples":    w.cfg.Samples,
+	}).Warn("goroutine count keeps growing; possible leak")
+	return true
+}
@@ -0,0 +1,27 @@
+package watchdog
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// TestSample feeds a scripted goroutine count through the watchdog and
+// checks when it alerts.
+func TestSample(t *testing.T) {
+	counts := []int{5, 6, 7, 8, 9, 10, 10, 11, 12, 13}
+	want := []bool{false, false, false, true, false, false, false, false, false, true}
+
+	w := New(Config{Threshold: 8, Samples: 3})
+	i := 0
+	w.count = func() int { return counts[i] }
+	for ; i < len(counts); i++ {
+		if got := w.sample(); got != want[i] {
+			t.Errorf("sample %d (count %d) = %v, want %v", i, counts[i], got, want[i])
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package webhooks delivers application events to subscriber URLs and keeps
+// a log of every delivery attempt.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// Storage collections used by the package.
+const (
+	SubscriptionsCollection = "webhooks"
+	DeliveriesCollection    = "webhook_deliveries"
+)
+
+// TestEvent is the type of events sent by the "send test event" action.
+const TestEvent = "webhook.test"
+
+// Headers set on every delivery. The signature is the hex HMAC-SHA256 of
+// the body keyed with the subscription secret, prefixed with "sha256=".
+const (
+	EventHeader     = "X-Webhook-Event"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// DeliveryTimeout bounds a single delivery attempt.
+const DeliveryTimeout = 10 * time.Second
+
+// Subscription is a stored webhook subscription.
+type Subscription struct {
+	URL string `json:"url" validate:"required,http_url"`
+	// Events lists the event types to deliver; "*" means all.
+	Events []string `json:"events" validate:"required,min=1,dive,required"`
+	// Secret signs deliveries. It is encrypted at rest.
+	Secret string `json:"secret" validate:"required,min=16" encrypt:"true"`
+	Active bool   `json:"active"`
+}
+
+// Wants reports whether the subscription should receive events of typ.
+func (s Subscription) Wants(typ string) bool {
+	if !s.Active {
+		return false
+	}
+	for _, e := range s.Events {
+		if e == "*" || e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is the log entry for one delivery attempt.
+type Delivery struct {
+	SubscriptionID string    `json:"subscription_id"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	Success        bool      `json:"success"`
+	Error          string    `json:"error,omitempty"`
+	DurationMS     int64     `json:"duration_ms"`
+	AttemptedAt    time.Time `json:"attempted_at"`
+}
+
+// Service delivers events to subscriptions stored in Store.
+type Service struct {
+	Store  storage.Store
+	Client *http.Client
+
+	wg sync.WaitGroup
+}
+
+// NewService returns a Service using store and NewClient.
+func NewService(store storage.Store) *Service {
+	return &Service{Store: store, Client: NewClient()}
+}
+
+// ErrPrivateAddress is the error of deliveries to addresses inside the
+// server's network.
+var ErrPrivateAddress = errors.New("webhooks: refusing to deliver to a private address")
+
+// blockedPrefixes are refused as well as the loopback, private,
+// link-local, unspecified and multicast addresses netip recognizes:
+// "this network" and carrier-grade NAT space.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// NewClient returns the client deliveries use by default. It refuses
+// connections to loopback, private and link-local addresses, cloud
+// metadata services such as 169.254.169.254 among them, as it dials them,
+// so neither a subscription's URL nor its DNS nor a redirect can point
+// deliveries into the server's network. It ignores proxy settings, as a
+// proxy would dial on its behalf.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DeliveryTimeout, Control: denyPrivate}
+	return &http.Client{Transport: &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: DeliveryTimeout,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	}}
+}
+
+// denyPrivate is a net.Dialer Control function refusing addresses inside
+// the server's network.
+func denyPrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	addr = addr.Unmap()
+	private := addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified()
+	for _, p := range blockedPrefixes {
+		private = private || p.Contains(addr)
+	}
+	if private {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addr)
+	}
+	return nil
+}
+
+// Sign returns the signature header value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscription loads the subscription with id.
+func (s *Service) Subscription(ctx context.Context, id string) (Subscription, storage.Record, error) {
+	var sub Subscription
+	rec, err := s.Store.Get(ctx, SubscriptionsCollection, id)
+	if err != nil {
+		return sub, rec, err
+	}
+	err = json.Unmarshal(rec.Data, &sub)
+	return sub, rec, err
+}
+
+// HandleEvent is an events.Handler that delivers e to every active
+// subscription that wants it. Deliveries run in the background; use Wait
+// to block until they finish.
+func (s *Service) HandleEvent(ctx context.Context, e events.Event) {
+	recs, err := s.Store.List(ctx, SubscriptionsCollection, storage.ListOptions{})
+	if err != nil {
+		logrus.WithError(err).Error("webhooks: listing subscriptions")
+		return
+	}
+	for _, rec := range recs {
+		var sub Subscription
+		if err := json.Unmarshal(rec.Data, &sub); err != nil || !sub.Wants(e.Type) {
+			continue
+		}
+		s.wg.Add(1)
+		go func(id string, sub Subscription) {
+			defer s.wg.Done()
+			// The request that caused the event may be long gone.
+			s.Deliver(context.Background(), id, sub, e)
+		}(rec.ID, sub)
+	}
+}
+
+// Wait blocks until background deliveries started by HandleEvent finish.
+func (s *Service) Wait() {
+	s.wg.Wait()
+}
+
+// Deliver sends e to sub and records the attempt in the delivery log.
+func (s *Service) Deliver(ctx context.Context, id string, sub Subscription, e events.Event) Delivery {
+	d := Delivery{SubscriptionID: id, EventID: e.ID, EventType: e.Type, AttemptedAt: time.Now().UTC()}
+	err := s.send(ctx, sub, e, &d)
+	d.DurationMS = time.Since(d.AttemptedAt).Milliseconds()
+	if err != nil {
+		d.Error = err.Error()
+	}
+
+	data, _ := json.Marshal(d)
+	if _, err := s.Store.Create(ctx, DeliveriesCollection, uuid.NewString(), data); err != nil {
+		logrus.WithError(err).WithField("subscription", id).Error("webhooks: recording delivery")
+	}
+	return d
+}
+
+func (s *Service) send(ctx context.Context, sub Subscription, e events.Event, d *Delivery) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, DeliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, e.Type)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	d.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+	d.Success = true
+	return nil
+}
+
+// Deliveries returns the delivery log of subscription id, oldest first.
+func (s *Service) Deliveries(ctx context.Context, id string) ([]Delivery, error) {
+	recs, err := s.Store.List(ctx, DeliveriesCollection, storage.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var out []Delivery
+	for _, rec := range recs {
+		var d Delivery
+		if err := json.Unmarshal(rec.Data, &d); err == nil && d.SubscriptionID == id {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
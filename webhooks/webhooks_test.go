@@ -0,0 +1,95 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/events"
+	"github.com/Shulammite-Aso/bazel-demo-app/storage"
+)
+
+// TestHandleEvent checks that matching subscriptions receive a signed
+// delivery, others don't, and every attempt is logged.
+func TestHandleEvent(t *testing.T) {
+	const secret = "0123456789abcdef"
+	got := make(chan *http.Request, 2)
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		got <- r
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	store := storage.NewMemory()
+	s := NewService(store)
+	// The subscriber is on loopback, which the default client refuses.
+	s.Client = srv.Client()
+	for id, sub := range map[string]Subscription{
+		"wanted":   {URL: srv.URL, Events: []string{events.GreetingCreated}, Secret: secret, Active: true},
+		"inactive": {URL: srv.URL, Events: []string{"*"}, Secret: secret},
+		"other":    {URL: srv.URL, Events: []string{events.GreetingDeleted}, Secret: secret, Active: true},
+	} {
+		data, _ := json.Marshal(sub)
+		store.Create(ctx, SubscriptionsCollection, id, data)
+	}
+
+	bus := events.NewBus()
+	bus.Subscribe(s.HandleEvent)
+	bus.Publish(ctx, events.GreetingCreated, map[string]string{"name": "Gladys"})
+	s.Wait()
+
+	if len(got) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(got))
+	}
+	r := <-got
+	if sig := r.Header.Get(SignatureHeader); sig != Sign(secret, body) {
+		t.Errorf("signature = %q, want %q", sig, Sign(secret, body))
+	}
+
+	log, err := s.Deliveries(ctx, "wanted")
+	if err != nil || len(log) != 1 || !log[0].Success || log[0].StatusCode != 200 {
+		t.Fatalf("Deliveries(wanted) = %+v, %v, want one successful delivery", log, err)
+	}
+}
+
+// TestPrivateAddresses checks that the default client refuses to deliver
+// into the server's network, whatever the URL looks like.
+func TestPrivateAddresses(t *testing.T) {
+	for address, refused := range map[string]bool{
+		"127.0.0.1:80":          true,
+		"[::1]:443":             true,
+		"[::ffff:127.0.0.1]:80": true,
+		"10.1.2.3:80":           true,
+		"192.168.0.10:8080":     true,
+		"169.254.169.254:80":    true,
+		"[fe80::1]:80":          true,
+		"[fd00::1]:80":          true,
+		"100.64.0.1:80":         true,
+		"0.0.0.0:80":            true,
+		"93.184.216.34:443":     false,
+		"[2606:4700::1]:443":    false,
+	} {
+		if err := denyPrivate("tcp", address, nil); errors.Is(err, ErrPrivateAddress) != refused {
+			t.Errorf("denyPrivate(%s) = %v, want refused %v", address, err, refused)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("delivery reached a loopback subscriber")
+	}))
+	defer srv.Close()
+	s := NewService(storage.NewMemory())
+	// localhost resolves to loopback only once dialed.
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	d := s.Deliver(context.Background(), "local", Subscription{URL: url, Secret: "0123456789abcdef"}, events.Event{Type: TestEvent})
+	if d.Success || d.StatusCode != 0 || !strings.Contains(d.Error, ErrPrivateAddress.Error()) {
+		t.Errorf("Deliver(%s) = %+v, want it refused", url, d)
+	}
+}
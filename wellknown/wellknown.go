@@ -0,0 +1,123 @@
+// Package wellknown serves the files browsers, crawlers, and security
+// researchers ask every site for (/robots.txt, /favicon.ico,
+// /.well-known/security.txt, /.well-known/change-password), so those
+// requests stop showing up as 404s. security.txt and change-password stay
+// 404 until configured, which is what clients expect from a site that has
+// neither.
+package wellknown
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Shulammite-Aso/bazel-demo-app/respond"
+)
+
+// Paths served by the package.
+const (
+	RobotsPath         = "/robots.txt"
+	FaviconPath        = "/favicon.ico"
+	SecurityTxtPath    = "/.well-known/security.txt"
+	ChangePasswordPath = "/.well-known/change-password"
+)
+
+// cacheControl lets clients and CDNs keep these files for a day.
+const cacheControl = "public, max-age=86400"
+
+// securityTxtLifetime is how far ahead generated security.txt files
+// expire. RFC 9116 recommends less than a year.
+const securityTxtLifetime = 180 * 24 * time.Hour
+
+var (
+	//go:embed robots.txt
+	defaultRobots []byte
+	//go:embed favicon.ico
+	defaultFavicon []byte
+)
+
+// Config says what to serve. File paths, when set, replace the embedded
+// defaults.
+type Config struct {
+	RobotsFile      string
+	FaviconFile     string
+	SecurityTxtFile string
+	// SecurityContact is the Contact line of the generated security.txt,
+	// such as "mailto:security@example.com". It is used when
+	// SecurityTxtFile is empty.
+	SecurityContact string
+	// ChangePasswordURL is where /.well-known/change-password redirects.
+	ChangePasswordURL string
+}
+
+// Handler serves the well-known files.
+type Handler struct {
+	robots, favicon, securityTxt []byte
+	changePassword               string
+}
+
+// New reads the files named in c.
+func New(c Config) (*Handler, error) {
+	h := &Handler{robots: defaultRobots, favicon: defaultFavicon, changePassword: c.ChangePasswordURL}
+	for _, f := range []struct {
+		path string
+		dst  *[]byte
+	}{
+		{c.RobotsFile, &h.robots},
+		{c.FaviconFile, &h.favicon},
+		{c.SecurityTxtFile, &h.securityTxt},
+	} {
+		if f.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, fmt.Errorf("wellknown: %w", err)
+		}
+		*f.dst = data
+	}
+	if h.securityTxt == nil && c.SecurityContact != "" {
+		h.securityTxt = []byte(fmt.Sprintf("Contact: %s\nExpires: %s\n",
+			c.SecurityContact, time.Now().Add(securityTxtLifetime).UTC().Format(time.RFC3339)))
+	}
+	return h, nil
+}
+
+func serve(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(body)
+}
+
+// Robots serves /robots.txt.
+func (h *Handler) Robots(w http.ResponseWriter, r *http.Request) {
+	serve(w, "text/plain; charset=utf-8", h.robots)
+}
+
+// Favicon serves /favicon.ico. A configured file may be an ICO or a PNG.
+func (h *Handler) Favicon(w http.ResponseWriter, r *http.Request) {
+	serve(w, http.DetectContentType(h.favicon), h.favicon)
+}
+
+// SecurityTxt serves /.well-known/security.txt, or 404 if no file or
+// contact is configured.
+func (h *Handler) SecurityTxt(w http.ResponseWriter, r *http.Request) {
+	if h.securityTxt == nil {
+		respond.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	serve(w, "text/plain; charset=utf-8", h.securityTxt)
+}
+
+// ChangePassword redirects to the configured change-password page, as
+// password managers expect, or responds 404 if there is none.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	if h.changePassword == "" {
+		respond.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+	http.Redirect(w, r, h.changePassword, http.StatusFound)
+}
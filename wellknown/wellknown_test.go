@@ -0,0 +1,68 @@
+package wellknown
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func get(h http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", path, nil))
+	return rec
+}
+
+// TestDefaults checks the embedded files and that unconfigured endpoints
+// are 404s.
+func TestDefaults(t *testing.T) {
+	h, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if rec := get(h.Robots, RobotsPath); !strings.Contains(rec.Body.String(), "User-agent: *") {
+		t.Errorf("robots.txt = %q, want the embedded file", rec.Body)
+	}
+	if rec := get(h.Favicon, FaviconPath); rec.Header().Get("Content-Type") != "image/x-icon" {
+		t.Errorf("favicon Content-Type = %q, want image/x-icon", rec.Header().Get("Content-Type"))
+	}
+	if rec := get(h.SecurityTxt, SecurityTxtPath); rec.Code != http.StatusNotFound {
+		t.Errorf("security.txt without contact = %d, want 404", rec.Code)
+	}
+	if rec := get(h.ChangePassword, ChangePasswordPath); rec.Code != http.StatusNotFound {
+		t.Errorf("change-password without URL = %d, want 404", rec.Code)
+	}
+}
+
+// TestConfigured checks file overrides, the generated security.txt, and
+// the change-password redirect.
+func TestConfigured(t *testing.T) {
+	robots := filepath.Join(t.TempDir(), "robots.txt")
+	os.WriteFile(robots, []byte("User-agent: *\nDisallow:\n"), 0o644)
+	h, err := New(Config{
+		RobotsFile:        robots,
+		SecurityContact:   "mailto:security@example.com",
+		ChangePasswordURL: "https://accounts.example.com/password",
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if rec := get(h.Robots, RobotsPath); rec.Body.String() != "User-agent: *\nDisallow:\n" {
+		t.Errorf("robots.txt = %q, want the configured file", rec.Body)
+	}
+	body := get(h.SecurityTxt, SecurityTxtPath).Body.String()
+	if !strings.Contains(body, "Contact: mailto:security@example.com\n") || !strings.Contains(body, "Expires: ") {
+		t.Errorf("security.txt = %q, want Contact and Expires", body)
+	}
+	rec := get(h.ChangePassword, ChangePasswordPath)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://accounts.example.com/password" {
+		t.Errorf("change-password = %d %q, want 302 to the configured URL", rec.Code, rec.Header().Get("Location"))
+	}
+
+	if _, err := New(Config{FaviconFile: "/does/not/exist.ico"}); err == nil {
+		t.Errorf("New() with a missing file error = nil, want error")
+	}
+}